@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"github.com/lionslon/go-keepass/internal/generator"
+	"strconv"
+	"strings"
+)
+
+const (
+	generatePassword   = "password"
+	generatePassphrase = "passphrase"
+
+	defaultPasswordClasses = "lower:1,upper:1,digits:1,symbols:1"
+)
+
+// readPassword запрашивает пароль, пустой ввод - сгенерировать пароль
+func readPassword(title string) (string, error) {
+	password := readLine(fmt.Sprintf(`%s (empty to generate)`, title))
+	if password != `` {
+		return password, nil
+	}
+
+	password, err := generate()
+	if err != nil {
+		return ``, err
+	}
+
+	fmt.Printf("generated: %s\n", password)
+	return password, nil
+}
+
+// generate запрашивает режим и правила генератора, создает пароль или фразу и выводит оценку энтропии
+func generate() (string, error) {
+	mode := readDefault(fmt.Sprintf(`generator mode (%s, %s)`, generatePassword, generatePassphrase), generatePassword)
+
+	var value string
+	var entropy float64
+	var err error
+	switch mode {
+	case generatePassword:
+		policy, policyErr := readPasswordPolicy()
+		if policyErr != nil {
+			return ``, policyErr
+		}
+		value, entropy, err = generator.Password(policy)
+	case generatePassphrase:
+		policy, policyErr := readPassphrasePolicy()
+		if policyErr != nil {
+			return ``, policyErr
+		}
+		value, entropy, err = generator.Passphrase(policy)
+	default:
+		return ``, fmt.Errorf("unknown generator mode %q", mode)
+	}
+	if err != nil {
+		return ``, err
+	}
+
+	fmt.Printf("entropy: %.1f bits (%s)\n", entropy, strength(entropy))
+	return value, nil
+}
+
+// readPasswordPolicy запрашивает правила пароля, пустой ввод оставляет значение по умолчанию.
+// Классы символов задаются списком с необязательным минимумом: lower:2,digits,symbols:1
+func readPasswordPolicy() (generator.PasswordPolicy, error) {
+	policy := generator.PasswordPolicy{}
+
+	length, err := strconv.Atoi(readDefault(`password length`, strconv.Itoa(generator.DefaultPasswordPolicy.Length)))
+	if err != nil {
+		return policy, fmt.Errorf("bad password length: %w", err)
+	}
+	policy.Length = length
+
+	classes := readDefault(`character classes with minimum counts (lower, upper, digits, symbols)`, defaultPasswordClasses)
+	for _, class := range strings.Split(classes, ",") {
+		name, count, hasCount := strings.Cut(strings.TrimSpace(class), ":")
+		minimum := 0
+		if hasCount {
+			if minimum, err = strconv.Atoi(count); err != nil {
+				return policy, fmt.Errorf("bad minimum of %s: %w", name, err)
+			}
+		}
+
+		switch name {
+		case `lower`:
+			policy.Lower, policy.MinLower = true, minimum
+		case `upper`:
+			policy.Upper, policy.MinUpper = true, minimum
+		case `digits`:
+			policy.Digits, policy.MinDigits = true, minimum
+		case `symbols`:
+			policy.Symbols, policy.MinSymbols = true, minimum
+		default:
+			return policy, fmt.Errorf("unknown character class %q", name)
+		}
+	}
+
+	policy.ExcludeAmbiguous = readLine(`exclude ambiguous characters like l, 1, O, 0 (y/n)`) == `y`
+
+	return policy, nil
+}
+
+// readPassphrasePolicy запрашивает правила парольной фразы, пустой ввод оставляет значение по умолчанию
+func readPassphrasePolicy() (generator.PassphrasePolicy, error) {
+	policy := generator.DefaultPassphrasePolicy
+
+	words, err := strconv.Atoi(readDefault(`number of words`, strconv.Itoa(policy.Words)))
+	if err != nil {
+		return policy, fmt.Errorf("bad number of words: %w", err)
+	}
+	policy.Words = words
+
+	policy.Separator = readDefault(`word separator ("space" for space)`, policy.Separator)
+	if policy.Separator == `space` {
+		policy.Separator = " "
+	}
+	policy.Capitalize = readLine(`capitalize words (y/n)`) == `y`
+	policy.Number = readLine(`add a digit (y/n)`) == `y`
+
+	return policy, nil
+}
+
+// readDefault запрашивает значение, пустой ввод - значение по умолчанию
+func readDefault(title, value string) string {
+	if line := readLine(fmt.Sprintf(`%s [%s]`, title, value)); line != `` {
+		return line
+	}
+	return value
+}
+
+// strength словесная оценка стойкости по энтропии
+func strength(entropy float64) string {
+	switch {
+	case entropy < 50:
+		return "weak"
+	case entropy < 75:
+		return "fair"
+	case entropy < 100:
+		return "strong"
+	}
+	return "very strong"
+}
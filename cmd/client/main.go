@@ -2,12 +2,20 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"github.com/lionslon/go-keepass/internal/client/app"
 	"github.com/lionslon/go-keepass/internal/client/config"
+	"github.com/lionslon/go-keepass/internal/models"
+	"io"
 	"log"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
+	"text/tabwriter"
+	"time"
 )
 
 var (
@@ -17,15 +25,211 @@ var (
 	reader *bufio.Reader
 )
 
+const (
+	listPageSize = 20 // размер страницы команды list
+)
+
 //go build -ldflags="-X 'main.Version=v1.0.0' -X 'app/build.Time=$(date)'"
 
 func readLine(title string) string {
 	fmt.Printf(`Enter %s: `, title)
-	line, _ := reader.ReadString('\n')
-	line = strings.TrimSuffix(line, "\r\n")
+	line, err := reader.ReadString('\n')
+	//Ввод закончился (Ctrl+D или конец перенаправленного файла) - завершаем работу
+	if err == io.EOF && line == `` {
+		fmt.Println()
+		os.Exit(0)
+	}
+	line = strings.TrimRight(line, "\r\n")
 	return line
 }
 
+func printDataList(items []app.EntryInfo) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "IDENTIFIER\tREVISION\tSIZE\tCREATED\tUPDATED\tTAGS")
+	for _, item := range items {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\t%s\n", item.Identifier, item.Revision, item.Size,
+			item.CreatedAt.Local().Format(time.DateTime), item.UpdatedAt.Local().Format(time.DateTime),
+			strings.Join(item.Meta.Tags, ","))
+	}
+	w.Flush()
+}
+
+func printTrashList(items []app.TrashEntry) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TRASH ID\tIDENTIFIER\tREVISION\tSIZE\tDELETED\tTAGS")
+	for _, item := range items {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\t%s\n", item.Id, item.Identifier, item.Revision, item.Size,
+			item.DeletedAt.Local().Format(time.DateTime), strings.Join(item.Meta.Tags, ","))
+	}
+	w.Flush()
+}
+
+func printShareList(list models.ShareList) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SHARE ID\tDIRECTION\tIDENTIFIER\tUSER\tPERMISSION\tACCEPTED\tCREATED")
+	for _, share := range list.Outgoing {
+		fmt.Fprintf(w, "%s\tto\t%s\t%s\t%s\t%t\t%s\n", share.Id, share.Identifier, share.Recipient, share.Permission,
+			share.Accepted, share.CreatedAt.Local().Format(time.DateTime))
+	}
+	for _, share := range list.Incoming {
+		fmt.Fprintf(w, "%s\tfrom\t%s\t%s\t%s\t%t\t%s\n", share.Id, share.Identifier, share.Owner, share.Permission,
+			share.Accepted, share.CreatedAt.Local().Format(time.DateTime))
+	}
+	w.Flush()
+}
+
+func printOrgList(orgs []models.Organization) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ORGANIZATION ID\tNAME\tROLE\tACCEPTED\tCREATED")
+	for _, org := range orgs {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%t\t%s\n", org.Id, org.Name, org.Role, org.Accepted,
+			org.CreatedAt.Local().Format(time.DateTime))
+	}
+	w.Flush()
+}
+
+func printMemberList(members []models.Member) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "LOGIN\tROLE\tACCEPTED\tINVITED")
+	for _, member := range members {
+		fmt.Fprintf(w, "%s\t%s\t%t\t%s\n", member.Login, member.Role, member.Accepted,
+			member.CreatedAt.Local().Format(time.DateTime))
+	}
+	w.Flush()
+}
+
+func printCollectionList(collections []models.Collection) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "COLLECTION ID\tNAME\tKEY VERSION\tCREATED")
+	for _, collection := range collections {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", collection.Id, collection.Name, collection.KeyVersion,
+			collection.CreatedAt.Local().Format(time.DateTime))
+	}
+	w.Flush()
+}
+
+func printFolderList(folders []models.Folder) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FOLDER\tENTRIES")
+	for _, folder := range folders {
+		fmt.Fprintf(w, "%s\t%d\n", folder.Path, folder.Entries)
+	}
+	w.Flush()
+}
+
+func printAttachmentList(attachments []models.Attachment) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tTYPE\tSIZE\tCREATED")
+	for _, attachment := range attachments {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", attachment.Name, attachment.MimeType, attachment.Size,
+			attachment.CreatedAt.Local().Format(time.DateTime))
+	}
+	w.Flush()
+}
+
+// printTree печатает дерево папки root: вложенные папки с количеством данных и данные с отступом по глубине
+func printTree(root string, folders []models.Folder, entries []app.EntryInfo) {
+	type node struct {
+		path    string
+		entries int64
+		folder  bool
+	}
+
+	nodes := make([]node, 0, len(folders)+len(entries))
+	for _, folder := range folders {
+		if models.InFolder(folder.Path, root) {
+			nodes = append(nodes, node{path: folder.Path, entries: folder.Entries, folder: true})
+		}
+	}
+	for _, entry := range entries {
+		nodes = append(nodes, node{path: entry.Identifier})
+	}
+
+	//Сравниваем пути по частям, чтобы содержимое папки шло сразу за ней
+	slices.SortFunc(nodes, func(a, b node) int {
+		return slices.Compare(strings.Split(a.path, models.FolderSeparator), strings.Split(b.path, models.FolderSeparator))
+	})
+
+	depth := 0
+	if root != `` {
+		depth = strings.Count(root, models.FolderSeparator) + 1
+	}
+	for _, n := range nodes {
+		indent := strings.Repeat("  ", strings.Count(n.path, models.FolderSeparator)-depth)
+		if n.folder {
+			fmt.Printf("%s%s/ (%d)\n", indent, models.BaseName(n.path), n.entries)
+			continue
+		}
+		fmt.Println(indent + models.BaseName(n.path))
+	}
+}
+
+// formatLimit занятое место с ограничением квоты, если оно есть
+func formatLimit(used, limit int64) string {
+	if limit == 0 {
+		return fmt.Sprintf("%d (unlimited)", used)
+	}
+	return fmt.Sprintf("%d of %d (%d%%)", used, limit, used*100/limit)
+}
+
+// promptTitle приглашение ввода команды с пользователем и признаком связи с сервером
+func promptTitle(status app.SyncStatus) string {
+	if status.User == `` {
+		return `command`
+	}
+
+	mode := "online"
+	if !status.Online {
+		mode = "offline"
+	}
+
+	return fmt.Sprintf("command [%s, %s]", status.User, mode)
+}
+
+// editFailed сообщает о неудачном изменении данных, false - изменение сохранено
+func editFailed(err error, message string) bool {
+	if conflict := new(app.ConflictError); errors.As(err, &conflict) {
+		fmt.Printf("conflict: %s\n", conflict)
+		if conflict.Pending {
+			fmt.Println("use conflicts and resolve commands to choose the version to keep")
+		}
+		return true
+	}
+	if errors.Is(err, app.ErrQueued) {
+		fmt.Println(err)
+		return true
+	}
+	if err != nil {
+		fmt.Printf("%s: %s\n", message, err)
+		return true
+	}
+	return false
+}
+
+// printImportResult выводит пропущенные при импорте записи и итог импорта
+func printImportResult(result app.ImportResult, dryRun bool) {
+	for _, line := range result.Malformed {
+		fmt.Printf("malformed %s\n", line)
+	}
+	for _, line := range result.Duplicates {
+		fmt.Printf("duplicate %s\n", line)
+	}
+	for _, line := range result.Skipped {
+		fmt.Printf("skipped %s\n", line)
+	}
+
+	imported := `imported`
+	if dryRun {
+		imported = `ready to import`
+		for _, identifier := range result.Imported {
+			fmt.Printf("%s\n", identifier)
+		}
+	}
+
+	fmt.Printf("%s: %d, duplicates: %d, malformed: %d, skipped: %d\n",
+		imported, len(result.Imported), len(result.Duplicates), len(result.Malformed), len(result.Skipped))
+}
+
 func main() {
 
 	reader = bufio.NewReader(os.Stdin)
@@ -40,10 +244,23 @@ func main() {
 		log.Fatalf("cannot initialize sender: %s\n", err)
 	}
 
+	//Курсор синхронизации для команды changes: изменения с ее прошлого вызова
+	var syncCursor int64
+
+	//Фоновая синхронизация запускается после входа пользователя и работает до выхода из клиента
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
 	for {
-		cmd := readLine(`command`)
+		for _, notice := range sender.Notices() {
+			fmt.Printf("sync: %s\n", notice)
+		}
+
+		cmd := readLine(promptTitle(sender.SyncStatus()))
 
 		switch cmd {
+		case `exit`:
+			return
 		case `register`:
 			login := readLine(`login`)
 			password := readLine(`password`)
@@ -55,6 +272,7 @@ func main() {
 			}
 
 			fmt.Println("user registration is successful")
+			sender.StartSync(ctx)
 		case `login`:
 			login := readLine(`login`)
 			password := readLine(`password`)
@@ -66,13 +284,19 @@ func main() {
 			}
 
 			fmt.Println("user login is successful")
+			sender.StartSync(ctx)
 		case `add_data`:
 			identifier := readLine(`data identifier`)
-			data := readLine(`data`)
-
-			err := sender.AddNewData(identifier, []byte(data))
+			record, err := readRecord()
 			if err != nil {
-				fmt.Printf("cannot add new user data: %s\n", err)
+				fmt.Printf("bad record: %s\n", err)
+				break
+			}
+
+			metadata := readMetadata(record.Type)
+
+			err = sender.AddRecord(identifier, record, metadata)
+			if editFailed(err, "cannot add new user data") {
 				break
 			}
 
@@ -80,13 +304,826 @@ func main() {
 		case `get_data`:
 			identifier := readLine(`data identifier`)
 
-			data, err := sender.GetUserData(identifier)
+			record, metadata, err := sender.GetRecord(identifier)
+			if err != nil {
+				fmt.Printf("cannot get user data: %s\n", err)
+				break
+			}
+
+			printRecord(record)
+			printMetadata(metadata)
+		case `otp`:
+			identifier := readLine(`data identifier`)
+
+			code, err := sender.OTP(identifier)
+			if err != nil {
+				fmt.Printf("cannot get otp code: %s\n", err)
+				break
+			}
+
+			if code.Kind == models.OTPTotp {
+				fmt.Printf("%s  %s (%ds remaining)\n", code.Code, code.Label, int(code.Remaining.Seconds()))
+			} else {
+				fmt.Printf("%s  %s (counter %d)\n", code.Code, code.Label, code.Counter)
+			}
+		case `upload_file`:
+			identifier := readLine(`data identifier`)
+			path := readLine(`file path`)
+			metadata := readMetadata(models.RecordBinary)
+
+			err := sender.UploadFile(identifier, path, metadata)
+			if editFailed(err, "cannot upload file") {
+				break
+			}
+
+			fmt.Println("file upload successful")
+		case `download_file`:
+			identifier := readLine(`data identifier`)
+			path := readLine(`path to save file`)
+
+			if err := sender.DownloadFile(identifier, path); err != nil {
+				fmt.Printf("cannot download file: %s\n", err)
+				break
+			}
+
+			fmt.Printf("saved to %s\n", path)
+		case `attach`:
+			identifier := readLine(`data identifier`)
+			path := readLine(`file path`)
+			name := readLine(`attachment name (optional, file name by default)`)
+
+			attachment, err := sender.Attach(identifier, path, name)
+			if err != nil {
+				fmt.Printf("cannot attach file: %s\n", err)
+				break
+			}
+
+			fmt.Printf("attached %s (%s, %d bytes)\n", attachment.Name, attachment.MimeType, attachment.Size)
+		case `list_attachments`:
+			identifier := readLine(`data identifier`)
+
+			attachments, err := sender.ListAttachments(identifier)
+			if err != nil {
+				fmt.Printf("cannot list attachments: %s\n", err)
+				break
+			}
+
+			printAttachmentList(attachments)
+		case `save_attachment`:
+			identifier := readLine(`data identifier`)
+			name := readLine(`attachment name`)
+			path := readLine(`path to save file`)
+
+			if err := sender.SaveAttachment(identifier, name, path); err != nil {
+				fmt.Printf("cannot save attachment: %s\n", err)
+				break
+			}
+
+			fmt.Printf("saved to %s\n", path)
+		case `detach`:
+			identifier := readLine(`data identifier`)
+			name := readLine(`attachment name`)
+
+			if err := sender.Detach(identifier, name); err != nil {
+				fmt.Printf("cannot delete attachment: %s\n", err)
+				break
+			}
+
+			fmt.Println("attachment deleted")
+		case `import_kdbx`:
+			path := readLine(`keepass database path`)
+			password := readLine(`database password`)
+			keyFile := readLine(`key file path (optional)`)
+
+			result, err := sender.ImportKeePass(path, password, keyFile)
+			if err != nil {
+				fmt.Printf("cannot import keepass database: %s\n", err)
+			}
+
+			printImportResult(result, false)
+		case `import_file`:
+			names := make([]string, 0, len(app.ImportFormats))
+			for _, format := range app.ImportFormats {
+				names = append(names, string(format))
+			}
+
+			format, err := app.ParseImportFormat(readLine(fmt.Sprintf(`file format (%s)`, strings.Join(names, `, `))))
+			if err != nil {
+				fmt.Printf("bad format: %s\n", err)
+				break
+			}
+			path := readLine(`file path`)
+			dryRun := readLine(`dry run, only check the file (y/n)`) == `y`
+
+			result, err := sender.ImportFile(format, path, dryRun)
+			if err != nil {
+				fmt.Printf("cannot import file: %s\n", err)
+			}
+
+			printImportResult(result, dryRun)
+		case `export_kdbx`:
+			path := readLine(`path to save keepass database`)
+			password := readLine(`database password`)
+			keyFile := readLine(`key file path (optional)`)
+
+			result, err := sender.ExportKeePass(path, password, keyFile)
+			for _, skipped := range result.Skipped {
+				fmt.Printf("skipped %s\n", skipped)
+			}
+			if err != nil {
+				fmt.Printf("cannot export keepass database: %s\n", err)
+				break
+			}
+
+			fmt.Printf("exported %d entries to %s\n", len(result.Exported), path)
+		case `export_secrets`:
+			names := make([]string, 0, len(app.SecretsFormats))
+			for _, format := range app.SecretsFormats {
+				names = append(names, string(format))
+			}
+
+			format, err := app.ParseSecretsFormat(readLine(fmt.Sprintf(`secrets format (%s)`, strings.Join(names, `, `))))
+			if err != nil {
+				fmt.Printf("bad format: %s\n", err)
+				break
+			}
+
+			var selection app.SecretsSelection
+			selection.Tag = readLine(`tag (optional)`)
+			selection.Folder = readLine(`folder (optional)`)
+			for _, identifier := range strings.Split(readLine(`identifiers separated by comma (optional)`), `,`) {
+				if identifier = strings.TrimSpace(identifier); identifier != `` {
+					selection.Identifiers = append(selection.Identifiers, identifier)
+				}
+			}
+
+			var name string
+			if format == app.SecretsKubernetes {
+				name = readLine(`kubernetes secret name`)
+			}
+			path := readLine(`path to save secrets`)
+
+			fmt.Printf("WARNING: secrets will be written to %s unencrypted, do not commit the file and delete it after use\n", path)
+			if readLine(`continue (y/n)`) != `y` {
+				break
+			}
+
+			result, err := sender.ExportSecrets(selection, format, path, name)
+			for _, skipped := range result.Skipped {
+				fmt.Printf("skipped %s\n", skipped)
+			}
+			if err != nil {
+				fmt.Printf("cannot export secrets: %s\n", err)
+				break
+			}
+
+			fmt.Printf("exported %d entries to %s\n", len(result.Exported), path)
+		case `backup`:
+			path := readLine(`path to save backup`)
+			password := readLine(`backup password`)
+			if readLine(`repeat backup password`) != password {
+				fmt.Println("passwords do not match")
+				break
+			}
+
+			count, err := sender.Backup(path, password)
+			if err != nil {
+				fmt.Printf("cannot backup user data: %s\n", err)
+				break
+			}
+
+			fmt.Printf("saved %d entries to %s\n", count, path)
+		case `restore_backup`:
+			path := readLine(`backup path`)
+			password := readLine(`backup password`)
+
+			result, err := sender.Restore(path, password)
+			if err != nil {
+				fmt.Printf("cannot restore backup: %s\n", err)
+			}
+
+			printImportResult(result, false)
+		case `edit_metadata`:
+			identifier := readLine(`data identifier`)
+
+			_, metadata, err := sender.GetRecord(identifier)
+			if err != nil {
+				fmt.Printf("cannot get user data: %s\n", err)
+				break
+			}
+
+			err = sender.UpdateMetadata(identifier, editMetadata(metadata))
+			if editFailed(err, "cannot update metadata") {
+				break
+			}
+
+			fmt.Println("metadata update successful")
+		case `find_tag`:
+			tag := readLine(`tag`)
+
+			entries, err := sender.FindByTag(tag)
+			if err != nil {
+				fmt.Printf("cannot find user data: %s\n", err)
+				break
+			}
+
+			printDataList(entries)
+			fmt.Printf("found: %d\n", len(entries))
+		case `list`:
+			folder := readLine(`folder (empty for all data)`)
+			sort := readLine(`sort field (identifier, created, updated, size)`)
+			if sort == `` {
+				sort = `identifier`
+			}
+			desc := readLine(`descending order (y/n)`) == `y`
+
+			for offset := 0; ; offset += listPageSize {
+				entries, total, err := sender.ListFolderEntries(folder, sort, desc, offset, listPageSize)
+				if err != nil {
+					fmt.Printf("cannot list user data: %s\n", err)
+					break
+				}
+
+				printDataList(entries)
+
+				if int64(offset+len(entries)) >= total || len(entries) == 0 {
+					fmt.Printf("total: %d\n", total)
+					break
+				}
+				if readLine(`next page (y/n)`) != `y` {
+					break
+				}
+			}
+		case `tree`:
+			folder := readLine(`folder (empty for all data)`)
+
+			folders, err := sender.ListFolders()
+			if err != nil {
+				fmt.Printf("cannot list folders: %s\n", err)
+				break
+			}
+
+			var entries []app.EntryInfo
+			for offset := 0; ; offset += listPageSize {
+				page, total, err := sender.ListFolderEntries(folder, `identifier`, false, offset, listPageSize)
+				if err != nil {
+					fmt.Printf("cannot list user data: %s\n", err)
+					break
+				}
+				entries = append(entries, page...)
+				if int64(offset+len(page)) >= total || len(page) == 0 {
+					break
+				}
+			}
+
+			printTree(folder, folders, entries)
+		case `list_folders`:
+			folders, err := sender.ListFolders()
+			if err != nil {
+				fmt.Printf("cannot list folders: %s\n", err)
+				break
+			}
+
+			printFolderList(folders)
+			fmt.Printf("total: %d\n", len(folders))
+		case `create_folder`:
+			path := readLine(`folder path`)
+
+			if err := sender.CreateFolder(path); err != nil {
+				fmt.Printf("cannot create folder: %s\n", err)
+				break
+			}
+
+			fmt.Println("folder created")
+		case `move_folder`:
+			from := readLine(`folder path`)
+			to := readLine(`new folder path`)
+
+			folder, err := sender.MoveFolder(from, to)
+			if err != nil {
+				fmt.Printf("cannot move folder: %s\n", err)
+				break
+			}
+
+			fmt.Printf("folder moved to %s with %d entries\n", folder.Path, folder.Entries)
+		case `delete_folder`:
+			path := readLine(`folder path`)
+			if readLine(`move folder and all its data to trash (y/n)`) != `y` {
+				break
+			}
+
+			folder, err := sender.DeleteFolder(path)
+			if err != nil {
+				fmt.Printf("cannot delete folder: %s\n", err)
+				break
+			}
+
+			fmt.Printf("folder deleted, %d entries moved to trash\n", folder.Entries)
+		case `move_data`:
+			from := readLine(`data identifier`)
+			to := readLine(`new data identifier`)
+
+			err := sender.MoveData(from, to)
+			if editFailed(err, "cannot move user data") {
+				break
+			}
+
+			fmt.Printf("user data moved to %s\n", to)
+		case `delete_data`:
+			identifier := readLine(`data identifier`)
+
+			err := sender.DeleteData(identifier)
+			if editFailed(err, "cannot delete user data") {
+				break
+			}
+
+			fmt.Println("user data moved to trash, use trash_restore to bring it back")
+		case `update_data`:
+			identifier := readLine(`data identifier`)
+			record, err := readRecord()
+			if err != nil {
+				fmt.Printf("bad record: %s\n", err)
+				break
+			}
+
+			err = sender.UpdateRecord(identifier, record, nil)
+			if editFailed(err, "cannot update user data") {
+				break
+			}
+
+			fmt.Println("user data update successful")
+		case `rotate_password`:
+			identifier := readLine(`data identifier`)
+
+			record, _, err := sender.GetRecord(identifier)
 			if err != nil {
 				fmt.Printf("cannot get user data: %s\n", err)
 				break
 			}
+			if record.Type != models.RecordCredentials {
+				fmt.Printf("%s is %s record, not credentials\n", identifier, record.Type)
+				break
+			}
+
+			password, err := readPassword(`new password`)
+			if err != nil {
+				fmt.Printf("cannot generate password: %s\n", err)
+				break
+			}
+
+			credentials := *record.Credentials
+			credentials.Password = password
+			record.Credentials = &credentials
+
+			err = sender.UpdateRecord(identifier, record, nil)
+			if editFailed(err, "cannot update user data") {
+				break
+			}
+
+			fmt.Println("password rotated, previous password is kept in history")
+		case `generate`:
+			value, err := generate()
+			if err != nil {
+				fmt.Printf("cannot generate: %s\n", err)
+				break
+			}
+
+			fmt.Println(value)
+		case `history`:
+			identifier := readLine(`data identifier`)
+
+			revisions, err := sender.GetDataHistory(identifier)
+			if err != nil {
+				fmt.Printf("cannot get user data history: %s\n", err)
+				break
+			}
+
+			for _, revision := range revisions {
+				fmt.Printf("%d\t%s\t%d bytes\n", revision.Revision, revision.CreatedAt.Local().Format(time.DateTime), revision.Size)
+			}
+		case `get_revision`:
+			identifier := readLine(`data identifier`)
+			revision, err := strconv.ParseInt(readLine(`revision`), 10, 64)
+			if err != nil {
+				fmt.Printf("bad revision number: %s\n", err)
+				break
+			}
+
+			record, metadata, err := sender.GetRecordRevision(identifier, revision)
+			if err != nil {
+				fmt.Printf("cannot get user data revision: %s\n", err)
+				break
+			}
+
+			printRecord(record)
+			printMetadata(metadata)
+		case `restore`:
+			identifier := readLine(`data identifier`)
+			revision, err := strconv.ParseInt(readLine(`revision`), 10, 64)
+			if err != nil {
+				fmt.Printf("bad revision number: %s\n", err)
+				break
+			}
+
+			err = sender.RestoreRevision(identifier, revision)
+			if editFailed(err, "cannot restore user data revision") {
+				break
+			}
+
+			fmt.Println("user data revision restored")
+		case `trash`:
+			entries, err := sender.ListTrash()
+			if err != nil {
+				fmt.Printf("cannot list trash: %s\n", err)
+				break
+			}
+
+			printTrashList(entries)
+			fmt.Printf("total: %d\n", len(entries))
+		case `trash_restore`:
+			trashId := readLine(`trash id`)
+
+			item, err := sender.RestoreTrash(trashId)
+			if err != nil {
+				fmt.Printf("cannot restore user data from trash: %s\n", err)
+				break
+			}
+
+			fmt.Printf("user data %s restored from trash\n", item.Identifier)
+		case `trash_delete`:
+			trashId := readLine(`trash id`)
+
+			if err := sender.DeleteTrash(trashId); err != nil {
+				fmt.Printf("cannot delete user data from trash: %s\n", err)
+				break
+			}
+
+			fmt.Println("user data deleted permanently")
+		case `trash_empty`:
+			if readLine(`delete all trash permanently (y/n)`) != `y` {
+				break
+			}
+
+			if err := sender.EmptyTrash(); err != nil {
+				fmt.Printf("cannot empty trash: %s\n", err)
+				break
+			}
+
+			fmt.Println("trash is empty")
+		case `changes`:
+			changes, err := sender.Changes(syncCursor)
+			if err != nil {
+				fmt.Printf("cannot get changes: %s\n", err)
+				break
+			}
+			syncCursor = changes.Cursor
+
+			if changes.Reset {
+				fmt.Println("full list:")
+			}
+			for _, identifier := range changes.Deleted {
+				fmt.Printf("deleted: %s\n", identifier)
+			}
+			if len(changes.Created) > 0 {
+				fmt.Println("created:")
+				printDataList(changes.Created)
+			}
+			if len(changes.Updated) > 0 {
+				fmt.Println("updated:")
+				printDataList(changes.Updated)
+			}
+			fmt.Printf("cursor: %d\n", changes.Cursor)
+		case `usage`:
+			usage, err := sender.Usage()
+			if err != nil {
+				fmt.Printf("cannot get usage: %s\n", err)
+				break
+			}
+
+			fmt.Printf("entries: %s\n", formatLimit(usage.Entries, usage.MaxEntries))
+			fmt.Printf("bytes: %s\n", formatLimit(usage.Bytes, usage.MaxBytes))
+		case `sync`:
+			if err := sender.Sync(); err != nil {
+				fmt.Printf("cannot sync: %s\n", err)
+			}
+			for _, notice := range sender.Notices() {
+				fmt.Printf("sync: %s\n", notice)
+			}
+
+			status := sender.SyncStatus()
+			fmt.Printf("background sync: %t, online: %t, cursor: %d\n", status.Enabled, status.Online, status.Cursor)
+			if !status.LastSync.IsZero() {
+				fmt.Printf("last sync: %s\n", status.LastSync.Local().Format(time.DateTime))
+			}
+			fmt.Printf("cached entries: %d, pending changes: %d, conflicts: %d\n", status.Cached, status.Pending, status.Conflicts)
+		case `conflicts`:
+			conflicts := sender.Conflicts()
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "IDENTIFIER\tLOCAL CHANGE\tBASE REVISION\tREMOTE REVISION\tDETECTED")
+			for _, c := range conflicts {
+				remote := strconv.FormatInt(c.RemoteRevision, 10)
+				if c.RemoteRevision == 0 {
+					remote = "deleted"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", c.Identifier, c.Action, c.BaseRevision, remote,
+					c.DetectedAt.Local().Format(time.DateTime))
+			}
+			w.Flush()
+			fmt.Printf("total: %d\n", len(conflicts))
+		case `resolve`:
+			identifier := readLine(`data identifier`)
+			resolution := readLine(`keep version (local, remote, both)`)
+
+			copyId, err := sender.Resolve(identifier, app.Resolution(resolution))
+			if err != nil {
+				fmt.Printf("cannot resolve conflict: %s\n", err)
+				break
+			}
+
+			if copyId != `` {
+				fmt.Printf("local version saved as %s\n", copyId)
+			}
+			fmt.Println("conflict resolved")
+		case `share`:
+			identifier := readLine(`data identifier`)
+			recipient := readLine(`recipient login`)
+			permission := models.ShareRead
+			if readLine(`allow recipient to edit (y/n)`) == `y` {
+				permission = models.ShareWrite
+			}
+
+			share, err := sender.Share(identifier, recipient, permission)
+			if err != nil {
+				fmt.Printf("cannot share user data: %s\n", err)
+				break
+			}
+
+			fmt.Printf("shared %s with %s (%s), share id %s\n", share.Identifier, share.Recipient, share.Permission, share.Id)
+		case `list_shares`:
+			list, err := sender.ListShares()
+			if err != nil {
+				fmt.Printf("cannot list shares: %s\n", err)
+				break
+			}
+
+			printShareList(list)
+		case `accept_share`:
+			shareId := readLine(`share id`)
+
+			share, err := sender.AcceptShare(shareId)
+			if err != nil {
+				fmt.Printf("cannot accept share: %s\n", err)
+				break
+			}
+
+			fmt.Printf("accepted %s from %s, use get_shared to read it\n", share.Identifier, share.Owner)
+		case `revoke_share`:
+			shareId := readLine(`share id`)
+
+			//Владельцу нужно знать, что уже полученное остается у получателя
+			list, _ := sender.ListShares()
+			outgoing := slices.ContainsFunc(list.Outgoing, func(share models.Share) bool { return share.Id == shareId })
+
+			if err := sender.RevokeShare(shareId); err != nil {
+				fmt.Printf("cannot revoke share: %s\n", err)
+				break
+			}
+
+			fmt.Println("share revoked")
+			if outgoing {
+				fmt.Println("the data was re-encrypted with a new key; the recipient keeps only what was already read, " +
+					"change the secret if that matters")
+			}
+		case `get_shared`:
+			shareId := readLine(`share id`)
+
+			entry, err := sender.GetShared(shareId)
+			if err != nil {
+				fmt.Printf("cannot get shared data: %s\n", err)
+				break
+			}
+
+			fmt.Printf("%s from %s (%s)\n", entry.Share.Identifier, entry.Share.Owner, entry.Share.Permission)
+			printRecord(entry.Record)
+			printMetadata(entry.Metadata)
+		case `download_shared`:
+			shareId := readLine(`share id`)
+			path := readLine(`path to save file`)
+
+			if err := sender.DownloadShared(shareId, path); err != nil {
+				fmt.Printf("cannot download shared file: %s\n", err)
+				break
+			}
+
+			fmt.Printf("saved to %s\n", path)
+		case `edit_shared`:
+			shareId := readLine(`share id`)
+
+			entry, err := sender.GetShared(shareId)
+			if err != nil {
+				fmt.Printf("cannot get shared data: %s\n", err)
+				break
+			}
+			if entry.Share.Permission != models.ShareWrite {
+				fmt.Printf("%s is shared read only\n", entry.Share.Identifier)
+				break
+			}
+
+			record, err := readRecord()
+			if err != nil {
+				fmt.Printf("bad record: %s\n", err)
+				break
+			}
+
+			err = sender.UpdateShared(shareId, entry.Revision, record, nil)
+			if editFailed(err, "cannot update shared data") {
+				break
+			}
+
+			fmt.Println("shared data update successful")
+		case `create_org`:
+			name := readLine(`organization name`)
+
+			org, err := sender.CreateOrganization(name)
+			if err != nil {
+				fmt.Printf("cannot create organization: %s\n", err)
+				break
+			}
+
+			fmt.Printf("organization %s created, id %s\n", org.Name, org.Id)
+		case `list_orgs`:
+			orgs, err := sender.ListOrganizations()
+			if err != nil {
+				fmt.Printf("cannot list organizations: %s\n", err)
+				break
+			}
+
+			printOrgList(orgs)
+		case `accept_org`:
+			orgId := readLine(`organization id`)
+
+			if err := sender.AcceptInvitation(orgId); err != nil {
+				fmt.Printf("cannot accept invitation: %s\n", err)
+				break
+			}
+
+			fmt.Println("invitation accepted, use list_collections to see shared collections")
+		case `list_members`:
+			orgId := readLine(`organization id`)
+
+			members, err := sender.ListMembers(orgId)
+			if err != nil {
+				fmt.Printf("cannot list members: %s\n", err)
+				break
+			}
+
+			printMemberList(members)
+		case `invite`:
+			orgId := readLine(`organization id`)
+			login := readLine(`user login`)
+			role := models.OrgRole(readLine(`role (owner, admin, member, readonly)`))
+
+			member, err := sender.InviteMember(orgId, login, role)
+			if err != nil {
+				fmt.Printf("cannot invite user: %s\n", err)
+				break
+			}
+
+			fmt.Printf("%s invited as %s\n", member.Login, member.Role)
+		case `set_role`:
+			orgId := readLine(`organization id`)
+			login := readLine(`member login`)
+			role := models.OrgRole(readLine(`role (owner, admin, member, readonly)`))
+
+			if err := sender.SetMemberRole(orgId, login, role); err != nil {
+				fmt.Printf("cannot set member role: %s\n", err)
+				break
+			}
+
+			fmt.Println("member role changed")
+		case `remove_member`:
+			orgId := readLine(`organization id`)
+			login := readLine(`member login (your own to decline invitation)`)
+
+			if err := sender.RemoveMember(orgId, login); err != nil {
+				fmt.Printf("cannot remove member: %s\n", err)
+				break
+			}
+
+			fmt.Println("member removed")
+		case `create_collection`:
+			orgId := readLine(`organization id`)
+			name := readLine(`collection name`)
+
+			collection, err := sender.CreateCollection(orgId, name)
+			if err != nil {
+				fmt.Printf("cannot create collection: %s\n", err)
+				break
+			}
+
+			fmt.Printf("collection %s created, id %s\n", collection.Name, collection.Id)
+		case `list_collections`:
+			orgId := readLine(`organization id`)
+
+			collections, err := sender.ListCollections(orgId)
+			if err != nil {
+				fmt.Printf("cannot list collections: %s\n", err)
+				break
+			}
+
+			printCollectionList(collections)
+		case `collection_list`:
+			collectionId := readLine(`collection id`)
+
+			for offset := 0; ; offset += listPageSize {
+				entries, total, err := sender.ListCollectionEntries(collectionId, offset, listPageSize)
+				if err != nil {
+					fmt.Printf("cannot list collection data: %s\n", err)
+					break
+				}
+
+				printDataList(entries)
+
+				if int64(offset+len(entries)) >= total || len(entries) == 0 {
+					fmt.Printf("total: %d\n", total)
+					break
+				}
+				if readLine(`next page (y/n)`) != `y` {
+					break
+				}
+			}
+		case `collection_add`:
+			collectionId := readLine(`collection id`)
+			identifier := readLine(`data identifier`)
+			record, err := readRecord()
+			if err != nil {
+				fmt.Printf("bad record: %s\n", err)
+				break
+			}
+
+			metadata := readMetadata(record.Type)
+
+			err = sender.AddCollectionRecord(collectionId, identifier, record, metadata)
+			if editFailed(err, "cannot add collection data") {
+				break
+			}
+
+			fmt.Println("collection data adding successful")
+		case `collection_get`:
+			collectionId := readLine(`collection id`)
+			identifier := readLine(`data identifier`)
+
+			entry, err := sender.GetCollectionRecord(collectionId, identifier)
+			if err != nil {
+				fmt.Printf("cannot get collection data: %s\n", err)
+				break
+			}
+
+			printRecord(entry.Record)
+			printMetadata(entry.Metadata)
+		case `collection_update`:
+			collectionId := readLine(`collection id`)
+			identifier := readLine(`data identifier`)
+
+			entry, err := sender.GetCollectionRecord(collectionId, identifier)
+			if err != nil {
+				fmt.Printf("cannot get collection data: %s\n", err)
+				break
+			}
+
+			record, err := readRecord()
+			if err != nil {
+				fmt.Printf("bad record: %s\n", err)
+				break
+			}
+
+			err = sender.UpdateCollectionRecord(collectionId, entry, record, nil)
+			if editFailed(err, "cannot update collection data") {
+				break
+			}
+
+			fmt.Println("collection data update successful")
+		case `collection_delete`:
+			collectionId := readLine(`collection id`)
+			identifier := readLine(`data identifier`)
+
+			if err := sender.DeleteCollectionData(collectionId, identifier); err != nil {
+				fmt.Printf("cannot delete collection data: %s\n", err)
+				break
+			}
+
+			fmt.Println("collection data moved to trash")
+		case `collection_reencrypt`:
+			collectionId := readLine(`collection id`)
+
+			count, err := sender.ReencryptCollection(collectionId)
+			if err != nil {
+				fmt.Printf("cannot re-encrypt collection: %s\n", err)
+				break
+			}
 
-			fmt.Println(string(data))
+			fmt.Printf("%d entries re-encrypted with the current collection key\n", count)
 		}
 	}
 }
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"github.com/lionslon/go-keepass/internal/models"
+	"strings"
+)
+
+// readMetadata запрашивает метаданные новой записи, поле сайта или банка - в зависимости от типа записи
+func readMetadata(recordType models.RecordType) models.Metadata {
+	var metadata models.Metadata
+
+	switch recordType {
+	case models.RecordCredentials:
+		metadata.Site = readLine(`site (optional)`)
+	case models.RecordCard:
+		metadata.Bank = readLine(`bank (optional)`)
+	}
+
+	metadata.Owner = readLine(`owner (optional)`)
+	metadata.Notes = readLine(`notes (optional)`)
+	metadata.Tags = models.ParseTags(readLine(`tags, comma separated (optional)`))
+
+	return metadata
+}
+
+// editMetadata запрашивает новые значения метаданных, пустой ввод оставляет текущее значение, "-" очищает поле
+func editMetadata(metadata models.Metadata) models.Metadata {
+	edit := func(title, current string) string {
+		value := readLine(fmt.Sprintf(`%s [%s]`, title, current))
+		switch value {
+		case ``:
+			return current
+		case `-`:
+			return ``
+		}
+		return value
+	}
+
+	metadata.Site = edit(`site`, metadata.Site)
+	metadata.Bank = edit(`bank`, metadata.Bank)
+	metadata.Owner = edit(`owner`, metadata.Owner)
+	metadata.Notes = edit(`notes`, metadata.Notes)
+	metadata.Tags = models.ParseTags(edit(`tags`, strings.Join(metadata.Tags, `, `)))
+
+	return metadata
+}
+
+// printMetadata выводит заполненные поля метаданных
+func printMetadata(metadata models.Metadata) {
+	for _, field := range []struct{ name, value string }{
+		{`site`, metadata.Site},
+		{`bank`, metadata.Bank},
+		{`owner`, metadata.Owner},
+		{`notes`, metadata.Notes},
+		{`tags`, strings.Join(metadata.Tags, `, `)},
+	} {
+		if field.value != `` {
+			fmt.Printf("%s: %s\n", field.name, field.value)
+		}
+	}
+
+	for name, value := range metadata.Fields {
+		fmt.Printf("%s: %s\n", name, value)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"github.com/lionslon/go-keepass/internal/models"
+	"os"
+	"strings"
+	"time"
+)
+
+// readRecord запрашивает у пользователя тип записи и поля, соответствующие типу
+func readRecord() (models.Record, error) {
+	names := make([]string, 0, len(models.RecordTypes))
+	for _, recordType := range models.RecordTypes {
+		names = append(names, string(recordType))
+	}
+
+	name := readLine(fmt.Sprintf(`record type (%s)`, strings.Join(names, `, `)))
+	if name == `` {
+		name = string(models.RecordText)
+	}
+
+	recordType, err := models.ParseRecordType(name)
+	if err != nil {
+		return models.Record{}, err
+	}
+
+	record := models.Record{Type: recordType}
+
+	switch recordType {
+	case models.RecordCredentials:
+		login := readLine(`login (optional)`)
+		password, err := readPassword(`password`)
+		if err != nil {
+			return record, err
+		}
+		record.Credentials = &models.Credentials{
+			Login:    login,
+			Password: password,
+			URL:      readLine(`url (optional)`),
+		}
+	case models.RecordCard:
+		record.Card = &models.Card{
+			Number: models.NormalizeCardNumber(readLine(`card number`)),
+			Holder: readLine(`card holder`),
+			Expiry: readLine(`expiry (MM/YY or MM/YYYY)`),
+			CVV:    readLine(`cvv`),
+		}
+	case models.RecordText:
+		record.Text = &models.TextNote{
+			Text: readLine(`text`),
+		}
+	case models.RecordOTP:
+		otp, err := models.ParseOTPURI(readLine(`otpauth uri`))
+		if err != nil {
+			return record, err
+		}
+		record.OTP = &otp
+	case models.RecordBinary:
+		path := readLine(`file path`)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return record, fmt.Errorf("cannot read file: %w", err)
+		}
+
+		record.Binary = &models.BinaryFile{
+			Name: path[strings.LastIndexAny(path, `/\`)+1:],
+			Data: data,
+		}
+	}
+
+	if err := record.Validate(); err != nil {
+		return record, err
+	}
+
+	//Адрес с опечаткой и истекшую карту нельзя ввести заново, но сохраненные ранее остаются читаемыми
+	if record.Credentials != nil {
+		if err := record.Credentials.CheckInput(); err != nil {
+			return record, err
+		}
+	}
+	if record.Card != nil {
+		if err := record.Card.CheckExpiry(time.Now()); err != nil {
+			return record, err
+		}
+	}
+
+	return record, nil
+}
+
+// printRecord выводит запись в зависимости от ее типа, бинарные данные по запросу сохраняет в файл
+func printRecord(record models.Record) {
+	fmt.Printf("type: %s\n", record.Type)
+
+	switch record.Type {
+	case models.RecordCredentials:
+		fmt.Printf("login: %s\npassword: %s\n", record.Credentials.Login, record.Credentials.Password)
+		if record.Credentials.URL != `` {
+			fmt.Printf("url: %s\n", record.Credentials.URL)
+		}
+	case models.RecordCard:
+		fmt.Printf("number: %s\nholder: %s\nexpiry: %s\ncvv: %s\n",
+			record.Card.Number, record.Card.Holder, record.Card.Expiry, record.Card.CVV)
+	case models.RecordText:
+		fmt.Println(record.Text.Text)
+	case models.RecordOTP:
+		otp := record.OTP
+		fmt.Printf("%s: %s\nalgorithm: %s\ndigits: %d\n", otp.Kind, otp.Label(), otp.Algorithm, otp.Digits)
+		if otp.Kind == models.OTPTotp {
+			fmt.Printf("period: %ds\n", otp.Period)
+		} else {
+			fmt.Printf("counter: %d\n", otp.Counter)
+		}
+		fmt.Printf("uri: %s\n", otp.URI())
+	case models.RecordBinary:
+		fmt.Printf("file: %s (%d bytes)\n", record.Binary.Name, len(record.Binary.Data))
+
+		path := readLine(`path to save file (empty to skip)`)
+		if path == `` {
+			break
+		}
+		if err := os.WriteFile(path, record.Binary.Data, 0600); err != nil {
+			fmt.Printf("cannot save file: %s\n", err)
+			break
+		}
+		fmt.Printf("saved to %s\n", path)
+	}
+}
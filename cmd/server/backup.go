@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/lionslon/go-keepass/internal/server/config"
+	"github.com/lionslon/go-keepass/internal/storage"
+	"os"
+	"path/filepath"
+)
+
+const (
+	backupUsage  = `usage: server backup -d dsn file`
+	restoreUsage = `usage: server restore -d dsn file`
+)
+
+// openBackuper открывает хранилище, которое умеет выгружать и загружать архив
+func openBackuper(cfg *config.Config) (storage.Backuper, func(), error) {
+	st, err := storage.New(cfg.DataBaseDSN)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot create db store: %w", err)
+	}
+
+	backuper, ok := st.(storage.Backuper)
+	if !ok {
+		st.Close()
+		return nil, nil, fmt.Errorf("storage %s does not support backup", cfg.DataBaseDSN)
+	}
+
+	return backuper, st.Close, nil
+}
+
+// backup выгружает пользователей и их зашифрованные данные в архив: server backup -d dsn file.
+// Архив пишется во временный файл рядом и переименовывается только после успешной выгрузки.
+func backup(cfg *config.Config) error {
+	if len(cfg.CommandArgs) != 1 {
+		return fmt.Errorf("backup file is not set\n%s", backupUsage)
+	}
+	path := cfg.CommandArgs[0]
+
+	backuper, closeStorage, err := openBackuper(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeStorage()
+
+	//Архив содержит хэши паролей пользователей, поэтому доступен только владельцу
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("cannot create backup file: %w", err)
+	}
+	defer os.Remove(file.Name())
+
+	stats, err := backuper.Backup(context.Background(), file)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("cannot backup storage: %w", err)
+	}
+
+	if err := os.Rename(file.Name(), path); err != nil {
+		return fmt.Errorf("cannot save backup file: %w", err)
+	}
+
+	printBackupStats("saved", stats)
+	return nil
+}
+
+// restore загружает архив в пустое хранилище: server restore -d dsn file.
+// Архив сначала проверяется целиком, затем загружается одной транзакцией.
+func restore(cfg *config.Config) error {
+	if len(cfg.CommandArgs) != 1 {
+		return fmt.Errorf("backup file is not set\n%s", restoreUsage)
+	}
+
+	file, err := os.Open(cfg.CommandArgs[0])
+	if err != nil {
+		return fmt.Errorf("cannot open backup file: %w", err)
+	}
+	defer file.Close()
+
+	stats, err := storage.VerifyBackup(file)
+	if err != nil {
+		return fmt.Errorf("cannot verify backup: %w", err)
+	}
+	printBackupStats("verified", stats)
+
+	if _, err := file.Seek(0, 0); err != nil {
+		return fmt.Errorf("cannot read backup file: %w", err)
+	}
+
+	backuper, closeStorage, err := openBackuper(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeStorage()
+
+	stats, err = backuper.Restore(context.Background(), file)
+	if err != nil {
+		return fmt.Errorf("cannot restore storage: %w", err)
+	}
+
+	printBackupStats("restored", stats)
+	return nil
+}
+
+func printBackupStats(action string, stats storage.BackupStats) {
+	fmt.Printf("%s %d users, %d entries, %d revisions, %d files in %d chunks, %d shares, %d organizations with %d members, %d collections, %d folders, %d attachments\n",
+		action, stats.Users, stats.Data, stats.Revisions, stats.Blobs, stats.Chunks, stats.Shares, stats.Orgs, stats.Members, stats.Collections,
+		stats.Folders, stats.Attachments)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/lionslon/go-keepass/internal/models"
+	"github.com/lionslon/go-keepass/internal/server/config"
+	"github.com/lionslon/go-keepass/internal/storage"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newSQLiteDSN создает файл базы SQLite с примененными миграциями
+func newSQLiteDSN(t *testing.T, name string) string {
+	t.Helper()
+
+	dsn := "sqlite://" + filepath.Join(t.TempDir(), name)
+
+	migrator, err := storage.OpenMigrator(dsn)
+	if err != nil {
+		t.Fatalf("OpenMigrator() error = %v", err)
+	}
+	defer migrator.Close()
+	if _, err := migrator.Up(context.Background(), 0); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+
+	return dsn
+}
+
+// openStorage открывает хранилище и закрывает его по окончании теста
+func openStorage(t *testing.T, dsn string) storage.Storage {
+	t.Helper()
+
+	st, err := storage.New(dsn)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	t.Cleanup(st.Close)
+
+	return st
+}
+
+func TestBackupCommand(t *testing.T) {
+	ctx := context.Background()
+
+	source := newSQLiteDSN(t, "source.db")
+	st := openStorage(t, source)
+	userId, err := st.CreateUser(ctx, models.AuthDTO{Login: "alice", Password: "password"})
+	if err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	if err := st.AddData(ctx, userId, "mail", []byte("encrypted"), []byte("metadata")); err != nil {
+		t.Fatalf("AddData() error = %v", err)
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "keeper.backup")
+	if err := backup(&config.Config{DataBaseDSN: source, CommandArgs: []string{path}}); err != nil {
+		t.Fatalf("backup() error = %v", err)
+	}
+
+	//Архив с хэшами паролей доступен только владельцу, временный файл не остается
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("backup file error = %v", err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("backup file mode = %v, want %v", mode, os.FileMode(0600))
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 1 {
+		t.Errorf("backup dir = %d files, want only backup", len(files))
+	}
+
+	target := newSQLiteDSN(t, "target.db")
+	if err := restore(&config.Config{DataBaseDSN: target, CommandArgs: []string{path}}); err != nil {
+		t.Fatalf("restore() error = %v", err)
+	}
+
+	restored := openStorage(t, target)
+	restoredId, err := restored.Login(ctx, models.AuthDTO{Login: "alice", Password: "password"})
+	if err != nil {
+		t.Fatalf("Login() restored error = %v", err)
+	}
+	entry, err := restored.GetData(ctx, restoredId, "mail")
+	if err != nil {
+		t.Fatalf("GetData() restored error = %v", err)
+	}
+	if string(entry.Data) != "encrypted" || string(entry.Metadata) != "metadata" {
+		t.Errorf("GetData() restored = %q, %q, want encrypted, metadata", entry.Data, entry.Metadata)
+	}
+
+	//Повторное восстановление в непустое хранилище отклоняется
+	if err := restore(&config.Config{DataBaseDSN: target, CommandArgs: []string{path}}); err == nil {
+		t.Error("restore() into non-empty storage error = nil, want error")
+	}
+}
+
+func TestRestoreCommandRejectsCorrupted(t *testing.T) {
+	ctx := context.Background()
+
+	source := newSQLiteDSN(t, "source.db")
+	if _, err := openStorage(t, source).CreateUser(ctx, models.AuthDTO{Login: "alice", Password: "password"}); err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "keeper.backup")
+	if err := backup(&config.Config{DataBaseDSN: source, CommandArgs: []string{path}}); err != nil {
+		t.Fatalf("backup() error = %v", err)
+	}
+	archive, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, archive[:len(archive)-10], 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	target := newSQLiteDSN(t, "target.db")
+	if err := restore(&config.Config{DataBaseDSN: target, CommandArgs: []string{path}}); !errors.Is(err, storage.ErrBackupCorrupted) {
+		t.Errorf("restore() error = %v, want %v", err, storage.ErrBackupCorrupted)
+	}
+	if openStorage(t, target).IsUserExist(ctx, "alice") {
+		t.Error("IsUserExist() after failed restore = true, want false")
+	}
+
+	if err := restore(&config.Config{DataBaseDSN: target}); err == nil {
+		t.Error("restore() without file error = nil, want error")
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/lionslon/go-keepass/internal/server/config"
 	"github.com/lionslon/go-keepass/internal/storage"
 	"log"
+	"os"
 )
 
 func main() {
@@ -21,14 +22,36 @@ func main() {
 		log.Fatalf("cannot load config: %s\n", err)
 	}
 
+	//Подкоманды обслуживания выполняются без запуска сервера
+	switch cfg.Command {
+	case ``:
+	case `migrate`:
+		if err := migrate(cfg, os.Stdout); err != nil {
+			log.Fatalf("migrate: %s\n", err)
+		}
+		return
+	case `backup`:
+		if err := backup(cfg); err != nil {
+			log.Fatalf("backup: %s\n", err)
+		}
+		return
+	case `restore`:
+		if err := restore(cfg); err != nil {
+			log.Fatalf("restore: %s\n", err)
+		}
+		return
+	default:
+		log.Fatalf("unknown command: %s\n", cfg.Command)
+	}
+
 	// Инициализируем расшифровыватель аутентификационных данных пользователя на закрытом ключе сервера
 	err = crypt.NewDecryptor(cfg.CryptoKey)
 	if err != nil {
 		log.Fatalf("cannot initialize server credentions decryptor: %s", err)
 	}
 
-	// База данных
-	storage, err := storage.NewKeeperStorage(cfg.DataBaseDSN)
+	// Хранилище, реализация выбирается по схеме dsn
+	storage, err := storage.New(cfg.DataBaseDSN)
 	if err != nil {
 		log.Fatalf("cannot create db store: %s\n", err)
 	}
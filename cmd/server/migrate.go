@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/lionslon/go-keepass/internal/server/config"
+	"github.com/lionslon/go-keepass/internal/storage"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+const migrateUsage = `usage: server migrate -d dsn [status | up [N] | down [N]]`
+
+// migrate управляет версией схемы базы: server migrate -d dsn [status | up [N] | down [N]].
+// Результат пишется в out.
+func migrate(cfg *config.Config, out io.Writer) error {
+	action, steps := `status`, 0
+	if len(cfg.CommandArgs) > 0 {
+		action = cfg.CommandArgs[0]
+	}
+	if len(cfg.CommandArgs) > 1 {
+		n, err := strconv.Atoi(cfg.CommandArgs[1])
+		if err != nil || n <= 0 {
+			return fmt.Errorf("bad steps count %q\n%s", cfg.CommandArgs[1], migrateUsage)
+		}
+		steps = n
+	}
+
+	migrator, err := storage.OpenMigrator(cfg.DataBaseDSN)
+	if err != nil {
+		return fmt.Errorf("cannot open migrator: %w", err)
+	}
+	defer migrator.Close()
+
+	ctx := context.Background()
+
+	switch action {
+	case `status`:
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return fmt.Errorf("cannot get migrations status: %w", err)
+		}
+
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, status := range statuses {
+			appliedAt := `pending`
+			if status.Applied {
+				appliedAt = status.AppliedAt.Local().Format(time.DateTime)
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+		}
+		return w.Flush()
+	case `up`:
+		done, err := migrator.Up(ctx, steps)
+		for _, migration := range done {
+			fmt.Fprintf(out, "applied %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			return fmt.Errorf("cannot apply migrations: %w", err)
+		}
+		if len(done) == 0 {
+			fmt.Fprintln(out, "schema is up to date")
+		}
+	case `down`:
+		done, err := migrator.Down(ctx, steps)
+		for _, migration := range done {
+			fmt.Fprintf(out, "reverted %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			return fmt.Errorf("cannot revert migrations: %w", err)
+		}
+		if len(done) == 0 {
+			fmt.Fprintln(out, "nothing to revert")
+		}
+	default:
+		return fmt.Errorf("unknown action %q\n%s", action, migrateUsage)
+	}
+
+	return nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"github.com/lionslon/go-keepass/internal/server/config"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runMigrate выполняет migrate и возвращает его вывод
+func runMigrate(t *testing.T, dsn string, args ...string) string {
+	t.Helper()
+
+	var out bytes.Buffer
+	if err := migrate(&config.Config{DataBaseDSN: dsn, CommandArgs: args}, &out); err != nil {
+		t.Fatalf("migrate(%v) error = %v", args, err)
+	}
+	return out.String()
+}
+
+// statusLines строки вывода status без заголовка
+func statusLines(t *testing.T, dsn string) []string {
+	t.Helper()
+
+	lines := strings.Split(strings.TrimSpace(runMigrate(t, dsn, "status")), "\n")
+	if !strings.HasPrefix(lines[0], "VERSION") {
+		t.Fatalf("status header = %q, want VERSION NAME APPLIED AT", lines[0])
+	}
+	return lines[1:]
+}
+
+func TestMigrateCommand(t *testing.T) {
+	dsn := "sqlite://" + filepath.Join(t.TempDir(), "keeper.db")
+
+	lines := statusLines(t, dsn)
+	if len(lines) == 0 {
+		t.Fatal("status lists no migrations")
+	}
+	total := len(lines)
+	for _, line := range lines {
+		if !strings.HasSuffix(line, "pending") {
+			t.Errorf("status on empty db = %q, want pending", line)
+		}
+	}
+	if fields := strings.Fields(lines[0]); fields[0] != "0001" || fields[1] != "init" {
+		t.Errorf("status first line = %q, want 0001 init", lines[0])
+	}
+
+	out := runMigrate(t, dsn, "up", "1")
+	if out != "applied 0001_init\n" {
+		t.Errorf("up 1 = %q, want applied 0001_init", out)
+	}
+	lines = statusLines(t, dsn)
+	if strings.HasSuffix(lines[0], "pending") || !strings.HasSuffix(lines[1], "pending") {
+		t.Errorf("status after up 1 = %q, want only 0001 applied", lines)
+	}
+
+	out = runMigrate(t, dsn, "up")
+	if applied := strings.Count(out, "applied "); applied != total-1 {
+		t.Errorf("up = %d applied, want %d:\n%s", applied, total-1, out)
+	}
+	if out := runMigrate(t, dsn, "up"); out != "schema is up to date\n" {
+		t.Errorf("up again = %q, want schema is up to date", out)
+	}
+	for _, line := range statusLines(t, dsn) {
+		if strings.HasSuffix(line, "pending") {
+			t.Errorf("status after up = %q, want applied", line)
+		}
+	}
+
+	out = runMigrate(t, dsn, "down", "100")
+	if reverted := strings.Count(out, "reverted "); reverted != total {
+		t.Errorf("down = %d reverted, want %d:\n%s", reverted, total, out)
+	}
+	if !strings.HasSuffix(out, "reverted 0001_init\n") {
+		t.Errorf("down = %q, want 0001_init reverted last", out)
+	}
+	if out := runMigrate(t, dsn, "down"); out != "nothing to revert\n" {
+		t.Errorf("down on empty db = %q, want nothing to revert", out)
+	}
+	for _, line := range statusLines(t, dsn) {
+		if !strings.HasSuffix(line, "pending") {
+			t.Errorf("status after down = %q, want pending", line)
+		}
+	}
+
+	if out := runMigrate(t, dsn, "up"); strings.Count(out, "applied ") != total {
+		t.Errorf("up after down = %q, want %d applied", out, total)
+	}
+	openStorage(t, dsn)
+}
+
+func TestMigrateCommandRejectsBadArgs(t *testing.T) {
+	dsn := "sqlite://" + filepath.Join(t.TempDir(), "keeper.db")
+
+	for _, args := range [][]string{{"sideways"}, {"up", "0"}, {"down", "x"}} {
+		var out bytes.Buffer
+		if err := migrate(&config.Config{DataBaseDSN: dsn, CommandArgs: args}, &out); err == nil {
+			t.Errorf("migrate(%v) error = nil, want error", args)
+		}
+	}
+	if err := migrate(&config.Config{DataBaseDSN: "mem://"}, &bytes.Buffer{}); err == nil {
+		t.Error("migrate() in-memory storage error = nil, want error")
+	}
+}
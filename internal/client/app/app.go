@@ -16,6 +16,14 @@ const (
 	registerUrl = "api/user/register"
 	loginUrl    = "api/user/login"
 	addDataUrl  = "api/data"
+
+	revisionsPath = "revisions"
+	metadataPath  = "metadata"
+
+	// metadataHeader заголовок с зашифрованными метаданными в base64
+	metadataHeader = "X-Metadata"
+	// originHeader заголовок с исходным идентификатором перемещенных данных
+	originHeader = "X-Data-Origin"
 )
 
 // sender для взаимодействия клиента с сервером
@@ -23,8 +31,8 @@ type sender struct {
 	cfg       *config.Config   // конфиг приложения
 	client    *resty.Client    // клиент http
 	encryptor *crypt.Encryptor // объект для шифрования аутентификационных данных на открытом ключе сервера
-	token     string           // актуальный jwt токен
 	password  string           // пароль пользователя (используем для шифрования / расшифровывания данных для /от сервера)
+	state     *syncState       // ревизии данных, очередь изменений и состояние фоновой синхронизации
 }
 
 func NewSender(cfg *config.Config) sender {
@@ -36,6 +44,7 @@ func NewSender(cfg *config.Config) sender {
 	return sender{
 		cfg:    cfg,
 		client: resty.New(),
+		state:  newSyncState(),
 	}
 }
 
@@ -69,14 +78,24 @@ func (m *sender) Register(login, password string) error {
 
 	//Нужно разобрать заголовки и забрать токен
 	if code := resp.StatusCode(); code != http.StatusOK {
-		return fmt.Errorf("request processing failed, code: %d", code)
+		return statusError(code)
 	}
 
+	//Фоновая синхронизация использует токен и пароль, поэтому меняем их между ее проходами
+	m.state.op.Lock()
+	defer m.state.op.Unlock()
+
 	if err := m.parseAuthorization(resp); err != nil {
 		return fmt.Errorf("cannot get jwt token: %s", err)
 	}
 
 	m.password = password
+	m.openCache(login, password)
+
+	//Без ключей пользователю нельзя передать данные, но остальная работа возможна
+	if err := m.ensureKeys(); err != nil {
+		m.state.warn("cannot create sharing keys: %s", err)
+	}
 
 	return nil
 }
@@ -94,79 +113,37 @@ func (m *sender) Login(login, password string) error {
 
 	resp, err := req.Post(url)
 	if err != nil {
-		return fmt.Errorf("cannot send login request: %w", err)
+		//Без связи с сервером входим по локальному кэшу
+		if offlineErr := m.loginOffline(login, password); offlineErr != nil {
+			return fmt.Errorf("cannot send login request: %w, cannot login offline: %s", err, offlineErr)
+		}
+		return nil
 	}
 
 	//Нужно разобрать заголовки и забрать токен
 	if code := resp.StatusCode(); code != http.StatusOK {
-		return fmt.Errorf("request processing failed, code: %d", code)
+		return statusError(code)
 	}
 
+	//Фоновая синхронизация использует токен и пароль, поэтому меняем их между ее проходами
+	m.state.op.Lock()
+	defer m.state.op.Unlock()
+
 	if err := m.parseAuthorization(resp); err != nil {
 		return fmt.Errorf("cannot get jwt token: %s", err)
 	}
 
 	m.password = password
+	m.openCache(login, password)
 
-	return nil
-}
-
-func (m *sender) AddNewData(identifier string, data []byte) error {
-
-	if m.token == `` || m.password == `` {
-		return fmt.Errorf("bad auth data, try login")
-	}
-
-	encryptData, err := crypt.SymmetricEncrypt(m.password, data)
-	if err != nil {
-		return fmt.Errorf("cannot encrypt user data: %w", err)
-	}
-
-	req := m.client.R().
-		SetBody(encryptData).
-		SetHeader("Authorization", m.token)
-
-	url := strings.Join([]string{m.cfg.ServerEndpoint, addDataUrl, identifier}, "/")
-
-	resp, err := req.Post(url)
-	if err != nil {
-		return fmt.Errorf("cannot send add data request: %w", err)
-	}
-
-	if code := resp.StatusCode(); code != http.StatusAccepted {
-		return fmt.Errorf("request processing failed, code: %d", code)
+	//Без ключей пользователю нельзя передать данные, но остальная работа возможна
+	if err := m.ensureKeys(); err != nil {
+		m.state.warn("cannot create sharing keys: %s", err)
 	}
 
 	return nil
 }
 
-func (m *sender) GetUserData(identifier string) ([]byte, error) {
-	if m.token == `` || m.password == `` {
-		return nil, fmt.Errorf("bad auth data, try login")
-	}
-
-	req := m.client.R().
-		SetHeader("Authorization", m.token)
-
-	url := strings.Join([]string{m.cfg.ServerEndpoint, addDataUrl, identifier}, "/")
-
-	resp, err := req.Get(url)
-	if err != nil {
-		return nil, fmt.Errorf("cannot sen get user data request: %w", err)
-	}
-
-	if code := resp.StatusCode(); code != http.StatusOK {
-		return nil, fmt.Errorf("request processing failed, code: %d", code)
-	}
-
-	data, err := crypt.SymmetricDecrypt(m.password, resp.Body())
-	if err != nil {
-		return nil, fmt.Errorf("cannot decrypt user data: %w", err)
-	}
-
-	return data, nil
-}
-
 // Шифрует аутентификационные данные пользователя
 func (m *sender) createEncryptUserAuthData(login, password string) ([]byte, error) {
 	authdto := new(bytes.Buffer)
@@ -188,13 +165,45 @@ func (m *sender) createEncryptUserAuthData(login, password string) ([]byte, erro
 
 func (m *sender) parseAuthorization(resp *resty.Response) error {
 
-	resp.Header().Get("Authorization")
-
 	//Получение header c токеном
-	m.token = resp.Header().Get("Authorization")
-	if m.token == `` {
+	token := resp.Header().Get("Authorization")
+	if token == `` {
 		return fmt.Errorf("authorization header is missing")
 	}
 
+	m.state.setToken(token)
+
+	return nil
+}
+
+// openCache переключает состояние на пользователя и загружает его локальный кэш.
+// Кэш, который не удалось прочитать, заново заполнит синхронизация с сервером.
+func (m *sender) openCache(login, password string) {
+	cache, err := m.readCache(login, password)
+	m.state.open(login, cache)
+	if err != nil {
+		m.state.warn("%s, it will be rebuilt from server", err)
+	}
+}
+
+// loginOffline входит без связи с сервером по локальному кэшу: пароль проверяется расшифровкой кэша.
+// Токен получит фоновая синхронизация, когда сервер станет доступен.
+func (m *sender) loginOffline(login, password string) error {
+	cache, err := m.readCache(login, password)
+	if err != nil {
+		return err
+	}
+	if cache == nil {
+		return fmt.Errorf("no local cache for user %s", login)
+	}
+
+	m.state.op.Lock()
+	defer m.state.op.Unlock()
+
+	m.state.setToken(``)
+	m.password = password
+	m.state.open(login, cache)
+	m.state.reachable(ErrUnavailable)
+
 	return nil
 }
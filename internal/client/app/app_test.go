@@ -0,0 +1,103 @@
+package app
+
+import (
+	"github.com/go-chi/chi/v5"
+	"github.com/lionslon/go-keepass/internal/auth"
+	"github.com/lionslon/go-keepass/internal/client/config"
+	"github.com/lionslon/go-keepass/internal/crypt"
+	serverconfig "github.com/lionslon/go-keepass/internal/server/config"
+	"github.com/lionslon/go-keepass/internal/server/handlers"
+	"github.com/lionslon/go-keepass/internal/storage"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testServerKey открытый ключ сервера для шифрования данных входа, закрытый ключ задается
+// глобально в crypt, поэтому пара создается один раз на все тесты
+var testServerKey = sync.OnceValues(func() ([]byte, error) {
+	publicKey, privateKey, err := crypt.GenerateKeyPair()
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp("", "keeper-test")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "private.rsa")
+	if err := os.WriteFile(file, privateKey, 0600); err != nil {
+		return nil, err
+	}
+	if err := crypt.NewDecryptor(file); err != nil {
+		return nil, err
+	}
+
+	auth.Initialize(&serverconfig.Config{JWTKey: []byte("test"), JWTDuration: time.Hour})
+
+	return publicKey, nil
+})
+
+// newTestServer запускает сервер с хранилищем в памяти и возвращает его адрес
+func newTestServer(t *testing.T) string {
+	t.Helper()
+
+	if _, err := testServerKey(); err != nil {
+		t.Fatalf("cannot create server key: %v", err)
+	}
+
+	router := chi.NewRouter()
+	handler := handlers.NewKeeperHandler(storage.NewMemStorage(), handlers.Limits{})
+	handler.Register(router)
+
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	return server.URL
+}
+
+// newTestSender создает клиента сервера endpoint без кэша на диске
+func newTestSender(t *testing.T, endpoint string) *sender {
+	t.Helper()
+
+	return newCachedSender(t, endpoint, ``)
+}
+
+// newCachedSender создает клиента сервера endpoint с кэшем в каталоге cacheDir
+func newCachedSender(t *testing.T, endpoint, cacheDir string) *sender {
+	t.Helper()
+
+	publicKey, err := testServerKey()
+	if err != nil {
+		t.Fatalf("cannot create server key: %v", err)
+	}
+
+	file := filepath.Join(t.TempDir(), "public.rsa")
+	if err := os.WriteFile(file, publicKey, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewSender(&config.Config{ServerEndpoint: endpoint, CryptoKey: file, CacheDir: cacheDir})
+	if err := m.Init(); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+
+	return &m
+}
+
+// newTestUser регистрирует пользователя и возвращает его клиента
+func newTestUser(t *testing.T, endpoint, login, password string) *sender {
+	t.Helper()
+
+	m := newTestSender(t, endpoint)
+	if err := m.Register(login, password); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+
+	return m
+}
@@ -0,0 +1,254 @@
+package app
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/lionslon/go-keepass/internal/crypt"
+	"github.com/lionslon/go-keepass/internal/models"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+const (
+	attachmentsPath = "attachments"
+
+	attachmentTypeHeader = "X-Attachment-Type"
+	attachmentKeyHeader  = "X-Attachment-Key"
+)
+
+// Attach прикрепляет файл к данным под именем name (по умолчанию - имя файла), одноименное вложение заменяется.
+// Файл шифруется потоком на случайном ключе вложения, сам ключ - ключом данных.
+func (m *sender) Attach(identifier, path, name string) (models.Attachment, error) {
+	var attachment models.Attachment
+
+	if m.state.auth() == `` || m.password == `` {
+		return attachment, fmt.Errorf("bad auth data, try login")
+	}
+	if name == `` {
+		name = filepath.Base(path)
+	}
+	if err := models.ValidateAttachmentName(name); err != nil {
+		return attachment, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return attachment, fmt.Errorf("cannot open file: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return attachment, fmt.Errorf("cannot stat file: %w", err)
+	}
+
+	mimeType, err := detectType(file, name)
+	if err != nil {
+		return attachment, err
+	}
+
+	if err := m.attachContent(identifier, name, mimeType, file, info.Size()); err != nil {
+		return attachment, err
+	}
+
+	return models.Attachment{
+		Name:     name,
+		MimeType: mimeType,
+		Size:     info.Size(),
+	}, nil
+}
+
+// attachContent шифрует size байт содержимого вложения из r и загружает их по частям
+func (m *sender) attachContent(identifier, name, mimeType string, r io.ReaderAt, size int64) error {
+	key, err := crypt.GenerateKey()
+	if err != nil {
+		return fmt.Errorf("cannot generate attachment key: %w", err)
+	}
+	wrapped, err := crypt.SymmetricEncrypt(m.entryKey(identifier), []byte(key))
+	if err != nil {
+		return fmt.Errorf("cannot encrypt attachment key: %w", err)
+	}
+
+	encrypter, err := crypt.NewStreamEncrypter(key, r, size)
+	if err != nil {
+		return fmt.Errorf("cannot encrypt file: %w", err)
+	}
+
+	return m.uploadAttachment(m.attachmentUrl(identifier, name), identifier, mimeType, wrapped, encrypter)
+}
+
+// uploadAttachment начинает загрузку вложения по адресу url с ключом wrapped, зашифрованным ключом данных,
+// и загружает шифротекст по частям
+func (m *sender) uploadAttachment(url, identifier, mimeType string, wrapped []byte, encrypter uploadBody) error {
+	resp, err := m.client.R().
+		SetHeader("Authorization", m.state.auth()).
+		SetHeader(uploadLengthHeader, strconv.FormatInt(encrypter.Size(), 10)).
+		SetHeader(attachmentTypeHeader, mimeType).
+		SetHeader(attachmentKeyHeader, base64.StdEncoding.EncodeToString(wrapped)).
+		Post(url)
+	if err != nil {
+		return fmt.Errorf("cannot send create attachment request: %w", err)
+	}
+
+	switch code := resp.StatusCode(); code {
+	case http.StatusCreated:
+	case http.StatusNotFound:
+		return fmt.Errorf("data %s not found", identifier)
+	default:
+		return statusError(code)
+	}
+
+	location := resp.Header().Get("Location")
+	if location == `` {
+		return fmt.Errorf("location header is missing")
+	}
+	uploadUrl := m.cfg.ServerEndpoint + location
+
+	if _, err := m.sendUpload(uploadUrl, encrypter); err != nil {
+		m.cancelUpload(uploadUrl)
+		if errors.Is(err, errUploadPrecondition) {
+			return fmt.Errorf("data %s was deleted during upload", identifier)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// ListAttachments возвращает вложения данных, отсортированные по имени, с размером открытого содержимого
+func (m *sender) ListAttachments(identifier string) ([]models.Attachment, error) {
+	if m.state.auth() == `` || m.password == `` {
+		return nil, fmt.Errorf("bad auth data, try login")
+	}
+
+	var attachments []models.Attachment
+
+	resp, err := m.client.R().
+		SetHeader("Authorization", m.state.auth()).
+		SetResult(&attachments).
+		Get(m.dataUrl(identifier, attachmentsPath))
+	if err != nil {
+		return nil, fmt.Errorf("cannot send list attachments request: %w", err)
+	}
+
+	switch code := resp.StatusCode(); code {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("data %s not found", identifier)
+	default:
+		return nil, statusError(code)
+	}
+
+	for i := range attachments {
+		attachments[i].Size = crypt.StreamPlainSize(attachments[i].Size)
+	}
+
+	return attachments, nil
+}
+
+// SaveAttachment получает вложение и сохраняет его расшифрованное содержимое в path
+func (m *sender) SaveAttachment(identifier, name, path string) error {
+	if m.state.auth() == `` || m.password == `` {
+		return fmt.Errorf("bad auth data, try login")
+	}
+
+	return m.readAttachment(identifier, name, func(r io.Reader) error {
+		return writeFile(path, r)
+	})
+}
+
+// readAttachment получает вложение и передает read его содержимое, расшифровываемое по мере чтения
+func (m *sender) readAttachment(identifier, name string, read func(r io.Reader) error) error {
+	resp, err := m.client.R().
+		SetHeader("Authorization", m.state.auth()).
+		SetDoNotParseResponse(true).
+		Get(m.attachmentUrl(identifier, name))
+	if err != nil {
+		return fmt.Errorf("cannot send get attachment request: %w", err)
+	}
+
+	body := resp.RawBody()
+	defer body.Close()
+
+	switch code := resp.StatusCode(); code {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return fmt.Errorf("attachment %s of data %s not found", name, identifier)
+	default:
+		return statusError(code)
+	}
+
+	//Ключ вложения зашифрован ключом данных, который у перемещенных данных получен из исходного идентификатора
+	origin, err := readOrigin(resp)
+	if err != nil {
+		return err
+	}
+	keys := m.entryKeys(identifier)
+	if origin != `` {
+		keys = m.dataKeys(origin, identifier)
+	}
+
+	wrapped, err := base64.StdEncoding.DecodeString(resp.Header().Get(attachmentKeyHeader))
+	if err != nil {
+		return fmt.Errorf("bad %s header: %w", attachmentKeyHeader, err)
+	}
+	key, err := decryptWith(keys, wrapped)
+	if err != nil {
+		return fmt.Errorf("cannot decrypt attachment key: %w", err)
+	}
+
+	decrypted, err := crypt.NewDecryptReader(string(key), body)
+	if err != nil {
+		return fmt.Errorf("cannot decrypt attachment: %w", err)
+	}
+
+	return read(decrypted)
+}
+
+// Detach удаляет вложение данных
+func (m *sender) Detach(identifier, name string) error {
+	if m.state.auth() == `` || m.password == `` {
+		return fmt.Errorf("bad auth data, try login")
+	}
+
+	resp, err := m.client.R().
+		SetHeader("Authorization", m.state.auth()).
+		Delete(m.attachmentUrl(identifier, name))
+	if err != nil {
+		return fmt.Errorf("cannot send delete attachment request: %w", err)
+	}
+
+	switch code := resp.StatusCode(); code {
+	case http.StatusNoContent:
+		return nil
+	case http.StatusNotFound:
+		return fmt.Errorf("attachment %s of data %s not found", name, identifier)
+	default:
+		return statusError(code)
+	}
+}
+
+func (m *sender) attachmentUrl(identifier, name string) string {
+	return m.dataUrl(identifier, attachmentsPath, url.PathEscape(name))
+}
+
+// detectType определяет тип содержимого по расширению имени, а если расширение неизвестно - по началу файла
+func detectType(r io.ReaderAt, name string) (string, error) {
+	if mimeType := mime.TypeByExtension(filepath.Ext(name)); mimeType != `` {
+		return mimeType, nil
+	}
+
+	head := make([]byte, 512)
+	n, err := r.ReadAt(head, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return ``, fmt.Errorf("cannot read file: %w", err)
+	}
+
+	return http.DetectContentType(head[:n]), nil
+}
@@ -0,0 +1,83 @@
+package app
+
+import (
+	"bytes"
+	"github.com/lionslon/go-keepass/internal/models"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAttachRoundTrip(t *testing.T) {
+	endpoint := newTestServer(t)
+
+	m := newTestUser(t, endpoint, "alice", "password")
+	if err := m.AddRecord("servers/vpn", models.NewTextRecord("vpn"), models.Metadata{}); err != nil {
+		t.Fatalf("AddRecord() error = %v", err)
+	}
+
+	dir := t.TempDir()
+	content := bytes.Repeat([]byte("client config\n"), 5000)
+	path := filepath.Join(dir, "client.ovpn")
+	if err := os.WriteFile(path, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	attachment, err := m.Attach("servers/vpn", path, ``)
+	if err != nil {
+		t.Fatalf("Attach() error = %v", err)
+	}
+	if attachment.Name != "client.ovpn" || attachment.Size != int64(len(content)) {
+		t.Errorf("Attach() = %+v, want client.ovpn of %d bytes", attachment, len(content))
+	}
+	if _, err := m.Attach("servers/vpn", path, "ca.pem"); err != nil {
+		t.Fatalf("Attach() with name error = %v", err)
+	}
+
+	attachments, err := m.ListAttachments("servers/vpn")
+	if err != nil {
+		t.Fatalf("ListAttachments() error = %v", err)
+	}
+	if len(attachments) != 2 || attachments[0].Name != "ca.pem" || attachments[1].Name != "client.ovpn" {
+		t.Fatalf("ListAttachments() = %+v, want ca.pem, client.ovpn", attachments)
+	}
+	if attachments[1].Size != int64(len(content)) {
+		t.Errorf("ListAttachments() size = %d, want plain size %d", attachments[1].Size, len(content))
+	}
+
+	saved := filepath.Join(dir, "saved.ovpn")
+	if err := m.SaveAttachment("servers/vpn", "client.ovpn", saved); err != nil {
+		t.Fatalf("SaveAttachment() error = %v", err)
+	}
+	if got, err := os.ReadFile(saved); err != nil || !bytes.Equal(got, content) {
+		t.Errorf("saved attachment = %d bytes, %v, want %d bytes", len(got), err, len(content))
+	}
+
+	//Вложение шифруется: на сервере нет открытого содержимого
+	resp, err := m.client.R().
+		SetHeader("Authorization", m.state.auth()).
+		Get(m.attachmentUrl("servers/vpn", "client.ovpn"))
+	if err != nil {
+		t.Fatalf("get attachment error = %v", err)
+	}
+	if bytes.Contains(resp.Body(), []byte("client config")) {
+		t.Error("attachment is stored on server in plain text")
+	}
+
+	if err := m.Detach("servers/vpn", "client.ovpn"); err != nil {
+		t.Fatalf("Detach() error = %v", err)
+	}
+	if err := m.Detach("servers/vpn", "client.ovpn"); err == nil {
+		t.Error("Detach() twice error = nil, want error")
+	}
+	if err := m.SaveAttachment("servers/vpn", "client.ovpn", saved); err == nil {
+		t.Error("SaveAttachment() detached error = nil, want error")
+	}
+	if attachments, err := m.ListAttachments("servers/vpn"); err != nil || len(attachments) != 1 {
+		t.Errorf("ListAttachments() after Detach() = %+v, %v, want ca.pem", attachments, err)
+	}
+
+	if _, err := m.Attach("servers/missing", path, ``); err == nil {
+		t.Error("Attach() to missing data error = nil, want error")
+	}
+}
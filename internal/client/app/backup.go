@@ -0,0 +1,466 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/lionslon/go-keepass/internal/crypt"
+	"github.com/lionslon/go-keepass/internal/models"
+	"golang.org/x/crypto/argon2"
+	"io"
+	"os"
+	"time"
+)
+
+// Файл резервной копии: backupMagic || версия || соль || содержимое в потоковом формате crypt.
+// Ключ потока получается из пароля копии через Argon2id с солью, поэтому подмена заголовка
+// или любого байта содержимого обнаруживается при расшифровывании.
+//
+// Содержимое - строки JSON: заголовок копии, для каждых данных строка записи, за ней части содержимого
+// файла и строки вложений с частями их содержимого, в конце - завершающая строка с количеством данных.
+// Копия пишется и проверяется потоком, не собираясь в памяти целиком.
+const (
+	backupMagic       = "GKPBACKUP"
+	backupVersion     = 1
+	backupSaltSize    = 16
+	backupHeaderSize  = len(backupMagic) + 1 + backupSaltSize
+	backupArgonTime   = 3
+	backupArgonMemory = 64 << 10 // КиБ
+	backupArgonLanes  = 4
+	backupChunkSize   = 48 << 10 // размер части содержимого в одной строке, в base64 - 64 КиБ
+)
+
+// ErrBadBackup файл не является резервной копией, поврежден или пароль неверный
+var ErrBadBackup = errors.New("backup file is corrupted or password is wrong")
+
+// backupLine строка резервной копии, заполнено одно поле
+type backupLine struct {
+	Header     *backupHeader     `json:"header,omitempty"`
+	Entry      *backupEntry      `json:"entry,omitempty"`
+	Attachment *backupAttachment `json:"attachment,omitempty"` //Вложение предыдущих данных
+	Chunk      []byte            `json:"chunk,omitempty"`      //Часть содержимого предыдущего файла или вложения
+	End        *backupEnd        `json:"end,omitempty"`
+}
+
+// backupHeader заголовок открытого содержимого копии
+type backupHeader struct {
+	Version   int       `json:"version"`    //Версия формата, совпадает с версией в заголовке файла
+	Login     string    `json:"login"`      //Пользователь, данные которого сохранены
+	CreatedAt time.Time `json:"created_at"` //Время создания копии
+}
+
+// backupEntry расшифрованные данные пользователя. Данные хранятся открытыми внутри копии,
+// чтобы их можно было восстановить в учетную запись с другим паролем. Содержимое файла
+// не входит в запись, а следует за ней частями.
+type backupEntry struct {
+	Identifier string          `json:"identifier"`
+	Record     models.Record   `json:"record"`
+	Metadata   models.Metadata `json:"metadata"`
+	CreatedAt  time.Time       `json:"created_at"`
+	UpdatedAt  time.Time       `json:"updated_at"`
+}
+
+// backupAttachment расшифрованное вложение данных, содержимое следует за ним частями
+type backupAttachment struct {
+	Name     string `json:"name"`
+	MimeType string `json:"mime_type"`
+}
+
+// backupEnd завершающая строка копии
+type backupEnd struct {
+	Entries int `json:"entries"` //Количество данных в копии
+}
+
+// backupItem данные копии, собранные для восстановления вместе с содержимым файла и вложений
+type backupItem struct {
+	backupEntry
+	content     []byte
+	attachments []backupItemAttachment
+}
+
+type backupItemAttachment struct {
+	backupAttachment
+	content []byte
+}
+
+// backupKey ключ шифрования копии из пароля и соли
+func backupKey(password string, salt []byte) string {
+	key := argon2.IDKey([]byte(password), salt, backupArgonTime, backupArgonMemory, backupArgonLanes, 32)
+	return hex.EncodeToString(key)
+}
+
+// Backup сохраняет все данные пользователя в один файл, зашифрованный паролем копии.
+// Копия не зависит от сервера и пароля учетной записи. Данные, файлы и вложения пишутся в копию
+// по мере получения с сервера. Если хотя бы одни данные не удалось получить, копия не создается,
+// чтобы неполная копия не выглядела полной. Возвращает число сохраненных данных.
+func (m *sender) Backup(path, password string) (int, error) {
+	if m.password == `` {
+		return 0, fmt.Errorf("bad auth data, try login")
+	}
+	if password == `` {
+		return 0, fmt.Errorf("backup password is empty")
+	}
+
+	entries, err := m.listAll()
+	if err != nil {
+		return 0, err
+	}
+
+	//Копия пишется во временный файл через pipe: ошибка записи копии прерывает сохранение файла
+	reader, writer := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		writer.CloseWithError(m.writeBackup(writer, password, entries))
+	}()
+
+	err = writeFile(path, reader)
+	reader.Close()
+	<-done
+
+	if err != nil {
+		return 0, err
+	}
+
+	return len(entries), nil
+}
+
+// writeBackup шифрует паролем копии и пишет в w данные entries
+func (m *sender) writeBackup(w io.Writer, password string, entries []EntryInfo) error {
+	header := make([]byte, backupHeaderSize)
+	copy(header, backupMagic)
+	header[len(backupMagic)] = backupVersion
+	salt := header[len(backupMagic)+1:]
+	if _, err := rand.Read(salt); err != nil {
+		return fmt.Errorf("cannot generate salt: %w", err)
+	}
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+
+	encrypter, err := crypt.NewEncryptWriter(backupKey(password, salt), w)
+	if err != nil {
+		return fmt.Errorf("cannot encrypt backup: %w", err)
+	}
+
+	encoder := json.NewEncoder(encrypter)
+	err = encoder.Encode(backupLine{Header: &backupHeader{
+		Version:   backupVersion,
+		Login:     m.state.user(),
+		CreatedAt: time.Now().UTC(),
+	}})
+	if err != nil {
+		return fmt.Errorf("cannot write backup: %w", err)
+	}
+
+	for _, entry := range entries {
+		if err := m.backupEntry(encoder, entry); err != nil {
+			return fmt.Errorf("cannot get %s: %w", entry.Identifier, err)
+		}
+
+		if err := m.backupAttachments(encoder, entry.Identifier); err != nil {
+			return fmt.Errorf("cannot get attachments of %s: %w", entry.Identifier, err)
+		}
+	}
+
+	if err := encoder.Encode(backupLine{End: &backupEnd{Entries: len(entries)}}); err != nil {
+		return fmt.Errorf("cannot write backup: %w", err)
+	}
+
+	return encrypter.Close()
+}
+
+// backupEntry пишет строку записи и части содержимого файла.
+// Неотправленное изменение данных важнее версии на сервере, как в GetRecord.
+func (m *sender) backupEntry(encoder *json.Encoder, entry EntryInfo) error {
+	metadata := entry.Meta
+	write := func(record models.Record, content io.Reader) error {
+		err := encoder.Encode(backupLine{Entry: &backupEntry{
+			Identifier: entry.Identifier,
+			Record:     record,
+			Metadata:   metadata,
+			CreatedAt:  entry.CreatedAt,
+			UpdatedAt:  entry.UpdatedAt,
+		}})
+		if err != nil {
+			return fmt.Errorf("cannot write backup: %w", err)
+		}
+
+		return writeChunks(encoder, content)
+	}
+
+	data, encryptMetadata, ok, err := m.state.local(entry.Identifier)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return m.readContent(entry.Identifier, write)
+	}
+
+	if metadata, err = decryptMetadata(m.entryKeys(entry.Identifier), encryptMetadata); err != nil {
+		return err
+	}
+	return decryptContent(m.entryKeys(entry.Identifier), bytes.NewReader(data), write)
+}
+
+// backupAttachments пишет строки вложений данных с частями их содержимого
+func (m *sender) backupAttachments(encoder *json.Encoder, identifier string) error {
+	list, err := m.ListAttachments(identifier)
+	if err != nil {
+		return err
+	}
+
+	for _, attachment := range list {
+		err := m.readAttachment(identifier, attachment.Name, func(r io.Reader) error {
+			line := backupLine{Attachment: &backupAttachment{Name: attachment.Name, MimeType: attachment.MimeType}}
+			if err := encoder.Encode(line); err != nil {
+				return fmt.Errorf("cannot write backup: %w", err)
+			}
+
+			return writeChunks(encoder, r)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeChunks пишет содержимое r строками частей
+func writeChunks(encoder *json.Encoder, r io.Reader) error {
+	chunk := make([]byte, backupChunkSize)
+	for {
+		n, err := io.ReadFull(r, chunk)
+		if n > 0 {
+			if err := encoder.Encode(backupLine{Chunk: chunk[:n]}); err != nil {
+				return fmt.Errorf("cannot write backup: %w", err)
+			}
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Restore загружает данные из резервной копии в текущую учетную запись, она может быть другой
+// и на другом сервере. Файл расшифровывается и проверяется целиком до отправки первых данных,
+// затем читается повторно; в памяти держатся одни данные с содержимым файла и вложений.
+// Существующие данные не перезаписываются и возвращаются как повторы.
+func (m *sender) Restore(path, password string) (ImportResult, error) {
+	var result ImportResult
+
+	if m.password == `` {
+		return result, fmt.Errorf("bad auth data, try login")
+	}
+
+	if err := readBackup(path, password, nil); err != nil {
+		return result, err
+	}
+
+	existing, err := m.listAll()
+	if err != nil {
+		return result, err
+	}
+
+	exists := make(map[string]bool, len(existing))
+	for _, entry := range existing {
+		exists[entry.Identifier] = true
+	}
+
+	err = readBackup(path, password, func(item *backupItem) error {
+		if exists[item.Identifier] {
+			result.Duplicates = append(result.Duplicates, fmt.Sprintf("%s: already exists", item.Identifier))
+			return nil
+		}
+
+		return m.restoreEntry(item, &result)
+	})
+
+	return result, err
+}
+
+// restoreEntry сохраняет данные из копии вместе с вложениями. Файл, не помещающийся в один запрос, загружается по частям.
+func (m *sender) restoreEntry(entry *backupItem, result *ImportResult) error {
+	imported := len(result.Imported)
+
+	if entry.Record.Type == models.RecordBinary {
+		file := *entry.Record.Binary
+		file.Data = entry.content
+		entry.Record.Binary = &file
+	}
+
+	err := m.AddRecord(entry.Identifier, entry.Record, entry.Metadata)
+	if errors.Is(err, ErrTooLarge) && entry.Record.Type == models.RecordBinary {
+		file := entry.Record.Binary
+		err = m.uploadContent(entry.Identifier, file.Name, bytes.NewReader(file.Data), int64(len(file.Data)), entry.Metadata)
+	}
+	if err := importOutcome(entry.Identifier, err, result); err != nil || len(result.Imported) == imported {
+		return err
+	}
+
+	//Вложения прикрепляются только к сохраненным данным, не удавшиеся пропускаются, как и данные
+	for _, attachment := range entry.attachments {
+		err := m.attachContent(entry.Identifier, attachment.Name, attachment.MimeType,
+			bytes.NewReader(attachment.content), int64(len(attachment.content)))
+		switch {
+		case errors.Is(err, ErrUnauthorized), errors.Is(err, ErrQuotaExceeded):
+			return err
+		case err != nil:
+			result.Skipped = append(result.Skipped, fmt.Sprintf("%s/%s: %s", entry.Identifier, attachment.Name, err))
+		}
+	}
+
+	return nil
+}
+
+// readBackup расшифровывает и проверяет резервную копию потоком и передает restore данные по одним
+// вместе с содержимым. Если restore равно nil, содержимое не собирается: копия только проверяется.
+func readBackup(path, password string, restore func(item *backupItem) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("cannot read backup file: %w", err)
+	}
+	defer file.Close()
+
+	header := make([]byte, backupHeaderSize)
+	if _, err := io.ReadFull(file, header); err != nil || string(header[:len(backupMagic)]) != backupMagic {
+		return fmt.Errorf("%s is not a backup file", path)
+	}
+	if version := header[len(backupMagic)]; version != backupVersion {
+		return fmt.Errorf("unsupported backup version %d", version)
+	}
+
+	salt := header[len(backupMagic)+1:]
+	decrypted, err := crypt.NewDecryptReader(backupKey(password, salt), bufio.NewReader(file))
+	if err != nil {
+		return ErrBadBackup
+	}
+
+	reader := &backupReader{lines: bufio.NewReader(decrypted), seen: make(map[string]bool)}
+	if err := reader.readHeader(); err != nil {
+		return err
+	}
+
+	//Данные передаются restore, когда началась следующая строка данных или копия закончилась
+	var item *backupItem
+	flush := func() error {
+		if item == nil || restore == nil {
+			return nil
+		}
+		return restore(item)
+	}
+
+	for {
+		line, err := reader.next()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case line.Entry != nil:
+			if err := flush(); err != nil {
+				return err
+			}
+			if err := reader.checkEntry(line.Entry); err != nil {
+				return err
+			}
+			item = &backupItem{backupEntry: *line.Entry}
+			reader.content = nil
+			if item.Record.Type == models.RecordBinary {
+				reader.content = &item.content
+			}
+		case line.Attachment != nil:
+			if item == nil {
+				return fmt.Errorf("attachment without entry: %w", ErrBadBackup)
+			}
+			if err := models.ValidateAttachmentName(line.Attachment.Name); err != nil {
+				return fmt.Errorf("bad backup entry %s: %w", item.Identifier, err)
+			}
+			item.attachments = append(item.attachments, backupItemAttachment{backupAttachment: *line.Attachment})
+			reader.content = &item.attachments[len(item.attachments)-1].content
+		case line.Chunk != nil:
+			if reader.content == nil {
+				return fmt.Errorf("content without file: %w", ErrBadBackup)
+			}
+			if restore != nil {
+				*reader.content = append(*reader.content, line.Chunk...)
+			}
+		case line.End != nil:
+			if line.End.Entries != len(reader.seen) {
+				return ErrBadBackup
+			}
+			if _, err := reader.lines.ReadByte(); !errors.Is(err, io.EOF) {
+				return ErrBadBackup
+			}
+			return flush()
+		default:
+			return fmt.Errorf("unexpected backup line: %w", ErrBadBackup)
+		}
+	}
+}
+
+// backupReader строки расшифрованной копии
+type backupReader struct {
+	lines   *bufio.Reader
+	seen    map[string]bool // идентификаторы прочитанных данных
+	content *[]byte         // содержимое, к которому относятся следующие части
+}
+
+// next читает очередную строку. Ошибка расшифровывания означает поврежденную копию или неверный пароль.
+func (m *backupReader) next() (backupLine, error) {
+	var line backupLine
+
+	data, err := m.lines.ReadBytes('\n')
+	if err != nil {
+		return line, ErrBadBackup
+	}
+
+	if err := json.Unmarshal(data, &line); err != nil {
+		return line, fmt.Errorf("cannot unmarshal backup: %w", err)
+	}
+	if line.Header != nil {
+		return line, fmt.Errorf("unexpected backup header: %w", ErrBadBackup)
+	}
+
+	return line, nil
+}
+
+// readHeader читает и проверяет заголовок открытого содержимого
+func (m *backupReader) readHeader() error {
+	data, err := m.lines.ReadBytes('\n')
+	if err != nil {
+		return ErrBadBackup
+	}
+
+	var line backupLine
+	if err := json.Unmarshal(data, &line); err != nil || line.Header == nil || line.Header.Version != backupVersion {
+		return ErrBadBackup
+	}
+
+	return nil
+}
+
+// checkEntry проверяет идентификатор и запись данных копии
+func (m *backupReader) checkEntry(entry *backupEntry) error {
+	if entry.Identifier == `` || m.seen[entry.Identifier] {
+		return fmt.Errorf("bad backup entry identifier %q", entry.Identifier)
+	}
+	m.seen[entry.Identifier] = true
+
+	if err := entry.Record.Validate(); err != nil {
+		return fmt.Errorf("bad backup entry %s: %w", entry.Identifier, err)
+	}
+	if entry.Record.Type == models.RecordBinary && len(entry.Record.Binary.Data) != 0 {
+		return fmt.Errorf("bad backup entry %s: file content inside record", entry.Identifier)
+	}
+
+	return nil
+}
@@ -0,0 +1,125 @@
+package app
+
+import (
+	"bytes"
+	"errors"
+	"github.com/lionslon/go-keepass/internal/crypt"
+	"github.com/lionslon/go-keepass/internal/models"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBackupRestore(t *testing.T) {
+	endpoint := newTestServer(t)
+	dir := t.TempDir()
+
+	owner := newTestUser(t, endpoint, "alice", "password")
+
+	//Файл в несколько сегментов потока загружается частями, небольшой сохраняется записью целиком
+	video := bytes.Repeat([]byte("0123456789abcdef"), 3*crypt.StreamSegmentSize/16+100)
+	scan := []byte("%PDF scan")
+	for name, content := range map[string][]byte{"video.mp4": video, "scan.pdf": scan} {
+		if err := os.WriteFile(filepath.Join(dir, name), content, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := owner.AddRecord("notes/plan", models.NewTextRecord("plan"), models.Metadata{Tags: []string{"work"}}); err != nil {
+		t.Fatalf("AddRecord() error = %v", err)
+	}
+	small := models.Record{Type: models.RecordBinary, Binary: &models.BinaryFile{Name: "key.txt", Data: []byte("secret key")}}
+	if err := owner.AddRecord("key", small, models.Metadata{}); err != nil {
+		t.Fatalf("AddRecord() error = %v", err)
+	}
+	if err := owner.UploadFile("video", filepath.Join(dir, "video.mp4"), models.Metadata{Tags: []string{"media"}}); err != nil {
+		t.Fatalf("UploadFile() error = %v", err)
+	}
+	if _, err := owner.Attach("notes/plan", filepath.Join(dir, "scan.pdf"), ``); err != nil {
+		t.Fatalf("Attach() error = %v", err)
+	}
+
+	path := filepath.Join(dir, "alice.backup")
+	count, err := owner.Backup(path, "backup password")
+	if err != nil {
+		t.Fatalf("Backup() error = %v", err)
+	}
+	if count != 3 {
+		t.Errorf("Backup() = %d, want 3", count)
+	}
+
+	backup, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(backup, []byte("plan")) || bytes.Contains(backup, video[:64]) {
+		t.Error("backup contains plain data")
+	}
+
+	//Копия восстанавливается в учетную запись другого пользователя с другим паролем
+	target := newTestUser(t, endpoint, "bob", "other password")
+
+	tampered := bytes.Clone(backup)
+	tampered[len(tampered)/2] ^= 0x01
+	tamperedPath := filepath.Join(dir, "tampered.backup")
+	if err := os.WriteFile(tamperedPath, tampered, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, restore := range map[string]func() (ImportResult, error){
+		"wrong password": func() (ImportResult, error) { return target.Restore(path, "wrong password") },
+		"tampered byte":  func() (ImportResult, error) { return target.Restore(tamperedPath, "backup password") },
+	} {
+		if _, err := restore(); !errors.Is(err, ErrBadBackup) {
+			t.Errorf("Restore() %s error = %v, want %v", name, err, ErrBadBackup)
+		}
+	}
+
+	//Поврежденная копия проверяется целиком, прежде чем сохраняются первые данные
+	if entries, err := target.listAll(); err != nil || len(entries) != 0 {
+		t.Fatalf("listAll() after rejected restore = %d entries, %v, want none", len(entries), err)
+	}
+
+	result, err := target.Restore(path, "backup password")
+	if err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if len(result.Imported) != 3 || len(result.Skipped) != 0 {
+		t.Errorf("Restore() = %+v, want 3 imported", result)
+	}
+
+	record, metadata, err := target.GetRecord("notes/plan")
+	if err != nil {
+		t.Fatalf("GetRecord() error = %v", err)
+	}
+	if record.Text == nil || record.Text.Text != "plan" || !metadata.HasTag("work") {
+		t.Errorf("GetRecord() = %+v, %+v, want restored note", record.Text, metadata)
+	}
+
+	for identifier, want := range map[string][]byte{"video": video, "key": small.Binary.Data} {
+		file := filepath.Join(dir, identifier+".restored")
+		if err := target.DownloadFile(identifier, file); err != nil {
+			t.Fatalf("DownloadFile(%s) error = %v", identifier, err)
+		}
+		if got, _ := os.ReadFile(file); !bytes.Equal(got, want) {
+			t.Errorf("DownloadFile(%s) = %d bytes, want %d restored bytes", identifier, len(got), len(want))
+		}
+	}
+
+	attachment := filepath.Join(dir, "scan.restored")
+	if err := target.SaveAttachment("notes/plan", "scan.pdf", attachment); err != nil {
+		t.Fatalf("SaveAttachment() error = %v", err)
+	}
+	if got, _ := os.ReadFile(attachment); !bytes.Equal(got, scan) {
+		t.Errorf("SaveAttachment() = %q, want %q", got, scan)
+	}
+
+	//Повторное восстановление не перезаписывает данные
+	result, err = target.Restore(path, "backup password")
+	if err != nil {
+		t.Fatalf("Restore() again error = %v", err)
+	}
+	if len(result.Imported) != 0 || len(result.Duplicates) != 3 {
+		t.Errorf("Restore() again = %+v, want 3 duplicates", result)
+	}
+}
@@ -0,0 +1,380 @@
+package app
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/lionslon/go-keepass/internal/crypt"
+	"github.com/lionslon/go-keepass/internal/models"
+	"golang.org/x/crypto/argon2"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const (
+	// cacheDataLimit наибольший размер зашифрованных данных, содержимое которых хранится в локальном кэше.
+	// Большие файлы доступны только при связи с сервером.
+	cacheDataLimit = 1 << 20
+)
+
+// Файл кэша: cacheMagic || версия || параметры Argon2id || соль || содержимое, зашифрованное crypt.SymmetricEncrypt.
+// Ключ получается из пароля пользователя через Argon2id с солью, параметры хранятся в заголовке,
+// чтобы их можно было менять без потери прежних кэшей.
+const (
+	cacheMagic          = "GKPCACHE"
+	cacheVersion        = 1
+	cacheSaltSize       = 16
+	cacheHeaderSize     = len(cacheMagic) + 1 + 4 + 4 + 1 + cacheSaltSize
+	cacheArgonTime      = 3
+	cacheArgonMemory    = 64 << 10 // КиБ
+	cacheArgonLanes     = 4
+	cacheArgonMaxTime   = 16
+	cacheArgonMaxMemory = 1 << 20 // КиБ, ограничение для параметров из заголовка
+)
+
+// cacheKey ключ шифрования кэша, выведенный из пароля. Хранится в состоянии, чтобы не выводить
+// ключ заново при каждом сохранении.
+type cacheKey struct {
+	password string // пароль, из которого выведен ключ
+	header   []byte // заголовок файла с параметрами и солью
+	key      string // ключ для crypt.SymmetricEncrypt
+}
+
+// newCacheKey выводит ключ кэша из пароля со случайной солью и текущими параметрами
+func newCacheKey(password string) (*cacheKey, error) {
+	header := make([]byte, cacheHeaderSize)
+	copy(header, cacheMagic)
+	params := header[len(cacheMagic):]
+	params[0] = cacheVersion
+	binary.BigEndian.PutUint32(params[1:], cacheArgonTime)
+	binary.BigEndian.PutUint32(params[5:], cacheArgonMemory)
+	params[9] = cacheArgonLanes
+	if _, err := rand.Read(params[10:]); err != nil {
+		return nil, fmt.Errorf("cannot generate salt: %w", err)
+	}
+
+	return deriveCacheKey(password, header)
+}
+
+// deriveCacheKey выводит ключ кэша из пароля по параметрам и соли заголовка
+func deriveCacheKey(password string, header []byte) (*cacheKey, error) {
+	params := header[len(cacheMagic):]
+	if version := params[0]; version != cacheVersion {
+		return nil, fmt.Errorf("unsupported local cache version %d", version)
+	}
+
+	passes := binary.BigEndian.Uint32(params[1:])
+	memory := binary.BigEndian.Uint32(params[5:])
+	lanes := params[9]
+	if passes == 0 || passes > cacheArgonMaxTime || memory > cacheArgonMaxMemory || lanes == 0 || memory < 8*uint32(lanes) {
+		return nil, fmt.Errorf("bad local cache key parameters")
+	}
+
+	key := argon2.IDKey([]byte(password), params[10:], passes, memory, lanes, 32)
+
+	return &cacheKey{
+		password: password,
+		header:   bytes.Clone(header),
+		key:      hex.EncodeToString(key),
+	}, nil
+}
+
+// cacheEntry данные в локальном кэше, зашифрованные так же, как на сервере
+type cacheEntry struct {
+	Info models.DataInfo `json:"info"`           //Описание данных с зашифрованными метаданными
+	Data []byte          `json:"data,omitempty"` //Зашифрованные данные, nil - содержимое не загружено
+}
+
+// cacheFile содержимое файла локального кэша. Файл целиком шифруется паролем пользователя.
+type cacheFile struct {
+	Cursor    int64                  `json:"cursor"`    //Курсор синхронизации
+	Entries   map[string]*cacheEntry `json:"entries"`   //Копия данных на сервере
+	Revisions map[string]int64       `json:"revisions"` //Ревизии, полученные клиентом
+	Pending   []edit                 `json:"pending"`   //Неотправленные изменения
+	Conflicts []conflict             `json:"conflicts"` //Неразрешенные конфликты
+
+	key *cacheKey //Ключ, которым зашифрован файл
+}
+
+// cachePath путь до файла кэша пользователя, пустой - кэш на диске отключен
+func (m *sender) cachePath(login string) string {
+	if m.cfg.CacheDir == `` {
+		return ``
+	}
+
+	//Имя файла не раскрывает логин и различает серверы
+	sum := sha256.Sum256([]byte(m.cfg.ServerEndpoint + "\n" + login))
+
+	return filepath.Join(m.cfg.CacheDir, hex.EncodeToString(sum[:])+".cache")
+}
+
+// readCache читает и расшифровывает кэш пользователя, nil - кэша нет
+func (m *sender) readCache(login, password string) (*cacheFile, error) {
+	path := m.cachePath(login)
+	if path == `` {
+		return nil, nil
+	}
+
+	encryptData, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read local cache: %w", err)
+	}
+
+	if len(encryptData) < cacheHeaderSize || string(encryptData[:len(cacheMagic)]) != cacheMagic {
+		return nil, fmt.Errorf("unknown local cache format")
+	}
+
+	//Пароль проверяется расшифровкой, поэтому подбор пароля по файлу кэша стоит вывода ключа Argon2id
+	key, err := deriveCacheKey(password, encryptData[:cacheHeaderSize])
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := crypt.SymmetricDecrypt(key.key, encryptData[cacheHeaderSize:])
+	if err != nil {
+		return nil, fmt.Errorf("cannot decrypt local cache: %w", err)
+	}
+
+	cache := &cacheFile{key: key}
+	if err := json.Unmarshal(data, cache); err != nil {
+		return nil, fmt.Errorf("cannot unmarshal local cache: %w", err)
+	}
+
+	return cache, nil
+}
+
+// saveCache шифрует и сохраняет состояние в кэш пользователя, если оно изменилось.
+// Ошибка сохранения не мешает работе с сервером, поэтому о ней только сообщается.
+func (m *sender) saveCache() {
+	s := m.state
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := m.cachePath(s.login)
+	if !s.dirty || path == `` || m.password == `` {
+		return
+	}
+
+	//Новая соль выбирается при первом сохранении и при смене пароля
+	if s.cacheKey == nil || s.cacheKey.password != m.password {
+		key, err := newCacheKey(m.password)
+		if err != nil {
+			s.notify("cannot save local cache: %s", err)
+			return
+		}
+		s.cacheKey = key
+	}
+
+	if err := writeCache(path, s.cacheKey, &cacheFile{
+		Cursor:    s.cursor,
+		Entries:   s.entries,
+		Revisions: s.revisions,
+		Pending:   s.pending,
+		Conflicts: s.conflicts,
+	}); err != nil {
+		s.notify("cannot save local cache: %s", err)
+		return
+	}
+
+	s.dirty = false
+}
+
+// writeCache записывает кэш через временный файл, чтобы прерванная запись не испортила прежний кэш
+func writeCache(path string, key *cacheKey, cache *cacheFile) error {
+	data, err := json.Marshal(cache)
+	if err != nil {
+		return fmt.Errorf("cannot marshal local cache: %w", err)
+	}
+
+	encryptData, err := crypt.SymmetricEncrypt(key.key, data)
+	if err != nil {
+		return fmt.Errorf("cannot encrypt local cache: %w", err)
+	}
+	encryptData = append(bytes.Clone(key.header), encryptData...)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("cannot create cache dir: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, encryptData, 0600); err != nil {
+		return fmt.Errorf("cannot write local cache: %w", err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("cannot replace local cache: %w", err)
+	}
+
+	return nil
+}
+
+// fetchData запрашивает текущую ревизию данных, nil - данных нет на сервере
+func (m *sender) fetchData(identifier string) (*cacheEntry, error) {
+	req := m.client.R().
+		SetHeader("Authorization", m.state.auth())
+
+	url := m.dataUrl(identifier)
+
+	resp, err := req.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("cannot send get user data request: %w: %w", ErrUnavailable, err)
+	}
+
+	switch code := resp.StatusCode(); code {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		return nil, statusError(code)
+	}
+
+	metadata, err := readMetadata(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	origin, err := readOrigin(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	revision, ok := parseRevision(resp)
+	if !ok {
+		return nil, fmt.Errorf("etag header is missing")
+	}
+
+	return &cacheEntry{
+		Info: models.DataInfo{Identifier: identifier, Origin: origin, Revision: revision, Size: int64(len(resp.Body())), Metadata: metadata},
+		Data: resp.Body(),
+	}, nil
+}
+
+// local возвращает данные с неотправленным изменением, false - изменения нет или содержимое не загружено в кэш
+func (s *syncState) local(identifier string) ([]byte, []byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	view, ok, err := s.view(identifier)
+	if !ok || err != nil {
+		return nil, nil, false, err
+	}
+
+	if view.Data == nil {
+		return nil, nil, false, nil
+	}
+
+	return view.Data, view.Info.Metadata, true, nil
+}
+
+// cached возвращает данные из кэша с учетом неотправленных изменений, когда сервер недоступен
+func (s *syncState) cached(identifier string) ([]byte, []byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	view, _, err := s.view(identifier)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if view == nil {
+		return nil, nil, fmt.Errorf("data %s not found in local cache: %w", identifier, ErrUnavailable)
+	}
+
+	if view.Data == nil {
+		return nil, nil, fmt.Errorf("data %s is not available offline: %w", identifier, ErrUnavailable)
+	}
+
+	return view.Data, view.Info.Metadata, nil
+}
+
+// view данные из кэша с примененным неотправленным изменением, вызывается под s.mu.
+// Второе значение - есть ли неотправленное изменение, nil без ошибки - данных нет в кэше.
+func (s *syncState) view(identifier string) (*cacheEntry, bool, error) {
+	entry := s.entries[identifier]
+
+	for _, e := range s.pending {
+		if e.Identifier != identifier {
+			continue
+		}
+
+		if e.Kind == editDelete {
+			return nil, true, fmt.Errorf("data %s is deleted, deletion waits for sync", identifier)
+		}
+
+		view := &cacheEntry{Info: models.DataInfo{Identifier: identifier}}
+		if entry != nil && e.Kind != editAdd {
+			copied := *entry
+			view = &copied
+		}
+		if e.Kind != editMetadata {
+			view.Data = e.Data
+			view.Info.Size = int64(len(e.Data))
+		}
+		if e.Metadata != nil {
+			view.Info.Metadata = e.Metadata
+		}
+
+		return view, true, nil
+	}
+
+	return entry, false, nil
+}
+
+// list возвращает страницу списка данных папки folder из кэша с учетом неотправленных изменений
+func (s *syncState) list(folder, field string, desc bool, offset, limit int) models.DataList {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	identifiers := make(map[string]struct{}, len(s.entries)+len(s.pending))
+	for identifier := range s.entries {
+		identifiers[identifier] = struct{}{}
+	}
+	for _, e := range s.pending {
+		identifiers[e.Identifier] = struct{}{}
+	}
+
+	items := make([]models.DataInfo, 0, len(identifiers))
+	for identifier := range identifiers {
+		if !models.InFolder(identifier, folder) {
+			continue
+		}
+		if view, _, err := s.view(identifier); err == nil && view != nil {
+			items = append(items, view.Info)
+		}
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		a, b := items[i], items[j]
+		if desc {
+			a, b = b, a
+		}
+		switch {
+		case field == "created" && !a.CreatedAt.Equal(b.CreatedAt):
+			return a.CreatedAt.Before(b.CreatedAt)
+		case field == "updated" && !a.UpdatedAt.Equal(b.UpdatedAt):
+			return a.UpdatedAt.Before(b.UpdatedAt)
+		case field == "size" && a.Size != b.Size:
+			return a.Size < b.Size
+		}
+		return a.Identifier < b.Identifier
+	})
+
+	list := models.DataList{Items: []models.DataInfo{}, Total: int64(len(items))}
+	if offset < len(items) {
+		list.Items = items[offset:min(offset+limit, len(items))]
+	}
+
+	return list
+}
@@ -0,0 +1,277 @@
+package app
+
+import (
+	"encoding/binary"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/lionslon/go-keepass/internal/models"
+	"github.com/lionslon/go-keepass/internal/server/handlers"
+	"github.com/lionslon/go-keepass/internal/storage"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// newFlakyServer запускает сервер, который можно сделать недоступным: пока down установлен,
+// соединения закрываются без ответа, как при обрыве связи
+func newFlakyServer(t *testing.T) (string, *atomic.Bool) {
+	t.Helper()
+
+	if _, err := testServerKey(); err != nil {
+		t.Fatalf("cannot create server key: %v", err)
+	}
+
+	router := chi.NewRouter()
+	handler := handlers.NewKeeperHandler(storage.NewMemStorage(), handlers.Limits{})
+	handler.Register(router)
+
+	down := new(atomic.Bool)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			panic(http.ErrAbortHandler)
+		}
+		router.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	return server.URL, down
+}
+
+func TestCacheRoundTrip(t *testing.T) {
+	m := newCachedSender(t, "http://localhost", t.TempDir())
+	path := m.cachePath("alice")
+
+	if cache, err := m.readCache("alice", "password"); cache != nil || err != nil {
+		t.Fatalf("readCache() without file = %v, %v, want nil", cache, err)
+	}
+
+	key, err := newCacheKey("password")
+	if err != nil {
+		t.Fatalf("newCacheKey() error = %v", err)
+	}
+	want := &cacheFile{
+		Cursor: 7,
+		Entries: map[string]*cacheEntry{
+			"notes/plan": {Info: models.DataInfo{Identifier: "notes/plan", Revision: 2, Size: 4}, Data: []byte("data")},
+		},
+		Revisions: map[string]int64{"notes/plan": 2},
+		Pending:   []edit{{Identifier: "notes/new", Kind: editAdd, Data: []byte("new")}},
+		Conflicts: []conflict{},
+	}
+	if err := writeCache(path, key, want); err != nil {
+		t.Fatalf("writeCache() error = %v", err)
+	}
+
+	got, err := m.readCache("alice", "password")
+	if err != nil {
+		t.Fatalf("readCache() error = %v", err)
+	}
+	if got.key == nil || got.key.key != key.key {
+		t.Errorf("readCache() key = %+v, want key of written file", got.key)
+	}
+	got.key = nil
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("readCache() = %+v, want %+v", got, want)
+	}
+
+	if _, err := m.readCache("alice", "wrong"); err == nil {
+		t.Error("readCache() with wrong password error = nil, want error")
+	}
+	if cache, err := m.readCache("bob", "password"); cache != nil || err != nil {
+		t.Errorf("readCache() of other user = %v, %v, want nil", cache, err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"truncated header", data[:cacheHeaderSize-1]},
+		{"truncated data", data[:len(data)-1]},
+		{"corrupted data", append(data[:len(data)-1:len(data)-1], data[len(data)-1]^0x01)},
+		{"corrupted salt", append(append(data[:cacheHeaderSize-1:cacheHeaderSize-1], data[cacheHeaderSize-1]^0x01), data[cacheHeaderSize:]...)},
+		{"no header", data[cacheHeaderSize:]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(path, tt.data, 0600); err != nil {
+				t.Fatal(err)
+			}
+			if cache, err := m.readCache("alice", "password"); err == nil {
+				t.Errorf("readCache() = %+v, want error", cache)
+			}
+		})
+	}
+}
+
+func TestDeriveCacheKeyParams(t *testing.T) {
+	key, err := newCacheKey("password")
+	if err != nil {
+		t.Fatalf("newCacheKey() error = %v", err)
+	}
+
+	//header заголовок key с измененными параметрами
+	header := func(change func(params []byte)) []byte {
+		header := append([]byte(nil), key.header...)
+		change(header[len(cacheMagic):])
+		return header
+	}
+
+	tests := []struct {
+		name   string
+		header []byte
+	}{
+		{"unknown version", header(func(p []byte) { p[0] = cacheVersion + 1 })},
+		{"no passes", header(func(p []byte) { binary.BigEndian.PutUint32(p[1:], 0) })},
+		{"too many passes", header(func(p []byte) { binary.BigEndian.PutUint32(p[1:], cacheArgonMaxTime+1) })},
+		{"too much memory", header(func(p []byte) { binary.BigEndian.PutUint32(p[5:], cacheArgonMaxMemory+1) })},
+		{"no lanes", header(func(p []byte) { p[9] = 0 })},
+		{"too little memory", header(func(p []byte) { binary.BigEndian.PutUint32(p[5:], 8*cacheArgonLanes-1) })},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := deriveCacheKey("password", tt.header); err == nil {
+				t.Error("deriveCacheKey() error = nil, want error")
+			}
+		})
+	}
+
+	//Те же параметры и соль дают тот же ключ
+	derived, err := deriveCacheKey("password", key.header)
+	if err != nil {
+		t.Fatalf("deriveCacheKey() error = %v", err)
+	}
+	if derived.key != key.key {
+		t.Error("deriveCacheKey() = other key, want key of the header")
+	}
+}
+
+// offlineUser сохраняет записи пользователя alice в кэш cacheDir, делает сервер недоступным
+// и возвращает клиента, заново вошедшего без связи с сервером
+func offlineUser(t *testing.T, endpoint string, down *atomic.Bool, cacheDir string, records map[string]string) *sender {
+	t.Helper()
+
+	online := newCachedSender(t, endpoint, cacheDir)
+	if err := online.Register("alice", "password"); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	for identifier, text := range records {
+		if err := online.AddRecord(identifier, models.NewTextRecord(text), models.Metadata{}); err != nil {
+			t.Fatalf("AddRecord(%s) error = %v", identifier, err)
+		}
+	}
+	if err := online.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	down.Store(true)
+
+	m := newCachedSender(t, endpoint, cacheDir)
+	if err := m.Login("alice", "wrong"); err == nil {
+		t.Fatal("Login() offline with wrong password error = nil, want error")
+	}
+	if err := m.Login("alice", "password"); err != nil {
+		t.Fatalf("Login() offline error = %v", err)
+	}
+
+	return m
+}
+
+func TestOfflineLogin(t *testing.T) {
+	endpoint, down := newFlakyServer(t)
+	records := map[string]string{"notes/plan": "plan", "notes/todo": "todo"}
+
+	m := offlineUser(t, endpoint, down, t.TempDir(), records)
+
+	if status := m.SyncStatus(); status.User != "alice" || status.Online || status.Cached != len(records) {
+		t.Errorf("SyncStatus() = %+v, want offline alice with %d cached", status, len(records))
+	}
+
+	for identifier, text := range records {
+		checkText(t, "offline", m, identifier, text)
+	}
+
+	entries, total, err := m.ListEntries(``, false, 0, 10)
+	if err != nil {
+		t.Fatalf("ListEntries() error = %v", err)
+	}
+	if total != int64(len(records)) || len(entries) != len(records) {
+		t.Errorf("ListEntries() = %+v, %d, want %d entries", entries, total, len(records))
+	}
+
+	if _, _, err := m.GetRecord("notes/missing"); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("GetRecord() not cached error = %v, want %v", err, ErrUnavailable)
+	}
+
+	//Без кэша войти без связи с сервером нельзя
+	other := newCachedSender(t, endpoint, t.TempDir())
+	if err := other.Login("alice", "password"); err == nil || !strings.Contains(err.Error(), "no local cache") {
+		t.Errorf("Login() offline without cache error = %v, want no local cache", err)
+	}
+}
+
+func TestOfflineQueueReplay(t *testing.T) {
+	endpoint, down := newFlakyServer(t)
+	cacheDir := t.TempDir()
+
+	m := offlineUser(t, endpoint, down, cacheDir, map[string]string{"notes/plan": "plan", "notes/old": "old"})
+
+	if err := m.AddRecord("notes/new", models.NewTextRecord("new"), models.Metadata{}); !errors.Is(err, ErrQueued) {
+		t.Errorf("AddRecord() offline error = %v, want %v", err, ErrQueued)
+	}
+	if err := m.UpdateRecord("notes/plan", models.NewTextRecord("plan v2"), nil); !errors.Is(err, ErrQueued) {
+		t.Errorf("UpdateRecord() offline error = %v, want %v", err, ErrQueued)
+	}
+	if err := m.DeleteData("notes/old"); !errors.Is(err, ErrQueued) {
+		t.Errorf("DeleteData() offline error = %v, want %v", err, ErrQueued)
+	}
+
+	//Очередь видна в локальных чтениях и переживает перезапуск клиента
+	checkText(t, "offline", m, "notes/new", "new")
+	checkText(t, "offline", m, "notes/plan", "plan v2")
+	if _, _, err := m.GetRecord("notes/old"); err == nil {
+		t.Error("GetRecord() of queued deletion error = nil, want error")
+	}
+
+	restarted := newCachedSender(t, endpoint, cacheDir)
+	if err := restarted.Login("alice", "password"); err != nil {
+		t.Fatalf("Login() offline after restart error = %v", err)
+	}
+	if status := restarted.SyncStatus(); status.Pending != 3 {
+		t.Fatalf("SyncStatus() after restart = %+v, want 3 pending", status)
+	}
+
+	//Пока сервер недоступен, синхронизация сохраняет очередь
+	if err := restarted.Sync(); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("Sync() offline error = %v, want %v", err, ErrUnavailable)
+	}
+
+	down.Store(false)
+
+	if err := restarted.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if status := restarted.SyncStatus(); !status.Online || status.Pending != 0 || status.Conflicts != 0 {
+		t.Errorf("SyncStatus() after Sync() = %+v, want online without pending", status)
+	}
+
+	other := newTestSender(t, endpoint)
+	if err := other.Login("alice", "password"); err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+	checkText(t, "server", other, "notes/new", "new")
+	checkText(t, "server", other, "notes/plan", "plan v2")
+	if _, _, err := other.GetRecord("notes/old"); err == nil {
+		t.Error("GetRecord() of deleted data error = nil, want error")
+	}
+}
@@ -0,0 +1,204 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Resolution способ разрешения конфликта
+type Resolution string
+
+const (
+	KeepLocal  Resolution = "local"  // отправить локальное изменение поверх изменения на сервере
+	KeepRemote Resolution = "remote" // отказаться от локального изменения
+	KeepBoth   Resolution = "both"   // сохранить локальную версию под новым идентификатором, на сервере оставить прежнюю
+)
+
+// conflict локальное изменение, отклоненное из-за одновременного изменения данных на сервере
+type conflict struct {
+	edit
+	DetectedAt time.Time `json:"detected_at"` // время обнаружения конфликта
+}
+
+// Conflict описание неразрешенного конфликта
+type Conflict struct {
+	Identifier     string    // идентификатор данных
+	Action         string    // локальное изменение: add, update, metadata или delete
+	BaseRevision   int64     // ревизия, на которой сделано локальное изменение
+	RemoteRevision int64     // ревизия на сервере по последней синхронизации, 0 - данных нет
+	DetectedAt     time.Time // время обнаружения конфликта
+}
+
+// Conflicts возвращает неразрешенные конфликты
+func (m *sender) Conflicts() []Conflict {
+	s := m.state
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	conflicts := make([]Conflict, 0, len(s.conflicts))
+	for _, c := range s.conflicts {
+		conflicts = append(conflicts, Conflict{
+			Identifier:     c.Identifier,
+			Action:         c.Kind.String(),
+			BaseRevision:   c.Base,
+			RemoteRevision: s.remoteRevision(c.Identifier),
+			DetectedAt:     c.DetectedAt,
+		})
+	}
+
+	return conflicts
+}
+
+// Resolve разрешает конфликт изменения данных. Для KeepBoth возвращает идентификатор копии с локальной версией.
+func (m *sender) Resolve(identifier string, resolution Resolution) (string, error) {
+	if m.state.auth() == `` || m.password == `` {
+		return ``, fmt.Errorf("bad auth data, try login")
+	}
+
+	m.state.op.Lock()
+	defer m.state.op.Unlock()
+
+	c, ok := m.state.findConflict(identifier)
+	if !ok {
+		return ``, fmt.Errorf("no conflict for data %s", identifier)
+	}
+
+	remote, err := m.fetchData(identifier)
+	if err != nil {
+		return ``, err
+	}
+
+	e := c.edit
+
+	switch resolution {
+	case KeepRemote:
+		m.state.resolve(identifier, remote)
+		m.saveCache()
+		return ``, nil
+	case KeepLocal:
+		switch {
+		case remote == nil && e.Kind == editDelete:
+			m.state.resolve(identifier, nil)
+			m.saveCache()
+			return ``, nil
+		case remote == nil && e.Kind == editMetadata:
+			return ``, fmt.Errorf("data %s is deleted on server, restore it from trash or keep remote", identifier)
+		case remote == nil:
+			e.Kind = editAdd
+			e.Base = 0
+		case e.Kind == editAdd:
+			e.Kind = editUpdate
+			e.Base = remote.Info.Revision
+		default:
+			e.Base = remote.Info.Revision
+		}
+	case KeepBoth:
+		if e.Kind != editAdd && e.Kind != editUpdate {
+			return ``, fmt.Errorf("keep both is possible only for added or updated data, %s change of data %s cannot be copied", e.Kind, identifier)
+		}
+		//Ключ данных получается из идентификатора, поэтому копия перешифровывается ключом нового идентификатора
+		copyId := fmt.Sprintf("%s.conflict-%s", identifier, time.Now().Format("20060102-150405"))
+		metadataKeys := m.entryKeys(identifier)
+		//Копия без собственных метаданных получает метаданные с сервера
+		if e.Metadata == nil && remote != nil {
+			e.Metadata = remote.Info.Metadata
+			metadataKeys = m.dataKeys(remote.Info.KeyId(), identifier)
+		}
+		if e.Data, err = reseal(m.entryKeys(identifier), m.entryKey(copyId), e.Data); err != nil {
+			return ``, err
+		}
+		if e.Metadata, err = reseal(metadataKeys, m.entryKey(copyId), e.Metadata); err != nil {
+			return ``, err
+		}
+		e.Identifier = copyId
+		e.Kind = editAdd
+		e.Base = 0
+	default:
+		return ``, fmt.Errorf("unknown resolution %s, use %s, %s or %s", resolution, KeepLocal, KeepRemote, KeepBoth)
+	}
+
+	saved, err := m.sendEdit(e)
+	if conflict := new(ConflictError); errors.As(err, &conflict) {
+		//Данные успели измениться еще раз, конфликт остается
+		conflict.Pending = true
+		return ``, conflict
+	}
+	if err != nil {
+		return ``, err
+	}
+
+	if resolution == KeepBoth {
+		m.state.applied(e, saved)
+		m.state.resolve(identifier, remote)
+		m.saveCache()
+		return e.Identifier, nil
+	}
+
+	m.state.resolve(identifier, remote)
+	m.state.applied(e, saved)
+	m.saveCache()
+
+	return ``, nil
+}
+
+// addConflict сохраняет отклоненное изменение до разрешения конфликта, вызывается под s.mu
+func (s *syncState) addConflict(e edit) {
+	s.conflicts = append(s.conflicts, conflict{edit: e, DetectedAt: time.Now()})
+	s.dirty = true
+	s.notify("conflict: local %s of data %s clashes with change on server, resolve it", e.Kind, e.Identifier)
+}
+
+// conflict сохраняет изменение, отклоненное сервером из-за конфликта
+func (s *syncState) conflict(e edit) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.conflicts = append(s.conflicts, conflict{edit: e, DetectedAt: time.Now()})
+	s.dirty = true
+}
+
+func (s *syncState) findConflict(identifier string) (conflict, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, c := range s.conflicts {
+		if c.Identifier == identifier {
+			return c, true
+		}
+	}
+
+	return conflict{}, false
+}
+
+// resolve убирает конфликт и запоминает версию данных на сервере, которую теперь видел пользователь, nil - данных нет
+func (s *syncState) resolve(identifier string, remote *cacheEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, c := range s.conflicts {
+		if c.Identifier == identifier {
+			s.conflicts = append(s.conflicts[:i], s.conflicts[i+1:]...)
+			break
+		}
+	}
+	s.dirty = true
+
+	if remote == nil {
+		delete(s.revisions, identifier)
+		delete(s.entries, identifier)
+		return
+	}
+
+	s.revisions[identifier] = remote.Info.Revision
+	s.put(remote)
+}
+
+// remoteRevision ревизия данных на сервере по последней синхронизации, 0 - данных нет, вызывается под s.mu
+func (s *syncState) remoteRevision(identifier string) int64 {
+	if entry, ok := s.entries[identifier]; ok {
+		return entry.Info.Revision
+	}
+	return 0
+}
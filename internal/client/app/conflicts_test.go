@@ -0,0 +1,244 @@
+package app
+
+import (
+	"errors"
+	"github.com/lionslon/go-keepass/internal/models"
+	"reflect"
+	"testing"
+)
+
+func TestResolveKeepBoth(t *testing.T) {
+	endpoint := newTestServer(t)
+
+	local := newTestUser(t, endpoint, "alice", "password")
+	remote := newTestSender(t, endpoint)
+	if err := remote.Login("alice", "password"); err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+
+	if err := local.AddRecord("notes/plan", models.NewTextRecord("v1"), models.Metadata{}); err != nil {
+		t.Fatalf("AddRecord() error = %v", err)
+	}
+	if _, _, err := remote.GetRecord("notes/plan"); err != nil {
+		t.Fatalf("GetRecord() error = %v", err)
+	}
+	if err := remote.UpdateRecord("notes/plan", models.NewTextRecord("remote"), nil); err != nil {
+		t.Fatalf("UpdateRecord() remote error = %v", err)
+	}
+
+	metadata := models.Metadata{Tags: []string{"local"}}
+	err := local.UpdateRecord("notes/plan", models.NewTextRecord("local"), &metadata)
+	if conflict := new(ConflictError); !errors.As(err, &conflict) || !conflict.Pending {
+		t.Fatalf("UpdateRecord() local error = %v, want pending conflict", err)
+	}
+
+	copyId, err := local.Resolve("notes/plan", KeepBoth)
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+
+	//Копию читают оба клиента, в том числе не видевший конфликта
+	for name, m := range map[string]*sender{"local": local, "remote": remote} {
+		record, meta, err := m.GetRecord(copyId)
+		if err != nil {
+			t.Fatalf("%s GetRecord(%s) error = %v", name, copyId, err)
+		}
+		if record.Text == nil || record.Text.Text != "local" || !meta.HasTag("local") {
+			t.Errorf("%s GetRecord(%s) = %+v, %+v, want local version", name, copyId, record.Text, meta)
+		}
+
+		record, _, err = m.GetRecord("notes/plan")
+		if err != nil {
+			t.Fatalf("%s GetRecord() error = %v", name, err)
+		}
+		if record.Text == nil || record.Text.Text != "remote" {
+			t.Errorf("%s GetRecord() = %+v, want remote version", name, record.Text)
+		}
+	}
+
+	if conflicts := local.Conflicts(); len(conflicts) != 0 {
+		t.Errorf("Conflicts() = %+v, want none", conflicts)
+	}
+}
+
+// conflictedUser возвращает двух клиентов одного пользователя: remote изменил запись notes/plan
+// после того, как local ее создал, а local затем изменил ее на своей, уже устаревшей ревизии
+func conflictedUser(t *testing.T) (local, remote *sender) {
+	t.Helper()
+
+	endpoint := newTestServer(t)
+
+	local = newTestUser(t, endpoint, "alice", "password")
+	remote = newTestSender(t, endpoint)
+	if err := remote.Login("alice", "password"); err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+
+	if err := local.AddRecord("notes/plan", models.NewTextRecord("v1"), models.Metadata{}); err != nil {
+		t.Fatalf("AddRecord() error = %v", err)
+	}
+	if _, _, err := remote.GetRecord("notes/plan"); err != nil {
+		t.Fatalf("GetRecord() error = %v", err)
+	}
+	if err := remote.UpdateRecord("notes/plan", models.NewTextRecord("remote"), nil); err != nil {
+		t.Fatalf("UpdateRecord() remote error = %v", err)
+	}
+
+	err := local.UpdateRecord("notes/plan", models.NewTextRecord("local"), nil)
+	if conflict := new(ConflictError); !errors.As(err, &conflict) || !conflict.Pending {
+		t.Fatalf("UpdateRecord() local error = %v, want pending conflict", err)
+	}
+
+	return local, remote
+}
+
+// checkText проверяет текст записи identifier у клиента m
+func checkText(t *testing.T, name string, m *sender, identifier, want string) {
+	t.Helper()
+
+	record, _, err := m.GetRecord(identifier)
+	if err != nil {
+		t.Fatalf("%s GetRecord(%s) error = %v", name, identifier, err)
+	}
+	if record.Text == nil || record.Text.Text != want {
+		t.Errorf("%s GetRecord(%s) = %+v, want %q", name, identifier, record.Text, want)
+	}
+}
+
+func TestApplyConflict(t *testing.T) {
+	local, _ := conflictedUser(t)
+
+	conflicts := local.Conflicts()
+	if len(conflicts) != 1 {
+		t.Fatalf("Conflicts() = %+v, want one", conflicts)
+	}
+	if c := conflicts[0]; c.Identifier != "notes/plan" || c.Action != "update" || c.BaseRevision != 1 {
+		t.Errorf("Conflicts() = %+v, want update of notes/plan on revision 1", c)
+	}
+
+	//Следующие изменения тех же данных отклоняются до разрешения конфликта и не отправляются
+	err := local.UpdateRecord("notes/plan", models.NewTextRecord("local again"), nil)
+	if conflict := new(ConflictError); !errors.As(err, &conflict) || !conflict.Pending {
+		t.Errorf("UpdateRecord() with unresolved conflict error = %v, want pending conflict", err)
+	}
+	if err := local.DeleteData("notes/plan"); !errors.As(err, new(*ConflictError)) {
+		t.Errorf("DeleteData() with unresolved conflict error = %v, want conflict", err)
+	}
+
+	//Изменения других данных отправляются как обычно
+	if err := local.AddRecord("notes/other", models.NewTextRecord("other"), models.Metadata{}); err != nil {
+		t.Fatalf("AddRecord() of other data error = %v", err)
+	}
+
+	//Создание существующих данных - ошибка пользователя, конфликт не сохраняется
+	err = local.AddRecord("notes/other", models.NewTextRecord("new"), models.Metadata{})
+	if conflict := new(ConflictError); !errors.As(err, &conflict) || conflict.Pending {
+		t.Errorf("AddRecord() of existing data error = %v, want not pending conflict", err)
+	}
+	if conflicts := local.Conflicts(); len(conflicts) != 1 {
+		t.Errorf("Conflicts() = %+v, want one", conflicts)
+	}
+}
+
+func TestResolveKeepLocal(t *testing.T) {
+	local, remote := conflictedUser(t)
+
+	if _, err := local.Resolve("notes/plan", KeepLocal); err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if conflicts := local.Conflicts(); len(conflicts) != 0 {
+		t.Errorf("Conflicts() = %+v, want none", conflicts)
+	}
+
+	if err := remote.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	for name, m := range map[string]*sender{"local": local, "remote": remote} {
+		checkText(t, name, m, "notes/plan", "local")
+	}
+
+	//Локальное изменение записано поверх ревизии с сервера, а не исходной
+	if revision, _ := local.state.revision("notes/plan"); revision != 3 {
+		t.Errorf("revision after Resolve() = %d, want 3", revision)
+	}
+	if err := local.UpdateRecord("notes/plan", models.NewTextRecord("after"), nil); err != nil {
+		t.Errorf("UpdateRecord() after Resolve() error = %v", err)
+	}
+}
+
+func TestResolveKeepRemote(t *testing.T) {
+	local, remote := conflictedUser(t)
+
+	if _, err := local.Resolve("notes/plan", KeepRemote); err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if conflicts := local.Conflicts(); len(conflicts) != 0 {
+		t.Errorf("Conflicts() = %+v, want none", conflicts)
+	}
+
+	for name, m := range map[string]*sender{"local": local, "remote": remote} {
+		checkText(t, name, m, "notes/plan", "remote")
+	}
+	if revision, _ := local.state.revision("notes/plan"); revision != 2 {
+		t.Errorf("revision after Resolve() = %d, want 2", revision)
+	}
+
+	if _, err := local.Resolve("notes/plan", KeepRemote); err == nil {
+		t.Error("Resolve() of resolved conflict error = nil, want error")
+	}
+}
+
+func TestMergeEdits(t *testing.T) {
+	add := edit{Identifier: "a", Kind: editAdd, Data: []byte("added"), Metadata: []byte("added meta")}
+	update := edit{Identifier: "a", Kind: editUpdate, Data: []byte("updated"), Base: 2}
+	updateMeta := edit{Identifier: "a", Kind: editUpdate, Data: []byte("updated"), Metadata: []byte("updated meta"), Base: 2}
+	metadata := edit{Identifier: "a", Kind: editMetadata, Data: []byte("old"), Metadata: []byte("new meta"), Base: 2}
+	remove := edit{Identifier: "a", Kind: editDelete, Base: 2}
+
+	tests := []struct {
+		name    string
+		prev    edit
+		next    edit
+		want    edit
+		keep    bool
+		wantErr bool
+	}{
+		{"update after add", add, update,
+			edit{Identifier: "a", Kind: editAdd, Data: []byte("updated"), Metadata: []byte("added meta")}, true, false},
+		{"metadata after add", add, metadata,
+			edit{Identifier: "a", Kind: editAdd, Data: []byte("added"), Metadata: []byte("new meta")}, true, false},
+		{"delete after add cancels out", add, remove, add, false, false},
+		{"add after delete becomes update", remove, add,
+			edit{Identifier: "a", Kind: editUpdate, Data: []byte("added"), Metadata: []byte("added meta"), Base: 2}, true, false},
+		{"update after metadata", metadata, update,
+			edit{Identifier: "a", Kind: editUpdate, Data: []byte("updated"), Metadata: []byte("new meta"), Base: 2}, true, false},
+		{"metadata after update", update, metadata,
+			edit{Identifier: "a", Kind: editUpdate, Data: []byte("updated"), Metadata: []byte("new meta"), Base: 2}, true, false},
+		{"update with metadata after metadata", metadata, updateMeta,
+			edit{Identifier: "a", Kind: editUpdate, Data: []byte("updated"), Metadata: []byte("updated meta"), Base: 2}, true, false},
+		{"delete after update", update, remove, remove, true, false},
+		{"add after add", add, add, add, true, true},
+		{"add after update", update, add, update, true, true},
+		{"delete after delete", remove, remove, remove, true, true},
+		{"update after delete", remove, update, remove, true, true},
+		{"metadata after delete", remove, metadata, remove, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, keep, err := mergeEdits(tt.prev, tt.next)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("mergeEdits() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if keep != tt.keep {
+				t.Errorf("mergeEdits() keep = %v, want %v", keep, tt.keep)
+			}
+			if keep && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mergeEdits() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,346 @@
+package app
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/go-resty/resty/v2"
+	"github.com/lionslon/go-keepass/internal/crypt"
+	"github.com/lionslon/go-keepass/internal/models"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// AddNewData шифрует и сохраняет новые данные без метаданных
+func (m *sender) AddNewData(identifier string, data []byte) error {
+
+	if m.password == `` {
+		return fmt.Errorf("bad auth data, try login")
+	}
+
+	encryptData, err := crypt.SymmetricEncrypt(m.entryKey(identifier), data)
+	if err != nil {
+		return fmt.Errorf("cannot encrypt user data: %w", err)
+	}
+
+	return m.postEncryptedData(identifier, encryptData, nil)
+}
+
+// GetUserData получает и расшифровывает данные
+func (m *sender) GetUserData(identifier string) ([]byte, error) {
+	if m.password == `` {
+		return nil, fmt.Errorf("bad auth data, try login")
+	}
+
+	encryptData, _, err := m.getEncryptedData(identifier)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := decryptWith(m.entryKeys(identifier), encryptData)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decrypt user data: %w", err)
+	}
+
+	return data, nil
+}
+
+// UpdateData шифрует и сохраняет новую ревизию данных, метаданные остаются прежними
+func (m *sender) UpdateData(identifier string, data []byte) error {
+
+	if m.password == `` {
+		return fmt.Errorf("bad auth data, try login")
+	}
+
+	encryptData, err := crypt.SymmetricEncrypt(m.entryKey(identifier), data)
+	if err != nil {
+		return fmt.Errorf("cannot encrypt user data: %w", err)
+	}
+
+	return m.putEncryptedData(identifier, encryptData, nil)
+}
+
+// ListData возвращает страницу списка данных пользователя, sort - identifier, created, updated или size
+func (m *sender) ListData(sort string, desc bool, offset, limit int) (models.DataList, error) {
+	return m.ListFolderData(``, sort, desc, offset, limit)
+}
+
+// ListFolderData возвращает страницу списка данных папки folder и ее вложенных папок, пустая папка - все данные
+func (m *sender) ListFolderData(folder, sort string, desc bool, offset, limit int) (models.DataList, error) {
+	var list models.DataList
+
+	if m.password == `` {
+		return list, fmt.Errorf("bad auth data, try login")
+	}
+
+	order := "asc"
+	if desc {
+		order = "desc"
+	}
+
+	req := m.client.R().
+		SetHeader("Authorization", m.state.auth()).
+		SetQueryParams(map[string]string{
+			"sort":   sort,
+			"order":  order,
+			"offset": strconv.Itoa(offset),
+			"limit":  strconv.Itoa(limit),
+		}).
+		SetResult(&list)
+	if folder != `` {
+		req.SetQueryParam("folder", folder)
+	}
+
+	url := strings.Join([]string{m.cfg.ServerEndpoint, addDataUrl}, "/")
+
+	//Без связи с сервером список строится по локальному кэшу
+	if m.state.auth() == `` {
+		return m.state.list(folder, sort, desc, offset, limit), nil
+	}
+
+	resp, err := req.Get(url)
+	if err != nil {
+		m.state.reachable(ErrUnavailable)
+		return m.state.list(folder, sort, desc, offset, limit), nil
+	}
+	m.state.reachable(nil)
+
+	if code := resp.StatusCode(); code != http.StatusOK {
+		return list, statusError(code)
+	}
+
+	return list, nil
+}
+
+// DeleteData перемещает данные в корзину
+func (m *sender) DeleteData(identifier string) error {
+	if m.password == `` {
+		return fmt.Errorf("bad auth data, try login")
+	}
+
+	return m.apply(edit{Identifier: identifier, Kind: editDelete})
+}
+
+func (m *sender) GetDataHistory(identifier string) ([]models.DataRevision, error) {
+	if m.state.auth() == `` || m.password == `` {
+		return nil, fmt.Errorf("bad auth data, try login")
+	}
+
+	var revisions []models.DataRevision
+
+	req := m.client.R().
+		SetHeader("Authorization", m.state.auth()).
+		SetResult(&revisions)
+
+	url := m.dataUrl(identifier, revisionsPath)
+
+	resp, err := req.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("cannot send get data history request: %w", err)
+	}
+
+	if code := resp.StatusCode(); code != http.StatusOK {
+		return nil, statusError(code)
+	}
+
+	return revisions, nil
+}
+
+func (m *sender) GetDataRevision(identifier string, revision int64) ([]byte, error) {
+	if m.state.auth() == `` || m.password == `` {
+		return nil, fmt.Errorf("bad auth data, try login")
+	}
+
+	encryptData, _, err := m.getEncryptedRevision(identifier, revision)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := decryptWith(m.entryKeys(identifier), encryptData)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decrypt user data: %w", err)
+	}
+
+	return data, nil
+}
+
+// RestoreRevision сохраняет данные и метаданные указанной ревизии как новую текущую ревизию
+func (m *sender) RestoreRevision(identifier string, revision int64) error {
+	if m.state.auth() == `` || m.password == `` {
+		return fmt.Errorf("bad auth data, try login")
+	}
+
+	encryptData, encryptMetadata, err := m.getEncryptedRevision(identifier, revision)
+	if err != nil {
+		return err
+	}
+
+	//Проверяем, что ревизия расшифровывается ключами текущего пароля, прежде чем делать ее актуальной
+	if _, err := decryptWith(m.entryKeys(identifier), encryptData); err != nil {
+		return fmt.Errorf("cannot decrypt user data: %w", err)
+	}
+
+	return m.putEncryptedData(identifier, encryptData, encryptMetadata)
+}
+
+// getEncryptedData получает данные с сервера и сохраняет их в локальный кэш.
+// Неотправленное изменение данных важнее версии на сервере, без связи с сервером данные берутся из кэша.
+func (m *sender) getEncryptedData(identifier string) ([]byte, []byte, error) {
+	if data, metadata, ok, err := m.state.local(identifier); ok || err != nil {
+		return data, metadata, err
+	}
+
+	if m.state.auth() == `` {
+		return m.state.cached(identifier)
+	}
+
+	entry, err := m.fetchData(identifier)
+	m.state.reachable(err)
+	if errors.Is(err, ErrUnavailable) {
+		return m.state.cached(identifier)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if entry == nil {
+		return nil, nil, statusError(http.StatusNotFound)
+	}
+
+	m.state.fetched(entry)
+	m.saveCache()
+
+	return entry.Data, entry.Info.Metadata, nil
+}
+
+func (m *sender) getEncryptedRevision(identifier string, revision int64) ([]byte, []byte, error) {
+	req := m.client.R().
+		SetHeader("Authorization", m.state.auth())
+
+	url := m.dataUrl(identifier, revisionsPath, strconv.FormatInt(revision, 10))
+
+	resp, err := req.Get(url)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot send get data revision request: %w", err)
+	}
+
+	if code := resp.StatusCode(); code != http.StatusOK {
+		return nil, nil, statusError(code)
+	}
+
+	metadata, err := readMetadata(resp)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return resp.Body(), metadata, nil
+}
+
+func (m *sender) postEncryptedData(identifier string, encryptData, encryptMetadata []byte) error {
+	return m.apply(edit{Identifier: identifier, Kind: editAdd, Data: encryptData, Metadata: encryptMetadata})
+}
+
+// putEncryptedData сохраняет новую ревизию данных, encryptMetadata nil - метаданные не меняются
+func (m *sender) putEncryptedData(identifier string, encryptData, encryptMetadata []byte) error {
+	return m.apply(edit{Identifier: identifier, Kind: editUpdate, Data: encryptData, Metadata: encryptMetadata})
+}
+
+func (m *sender) putEncryptedMetadata(identifier string, encryptMetadata []byte) error {
+	return m.apply(edit{Identifier: identifier, Kind: editMetadata, Metadata: encryptMetadata})
+}
+
+// dataUrl адрес данных и их вложенных путей. Разделитель папок в идентификаторе экранируется,
+// чтобы идентификатор остался одним сегментом пути.
+func (m *sender) dataUrl(identifier string, path ...string) string {
+	return strings.Join(append([]string{m.cfg.ServerEndpoint, addDataUrl, url.PathEscape(identifier)}, path...), "/")
+}
+
+// dataStatus ошибка для ответа на запрос к данным пользователя
+func dataStatus(identifier string, code, expected int) error {
+	switch code {
+	case expected:
+		return nil
+	case http.StatusNotFound:
+		return fmt.Errorf("data %s not found", identifier)
+	default:
+		return statusError(code)
+	}
+}
+
+// readOrigin возвращает исходный идентификатор перемещенных данных из заголовка ответа
+func readOrigin(resp *resty.Response) (string, error) {
+	origin, err := url.PathUnescape(resp.Header().Get(originHeader))
+	if err != nil {
+		return ``, fmt.Errorf("bad origin header: %w", err)
+	}
+
+	return origin, nil
+}
+
+// setMetadata передает зашифрованные метаданные в заголовке запроса
+func setMetadata(req *resty.Request, encryptMetadata []byte) {
+	if len(encryptMetadata) > 0 {
+		req.SetHeader(metadataHeader, base64.StdEncoding.EncodeToString(encryptMetadata))
+	}
+}
+
+// readMetadata возвращает зашифрованные метаданные из заголовка ответа
+func readMetadata(resp *resty.Response) ([]byte, error) {
+	header := resp.Header().Get(metadataHeader)
+	if header == `` {
+		return nil, nil
+	}
+
+	metadata, err := base64.StdEncoding.DecodeString(header)
+	if err != nil {
+		return nil, fmt.Errorf("bad metadata header: %w", err)
+	}
+
+	return metadata, nil
+}
+
+// setIfMatch добавляет в запрос последнюю известную ревизию данных,
+// чтобы сервер отклонил изменение, если данные успели изменить с другого устройства
+func (m *sender) setIfMatch(req *resty.Request, identifier string) {
+	if revision, ok := m.state.revision(identifier); ok {
+		setRevision(req, revision)
+	}
+}
+
+// setRevision добавляет в запрос условие на ревизию данных
+func setRevision(req *resty.Request, revision int64) {
+	req.SetHeader("If-Match", strconv.Quote(strconv.FormatInt(revision, 10)))
+}
+
+// rememberRevision запоминает ревизию полученных данных из ETag ответа
+func (m *sender) rememberRevision(identifier string, resp *resty.Response) {
+	if revision, ok := parseRevision(resp); ok {
+		m.state.seen(identifier, revision)
+	}
+}
+
+// rememberSaved запоминает ревизию данных, сохраненных этим клиентом, из ETag ответа.
+// Фоновая синхронизация не сообщает о таких данных как об изменениях с другого устройства.
+// origin - исходный идентификатор, от которого получен ключ данных.
+func (m *sender) rememberSaved(identifier, origin string, resp *resty.Response) {
+	if revision, ok := parseRevision(resp); ok {
+		m.state.saved(identifier, origin, revision)
+	}
+}
+
+// parseRevision возвращает ревизию данных из ETag ответа
+func parseRevision(resp *resty.Response) (int64, bool) {
+	tag, err := strconv.Unquote(resp.Header().Get("ETag"))
+	if err != nil {
+		return 0, false
+	}
+
+	revision, err := strconv.ParseInt(tag, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return revision, true
+}
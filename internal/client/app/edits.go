@@ -0,0 +1,225 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-resty/resty/v2"
+	"github.com/lionslon/go-keepass/internal/models"
+	"net/http"
+	"strings"
+)
+
+// editKind вид изменения данных
+type editKind int
+
+const (
+	editAdd      editKind = iota // создание данных
+	editUpdate                   // новая ревизия данных, метаданные могут не меняться
+	editMetadata                 // новая ревизия с измененными метаданными
+	editDelete                   // перемещение данных в корзину
+)
+
+func (k editKind) String() string {
+	switch k {
+	case editAdd:
+		return "add"
+	case editUpdate:
+		return "update"
+	case editMetadata:
+		return "metadata"
+	default:
+		return "delete"
+	}
+}
+
+// edit изменение данных пользователя, уже зашифрованное для отправки на сервер и хранения в локальном кэше
+type edit struct {
+	Identifier string   `json:"identifier"`         //Идентификатор данных
+	Kind       editKind `json:"kind"`               //Вид изменения
+	Data       []byte   `json:"data,omitempty"`     //Зашифрованные данные
+	Metadata   []byte   `json:"metadata,omitempty"` //Зашифрованные метаданные, nil - не меняются
+	Base       int64    `json:"base"`               //Ревизия, на которой сделано изменение, 0 - неизвестна и не проверяется сервером
+}
+
+// apply отправляет изменение пользователя на сервер.
+// Если сервер недоступен или у данных уже есть неотправленные изменения, изменение ставится в очередь фоновой синхронизации.
+// Изменение существующих данных, отклоненное из-за конфликта, сохраняется до разрешения конфликта.
+func (m *sender) apply(e edit) error {
+	m.state.op.Lock()
+	defer m.state.op.Unlock()
+
+	if e.Kind != editAdd {
+		e.Base, _ = m.state.revision(e.Identifier)
+	}
+
+	pending, conflicted := m.state.waiting(e.Identifier)
+	if conflicted {
+		return &ConflictError{Identifier: e.Identifier, Pending: true}
+	}
+
+	//Изменение отправится после уже ожидающих изменений тех же данных.
+	//Без токена (вход без связи с сервером) изменение сразу ставится в очередь.
+	if pending || m.state.auth() == `` {
+		return m.enqueue(e)
+	}
+
+	revision, err := m.sendEdit(e)
+	m.state.reachable(err)
+	//Создание уже существующих данных - ошибка пользователя, а не одновременное изменение, его не сохраняем
+	if conflict := new(ConflictError); errors.As(err, &conflict) && e.Kind != editAdd {
+		m.state.conflict(e)
+		m.saveCache()
+		conflict.Pending = true
+		return conflict
+	}
+	if errors.Is(err, ErrUnavailable) {
+		return m.enqueue(e)
+	}
+	if err != nil {
+		return err
+	}
+
+	m.state.applied(e, revision)
+	m.saveCache()
+
+	return nil
+}
+
+// addBatch отправляет пакет новых данных одним запросом и возвращает результат по каждым данным.
+// Сохраненные данные учитываются в локальном кэше, отклоненные сервером не ставятся в очередь.
+func (m *sender) addBatch(edits []edit) ([]models.AddResult, error) {
+	m.state.op.Lock()
+	defer m.state.op.Unlock()
+
+	batch := make([]models.NewData, 0, len(edits))
+	for _, e := range edits {
+		batch = append(batch, models.NewData{Identifier: e.Identifier, Data: e.Data, Metadata: e.Metadata})
+	}
+
+	var results []models.AddResult
+	resp, err := m.client.R().
+		SetHeader("Authorization", m.state.auth()).
+		SetBody(batch).
+		SetResult(&results).
+		Post(strings.Join([]string{m.cfg.ServerEndpoint, addDataUrl}, "/"))
+	if err != nil {
+		err = fmt.Errorf("cannot send data batch request: %w: %w", ErrUnavailable, err)
+	}
+	m.state.reachable(err)
+	if err != nil {
+		return nil, err
+	}
+
+	switch code := resp.StatusCode(); {
+	case code != http.StatusOK:
+		return nil, statusError(code)
+	case len(results) != len(edits):
+		return nil, fmt.Errorf("data batch of %d got %d results", len(edits), len(results))
+	}
+
+	for i, result := range results {
+		if result.Status == http.StatusAccepted {
+			m.state.applied(edits[i], result.Revision)
+		}
+	}
+	m.saveCache()
+
+	return results, nil
+}
+
+// enqueue ставит изменение в очередь фоновой синхронизации и сохраняет очередь в локальный кэш
+func (m *sender) enqueue(e edit) error {
+	err := m.state.queue(e)
+	m.saveCache()
+	if err != nil {
+		return err
+	}
+
+	return fmt.Errorf("data %s: %w", e.Identifier, ErrQueued)
+}
+
+// sendEdit отправляет изменение на сервер и возвращает новую ревизию данных (0 после удаления)
+func (m *sender) sendEdit(e edit) (int64, error) {
+	req := m.client.R().
+		SetHeader("Authorization", m.state.auth())
+	if e.Base > 0 {
+		setRevision(req, e.Base)
+	}
+
+	url := m.dataUrl(e.Identifier)
+
+	var resp *resty.Response
+	var err error
+
+	switch e.Kind {
+	case editAdd:
+		req.SetBody(e.Data).SetHeader("If-None-Match", "*")
+		setMetadata(req, e.Metadata)
+		resp, err = req.Post(url)
+	case editUpdate:
+		req.SetBody(e.Data)
+		setMetadata(req, e.Metadata)
+		resp, err = req.Put(url)
+	case editMetadata:
+		resp, err = req.SetBody(e.Metadata).Put(strings.Join([]string{url, metadataPath}, "/"))
+	default:
+		resp, err = req.Delete(url)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("cannot send %s data request: %w: %w", e.Kind, ErrUnavailable, err)
+	}
+
+	if code := resp.StatusCode(); code == http.StatusPreconditionFailed {
+		return 0, &ConflictError{Identifier: e.Identifier}
+	} else if code != http.StatusAccepted {
+		return 0, statusError(code)
+	}
+
+	if e.Kind == editDelete {
+		return 0, nil
+	}
+
+	revision, ok := parseRevision(resp)
+	if !ok {
+		return 0, fmt.Errorf("etag header is missing")
+	}
+
+	return revision, nil
+}
+
+// mergeEdits объединяет ожидающее в очереди изменение с новым изменением тех же данных.
+// Если изменения отменяют друг друга, возвращается false.
+func mergeEdits(prev, next edit) (edit, bool, error) {
+	switch next.Kind {
+	case editAdd:
+		if prev.Kind != editDelete {
+			return prev, true, fmt.Errorf("data %s already exists", next.Identifier)
+		}
+		//Удаление еще не отправлено и данные остались на сервере, поэтому создание становится новой ревизией
+		return edit{Identifier: next.Identifier, Kind: editUpdate, Data: next.Data, Metadata: next.Metadata, Base: prev.Base}, true, nil
+	case editDelete:
+		switch prev.Kind {
+		case editDelete:
+			return prev, true, fmt.Errorf("data %s is already deleted", next.Identifier)
+		case editAdd:
+			//Данные еще не созданы на сервере, оба изменения отменяются
+			return prev, false, nil
+		}
+		return edit{Identifier: next.Identifier, Kind: editDelete, Base: prev.Base}, true, nil
+	default:
+		if prev.Kind == editDelete {
+			return prev, true, fmt.Errorf("data %s is deleted", next.Identifier)
+		}
+		merged := prev
+		if next.Kind == editUpdate {
+			merged.Data = next.Data
+			if merged.Kind == editMetadata {
+				merged.Kind = editUpdate
+			}
+		}
+		if next.Metadata != nil {
+			merged.Metadata = next.Metadata
+		}
+		return merged, true, nil
+	}
+}
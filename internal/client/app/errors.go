@@ -0,0 +1,50 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ConflictError данные на сервере изменились (например, с другого устройства) после того,
+// как клиент их последний раз получал, и запрос отклонен сервером с кодом 412
+type ConflictError struct {
+	Identifier string // идентификатор данных
+	Pending    bool   // локальное изменение сохранено до разрешения конфликта (см. Resolve)
+}
+
+func (e *ConflictError) Error() string {
+	if e.Pending {
+		return fmt.Sprintf("conflicting change of data %s on server, local change is kept until the conflict is resolved", e.Identifier)
+	}
+	return fmt.Sprintf("conflicting change of data %s on server, get it again and retry", e.Identifier)
+}
+
+var (
+	// ErrTooLarge запрос больше ограничения размера, установленного на сервере
+	ErrTooLarge = errors.New("request is too large for server")
+	// ErrQuotaExceeded на сервере не осталось места в квоте пользователя
+	ErrQuotaExceeded = errors.New("storage quota exceeded, delete unused data and empty the trash")
+	// ErrUnauthorized токен отсутствует или истек
+	ErrUnauthorized = errors.New("not authorized, try login")
+	// ErrUnavailable сервер недоступен или временно не обрабатывает запросы
+	ErrUnavailable = errors.New("server is unavailable")
+	// ErrQueued сервер недоступен, изменение сохранено в очереди и будет отправлено фоновой синхронизацией
+	ErrQueued = errors.New("server is unavailable, change is queued and will be sent by background sync")
+)
+
+// statusError ошибка для неожиданного кода ответа сервера
+func statusError(code int) error {
+	switch code {
+	case http.StatusRequestEntityTooLarge:
+		return ErrTooLarge
+	case http.StatusInsufficientStorage:
+		return ErrQuotaExceeded
+	case http.StatusUnauthorized:
+		return ErrUnauthorized
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return fmt.Errorf("%w, code: %d", ErrUnavailable, code)
+	default:
+		return fmt.Errorf("request processing failed, code: %d", code)
+	}
+}
@@ -0,0 +1,195 @@
+package app
+
+import (
+	"fmt"
+	"github.com/lionslon/go-keepass/internal/models"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	foldersUrl = "api/folders"
+
+	movePath = "move"
+)
+
+// ListFolders возвращает папки пользователя с количеством данных в них, отсортированные по пути
+func (m *sender) ListFolders() ([]models.Folder, error) {
+	if m.state.auth() == `` || m.password == `` {
+		return nil, fmt.Errorf("bad auth data, try login")
+	}
+
+	var folders []models.Folder
+
+	req := m.client.R().
+		SetHeader("Authorization", m.state.auth()).
+		SetResult(&folders)
+
+	resp, err := req.Get(m.folderUrl())
+	if err != nil {
+		return nil, fmt.Errorf("cannot send list folders request: %w", err)
+	}
+
+	if code := resp.StatusCode(); code != http.StatusOK {
+		return nil, statusError(code)
+	}
+
+	return folders, nil
+}
+
+// CreateFolder создает пустую папку. Папки с данными создавать не нужно, они следуют из идентификаторов.
+func (m *sender) CreateFolder(path string) error {
+	if m.state.auth() == `` || m.password == `` {
+		return fmt.Errorf("bad auth data, try login")
+	}
+	if err := models.ValidatePath(path); err != nil {
+		return fmt.Errorf("bad folder path: %w", err)
+	}
+
+	req := m.client.R().
+		SetHeader("Authorization", m.state.auth())
+
+	resp, err := req.Post(m.folderUrl(path))
+	if err != nil {
+		return fmt.Errorf("cannot send create folder request: %w", err)
+	}
+
+	switch code := resp.StatusCode(); code {
+	case http.StatusCreated:
+		return nil
+	case http.StatusConflict:
+		return fmt.Errorf("folder %s already exists", path)
+	default:
+		return statusError(code)
+	}
+}
+
+// MoveFolder переименовывает или перемещает папку вместе с вложенными папками и данными.
+// Ключи данных не меняются, поэтому данные не перешифровываются.
+func (m *sender) MoveFolder(from, to string) (models.Folder, error) {
+	var folder models.Folder
+
+	if m.state.auth() == `` || m.password == `` {
+		return folder, fmt.Errorf("bad auth data, try login")
+	}
+	if err := models.ValidatePath(to); err != nil {
+		return folder, fmt.Errorf("bad folder path: %w", err)
+	}
+	//Неотправленное изменение данных папки ушло бы под прежним идентификатором
+	if m.state.waitingFolder(from) {
+		return folder, fmt.Errorf("folder %s has unsent changes or conflicts, sync them first", from)
+	}
+
+	req := m.client.R().
+		SetHeader("Authorization", m.state.auth()).
+		SetHeader("Content-Type", "application/json").
+		SetBody(models.MoveRequest{Path: to}).
+		SetResult(&folder)
+
+	resp, err := req.Put(m.folderUrl(from))
+	if err != nil {
+		return folder, fmt.Errorf("cannot send move folder request: %w", err)
+	}
+
+	switch code := resp.StatusCode(); code {
+	case http.StatusOK:
+	case http.StatusBadRequest:
+		return folder, fmt.Errorf("cannot move folder %s into itself", from)
+	case http.StatusNotFound:
+		return folder, fmt.Errorf("folder %s not found", from)
+	case http.StatusConflict:
+		return folder, fmt.Errorf("folder %s already exists", to)
+	default:
+		return folder, statusError(code)
+	}
+
+	m.state.movedFolder(from, to)
+	m.saveCache()
+
+	return folder, nil
+}
+
+// DeleteFolder удаляет папку, все ее данные попадают в корзину
+func (m *sender) DeleteFolder(path string) (models.Folder, error) {
+	var folder models.Folder
+
+	if m.state.auth() == `` || m.password == `` {
+		return folder, fmt.Errorf("bad auth data, try login")
+	}
+	if m.state.waitingFolder(path) {
+		return folder, fmt.Errorf("folder %s has unsent changes or conflicts, sync them first", path)
+	}
+
+	req := m.client.R().
+		SetHeader("Authorization", m.state.auth()).
+		SetResult(&folder)
+
+	resp, err := req.Delete(m.folderUrl(path))
+	if err != nil {
+		return folder, fmt.Errorf("cannot send delete folder request: %w", err)
+	}
+
+	switch code := resp.StatusCode(); code {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return folder, fmt.Errorf("folder %s not found", path)
+	default:
+		return folder, statusError(code)
+	}
+
+	m.state.deletedFolder(path)
+	m.saveCache()
+
+	return folder, nil
+}
+
+// MoveData переименовывает данные или перемещает их в другую папку. Ключ данных остается прежним:
+// он получен из исходного идентификатора, который сервер хранит вместе с данными.
+func (m *sender) MoveData(from, to string) error {
+	if m.state.auth() == `` || m.password == `` {
+		return fmt.Errorf("bad auth data, try login")
+	}
+	if err := models.ValidatePath(to); err != nil {
+		return fmt.Errorf("bad data identifier: %w", err)
+	}
+	if pending, conflict := m.state.waiting(from); pending || conflict {
+		return fmt.Errorf("data %s has unsent changes or conflicts, sync them first", from)
+	}
+
+	req := m.client.R().
+		SetHeader("Authorization", m.state.auth()).
+		SetHeader("Content-Type", "application/json").
+		SetBody(models.MoveRequest{Path: to})
+	m.setIfMatch(req, from)
+
+	resp, err := req.Post(m.dataUrl(from, movePath))
+	if err != nil {
+		return fmt.Errorf("cannot send move data request: %w", err)
+	}
+
+	switch code := resp.StatusCode(); code {
+	case http.StatusAccepted:
+	case http.StatusPreconditionFailed:
+		return &ConflictError{Identifier: from}
+	case http.StatusNotFound:
+		return fmt.Errorf("data %s not found", from)
+	case http.StatusConflict:
+		return fmt.Errorf("data %s already exists", to)
+	default:
+		return statusError(code)
+	}
+
+	m.state.moved(from, to)
+	m.saveCache()
+
+	return nil
+}
+
+func (m *sender) folderUrl(path ...string) string {
+	parts := []string{m.cfg.ServerEndpoint, foldersUrl}
+	for _, p := range path {
+		parts = append(parts, url.PathEscape(p))
+	}
+	return strings.Join(parts, "/")
+}
@@ -0,0 +1,575 @@
+package app
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/lionslon/go-keepass/internal/models"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// ImportFormat формат файла, выгруженного из браузера или другого менеджера паролей
+type ImportFormat string
+
+const (
+	ImportChrome    ImportFormat = "chrome"    //CSV из Chrome и других браузеров на Chromium
+	ImportFirefox   ImportFormat = "firefox"   //CSV из Firefox
+	ImportBitwarden ImportFormat = "bitwarden" //Незашифрованный JSON из Bitwarden
+	Import1Password ImportFormat = "1password" //CSV из 1Password
+	ImportOTPAuth   ImportFormat = "otpauth"   //Адреса otpauth:// и otpauth-migration:// (Google Authenticator) по одному в строке
+)
+
+// Ограничения пакета записей при импорте: объем с запасом меньше ограничения размера запроса на сервере по умолчанию
+const (
+	importBatchSize  = 100     // количество записей в пакете
+	importBatchBytes = 4 << 20 // объем зашифрованных записей в пакете
+)
+
+// ImportFormats все поддерживаемые форматы импорта
+var ImportFormats = []ImportFormat{ImportChrome, ImportFirefox, ImportBitwarden, Import1Password, ImportOTPAuth}
+
+// Типы элементов в выгрузке Bitwarden
+const (
+	bitwardenLogin = 1
+	bitwardenNote  = 2
+	bitwardenCard  = 3
+)
+
+// ImportResult итог импорта
+type ImportResult struct {
+	Imported   []string // идентификаторы сохраненных данных, при пробном импорте - данных, которые были бы сохранены
+	Duplicates []string // повторяющиеся в файле или уже существующие данные
+	Malformed  []string // строки файла, которые не удалось разобрать, с причиной
+	Skipped    []string // данные, которые не удалось сохранить, с причиной
+}
+
+// importItem запись, подготовленная к импорту
+type importItem struct {
+	source     string   // место записи в файле для сообщений
+	name       []string // части идентификатора: папка и название
+	identifier string   // идентификатор, под которым запись будет сохранена
+	record     models.Record
+	metadata   models.Metadata
+}
+
+// ParseImportFormat проверяет название формата импорта
+func ParseImportFormat(name string) (ImportFormat, error) {
+	for _, format := range ImportFormats {
+		if string(format) == strings.ToLower(name) {
+			return format, nil
+		}
+	}
+	return ``, fmt.Errorf("unknown import format %q", name)
+}
+
+// ImportFile импортирует учетные данные из файла, выгруженного из браузера или менеджера паролей.
+// Сначала файл разбирается целиком: неразобранные строки и повторы не мешают импорту остальных записей
+// и возвращаются в итоге, затем записи шифруются и сохраняются пакетами, итог содержит результат по каждой
+// строке. При dryRun данные только проверяются.
+// Идентификатор записи - путь из папок и названия (для Firefox - из адреса сайта),
+// данные с уже существующими идентификаторами не перезаписываются.
+func (m *sender) ImportFile(format ImportFormat, path string, dryRun bool) (ImportResult, error) {
+	var result ImportResult
+
+	if m.password == `` {
+		return result, fmt.Errorf("bad auth data, try login")
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return result, fmt.Errorf("cannot open import file: %w", err)
+	}
+	defer file.Close()
+
+	var items []importItem
+	switch format {
+	case ImportBitwarden:
+		items, result.Malformed, err = readBitwarden(file)
+	case ImportOTPAuth:
+		items, result.Malformed, err = readOTPAuth(file)
+	default:
+		items, result.Malformed, err = readLoginCSV(file, format)
+	}
+	if err != nil {
+		return result, err
+	}
+
+	existing, err := m.listAll()
+	if err != nil {
+		return result, err
+	}
+
+	exists := make(map[string]bool, len(existing))
+	for _, entry := range existing {
+		exists[entry.Identifier] = true
+	}
+
+	used := make(map[string]bool)
+	seen := make(map[string]string)
+
+	var ready []importItem
+	for _, item := range items {
+		//Повтором считается запись с тем же сайтом, логином и паролем
+		key := ``
+		if c := item.record.Credentials; c != nil {
+			key = strings.Join([]string{strings.ToLower(c.URL), c.Login, c.Password}, "\x00")
+			if first, ok := seen[key]; ok {
+				result.Duplicates = append(result.Duplicates, fmt.Sprintf("%s: duplicate of %s", item.source, first))
+				continue
+			}
+		}
+
+		if item.name[len(item.name)-1] == `` {
+			item.name[len(item.name)-1] = string(item.record.Type)
+		}
+
+		item.identifier = uniqueIdentifier(importIdentifier(item.name...), used)
+		if key != `` {
+			seen[key] = item.identifier
+		}
+
+		if exists[item.identifier] {
+			result.Duplicates = append(result.Duplicates, fmt.Sprintf("%s: %s already exists", item.source, item.identifier))
+			continue
+		}
+
+		ready = append(ready, item)
+	}
+
+	if dryRun {
+		for _, item := range ready {
+			result.Imported = append(result.Imported, item.identifier)
+		}
+		return result, nil
+	}
+
+	return result, m.importItems(ready, &result)
+}
+
+// importItems шифрует записи и сохраняет их пакетами по importBatchSize записей, не больше importBatchBytes
+// в пакете. Без связи с сервером или если у записи есть неотправленные изменения, записи сохраняются
+// по одной с постановкой в очередь синхронизации.
+func (m *sender) importItems(items []importItem, result *ImportResult) error {
+	var batch []edit
+	var sources []importItem
+	size := 0
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		defer func() { batch, sources, size = nil, nil, 0 }()
+
+		results, err := m.addBatch(batch)
+		if errors.Is(err, ErrUnavailable) {
+			for _, e := range batch {
+				if err := importOutcome(e.Identifier, m.postEncryptedData(e.Identifier, e.Data, e.Metadata), result); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		quota := false
+		for i, r := range results {
+			source := fmt.Sprintf("%s (%s)", sources[i].source, r.Identifier)
+			switch r.Status {
+			case http.StatusAccepted:
+				result.Imported = append(result.Imported, r.Identifier)
+			case http.StatusConflict:
+				result.Duplicates = append(result.Duplicates, fmt.Sprintf("%s: already exists", source))
+			case http.StatusInsufficientStorage:
+				quota = true
+				result.Skipped = append(result.Skipped, fmt.Sprintf("%s: %s", source, ErrQuotaExceeded))
+			default:
+				result.Skipped = append(result.Skipped, fmt.Sprintf("%s: %s", source, r.Error))
+			}
+		}
+		//Следующие пакеты тоже не поместятся в квоту
+		if quota {
+			return ErrQuotaExceeded
+		}
+
+		return nil
+	}
+
+	for _, item := range items {
+		data, err := m.encryptRecord(item.identifier, item.record)
+		if err != nil {
+			return err
+		}
+		metadata, err := m.encryptMetadata(item.identifier, item.metadata)
+		if err != nil {
+			return err
+		}
+
+		if pending, conflicted := m.state.waiting(item.identifier); pending || conflicted || m.state.auth() == `` {
+			if err := importOutcome(item.identifier, m.postEncryptedData(item.identifier, data, metadata), result); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if size+len(data)+len(metadata) > importBatchBytes {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		batch = append(batch, edit{Identifier: item.identifier, Kind: editAdd, Data: data, Metadata: metadata})
+		sources = append(sources, item)
+		size += len(data) + len(metadata)
+
+		if len(batch) == importBatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return flush()
+}
+
+// importRecord сохраняет запись, ошибка возвращается, только если продолжать импорт бессмысленно
+func (m *sender) importRecord(identifier string, record models.Record, metadata models.Metadata, result *ImportResult) error {
+	return importOutcome(identifier, m.AddRecord(identifier, record, metadata), result)
+}
+
+// importOutcome учитывает результат сохранения записи в итоге импорта
+func importOutcome(identifier string, err error, result *ImportResult) error {
+	conflict := new(ConflictError)
+	switch {
+	case err == nil || errors.Is(err, ErrQueued):
+		result.Imported = append(result.Imported, identifier)
+	case errors.As(err, &conflict):
+		result.Duplicates = append(result.Duplicates, fmt.Sprintf("%s: already exists", identifier))
+	case errors.Is(err, ErrUnauthorized), errors.Is(err, ErrQuotaExceeded):
+		return err
+	default:
+		result.Skipped = append(result.Skipped, fmt.Sprintf("%s: %s", identifier, err))
+	}
+
+	return nil
+}
+
+// csvColumns названия столбцов в выгрузках разных программ
+var csvColumns = map[string][]string{
+	"title":    {"name", "title"},
+	"url":      {"url", "website", "login_uri"},
+	"username": {"username", "login_username"},
+	"password": {"password", "login_password"},
+	"notes":    {"note", "notes"},
+	"tags":     {"tags"},
+	"otp":      {"otpauth", "login_totp"},
+}
+
+// readLoginCSV разбирает CSV с учетными данными. Столбцы находятся по заголовку, поэтому порядок столбцов
+// и дополнительные столбцы, которые появляются в новых версиях программ, не мешают разбору.
+func readLoginCSV(r io.Reader, format ImportFormat) ([]importItem, []string, error) {
+	//BOM, который добавляют программы под Windows, перед заголовком в кавычках ломает разбор CSV
+	buffered := bufio.NewReader(r)
+	if bom, err := buffered.Peek(3); err == nil && string(bom) == "\ufeff" {
+		buffered.Discard(len(bom))
+	}
+
+	reader := csv.NewReader(buffered)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot read %s csv header: %w", format, err)
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		for column, aliases := range csvColumns {
+			for _, alias := range aliases {
+				if _, ok := columns[column]; !ok && name == alias {
+					columns[column] = i
+				}
+			}
+		}
+	}
+
+	for _, column := range []string{"username", "password"} {
+		if _, ok := columns[column]; !ok {
+			return nil, nil, fmt.Errorf("%s column not found in %s csv header", column, format)
+		}
+	}
+
+	var items []importItem
+	var malformed []string
+	for {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return items, malformed, nil
+		}
+
+		if parseErr := new(csv.ParseError); errors.As(err, &parseErr) {
+			malformed = append(malformed, fmt.Sprintf("line %d: %s", parseErr.Line, parseErr.Err))
+			continue
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot read %s csv: %w", format, err)
+		}
+
+		line, _ := reader.FieldPos(0)
+		source := fmt.Sprintf("line %d", line)
+
+		if len(row) != len(header) {
+			malformed = append(malformed, fmt.Sprintf("%s: expected %d fields, got %d", source, len(header), len(row)))
+			continue
+		}
+
+		value := func(column string) string {
+			if i, ok := columns[column]; ok {
+				return strings.TrimSpace(row[i])
+			}
+			return ``
+		}
+
+		credentials := &models.Credentials{Login: value("username"), Password: row[columns["password"]], URL: value("url")}
+		item := importItem{
+			source: source,
+			name:   []string{loginTitle(value("title"), credentials.URL)},
+			record: models.Record{Type: models.RecordCredentials, Credentials: credentials},
+			metadata: models.Metadata{
+				Notes: value("notes"),
+				Tags:  models.ParseTags(strings.ReplaceAll(value("tags"), ";", ",")),
+			},
+		}
+		if otp := value("otp"); otp != `` {
+			item.metadata.Fields = map[string]string{otpauthField: otp}
+		}
+
+		if err := item.record.Validate(); err != nil {
+			malformed = append(malformed, fmt.Sprintf("%s: %s", source, err))
+			continue
+		}
+
+		items = append(items, item)
+	}
+}
+
+// bitwardenExport незашифрованная выгрузка Bitwarden в JSON
+type bitwardenExport struct {
+	Encrypted bool `json:"encrypted"`
+	Folders   []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"folders"`
+	Items []bitwardenItem `json:"items"`
+}
+
+type bitwardenItem struct {
+	Type     int    `json:"type"`
+	Name     string `json:"name"`
+	Notes    string `json:"notes"`
+	FolderID string `json:"folderId"`
+	Fields   []struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	} `json:"fields"`
+	Login *struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+		Totp     string `json:"totp"`
+		Uris     []struct {
+			URI string `json:"uri"`
+		} `json:"uris"`
+	} `json:"login"`
+	Card *struct {
+		CardholderName string `json:"cardholderName"`
+		Brand          string `json:"brand"`
+		Number         string `json:"number"`
+		ExpMonth       string `json:"expMonth"`
+		ExpYear        string `json:"expYear"`
+		Code           string `json:"code"`
+	} `json:"card"`
+}
+
+// readBitwarden разбирает выгрузку Bitwarden: логины, заметки и карты. Папка становится частью идентификатора.
+func readBitwarden(r io.Reader) ([]importItem, []string, error) {
+	var export bitwardenExport
+	if err := json.NewDecoder(r).Decode(&export); err != nil {
+		return nil, nil, fmt.Errorf("cannot parse bitwarden json: %w", err)
+	}
+	if export.Encrypted {
+		return nil, nil, fmt.Errorf("bitwarden export is encrypted, export the vault as unencrypted json")
+	}
+
+	folders := make(map[string]string, len(export.Folders))
+	for _, folder := range export.Folders {
+		folders[folder.ID] = folder.Name
+	}
+
+	var items []importItem
+	var malformed []string
+	for i, bw := range export.Items {
+		source := fmt.Sprintf("item %d (%s)", i+1, bw.Name)
+
+		item := importItem{source: source, metadata: models.Metadata{Notes: bw.Notes, Fields: make(map[string]string)}}
+		//Вложенные папки Bitwarden называются через "/": Work/Servers
+		if folder := folders[bw.FolderID]; folder != `` {
+			item.name = append(item.name, strings.Split(folder, "/")...)
+		}
+
+		for _, field := range bw.Fields {
+			if field.Name != `` && field.Value != `` {
+				item.metadata.Fields[field.Name] = field.Value
+			}
+		}
+
+		switch {
+		case bw.Type == bitwardenLogin && bw.Login != nil:
+			credentials := &models.Credentials{Login: bw.Login.Username, Password: bw.Login.Password}
+			if len(bw.Login.Uris) > 0 {
+				credentials.URL = bw.Login.Uris[0].URI
+			}
+			if bw.Login.Totp != `` {
+				item.metadata.Fields[otpauthField] = bw.Login.Totp
+			}
+			item.record = models.Record{Type: models.RecordCredentials, Credentials: credentials}
+			item.name = append(item.name, loginTitle(bw.Name, credentials.URL))
+		case bw.Type == bitwardenNote:
+			item.record = models.NewTextRecord(bw.Notes)
+			item.metadata.Notes = ``
+			item.name = append(item.name, bw.Name)
+		case bw.Type == bitwardenCard && bw.Card != nil:
+			item.record = models.Record{Type: models.RecordCard, Card: &models.Card{
+				Number: models.NormalizeCardNumber(bw.Card.Number),
+				Holder: bw.Card.CardholderName,
+				Expiry: cardExpiry(bw.Card.ExpMonth, bw.Card.ExpYear),
+				CVV:    bw.Card.Code,
+			}}
+			if bw.Card.Brand != `` {
+				item.metadata.Fields["brand"] = bw.Card.Brand
+			}
+			item.name = append(item.name, bw.Name)
+		default:
+			malformed = append(malformed, fmt.Sprintf("%s: unsupported item type %d", source, bw.Type))
+			continue
+		}
+
+		if err := item.record.Validate(); err != nil {
+			malformed = append(malformed, fmt.Sprintf("%s: %s", source, err))
+			continue
+		}
+
+		items = append(items, item)
+	}
+
+	return items, malformed, nil
+}
+
+// readOTPAuth разбирает адреса секретов одноразовых кодов, по одному в строке. Выгрузка Google Authenticator
+// содержит несколько секретов в одном адресе. Идентификатор записи составляется из сервиса и учетной записи.
+func readOTPAuth(r io.Reader) ([]importItem, []string, error) {
+	scanner := bufio.NewScanner(r)
+	//Адрес выгрузки со многими секретами бывает длиннее буфера по умолчанию
+	scanner.Buffer(nil, 1<<20)
+
+	var items []importItem
+	var malformed []string
+	for line := 1; scanner.Scan(); line++ {
+		uri := strings.TrimSpace(scanner.Text())
+		if uri == `` || strings.HasPrefix(uri, "#") {
+			continue
+		}
+		source := fmt.Sprintf("line %d", line)
+
+		var otps []models.OTP
+		var err error
+		if scheme, _, _ := strings.Cut(uri, ":"); strings.EqualFold(scheme, models.OTPMigrationScheme) {
+			otps, err = models.ParseOTPMigration(uri)
+		} else {
+			var otp models.OTP
+			otp, err = models.ParseOTPURI(uri)
+			otps = append(otps, otp)
+		}
+		if err != nil {
+			malformed = append(malformed, fmt.Sprintf("%s: %s", source, err))
+			continue
+		}
+
+		for _, otp := range otps {
+			//Сервис - не папка, а часть названия: GitHub:me становится GitHub_me
+			item := importItem{
+				source: fmt.Sprintf("%s (%s)", source, otp.Label()),
+				name:   []string{otp.Label()},
+				record: models.Record{Type: models.RecordOTP, OTP: &otp},
+			}
+
+			items = append(items, item)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("cannot read otpauth file: %w", err)
+	}
+
+	return items, malformed, nil
+}
+
+// loginTitle название учетных данных, при его отсутствии - адрес сайта без схемы
+func loginTitle(title, rawURL string) string {
+	if title != `` {
+		return title
+	}
+	if u, err := url.Parse(rawURL); err == nil && u.Host != `` {
+		return u.Host
+	}
+	if rawURL != `` {
+		return rawURL
+	}
+	return "login"
+}
+
+// cardExpiry срок действия карты в формате MM/YY из месяца и года в любом формате
+func cardExpiry(month, year string) string {
+	if len(month) == 1 {
+		month = "0" + month
+	}
+	if len(year) == 4 {
+		year = year[2:]
+	}
+	return month + "/" + year
+}
+
+// importIdentifier составляет идентификатор из папок и названия через разделитель папок. Каждая часть
+// очищается отдельно: символы, недопустимые в адресе запроса, и разделитель папок внутри части заменяются на "_".
+func importIdentifier(parts ...string) string {
+	for i, part := range parts {
+		part = strings.Map(func(r rune) rune {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '.' || r == '_' {
+				return r
+			}
+			return '_'
+		}, part)
+		//Пустая или относительная часть сделала бы путь недопустимым
+		if part == `` || part == "." || part == ".." {
+			part = strings.Repeat("_", max(1, len(part)))
+		}
+		parts[i] = part
+	}
+	return strings.Join(parts, models.FolderSeparator)
+}
+
+// uniqueIdentifier добавляет к идентификатору номер, если он уже занят другой импортируемой записью
+func uniqueIdentifier(identifier string, used map[string]bool) string {
+	unique := identifier
+	for n := 2; used[unique]; n++ {
+		unique = fmt.Sprintf("%s-%d", identifier, n)
+	}
+	used[unique] = true
+	return unique
+}
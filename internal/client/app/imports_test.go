@@ -0,0 +1,239 @@
+package app
+
+import (
+	"github.com/lionslon/go-keepass/internal/models"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// writeImportFile сохраняет содержимое файла импорта во временный каталог
+func writeImportFile(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "import")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// importLogin ожидаемая учетная запись после разбора
+type importLogin struct {
+	name, url, login, password, notes string
+}
+
+// checkLogins сравнивает разобранные записи с ожидаемыми учетными данными
+func checkLogins(t *testing.T, items []importItem, want []importLogin) {
+	t.Helper()
+
+	if len(items) != len(want) {
+		t.Fatalf("items = %d, want %d", len(items), len(want))
+	}
+	for i, w := range want {
+		item := items[i]
+		c := item.record.Credentials
+		if c == nil {
+			t.Errorf("item %d is %s, want credentials", i, item.record.Type)
+			continue
+		}
+		got := importLogin{strings.Join(item.name, "/"), c.URL, c.Login, c.Password, item.metadata.Notes}
+		if got != w {
+			t.Errorf("item %d = %+v, want %+v", i, got, w)
+		}
+	}
+}
+
+func TestReadLoginCSV(t *testing.T) {
+	tests := []struct {
+		name      string
+		format    ImportFormat
+		content   string
+		want      []importLogin
+		malformed int
+	}{
+		{
+			name:   "chrome",
+			format: ImportChrome,
+			content: "name,url,username,password,note\n" +
+				"mail,https://mail.example.com/,alice,secret,\n" +
+				",https://bank.example.com/login,bob,pa55,\"line one\nline two\"\n",
+			want: []importLogin{
+				{"mail", "https://mail.example.com/", "alice", "secret", ``},
+				//Без названия используется хост, заметка в кавычках может занимать несколько строк
+				{"bank.example.com", "https://bank.example.com/login", "bob", "pa55", "line one\nline two"},
+			},
+		},
+		{
+			name:   "firefox",
+			format: ImportFirefox,
+			content: "\ufeff\"url\",\"username\",\"password\",\"httpRealm\",\"formActionOrigin\",\"guid\",\"timeCreated\",\"timeLastUsed\",\"timePasswordChanged\"\n" +
+				"\"https://shop.example.com\",\"carol\",\"pass, with \"\"quotes\"\"\",,\"\",\"{1}\",\"1\",\"1\",\"1\"\n",
+			want: []importLogin{{"shop.example.com", "https://shop.example.com", "carol", `pass, with "quotes"`, ``}},
+		},
+		{
+			name:   "1password",
+			format: Import1Password,
+			content: "Title,Website,Username,Password,OTPAuth,Favorite,Archived,Tags,Notes\n" +
+				"VPN,vpn.example.com,dave, keep spaces ,,false,false,work;infra,note\n" +
+				"Empty,,,,,false,false,,\n" +
+				"Short,example.com,erin\n" +
+				"Bare,exa\"mple.com,frank,pw,,false,false,,\n",
+			//Пароль не обрезается, строка без пароля и строки с неверным числом полей или кавычкой не разбираются
+			want:      []importLogin{{"VPN", "vpn.example.com", "dave", " keep spaces ", "note"}},
+			malformed: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, malformed, err := readLoginCSV(strings.NewReader(tt.content), tt.format)
+			if err != nil {
+				t.Fatalf("readLoginCSV() error = %v", err)
+			}
+			if len(malformed) != tt.malformed {
+				t.Errorf("malformed = %q, want %d", malformed, tt.malformed)
+			}
+			checkLogins(t, items, tt.want)
+		})
+	}
+}
+
+func TestReadLoginCSVHeader(t *testing.T) {
+	//Столбцы находятся по названию без учета регистра и порядка
+	items, _, err := readLoginCSV(strings.NewReader("Password,Extra,USERNAME,Title\nsecret,x,alice,mail\n"), ImportChrome)
+	if err != nil {
+		t.Fatalf("readLoginCSV() error = %v", err)
+	}
+	checkLogins(t, items, []importLogin{{"mail", ``, "alice", "secret", ``}})
+
+	for _, content := range []string{``, "name,url,username\nmail,,alice\n", "name,url,password\nmail,,secret\n"} {
+		if _, _, err := readLoginCSV(strings.NewReader(content), ImportChrome); err == nil {
+			t.Errorf("readLoginCSV(%q) error = nil, want header error", content)
+		}
+	}
+}
+
+func TestReadBitwarden(t *testing.T) {
+	content := `{
+		"encrypted": false,
+		"folders": [{"id": "f1", "name": "Work/Servers"}],
+		"items": [
+			{"type": 1, "name": "ssh", "folderId": "f1", "notes": "root",
+				"fields": [{"name": "port", "value": "22"}, {"name": "", "value": "skip"}],
+				"login": {"username": "admin", "password": "s3cr3t", "totp": "JBSWY3DPEHPK3PXP",
+					"uris": [{"uri": "https://ssh.example.com"}]}},
+			{"type": 2, "name": "memo", "notes": "secure note"},
+			{"type": 3, "name": "visa", "card": {"cardholderName": "ALICE", "brand": "Visa",
+				"number": "4111 1111 1111 1111", "expMonth": "3", "expYear": "2030", "code": "123"}},
+			{"type": 4, "name": "identity"},
+			{"type": 1, "name": "no password", "login": {"username": "x"}}
+		]
+	}`
+
+	items, malformed, err := readBitwarden(strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("readBitwarden() error = %v", err)
+	}
+	if len(malformed) != 2 {
+		t.Errorf("malformed = %q, want identity and login without password", malformed)
+	}
+	if len(items) != 3 {
+		t.Fatalf("items = %d, want 3", len(items))
+	}
+
+	login := items[0]
+	if !slices.Equal(login.name, []string{"Work", "Servers", "ssh"}) {
+		t.Errorf("login name = %v, want folder path", login.name)
+	}
+	if c := login.record.Credentials; c == nil || c.Login != "admin" || c.Password != "s3cr3t" || c.URL != "https://ssh.example.com" {
+		t.Errorf("login = %+v", login.record.Credentials)
+	}
+	if f := login.metadata.Fields; f["port"] != "22" || f[otpauthField] != "JBSWY3DPEHPK3PXP" || len(f) != 2 {
+		t.Errorf("login fields = %v", f)
+	}
+	if login.metadata.Notes != "root" {
+		t.Errorf("login notes = %q, want root", login.metadata.Notes)
+	}
+
+	if note := items[1]; note.record.Type != models.RecordText || note.record.Text.Text != "secure note" || note.metadata.Notes != `` {
+		t.Errorf("note = %+v", note)
+	}
+
+	card := items[2].record.Card
+	if card == nil || card.Number != "4111111111111111" || card.Expiry != "03/30" || card.Holder != "ALICE" || card.CVV != "123" {
+		t.Errorf("card = %+v", card)
+	}
+
+	for _, content := range []string{`{"encrypted": true, "items": []}`, `not json`} {
+		if _, _, err := readBitwarden(strings.NewReader(content)); err == nil {
+			t.Errorf("readBitwarden(%q) error = nil, want error", content)
+		}
+	}
+}
+
+func TestImportFile(t *testing.T) {
+	endpoint := newTestServer(t)
+	m := newTestUser(t, endpoint, "alice", "password")
+
+	if err := m.AddRecord("existing", models.NewTextRecord("keep"), models.Metadata{}); err != nil {
+		t.Fatalf("AddRecord() error = %v", err)
+	}
+
+	path := writeImportFile(t, "name,url,username,password\n"+
+		"mail,https://mail.example.com,alice,one\n"+
+		"mail,https://mail.example.com,alice,one\n"+
+		"mail,https://mail.example.com,bob,two\n"+
+		"existing,https://example.com,carol,three\n"+
+		"broken,https://example.com,dave\n")
+
+	//Пробный импорт ничего не сохраняет
+	result, err := m.ImportFile(ImportChrome, path, true)
+	if err != nil {
+		t.Fatalf("ImportFile() dry run error = %v", err)
+	}
+	if !slices.Equal(result.Imported, []string{"mail", "mail-2"}) {
+		t.Errorf("ImportFile() dry run imported = %v, want mail, mail-2", result.Imported)
+	}
+	if list, _ := m.ListData("identifier", false, 0, 10); list.Total != 1 {
+		t.Errorf("ListData() after dry run total = %d, want 1", list.Total)
+	}
+
+	result, err = m.ImportFile(ImportChrome, path, false)
+	if err != nil {
+		t.Fatalf("ImportFile() error = %v", err)
+	}
+	if !slices.Equal(result.Imported, []string{"mail", "mail-2"}) {
+		t.Errorf("ImportFile() imported = %v, want mail, mail-2", result.Imported)
+	}
+	//Повтор в файле и уже существующие данные, строка с неверным числом полей
+	if len(result.Duplicates) != 2 || !strings.HasPrefix(result.Duplicates[0], "line 3:") ||
+		!strings.Contains(result.Duplicates[1], "existing already exists") {
+		t.Errorf("ImportFile() duplicates = %q", result.Duplicates)
+	}
+	if len(result.Malformed) != 1 || !strings.HasPrefix(result.Malformed[0], "line 6:") {
+		t.Errorf("ImportFile() malformed = %q", result.Malformed)
+	}
+	if len(result.Skipped) != 0 {
+		t.Errorf("ImportFile() skipped = %q, want none", result.Skipped)
+	}
+
+	record, _, err := m.GetRecord("mail-2")
+	if err != nil {
+		t.Fatalf("GetRecord() error = %v", err)
+	}
+	if c := record.Credentials; c == nil || c.Login != "bob" || c.Password != "two" {
+		t.Errorf("GetRecord() = %+v, want bob", record.Credentials)
+	}
+
+	//Повторный импорт того же файла не перезаписывает данные
+	result, err = m.ImportFile(ImportChrome, path, false)
+	if err != nil {
+		t.Fatalf("ImportFile() again error = %v", err)
+	}
+	if len(result.Imported) != 0 || len(result.Duplicates) != 4 {
+		t.Errorf("ImportFile() again = %+v, want only duplicates", result)
+	}
+}
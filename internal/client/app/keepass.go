@@ -0,0 +1,375 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"github.com/lionslon/go-keepass/internal/kdbx"
+	"github.com/lionslon/go-keepass/internal/models"
+	"maps"
+	"os"
+	"path"
+	"slices"
+	"strings"
+)
+
+// Поля метаданных, в которых импорт сохраняет структуру базы KeePass для обратного экспорта
+const (
+	keepassGroupField = "keepass.group" //Исходный путь группы через "/", корневая группа не входит в путь
+	keepassTitleField = "keepass.title" //Название записи, если оно не совпадает с идентификатором
+	keepassEntryField = "keepass.entry" //Идентификатор записи, к которой относится вложение
+)
+
+// Поля записи KeePass для данных, у которых в KeePass нет стандартных полей
+const (
+	keepassCardNumber = "Card number"
+	keepassCardHolder = "Card holder"
+	keepassCardExpiry = "Expiry"
+	keepassCardCVV    = "CVV"
+	keepassSite       = "Site"
+	keepassBank       = "Bank"
+	keepassOwner      = "Owner"
+	keepassComment    = "Comment" //Заметки метаданных текстовой записи, текст которой хранится в Notes
+	keepassOTP        = "otp"     //Адрес otpauth:// в формате KeePassXC
+)
+
+// ExportResult итог экспорта
+type ExportResult struct {
+	Exported []string // идентификаторы выгруженных данных
+	Skipped  []string // пропущенные данные с причиной
+}
+
+// ImportKeePass сохраняет записи базы KeePass (KDBX 4) как новые данные пользователя.
+// Группы становятся папками, идентификатор записи - путь из групп и названия, записи с паролем становятся
+// учетными данными, остальные - текстовыми заметками, дополнительные поля и теги переносятся в метаданные,
+// каждое вложение сохраняется отдельной бинарной записью. Записи из корзины KeePass не импортируются,
+// а данные с уже существующими идентификаторами не перезаписываются.
+func (m *sender) ImportKeePass(path, password, keyFile string) (ImportResult, error) {
+	var result ImportResult
+
+	if m.password == `` {
+		return result, fmt.Errorf("bad auth data, try login")
+	}
+
+	key, err := readKeePassKey(password, keyFile)
+	if err != nil {
+		return result, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return result, fmt.Errorf("cannot open keepass database: %w", err)
+	}
+	defer file.Close()
+
+	db, err := kdbx.Read(bufio.NewReader(file), key)
+	if err != nil {
+		return result, fmt.Errorf("cannot read keepass database: %w", err)
+	}
+
+	used := make(map[string]bool)
+
+	var walk func(group *kdbx.Group, groups []string) error
+	walk = func(group *kdbx.Group, groups []string) error {
+		if !db.RecycleBin.IsZero() && group.UUID == db.RecycleBin {
+			return nil
+		}
+
+		for i := range group.Entries {
+			if err := m.importEntry(&group.Entries[i], groups, used, &result); err != nil {
+				return err
+			}
+		}
+
+		for i := range group.Groups {
+			if err := walk(&group.Groups[i], append(slices.Clone(groups), group.Groups[i].Name)); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	return result, walk(&db.Root, nil)
+}
+
+// importEntry сохраняет запись KeePass и ее вложения
+func (m *sender) importEntry(entry *kdbx.Entry, groups []string, used map[string]bool, result *ImportResult) error {
+	title := entry.Get(kdbx.FieldTitle)
+	if title == `` {
+		title = "entry"
+	}
+
+	identifier := uniqueIdentifier(importIdentifier(append(slices.Clone(groups), title)...), used)
+
+	record, metadata := keepassRecord(entry)
+	if len(groups) > 0 {
+		metadata.Fields[keepassGroupField] = strings.Join(groups, "/")
+	}
+	if title != path.Base(identifier) {
+		metadata.Fields[keepassTitleField] = title
+	}
+
+	if err := m.importRecord(identifier, record, metadata, result); err != nil {
+		return err
+	}
+
+	for _, attachment := range entry.Attachments {
+		record := models.Record{Type: models.RecordBinary, Binary: &models.BinaryFile{Name: attachment.Name, Data: attachment.Data}}
+		metadata := models.Metadata{Fields: map[string]string{keepassEntryField: identifier}}
+
+		//Вложение сохраняется рядом с записью, в той же папке
+		name := path.Base(identifier) + "_" + importIdentifier(attachment.Name)
+		if err := m.importRecord(uniqueIdentifier(path.Join(path.Dir(identifier), name), used), record, metadata, result); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// keepassRecord преобразует поля записи KeePass в запись и метаданные
+func keepassRecord(entry *kdbx.Entry) (models.Record, models.Metadata) {
+	metadata := models.Metadata{Tags: entry.Tags, Fields: make(map[string]string)}
+
+	//Поля, перенесенные в запись, не повторяются в метаданных
+	consumed := map[string]bool{kdbx.FieldTitle: true, kdbx.FieldNotes: true}
+
+	var record models.Record
+
+	card := &models.Card{
+		Number: models.NormalizeCardNumber(entry.Get(keepassCardNumber)),
+		Holder: entry.Get(keepassCardHolder),
+		Expiry: entry.Get(keepassCardExpiry),
+		CVV:    entry.Get(keepassCardCVV),
+	}
+
+	//Запись только с секретом одноразовых кодов, у учетных данных секрет остается полем метаданных
+	otp, otpErr := models.ParseOTPURI(entry.Get(keepassOTP))
+
+	switch {
+	case entry.Get(kdbx.FieldPassword) != ``:
+		record = models.Record{Type: models.RecordCredentials, Credentials: &models.Credentials{
+			Login:    entry.Get(kdbx.FieldUserName),
+			Password: entry.Get(kdbx.FieldPassword),
+			URL:      entry.Get(kdbx.FieldURL),
+		}}
+		metadata.Notes = entry.Get(kdbx.FieldNotes)
+		consumed[kdbx.FieldUserName], consumed[kdbx.FieldPassword], consumed[kdbx.FieldURL] = true, true, true
+	case card.Validate() == nil:
+		record = models.Record{Type: models.RecordCard, Card: card}
+		metadata.Notes = entry.Get(kdbx.FieldNotes)
+		consumed[keepassCardNumber], consumed[keepassCardHolder], consumed[keepassCardExpiry], consumed[keepassCardCVV] = true, true, true, true
+	case otpErr == nil:
+		record = models.Record{Type: models.RecordOTP, OTP: &otp}
+		metadata.Notes = entry.Get(kdbx.FieldNotes)
+		consumed[keepassOTP] = true
+	default:
+		record = models.NewTextRecord(entry.Get(kdbx.FieldNotes))
+		metadata.Notes = entry.Get(keepassComment)
+		consumed[keepassComment] = true
+	}
+
+	for _, field := range entry.Fields {
+		switch {
+		case consumed[field.Key] || field.Value == ``:
+		case field.Key == keepassSite:
+			metadata.Site = field.Value
+		case field.Key == keepassBank:
+			metadata.Bank = field.Value
+		case field.Key == keepassOwner:
+			metadata.Owner = field.Value
+		default:
+			metadata.Fields[field.Key] = field.Value
+		}
+	}
+
+	return record, metadata
+}
+
+// ExportKeePass выгружает все данные пользователя в новую базу KeePass (KDBX 4).
+// Папки становятся группами, вложения, импортированные из KeePass, возвращаются в свои записи.
+func (m *sender) ExportKeePass(path, password, keyFile string) (ExportResult, error) {
+	var result ExportResult
+
+	if m.password == `` {
+		return result, fmt.Errorf("bad auth data, try login")
+	}
+
+	key, err := readKeePassKey(password, keyFile)
+	if err != nil {
+		return result, err
+	}
+
+	infos, err := m.listAll()
+	if err != nil {
+		return result, err
+	}
+
+	type exported struct {
+		info     EntryInfo
+		record   models.Record
+		metadata models.Metadata
+	}
+
+	records := make(map[string]exported, len(infos))
+	for _, info := range infos {
+		record, metadata, err := m.GetRecord(info.Identifier)
+		if err != nil {
+			result.Skipped = append(result.Skipped, fmt.Sprintf("%s: %s", info.Identifier, err))
+			continue
+		}
+		records[info.Identifier] = exported{info: info, record: record, metadata: metadata}
+	}
+
+	//Вложения переносятся в записи, к которым относятся, если эти записи тоже выгружаются
+	attachments := make(map[string][]exported)
+	for _, info := range infos {
+		e, ok := records[info.Identifier]
+		if !ok || e.record.Type != models.RecordBinary {
+			continue
+		}
+		owner, ok := records[e.metadata.Fields[keepassEntryField]]
+		if ok && owner.metadata.Fields[keepassEntryField] == `` {
+			attachments[owner.info.Identifier] = append(attachments[owner.info.Identifier], e)
+			delete(records, info.Identifier)
+			result.Exported = append(result.Exported, info.Identifier)
+		}
+	}
+
+	db := &kdbx.Database{Name: m.state.user(), Root: kdbx.Group{Name: m.state.user()}}
+	for _, info := range infos {
+		e, ok := records[info.Identifier]
+		if !ok {
+			continue
+		}
+
+		entry := keepassEntry(e.info, e.record, e.metadata)
+		for _, attachment := range attachments[info.Identifier] {
+			entry.Attachments = append(entry.Attachments, kdbx.Attachment{Name: attachment.record.Binary.Name, Data: attachment.record.Binary.Data})
+		}
+
+		group := keepassGroup(&db.Root, keepassGroupPath(info.Identifier, e.metadata))
+		group.Entries = append(group.Entries, entry)
+		result.Exported = append(result.Exported, info.Identifier)
+	}
+
+	var buf bytes.Buffer
+	if err := kdbx.Write(&buf, db, key); err != nil {
+		return result, fmt.Errorf("cannot write keepass database: %w", err)
+	}
+
+	return result, writeFile(path, &buf)
+}
+
+// keepassEntry преобразует запись и метаданные в запись KeePass
+func keepassEntry(info EntryInfo, record models.Record, metadata models.Metadata) kdbx.Entry {
+	entry := kdbx.Entry{Tags: metadata.Tags, CreatedAt: info.CreatedAt, UpdatedAt: info.UpdatedAt}
+
+	title := metadata.Fields[keepassTitleField]
+	if title == `` {
+		title = path.Base(info.Identifier)
+	}
+
+	//Стандартные поля есть в каждой записи KeePass
+	entry.Set(kdbx.FieldTitle, title, false)
+	entry.Set(kdbx.FieldUserName, ``, false)
+	entry.Set(kdbx.FieldPassword, ``, true)
+	entry.Set(kdbx.FieldURL, ``, false)
+	entry.Set(kdbx.FieldNotes, metadata.Notes, false)
+
+	switch record.Type {
+	case models.RecordCredentials:
+		entry.Set(kdbx.FieldUserName, record.Credentials.Login, false)
+		entry.Set(kdbx.FieldPassword, record.Credentials.Password, true)
+		entry.Set(kdbx.FieldURL, record.Credentials.URL, false)
+	case models.RecordCard:
+		entry.Set(keepassCardNumber, record.Card.Number, true)
+		entry.Set(keepassCardHolder, record.Card.Holder, false)
+		entry.Set(keepassCardExpiry, record.Card.Expiry, false)
+		entry.Set(keepassCardCVV, record.Card.CVV, true)
+	case models.RecordText:
+		entry.Set(kdbx.FieldNotes, record.Text.Text, false)
+		if metadata.Notes != `` {
+			entry.Set(keepassComment, metadata.Notes, false)
+		}
+	case models.RecordOTP:
+		entry.Set(keepassOTP, record.OTP.URI(), true)
+	case models.RecordBinary:
+		name := record.Binary.Name
+		if name == `` {
+			name = info.Identifier
+		}
+		entry.Attachments = append(entry.Attachments, kdbx.Attachment{Name: name, Data: record.Binary.Data})
+	}
+
+	for _, field := range []struct{ key, value string }{
+		{keepassSite, metadata.Site},
+		{keepassBank, metadata.Bank},
+		{keepassOwner, metadata.Owner},
+	} {
+		if field.value != `` {
+			entry.Set(field.key, field.value, false)
+		}
+	}
+
+	//Стандартные поля в метаданных остаются от записей KeePass, импортированных как заметки
+	for _, key := range slices.Sorted(maps.Keys(metadata.Fields)) {
+		switch {
+		case strings.HasPrefix(key, "keepass."):
+		case !kdbx.IsStandard(key):
+			entry.Set(key, metadata.Fields[key], false)
+		case entry.Get(key) == ``:
+			entry.Set(key, metadata.Fields[key], key == kdbx.FieldPassword)
+		}
+	}
+
+	return entry
+}
+
+// keepassGroupPath путь группы данных - папка из идентификатора. Исходные названия групп KeePass,
+// измененные при импорте, восстанавливаются, если данные не перемещались в другую папку.
+func keepassGroupPath(identifier string, metadata models.Metadata) string {
+	folder := models.ParentFolder(identifier)
+	if original := metadata.Fields[keepassGroupField]; original != `` &&
+		importIdentifier(strings.Split(original, "/")...) == folder {
+		return original
+	}
+	return folder
+}
+
+// keepassGroup находит или создает группу по пути через "/"
+func keepassGroup(root *kdbx.Group, path string) *kdbx.Group {
+	group := root
+	for _, name := range strings.Split(path, "/") {
+		if name == `` {
+			continue
+		}
+
+		i := slices.IndexFunc(group.Groups, func(g kdbx.Group) bool { return g.Name == name })
+		if i < 0 {
+			group.Groups = append(group.Groups, kdbx.Group{Name: name})
+			i = len(group.Groups) - 1
+		}
+		group = &group.Groups[i]
+	}
+	return group
+}
+
+// readKeePassKey составной ключ базы из пароля и необязательного файла ключа
+func readKeePassKey(password, keyFile string) (*kdbx.Key, error) {
+	var keyData []byte
+	if keyFile != `` {
+		data, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read key file: %w", err)
+		}
+		keyData = data
+	}
+
+	if password == `` && keyData == nil {
+		return nil, fmt.Errorf("database password or key file required")
+	}
+
+	return kdbx.NewKey(password, keyData)
+}
@@ -0,0 +1,982 @@
+package app
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/go-resty/resty/v2"
+	"github.com/lionslon/go-keepass/internal/crypt"
+	"github.com/lionslon/go-keepass/internal/models"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	orgsUrl        = "api/orgs"
+	collectionsUrl = "api/collections"
+
+	membersPath     = "members"
+	collectionsPath = "collections"
+	dataPath        = "data"
+
+	reencryptPageSize = 100 // размер страницы списка данных коллекции при перешифровании
+)
+
+// CollectionEntry запись общей коллекции организации
+type CollectionEntry struct {
+	Identifier string
+	Origin     string // исходный идентификатор перемещенной записи, от него получен ключ данных
+	Record     models.Record
+	Metadata   models.Metadata
+	Revision   int64 // ревизия данных, для UpdateCollectionRecord
+}
+
+// KeyId идентификатор, от которого получен ключ данных записи
+func (m *CollectionEntry) KeyId() string {
+	if m.Origin != `` {
+		return m.Origin
+	}
+	return m.Identifier
+}
+
+// collectionVault ключи коллекции, расшифрованные закрытым ключом пользователя
+type collectionVault struct {
+	models.Collection
+	keys map[int64]string // ключи коллекции по версиям
+}
+
+// entryKey ключ данных записи коллекции: новые ревизии шифруются текущей версией ключа коллекции
+func (m *collectionVault) entryKey(identifier string) string {
+	return crypt.EntryKey(m.keys[m.KeyVersion], identifier)
+}
+
+// entryKeys ключи, которыми могут быть зашифрованы данные записи, начиная с новой версии ключа коллекции.
+// После удаления участника прежние ревизии и данные в корзине остаются зашифрованы прежней версией.
+func (m *collectionVault) entryKeys(identifier string) []string {
+	versions := make([]int64, 0, len(m.keys))
+	for version := range m.keys {
+		versions = append(versions, version)
+	}
+	slices.Sort(versions)
+	slices.Reverse(versions)
+
+	keys := make([]string, 0, len(versions))
+	for _, version := range versions {
+		keys = append(keys, crypt.EntryKey(m.keys[version], identifier))
+	}
+	return keys
+}
+
+// CreateOrganization создает организацию, пользователь становится ее владельцем
+func (m *sender) CreateOrganization(name string) (models.Organization, error) {
+	var org models.Organization
+
+	if m.state.auth() == `` || m.password == `` {
+		return org, fmt.Errorf("bad auth data, try login")
+	}
+
+	req := m.client.R().
+		SetHeader("Authorization", m.state.auth()).
+		SetHeader("Content-Type", "application/json").
+		SetBody(models.OrganizationRequest{Name: name}).
+		SetResult(&org)
+
+	url := strings.Join([]string{m.cfg.ServerEndpoint, orgsUrl}, "/")
+
+	resp, err := req.Post(url)
+	if err != nil {
+		return org, fmt.Errorf("cannot send create organization request: %w", err)
+	}
+
+	if code := resp.StatusCode(); code != http.StatusCreated {
+		return org, statusError(code)
+	}
+
+	return org, nil
+}
+
+// ListOrganizations возвращает организации пользователя, в том числе с непринятыми приглашениями
+func (m *sender) ListOrganizations() ([]models.Organization, error) {
+	var orgs []models.Organization
+
+	if m.state.auth() == `` || m.password == `` {
+		return orgs, fmt.Errorf("bad auth data, try login")
+	}
+
+	req := m.client.R().
+		SetHeader("Authorization", m.state.auth()).
+		SetResult(&orgs)
+
+	url := strings.Join([]string{m.cfg.ServerEndpoint, orgsUrl}, "/")
+
+	resp, err := req.Get(url)
+	if err != nil {
+		return orgs, fmt.Errorf("cannot send list organizations request: %w", err)
+	}
+
+	if code := resp.StatusCode(); code != http.StatusOK {
+		return orgs, statusError(code)
+	}
+
+	return orgs, nil
+}
+
+// AcceptInvitation принимает приглашение в организацию
+func (m *sender) AcceptInvitation(orgId string) error {
+	if m.state.auth() == `` || m.password == `` {
+		return fmt.Errorf("bad auth data, try login")
+	}
+
+	req := m.client.R().
+		SetHeader("Authorization", m.state.auth())
+
+	url := strings.Join([]string{m.cfg.ServerEndpoint, orgsUrl, orgId, acceptPath}, "/")
+
+	resp, err := req.Post(url)
+	if err != nil {
+		return fmt.Errorf("cannot send accept invitation request: %w", err)
+	}
+
+	return orgStatus(orgId, resp.StatusCode(), http.StatusAccepted)
+}
+
+// ListMembers возвращает участников организации
+func (m *sender) ListMembers(orgId string) ([]models.Member, error) {
+	var members []models.Member
+
+	if m.state.auth() == `` || m.password == `` {
+		return members, fmt.Errorf("bad auth data, try login")
+	}
+
+	req := m.client.R().
+		SetHeader("Authorization", m.state.auth()).
+		SetResult(&members)
+
+	url := strings.Join([]string{m.cfg.ServerEndpoint, orgsUrl, orgId, membersPath}, "/")
+
+	resp, err := req.Get(url)
+	if err != nil {
+		return members, fmt.Errorf("cannot send list members request: %w", err)
+	}
+
+	return members, orgStatus(orgId, resp.StatusCode(), http.StatusOK)
+}
+
+// InviteMember приглашает пользователя в организацию. Все версии ключей всех коллекций
+// шифруются его открытым ключом, чтобы после принятия приглашения он читал и прежние данные.
+func (m *sender) InviteMember(orgId, login string, role models.OrgRole) (models.Member, error) {
+	var member models.Member
+
+	collections, err := m.ListCollections(orgId)
+	if err != nil {
+		return member, err
+	}
+
+	publicKey, err := m.publicKey(login)
+	if err != nil {
+		return member, err
+	}
+
+	privateKey, err := m.privateKey()
+	if err != nil {
+		return member, err
+	}
+
+	keys := make([]models.CollectionKey, 0)
+	for _, collection := range collections {
+		for _, key := range collection.Keys {
+			collectionKey, err := crypt.UnwrapKey(privateKey, key.Key)
+			if err != nil {
+				return member, fmt.Errorf("cannot unwrap key of collection %s: %w", collection.Name, err)
+			}
+
+			wrapped, err := crypt.WrapKey(publicKey, collectionKey)
+			if err != nil {
+				return member, fmt.Errorf("cannot wrap key of collection %s: %w", collection.Name, err)
+			}
+
+			keys = append(keys, models.CollectionKey{Collection: collection.Id, Version: key.Version, Key: wrapped})
+		}
+	}
+
+	req := m.client.R().
+		SetHeader("Authorization", m.state.auth()).
+		SetHeader("Content-Type", "application/json").
+		SetBody(models.InviteRequest{Login: login, Role: role, Keys: keys}).
+		SetResult(&member)
+
+	url := strings.Join([]string{m.cfg.ServerEndpoint, orgsUrl, orgId, membersPath}, "/")
+
+	resp, err := req.Post(url)
+	if err != nil {
+		return member, fmt.Errorf("cannot send invite request: %w", err)
+	}
+
+	if resp.StatusCode() == http.StatusConflict {
+		return member, fmt.Errorf("%s is already a member or collections changed, try again", login)
+	}
+
+	return member, orgStatus(orgId, resp.StatusCode(), http.StatusCreated)
+}
+
+// SetMemberRole меняет роль участника организации
+func (m *sender) SetMemberRole(orgId, login string, role models.OrgRole) error {
+	if m.state.auth() == `` || m.password == `` {
+		return fmt.Errorf("bad auth data, try login")
+	}
+
+	req := m.client.R().
+		SetHeader("Authorization", m.state.auth()).
+		SetHeader("Content-Type", "application/json").
+		SetBody(models.RoleRequest{Role: role})
+
+	url := strings.Join([]string{m.cfg.ServerEndpoint, orgsUrl, orgId, membersPath, login}, "/")
+
+	resp, err := req.Put(url)
+	if err != nil {
+		return fmt.Errorf("cannot send set role request: %w", err)
+	}
+
+	return orgStatus(orgId, resp.StatusCode(), http.StatusAccepted)
+}
+
+// RemoveMember удаляет участника из организации или отказывается от приглашения, если login - свой логин.
+// Участнику, принявшему приглашение, известны ключи коллекций, поэтому для каждой коллекции создается
+// новая версия ключа, зашифрованная для оставшихся участников, и текущие данные коллекций с файлами
+// и вложениями перешифровываются ею (ReencryptCollection). Прежние ревизии удаленный участник мог прочитать и до удаления.
+func (m *sender) RemoveMember(orgId, login string) error {
+	if m.state.auth() == `` || m.password == `` {
+		return fmt.Errorf("bad auth data, try login")
+	}
+
+	req := m.client.R().
+		SetHeader("Authorization", m.state.auth())
+
+	var rotated []string
+	if login != m.state.user() {
+		keys, err := m.rotationKeys(orgId, login)
+		if err != nil {
+			return err
+		}
+		if len(keys) > 0 {
+			req.SetHeader("Content-Type", "application/json").
+				SetBody(models.RemoveRequest{Keys: keys})
+		}
+		for _, key := range keys {
+			if !slices.Contains(rotated, key.Collection) {
+				rotated = append(rotated, key.Collection)
+			}
+		}
+	}
+
+	url := strings.Join([]string{m.cfg.ServerEndpoint, orgsUrl, orgId, membersPath, login}, "/")
+
+	resp, err := req.Delete(url)
+	if err != nil {
+		return fmt.Errorf("cannot send remove member request: %w", err)
+	}
+
+	if resp.StatusCode() == http.StatusConflict {
+		return fmt.Errorf("members or collections of organization %s changed, try again", orgId)
+	}
+
+	if err := orgStatus(orgId, resp.StatusCode(), http.StatusAccepted); err != nil {
+		return err
+	}
+
+	for _, collectionId := range rotated {
+		if _, err := m.ReencryptCollection(collectionId); err != nil {
+			return fmt.Errorf("member removed, but collection %s is not re-encrypted, try collection_reencrypt: %w", collectionId, err)
+		}
+	}
+
+	return nil
+}
+
+// rotationKeys новые версии ключей коллекций для участников, остающихся после удаления login.
+// Если участник не принимал приглашение, ключи не меняются.
+func (m *sender) rotationKeys(orgId, login string) ([]models.CollectionKey, error) {
+	members, err := m.ListMembers(orgId)
+	if err != nil {
+		return nil, err
+	}
+
+	index := slices.IndexFunc(members, func(member models.Member) bool {
+		return member.Login == login
+	})
+	if index < 0 {
+		return nil, fmt.Errorf("member %s not found", login)
+	}
+	if !members[index].Accepted {
+		return nil, nil
+	}
+
+	collections, err := m.ListCollections(orgId)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]models.CollectionKey, 0)
+	for _, collection := range collections {
+		collectionKey, err := crypt.GenerateKey()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, member := range members {
+			if member.Login == login {
+				continue
+			}
+
+			wrapped, err := m.wrapFor(member.Login, collectionKey)
+			if err != nil {
+				return nil, err
+			}
+
+			keys = append(keys, models.CollectionKey{
+				Collection: collection.Id,
+				Login:      member.Login,
+				Version:    collection.KeyVersion + 1,
+				Key:        wrapped,
+			})
+		}
+	}
+
+	return keys, nil
+}
+
+// wrapFor шифрует ключ коллекции открытым ключом участника
+func (m *sender) wrapFor(login, collectionKey string) ([]byte, error) {
+	publicKey, err := m.publicKey(login)
+	if err != nil {
+		return nil, err
+	}
+
+	wrapped, err := crypt.WrapKey(publicKey, collectionKey)
+	if err != nil {
+		return nil, fmt.Errorf("cannot wrap collection key for %s: %w", login, err)
+	}
+
+	return wrapped, nil
+}
+
+// CreateCollection создает коллекцию организации. Ключ коллекции шифруется открытым ключом
+// каждого участника, в том числе еще не принявшего приглашение.
+func (m *sender) CreateCollection(orgId, name string) (models.Collection, error) {
+	var collection models.Collection
+
+	members, err := m.ListMembers(orgId)
+	if err != nil {
+		return collection, err
+	}
+
+	collectionKey, err := crypt.GenerateKey()
+	if err != nil {
+		return collection, err
+	}
+
+	keys := make([]models.CollectionKey, 0, len(members))
+	for _, member := range members {
+		wrapped, err := m.wrapFor(member.Login, collectionKey)
+		if err != nil {
+			return collection, err
+		}
+		keys = append(keys, models.CollectionKey{Login: member.Login, Key: wrapped})
+	}
+
+	req := m.client.R().
+		SetHeader("Authorization", m.state.auth()).
+		SetHeader("Content-Type", "application/json").
+		SetBody(models.CollectionRequest{Name: name, Keys: keys}).
+		SetResult(&collection)
+
+	url := strings.Join([]string{m.cfg.ServerEndpoint, orgsUrl, orgId, collectionsPath}, "/")
+
+	resp, err := req.Post(url)
+	if err != nil {
+		return collection, fmt.Errorf("cannot send create collection request: %w", err)
+	}
+
+	if resp.StatusCode() == http.StatusConflict {
+		return collection, fmt.Errorf("members of organization %s changed, try again", orgId)
+	}
+
+	return collection, orgStatus(orgId, resp.StatusCode(), http.StatusCreated)
+}
+
+// ListCollections возвращает коллекции организации с ключами, зашифрованными для пользователя
+func (m *sender) ListCollections(orgId string) ([]models.Collection, error) {
+	var collections []models.Collection
+
+	if m.state.auth() == `` || m.password == `` {
+		return collections, fmt.Errorf("bad auth data, try login")
+	}
+
+	req := m.client.R().
+		SetHeader("Authorization", m.state.auth()).
+		SetResult(&collections)
+
+	url := strings.Join([]string{m.cfg.ServerEndpoint, orgsUrl, orgId, collectionsPath}, "/")
+
+	resp, err := req.Get(url)
+	if err != nil {
+		return collections, fmt.Errorf("cannot send list collections request: %w", err)
+	}
+
+	return collections, orgStatus(orgId, resp.StatusCode(), http.StatusOK)
+}
+
+// collectionVault получает коллекцию и расшифровывает все версии ее ключа
+func (m *sender) collectionVault(collectionId string) (*collectionVault, error) {
+	var collection models.Collection
+
+	if m.state.auth() == `` || m.password == `` {
+		return nil, fmt.Errorf("bad auth data, try login")
+	}
+
+	req := m.client.R().
+		SetHeader("Authorization", m.state.auth()).
+		SetResult(&collection)
+
+	url := strings.Join([]string{m.cfg.ServerEndpoint, collectionsUrl, collectionId}, "/")
+
+	resp, err := req.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("cannot send get collection request: %w", err)
+	}
+
+	if err := collectionStatus(collectionId, resp.StatusCode(), http.StatusOK); err != nil {
+		return nil, err
+	}
+
+	privateKey, err := m.privateKey()
+	if err != nil {
+		return nil, err
+	}
+
+	vault := &collectionVault{Collection: collection, keys: make(map[int64]string)}
+	for _, key := range collection.Keys {
+		if vault.keys[key.Version], err = crypt.UnwrapKey(privateKey, key.Key); err != nil {
+			return nil, fmt.Errorf("cannot unwrap key of collection %s: %w", collection.Name, err)
+		}
+	}
+	if _, ok := vault.keys[collection.KeyVersion]; !ok {
+		return nil, fmt.Errorf("current key of collection %s is missing", collection.Name)
+	}
+
+	return vault, nil
+}
+
+func (m *sender) collectionDataUrl(collectionId string, identifier ...string) string {
+	path := []string{m.cfg.ServerEndpoint, collectionsUrl, collectionId, dataPath}
+	for _, id := range identifier {
+		path = append(path, url.PathEscape(id))
+	}
+	return strings.Join(path, "/")
+}
+
+// ListCollectionEntries возвращает страницу списка данных коллекции с расшифрованными метаданными
+func (m *sender) ListCollectionEntries(collectionId string, offset, limit int) ([]EntryInfo, int64, error) {
+	vault, err := m.collectionVault(collectionId)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var list models.DataList
+
+	req := m.client.R().
+		SetHeader("Authorization", m.state.auth()).
+		SetQueryParams(map[string]string{
+			"sort":   "identifier",
+			"offset": strconv.Itoa(offset),
+			"limit":  strconv.Itoa(limit),
+		}).
+		SetResult(&list)
+
+	resp, err := req.Get(m.collectionDataUrl(collectionId))
+	if err != nil {
+		return nil, 0, fmt.Errorf("cannot send list collection data request: %w", err)
+	}
+
+	if err := collectionStatus(collectionId, resp.StatusCode(), http.StatusOK); err != nil {
+		return nil, 0, err
+	}
+
+	entries := make([]EntryInfo, 0, len(list.Items))
+	for _, item := range list.Items {
+		metadata, err := decryptMetadata(vault.entryKeys(item.KeyId()), item.Metadata)
+		if err != nil {
+			return nil, 0, err
+		}
+		entries = append(entries, EntryInfo{DataInfo: item, Meta: metadata})
+	}
+
+	return entries, list.Total, nil
+}
+
+// AddCollectionRecord шифрует текущей версией ключа коллекции и сохраняет новую запись
+func (m *sender) AddCollectionRecord(collectionId, identifier string, record models.Record, metadata models.Metadata) error {
+	vault, err := m.collectionVault(collectionId)
+	if err != nil {
+		return err
+	}
+
+	req, err := sealCollectionRecord(m.client.R(), vault.entryKey(identifier), record, &metadata)
+	if err != nil {
+		return err
+	}
+
+	resp, err := req.
+		SetHeader("Authorization", m.state.auth()).
+		SetHeader("If-None-Match", "*").
+		Post(m.collectionDataUrl(collectionId, identifier))
+	if err != nil {
+		return fmt.Errorf("cannot send add collection data request: %w", err)
+	}
+
+	if resp.StatusCode() == http.StatusPreconditionFailed {
+		return fmt.Errorf("data %s already exists in collection %s", identifier, vault.Name)
+	}
+
+	return collectionStatus(collectionId, resp.StatusCode(), http.StatusAccepted)
+}
+
+// GetCollectionRecord получает и расшифровывает запись коллекции
+func (m *sender) GetCollectionRecord(collectionId, identifier string) (CollectionEntry, error) {
+	entry := CollectionEntry{Identifier: identifier}
+
+	vault, err := m.collectionVault(collectionId)
+	if err != nil {
+		return entry, err
+	}
+
+	req := m.client.R().
+		SetHeader("Authorization", m.state.auth())
+
+	resp, err := req.Get(m.collectionDataUrl(collectionId, identifier))
+	if err != nil {
+		return entry, fmt.Errorf("cannot send get collection data request: %w", err)
+	}
+
+	if resp.StatusCode() == http.StatusNotFound {
+		return entry, fmt.Errorf("data %s not found in collection %s", identifier, vault.Name)
+	}
+	if err := collectionStatus(collectionId, resp.StatusCode(), http.StatusOK); err != nil {
+		return entry, err
+	}
+
+	encryptMetadata, err := readMetadata(resp)
+	if err != nil {
+		return entry, err
+	}
+	if crypt.IsStream(resp.Body()) {
+		return entry, fmt.Errorf("data %s is a file, files in collections are not supported by this client", identifier)
+	}
+
+	entry.Origin, err = readOrigin(resp)
+	if err != nil {
+		return entry, err
+	}
+
+	entry.Record, entry.Metadata, err = decryptEntry(vault.entryKeys(entry.KeyId()), resp.Body(), encryptMetadata)
+	if err != nil {
+		return entry, err
+	}
+
+	entry.Revision, _ = parseRevision(resp)
+	return entry, nil
+}
+
+// UpdateCollectionRecord сохраняет новую ревизию записи коллекции, зашифрованную текущей версией ключа.
+// entry - запись из GetCollectionRecord: если данные с тех пор изменились, возвращается ConflictError.
+// Если metadata равно nil, метаданные остаются прежними.
+func (m *sender) UpdateCollectionRecord(collectionId string, entry CollectionEntry, record models.Record, metadata *models.Metadata) error {
+	vault, err := m.collectionVault(collectionId)
+	if err != nil {
+		return err
+	}
+
+	identifier := entry.Identifier
+	req, err := sealCollectionRecord(m.client.R(), vault.entryKey(entry.KeyId()), record, metadata)
+	if err != nil {
+		return err
+	}
+	if entry.Revision > 0 {
+		setRevision(req, entry.Revision)
+	}
+
+	resp, err := req.
+		SetHeader("Authorization", m.state.auth()).
+		Put(m.collectionDataUrl(collectionId, identifier))
+	if err != nil {
+		return fmt.Errorf("cannot send update collection data request: %w", err)
+	}
+
+	if resp.StatusCode() == http.StatusPreconditionFailed {
+		return &ConflictError{Identifier: identifier}
+	}
+
+	return collectionStatus(collectionId, resp.StatusCode(), http.StatusAccepted)
+}
+
+// ReencryptCollection перешифровывает текущие ревизии данных коллекции, в том числе файлы и вложения,
+// текущей версией ее ключа и возвращает количество перешифрованных данных. Данные, уже зашифрованные текущей версией,
+// пропускаются, поэтому после ошибки вызов можно повторить.
+func (m *sender) ReencryptCollection(collectionId string) (int, error) {
+	vault, err := m.collectionVault(collectionId)
+	if err != nil {
+		return 0, err
+	}
+
+	//Сначала собирается весь список: перешифрованные данные получают новую ревизию и меняют страницы
+	var identifiers []string
+	for offset := 0; ; offset += reencryptPageSize {
+		var list models.DataList
+
+		req := m.client.R().
+			SetHeader("Authorization", m.state.auth()).
+			SetQueryParams(map[string]string{
+				"sort":   "identifier",
+				"offset": strconv.Itoa(offset),
+				"limit":  strconv.Itoa(reencryptPageSize),
+			}).
+			SetResult(&list)
+
+		resp, err := req.Get(m.collectionDataUrl(collectionId))
+		if err != nil {
+			return 0, fmt.Errorf("cannot send list collection data request: %w", err)
+		}
+
+		if err := collectionStatus(collectionId, resp.StatusCode(), http.StatusOK); err != nil {
+			return 0, err
+		}
+
+		for _, item := range list.Items {
+			identifiers = append(identifiers, item.Identifier)
+		}
+		if len(list.Items) == 0 || int64(len(identifiers)) >= list.Total {
+			break
+		}
+	}
+
+	count := 0
+	for _, identifier := range identifiers {
+		resealed, err := m.reencryptEntry(vault, identifier)
+		if err != nil {
+			return count, fmt.Errorf("cannot re-encrypt %s: %w", identifier, err)
+		}
+		if resealed {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// reencryptEntry перешифровывает текущую ревизию данных коллекции и их вложения текущей версией ключа.
+// Возвращает false, если все уже зашифровано ею или данные удалены.
+func (m *sender) reencryptEntry(vault *collectionVault, identifier string) (bool, error) {
+	resealed, keyId, err := m.reencryptData(vault, identifier)
+	if err != nil || keyId == `` {
+		return resealed, err
+	}
+
+	attached, err := m.reencryptAttachments(m.collectionDataUrl(vault.Id, identifier), identifier, vault.entryKey(keyId), vault.entryKeys(keyId),
+		func(code, expected int) error { return collectionStatus(vault.Id, code, expected) })
+	return resealed || attached, err
+}
+
+// reencryptData перешифровывает текущую ревизию данных коллекции, файл - потоком с загрузкой по частям.
+// Возвращает идентификатор, от которого получен ключ данных, пустой - данные удалены.
+func (m *sender) reencryptData(vault *collectionVault, identifier string) (bool, string, error) {
+	for {
+		req := m.client.R().
+			SetHeader("Authorization", m.state.auth())
+
+		resp, err := req.Get(m.collectionDataUrl(vault.Id, identifier))
+		if err != nil {
+			return false, ``, fmt.Errorf("cannot send get collection data request: %w", err)
+		}
+
+		if resp.StatusCode() == http.StatusNotFound {
+			return false, ``, nil
+		}
+		if err := collectionStatus(vault.Id, resp.StatusCode(), http.StatusOK); err != nil {
+			return false, ``, err
+		}
+
+		origin, err := readOrigin(resp)
+		if err != nil {
+			return false, ``, err
+		}
+		keyId := identifier
+		if origin != `` {
+			keyId = origin
+		}
+
+		key := vault.entryKey(keyId)
+		body := resp.Body()
+		stream := crypt.IsStream(body)
+		if stream {
+			if crypt.MatchStream(key, body[:min(len(body), crypt.StreamPrefixSize)]) {
+				return false, keyId, nil
+			}
+		} else if _, err := crypt.SymmetricDecrypt(key, body); err == nil {
+			return false, keyId, nil
+		}
+
+		encryptMetadata, err := readMetadata(resp)
+		if err != nil {
+			return false, keyId, err
+		}
+		encryptMetadata, err = reseal(vault.entryKeys(keyId), key, encryptMetadata)
+		if err != nil {
+			return false, keyId, err
+		}
+		revision, _ := parseRevision(resp)
+
+		if stream {
+			encryptData, err := restream(vault.entryKeys(keyId), key, body)
+			if err != nil {
+				return false, keyId, err
+			}
+
+			err = m.uploadCollectionData(vault.Id, identifier, revision, encryptData, encryptMetadata)
+			if errors.Is(err, errUploadPrecondition) {
+				continue
+			}
+			return err == nil, keyId, err
+		}
+
+		encryptData, err := reseal(vault.entryKeys(keyId), key, body)
+		if err != nil {
+			return false, keyId, err
+		}
+
+		update := m.client.R().
+			SetHeader("Authorization", m.state.auth()).
+			SetBody(encryptData)
+		setMetadata(update, encryptMetadata)
+		if revision > 0 {
+			setRevision(update, revision)
+		}
+
+		resp, err = update.Put(m.collectionDataUrl(vault.Id, identifier))
+		if err != nil {
+			return false, keyId, fmt.Errorf("cannot send update collection data request: %w", err)
+		}
+
+		//Данные изменились после чтения, они перечитываются и проверяются заново
+		if resp.StatusCode() == http.StatusPreconditionFailed {
+			continue
+		}
+
+		return true, keyId, collectionStatus(vault.Id, resp.StatusCode(), http.StatusAccepted)
+	}
+}
+
+// uploadCollectionData загружает по частям новую ревизию данных коллекции поверх ревизии revision.
+// Если данные изменились, возвращает errUploadPrecondition.
+func (m *sender) uploadCollectionData(collectionId, identifier string, revision int64, encryptData uploadBody, encryptMetadata []byte) error {
+	req := m.client.R().
+		SetHeader("Authorization", m.state.auth()).
+		SetHeader(uploadLengthHeader, strconv.FormatInt(encryptData.Size(), 10))
+	setMetadata(req, encryptMetadata)
+	if revision > 0 {
+		setRevision(req, revision)
+	}
+
+	resp, err := req.Post(m.collectionDataUrl(collectionId, identifier) + "/" + uploadsPath)
+	if err != nil {
+		return fmt.Errorf("cannot send create upload request: %w", err)
+	}
+
+	if resp.StatusCode() == http.StatusPreconditionFailed {
+		return errUploadPrecondition
+	}
+	if err := collectionStatus(collectionId, resp.StatusCode(), http.StatusCreated); err != nil {
+		return err
+	}
+
+	location := resp.Header().Get("Location")
+	if location == `` {
+		return fmt.Errorf("location header is missing")
+	}
+	uploadUrl := m.cfg.ServerEndpoint + location
+
+	if _, err := m.sendUpload(uploadUrl, encryptData); err != nil {
+		m.cancelUpload(uploadUrl)
+		return err
+	}
+
+	return nil
+}
+
+// reencryptAttachments перешифровывает вложения данных по адресу dataUrl. Ключ вложения мог узнать любой, кто знал
+// прежний ключ данных, поэтому содержимое шифруется заново на новом случайном ключе, а он - ключом данных key.
+// Вложения, ключ которых уже зашифрован key, пропускаются, ключи остальных расшифровываются одним из keys.
+// status возвращает ошибку для ответа сервера.
+func (m *sender) reencryptAttachments(dataUrl, identifier, key string, keys []string, status func(code, expected int) error) (bool, error) {
+	var attachments []models.Attachment
+
+	resp, err := m.client.R().
+		SetHeader("Authorization", m.state.auth()).
+		SetResult(&attachments).
+		Get(dataUrl + "/" + attachmentsPath)
+	if err != nil {
+		return false, fmt.Errorf("cannot send list attachments request: %w", err)
+	}
+	if resp.StatusCode() == http.StatusNotFound {
+		return false, nil
+	}
+	if err := status(resp.StatusCode(), http.StatusOK); err != nil {
+		return false, err
+	}
+
+	resealed := false
+	for _, attachment := range attachments {
+		attachmentUrl := dataUrl + "/" + attachmentsPath + "/" + url.PathEscape(attachment.Name)
+
+		resp, err := m.client.R().
+			SetHeader("Authorization", m.state.auth()).
+			Get(attachmentUrl)
+		if err != nil {
+			return resealed, fmt.Errorf("cannot send get attachment request: %w", err)
+		}
+		//Вложение удалено после получения списка
+		if resp.StatusCode() == http.StatusNotFound {
+			continue
+		}
+		if err := status(resp.StatusCode(), http.StatusOK); err != nil {
+			return resealed, err
+		}
+
+		wrapped, err := base64.StdEncoding.DecodeString(resp.Header().Get(attachmentKeyHeader))
+		if err != nil {
+			return resealed, fmt.Errorf("bad %s header: %w", attachmentKeyHeader, err)
+		}
+		if _, err := crypt.SymmetricDecrypt(key, wrapped); err == nil {
+			continue
+		}
+		oldKey, err := decryptWith(keys, wrapped)
+		if err != nil {
+			return resealed, fmt.Errorf("cannot decrypt key of attachment %s: %w", attachment.Name, err)
+		}
+
+		newKey, err := crypt.GenerateKey()
+		if err != nil {
+			return resealed, fmt.Errorf("cannot generate attachment key: %w", err)
+		}
+		if wrapped, err = crypt.SymmetricEncrypt(key, []byte(newKey)); err != nil {
+			return resealed, fmt.Errorf("cannot encrypt attachment key: %w", err)
+		}
+		encryptData, err := restream([]string{string(oldKey)}, newKey, resp.Body())
+		if err != nil {
+			return resealed, fmt.Errorf("cannot re-encrypt attachment %s: %w", attachment.Name, err)
+		}
+
+		if err := m.uploadAttachment(attachmentUrl, identifier, attachment.MimeType, wrapped, encryptData); err != nil {
+			return resealed, err
+		}
+		resealed = true
+	}
+
+	return resealed, nil
+}
+
+// restream расшифровывает поток первым подходящим из keys ключом и шифрует его заново потоком на ключе key.
+// Открытые данные проходят через память по сегменту и целиком не собираются.
+func restream(keys []string, key string, encryptData []byte) (sealedUpload, error) {
+	oldKey, err := streamKey(keys, encryptData[:min(len(encryptData), crypt.StreamPrefixSize)])
+	if err != nil {
+		return nil, err
+	}
+
+	decrypted, err := crypt.NewDecryptReader(oldKey, bytes.NewReader(encryptData))
+	if err != nil {
+		return nil, fmt.Errorf("cannot decrypt stream: %w", err)
+	}
+
+	var buf bytes.Buffer
+	encrypter, err := crypt.NewEncryptWriter(key, &buf)
+	if err != nil {
+		return nil, fmt.Errorf("cannot encrypt stream: %w", err)
+	}
+	if _, err := io.Copy(encrypter, decrypted); err != nil {
+		return nil, fmt.Errorf("cannot re-encrypt stream: %w", err)
+	}
+	if err := encrypter.Close(); err != nil {
+		return nil, fmt.Errorf("cannot encrypt stream: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// DeleteCollectionData перемещает данные коллекции в ее корзину
+func (m *sender) DeleteCollectionData(collectionId, identifier string) error {
+	if m.state.auth() == `` || m.password == `` {
+		return fmt.Errorf("bad auth data, try login")
+	}
+
+	req := m.client.R().
+		SetHeader("Authorization", m.state.auth())
+
+	resp, err := req.Delete(m.collectionDataUrl(collectionId, identifier))
+	if err != nil {
+		return fmt.Errorf("cannot send delete collection data request: %w", err)
+	}
+
+	return collectionStatus(collectionId, resp.StatusCode(), http.StatusAccepted)
+}
+
+// sealCollectionRecord шифрует запись и метаданные ключом данных коллекции и добавляет их в запрос
+func sealCollectionRecord(req *resty.Request, key string, record models.Record, metadata *models.Metadata) (*resty.Request, error) {
+	encryptData, err := sealRecord(key, record)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBody(encryptData)
+
+	if metadata != nil {
+		encryptMetadata, err := sealMetadata(key, *metadata)
+		if err != nil {
+			return nil, err
+		}
+		setMetadata(req, encryptMetadata)
+	}
+
+	return req, nil
+}
+
+// orgStatus ошибка для ответа на запрос управления организацией
+func orgStatus(orgId string, code, expected int) error {
+	switch code {
+	case expected:
+		return nil
+	case http.StatusForbidden:
+		return fmt.Errorf("invitation to organization %s is not accepted or your role does not allow it", orgId)
+	case http.StatusNotFound:
+		return fmt.Errorf("organization %s or its member not found", orgId)
+	default:
+		return statusError(code)
+	}
+}
+
+// collectionStatus ошибка для ответа на запрос данных коллекции
+func collectionStatus(collectionId string, code, expected int) error {
+	switch code {
+	case expected:
+		return nil
+	case http.StatusForbidden:
+		return fmt.Errorf("collection %s is read only for you", collectionId)
+	case http.StatusNotFound:
+		return fmt.Errorf("collection %s not found", collectionId)
+	default:
+		return statusError(code)
+	}
+}
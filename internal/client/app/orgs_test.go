@@ -0,0 +1,226 @@
+package app
+
+import (
+	"bytes"
+	"encoding/base64"
+	"github.com/lionslon/go-keepass/internal/crypt"
+	"github.com/lionslon/go-keepass/internal/models"
+	"io"
+	"net/url"
+	"testing"
+)
+
+func TestRemoveMemberReencrypts(t *testing.T) {
+	endpoint := newTestServer(t)
+
+	owner := newTestUser(t, endpoint, "alice", "password")
+	member := newTestUser(t, endpoint, "bob", "password")
+
+	org, err := owner.CreateOrganization("team")
+	if err != nil {
+		t.Fatalf("CreateOrganization() error = %v", err)
+	}
+	collection, err := owner.CreateCollection(org.Id, "infra")
+	if err != nil {
+		t.Fatalf("CreateCollection() error = %v", err)
+	}
+
+	records := map[string]string{"db": "db password", "vpn": "vpn key"}
+	for identifier, text := range records {
+		err := owner.AddCollectionRecord(collection.Id, identifier, models.NewTextRecord(text), models.Metadata{Tags: []string{identifier}})
+		if err != nil {
+			t.Fatalf("AddCollectionRecord(%s) error = %v", identifier, err)
+		}
+	}
+
+	if _, err := owner.InviteMember(org.Id, "bob", models.RoleMember); err != nil {
+		t.Fatalf("InviteMember() error = %v", err)
+	}
+	if err := member.AcceptInvitation(org.Id); err != nil {
+		t.Fatalf("AcceptInvitation() error = %v", err)
+	}
+
+	//Ключи коллекции, которые удаленный участник знал до удаления
+	known, err := member.collectionVault(collection.Id)
+	if err != nil {
+		t.Fatalf("collectionVault() error = %v", err)
+	}
+
+	if err := owner.RemoveMember(org.Id, "bob"); err != nil {
+		t.Fatalf("RemoveMember() error = %v", err)
+	}
+
+	for identifier, text := range records {
+		resp, err := owner.client.R().
+			SetHeader("Authorization", owner.state.auth()).
+			Get(owner.collectionDataUrl(collection.Id, identifier))
+		if err != nil {
+			t.Fatalf("get %s error = %v", identifier, err)
+		}
+		encryptMetadata, err := readMetadata(resp)
+		if err != nil {
+			t.Fatalf("readMetadata() error = %v", err)
+		}
+
+		if _, err := crypt.SymmetricDecrypt(known.entryKey(identifier), resp.Body()); err == nil {
+			t.Errorf("%s data is readable with the key known to removed member", identifier)
+		}
+		if _, err := crypt.SymmetricDecrypt(known.entryKey(identifier), encryptMetadata); err == nil {
+			t.Errorf("%s metadata is readable with the key known to removed member", identifier)
+		}
+
+		entry, err := owner.GetCollectionRecord(collection.Id, identifier)
+		if err != nil {
+			t.Fatalf("GetCollectionRecord(%s) error = %v", identifier, err)
+		}
+		if entry.Record.Text == nil || entry.Record.Text.Text != text || !entry.Metadata.HasTag(identifier) {
+			t.Errorf("GetCollectionRecord(%s) = %+v, %+v, want %q", identifier, entry.Record.Text, entry.Metadata, text)
+		}
+		if entry.Revision != 2 {
+			t.Errorf("GetCollectionRecord(%s) revision = %d, want 2", identifier, entry.Revision)
+		}
+	}
+
+	//Повторный вызов не трогает уже перешифрованные данные
+	count, err := owner.ReencryptCollection(collection.Id)
+	if err != nil {
+		t.Fatalf("ReencryptCollection() error = %v", err)
+	}
+	if count != 0 {
+		t.Errorf("ReencryptCollection() = %d, want 0", count)
+	}
+}
+
+func TestRemoveMemberReencryptsFiles(t *testing.T) {
+	endpoint := newTestServer(t)
+
+	owner := newTestUser(t, endpoint, "alice", "password")
+	member := newTestUser(t, endpoint, "bob", "password")
+
+	org, err := owner.CreateOrganization("team")
+	if err != nil {
+		t.Fatalf("CreateOrganization() error = %v", err)
+	}
+	collection, err := owner.CreateCollection(org.Id, "infra")
+	if err != nil {
+		t.Fatalf("CreateCollection() error = %v", err)
+	}
+	if err := owner.AddCollectionRecord(collection.Id, "cert", models.NewTextRecord("stub"), models.Metadata{}); err != nil {
+		t.Fatalf("AddCollectionRecord() error = %v", err)
+	}
+
+	vault, err := owner.collectionVault(collection.Id)
+	if err != nil {
+		t.Fatalf("collectionVault() error = %v", err)
+	}
+	key := vault.entryKey("cert")
+
+	//Файл, загруженный по частям поверх первой ревизии
+	content := bytes.Repeat([]byte("certificate "), 10000)
+	src := &prefixReaderAt{prefix: models.FileHeader("cert.pem"), r: bytes.NewReader(content)}
+	encrypter, err := crypt.NewStreamEncrypter(key, src, int64(len(src.prefix)+len(content)))
+	if err != nil {
+		t.Fatalf("NewStreamEncrypter() error = %v", err)
+	}
+	encryptMetadata, err := crypt.SymmetricEncrypt(key, []byte(`{}`))
+	if err != nil {
+		t.Fatalf("SymmetricEncrypt() error = %v", err)
+	}
+	if err := owner.uploadCollectionData(collection.Id, "cert", 1, encrypter, encryptMetadata); err != nil {
+		t.Fatalf("uploadCollectionData() error = %v", err)
+	}
+
+	//Вложение со случайным ключом, зашифрованным ключом данных
+	attachment := []byte("private key")
+	attachmentKey, err := crypt.GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	wrapped, err := crypt.SymmetricEncrypt(key, []byte(attachmentKey))
+	if err != nil {
+		t.Fatalf("SymmetricEncrypt() error = %v", err)
+	}
+	sealed, err := crypt.NewStreamEncrypter(attachmentKey, bytes.NewReader(attachment), int64(len(attachment)))
+	if err != nil {
+		t.Fatalf("NewStreamEncrypter() error = %v", err)
+	}
+	attachmentUrl := owner.collectionDataUrl(collection.Id, "cert") + "/" + attachmentsPath + "/" + url.PathEscape("key.pem")
+	if err := owner.uploadAttachment(attachmentUrl, "cert", "text/plain", wrapped, sealed); err != nil {
+		t.Fatalf("uploadAttachment() error = %v", err)
+	}
+
+	if _, err := owner.InviteMember(org.Id, "bob", models.RoleMember); err != nil {
+		t.Fatalf("InviteMember() error = %v", err)
+	}
+	if err := member.AcceptInvitation(org.Id); err != nil {
+		t.Fatalf("AcceptInvitation() error = %v", err)
+	}
+	if err := owner.RemoveMember(org.Id, "bob"); err != nil {
+		t.Fatalf("RemoveMember() error = %v", err)
+	}
+
+	vault, err = owner.collectionVault(collection.Id)
+	if err != nil {
+		t.Fatalf("collectionVault() error = %v", err)
+	}
+
+	resp, err := owner.client.R().
+		SetHeader("Authorization", owner.state.auth()).
+		Get(owner.collectionDataUrl(collection.Id, "cert"))
+	if err != nil {
+		t.Fatalf("get data error = %v", err)
+	}
+	if body := resp.Body(); crypt.MatchStream(key, body[:min(len(body), crypt.StreamPrefixSize)]) {
+		t.Errorf("file is readable with the key known to removed member")
+	}
+	err = decryptContent([]string{vault.entryKey("cert")}, bytes.NewReader(resp.Body()), func(record models.Record, r io.Reader) error {
+		got, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		if record.Binary == nil || record.Binary.Name != "cert.pem" || !bytes.Equal(got, content) {
+			t.Errorf("file = %+v with %d bytes, want cert.pem with %d bytes", record.Binary, len(got), len(content))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("decryptContent() error = %v", err)
+	}
+
+	resp, err = owner.client.R().
+		SetHeader("Authorization", owner.state.auth()).
+		Get(attachmentUrl)
+	if err != nil {
+		t.Fatalf("get attachment error = %v", err)
+	}
+	wrapped, err = base64.StdEncoding.DecodeString(resp.Header().Get(attachmentKeyHeader))
+	if err != nil {
+		t.Fatalf("bad %s header: %v", attachmentKeyHeader, err)
+	}
+	if _, err := crypt.SymmetricDecrypt(key, wrapped); err == nil {
+		t.Errorf("attachment key is readable with the key known to removed member")
+	}
+	newKey, err := crypt.SymmetricDecrypt(vault.entryKey("cert"), wrapped)
+	if err != nil {
+		t.Fatalf("SymmetricDecrypt() attachment key error = %v", err)
+	}
+	if string(newKey) == attachmentKey {
+		t.Errorf("attachment key was not changed")
+	}
+	decrypted, err := crypt.NewDecryptReader(string(newKey), bytes.NewReader(resp.Body()))
+	if err != nil {
+		t.Fatalf("NewDecryptReader() error = %v", err)
+	}
+	if got, err := io.ReadAll(decrypted); err != nil || !bytes.Equal(got, attachment) {
+		t.Errorf("attachment = %q, %v, want %q", got, err, attachment)
+	}
+
+	//Повторный вызов не трогает уже перешифрованные файл и вложение
+	count, err := owner.ReencryptCollection(collection.Id)
+	if err != nil {
+		t.Fatalf("ReencryptCollection() error = %v", err)
+	}
+	if count != 0 {
+		t.Errorf("ReencryptCollection() = %d, want 0", count)
+	}
+}
@@ -0,0 +1,116 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"github.com/lionslon/go-keepass/internal/crypt"
+	"github.com/lionslon/go-keepass/internal/models"
+	"time"
+)
+
+// otpauthField поле метаданных, в котором импорт из CSV и Bitwarden сохраняет адрес otpauth:// учетных данных,
+// импорт из KeePass сохраняет его в поле keepassOTP
+const otpauthField = "otpauth"
+
+// OTPCode одноразовый код
+type OTPCode struct {
+	Code      string         // код
+	Kind      models.OTPKind // вид кода
+	Label     string         // сервис и учетная запись
+	Remaining time.Duration  // для TOTP - время до смены кода
+	Counter   uint64         // для HOTP - счетчик, из которого получен код
+}
+
+// OTP вычисляет текущий одноразовый код записи с секретом или учетных данных с адресом otpauth:// в метаданных.
+// Для HOTP счетчик в записи увеличивается до того, как код будет показан, чтобы код не выдавался дважды.
+func (m *sender) OTP(identifier string) (OTPCode, error) {
+	var code OTPCode
+
+	record, metadata, err := m.GetRecord(identifier)
+	if err != nil {
+		return code, err
+	}
+
+	otp, err := recordOTP(record, metadata)
+	if err != nil {
+		return code, fmt.Errorf("data %s: %w", identifier, err)
+	}
+
+	key, err := otp.Key()
+	if err != nil {
+		return code, err
+	}
+
+	code.Kind = otp.Kind
+	code.Label = otp.Label()
+
+	var counter uint64
+	if otp.Kind == models.OTPTotp {
+		counter, code.Remaining = otp.TimeCounter(time.Now())
+	} else {
+		counter = otp.Counter
+		code.Counter = counter
+
+		next := *otp
+		next.Counter++
+		if err := m.saveOTP(identifier, record, metadata, next); err != nil {
+			return code, fmt.Errorf("cannot save hotp counter: %w", err)
+		}
+	}
+
+	code.Code = crypt.HOTP(otp.Algorithm.Hash(), key, counter, otp.Digits)
+
+	return code, nil
+}
+
+// saveOTP сохраняет секрет с новым счетчиком туда, откуда он был прочитан. Изменение, отложенное
+// до синхронизации, тоже считается сохраненным: следующий код будет получен из очереди.
+func (m *sender) saveOTP(identifier string, record models.Record, metadata models.Metadata, otp models.OTP) error {
+	var err error
+	if record.Type == models.RecordOTP {
+		record.OTP = &otp
+		err = m.UpdateRecord(identifier, record, nil)
+	} else {
+		fields := make(map[string]string, len(metadata.Fields))
+		for name, value := range metadata.Fields {
+			fields[name] = value
+		}
+		fields[otpField(metadata)] = otp.URI()
+		metadata.Fields = fields
+		err = m.UpdateMetadata(identifier, metadata)
+	}
+
+	if errors.Is(err, ErrQueued) {
+		return nil
+	}
+	return err
+}
+
+// recordOTP секрет одноразовых кодов из записи или из поля метаданных
+func recordOTP(record models.Record, metadata models.Metadata) (*models.OTP, error) {
+	if record.Type == models.RecordOTP {
+		return record.OTP, nil
+	}
+
+	field := otpField(metadata)
+	if field == `` {
+		return nil, fmt.Errorf("%s record has no otp secret", record.Type)
+	}
+
+	otp, err := models.ParseOTPURI(metadata.Fields[field])
+	if err != nil {
+		return nil, err
+	}
+
+	return &otp, nil
+}
+
+// otpField поле метаданных с адресом otpauth://, пустое - такого поля нет
+func otpField(metadata models.Metadata) string {
+	for _, field := range []string{otpauthField, keepassOTP} {
+		if metadata.Fields[field] != `` {
+			return field
+		}
+	}
+	return ``
+}
@@ -0,0 +1,339 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/lionslon/go-keepass/internal/crypt"
+	"github.com/lionslon/go-keepass/internal/models"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	keyGenerationSeparator = "#" // разделитель номера поколения ключа в исходном идентификаторе данных
+	maxKeyGenerations      = 100 // наибольший номер поколения ключа, ограничивает перебор ключей при расшифровке
+)
+
+// EntryInfo описание данных из списка с расшифрованными метаданными
+type EntryInfo struct {
+	models.DataInfo
+	Meta models.Metadata
+}
+
+// AddRecord сериализует, шифрует и сохраняет новую типизированную запись вместе с метаданными
+func (m *sender) AddRecord(identifier string, record models.Record, metadata models.Metadata) error {
+	if m.password == `` {
+		return fmt.Errorf("bad auth data, try login")
+	}
+
+	encryptData, err := m.encryptRecord(identifier, record)
+	if err != nil {
+		return err
+	}
+
+	encryptMetadata, err := m.encryptMetadata(identifier, metadata)
+	if err != nil {
+		return err
+	}
+
+	return m.postEncryptedData(identifier, encryptData, encryptMetadata)
+}
+
+// UpdateRecord сохраняет новую ревизию типизированной записи.
+// Если metadata равно nil, метаданные остаются прежними.
+func (m *sender) UpdateRecord(identifier string, record models.Record, metadata *models.Metadata) error {
+	if m.password == `` {
+		return fmt.Errorf("bad auth data, try login")
+	}
+
+	encryptData, err := m.encryptRecord(identifier, record)
+	if err != nil {
+		return err
+	}
+
+	var encryptMetadata []byte
+	if metadata != nil {
+		encryptMetadata, err = m.encryptMetadata(identifier, *metadata)
+		if err != nil {
+			return err
+		}
+	}
+
+	return m.putEncryptedData(identifier, encryptData, encryptMetadata)
+}
+
+// UpdateMetadata сохраняет новую ревизию записи с измененными метаданными
+func (m *sender) UpdateMetadata(identifier string, metadata models.Metadata) error {
+	if m.password == `` {
+		return fmt.Errorf("bad auth data, try login")
+	}
+
+	encryptMetadata, err := m.encryptMetadata(identifier, metadata)
+	if err != nil {
+		return err
+	}
+
+	return m.putEncryptedMetadata(identifier, encryptMetadata)
+}
+
+// GetRecord получает и расшифровывает типизированную запись и ее метаданные
+func (m *sender) GetRecord(identifier string) (models.Record, models.Metadata, error) {
+	if m.password == `` {
+		return models.Record{}, models.Metadata{}, fmt.Errorf("bad auth data, try login")
+	}
+
+	encryptData, encryptMetadata, err := m.getEncryptedData(identifier)
+	if err != nil {
+		return models.Record{}, models.Metadata{}, err
+	}
+
+	return decryptEntry(m.entryKeys(identifier), encryptData, encryptMetadata)
+}
+
+// GetRecordRevision получает и расшифровывает указанную ревизию типизированной записи
+func (m *sender) GetRecordRevision(identifier string, revision int64) (models.Record, models.Metadata, error) {
+	if m.state.auth() == `` || m.password == `` {
+		return models.Record{}, models.Metadata{}, fmt.Errorf("bad auth data, try login")
+	}
+
+	encryptData, encryptMetadata, err := m.getEncryptedRevision(identifier, revision)
+	if err != nil {
+		return models.Record{}, models.Metadata{}, err
+	}
+
+	return decryptEntry(m.entryKeys(identifier), encryptData, encryptMetadata)
+}
+
+// ListEntries возвращает страницу списка данных с расшифрованными метаданными
+func (m *sender) ListEntries(sort string, desc bool, offset, limit int) ([]EntryInfo, int64, error) {
+	return m.ListFolderEntries(``, sort, desc, offset, limit)
+}
+
+// ListFolderEntries возвращает страницу списка данных папки folder с расшифрованными метаданными
+func (m *sender) ListFolderEntries(folder, sort string, desc bool, offset, limit int) ([]EntryInfo, int64, error) {
+	list, err := m.ListFolderData(folder, sort, desc, offset, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	entries, err := m.decryptInfos(list.Items)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return entries, list.Total, nil
+}
+
+// FindByTag просматривает весь список данных и возвращает записи с указанным тегом.
+// Загружаются и расшифровываются только метаданные, сами записи не запрашиваются.
+func (m *sender) FindByTag(tag string) ([]EntryInfo, error) {
+	entries, err := m.listAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var found []EntryInfo
+	for _, entry := range entries {
+		if entry.Meta.HasTag(tag) {
+			found = append(found, entry)
+		}
+	}
+
+	return found, nil
+}
+
+// listAll просматривает весь список данных по страницам и возвращает его с расшифрованными метаданными
+func (m *sender) listAll() ([]EntryInfo, error) {
+	const pageSize = 100
+
+	var all []EntryInfo
+	for offset := 0; ; offset += pageSize {
+		entries, total, err := m.ListEntries("identifier", false, offset, pageSize)
+		if err != nil {
+			return nil, err
+		}
+
+		all = append(all, entries...)
+
+		if len(entries) == 0 || int64(offset+len(entries)) >= total {
+			return all, nil
+		}
+	}
+}
+
+// entryKey ключ данных записи (см. crypt.EntryKey). Новые ревизии шифруются им, чтобы запись
+// можно было передать другому пользователю, не раскрывая пароль. Ключ получается из исходного
+// идентификатора: перемещение не меняет ключ перемещенных данных.
+func (m *sender) entryKey(identifier string) string {
+	return crypt.EntryKey(m.password, m.state.keyId(identifier))
+}
+
+// entryKeys ключи, которыми могут быть зашифрованы данные записи (см. dataKeys)
+func (m *sender) entryKeys(identifier string) []string {
+	return m.dataKeys(m.state.keyId(identifier), identifier)
+}
+
+// dataKeys ключи, которыми могут быть зашифрованы данные с исходным идентификатором keyId: ключ данных,
+// ключи прежних поколений для ревизий, сохраненных до смены ключа (см. keyGenerations),
+// ключ текущего идентификатора для ревизий, сохраненных клиентом, еще не знавшим о перемещении,
+// и ключ пароля для ревизий, сохраненных до появления ключей данных
+func (m *sender) dataKeys(keyId, identifier string) []string {
+	keyIds := keyGenerations(keyId)
+	if !slices.Contains(keyIds, identifier) {
+		keyIds = append(keyIds, identifier)
+	}
+
+	keys := make([]string, 0, len(keyIds)+1)
+	for _, id := range keyIds {
+		keys = append(keys, crypt.EntryKey(m.password, id))
+	}
+	return append(keys, m.password)
+}
+
+// keyGenerations исходный идентификатор keyId и идентификаторы прежних поколений ключа, от нового к старому.
+// После отзыва передачи ключ данных меняется: к исходному идентификатору добавляется номер поколения
+// (vpn, vpn#1, vpn#2), поэтому получатель не знает новый ключ, а владелец получает прежние из пароля.
+func keyGenerations(keyId string) []string {
+	base, generation := splitKeyId(keyId)
+
+	keyIds := []string{keyId}
+	for n := generation - 1; n > 0; n-- {
+		keyIds = append(keyIds, base+keyGenerationSeparator+strconv.Itoa(n))
+	}
+	if generation > 0 {
+		keyIds = append(keyIds, base)
+	}
+	return keyIds
+}
+
+// nextKeyId исходный идентификатор следующего поколения ключа данных
+func nextKeyId(keyId string) (string, error) {
+	base, generation := splitKeyId(keyId)
+	if generation >= maxKeyGenerations {
+		return ``, fmt.Errorf("data key was changed %d times, save the data under a new identifier", generation)
+	}
+	return base + keyGenerationSeparator + strconv.Itoa(generation+1), nil
+}
+
+// splitKeyId разделяет исходный идентификатор на идентификатор первого поколения ключа и номер поколения.
+// Номер считается только в каноническом виде, иначе идентификатор данных с # был бы прочитан иначе.
+func splitKeyId(keyId string) (string, int) {
+	i := strings.LastIndex(keyId, keyGenerationSeparator)
+	if i < 0 {
+		return keyId, 0
+	}
+
+	suffix := keyId[i+len(keyGenerationSeparator):]
+	generation, err := strconv.Atoi(suffix)
+	if err != nil || generation < 1 || generation > maxKeyGenerations || strconv.Itoa(generation) != suffix {
+		return keyId, 0
+	}
+	return keyId[:i], generation
+}
+
+// decryptWith расшифровывает данные первым подходящим ключом
+func decryptWith(keys []string, encryptData []byte) ([]byte, error) {
+	var err error
+	for _, key := range keys {
+		var data []byte
+		if data, err = crypt.SymmetricDecrypt(key, encryptData); err == nil {
+			return data, nil
+		}
+	}
+
+	return nil, err
+}
+
+// reseal перешифровывает данные, зашифрованные одним из keys, ключом key
+func reseal(keys []string, key string, encryptData []byte) ([]byte, error) {
+	if len(encryptData) == 0 {
+		return encryptData, nil
+	}
+
+	data, err := decryptWith(keys, encryptData)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decrypt user data: %w", err)
+	}
+
+	encryptData, err = crypt.SymmetricEncrypt(key, data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot encrypt user data: %w", err)
+	}
+
+	return encryptData, nil
+}
+
+func (m *sender) encryptRecord(identifier string, record models.Record) ([]byte, error) {
+	return sealRecord(m.entryKey(identifier), record)
+}
+
+func (m *sender) encryptMetadata(identifier string, metadata models.Metadata) ([]byte, error) {
+	return sealMetadata(m.entryKey(identifier), metadata)
+}
+
+// sealRecord шифрует запись ключом key
+func sealRecord(key string, record models.Record) ([]byte, error) {
+	data, err := record.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	encryptData, err := crypt.SymmetricEncrypt(key, data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot encrypt user data: %w", err)
+	}
+
+	return encryptData, nil
+}
+
+// sealMetadata шифрует метаданные ключом key, пустые метаданные не передаются
+func sealMetadata(key string, metadata models.Metadata) ([]byte, error) {
+	if metadata.IsEmpty() {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, fmt.Errorf("cannot marshal metadata: %w", err)
+	}
+
+	encryptMetadata, err := crypt.SymmetricEncrypt(key, data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot encrypt metadata: %w", err)
+	}
+
+	return encryptMetadata, nil
+}
+
+func decryptMetadata(keys []string, encryptMetadata []byte) (models.Metadata, error) {
+	if len(encryptMetadata) == 0 {
+		return models.Metadata{}, nil
+	}
+
+	data, err := decryptWith(keys, encryptMetadata)
+	if err != nil {
+		return models.Metadata{}, fmt.Errorf("cannot decrypt metadata: %w", err)
+	}
+
+	return models.ParseMetadata(data)
+}
+
+func decryptEntry(keys []string, encryptData, encryptMetadata []byte) (models.Record, models.Metadata, error) {
+	data, err := decryptWith(keys, encryptData)
+	if err != nil {
+		return models.Record{}, models.Metadata{}, fmt.Errorf("cannot decrypt user data: %w", err)
+	}
+
+	record, err := models.ParseRecord(data)
+	if err != nil {
+		return record, models.Metadata{}, err
+	}
+
+	metadata, err := decryptMetadata(keys, encryptMetadata)
+	if err != nil {
+		return record, metadata, err
+	}
+
+	return record, metadata, nil
+}
@@ -0,0 +1,104 @@
+package app
+
+import (
+	"bytes"
+	"github.com/lionslon/go-keepass/internal/crypt"
+	"github.com/lionslon/go-keepass/internal/models"
+	"testing"
+)
+
+func TestSealMetadata(t *testing.T) {
+	key := crypt.EntryKey("password", "mail")
+
+	//Пустые метаданные не передаются на сервер
+	sealed, err := sealMetadata(key, models.Metadata{})
+	if err != nil || sealed != nil {
+		t.Errorf("sealMetadata() empty = %q, %v, want nil", sealed, err)
+	}
+	if got, err := decryptMetadata([]string{key}, nil); err != nil || !got.IsEmpty() {
+		t.Errorf("decryptMetadata() nil = %+v, %v, want empty", got, err)
+	}
+
+	metadata := models.Metadata{Site: "mail.example.com", Tags: []string{"work"}, Fields: map[string]string{"pin": "1234"}}
+	sealed, err = sealMetadata(key, metadata)
+	if err != nil {
+		t.Fatalf("sealMetadata() error = %v", err)
+	}
+	if bytes.Contains(sealed, []byte("mail.example.com")) || bytes.Contains(sealed, []byte("work")) {
+		t.Errorf("sealMetadata() = %q, contains plaintext", sealed)
+	}
+
+	//Метаданные расшифровываются любым из ключей записи, как и сами данные
+	got, err := decryptMetadata([]string{"other", key}, sealed)
+	if err != nil {
+		t.Fatalf("decryptMetadata() error = %v", err)
+	}
+	if got.Site != metadata.Site || !got.HasTag("work") || got.Fields["pin"] != "1234" {
+		t.Errorf("decryptMetadata() = %+v, want %+v", got, metadata)
+	}
+
+	if _, err := decryptMetadata([]string{"other"}, sealed); err == nil {
+		t.Error("decryptMetadata() wrong key error = nil, want error")
+	}
+}
+
+func TestRecordMetadata(t *testing.T) {
+	endpoint := newTestServer(t)
+	m := newTestUser(t, endpoint, "alice", "password")
+
+	metadata := models.Metadata{Site: "bank.example.com", Tags: []string{"bank", "work"}}
+	if err := m.AddRecord("bank", models.NewTextRecord("pin 1234"), metadata); err != nil {
+		t.Fatalf("AddRecord() error = %v", err)
+	}
+	if err := m.AddRecord("note", models.NewTextRecord("note"), models.Metadata{Tags: []string{"home"}}); err != nil {
+		t.Fatalf("AddRecord() error = %v", err)
+	}
+
+	//Сервер хранит метаданные только зашифрованными
+	list, err := m.ListData("identifier", false, 0, 10)
+	if err != nil {
+		t.Fatalf("ListData() error = %v", err)
+	}
+	for _, item := range list.Items {
+		if len(item.Metadata) == 0 || bytes.Contains(item.Metadata, []byte("bank")) {
+			t.Errorf("ListData() %s metadata = %q, want encrypted", item.Identifier, item.Metadata)
+		}
+	}
+
+	found, err := m.FindByTag("bank")
+	if err != nil {
+		t.Fatalf("FindByTag() error = %v", err)
+	}
+	if len(found) != 1 || found[0].Identifier != "bank" || found[0].Meta.Site != metadata.Site {
+		t.Errorf("FindByTag() = %+v, want bank", found)
+	}
+
+	//Изменение метаданных сохраняет запись новой ревизией
+	if err := m.UpdateMetadata("bank", models.Metadata{Tags: []string{"archive"}}); err != nil {
+		t.Fatalf("UpdateMetadata() error = %v", err)
+	}
+	record, got, err := m.GetRecord("bank")
+	if err != nil {
+		t.Fatalf("GetRecord() error = %v", err)
+	}
+	if record.Text == nil || record.Text.Text != "pin 1234" || got.HasTag("bank") || !got.HasTag("archive") {
+		t.Errorf("GetRecord() = %+v, %+v, want same record with archive tag", record.Text, got)
+	}
+
+	//Прежние метаданные остаются в предыдущей ревизии
+	_, previous, err := m.GetRecordRevision("bank", 1)
+	if err != nil {
+		t.Fatalf("GetRecordRevision() error = %v", err)
+	}
+	if !previous.HasTag("bank") {
+		t.Errorf("GetRecordRevision() metadata = %+v, want bank tag", previous)
+	}
+
+	//Обновление записи без метаданных оставляет текущие
+	if err := m.UpdateRecord("bank", models.NewTextRecord("pin 4321"), nil); err != nil {
+		t.Fatalf("UpdateRecord() error = %v", err)
+	}
+	if _, got, err := m.GetRecord("bank"); err != nil || !got.HasTag("archive") {
+		t.Errorf("GetRecord() after update = %+v, %v, want archive tag kept", got, err)
+	}
+}
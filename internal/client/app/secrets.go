@@ -0,0 +1,246 @@
+package app
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/lionslon/go-keepass/internal/models"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// SecretsFormat формат выгрузки секретов для инструментов разработчика
+type SecretsFormat string
+
+const (
+	SecretsDotenv     SecretsFormat = "dotenv" //Файл .env с переменными окружения
+	SecretsJSON       SecretsFormat = "json"   //Плоский JSON объект
+	SecretsKubernetes SecretsFormat = "k8s"    //Манифест Kubernetes Secret со значениями в base64
+)
+
+// SecretsFormats все поддерживаемые форматы выгрузки секретов
+var SecretsFormats = []SecretsFormat{SecretsDotenv, SecretsJSON, SecretsKubernetes}
+
+// secretNamePattern допустимое имя Kubernetes Secret (поддомен DNS по RFC 1123)
+var secretNamePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9.]{0,251}[a-z0-9])?$`)
+
+// SecretsSelection выбор данных для выгрузки, данные должны подходить под все заданные условия
+type SecretsSelection struct {
+	Tag         string   // тег
+	Folder      string   // папка со вложенными папками, например, prod для prod/db/password
+	Identifiers []string // список идентификаторов
+}
+
+// IsEmpty проверяет, что условия выбора не заданы
+func (m *SecretsSelection) IsEmpty() bool {
+	return m.Tag == `` && m.Folder == `` && len(m.Identifiers) == 0
+}
+
+func (m *SecretsSelection) match(entry EntryInfo) bool {
+	if m.Tag != `` && !entry.Meta.HasTag(m.Tag) {
+		return false
+	}
+	if folder := strings.TrimSuffix(m.Folder, models.FolderSeparator); folder != `` && !models.InFolder(entry.Identifier, folder) {
+		return false
+	}
+	if len(m.Identifiers) > 0 && !slices.Contains(m.Identifiers, entry.Identifier) {
+		return false
+	}
+	return true
+}
+
+// secret переменная, получаемая из данных
+type secret struct {
+	name  string
+	value []byte
+}
+
+// ParseSecretsFormat проверяет название формата выгрузки секретов
+func ParseSecretsFormat(name string) (SecretsFormat, error) {
+	for _, format := range SecretsFormats {
+		if string(format) == strings.ToLower(name) {
+			return format, nil
+		}
+	}
+	return ``, fmt.Errorf("unknown secrets format %q", name)
+}
+
+// ExportSecrets выгружает выбранные данные в открытом виде в файл, доступный только владельцу.
+// Имя переменной получается из идентификатора: prod/db-password становится PROD_DB_PASSWORD.
+// Текстовая запись дает одну переменную, у учетных данных и карт к имени добавляется поле:
+// PROD_DB_LOGIN, PROD_DB_PASSWORD, PROD_DB_URL. Файлы попадают в выгрузку, только если это текст
+// в UTF-8, кроме манифеста Kubernetes, где значения в base64. name - имя Secret для Kubernetes.
+func (m *sender) ExportSecrets(selection SecretsSelection, format SecretsFormat, path, name string) (ExportResult, error) {
+	var result ExportResult
+
+	if m.password == `` {
+		return result, fmt.Errorf("bad auth data, try login")
+	}
+	if selection.IsEmpty() {
+		return result, fmt.Errorf("select data by tag, folder or identifiers")
+	}
+	if format == SecretsKubernetes && !secretNamePattern.MatchString(name) {
+		return result, fmt.Errorf("bad kubernetes secret name %q, use lowercase letters, digits, '-' and '.'", name)
+	}
+
+	entries, err := m.listAll()
+	if err != nil {
+		return result, err
+	}
+
+	var secrets []secret
+	names := make(map[string]string)
+
+	for _, entry := range entries {
+		if !selection.match(entry) {
+			continue
+		}
+
+		record, _, err := m.GetRecord(entry.Identifier)
+		if err != nil {
+			result.Skipped = append(result.Skipped, fmt.Sprintf("%s: %s", entry.Identifier, err))
+			continue
+		}
+
+		values, err := recordSecrets(envName(entry.Identifier), record, format == SecretsKubernetes)
+		if err != nil {
+			result.Skipped = append(result.Skipped, fmt.Sprintf("%s: %s", entry.Identifier, err))
+			continue
+		}
+
+		//Разные идентификаторы могут дать одно имя переменной, например, db-password и db_password
+		if i := slices.IndexFunc(values, func(s secret) bool { return names[s.name] != `` }); i >= 0 {
+			result.Skipped = append(result.Skipped, fmt.Sprintf("%s: variable %s is already taken by %s", entry.Identifier, values[i].name, names[values[i].name]))
+			continue
+		}
+		for _, value := range values {
+			names[value.name] = entry.Identifier
+		}
+
+		secrets = append(secrets, values...)
+		result.Exported = append(result.Exported, entry.Identifier)
+	}
+
+	for _, identifier := range selection.Identifiers {
+		if !slices.Contains(result.Exported, identifier) && !slices.ContainsFunc(result.Skipped, func(s string) bool { return strings.HasPrefix(s, identifier+": ") }) {
+			result.Skipped = append(result.Skipped, fmt.Sprintf("%s: not found", identifier))
+		}
+	}
+
+	if len(secrets) == 0 {
+		return result, fmt.Errorf("no data matches the selection")
+	}
+
+	var content []byte
+	switch format {
+	case SecretsDotenv:
+		content = formatDotenv(secrets)
+	case SecretsJSON:
+		content, err = formatSecretsJSON(secrets)
+	case SecretsKubernetes:
+		content = formatKubernetesSecret(secrets, name)
+	default:
+		err = fmt.Errorf("unknown secrets format %q", format)
+	}
+	if err != nil {
+		return result, err
+	}
+
+	return result, writeFile(path, bytes.NewReader(content))
+}
+
+// recordSecrets переменные записи, binary - значения могут быть произвольными байтами
+func recordSecrets(name string, record models.Record, binary bool) ([]secret, error) {
+	field := func(suffix, value string) secret {
+		return secret{name: name + "_" + suffix, value: []byte(value)}
+	}
+
+	switch record.Type {
+	case models.RecordCredentials:
+		secrets := []secret{field("LOGIN", record.Credentials.Login), field("PASSWORD", record.Credentials.Password)}
+		if record.Credentials.URL != `` {
+			secrets = append(secrets, field("URL", record.Credentials.URL))
+		}
+		return secrets, nil
+	case models.RecordCard:
+		return []secret{
+			field("NUMBER", record.Card.Number),
+			field("HOLDER", record.Card.Holder),
+			field("EXPIRY", record.Card.Expiry),
+			field("CVV", record.Card.CVV),
+		}, nil
+	case models.RecordText:
+		return []secret{{name: name, value: []byte(record.Text.Text)}}, nil
+	case models.RecordOTP:
+		return []secret{field("OTPAUTH", record.OTP.URI())}, nil
+	default:
+		if !binary && !utf8.Valid(record.Binary.Data) {
+			return nil, fmt.Errorf("file %s is not text, export it as kubernetes secret", record.Binary.Name)
+		}
+		return []secret{{name: name, value: record.Binary.Data}}, nil
+	}
+}
+
+// envName имя переменной окружения из идентификатора: латинские буквы в верхнем регистре, цифры и "_",
+// разделитель папок тоже становится "_": prod/db/password - PROD_DB_PASSWORD
+func envName(identifier string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, identifier)
+
+	if name == `` || name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+
+	return name
+}
+
+// formatDotenv файл .env. Значения берутся в одинарные кавычки, чтобы в них не подставлялись переменные,
+// а значения с одинарными кавычками и переводами строк - в двойные с экранированием.
+func formatDotenv(secrets []secret) []byte {
+	var buf bytes.Buffer
+	for _, s := range secrets {
+		value := string(s.value)
+		if !strings.ContainsAny(value, "'\n\r") {
+			fmt.Fprintf(&buf, "%s='%s'\n", s.name, value)
+			continue
+		}
+
+		value = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`, "\n", `\n`, "\r", `\r`).Replace(value)
+		fmt.Fprintf(&buf, "%s=\"%s\"\n", s.name, value)
+	}
+	return buf.Bytes()
+}
+
+func formatSecretsJSON(secrets []secret) ([]byte, error) {
+	values := make(map[string]string, len(secrets))
+	for _, s := range secrets {
+		values[s.name] = string(s.value)
+	}
+
+	content, err := json.MarshalIndent(values, ``, "  ")
+	if err != nil {
+		return nil, fmt.Errorf("cannot marshal secrets: %w", err)
+	}
+
+	return append(content, '\n'), nil
+}
+
+// formatKubernetesSecret манифест Secret. Имена и значения в base64 не требуют экранирования в YAML.
+func formatKubernetesSecret(secrets []secret, name string) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "apiVersion: v1\nkind: Secret\nmetadata:\n  name: %s\ntype: Opaque\ndata:\n", name)
+	for _, s := range secrets {
+		fmt.Fprintf(&buf, "  %s: %s\n", s.name, base64.StdEncoding.EncodeToString(s.value))
+	}
+	return buf.Bytes()
+}
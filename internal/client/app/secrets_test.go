@@ -0,0 +1,189 @@
+package app
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"github.com/lionslon/go-keepass/internal/models"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSecretsSelectionMatch(t *testing.T) {
+	entry := func(identifier string, tags ...string) EntryInfo {
+		return EntryInfo{DataInfo: models.DataInfo{Identifier: identifier}, Meta: models.Metadata{Tags: tags}}
+	}
+
+	tests := []struct {
+		name      string
+		selection SecretsSelection
+		entry     EntryInfo
+		want      bool
+	}{
+		{"folder", SecretsSelection{Folder: "prod"}, entry("prod/db/password"), true},
+		{"folder with separator", SecretsSelection{Folder: "prod/"}, entry("prod/db"), true},
+		{"other folder", SecretsSelection{Folder: "prod"}, entry("production/db"), false},
+		{"folder itself", SecretsSelection{Folder: "prod"}, entry("prod"), false},
+		//Имя с префиксом папки не означает, что данные лежат в папке
+		{"name with folder prefix", SecretsSelection{Folder: "prod"}, entry("prod_db_password"), false},
+		{"tag", SecretsSelection{Tag: "ci"}, entry("token", "ci"), true},
+		{"missing tag", SecretsSelection{Tag: "ci"}, entry("token", "dev"), false},
+		{"identifier", SecretsSelection{Identifiers: []string{"a", "token"}}, entry("token"), true},
+		{"other identifier", SecretsSelection{Identifiers: []string{"a"}}, entry("token"), false},
+		{"all conditions", SecretsSelection{Tag: "ci", Folder: "prod"}, entry("prod/token", "ci"), true},
+		{"one condition fails", SecretsSelection{Tag: "ci", Folder: "prod"}, entry("dev/token", "ci"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.selection.match(tt.entry); got != tt.want {
+				t.Errorf("match(%s) = %v, want %v", tt.entry.Identifier, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnvName(t *testing.T) {
+	tests := map[string]string{
+		"prod/db-password": "PROD_DB_PASSWORD",
+		"api.token":        "API_TOKEN",
+		"пароль":           "______",
+		"1password":        "_1PASSWORD",
+		"":                 "_",
+	}
+	for identifier, want := range tests {
+		if got := envName(identifier); got != want {
+			t.Errorf("envName(%q) = %s, want %s", identifier, got, want)
+		}
+	}
+}
+
+func TestFormatDotenv(t *testing.T) {
+	secrets := []secret{
+		{name: "PLAIN", value: []byte(`p@ss $HOME "quoted" \n`)},
+		{name: "SINGLE", value: []byte(`it's`)},
+		{name: "MULTILINE", value: []byte("line one\nline \"two\"\r\n$HOME \\")},
+		{name: "EMPTY"},
+	}
+
+	//Без одинарных кавычек и переводов строк значение берется в одинарные кавычки как есть,
+	//иначе - в двойные с экранированием обратной косой черты, кавычек, $ и переводов строк
+	want := `PLAIN='p@ss $HOME "quoted" \n'` + "\n" +
+		`SINGLE="it's"` + "\n" +
+		`MULTILINE="line one\nline \"two\"\r\n\$HOME \\"` + "\n" +
+		`EMPTY=''` + "\n"
+
+	if got := string(formatDotenv(secrets)); got != want {
+		t.Errorf("formatDotenv() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestFormatSecretsJSON(t *testing.T) {
+	content, err := formatSecretsJSON([]secret{{name: "A", value: []byte("x\n\"y\"")}, {name: "B", value: []byte("")}})
+	if err != nil {
+		t.Fatalf("formatSecretsJSON() error = %v", err)
+	}
+
+	var got map[string]string
+	if err := json.Unmarshal(content, &got); err != nil {
+		t.Fatalf("cannot decode %s: %v", content, err)
+	}
+	if len(got) != 2 || got["A"] != "x\n\"y\"" || got["B"] != `` {
+		t.Errorf("formatSecretsJSON() = %v", got)
+	}
+}
+
+func TestFormatKubernetesSecret(t *testing.T) {
+	content := formatKubernetesSecret([]secret{{name: "KEY", value: []byte{0x00, 0xff, '\n'}}, {name: "TEXT", value: []byte("a: b")}}, "app-secrets")
+
+	want := "apiVersion: v1\nkind: Secret\nmetadata:\n  name: app-secrets\ntype: Opaque\ndata:\n" +
+		"  KEY: " + base64.StdEncoding.EncodeToString([]byte{0x00, 0xff, '\n'}) + "\n" +
+		"  TEXT: " + base64.StdEncoding.EncodeToString([]byte("a: b")) + "\n"
+	if string(content) != want {
+		t.Errorf("formatKubernetesSecret() =\n%s\nwant\n%s", content, want)
+	}
+}
+
+func TestExportSecrets(t *testing.T) {
+	endpoint := newTestServer(t)
+	m := newTestUser(t, endpoint, "alice", "password")
+
+	records := []struct {
+		identifier string
+		record     models.Record
+		tags       []string
+	}{
+		{"prod/db", models.Record{Type: models.RecordCredentials, Credentials: &models.Credentials{Login: "admin", Password: "it's"}}, nil},
+		{"prod/token", models.NewTextRecord("abc"), []string{"ci"}},
+		{"prod/key", models.Record{Type: models.RecordBinary, Binary: &models.BinaryFile{Name: "key", Data: []byte{0xff}}}, nil},
+		{"prod_legacy", models.NewTextRecord("legacy"), nil},
+		{"dev/token", models.NewTextRecord("dev"), []string{"ci"}},
+	}
+	for _, r := range records {
+		if err := m.AddRecord(r.identifier, r.record, models.Metadata{Tags: r.tags}); err != nil {
+			t.Fatalf("AddRecord(%s) error = %v", r.identifier, err)
+		}
+	}
+
+	dir := t.TempDir()
+
+	//Двоичный файл выгружается только в манифест Kubernetes
+	path := filepath.Join(dir, ".env")
+	result, err := m.ExportSecrets(SecretsSelection{Folder: "prod"}, SecretsDotenv, path, ``)
+	if err != nil {
+		t.Fatalf("ExportSecrets() dotenv error = %v", err)
+	}
+	if !slices.Equal(result.Exported, []string{"prod/db", "prod/token"}) || len(result.Skipped) != 1 {
+		t.Errorf("ExportSecrets() dotenv = %+v, want prod/db, prod/token and skipped prod/key", result)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "PROD_DB_LOGIN='admin'\nPROD_DB_PASSWORD=\"it's\"\nPROD_TOKEN='abc'\n"; string(content) != want {
+		t.Errorf("dotenv file =\n%s\nwant\n%s", content, want)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("dotenv file mode = %v, %v, want 0600", info.Mode().Perm(), err)
+	}
+
+	path = filepath.Join(dir, "secrets.json")
+	result, err = m.ExportSecrets(SecretsSelection{Tag: "ci"}, SecretsJSON, path, ``)
+	if err != nil {
+		t.Fatalf("ExportSecrets() json error = %v", err)
+	}
+	var values map[string]string
+	if content, err = os.ReadFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(content, &values); err != nil || len(values) != 2 || values["PROD_TOKEN"] != "abc" || values["DEV_TOKEN"] != "dev" {
+		t.Errorf("json file = %s, %v", content, err)
+	}
+
+	path = filepath.Join(dir, "secret.yaml")
+	result, err = m.ExportSecrets(SecretsSelection{Identifiers: []string{"prod/key", "missing"}}, SecretsKubernetes, path, "app")
+	if err != nil {
+		t.Fatalf("ExportSecrets() k8s error = %v", err)
+	}
+	if !slices.Equal(result.Exported, []string{"prod/key"}) || !slices.Equal(result.Skipped, []string{"missing: not found"}) {
+		t.Errorf("ExportSecrets() k8s = %+v", result)
+	}
+	if content, err = os.ReadFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(string(content), "data:\n  PROD_KEY: /w==\n") {
+		t.Errorf("k8s file =\n%s", content)
+	}
+
+	if _, err := m.ExportSecrets(SecretsSelection{}, SecretsDotenv, path, ``); err == nil {
+		t.Error("ExportSecrets() without selection error = nil, want error")
+	}
+	if _, err := m.ExportSecrets(SecretsSelection{Folder: "prod"}, SecretsKubernetes, path, "Bad_Name"); err == nil {
+		t.Error("ExportSecrets() bad secret name error = nil, want error")
+	}
+	if _, err := m.ExportSecrets(SecretsSelection{Folder: "stage"}, SecretsDotenv, path, ``); err == nil {
+		t.Error("ExportSecrets() empty selection error = nil, want error")
+	}
+}
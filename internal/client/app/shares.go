@@ -0,0 +1,570 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"github.com/lionslon/go-keepass/internal/crypt"
+	"github.com/lionslon/go-keepass/internal/models"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+const (
+	keysUrl   = "api/keys"
+	sharesUrl = "api/shares"
+
+	sharesPath     = "shares"
+	rekeyPath      = "rekey"
+	acceptPath     = "accept"
+	sharedDataPath = "data"
+)
+
+// errNoKeys у пользователя еще нет пары ключей на сервере
+var errNoKeys = errors.New("user keys are not created")
+
+// SharedEntry данные, полученные от другого пользователя
+type SharedEntry struct {
+	Share    models.Share
+	Record   models.Record
+	Metadata models.Metadata
+	Revision int64 // ревизия данных у владельца, для UpdateShared
+}
+
+// ensureKeys создает пару ключей пользователя, если ее еще нет на сервере. Закрытый ключ шифруется
+// паролем и хранится на сервере, поэтому полученные данные доступны с любого устройства.
+func (m *sender) ensureKeys() error {
+	_, err := m.userKeys()
+	if !errors.Is(err, errNoKeys) {
+		return err
+	}
+
+	publicKey, privateKey, err := crypt.GenerateKeyPair()
+	if err != nil {
+		return err
+	}
+
+	encryptPrivateKey, err := crypt.SymmetricEncrypt(m.password, privateKey)
+	if err != nil {
+		return fmt.Errorf("cannot encrypt private key: %w", err)
+	}
+
+	req := m.client.R().
+		SetHeader("Authorization", m.state.auth()).
+		SetHeader("Content-Type", "application/json").
+		SetBody(models.UserKeys{PublicKey: publicKey, PrivateKey: encryptPrivateKey})
+
+	url := strings.Join([]string{m.cfg.ServerEndpoint, keysUrl}, "/")
+
+	resp, err := req.Put(url)
+	if err != nil {
+		return fmt.Errorf("cannot send set keys request: %w", err)
+	}
+
+	switch code := resp.StatusCode(); code {
+	case http.StatusCreated:
+	case http.StatusConflict:
+		//Ключи одновременно создал другой клиент этого пользователя
+	default:
+		return statusError(code)
+	}
+
+	return nil
+}
+
+// userKeys получает пару ключей пользователя, закрытый ключ остается зашифрованным
+func (m *sender) userKeys() (models.UserKeys, error) {
+	var keys models.UserKeys
+
+	req := m.client.R().
+		SetHeader("Authorization", m.state.auth()).
+		SetResult(&keys)
+
+	url := strings.Join([]string{m.cfg.ServerEndpoint, keysUrl}, "/")
+
+	resp, err := req.Get(url)
+	if err != nil {
+		return keys, fmt.Errorf("cannot send get keys request: %w", err)
+	}
+
+	switch code := resp.StatusCode(); code {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return keys, errNoKeys
+	default:
+		return keys, statusError(code)
+	}
+
+	return keys, nil
+}
+
+// privateKey получает и расшифровывает закрытый ключ пользователя
+func (m *sender) privateKey() ([]byte, error) {
+	keys, err := m.userKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	privateKey, err := crypt.SymmetricDecrypt(m.password, keys.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decrypt private key: %w", err)
+	}
+
+	return privateKey, nil
+}
+
+// publicKey получает открытый ключ другого пользователя
+func (m *sender) publicKey(login string) ([]byte, error) {
+	req := m.client.R().
+		SetHeader("Authorization", m.state.auth())
+
+	url := strings.Join([]string{m.cfg.ServerEndpoint, keysUrl, login}, "/")
+
+	resp, err := req.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("cannot send get public key request: %w", err)
+	}
+
+	switch code := resp.StatusCode(); code {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("user %s not found or has not logged in since sharing appeared", login)
+	default:
+		return nil, statusError(code)
+	}
+
+	return resp.Body(), nil
+}
+
+// unwrapKey расшифровывает ключ переданных данных закрытым ключом пользователя
+func (m *sender) unwrapKey(share models.Share) (string, error) {
+	privateKey, err := m.privateKey()
+	if err != nil {
+		return ``, err
+	}
+
+	return crypt.UnwrapKey(privateKey, share.Key)
+}
+
+// Share передает данные пользователю recipient. Ключ данных шифруется его открытым ключом,
+// поэтому получатель не узнает ни пароль, ни ключи остальных данных. Повторная передача
+// тому же получателю меняет права.
+func (m *sender) Share(identifier, recipient string, permission models.SharePermission) (models.Share, error) {
+	var share models.Share
+
+	if m.state.auth() == `` || m.password == `` {
+		return share, fmt.Errorf("bad auth data, try login")
+	}
+
+	publicKey, err := m.publicKey(recipient)
+	if err != nil {
+		return share, err
+	}
+
+	if err := m.prepareShare(identifier); err != nil {
+		return share, err
+	}
+
+	wrapped, err := crypt.WrapKey(publicKey, m.entryKey(identifier))
+	if err != nil {
+		return share, fmt.Errorf("cannot wrap data key: %w", err)
+	}
+
+	req := m.client.R().
+		SetHeader("Authorization", m.state.auth()).
+		SetHeader("Content-Type", "application/json").
+		SetBody(models.ShareRequest{Recipient: recipient, Key: wrapped, Permission: permission}).
+		SetResult(&share)
+
+	url := m.dataUrl(identifier, sharesPath)
+
+	resp, err := req.Post(url)
+	if err != nil {
+		return share, fmt.Errorf("cannot send share request: %w", err)
+	}
+
+	switch code := resp.StatusCode(); code {
+	case http.StatusCreated:
+	case http.StatusNotFound:
+		return share, fmt.Errorf("data %s not found", identifier)
+	case http.StatusBadRequest:
+		return share, fmt.Errorf("cannot share data %s with %s", identifier, recipient)
+	default:
+		return share, statusError(code)
+	}
+
+	return share, nil
+}
+
+// prepareShare сохраняет текущую ревизию данных, зашифрованную ключом пароля или прежним ключом данных,
+// заново на текущем ключе данных, иначе получатель не сможет ее расшифровать
+func (m *sender) prepareShare(identifier string) error {
+	encryptData, encryptMetadata, err := m.getEncryptedData(identifier)
+	if err != nil {
+		return err
+	}
+
+	key := m.entryKey(identifier)
+
+	if crypt.IsStream(encryptData) {
+		if !crypt.MatchStream(key, encryptData[:min(len(encryptData), crypt.StreamPrefixSize)]) {
+			return m.restreamFile(identifier, encryptData, encryptMetadata)
+		}
+		if _, err := decryptMetadata([]string{key}, encryptMetadata); err == nil {
+			return nil
+		}
+
+		metadata, err := decryptMetadata(m.entryKeys(identifier), encryptMetadata)
+		if err != nil {
+			return err
+		}
+		return m.UpdateMetadata(identifier, metadata)
+	}
+
+	if _, _, err := decryptEntry([]string{key}, encryptData, encryptMetadata); err == nil {
+		return nil
+	}
+
+	record, metadata, err := decryptEntry(m.entryKeys(identifier), encryptData, encryptMetadata)
+	if err != nil {
+		return err
+	}
+
+	return m.UpdateRecord(identifier, record, &metadata)
+}
+
+// restreamFile загружает новую ревизию файла, зашифрованную заново на текущем ключе данных
+func (m *sender) restreamFile(identifier string, encryptData, encryptMetadata []byte) error {
+	key, keys := m.entryKey(identifier), m.entryKeys(identifier)
+
+	encrypter, err := restream(keys, key, encryptData)
+	if err != nil {
+		return err
+	}
+	if encryptMetadata, err = reseal(keys, key, encryptMetadata); err != nil {
+		return err
+	}
+
+	return m.uploadEncrypted(identifier, encrypter, encryptMetadata)
+}
+
+// rekey переводит данные на ключ следующего поколения (см. keyGenerations), которого не знают получатели
+// отозванных передач: сервер запоминает новый исходный идентификатор, текущая ревизия и вложения
+// перешифровываются новым ключом. Прежние ревизии остаются на прежнем ключе, их получатель мог прочитать и до отзыва.
+func (m *sender) rekey(identifier string) error {
+	if pending, conflict := m.state.waiting(identifier); pending || conflict {
+		return fmt.Errorf("data %s has unsent changes or conflicts, sync them first", identifier)
+	}
+
+	//Исходный идентификатор берется с сервера: кэш мог не знать о перемещении или прежней смене ключа
+	if _, _, err := m.getEncryptedData(identifier); err != nil {
+		return err
+	}
+	keyId, err := nextKeyId(m.state.keyId(identifier))
+	if err != nil {
+		return err
+	}
+
+	req := m.client.R().
+		SetHeader("Authorization", m.state.auth()).
+		SetHeader("Content-Type", "application/json").
+		SetBody(models.RekeyRequest{Origin: keyId})
+	m.setIfMatch(req, identifier)
+
+	resp, err := req.Post(m.dataUrl(identifier, rekeyPath))
+	if err != nil {
+		return fmt.Errorf("cannot send rekey data request: %w", err)
+	}
+
+	if resp.StatusCode() == http.StatusPreconditionFailed {
+		return &ConflictError{Identifier: identifier}
+	}
+	if err := dataStatus(identifier, resp.StatusCode(), http.StatusAccepted); err != nil {
+		return err
+	}
+
+	m.state.rekeyed(identifier, keyId)
+	m.saveCache()
+
+	if err := m.prepareShare(identifier); err != nil {
+		return err
+	}
+
+	_, err = m.reencryptAttachments(m.dataUrl(identifier), identifier, m.entryKey(identifier), m.entryKeys(identifier),
+		func(code, expected int) error { return dataStatus(identifier, code, expected) })
+	return err
+}
+
+// ListShares возвращает переданные пользователем и полученные им данные
+func (m *sender) ListShares() (models.ShareList, error) {
+	var list models.ShareList
+
+	if m.state.auth() == `` || m.password == `` {
+		return list, fmt.Errorf("bad auth data, try login")
+	}
+
+	req := m.client.R().
+		SetHeader("Authorization", m.state.auth()).
+		SetResult(&list)
+
+	url := strings.Join([]string{m.cfg.ServerEndpoint, sharesUrl}, "/")
+
+	resp, err := req.Get(url)
+	if err != nil {
+		return list, fmt.Errorf("cannot send list shares request: %w", err)
+	}
+
+	if code := resp.StatusCode(); code != http.StatusOK {
+		return list, statusError(code)
+	}
+
+	return list, nil
+}
+
+// AcceptShare принимает полученные данные. Ключ данных проверяется до принятия.
+func (m *sender) AcceptShare(shareId string) (models.Share, error) {
+	share, _, err := m.receivedKey(shareId)
+	if err != nil {
+		return share, err
+	}
+
+	req := m.client.R().
+		SetHeader("Authorization", m.state.auth())
+
+	url := strings.Join([]string{m.cfg.ServerEndpoint, sharesUrl, shareId, acceptPath}, "/")
+
+	resp, err := req.Post(url)
+	if err != nil {
+		return share, fmt.Errorf("cannot send accept share request: %w", err)
+	}
+
+	switch code := resp.StatusCode(); code {
+	case http.StatusAccepted:
+	case http.StatusNotFound:
+		return share, fmt.Errorf("share %s not found", shareId)
+	default:
+		return share, statusError(code)
+	}
+
+	share.Accepted = true
+	return share, nil
+}
+
+// RevokeShare удаляет передачу: владелец отзывает доступ к данным, получатель отказывается от них.
+// Получатель мог сохранить ключ данных, поэтому при отзыве владельцем данные сначала переводятся на новый ключ
+// (см. rekey), а остальным получателям тех же данных он передается заново. Уже прочитанное получателем
+// остается у него, но новые ревизии он расшифровать не сможет. Если сменить ключ не удалось, передача
+// не удаляется и отзыв можно повторить.
+func (m *sender) RevokeShare(shareId string) error {
+	if m.state.auth() == `` || m.password == `` {
+		return fmt.Errorf("bad auth data, try login")
+	}
+
+	list, err := m.ListShares()
+	if err != nil {
+		return err
+	}
+
+	if i := slices.IndexFunc(list.Outgoing, func(share models.Share) bool { return share.Id == shareId }); i >= 0 {
+		revoked := list.Outgoing[i]
+		if err := m.rekey(revoked.Identifier); err != nil {
+			return fmt.Errorf("cannot change key of %s: %w", revoked.Identifier, err)
+		}
+
+		for _, share := range list.Outgoing {
+			if share.Identifier != revoked.Identifier || share.Id == shareId {
+				continue
+			}
+			if _, err := m.Share(share.Identifier, share.Recipient, share.Permission); err != nil {
+				return fmt.Errorf("cannot pass new key of %s to %s: %w", share.Identifier, share.Recipient, err)
+			}
+		}
+	}
+
+	req := m.client.R().
+		SetHeader("Authorization", m.state.auth())
+
+	url := strings.Join([]string{m.cfg.ServerEndpoint, sharesUrl, shareId}, "/")
+
+	resp, err := req.Delete(url)
+	if err != nil {
+		return fmt.Errorf("cannot send delete share request: %w", err)
+	}
+
+	switch code := resp.StatusCode(); code {
+	case http.StatusAccepted:
+	case http.StatusNotFound:
+		return fmt.Errorf("share %s not found", shareId)
+	default:
+		return statusError(code)
+	}
+
+	return nil
+}
+
+// GetShared получает и расшифровывает принятые данные другого пользователя
+func (m *sender) GetShared(shareId string) (SharedEntry, error) {
+	var entry SharedEntry
+
+	share, key, err := m.receivedKey(shareId)
+	if err != nil {
+		return entry, err
+	}
+	entry.Share = share
+
+	req := m.client.R().
+		SetHeader("Authorization", m.state.auth())
+
+	resp, err := req.Get(m.sharedDataUrl(shareId))
+	if err != nil {
+		return entry, fmt.Errorf("cannot send get shared data request: %w", err)
+	}
+
+	if err := sharedStatus(shareId, resp.StatusCode(), http.StatusOK); err != nil {
+		return entry, err
+	}
+
+	encryptMetadata, err := readMetadata(resp)
+	if err != nil {
+		return entry, err
+	}
+	if crypt.IsStream(resp.Body()) {
+		return entry, fmt.Errorf("data %s is a file, use download_shared", share.Identifier)
+	}
+
+	entry.Record, entry.Metadata, err = decryptEntry([]string{key}, resp.Body(), encryptMetadata)
+	if err != nil {
+		return entry, err
+	}
+
+	entry.Revision, _ = parseRevision(resp)
+	return entry, nil
+}
+
+// DownloadShared сохраняет содержимое принятого файла другого пользователя в path
+func (m *sender) DownloadShared(shareId, path string) error {
+	share, key, err := m.receivedKey(shareId)
+	if err != nil {
+		return err
+	}
+
+	req := m.client.R().
+		SetHeader("Authorization", m.state.auth()).
+		SetDoNotParseResponse(true)
+
+	resp, err := req.Get(m.sharedDataUrl(shareId))
+	if err != nil {
+		return fmt.Errorf("cannot send get shared data request: %w", err)
+	}
+
+	body := resp.RawBody()
+	defer body.Close()
+
+	if err := sharedStatus(shareId, resp.StatusCode(), http.StatusOK); err != nil {
+		return err
+	}
+
+	return saveContent(share.Identifier, []string{key}, body, path)
+}
+
+// UpdateShared сохраняет новую ревизию принятых данных, если владелец разрешил запись.
+// revision - ревизия из GetShared: если данные с тех пор изменились, возвращается ConflictError.
+// Если metadata равно nil, метаданные остаются прежними.
+func (m *sender) UpdateShared(shareId string, revision int64, record models.Record, metadata *models.Metadata) error {
+	share, key, err := m.receivedKey(shareId)
+	if err != nil {
+		return err
+	}
+
+	encryptData, err := sealRecord(key, record)
+	if err != nil {
+		return err
+	}
+
+	req := m.client.R().
+		SetHeader("Authorization", m.state.auth()).
+		SetBody(encryptData)
+	if metadata != nil {
+		encryptMetadata, err := sealMetadata(key, *metadata)
+		if err != nil {
+			return err
+		}
+		setMetadata(req, encryptMetadata)
+	}
+	if revision > 0 {
+		setRevision(req, revision)
+	}
+
+	resp, err := req.Put(m.sharedDataUrl(shareId))
+	if err != nil {
+		return fmt.Errorf("cannot send update shared data request: %w", err)
+	}
+
+	if resp.StatusCode() == http.StatusPreconditionFailed {
+		return &ConflictError{Identifier: share.Identifier}
+	}
+
+	return sharedStatus(shareId, resp.StatusCode(), http.StatusAccepted)
+}
+
+// getShare получает передачу; получателю она приходит с зашифрованным для него ключом данных
+func (m *sender) getShare(shareId string) (models.Share, error) {
+	var share models.Share
+
+	if m.state.auth() == `` || m.password == `` {
+		return share, fmt.Errorf("bad auth data, try login")
+	}
+
+	req := m.client.R().
+		SetHeader("Authorization", m.state.auth()).
+		SetResult(&share)
+
+	url := strings.Join([]string{m.cfg.ServerEndpoint, sharesUrl, shareId}, "/")
+
+	resp, err := req.Get(url)
+	if err != nil {
+		return share, fmt.Errorf("cannot send get share request: %w", err)
+	}
+
+	switch code := resp.StatusCode(); code {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return share, fmt.Errorf("share %s not found", shareId)
+	default:
+		return share, statusError(code)
+	}
+
+	return share, nil
+}
+
+// receivedKey получает передачу и расшифровывает ее ключ данных
+func (m *sender) receivedKey(shareId string) (models.Share, string, error) {
+	share, err := m.getShare(shareId)
+	if err != nil {
+		return share, ``, err
+	}
+	if len(share.Key) == 0 {
+		return share, ``, fmt.Errorf("share %s is not received by you, use your own data directly", shareId)
+	}
+
+	key, err := m.unwrapKey(share)
+	return share, key, err
+}
+
+func (m *sender) sharedDataUrl(shareId string) string {
+	return strings.Join([]string{m.cfg.ServerEndpoint, sharesUrl, shareId, sharedDataPath}, "/")
+}
+
+// sharedStatus ошибка для ответа на запрос переданных данных
+func sharedStatus(shareId string, code, expected int) error {
+	switch code {
+	case expected:
+		return nil
+	case http.StatusForbidden:
+		return fmt.Errorf("share %s is not accepted or is read only", shareId)
+	case http.StatusNotFound:
+		return fmt.Errorf("share %s not found", shareId)
+	default:
+		return statusError(code)
+	}
+}
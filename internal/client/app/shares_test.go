@@ -0,0 +1,219 @@
+package app
+
+import (
+	"bytes"
+	"encoding/base64"
+	"github.com/lionslon/go-keepass/internal/crypt"
+	"github.com/lionslon/go-keepass/internal/models"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// acceptedShare передает данные identifier пользователю recipient, принимает передачу
+// и возвращает ее вместе с ключом данных, который получатель мог сохранить
+func acceptedShare(t *testing.T, owner, recipient *sender, identifier string, permission models.SharePermission) (models.Share, string) {
+	t.Helper()
+
+	share, err := owner.Share(identifier, recipient.state.user(), permission)
+	if err != nil {
+		t.Fatalf("Share() error = %v", err)
+	}
+	if _, err := recipient.AcceptShare(share.Id); err != nil {
+		t.Fatalf("AcceptShare() error = %v", err)
+	}
+	_, key, err := recipient.receivedKey(share.Id)
+	if err != nil {
+		t.Fatalf("receivedKey() error = %v", err)
+	}
+
+	return share, key
+}
+
+func TestRevokeShare(t *testing.T) {
+	endpoint := newTestServer(t)
+
+	owner := newTestUser(t, endpoint, "alice", "password")
+	recipient := newTestUser(t, endpoint, "bob", "password")
+	remaining := newTestUser(t, endpoint, "carol", "password")
+
+	if err := owner.AddRecord("wifi", models.NewTextRecord("secret"), models.Metadata{}); err != nil {
+		t.Fatalf("AddRecord() error = %v", err)
+	}
+
+	share, retained := acceptedShare(t, owner, recipient, "wifi", models.ShareRead)
+	kept, _ := acceptedShare(t, owner, remaining, "wifi", models.ShareWrite)
+
+	entry, err := recipient.GetShared(share.Id)
+	if err != nil {
+		t.Fatalf("GetShared() error = %v", err)
+	}
+	if entry.Record.Text == nil || entry.Record.Text.Text != "secret" {
+		t.Errorf("GetShared() = %+v, want secret", entry.Record)
+	}
+
+	if err := owner.RevokeShare(share.Id); err != nil {
+		t.Fatalf("RevokeShare() error = %v", err)
+	}
+
+	if _, err := recipient.GetShared(share.Id); err == nil {
+		t.Error("GetShared() after revoke error = nil, want error")
+	}
+	if list, err := recipient.ListShares(); err != nil || len(list.Incoming) != 0 {
+		t.Errorf("ListShares() after revoke = %+v, %v, want no incoming shares", list.Incoming, err)
+	}
+	if err := owner.RevokeShare(share.Id); err == nil {
+		t.Error("RevokeShare() again error = nil, want error")
+	}
+
+	//Ключ, сохраненный получателем, не подходит к ревизиям после отзыва
+	if err := owner.UpdateRecord("wifi", models.NewTextRecord("new secret"), nil); err != nil {
+		t.Fatalf("UpdateRecord() error = %v", err)
+	}
+	current, err := owner.fetchData("wifi")
+	if err != nil {
+		t.Fatalf("fetchData() error = %v", err)
+	}
+	if _, _, err := decryptEntry([]string{retained}, current.Data, current.Info.Metadata); err == nil {
+		t.Error("revoked recipient decrypted a revision made after revocation")
+	}
+	for _, revision := range []int64{2, 3} {
+		encryptData, _, err := owner.getEncryptedRevision("wifi", revision)
+		if err != nil {
+			t.Fatalf("getEncryptedRevision(%d) error = %v", revision, err)
+		}
+		if _, err := crypt.SymmetricDecrypt(retained, encryptData); err == nil {
+			t.Errorf("revoked recipient decrypted revision %d", revision)
+		}
+	}
+
+	//Владелец читает и новые, и прежние ревизии
+	checkText(t, "owner", owner, "wifi", "new secret")
+	if _, err := owner.GetDataRevision("wifi", 1); err != nil {
+		t.Errorf("GetDataRevision() before revocation error = %v", err)
+	}
+	other := newTestSender(t, endpoint)
+	if err := other.Login("alice", "password"); err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+	checkText(t, "other device", other, "wifi", "new secret")
+
+	//Оставшийся получатель получил новый ключ и может сохранять ревизии
+	entry, err = remaining.GetShared(kept.Id)
+	if err != nil {
+		t.Fatalf("GetShared() remaining error = %v", err)
+	}
+	if entry.Record.Text == nil || entry.Record.Text.Text != "new secret" {
+		t.Errorf("GetShared() remaining = %+v, want new secret", entry.Record)
+	}
+	if err := remaining.UpdateShared(kept.Id, entry.Revision, models.NewTextRecord("from carol"), nil); err != nil {
+		t.Fatalf("UpdateShared() error = %v", err)
+	}
+	checkText(t, "owner", owner, "wifi", "from carol")
+}
+
+func TestRevokeShareFile(t *testing.T) {
+	endpoint := newTestServer(t)
+
+	owner := newTestUser(t, endpoint, "alice", "password")
+	recipient := newTestUser(t, endpoint, "bob", "password")
+
+	dir := t.TempDir()
+	content := bytes.Repeat([]byte("report line\n"), 5000)
+	path := filepath.Join(dir, "report.txt")
+	if err := os.WriteFile(path, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := owner.UploadFile("files/report", path, models.Metadata{}); err != nil {
+		t.Fatalf("UploadFile() error = %v", err)
+	}
+	if _, err := owner.Attach("files/report", path, "copy.txt"); err != nil {
+		t.Fatalf("Attach() error = %v", err)
+	}
+
+	share, retained := acceptedShare(t, owner, recipient, "files/report", models.ShareRead)
+
+	if err := owner.RevokeShare(share.Id); err != nil {
+		t.Fatalf("RevokeShare() error = %v", err)
+	}
+
+	//Файл и ключ вложения перешифрованы новым ключом
+	current, err := owner.fetchData("files/report")
+	if err != nil {
+		t.Fatalf("fetchData() error = %v", err)
+	}
+	if crypt.MatchStream(retained, current.Data[:min(len(current.Data), crypt.StreamPrefixSize)]) {
+		t.Error("revoked recipient key matches the file after revocation")
+	}
+	if current.Info.Origin != "files/report#1" {
+		t.Errorf("origin after revocation = %q, want files/report#1", current.Info.Origin)
+	}
+	resp, err := owner.client.R().
+		SetHeader("Authorization", owner.state.auth()).
+		Get(owner.attachmentUrl("files/report", "copy.txt"))
+	if err != nil {
+		t.Fatalf("get attachment error = %v", err)
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(resp.Header().Get(attachmentKeyHeader))
+	if err != nil {
+		t.Fatalf("bad attachment key header: %v", err)
+	}
+	if _, err := crypt.SymmetricDecrypt(retained, wrapped); err == nil {
+		t.Error("revoked recipient key decrypts the attachment key after revocation")
+	}
+
+	for name, save := range map[string]func(path string) error{
+		"file":       func(path string) error { return owner.DownloadFile("files/report", path) },
+		"attachment": func(path string) error { return owner.SaveAttachment("files/report", "copy.txt", path) },
+	} {
+		saved := filepath.Join(dir, name)
+		if err := save(saved); err != nil {
+			t.Fatalf("save %s error = %v", name, err)
+		}
+		if got, err := os.ReadFile(saved); err != nil || !bytes.Equal(got, content) {
+			t.Errorf("saved %s = %d bytes, %v, want %d bytes", name, len(got), err, len(content))
+		}
+	}
+
+	//Повторная передача использует новый ключ
+	share, key := acceptedShare(t, owner, recipient, "files/report", models.ShareRead)
+	if key == retained {
+		t.Error("share after revocation passes the revoked key")
+	}
+	saved := filepath.Join(dir, "shared")
+	if err := recipient.DownloadShared(share.Id, saved); err != nil {
+		t.Fatalf("DownloadShared() error = %v", err)
+	}
+}
+
+func TestKeyGenerations(t *testing.T) {
+	tests := []struct {
+		keyId string
+		want  []string
+		next  string
+	}{
+		{"vpn", []string{"vpn"}, "vpn#1"},
+		{"vpn#1", []string{"vpn#1", "vpn"}, "vpn#2"},
+		{"work/vpn#3", []string{"work/vpn#3", "work/vpn#2", "work/vpn#1", "work/vpn"}, "work/vpn#4"},
+		//Идентификаторы с #, не похожие на номер поколения, остаются как есть
+		{"notes#draft", []string{"notes#draft"}, "notes#draft#1"},
+		{"notes#01", []string{"notes#01"}, "notes#01#1"},
+		{"notes#0", []string{"notes#0"}, "notes#0#1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.keyId, func(t *testing.T) {
+			if got := keyGenerations(tt.keyId); !slices.Equal(got, tt.want) {
+				t.Errorf("keyGenerations() = %v, want %v", got, tt.want)
+			}
+			if got, err := nextKeyId(tt.keyId); err != nil || got != tt.next {
+				t.Errorf("nextKeyId() = %q, %v, want %q", got, err, tt.next)
+			}
+		})
+	}
+
+	if _, err := nextKeyId("vpn#100"); err == nil {
+		t.Error("nextKeyId() after last generation error = nil, want error")
+	}
+}
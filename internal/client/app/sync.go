@@ -0,0 +1,59 @@
+package app
+
+import (
+	"fmt"
+	"github.com/lionslon/go-keepass/internal/models"
+)
+
+const (
+	syncUrl = "api/sync"
+)
+
+// Changes изменения данных после курсора синхронизации с расшифрованными метаданными
+type Changes struct {
+	Cursor  int64       // курсор для следующего запроса
+	Reset   bool        // Created содержит все данные, остальные удалены
+	Created []EntryInfo // созданные данные
+	Updated []EntryInfo // измененные данные
+	Deleted []string    // идентификаторы удаленных данных
+}
+
+// Changes запрашивает изменения данных после курсора since, 0 - все данные
+func (m *sender) Changes(since int64) (Changes, error) {
+	var changes Changes
+
+	if m.state.auth() == `` || m.password == `` {
+		return changes, fmt.Errorf("bad auth data, try login")
+	}
+
+	sync, err := m.fetchChanges(since)
+	if err != nil {
+		return changes, err
+	}
+
+	changes.Cursor = sync.Cursor
+	changes.Reset = sync.Reset
+	changes.Deleted = sync.Deleted
+
+	if changes.Created, err = m.decryptInfos(sync.Created); err != nil {
+		return changes, err
+	}
+	if changes.Updated, err = m.decryptInfos(sync.Updated); err != nil {
+		return changes, err
+	}
+
+	return changes, nil
+}
+
+// decryptInfos расшифровывает метаданные описаний данных
+func (m *sender) decryptInfos(items []models.DataInfo) ([]EntryInfo, error) {
+	entries := make([]EntryInfo, 0, len(items))
+	for _, item := range items {
+		metadata, err := decryptMetadata(m.dataKeys(item.KeyId(), item.Identifier), item.Metadata)
+		if err != nil {
+			return nil, fmt.Errorf("data %s: %w", item.Identifier, err)
+		}
+		entries = append(entries, EntryInfo{DataInfo: item, Meta: metadata})
+	}
+	return entries, nil
+}
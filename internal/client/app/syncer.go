@@ -0,0 +1,736 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/lionslon/go-keepass/internal/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// syncState состояние, общее для команд пользователя и фоновой синхронизации
+type syncState struct {
+	op sync.Mutex // упорядочивает отправку изменений и проходы синхронизации
+	mu sync.Mutex // защищает поля ниже
+
+	login     string                 // пользователь, к которому относится состояние
+	token     string                 // актуальный jwt токен, пустой после входа без связи с сервером
+	revisions map[string]int64       // последние полученные клиентом ревизии данных (по ETag), для If-Match
+	entries   map[string]*cacheEntry // локальная копия данных на сервере по последней синхронизации
+	cursor    int64                  // курсор синхронизации, 0 - синхронизации еще не было
+	pending   []edit                 // неотправленные изменения в порядке выполнения, не больше одного на данные
+	conflicts []conflict             // изменения, отклоненные из-за конфликта
+	notices   []string               // сообщения для пользователя о событиях синхронизации
+	started   bool                   // фоновая синхронизация запущена
+	offline   bool                   // последний запрос не смог связаться с сервером
+	dirty     bool                   // состояние изменилось после сохранения локального кэша
+	cacheKey  *cacheKey              // ключ локального кэша из пароля, nil - будет выведен при сохранении
+	lastSync  time.Time              // время последнего успешного прохода
+	lastErr   error                  // ошибка последнего прохода
+}
+
+// SyncStatus состояние фоновой синхронизации
+type SyncStatus struct {
+	User      string    // вошедший пользователь, пустой - вход не выполнен
+	Enabled   bool      // фоновая синхронизация запущена
+	Online    bool      // последний запрос связался с сервером
+	LastSync  time.Time // время последнего успешного прохода, нулевое - не было
+	Cursor    int64     // курсор синхронизации
+	Cached    int       // данные в локальном кэше
+	Pending   int       // неотправленные изменения
+	Conflicts int       // неразрешенные конфликты
+	Error     string    // ошибка последнего прохода
+}
+
+func newSyncState() *syncState {
+	return &syncState{
+		revisions: make(map[string]int64),
+		entries:   make(map[string]*cacheEntry),
+	}
+}
+
+// StartSync запускает фоновую синхронизацию с интервалом cfg.PollInterval секунд.
+// Повторный вызов ничего не делает, интервал 0 отключает фоновую синхронизацию.
+func (m *sender) StartSync(ctx context.Context) {
+	if m.cfg.PollInterval <= 0 {
+		return
+	}
+
+	m.state.mu.Lock()
+	defer m.state.mu.Unlock()
+
+	if m.state.started {
+		return
+	}
+	m.state.started = true
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(m.cfg.PollInterval) * time.Second)
+		defer ticker.Stop()
+
+		for {
+			//Ошибки прохода сохраняются в состоянии и сообщаются пользователю через Notices
+			m.Sync()
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Sync выполняет проход синхронизации: получает изменения с сервера в локальный кэш,
+// находит конфликты с ожидающими изменениями и отправляет остальные изменения из очереди
+func (m *sender) Sync() error {
+	m.state.op.Lock()
+	defer m.state.op.Unlock()
+
+	if m.password == `` {
+		return fmt.Errorf("bad auth data, try login")
+	}
+
+	loggedIn := m.state.auth() != ``
+	err := m.syncPass()
+	//Токен истек: пароль известен, поэтому вход выполняется заново, а синхронизация
+	//приостанавливается, только если не удался сам вход
+	if errors.Is(err, ErrUnauthorized) && loggedIn {
+		m.state.setToken(``)
+		err = m.syncPass()
+	}
+
+	m.state.finish(err)
+	m.saveCache()
+
+	return err
+}
+
+// SyncStatus возвращает состояние фоновой синхронизации
+func (m *sender) SyncStatus() SyncStatus {
+	s := m.state
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := SyncStatus{
+		User:      s.login,
+		Enabled:   s.started,
+		Online:    !s.offline,
+		LastSync:  s.lastSync,
+		Cursor:    s.cursor,
+		Cached:    len(s.entries),
+		Pending:   len(s.pending),
+		Conflicts: len(s.conflicts),
+	}
+	if s.lastErr != nil {
+		status.Error = s.lastErr.Error()
+	}
+
+	return status
+}
+
+// Notices возвращает и очищает накопленные сообщения синхронизации
+func (m *sender) Notices() []string {
+	m.state.mu.Lock()
+	defer m.state.mu.Unlock()
+
+	notices := m.state.notices
+	m.state.notices = nil
+
+	return notices
+}
+
+// syncPass получает токен при необходимости, изменения с сервера и отправляет очередь
+func (m *sender) syncPass() error {
+	err := m.relogin()
+	if err == nil {
+		err = m.pull()
+	}
+	if err == nil {
+		err = m.push()
+	}
+	return err
+}
+
+// relogin получает токен, если пользователь вошел без связи с сервером или токен истек
+func (m *sender) relogin() error {
+	if m.state.auth() != `` {
+		return nil
+	}
+
+	encryptAuthData, err := m.createEncryptUserAuthData(m.state.user(), m.password)
+	if err != nil {
+		return fmt.Errorf("cannot create encrypt user auth data: %w", err)
+	}
+
+	url := strings.Join([]string{m.cfg.ServerEndpoint, loginUrl}, "/")
+
+	resp, err := m.client.R().SetBody(encryptAuthData).Post(url)
+	if err != nil {
+		return fmt.Errorf("cannot send login request: %w: %w", ErrUnavailable, err)
+	}
+
+	if code := resp.StatusCode(); code != http.StatusOK {
+		return statusError(code)
+	}
+
+	return m.parseAuthorization(resp)
+}
+
+// pull получает изменения после курсора, сверяет с ними очередь и загружает содержимое изменившихся данных в кэш
+func (m *sender) pull() error {
+	m.state.mu.Lock()
+	cursor := m.state.cursor
+	m.state.mu.Unlock()
+
+	changes, err := m.fetchChanges(cursor)
+	if err != nil {
+		return err
+	}
+
+	m.state.merge(changes)
+
+	for _, identifier := range m.state.missing() {
+		entry, err := m.fetchData(identifier)
+		if err != nil {
+			return err
+		}
+		//Данные удалили после получения изменений, удаление придет следующим проходом
+		if entry != nil {
+			m.state.store(entry)
+		}
+	}
+
+	return nil
+}
+
+// push отправляет изменения из очереди по порядку, пока сервер доступен
+func (m *sender) push() error {
+	for {
+		e, ok := m.state.next()
+		if !ok {
+			return nil
+		}
+
+		revision, err := m.sendEdit(e)
+		if errors.Is(err, ErrUnavailable) || errors.Is(err, ErrUnauthorized) {
+			return err
+		}
+
+		m.state.sent(e, revision, err)
+	}
+}
+
+// fetchChanges запрашивает изменения данных после курсора since
+func (m *sender) fetchChanges(since int64) (models.SyncChanges, error) {
+	var changes models.SyncChanges
+
+	req := m.client.R().
+		SetHeader("Authorization", m.state.auth()).
+		SetQueryParam("since", strconv.FormatInt(since, 10)).
+		SetResult(&changes)
+
+	url := strings.Join([]string{m.cfg.ServerEndpoint, syncUrl}, "/")
+
+	resp, err := req.Get(url)
+	if err != nil {
+		return changes, fmt.Errorf("cannot send sync request: %w: %w", ErrUnavailable, err)
+	}
+
+	if code := resp.StatusCode(); code != http.StatusOK {
+		return changes, statusError(code)
+	}
+
+	return changes, nil
+}
+
+// auth возвращает актуальный jwt токен
+func (s *syncState) auth() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.token
+}
+
+// user возвращает вошедшего пользователя
+func (s *syncState) user() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.login
+}
+
+func (s *syncState) setToken(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.token = token
+}
+
+// open переключает состояние на пользователя login и заполняет его из локального кэша, cache nil - кэша нет.
+// Повторный вход того же пользователя состояние не меняет.
+func (s *syncState) open(login string, cache *cacheFile) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.login == login {
+		return
+	}
+
+	s.login = login
+	s.revisions = make(map[string]int64)
+	s.entries = make(map[string]*cacheEntry)
+	s.cursor = 0
+	s.pending = nil
+	s.conflicts = nil
+	s.dirty = false
+	s.cacheKey = nil
+
+	if cache == nil {
+		return
+	}
+
+	s.cacheKey = cache.key
+	s.cursor = cache.Cursor
+	s.pending = cache.Pending
+	s.conflicts = cache.Conflicts
+	for identifier, revision := range cache.Revisions {
+		s.revisions[identifier] = revision
+	}
+	for identifier, entry := range cache.Entries {
+		s.entries[identifier] = entry
+	}
+
+	if n := len(s.pending) + len(s.conflicts); n > 0 {
+		s.notify("%d unsent changes restored from local cache", n)
+	}
+}
+
+// revision возвращает последнюю полученную клиентом ревизию данных
+func (s *syncState) revision(identifier string) (int64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	revision, ok := s.revisions[identifier]
+	return revision, ok
+}
+
+// seen запоминает ревизию данных, полученных с сервера
+func (s *syncState) seen(identifier string, revision int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.revisions[identifier] = revision
+	s.dirty = true
+}
+
+// saved запоминает ревизию данных, сохраненных этим клиентом в обход очереди (загрузки, корзина).
+// Содержимое в кэше устарело и загрузится следующим проходом синхронизации.
+func (s *syncState) saved(identifier, origin string, revision int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.revisions[identifier] = revision
+	s.entries[identifier] = &cacheEntry{Info: models.DataInfo{Identifier: identifier, Origin: origin, Revision: revision}}
+	s.dirty = true
+}
+
+// origin возвращает исходный идентификатор перемещенных данных из кэша, пустой - данные
+// не перемещались или неизвестны клиенту
+func (s *syncState) origin(identifier string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry, ok := s.entries[identifier]; ok {
+		return entry.Info.Origin
+	}
+	return ``
+}
+
+// keyId исходный идентификатор данных, от которого получен их ключ (см. models.DataInfo.KeyId)
+func (s *syncState) keyId(identifier string) string {
+	if origin := s.origin(identifier); origin != `` {
+		return origin
+	}
+	return identifier
+}
+
+// moved переносит данные в кэше под новый идентификатор после перемещения на сервере
+func (s *syncState) moved(from, to string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if revision, ok := s.revisions[from]; ok {
+		s.revisions[to] = revision
+		delete(s.revisions, from)
+	}
+
+	if entry, ok := s.entries[from]; ok {
+		moved := *entry
+		moved.Info.Identifier = to
+		//Данные, вернувшиеся под исходный идентификатор, снова его не хранят, как на сервере
+		moved.Info.Origin = entry.Info.KeyId()
+		if moved.Info.Origin == to {
+			moved.Info.Origin = ``
+		}
+		s.entries[to] = &moved
+		delete(s.entries, from)
+	}
+
+	s.dirty = true
+}
+
+// rekeyed запоминает новый исходный идентификатор данных после смены ключа на сервере
+func (s *syncState) rekeyed(identifier, origin string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[identifier]
+	if !ok {
+		entry = &cacheEntry{Info: models.DataInfo{Identifier: identifier}}
+		s.entries[identifier] = entry
+	}
+	entry.Info.Origin = origin
+	s.dirty = true
+}
+
+// movedFolder переносит в кэше данные папки from в папку to после перемещения на сервере
+func (s *syncState) movedFolder(from, to string) {
+	for _, identifier := range s.folderEntries(from) {
+		s.moved(identifier, models.MovePath(identifier, from, to))
+	}
+}
+
+// deletedFolder убирает из кэша данные папки после ее удаления на сервере
+func (s *syncState) deletedFolder(folder string) {
+	for _, identifier := range s.folderEntries(folder) {
+		s.applied(edit{Identifier: identifier, Kind: editDelete}, 0)
+	}
+}
+
+// folderEntries идентификаторы данных папки и ее вложенных папок, известные клиенту
+func (s *syncState) folderEntries(folder string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var identifiers []string
+	for identifier := range s.entries {
+		if models.InFolder(identifier, folder) {
+			identifiers = append(identifiers, identifier)
+		}
+	}
+	return identifiers
+}
+
+// fetched запоминает полученные с сервера данные
+func (s *syncState) fetched(entry *cacheEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.revisions[entry.Info.Identifier] = entry.Info.Revision
+	s.put(entry)
+}
+
+// store сохраняет в кэше загруженное содержимое данных
+func (s *syncState) store(entry *cacheEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.put(entry)
+}
+
+func (s *syncState) put(entry *cacheEntry) {
+	cached := *entry
+	if prev, ok := s.entries[entry.Info.Identifier]; ok {
+		//Время создания и изменения известно только из синхронизации
+		cached.Info.CreatedAt, cached.Info.UpdatedAt = prev.Info.CreatedAt, prev.Info.UpdatedAt
+	}
+	if cached.Info.Size > cacheDataLimit {
+		cached.Data = nil
+	}
+
+	s.entries[entry.Info.Identifier] = &cached
+	s.dirty = true
+}
+
+// applied запоминает результат изменения, принятого сервером
+func (s *syncState) applied(e edit, revision int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.apply(e, revision)
+}
+
+func (s *syncState) apply(e edit, revision int64) {
+	s.dirty = true
+
+	if e.Kind == editDelete {
+		delete(s.revisions, e.Identifier)
+		delete(s.entries, e.Identifier)
+		return
+	}
+
+	s.revisions[e.Identifier] = revision
+
+	now := time.Now().UTC()
+	entry := &cacheEntry{Info: models.DataInfo{Identifier: e.Identifier, CreatedAt: now}}
+	if prev, ok := s.entries[e.Identifier]; ok && e.Kind != editAdd {
+		copied := *prev
+		entry = &copied
+	}
+
+	entry.Info.Revision = revision
+	entry.Info.UpdatedAt = now
+	if e.Kind != editMetadata {
+		entry.Data = e.Data
+		entry.Info.Size = int64(len(e.Data))
+	}
+	if e.Metadata != nil {
+		entry.Info.Metadata = e.Metadata
+	}
+	if entry.Info.Size > cacheDataLimit {
+		entry.Data = nil
+	}
+
+	s.entries[e.Identifier] = entry
+}
+
+// waiting сообщает, есть ли у данных неотправленное изменение или неразрешенный конфликт
+func (s *syncState) waiting(identifier string) (bool, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, c := range s.conflicts {
+		if c.Identifier == identifier {
+			return false, true
+		}
+	}
+
+	for _, e := range s.pending {
+		if e.Identifier == identifier {
+			return true, false
+		}
+	}
+
+	return false, false
+}
+
+// waitingFolder сообщает, есть ли у данных папки неотправленные изменения или неразрешенные конфликты
+func (s *syncState) waitingFolder(folder string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, c := range s.conflicts {
+		if models.InFolder(c.Identifier, folder) {
+			return true
+		}
+	}
+
+	for _, e := range s.pending {
+		if models.InFolder(e.Identifier, folder) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// queue ставит изменение в очередь, объединяя его с ожидающим изменением тех же данных
+func (s *syncState) queue(e edit) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, prev := range s.pending {
+		if prev.Identifier != e.Identifier {
+			continue
+		}
+
+		merged, keep, err := mergeEdits(prev, e)
+		if err != nil {
+			return err
+		}
+
+		if keep {
+			s.pending[i] = merged
+		} else {
+			s.pending = append(s.pending[:i], s.pending[i+1:]...)
+		}
+		s.dirty = true
+
+		return nil
+	}
+
+	s.pending = append(s.pending, e)
+	s.dirty = true
+
+	return nil
+}
+
+// next возвращает первое изменение очереди
+func (s *syncState) next() (edit, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.pending) == 0 {
+		return edit{}, false
+	}
+
+	return s.pending[0], true
+}
+
+// sent убирает из очереди первое изменение после его отправки
+func (s *syncState) sent(e edit, revision int64, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pending = s.pending[1:]
+	s.dirty = true
+
+	if conflict := new(ConflictError); errors.As(err, &conflict) {
+		s.addConflict(e)
+		return
+	}
+
+	//Изменение, которое сервер отклонил не из-за недоступности, повторная отправка не исправит
+	if err != nil {
+		s.notify("queued %s of data %s is rejected by server: %s", e.Kind, e.Identifier, err)
+		return
+	}
+
+	s.apply(e, revision)
+	s.notify("queued %s of data %s is sent", e.Kind, e.Identifier)
+}
+
+// merge применяет изменения с сервера к кэшу и сверяет с ними очередь.
+// Ревизии, полученные клиентом, не меняются: изменение поверх невиданной пользователем ревизии должно стать конфликтом.
+func (s *syncState) merge(changes models.SyncChanges) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.dirty = true
+
+	//При первой синхронизации и после сброса курсора список полный, о нем не сообщаем
+	report := s.cursor > 0 && !changes.Reset
+
+	entries := s.entries
+	if changes.Reset {
+		s.entries = make(map[string]*cacheEntry)
+	}
+
+	for _, info := range changes.Created {
+		if prev, ok := entries[info.Identifier]; report && (!ok || prev.Info.Revision != info.Revision) {
+			s.notify("data %s created on server", info.Identifier)
+		}
+		s.update(entries[info.Identifier], info)
+	}
+
+	for _, info := range changes.Updated {
+		if prev, ok := entries[info.Identifier]; report && (!ok || prev.Info.Revision != info.Revision) {
+			s.notify("data %s changed on server, revision %d", info.Identifier, info.Revision)
+		}
+		s.update(entries[info.Identifier], info)
+	}
+
+	for _, identifier := range changes.Deleted {
+		if _, ok := s.entries[identifier]; report && ok {
+			s.notify("data %s deleted on server", identifier)
+		}
+		delete(s.entries, identifier)
+	}
+
+	s.cursor = changes.Cursor
+
+	//Изменения, сделанные поверх устаревшей ревизии, не отправляем, а сразу отдаем на разрешение
+	pending := s.pending[:0]
+	for _, e := range s.pending {
+		entry, exists := s.entries[e.Identifier]
+
+		switch {
+		case e.Kind == editDelete && !exists:
+			//Данные удалены и локально, и на сервере - конфликта нет
+			delete(s.revisions, e.Identifier)
+		case e.Kind == editAdd && exists, e.Kind != editAdd && e.Base > 0 && (!exists || entry.Info.Revision != e.Base):
+			s.addConflict(e)
+		default:
+			pending = append(pending, e)
+		}
+	}
+	s.pending = pending
+}
+
+// update записывает в кэш описание данных с сервера, содержимое сохраняется, если ревизия не изменилась
+func (s *syncState) update(prev *cacheEntry, info models.DataInfo) {
+	entry := &cacheEntry{Info: info}
+	if prev != nil && prev.Info.Revision == info.Revision {
+		entry.Data = prev.Data
+	}
+	s.entries[info.Identifier] = entry
+}
+
+// missing возвращает идентификаторы данных, содержимое которых нужно загрузить в кэш
+func (s *syncState) missing() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var identifiers []string
+	for identifier, entry := range s.entries {
+		if entry.Data == nil && entry.Info.Size <= cacheDataLimit {
+			identifiers = append(identifiers, identifier)
+		}
+	}
+
+	return identifiers
+}
+
+// reachable запоминает, удалось ли связаться с сервером
+func (s *syncState) reachable(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.setOffline(errors.Is(err, ErrUnavailable))
+}
+
+// setOffline меняет признак работы без связи с сервером и сообщает о его смене, вызывается под s.mu
+func (s *syncState) setOffline(offline bool) {
+	if offline && !s.offline {
+		s.notify("server is unavailable, working offline with local cache")
+	} else if !offline && s.offline {
+		s.notify("server is available again")
+	}
+	s.offline = offline
+}
+
+// finish запоминает результат прохода синхронизации
+func (s *syncState) finish(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.setOffline(errors.Is(err, ErrUnavailable))
+
+	if errors.Is(err, ErrUnauthorized) && !errors.Is(s.lastErr, ErrUnauthorized) {
+		s.notify("background sync is paused: %s", err)
+	}
+
+	s.lastErr = err
+	if err == nil {
+		s.lastSync = time.Now()
+	}
+}
+
+// warn добавляет сообщение для пользователя
+func (s *syncState) warn(format string, args ...any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.notify(format, args...)
+}
+
+// notify добавляет сообщение для пользователя, вызывается под s.mu
+func (s *syncState) notify(format string, args ...any) {
+	s.notices = append(s.notices, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,70 @@
+package app
+
+import (
+	"errors"
+	"github.com/lionslon/go-keepass/internal/models"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// pausedNotice проверяет, есть ли среди сообщений сообщение о приостановке синхронизации
+func pausedNotice(notices []string) bool {
+	return slices.ContainsFunc(notices, func(notice string) bool {
+		return strings.Contains(notice, "background sync is paused")
+	})
+}
+
+func TestSyncRenewsExpiredToken(t *testing.T) {
+	endpoint := newTestServer(t)
+
+	m := newTestUser(t, endpoint, "alice", "password")
+	if err := m.AddRecord("notes/plan", models.NewTextRecord("v1"), models.Metadata{}); err != nil {
+		t.Fatalf("AddRecord() error = %v", err)
+	}
+
+	//Токен, который сервер больше не принимает, как после истечения срока
+	m.state.setToken("expired")
+
+	if err := m.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if token := m.state.auth(); token == `` || token == "expired" {
+		t.Errorf("token after Sync() = %q, want new token", token)
+	}
+	if status := m.SyncStatus(); status.Error != `` || status.LastSync.IsZero() {
+		t.Errorf("SyncStatus() = %+v, want successful sync", status)
+	}
+	if notices := m.Notices(); pausedNotice(notices) {
+		t.Errorf("Notices() = %v, want sync not paused", notices)
+	}
+
+	//Обычные запросы снова работают с новым токеном
+	if err := m.UpdateRecord("notes/plan", models.NewTextRecord("v2"), nil); err != nil {
+		t.Errorf("UpdateRecord() error = %v", err)
+	}
+}
+
+func TestSyncPausedWhenLoginFails(t *testing.T) {
+	endpoint := newTestServer(t)
+
+	m := newTestUser(t, endpoint, "alice", "password")
+	m.state.setToken("expired")
+	//Пароль сменили на другом устройстве, вход со старым не удается
+	m.password = "changed"
+
+	if err := m.Sync(); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("Sync() error = %v, want %v", err, ErrUnauthorized)
+	}
+	if notices := m.Notices(); !pausedNotice(notices) {
+		t.Errorf("Notices() = %v, want sync paused", notices)
+	}
+
+	//О приостановке сообщается один раз
+	if err := m.Sync(); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("Sync() again error = %v, want %v", err, ErrUnauthorized)
+	}
+	if notices := m.Notices(); pausedNotice(notices) {
+		t.Errorf("Notices() = %v, want no repeated notice", notices)
+	}
+}
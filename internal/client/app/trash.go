@@ -0,0 +1,138 @@
+package app
+
+import (
+	"fmt"
+	"github.com/lionslon/go-keepass/internal/models"
+	"net/http"
+	"strings"
+)
+
+const (
+	trashUrl = "api/trash"
+
+	restorePath = "restore"
+)
+
+// TrashEntry описание данных в корзине с расшифрованными метаданными
+type TrashEntry struct {
+	models.TrashItem
+	Meta models.Metadata
+}
+
+// ListTrash возвращает содержимое корзины, последние удаленные данные первыми
+func (m *sender) ListTrash() ([]TrashEntry, error) {
+	if m.state.auth() == `` || m.password == `` {
+		return nil, fmt.Errorf("bad auth data, try login")
+	}
+
+	var items []models.TrashItem
+
+	req := m.client.R().
+		SetHeader("Authorization", m.state.auth()).
+		SetResult(&items)
+
+	url := strings.Join([]string{m.cfg.ServerEndpoint, trashUrl}, "/")
+
+	resp, err := req.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("cannot send list trash request: %w", err)
+	}
+
+	if code := resp.StatusCode(); code != http.StatusOK {
+		return nil, statusError(code)
+	}
+
+	entries := make([]TrashEntry, 0, len(items))
+	for _, item := range items {
+		metadata, err := decryptMetadata(m.dataKeys(item.KeyId(), item.Identifier), item.Metadata)
+		if err != nil {
+			return nil, fmt.Errorf("data %s: %w", item.Identifier, err)
+		}
+		entries = append(entries, TrashEntry{TrashItem: item, Meta: metadata})
+	}
+
+	return entries, nil
+}
+
+// RestoreTrash возвращает данные из корзины под прежним идентификатором
+func (m *sender) RestoreTrash(trashId string) (models.TrashItem, error) {
+	var item models.TrashItem
+
+	if m.state.auth() == `` || m.password == `` {
+		return item, fmt.Errorf("bad auth data, try login")
+	}
+
+	req := m.client.R().
+		SetHeader("Authorization", m.state.auth()).
+		SetResult(&item)
+
+	url := strings.Join([]string{m.cfg.ServerEndpoint, trashUrl, trashId, restorePath}, "/")
+
+	resp, err := req.Post(url)
+	if err != nil {
+		return item, fmt.Errorf("cannot send restore trash request: %w", err)
+	}
+
+	switch code := resp.StatusCode(); code {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return item, fmt.Errorf("trash item %s not found", trashId)
+	case http.StatusConflict:
+		return item, fmt.Errorf("data with the same identifier already exists, delete it before restore")
+	default:
+		return item, statusError(code)
+	}
+
+	m.rememberSaved(item.Identifier, item.Origin, resp)
+
+	return item, nil
+}
+
+// DeleteTrash окончательно удаляет данные из корзины
+func (m *sender) DeleteTrash(trashId string) error {
+	if m.state.auth() == `` || m.password == `` {
+		return fmt.Errorf("bad auth data, try login")
+	}
+
+	req := m.client.R().
+		SetHeader("Authorization", m.state.auth())
+
+	url := strings.Join([]string{m.cfg.ServerEndpoint, trashUrl, trashId}, "/")
+
+	resp, err := req.Delete(url)
+	if err != nil {
+		return fmt.Errorf("cannot send delete trash request: %w", err)
+	}
+
+	switch code := resp.StatusCode(); code {
+	case http.StatusNoContent:
+		return nil
+	case http.StatusNotFound:
+		return fmt.Errorf("trash item %s not found", trashId)
+	default:
+		return statusError(code)
+	}
+}
+
+// EmptyTrash окончательно удаляет все данные из корзины
+func (m *sender) EmptyTrash() error {
+	if m.state.auth() == `` || m.password == `` {
+		return fmt.Errorf("bad auth data, try login")
+	}
+
+	req := m.client.R().
+		SetHeader("Authorization", m.state.auth())
+
+	url := strings.Join([]string{m.cfg.ServerEndpoint, trashUrl}, "/")
+
+	resp, err := req.Delete(url)
+	if err != nil {
+		return fmt.Errorf("cannot send empty trash request: %w", err)
+	}
+
+	if code := resp.StatusCode(); code != http.StatusNoContent {
+		return statusError(code)
+	}
+
+	return nil
+}
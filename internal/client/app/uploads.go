@@ -0,0 +1,408 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/go-resty/resty/v2"
+	"github.com/lionslon/go-keepass/internal/crypt"
+	"github.com/lionslon/go-keepass/internal/models"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+const (
+	uploadsPath = "uploads"
+
+	uploadLengthHeader = "Upload-Length"
+	uploadOffsetHeader = "Upload-Offset"
+
+	uploadPartSize  = 8 << 20  // размер части, отправляемой одним запросом
+	minUploadPart   = 64 << 10 // минимальный размер части, до которого она уменьшается по ответу 413
+	uploadRetries   = 3        // число попыток продолжить загрузку подряд после ошибки
+	fileHeaderLimit = 64 << 10 // ограничение размера заголовка файла
+)
+
+// UploadFile шифрует файл потоком и загружает его на сервер по частям, в памяти держится не больше части.
+// Оборвавшаяся загрузка продолжается со смещения, сохраненного сервером.
+// Если ревизия данных клиенту неизвестна, данные должны отсутствовать на сервере.
+func (m *sender) UploadFile(identifier, path string, metadata models.Metadata) error {
+	if m.state.auth() == `` || m.password == `` {
+		return fmt.Errorf("bad auth data, try login")
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("cannot open file: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("cannot stat file: %w", err)
+	}
+
+	return m.uploadContent(identifier, filepath.Base(path), file, info.Size(), metadata)
+}
+
+// uploadContent загружает size байт содержимого файла с именем name из r
+func (m *sender) uploadContent(identifier, name string, r io.ReaderAt, size int64, metadata models.Metadata) error {
+	//Открытые данные - заголовок с именем файла и содержимое файла
+	src := &prefixReaderAt{prefix: models.FileHeader(name), r: r}
+	encrypter, err := crypt.NewStreamEncrypter(m.entryKey(identifier), src, int64(len(src.prefix))+size)
+	if err != nil {
+		return fmt.Errorf("cannot encrypt file: %w", err)
+	}
+
+	encryptMetadata, err := m.encryptMetadata(identifier, metadata)
+	if err != nil {
+		return err
+	}
+
+	return m.uploadEncrypted(identifier, encrypter, encryptMetadata)
+}
+
+// uploadEncrypted загружает по частям новую ревизию данных, уже зашифрованную encrypter
+func (m *sender) uploadEncrypted(identifier string, encrypter uploadBody, encryptMetadata []byte) error {
+	url, err := m.createUpload(identifier, encrypter.Size(), encryptMetadata)
+	if err != nil {
+		return err
+	}
+
+	resp, err := m.sendUpload(url, encrypter)
+	if errors.Is(err, errUploadPrecondition) {
+		err = &ConflictError{Identifier: identifier}
+	}
+	if err != nil {
+		//Незавершенную загрузку удаляем, чтобы она не занимала место на сервере
+		m.cancelUpload(url)
+		return err
+	}
+
+	m.rememberSaved(identifier, m.state.origin(identifier), resp)
+	return nil
+}
+
+// cancelUpload удаляет незавершенную загрузку. Ошибка не важна: загрузку, которую не удалось удалить,
+// сервер удалит сам по истечении срока хранения незавершенных загрузок
+func (m *sender) cancelUpload(url string) {
+	m.client.R().SetHeader("Authorization", m.state.auth()).Delete(url)
+}
+
+// createUpload начинает загрузку и возвращает ее адрес
+func (m *sender) createUpload(identifier string, size int64, encryptMetadata []byte) (string, error) {
+	req := m.client.R().
+		SetHeader("Authorization", m.state.auth()).
+		SetHeader(uploadLengthHeader, strconv.FormatInt(size, 10))
+	setMetadata(req, encryptMetadata)
+	if _, ok := m.state.revision(identifier); ok {
+		m.setIfMatch(req, identifier)
+	} else {
+		req.SetHeader("If-None-Match", "*")
+	}
+
+	url := m.dataUrl(identifier, uploadsPath)
+
+	resp, err := req.Post(url)
+	if err != nil {
+		return ``, fmt.Errorf("cannot send create upload request: %w", err)
+	}
+
+	if code := resp.StatusCode(); code == http.StatusPreconditionFailed {
+		return ``, &ConflictError{Identifier: identifier}
+	} else if code != http.StatusCreated {
+		return ``, statusError(code)
+	}
+
+	location := resp.Header().Get("Location")
+	if location == `` {
+		return ``, fmt.Errorf("location header is missing")
+	}
+
+	return m.cfg.ServerEndpoint + location, nil
+}
+
+// uploadBody шифротекст, загружаемый по частям с любого смещения
+type uploadBody interface {
+	Size() int64
+	ReaderFrom(offset int64) io.Reader
+}
+
+// sealedUpload шифротекст, уже целиком зашифрованный в памяти
+type sealedUpload []byte
+
+func (m sealedUpload) Size() int64 {
+	return int64(len(m))
+}
+
+func (m sealedUpload) ReaderFrom(offset int64) io.Reader {
+	return bytes.NewReader(m[min(offset, int64(len(m))):])
+}
+
+// errUploadPrecondition сервер отказался завершать загрузку: данные изменились или исчезли
+var errUploadPrecondition = errors.New("upload precondition failed")
+
+// sendUpload отправляет шифротекст частями, после ошибки запрашивает у сервера загруженный объем и продолжает с него.
+// Возвращает ответ на последнюю часть, завершившую загрузку.
+func (m *sender) sendUpload(url string, encrypter uploadBody) (*resty.Response, error) {
+	var offset int64
+	failures := 0
+	partSize := int64(uploadPartSize)
+
+	for {
+		resp, err := m.client.R().
+			SetHeader("Authorization", m.state.auth()).
+			SetHeader("Content-Type", "application/offset+octet-stream").
+			SetHeader(uploadOffsetHeader, strconv.FormatInt(offset, 10)).
+			SetBody(io.LimitReader(encrypter.ReaderFrom(offset), partSize)).
+			Patch(url)
+		if errors.Is(err, crypt.ErrSourceChanged) {
+			return nil, fmt.Errorf("file changed during upload: %w", err)
+		}
+		if err != nil {
+			err = fmt.Errorf("cannot send upload part: %w", err)
+		} else {
+			switch code := resp.StatusCode(); code {
+			case http.StatusNoContent:
+				offset, err = strconv.ParseInt(resp.Header().Get(uploadOffsetHeader), 10, 64)
+				if err != nil {
+					return nil, fmt.Errorf("bad %s header: %w", uploadOffsetHeader, err)
+				}
+				if offset >= encrypter.Size() {
+					return resp, nil
+				}
+				failures = 0
+				continue
+			case http.StatusPreconditionFailed:
+				return nil, errUploadPrecondition
+			case http.StatusConflict:
+				//Смещение разошлось с сервером, сверяемся
+				err = fmt.Errorf("upload offset %d mismatch", offset)
+			case http.StatusRequestEntityTooLarge:
+				//Часть больше ограничения размера запроса на сервере, уменьшаем ее
+				if partSize <= minUploadPart {
+					return nil, ErrTooLarge
+				}
+				partSize /= 2
+				failures--
+				err = ErrTooLarge
+			default:
+				return nil, statusError(code)
+			}
+		}
+
+		failures++
+		if failures > uploadRetries {
+			return nil, err
+		}
+
+		offset, err = m.uploadOffset(url)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// uploadOffset запрашивает объем, уже загруженный на сервер
+func (m *sender) uploadOffset(url string) (int64, error) {
+	resp, err := m.client.R().
+		SetHeader("Authorization", m.state.auth()).
+		Head(url)
+	if err != nil {
+		return 0, fmt.Errorf("cannot send upload status request: %w", err)
+	}
+
+	if code := resp.StatusCode(); code != http.StatusOK {
+		return 0, statusError(code)
+	}
+
+	offset, err := strconv.ParseInt(resp.Header().Get(uploadOffsetHeader), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("bad %s header: %w", uploadOffsetHeader, err)
+	}
+
+	return offset, nil
+}
+
+// DownloadFile получает данные и сохраняет содержимое файла в path. Данные, загруженные через UploadFile,
+// расшифровываются потоком по мере получения; бинарные записи, сохраненные целиком, расшифровываются в памяти.
+func (m *sender) DownloadFile(identifier, path string) error {
+	if m.state.auth() == `` || m.password == `` {
+		return fmt.Errorf("bad auth data, try login")
+	}
+
+	return m.readContent(identifier, fileWriter(identifier, path))
+}
+
+// readContent получает данные с сервера и передает read запись и содержимое файла (см. decryptContent)
+func (m *sender) readContent(identifier string, read func(record models.Record, content io.Reader) error) error {
+	req := m.client.R().
+		SetHeader("Authorization", m.state.auth()).
+		SetDoNotParseResponse(true)
+
+	url := m.dataUrl(identifier)
+
+	resp, err := req.Get(url)
+	if err != nil {
+		return fmt.Errorf("cannot send get user data request: %w", err)
+	}
+
+	body := resp.RawBody()
+	defer body.Close()
+
+	if code := resp.StatusCode(); code != http.StatusOK {
+		return statusError(code)
+	}
+
+	m.rememberRevision(identifier, resp)
+
+	//Исходный идентификатор перемещенных данных сервер сообщает и тем клиентам, что о перемещении еще не знают
+	origin, err := readOrigin(resp)
+	if err != nil {
+		return err
+	}
+	keys := m.entryKeys(identifier)
+	if origin != `` {
+		keys = m.dataKeys(origin, identifier)
+	}
+
+	return decryptContent(keys, body, read)
+}
+
+// saveContent расшифровывает содержимое файла первым подходящим из keys ключом и сохраняет его в path
+func saveContent(identifier string, keys []string, body io.Reader, path string) error {
+	return decryptContent(keys, body, fileWriter(identifier, path))
+}
+
+// fileWriter сохраняет в path содержимое файла, полученное из decryptContent
+func fileWriter(identifier, path string) func(record models.Record, content io.Reader) error {
+	return func(record models.Record, content io.Reader) error {
+		if record.Type != models.RecordBinary {
+			return fmt.Errorf("data %s is %s record, not a file", identifier, record.Type)
+		}
+		return writeFile(path, content)
+	}
+}
+
+// decryptContent расшифровывает данные первым подходящим из keys ключом и передает read запись
+// и содержимое файла: у файла record.Binary.Data пустое, у записей других типов content пустой.
+// Файлы, загруженные через UploadFile, расшифровываются потоком по мере чтения content,
+// записи, сохраненные целиком, - в памяти.
+func decryptContent(keys []string, body io.Reader, read func(record models.Record, content io.Reader) error) error {
+	reader := bufio.NewReaderSize(body, crypt.StreamPrefixSize)
+	if prefix, _ := reader.Peek(crypt.StreamHeaderSize); !crypt.IsStream(prefix) {
+		encryptData, err := io.ReadAll(reader)
+		if err != nil {
+			return fmt.Errorf("cannot read user data: %w", err)
+		}
+
+		record, _, err := decryptEntry(keys, encryptData, nil)
+		if err != nil {
+			return err
+		}
+
+		var content []byte
+		if record.Type == models.RecordBinary {
+			file := *record.Binary
+			content, file.Data = file.Data, nil
+			record.Binary = &file
+		}
+
+		return read(record, bytes.NewReader(content))
+	}
+
+	//Ключ определяется по первому сегменту, не дожидаясь остального содержимого
+	prefix, _ := reader.Peek(crypt.StreamPrefixSize)
+	key, err := streamKey(keys, prefix)
+	if err != nil {
+		return err
+	}
+
+	decrypted, err := crypt.NewDecryptReader(key, reader)
+	if err != nil {
+		return fmt.Errorf("cannot decrypt user data: %w", err)
+	}
+
+	plain := bufio.NewReaderSize(decrypted, fileHeaderLimit)
+	header, err := plain.ReadSlice('\n')
+	if err != nil {
+		return fmt.Errorf("cannot read file header: %w", err)
+	}
+	record, err := models.ParseFileHeader(header[:len(header)-1])
+	if err != nil {
+		return err
+	}
+
+	return read(record, plain)
+}
+
+// streamKey выбирает из keys ключ, которым зашифрован поток с началом prefix
+func streamKey(keys []string, prefix []byte) (string, error) {
+	for _, key := range keys {
+		if crypt.MatchStream(key, prefix) {
+			return key, nil
+		}
+	}
+	return ``, fmt.Errorf("cannot decrypt user data: wrong key or corrupted data")
+}
+
+// writeFile пишет содержимое в файл, доступный только владельцу. Содержимое сначала пишется во временный
+// файл рядом с целевым и заменяет его только целиком: если содержимое не удалось дочитать (в том числе
+// не прошла проверка подлинности), прежний файл остается нетронутым, а временный удаляется.
+func writeFile(path string, r io.Reader) error {
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("cannot create file: %w", err)
+	}
+	tmp := file.Name()
+
+	//CreateTemp создает файл с правами 0600, явная установка защищает от необычной umask
+	err = file.Chmod(0600)
+	if err == nil {
+		_, err = io.Copy(file, r)
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("cannot save file: %w", err)
+	}
+
+	return nil
+}
+
+// prefixReaderAt открытые данные файла: заголовок, за которым следует содержимое
+type prefixReaderAt struct {
+	prefix []byte
+	r      io.ReaderAt
+}
+
+func (m *prefixReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	var n int
+	if off < int64(len(m.prefix)) {
+		n = copy(p, m.prefix[off:])
+		if n == len(p) {
+			return n, nil
+		}
+		off = 0
+	} else {
+		off -= int64(len(m.prefix))
+	}
+
+	k, err := m.r.ReadAt(p[n:], off)
+	if errors.Is(err, io.EOF) && n+k == len(p) {
+		err = nil
+	}
+	return n + k, err
+}
@@ -0,0 +1,36 @@
+package app
+
+import (
+	"bytes"
+	"errors"
+	"github.com/lionslon/go-keepass/internal/crypt"
+	"io"
+	"testing"
+)
+
+// TestSendUploadSourceChanged проверяет, что загрузка прерывается, если файл изменился
+// после шифрования части: иначе сегмент был бы зашифрован заново с тем же nonce
+func TestSendUploadSourceChanged(t *testing.T) {
+	m := newTestUser(t, newTestServer(t), "alice", "password")
+
+	plain := bytes.Repeat([]byte("0123456789abcdef"), crypt.StreamSegmentSize/8)
+	encrypter, err := crypt.NewStreamEncrypter(m.entryKey("video"), bytes.NewReader(plain), int64(len(plain)))
+	if err != nil {
+		t.Fatalf("NewStreamEncrypter() error = %v", err)
+	}
+
+	url, err := m.createUpload("video", encrypter.Size(), nil)
+	if err != nil {
+		t.Fatalf("createUpload() error = %v", err)
+	}
+
+	//Первый сегмент уже зашифрован, после чего файл изменился
+	if _, err := io.ReadFull(encrypter.ReaderFrom(0), make([]byte, crypt.StreamHeaderSize+1)); err != nil {
+		t.Fatal(err)
+	}
+	plain[100] ^= 0x01
+
+	if _, err := m.sendUpload(url, encrypter); !errors.Is(err, crypt.ErrSourceChanged) {
+		t.Errorf("sendUpload() error = %v, want %v", err, crypt.ErrSourceChanged)
+	}
+}
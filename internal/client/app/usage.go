@@ -0,0 +1,38 @@
+package app
+
+import (
+	"fmt"
+	"github.com/lionslon/go-keepass/internal/models"
+	"net/http"
+	"strings"
+)
+
+const (
+	usageUrl = "api/usage"
+)
+
+// Usage возвращает место, занятое пользователем на сервере, и его квоту
+func (m *sender) Usage() (models.Usage, error) {
+	var usage models.Usage
+
+	if m.state.auth() == `` {
+		return usage, fmt.Errorf("bad auth data, try login")
+	}
+
+	req := m.client.R().
+		SetHeader("Authorization", m.state.auth()).
+		SetResult(&usage)
+
+	url := strings.Join([]string{m.cfg.ServerEndpoint, usageUrl}, "/")
+
+	resp, err := req.Get(url)
+	if err != nil {
+		return usage, fmt.Errorf("cannot send usage request: %w", err)
+	}
+
+	if code := resp.StatusCode(); code != http.StatusOK {
+		return usage, statusError(code)
+	}
+
+	return usage, nil
+}
@@ -6,6 +6,7 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
 	"time"
 )
 
@@ -15,6 +16,7 @@ type Config struct {
 	CryptoKey      string //путь до файла с публичным ключом сервера для шифрования логина и пароля (карманный tls)
 	ConfigJson     string //путь до файла с json конфигурацией
 	PollInterval   int64  //интервал обновления данных
+	CacheDir       string //каталог локального кэша данных, пустой - кэш только в памяти
 }
 
 // formJson дополняет отсутствующие параметры из json
@@ -50,6 +52,10 @@ func (m *Config) formFile() error {
 			if m.CryptoKey == `` {
 				m.CryptoKey = value.(string)
 			}
+		case "cache_dir":
+			if m.CacheDir == `` {
+				m.CacheDir = value.(string)
+			}
 		}
 	}
 
@@ -64,6 +70,7 @@ func LoadAgentConfig() (*Config, error) {
 	flag.Int64Var(&cfg.PollInterval, "p", 10, "poll interval")
 	flag.StringVar(&cfg.CryptoKey, "k", "public.rsa", "open crypt key")
 	flag.StringVar(&cfg.ConfigJson, "c", "", "json config")
+	flag.StringVar(&cfg.CacheDir, "s", "", "local cache dir (default in user cache dir)")
 
 	flag.Parse()
 
@@ -74,5 +81,12 @@ func LoadAgentConfig() (*Config, error) {
 		}
 	}
 
+	//По умолчанию кэш хранится в каталоге кэшей пользователя, если он определен
+	if cfg.CacheDir == `` {
+		if dir, err := os.UserCacheDir(); err == nil {
+			cfg.CacheDir = filepath.Join(dir, "go-keepass")
+		}
+	}
+
 	return cfg, nil
 }
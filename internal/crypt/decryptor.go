@@ -26,21 +26,26 @@ func NewDecryptor(file string) error {
 		return fmt.Errorf("cannot read private key from file: %w", err)
 	}
 
+	deprypt, err = parseDecryptor(b)
+	return err
+}
+
+// parseDecryptor разбирает закрытый ключ RSA в PEM (PKCS #1)
+func parseDecryptor(b []byte) (*decryptor, error) {
+
 	keyBlock, _ := pem.Decode(b)
 	if keyBlock == nil {
-		return fmt.Errorf("bad private key blob: %w", err)
+		return nil, fmt.Errorf("bad private key blob")
 	}
 
 	privateKey, err := x509.ParsePKCS1PrivateKey(keyBlock.Bytes)
 	if err != nil {
-		return fmt.Errorf("cannot parse private key: %w", err)
+		return nil, fmt.Errorf("cannot parse private key: %w", err)
 	}
 
-	deprypt = &decryptor{
+	return &decryptor{
 		privateKey: privateKey,
-	}
-
-	return nil
+	}, nil
 }
 
 func (m *decryptor) Decrypt(message []byte) ([]byte, error) {
@@ -23,9 +23,15 @@ func NewEncryptor(file string) (*Encryptor, error) {
 		return nil, fmt.Errorf("cannot read open key from file: %w", err)
 	}
 
+	return ParseEncryptor(b)
+}
+
+// ParseEncryptor разбирает открытый ключ RSA в PEM (PKCS #1)
+func ParseEncryptor(b []byte) (*Encryptor, error) {
+
 	keyBlock, _ := pem.Decode(b)
 	if keyBlock == nil {
-		return nil, fmt.Errorf("bad open key blob: %w", err)
+		return nil, fmt.Errorf("bad open key blob")
 	}
 
 	pubKey, err := x509.ParsePKCS1PublicKey(keyBlock.Bytes)
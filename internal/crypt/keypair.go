@@ -0,0 +1,86 @@
+package crypt
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"golang.org/x/crypto/hkdf"
+	"io"
+)
+
+const (
+	userKeyBits  = 2048
+	entryKeyInfo = "go-keepass entry "
+)
+
+// GenerateKeyPair создает пару ключей RSA пользователя для обмена данными,
+// ключи возвращаются в PEM (PKCS #1), как и ключи сервера
+func GenerateKeyPair() ([]byte, []byte, error) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, userKeyBits)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot generate rsa key: %w", err)
+	}
+
+	publicPEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PUBLIC KEY",
+		Bytes: x509.MarshalPKCS1PublicKey(&privateKey.PublicKey),
+	})
+	privatePEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
+	})
+
+	return publicPEM, privatePEM, nil
+}
+
+// EntryKey ключ данных записи, получаемый из пароля и идентификатора записи. Его можно использовать
+// вместо пароля в SymmetricEncrypt и потоковом формате и передать другому пользователю,
+// не раскрывая ключ остальных записей.
+func EntryKey(password, identifier string) string {
+	key := symmetricKey(password)
+
+	entryKey := make([]byte, len(key))
+	//HKDF-SHA256 выдает до 8160 байт, ошибки для 32 байт не бывает
+	io.ReadFull(hkdf.New(sha256.New, key[:], nil, []byte(entryKeyInfo+identifier)), entryKey)
+
+	return hex.EncodeToString(entryKey)
+}
+
+// GenerateKey создает случайный ключ данных в том же виде, что и EntryKey, например, ключ общей коллекции
+func GenerateKey() (string, error) {
+	key := make([]byte, sha256.Size)
+	if _, err := rand.Read(key); err != nil {
+		return ``, fmt.Errorf("cannot generate key: %w", err)
+	}
+
+	return hex.EncodeToString(key), nil
+}
+
+// WrapKey шифрует ключ данных открытым ключом получателя в PEM
+func WrapKey(publicKey []byte, key string) ([]byte, error) {
+	encryptor, err := ParseEncryptor(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return encryptor.Encrypt([]byte(key))
+}
+
+// UnwrapKey расшифровывает ключ данных закрытым ключом в PEM
+func UnwrapKey(privateKey []byte, wrapped []byte) (string, error) {
+	decryptor, err := parseDecryptor(privateKey)
+	if err != nil {
+		return ``, err
+	}
+
+	key, err := decryptor.Decrypt(wrapped)
+	if err != nil {
+		return ``, fmt.Errorf("cannot unwrap data key: %w", err)
+	}
+
+	return string(key), nil
+}
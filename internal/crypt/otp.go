@@ -0,0 +1,29 @@
+package crypt
+
+import (
+	"crypto/hmac"
+	"encoding/binary"
+	"fmt"
+	"hash"
+)
+
+// HOTP вычисляет одноразовый код из digits цифр по RFC 4226: HMAC счетчика на ключе key
+// с динамическим усечением. TOTP по RFC 6238 - тот же код, где счетчик - номер периода времени.
+func HOTP(newHash func() hash.Hash, key []byte, counter uint64, digits int) string {
+	message := make([]byte, 8)
+	binary.BigEndian.PutUint64(message, counter)
+
+	mac := hmac.New(newHash, key)
+	mac.Write(message)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := uint64(binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff)
+
+	modulo := uint64(1)
+	for range digits {
+		modulo *= 10
+	}
+
+	return fmt.Sprintf("%0*d", digits, value%modulo)
+}
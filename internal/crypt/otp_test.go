@@ -0,0 +1,67 @@
+package crypt
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"hash"
+	"testing"
+)
+
+// TestHOTP проверяет коды по счетчику по RFC 4226, приложение D
+func TestHOTP(t *testing.T) {
+	key := []byte("12345678901234567890")
+
+	for counter, want := range []string{
+		"755224", "287082", "359152", "969429", "338314",
+		"254676", "287922", "162583", "399871", "520489",
+	} {
+		if got := HOTP(sha1.New, key, uint64(counter), 6); got != want {
+			t.Errorf("HOTP(counter %d) = %s, want %s", counter, got, want)
+		}
+	}
+}
+
+// TestTOTP проверяет коды по времени по RFC 6238, приложение B: счетчик - номер 30-секундного периода
+func TestTOTP(t *testing.T) {
+	keys := map[string]struct {
+		newHash func() hash.Hash
+		key     []byte
+	}{
+		"SHA1":   {sha1.New, []byte("12345678901234567890")},
+		"SHA256": {sha256.New, []byte("12345678901234567890123456789012")},
+		"SHA512": {sha512.New, []byte("1234567890123456789012345678901234567890123456789012345678901234")},
+	}
+
+	tests := []struct {
+		time      uint64
+		algorithm string
+		want      string
+	}{
+		{59, "SHA1", "94287082"},
+		{59, "SHA256", "46119246"},
+		{59, "SHA512", "90693936"},
+		{1111111109, "SHA1", "07081804"},
+		{1111111109, "SHA256", "68084774"},
+		{1111111109, "SHA512", "25091201"},
+		{1111111111, "SHA1", "14050471"},
+		{1111111111, "SHA256", "67062674"},
+		{1111111111, "SHA512", "99943326"},
+		{1234567890, "SHA1", "89005924"},
+		{1234567890, "SHA256", "91819424"},
+		{1234567890, "SHA512", "93441116"},
+		{2000000000, "SHA1", "69279037"},
+		{2000000000, "SHA256", "90698825"},
+		{2000000000, "SHA512", "38618901"},
+		{20000000000, "SHA1", "65353130"},
+		{20000000000, "SHA256", "77737706"},
+		{20000000000, "SHA512", "47863826"},
+	}
+
+	for _, tt := range tests {
+		k := keys[tt.algorithm]
+		if got := HOTP(k.newHash, k.key, tt.time/30, 8); got != tt.want {
+			t.Errorf("TOTP(%s, %d) = %s, want %s", tt.algorithm, tt.time, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,396 @@
+package crypt
+
+import (
+	"bufio"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/hkdf"
+	"io"
+	"sync"
+)
+
+// Потоковый формат (сегментное AEAD по схеме STREAM) позволяет шифровать и расшифровывать
+// данные любого размера, держа в памяти один сегмент:
+//
+//	заголовок: версия (1 байт) || размер сегмента (4 байта) || соль (16 байт)
+//	сегменты:  AES-GCM(открытые данные сегмента), последний сегмент короче или пустой
+//
+// Ключ потока - HKDF(ключ пароля, соль), nonce сегмента - 0^7 || номер сегмента || признак последнего сегмента,
+// заголовок передается как дополнительные данные каждого сегмента.
+// Номер в nonce не дает переставить сегменты, признак последнего - незаметно обрезать поток.
+const (
+	// StreamSegmentSize размер сегмента открытых данных при шифровании
+	StreamSegmentSize = 64 << 10
+	// StreamHeaderSize размер заголовка потока, достаточный для IsStream
+	StreamHeaderSize = 1 + 4 + streamSaltSize
+	// StreamPrefixSize размер начала шифротекста, достаточный для MatchStream
+	StreamPrefixSize = StreamHeaderSize + StreamSegmentSize + streamTagSize
+
+	streamSaltSize       = 16
+	streamTagSize        = 16 // размер тега AES-GCM
+	maxStreamSegmentSize = 16 << 20
+	streamKeyInfo        = "go-keepass stream"
+)
+
+// ErrSourceChanged открытые данные сегмента изменились после того, как сегмент был зашифрован.
+// Повторное шифрование других данных с тем же nonce раскрыло бы XOR открытых данных и позволило бы подделку.
+var ErrSourceChanged = errors.New("stream source changed during encryption")
+
+// IsStream проверяет, похожи ли данные на шифротекст в потоковом формате
+func IsStream(data []byte) bool {
+	return len(data) >= StreamHeaderSize && data[0] == streamVersion
+}
+
+// streamCipher параметры потока, общие для шифрования и расшифровывания
+type streamCipher struct {
+	aead        cipher.AEAD
+	header      []byte // заголовок потока
+	segmentSize int64  // размер сегмента открытых данных
+}
+
+func newStreamCipher(password string, header []byte) (*streamCipher, error) {
+	if len(header) != StreamHeaderSize || header[0] != streamVersion {
+		return nil, fmt.Errorf("bad stream header")
+	}
+
+	segmentSize := int64(binary.BigEndian.Uint32(header[1:5]))
+	if segmentSize == 0 || segmentSize > maxStreamSegmentSize {
+		return nil, fmt.Errorf("bad stream segment size %d", segmentSize)
+	}
+
+	key := symmetricKey(password)
+
+	streamKey := make([]byte, len(key))
+	if _, err := io.ReadFull(hkdf.New(sha256.New, key[:], header[5:], []byte(streamKeyInfo)), streamKey); err != nil {
+		return nil, fmt.Errorf("cannot derive stream key: %w", err)
+	}
+
+	aead, err := newGCM(streamKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &streamCipher{
+		aead:        aead,
+		header:      header,
+		segmentSize: segmentSize,
+	}, nil
+}
+
+// newRandomStreamCipher параметры нового потока со случайной солью
+func newRandomStreamCipher(password string) (*streamCipher, error) {
+	header := make([]byte, StreamHeaderSize)
+	header[0] = streamVersion
+	binary.BigEndian.PutUint32(header[1:5], StreamSegmentSize)
+	if _, err := rand.Read(header[5:]); err != nil {
+		return nil, fmt.Errorf("cannot generate stream salt: %w", err)
+	}
+
+	return newStreamCipher(password, header)
+}
+
+func (m *streamCipher) nonce(segment int64, last bool) []byte {
+	nonce := make([]byte, m.aead.NonceSize())
+	binary.BigEndian.PutUint32(nonce[len(nonce)-5:], uint32(segment))
+	if last {
+		nonce[len(nonce)-1] = 1
+	}
+	return nonce
+}
+
+// segments количество сегментов для открытых данных размера size, пустые данные - один пустой сегмент
+func (m *streamCipher) segments(size int64) int64 {
+	return max(1, (size+m.segmentSize-1)/m.segmentSize)
+}
+
+// StreamEncrypter шифрует открытые данные известного размера в потоковом формате.
+// Шифротекст одного экземпляра всегда одинаков, поэтому его можно читать с любого смещения,
+// например, чтобы продолжить прерванную загрузку. Если данные уже зашифрованного сегмента
+// изменились, чтение возвращает ErrSourceChanged.
+type StreamEncrypter struct {
+	cipher *streamCipher
+	src    io.ReaderAt // открытые данные
+	size   int64       // размер открытых данных
+
+	mu      sync.Mutex
+	digests map[int64][sha256.Size]byte // хэши открытых данных зашифрованных сегментов
+}
+
+// NewStreamEncrypter подготавливает шифрование size байт из src на ключе из пароля со случайной солью
+func NewStreamEncrypter(password string, src io.ReaderAt, size int64) (*StreamEncrypter, error) {
+	cipher, err := newRandomStreamCipher(password)
+	if err != nil {
+		return nil, err
+	}
+
+	return &StreamEncrypter{
+		cipher:  cipher,
+		src:     src,
+		size:    size,
+		digests: make(map[int64][sha256.Size]byte),
+	}, nil
+}
+
+// Size размер шифротекста
+func (m *StreamEncrypter) Size() int64 {
+	return StreamHeaderSize + m.size + m.cipher.segments(m.size)*int64(m.cipher.aead.Overhead())
+}
+
+// StreamPlainSize размер открытых данных по размеру шифротекста, созданного StreamEncrypter
+func StreamPlainSize(size int64) int64 {
+	size -= StreamHeaderSize
+	if size < streamTagSize {
+		return 0
+	}
+	segments := max(1, (size+StreamSegmentSize+streamTagSize-1)/(StreamSegmentSize+streamTagSize))
+	return size - segments*streamTagSize
+}
+
+// ReaderFrom возвращает шифротекст, начиная со смещения offset
+func (m *StreamEncrypter) ReaderFrom(offset int64) io.Reader {
+	return &encryptReader{encrypter: m, offset: offset}
+}
+
+// sealAt шифрует сегмент, содержащий байт шифротекста со смещением offset,
+// и возвращает шифротекст от offset до конца сегмента
+func (m *StreamEncrypter) sealAt(offset int64) ([]byte, error) {
+	if offset >= m.Size() {
+		return nil, io.EOF
+	}
+	if offset < StreamHeaderSize {
+		return m.cipher.header[offset:], nil
+	}
+
+	sealedSize := m.cipher.segmentSize + int64(m.cipher.aead.Overhead())
+	segment := (offset - StreamHeaderSize) / sealedSize
+	skip := (offset - StreamHeaderSize) % sealedSize
+
+	start := segment * m.cipher.segmentSize
+	length := min(m.cipher.segmentSize, m.size-start)
+
+	plain := make([]byte, length, length+int64(m.cipher.aead.Overhead()))
+	if n, err := m.src.ReadAt(plain, start); int64(n) < length {
+		return nil, fmt.Errorf("cannot read stream segment %d: %w", segment, err)
+	}
+
+	//Сегмент шифруется заново при чтении с его середины, nonce при этом тот же
+	digest := sha256.Sum256(plain)
+	m.mu.Lock()
+	sealedDigest, known := m.digests[segment]
+	if !known {
+		m.digests[segment] = digest
+	}
+	m.mu.Unlock()
+	if known && sealedDigest != digest {
+		return nil, fmt.Errorf("stream segment %d: %w", segment, ErrSourceChanged)
+	}
+
+	last := segment == m.cipher.segments(m.size)-1
+	sealed := m.cipher.aead.Seal(plain[:0], m.cipher.nonce(segment, last), plain, m.cipher.header)
+
+	return sealed[skip:], nil
+}
+
+// encryptReader шифротекст StreamEncrypter, начиная с заданного смещения
+type encryptReader struct {
+	encrypter *StreamEncrypter
+	offset    int64  // смещение следующего зашифрованного сегмента
+	buf       []byte // зашифрованные, но еще не прочитанные данные
+	err       error
+}
+
+func (m *encryptReader) Read(p []byte) (int, error) {
+	for len(m.buf) == 0 {
+		if m.err != nil {
+			return 0, m.err
+		}
+		m.buf, m.err = m.encrypter.sealAt(m.offset)
+		m.offset += int64(len(m.buf))
+	}
+
+	n := copy(p, m.buf)
+	m.buf = m.buf[n:]
+	return n, nil
+}
+
+// encryptWriter шифрует данные заранее неизвестного размера по мере записи
+type encryptWriter struct {
+	cipher  *streamCipher
+	dst     io.Writer
+	segment int64  // номер следующего сегмента
+	buf     []byte // открытые данные следующего сегмента
+	err     error
+}
+
+// NewEncryptWriter пишет в dst заголовок потока и возвращает writer, шифрующий записанное по сегментам.
+// Сегмент шифруется, когда за ним записаны следующие данные, поэтому последний сегмент шифруется в Close:
+// без Close поток останется обрезанным. Шифротекст совпадает по формату с шифротекстом StreamEncrypter.
+func NewEncryptWriter(password string, dst io.Writer) (io.WriteCloser, error) {
+	cipher, err := newRandomStreamCipher(password)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := dst.Write(cipher.header); err != nil {
+		return nil, fmt.Errorf("cannot write stream header: %w", err)
+	}
+
+	return &encryptWriter{
+		cipher: cipher,
+		dst:    dst,
+		buf:    make([]byte, 0, cipher.segmentSize+int64(cipher.aead.Overhead())),
+	}, nil
+}
+
+func (m *encryptWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if m.err != nil {
+			return written, m.err
+		}
+
+		if int64(len(m.buf)) == m.cipher.segmentSize {
+			m.err = m.seal(false)
+			continue
+		}
+
+		n := copy(m.buf[len(m.buf):m.cipher.segmentSize], p)
+		m.buf = m.buf[:len(m.buf)+n]
+		p = p[n:]
+		written += n
+	}
+
+	return written, nil
+}
+
+// Close шифрует последний сегмент, пустой, если данных не было
+func (m *encryptWriter) Close() error {
+	if m.err != nil {
+		return m.err
+	}
+
+	m.err = m.seal(true)
+	if m.err != nil {
+		return m.err
+	}
+
+	m.err = fmt.Errorf("stream writer is closed")
+	return nil
+}
+
+// seal шифрует накопленный сегмент и пишет его в dst
+func (m *encryptWriter) seal(last bool) error {
+	sealed := m.cipher.aead.Seal(m.buf[:0], m.cipher.nonce(m.segment, last), m.buf, m.cipher.header)
+	if _, err := m.dst.Write(sealed); err != nil {
+		return fmt.Errorf("cannot write stream segment %d: %w", m.segment, err)
+	}
+
+	m.segment++
+	m.buf = m.buf[:0]
+	return nil
+}
+
+// decryptReader расшифровывает потоковый формат по одному сегменту
+type decryptReader struct {
+	cipher  *streamCipher
+	src     *bufio.Reader
+	segment int64  // номер следующего сегмента
+	sealed  []byte // буфер сегмента шифротекста
+	buf     []byte // расшифрованные, но еще не прочитанные данные
+	done    bool   // последний сегмент расшифрован
+	err     error
+}
+
+// NewDecryptReader читает заголовок потока из src и возвращает reader расшифрованных данных.
+// Ошибка чтения возвращается, если поток поврежден, обрезан или зашифрован другим паролем.
+func NewDecryptReader(password string, src io.Reader) (io.Reader, error) {
+	header := make([]byte, StreamHeaderSize)
+	if _, err := io.ReadFull(src, header); err != nil {
+		return nil, fmt.Errorf("cannot read stream header: %w", err)
+	}
+
+	cipher, err := newStreamCipher(password, header)
+	if err != nil {
+		return nil, err
+	}
+
+	return &decryptReader{
+		cipher: cipher,
+		src:    bufio.NewReader(src),
+		sealed: make([]byte, cipher.segmentSize+int64(cipher.aead.Overhead())),
+	}, nil
+}
+
+func (m *decryptReader) Read(p []byte) (int, error) {
+	for len(m.buf) == 0 {
+		if m.err != nil {
+			return 0, m.err
+		}
+		m.err = m.next()
+	}
+
+	n := copy(p, m.buf)
+	m.buf = m.buf[n:]
+	return n, nil
+}
+
+// next расшифровывает очередной сегмент
+func (m *decryptReader) next() error {
+	if m.done {
+		return io.EOF
+	}
+
+	//Сегмент последний, если он неполный или за ним ничего нет
+	n, err := io.ReadFull(m.src, m.sealed)
+	last := errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF)
+	if err != nil && !last {
+		return fmt.Errorf("cannot read stream segment %d: %w", m.segment, err)
+	}
+	if !last {
+		if _, err := m.src.Peek(1); errors.Is(err, io.EOF) {
+			last = true
+		} else if err != nil {
+			return fmt.Errorf("cannot read stream segment %d: %w", m.segment+1, err)
+		}
+	}
+
+	data, err := m.cipher.aead.Open(m.sealed[:0], m.cipher.nonce(m.segment, last), m.sealed[:n], m.cipher.header)
+	if err != nil {
+		return fmt.Errorf("cannot decrypt stream segment %d: %w", m.segment, err)
+	}
+
+	m.segment++
+	m.done = last
+	m.buf = data
+
+	return nil
+}
+
+// MatchStream проверяет, что потоковый шифротекст зашифрован ключом из пароля.
+// prefix - начало шифротекста: заголовок и первый сегмент целиком или весь шифротекст, если он короче.
+func MatchStream(password string, prefix []byte) bool {
+	if !IsStream(prefix) {
+		return false
+	}
+
+	cipher, err := newStreamCipher(password, prefix[:StreamHeaderSize])
+	if err != nil {
+		return false
+	}
+
+	sealed := prefix[StreamHeaderSize:]
+	sealed = sealed[:min(int64(len(sealed)), cipher.segmentSize+int64(cipher.aead.Overhead()))]
+
+	//По началу шифротекста не видно, последний ли это сегмент
+	for _, last := range []bool{false, true} {
+		if _, err := cipher.aead.Open(nil, cipher.nonce(0, last), sealed, cipher.header); err == nil {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,234 @@
+package crypt
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+// testPlain открытые данные размера size, различающиеся в каждом сегменте
+func testPlain(size int) []byte {
+	plain := make([]byte, size)
+	for i := range plain {
+		plain[i] = byte(i*7 + i/StreamSegmentSize)
+	}
+	return plain
+}
+
+// encryptStream шифрует plain целиком
+func encryptStream(t *testing.T, password string, plain []byte) (*StreamEncrypter, []byte) {
+	t.Helper()
+
+	encrypter, err := NewStreamEncrypter(password, bytes.NewReader(plain), int64(len(plain)))
+	if err != nil {
+		t.Fatalf("NewStreamEncrypter() error = %v", err)
+	}
+
+	sealed, err := io.ReadAll(encrypter.ReaderFrom(0))
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+
+	return encrypter, sealed
+}
+
+// decryptStream расшифровывает поток целиком
+func decryptStream(password string, sealed []byte) ([]byte, error) {
+	reader, err := NewDecryptReader(password, bytes.NewReader(sealed))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(reader)
+}
+
+func TestStreamRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		size int
+	}{
+		{"empty", 0},
+		{"one byte", 1},
+		{"exactly one segment", StreamSegmentSize},
+		{"one segment and one byte", StreamSegmentSize + 1},
+		{"several segments", 3*StreamSegmentSize + StreamSegmentSize/2},
+		{"exactly several segments", 4 * StreamSegmentSize},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plain := testPlain(tt.size)
+			encrypter, sealed := encryptStream(t, "password", plain)
+
+			if int64(len(sealed)) != encrypter.Size() {
+				t.Errorf("ciphertext = %d bytes, Size() = %d", len(sealed), encrypter.Size())
+			}
+			if got := StreamPlainSize(encrypter.Size()); got != int64(tt.size) {
+				t.Errorf("StreamPlainSize(%d) = %d, want %d", encrypter.Size(), got, tt.size)
+			}
+			if !IsStream(sealed) {
+				t.Error("IsStream() = false, want true")
+			}
+			if !MatchStream("password", sealed[:min(len(sealed), StreamPrefixSize)]) {
+				t.Error("MatchStream() = false, want true")
+			}
+
+			got, err := decryptStream("password", sealed)
+			if err != nil {
+				t.Fatalf("decrypt error = %v", err)
+			}
+			if !bytes.Equal(got, plain) {
+				t.Errorf("decrypted %d bytes differ from %d bytes of plain data", len(got), len(plain))
+			}
+
+			//Шифротекст целиком расшифровывает и SymmetricDecrypt
+			if got, err := SymmetricDecrypt("password", sealed); err != nil || !bytes.Equal(got, plain) {
+				t.Errorf("SymmetricDecrypt() error = %v, equal = %v", err, bytes.Equal(got, plain))
+			}
+		})
+	}
+}
+
+func TestStreamReaderFrom(t *testing.T) {
+	plain := testPlain(3*StreamSegmentSize + 1000)
+	encrypter, sealed := encryptStream(t, "password", plain)
+
+	sealedSegment := StreamSegmentSize + streamTagSize
+	for _, offset := range []int{
+		0,
+		1,
+		StreamHeaderSize - 1,
+		StreamHeaderSize,
+		StreamHeaderSize + 100,
+		StreamHeaderSize + sealedSegment - 1,
+		StreamHeaderSize + sealedSegment,
+		StreamHeaderSize + 2*sealedSegment + 12345,
+		len(sealed) - 1,
+		len(sealed),
+	} {
+		got, err := io.ReadAll(encrypter.ReaderFrom(int64(offset)))
+		if err != nil {
+			t.Fatalf("ReaderFrom(%d) error = %v", offset, err)
+		}
+		if !bytes.Equal(got, sealed[offset:]) {
+			t.Errorf("ReaderFrom(%d) = %d bytes, differs from ciphertext tail of %d bytes", offset, len(got), len(sealed)-offset)
+		}
+	}
+}
+
+func TestStreamRejectsTampering(t *testing.T) {
+	plain := testPlain(3*StreamSegmentSize + 1000)
+	_, sealed := encryptStream(t, "password", plain)
+
+	sealedSegment := StreamSegmentSize + streamTagSize
+	segment := func(i int) []byte {
+		start := StreamHeaderSize + i*sealedSegment
+		return sealed[start:min(start+sealedSegment, len(sealed))]
+	}
+	concat := func(parts ...[]byte) []byte {
+		return bytes.Join(parts, nil)
+	}
+	header := sealed[:StreamHeaderSize]
+
+	flipped := bytes.Clone(sealed)
+	flipped[StreamHeaderSize+sealedSegment+10] ^= 0x01
+
+	tests := []struct {
+		name   string
+		sealed []byte
+	}{
+		{"truncated inside last segment", sealed[:len(sealed)-10]},
+		{"last segment dropped", sealed[:StreamHeaderSize+3*sealedSegment]},
+		{"header only", header},
+		{"segments reordered", concat(header, segment(1), segment(0), segment(2), segment(3))},
+		{"segment duplicated", concat(header, segment(0), segment(0), segment(2), segment(3))},
+		{"flipped byte", flipped},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decryptStream("password", tt.sealed); err == nil {
+				t.Error("decrypt error = nil, want error")
+			}
+		})
+	}
+
+	if _, err := decryptStream("wrong", sealed); err == nil {
+		t.Error("decrypt with wrong password error = nil, want error")
+	}
+	if MatchStream("wrong", sealed[:StreamPrefixSize]) {
+		t.Error("MatchStream() with wrong password = true, want false")
+	}
+}
+
+// TestStreamSourceChanged проверяет, что сегмент с изменившимися данными не шифруется с тем же nonce
+func TestStreamSourceChanged(t *testing.T) {
+	plain := testPlain(2*StreamSegmentSize + 1000)
+	encrypter, sealed := encryptStream(t, "password", plain)
+
+	//Данные второго сегмента изменились, первый и третий по-прежнему читаются
+	plain[StreamSegmentSize+10] ^= 0x01
+
+	sealedSegment := StreamSegmentSize + streamTagSize
+	if _, err := io.ReadAll(encrypter.ReaderFrom(int64(StreamHeaderSize + sealedSegment + 5))); !errors.Is(err, ErrSourceChanged) {
+		t.Errorf("ReaderFrom() changed segment error = %v, want %v", err, ErrSourceChanged)
+	}
+
+	got, err := io.ReadAll(io.LimitReader(encrypter.ReaderFrom(StreamHeaderSize+7), int64(sealedSegment-7)))
+	if err != nil {
+		t.Fatalf("ReaderFrom() unchanged segment error = %v", err)
+	}
+	if !bytes.Equal(got, sealed[StreamHeaderSize+7:StreamHeaderSize+sealedSegment]) {
+		t.Error("ReaderFrom() unchanged segment differs from ciphertext")
+	}
+}
+
+func TestEncryptWriter(t *testing.T) {
+	for _, size := range []int{0, 1, StreamSegmentSize, StreamSegmentSize + 1, 3*StreamSegmentSize + StreamSegmentSize/2, 4 * StreamSegmentSize} {
+		plain := testPlain(size)
+
+		var sealed bytes.Buffer
+		writer, err := NewEncryptWriter("password", &sealed)
+		if err != nil {
+			t.Fatalf("NewEncryptWriter() error = %v", err)
+		}
+
+		//Запись частями, не совпадающими с границами сегментов
+		for rest := plain; len(rest) > 0; {
+			n := min(len(rest), 10000)
+			if written, err := writer.Write(rest[:n]); err != nil || written != n {
+				t.Fatalf("Write() = %d, %v, want %d", written, err, n)
+			}
+			rest = rest[n:]
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatalf("Close() error = %v", err)
+		}
+		if _, err := writer.Write([]byte{1}); err == nil {
+			t.Error("Write() after Close() error = nil, want error")
+		}
+
+		if got := StreamPlainSize(int64(sealed.Len())); got != int64(size) {
+			t.Errorf("StreamPlainSize(%d) = %d, want %d", sealed.Len(), got, size)
+		}
+
+		got, err := decryptStream("password", sealed.Bytes())
+		if err != nil {
+			t.Fatalf("decrypt %d bytes error = %v", size, err)
+		}
+		if !bytes.Equal(got, plain) {
+			t.Errorf("decrypted %d bytes differ from %d bytes of plain data", len(got), len(plain))
+		}
+
+		//Поток, не закрытый Close, обрезан
+		var unclosed bytes.Buffer
+		writer, err = NewEncryptWriter("password", &unclosed)
+		if err != nil {
+			t.Fatalf("NewEncryptWriter() error = %v", err)
+		}
+		writer.Write(plain)
+		if _, err := decryptStream("password", unclosed.Bytes()); err == nil {
+			t.Errorf("decrypt unclosed %d bytes error = nil, want error", size)
+		}
+	}
+}
@@ -1,17 +1,29 @@
 package crypt
 
 import (
+	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/rand"
 	"crypto/sha256"
 	"fmt"
+	"io"
 )
 
-func SymmetricEncrypt(password string, data []byte) ([]byte, error) {
+// Версии формата зашифрованных данных, первый байт шифротекста.
+// Данные, зашифрованные до появления версий, не имеют заголовка и используют nonce, полученный из ключа.
+const (
+	sealedVersion byte = 0x01 // версия || nonce || шифротекст
+	streamVersion byte = 0x02 // потоковый формат, см. stream.go
+)
 
-	key := sha256.Sum256([]byte(password))
+// symmetricKey ключ симметричного шифрования, получаемый из пароля пользователя
+func symmetricKey(password string) [32]byte {
+	return sha256.Sum256([]byte(password))
+}
 
-	aesblock, err := aes.NewCipher(key[:])
+func newGCM(key []byte) (cipher.AEAD, error) {
+	aesblock, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, fmt.Errorf("cannot crate new cipher.Block: %w", err)
 	}
@@ -21,31 +33,70 @@ func SymmetricEncrypt(password string, data []byte) ([]byte, error) {
 		return nil, fmt.Errorf("cannot crate new block cipher wrapped in Galois Counter Mode: %w", err)
 	}
 
-	nonce := key[len(key)-aesgcm.NonceSize():]
+	return aesgcm, nil
+}
 
-	dst := aesgcm.Seal(nil, nonce, data, nil)
+// SymmetricEncrypt шифрует данные целиком на ключе из пароля со случайным nonce
+func SymmetricEncrypt(password string, data []byte) ([]byte, error) {
+
+	key := symmetricKey(password)
 
-	return dst, nil
+	aesgcm, err := newGCM(key[:])
+	if err != nil {
+		return nil, err
+	}
+
+	dst := make([]byte, 1+aesgcm.NonceSize(), 1+aesgcm.NonceSize()+len(data)+aesgcm.Overhead())
+	dst[0] = sealedVersion
+
+	nonce := dst[1:]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("cannot generate nonce: %w", err)
+	}
+
+	return aesgcm.Seal(dst, nonce, data, nil), nil
 }
 
+// SymmetricDecrypt расшифровывает данные любого формата: целиком, потоковые и сохраненные
+// до появления версий формата. Потоковые данные расшифровываются в память целиком.
 func SymmetricDecrypt(password string, encryptData []byte) ([]byte, error) {
 
-	key := sha256.Sum256([]byte(password))
+	key := symmetricKey(password)
 
-	aesblock, err := aes.NewCipher(key[:])
+	aesgcm, err := newGCM(key[:])
 	if err != nil {
-		return nil, fmt.Errorf("cannot crate new cipher.Block: %w", err)
+		return nil, err
 	}
 
-	aesgcm, err := cipher.NewGCM(aesblock)
-	if err != nil {
-		return nil, fmt.Errorf("cannot crate new block cipher wrapped in Galois Counter Mode: %w", err)
+	//Первый байт старого шифротекста случаен и может совпасть с версией,
+	//поэтому при ошибке пробуем расшифровать данные как старые
+	var versionErr error
+	switch {
+	case len(encryptData) >= 1+aesgcm.NonceSize()+aesgcm.Overhead() && encryptData[0] == sealedVersion:
+		nonce := encryptData[1 : 1+aesgcm.NonceSize()]
+		data, err := aesgcm.Open(nil, nonce, encryptData[1+aesgcm.NonceSize():], nil)
+		if err == nil {
+			return data, nil
+		}
+		versionErr = err
+	case IsStream(encryptData):
+		reader, err := NewDecryptReader(password, bytes.NewReader(encryptData))
+		if err == nil {
+			var data []byte
+			if data, err = io.ReadAll(reader); err == nil {
+				return data, nil
+			}
+		}
+		versionErr = err
 	}
 
 	nonce := key[len(key)-aesgcm.NonceSize():]
 
 	data, err := aesgcm.Open(nil, nonce, encryptData, nil) // расшифровываем
 	if err != nil {
+		if versionErr != nil {
+			err = versionErr
+		}
 		return nil, fmt.Errorf("cannot decrypt data: %w", err)
 	}
 
@@ -10,12 +10,17 @@ const (
 	contextTimeOut = 2 * time.Second
 )
 
+// unboundedKey ключ контекста запроса без deadline
+type unboundedKey struct{}
+
 // Middleware Устанавливаем deadline для контекста
 func Middleware(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
 		if _, ok := r.Context().Deadline(); !ok {
-			ctx, cancel := context.WithTimeout(r.Context(), contextTimeOut)
+			//Исходный контекст сохраняем для потоковой передачи данных, см. Unbounded
+			ctx := context.WithValue(r.Context(), unboundedKey{}, r.Context())
+			ctx, cancel := context.WithTimeout(ctx, contextTimeOut)
 			defer cancel()
 			h.ServeHTTP(w, r.WithContext(ctx))
 		} else {
@@ -23,3 +28,20 @@ func Middleware(h http.Handler) http.Handler {
 		}
 	})
 }
+
+// Unbounded возвращает контекст запроса без deadline, установленного Middleware.
+// Нужен для потоковой передачи больших данных, которая длится дольше contextTimeOut;
+// отмена контекста при разрыве соединения сохраняется.
+func Unbounded(ctx context.Context) context.Context {
+	if unbounded, ok := ctx.Value(unboundedKey{}).(context.Context); ok {
+		return unbounded
+	}
+	return ctx
+}
+
+// Renew возвращает контекст запроса с deadline, отсчитанным заново от текущего момента.
+// Нужен после потоковой передачи через Unbounded: исходный deadline запроса к этому времени
+// мог уже истечь, а оставшиеся короткие операции должны быть ограничены по времени.
+func Renew(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(Unbounded(ctx), contextTimeOut)
+}
@@ -0,0 +1,238 @@
+// Package generator создает случайные пароли по правилам и парольные фразы diceware из списка слов EFF.
+package generator
+
+import (
+	"bufio"
+	"crypto/rand"
+	_ "embed"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Наборы символов паролей. Похожие символы (ambiguousChars) легко спутать при вводе с экрана.
+const (
+	lowerChars     = "abcdefghijklmnopqrstuvwxyz"
+	upperChars     = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	digitChars     = "0123456789"
+	symbolChars    = "!#$%&*+-=?@^_~()[]{}<>.,:;/|"
+	ambiguousChars = "Il1|O0o"
+
+	minPasswordLength = 4
+	maxPasswordLength = 1024
+	minPassphrase     = 3
+	maxPassphrase     = 64
+)
+
+// effLargeWordlist большой список слов EFF для diceware (https://www.eff.org/dice, CC BY 3.0 US):
+// 7776 слов, каждое дает log2(7776) ≈ 12.9 бит энтропии
+//
+//go:embed eff_large_wordlist.txt
+var effLargeWordlist string
+
+// wordlist слова из effLargeWordlist, строка файла - номер броска костей и слово через табуляцию
+var wordlist = sync.OnceValue(func() []string {
+	words := make([]string, 0, 7776)
+	scanner := bufio.NewScanner(strings.NewReader(effLargeWordlist))
+	for scanner.Scan() {
+		if _, word, ok := strings.Cut(scanner.Text(), "\t"); ok {
+			words = append(words, word)
+		}
+	}
+	return words
+})
+
+// PasswordPolicy правила генерации пароля. Класс символов участвует, если он включен, минимальное
+// количество символов класса учитывается только для включенного класса.
+type PasswordPolicy struct {
+	Length           int  // длина пароля
+	Lower            bool // строчные латинские буквы
+	Upper            bool // прописные латинские буквы
+	Digits           bool // цифры
+	Symbols          bool // знаки
+	MinLower         int  // не меньше строчных букв
+	MinUpper         int  // не меньше прописных букв
+	MinDigits        int  // не меньше цифр
+	MinSymbols       int  // не меньше знаков
+	ExcludeAmbiguous bool // без похожих символов: I, l, 1, |, O, 0, o
+}
+
+// PassphrasePolicy правила генерации парольной фразы из слов списка EFF
+type PassphrasePolicy struct {
+	Words      int    // количество слов
+	Separator  string // разделитель слов
+	Capitalize bool   // слова с прописной буквы
+	Number     bool   // случайная цифра после случайного слова
+}
+
+// DefaultPasswordPolicy пароль из 20 символов всех классов, хотя бы по одному каждого
+var DefaultPasswordPolicy = PasswordPolicy{
+	Length:  20,
+	Lower:   true,
+	Upper:   true,
+	Digits:  true,
+	Symbols: true,
+
+	MinLower:   1,
+	MinUpper:   1,
+	MinDigits:  1,
+	MinSymbols: 1,
+}
+
+// DefaultPassphrasePolicy шесть слов через дефис, около 77 бит энтропии
+var DefaultPassphrasePolicy = PassphrasePolicy{
+	Words:     6,
+	Separator: "-",
+}
+
+// passwordClass класс символов пароля с минимальным количеством
+type passwordClass struct {
+	name  string
+	chars string
+	min   int
+}
+
+// Password создает пароль по правилам policy из crypto/rand и возвращает его с оценкой энтропии в битах.
+// Сначала выбираются обязательные символы классов, затем остальные из всех включенных классов,
+// после чего символы перемешиваются, чтобы обязательные не стояли в начале.
+func Password(policy PasswordPolicy) (string, float64, error) {
+	if policy.Length < minPasswordLength || policy.Length > maxPasswordLength {
+		return ``, 0, fmt.Errorf("password length must be from %d to %d", minPasswordLength, maxPasswordLength)
+	}
+
+	var classes []passwordClass
+	required := 0
+	for _, class := range []struct {
+		enabled bool
+		passwordClass
+	}{
+		{policy.Lower, passwordClass{"lowercase", lowerChars, policy.MinLower}},
+		{policy.Upper, passwordClass{"uppercase", upperChars, policy.MinUpper}},
+		{policy.Digits, passwordClass{"digits", digitChars, policy.MinDigits}},
+		{policy.Symbols, passwordClass{"symbols", symbolChars, policy.MinSymbols}},
+	} {
+		if class.min < 0 {
+			return ``, 0, fmt.Errorf("negative minimum of %s", class.name)
+		}
+		if !class.enabled {
+			if class.min > 0 {
+				return ``, 0, fmt.Errorf("minimum of %s is set, but %s are disabled", class.name, class.name)
+			}
+			continue
+		}
+
+		if policy.ExcludeAmbiguous {
+			class.chars = strings.Map(func(r rune) rune {
+				if strings.ContainsRune(ambiguousChars, r) {
+					return -1
+				}
+				return r
+			}, class.chars)
+		}
+		classes = append(classes, class.passwordClass)
+		required += class.min
+	}
+
+	if len(classes) == 0 {
+		return ``, 0, fmt.Errorf("no character classes enabled")
+	}
+	if required > policy.Length {
+		return ``, 0, fmt.Errorf("class minimums sum to %d, more than password length %d", required, policy.Length)
+	}
+
+	var all strings.Builder
+	password := make([]byte, 0, policy.Length)
+	for _, class := range classes {
+		all.WriteString(class.chars)
+		for range class.min {
+			c, err := randomChar(class.chars)
+			if err != nil {
+				return ``, 0, err
+			}
+			password = append(password, c)
+		}
+	}
+
+	alphabet := all.String()
+	for len(password) < policy.Length {
+		c, err := randomChar(alphabet)
+		if err != nil {
+			return ``, 0, err
+		}
+		password = append(password, c)
+	}
+
+	//Тасование Фишера - Йетса
+	for i := len(password) - 1; i > 0; i-- {
+		j, err := randomInt(i + 1)
+		if err != nil {
+			return ``, 0, err
+		}
+		password[i], password[j] = password[j], password[i]
+	}
+
+	//Оценка сверху: обязательные символы немного сужают выбор, но для разумных минимумов это доли бита
+	return string(password), float64(policy.Length) * math.Log2(float64(len(alphabet))), nil
+}
+
+// Passphrase создает парольную фразу diceware из слов списка EFF и возвращает ее с энтропией в битах.
+// Прописные буквы не добавляют энтропии: они известны из правил.
+func Passphrase(policy PassphrasePolicy) (string, float64, error) {
+	if policy.Words < minPassphrase || policy.Words > maxPassphrase {
+		return ``, 0, fmt.Errorf("passphrase words must be from %d to %d", minPassphrase, maxPassphrase)
+	}
+
+	words := wordlist()
+	phrase := make([]string, policy.Words)
+	for i := range phrase {
+		n, err := randomInt(len(words))
+		if err != nil {
+			return ``, 0, err
+		}
+		phrase[i] = words[n]
+
+		if policy.Capitalize {
+			runes := []rune(phrase[i])
+			runes[0] = unicode.ToUpper(runes[0])
+			phrase[i] = string(runes)
+		}
+	}
+
+	entropy := float64(policy.Words) * math.Log2(float64(len(words)))
+
+	if policy.Number {
+		word, err := randomInt(len(phrase))
+		if err != nil {
+			return ``, 0, err
+		}
+		digit, err := randomChar(digitChars)
+		if err != nil {
+			return ``, 0, err
+		}
+		phrase[word] += string(digit)
+		entropy += math.Log2(float64(len(digitChars) * len(phrase)))
+	}
+
+	return strings.Join(phrase, policy.Separator), entropy, nil
+}
+
+// randomChar равновероятно выбирает символ из chars
+func randomChar(chars string) (byte, error) {
+	n, err := randomInt(len(chars))
+	if err != nil {
+		return 0, err
+	}
+	return chars[n], nil
+}
+
+// randomInt равновероятное число от 0 до n-1 из crypto/rand
+func randomInt(n int) (int, error) {
+	value, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, fmt.Errorf("cannot generate random number: %w", err)
+	}
+	return int(value.Int64()), nil
+}
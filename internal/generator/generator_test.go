@@ -0,0 +1,208 @@
+package generator
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"unicode"
+)
+
+// countClass считает символы password из набора chars
+func countClass(password, chars string) int {
+	count := 0
+	for _, r := range password {
+		if strings.ContainsRune(chars, r) {
+			count++
+		}
+	}
+	return count
+}
+
+// TestPasswordMinimums проверяет длину, минимумы включенных классов и отсутствие символов выключенных
+func TestPasswordMinimums(t *testing.T) {
+	all := float64(len(lowerChars + upperChars + digitChars + symbolChars))
+
+	tests := []struct {
+		name    string
+		policy  PasswordPolicy
+		entropy float64
+	}{
+		{"default", DefaultPasswordPolicy, 20 * math.Log2(all)},
+		{"only minimums", PasswordPolicy{Length: 8, Lower: true, Upper: true, Digits: true, Symbols: true,
+			MinLower: 2, MinUpper: 2, MinDigits: 2, MinSymbols: 2}, 8 * math.Log2(all)},
+		{"digits", PasswordPolicy{Length: 6, Digits: true}, 6 * math.Log2(10)},
+		{"lower and digits", PasswordPolicy{Length: 12, Lower: true, Digits: true, MinDigits: 5}, 12 * math.Log2(36)},
+	}
+
+	classes := []struct {
+		chars   string
+		enabled func(PasswordPolicy) bool
+		min     func(PasswordPolicy) int
+	}{
+		{lowerChars, func(p PasswordPolicy) bool { return p.Lower }, func(p PasswordPolicy) int { return p.MinLower }},
+		{upperChars, func(p PasswordPolicy) bool { return p.Upper }, func(p PasswordPolicy) int { return p.MinUpper }},
+		{digitChars, func(p PasswordPolicy) bool { return p.Digits }, func(p PasswordPolicy) int { return p.MinDigits }},
+		{symbolChars, func(p PasswordPolicy) bool { return p.Symbols }, func(p PasswordPolicy) int { return p.MinSymbols }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			//Символы выбираются случайно, поэтому правила проверяются на многих паролях
+			for range 200 {
+				password, entropy, err := Password(tt.policy)
+				if err != nil {
+					t.Fatalf("Password() error = %v", err)
+				}
+				if len(password) != tt.policy.Length {
+					t.Fatalf("Password() = %q, want length %d", password, tt.policy.Length)
+				}
+				if math.Abs(entropy-tt.entropy) > 1e-9 {
+					t.Fatalf("Password() entropy = %f, want %f", entropy, tt.entropy)
+				}
+
+				total := 0
+				for _, class := range classes {
+					count := countClass(password, class.chars)
+					total += count
+					if !class.enabled(tt.policy) && count > 0 {
+						t.Fatalf("Password() = %q has characters of disabled class %q", password, class.chars)
+					}
+					if count < class.min(tt.policy) {
+						t.Fatalf("Password() = %q has %d characters of %q, want at least %d",
+							password, count, class.chars, class.min(tt.policy))
+					}
+				}
+				if total != len(password) {
+					t.Fatalf("Password() = %q has characters outside of classes", password)
+				}
+			}
+		})
+	}
+}
+
+// TestPasswordExcludeAmbiguous проверяет, что похожие символы исключаются и не учитываются в энтропии
+func TestPasswordExcludeAmbiguous(t *testing.T) {
+	policy := DefaultPasswordPolicy
+	policy.ExcludeAmbiguous = true
+
+	//Все похожие символы входят в наборы классов
+	all := len(lowerChars + upperChars + digitChars + symbolChars)
+	want := float64(policy.Length) * math.Log2(float64(all-len(ambiguousChars)))
+	for range 200 {
+		password, entropy, err := Password(policy)
+		if err != nil {
+			t.Fatalf("Password() error = %v", err)
+		}
+		if strings.ContainsAny(password, ambiguousChars) {
+			t.Fatalf("Password() = %q has ambiguous characters", password)
+		}
+		if math.Abs(entropy-want) > 1e-9 {
+			t.Fatalf("Password() entropy = %f, want %f", entropy, want)
+		}
+	}
+}
+
+// TestPasswordErrors проверяет отказ при невыполнимых правилах
+func TestPasswordErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy PasswordPolicy
+		want   string
+	}{
+		{"too short", PasswordPolicy{Length: minPasswordLength - 1, Lower: true}, "password length"},
+		{"too long", PasswordPolicy{Length: maxPasswordLength + 1, Lower: true}, "password length"},
+		{"no classes", PasswordPolicy{Length: 10}, "no character classes"},
+		{"minimums longer than length", PasswordPolicy{Length: 5, Lower: true, Digits: true, MinLower: 3, MinDigits: 3},
+			"more than password length"},
+		{"minimum of disabled class", PasswordPolicy{Length: 10, Lower: true, MinSymbols: 1}, "symbols are disabled"},
+		{"negative minimum", PasswordPolicy{Length: 10, Lower: true, MinLower: -1}, "negative minimum"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := Password(tt.policy)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Password() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// TestPassphrase проверяет количество слов, разделитель, прописные буквы, цифру и энтропию
+func TestPassphrase(t *testing.T) {
+	words := make(map[string]bool, len(wordlist()))
+	for _, word := range wordlist() {
+		words[word] = true
+	}
+	if len(words) != 7776 {
+		t.Fatalf("wordlist has %d unique words, want 7776", len(words))
+	}
+
+	tests := []struct {
+		name    string
+		policy  PassphrasePolicy
+		entropy float64
+	}{
+		//Несколько слов списка содержат дефис, поэтому фраза с разделителем по умолчанию не делится обратно на слова
+		{"default words", PassphrasePolicy{Words: DefaultPassphrasePolicy.Words, Separator: " "}, 6 * math.Log2(7776)},
+		{"space", PassphrasePolicy{Words: 4, Separator: " "}, 4 * math.Log2(7776)},
+		{"capitalized with number", PassphrasePolicy{Words: 5, Separator: ".", Capitalize: true, Number: true},
+			5*math.Log2(7776) + math.Log2(10*5)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for range 50 {
+				phrase, entropy, err := Passphrase(tt.policy)
+				if err != nil {
+					t.Fatalf("Passphrase() error = %v", err)
+				}
+				if math.Abs(entropy-tt.entropy) > 1e-9 {
+					t.Fatalf("Passphrase() entropy = %f, want %f", entropy, tt.entropy)
+				}
+
+				parts := strings.Split(phrase, tt.policy.Separator)
+				if len(parts) != tt.policy.Words {
+					t.Fatalf("Passphrase() = %q has %d words, want %d", phrase, len(parts), tt.policy.Words)
+				}
+
+				numbers := 0
+				for _, part := range parts {
+					word := strings.TrimRightFunc(part, unicode.IsDigit)
+					if word != part {
+						numbers++
+						if len(part)-len(word) != 1 {
+							t.Fatalf("Passphrase() = %q, word %q has more than one digit", phrase, part)
+						}
+					}
+					if tt.policy.Capitalize {
+						if first := []rune(word)[0]; !unicode.IsUpper(first) {
+							t.Fatalf("Passphrase() = %q, word %q is not capitalized", phrase, part)
+						}
+						word = strings.ToLower(word[:1]) + word[1:]
+					}
+					if !words[word] {
+						t.Fatalf("Passphrase() = %q, word %q is not from the wordlist", phrase, part)
+					}
+				}
+
+				wantNumbers := 0
+				if tt.policy.Number {
+					wantNumbers = 1
+				}
+				if numbers != wantNumbers {
+					t.Fatalf("Passphrase() = %q has %d numbers, want %d", phrase, numbers, wantNumbers)
+				}
+			}
+		})
+	}
+}
+
+// TestPassphraseErrors проверяет отказ при количестве слов вне допустимого
+func TestPassphraseErrors(t *testing.T) {
+	for _, count := range []int{0, minPassphrase - 1, maxPassphrase + 1} {
+		if _, _, err := Passphrase(PassphrasePolicy{Words: count, Separator: "-"}); err == nil {
+			t.Errorf("Passphrase(%d words) error = nil, want error", count)
+		}
+	}
+}
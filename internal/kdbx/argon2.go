@@ -0,0 +1,255 @@
+package kdbx
+
+import (
+	"encoding/binary"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/blake2b"
+	"sync"
+)
+
+// golang.org/x/crypto/argon2 реализует только Argon2i и Argon2id версии 0x13,
+// а KeePass по умолчанию использует Argon2d, поэтому он реализован здесь по RFC 9106.
+const (
+	argon2Version10 = 0x10
+	argon2Version13 = 0x13
+
+	argon2BlockWords = 128 // размер блока памяти в 64-битных словах
+	argon2SyncPoints = 4   // число отрезков в полосе
+	argon2TypeD      = 0   // тип Argon2d в начальном хэше
+)
+
+type argon2Block [argon2BlockWords]uint64
+
+// argon2Params параметры KDF Argon2 из заголовка базы
+type argon2Params struct {
+	id          bool   // Argon2id, иначе Argon2d
+	salt        []byte // соль
+	parallelism uint32 // число полос
+	memory      uint64 // объем памяти в байтах
+	iterations  uint64 // число проходов
+	version     uint32 // версия алгоритма
+}
+
+// deriveArgon2 преобразует составной ключ базы
+func deriveArgon2(key []byte, p argon2Params) ([]byte, error) {
+	if p.memory > argon2MaxMemory || p.iterations > argon2MaxIterations {
+		return nil, fmt.Errorf("%w: argon2 memory %d MiB, %d iterations, at most %d MiB and %d iterations",
+			ErrUnsupportedKDF, p.memory>>20, p.iterations, argon2MaxMemory>>20, argon2MaxIterations)
+	}
+
+	memory := p.memory / 1024
+	if p.parallelism == 0 || p.parallelism > 1<<24-1 || p.iterations == 0 || memory < 8*uint64(p.parallelism) {
+		return nil, fmt.Errorf("bad argon2 parameters")
+	}
+	if p.version != argon2Version10 && p.version != argon2Version13 {
+		return nil, fmt.Errorf("unsupported argon2 version %#x", p.version)
+	}
+
+	if p.id {
+		if p.version != argon2Version13 || p.parallelism > 255 {
+			return nil, fmt.Errorf("unsupported argon2id parameters")
+		}
+		return argon2.IDKey(key, p.salt, uint32(p.iterations), uint32(memory), uint8(p.parallelism), 32), nil
+	}
+
+	return argon2d(key, p.salt, nil, nil, uint32(p.iterations), uint32(memory), p.parallelism, p.version), nil
+}
+
+// argon2d вычисляет 32-байтный ключ Argon2d, memory в килобайтах.
+// KeePass не использует секрет и связанные данные, они нужны для проверки по векторам RFC 9106.
+func argon2d(password, salt, secret, data []byte, passes, memory, lanes, version uint32) []byte {
+	const keyLen = 32
+
+	//Начальный хэш от параметров, пароля и соли
+	h, _ := blake2b.New512(nil)
+	for _, v := range []uint32{lanes, keyLen, memory, passes, version, argon2TypeD} {
+		h.Write(binary.LittleEndian.AppendUint32(nil, v))
+	}
+	for _, v := range [][]byte{password, salt, secret, data} {
+		h.Write(binary.LittleEndian.AppendUint32(nil, uint32(len(v))))
+		h.Write(v)
+	}
+	h0 := h.Sum(make([]byte, 0, blake2b.Size+8))[:blake2b.Size+8]
+
+	memory = memory / (argon2SyncPoints * lanes) * (argon2SyncPoints * lanes)
+	laneLength := memory / lanes
+	segmentLength := laneLength / argon2SyncPoints
+
+	//Первые два блока каждой полосы
+	blocks := make([]argon2Block, memory)
+	var buf [1024]byte
+	for lane := uint32(0); lane < lanes; lane++ {
+		binary.LittleEndian.PutUint32(h0[blake2b.Size+4:], lane)
+		for i := uint32(0); i < 2; i++ {
+			binary.LittleEndian.PutUint32(h0[blake2b.Size:], i)
+			argon2Hash(buf[:], h0)
+			for j := range blocks[lane*laneLength+i] {
+				blocks[lane*laneLength+i][j] = binary.LittleEndian.Uint64(buf[j*8:])
+			}
+		}
+	}
+
+	segment := func(pass, slice, lane uint32) {
+		index := uint32(0)
+		if pass == 0 && slice == 0 {
+			index = 2
+		}
+
+		offset := lane*laneLength + slice*segmentLength + index
+		for ; index < segmentLength; index, offset = index+1, offset+1 {
+			prev := offset - 1
+			if index == 0 && slice == 0 {
+				prev += laneLength
+			}
+
+			ref := argon2Ref(blocks[prev][0], laneLength, segmentLength, lanes, pass, slice, lane, index)
+			//Версия 0x10 перезаписывает блоки, 0x13 на повторных проходах смешивает с прежним содержимым
+			argon2Compress(&blocks[offset], &blocks[prev], &blocks[ref], version == argon2Version13 && pass > 0)
+		}
+	}
+
+	for pass := uint32(0); pass < passes; pass++ {
+		for slice := uint32(0); slice < argon2SyncPoints; slice++ {
+			var wg sync.WaitGroup
+			for lane := uint32(0); lane < lanes; lane++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					segment(pass, slice, lane)
+				}()
+			}
+			wg.Wait()
+		}
+	}
+
+	//Ключ - хэш от XOR последних блоков всех полос
+	last := blocks[memory-1]
+	for lane := uint32(0); lane < lanes-1; lane++ {
+		for i, v := range blocks[lane*laneLength+laneLength-1] {
+			last[i] ^= v
+		}
+	}
+	for i, v := range last {
+		binary.LittleEndian.PutUint64(buf[i*8:], v)
+	}
+
+	key := make([]byte, keyLen)
+	argon2Hash(key, buf[:])
+
+	return key
+}
+
+// argon2Ref номер блока, с которым смешивается текущий блок
+func argon2Ref(random uint64, laneLength, segmentLength, lanes, pass, slice, lane, index uint32) uint32 {
+	refLane := uint32(random>>32) % lanes
+	if pass == 0 && slice == 0 {
+		refLane = lane
+	}
+
+	//Размер и начало доступной области
+	area, start := 3*segmentLength, ((slice+1)%argon2SyncPoints)*segmentLength
+	if lane == refLane {
+		area += index
+	}
+	if pass == 0 {
+		area, start = slice*segmentLength, 0
+		if slice == 0 || lane == refLane {
+			area += index
+		}
+	}
+	if index == 0 || lane == refLane {
+		area--
+	}
+
+	x := random & 0xFFFFFFFF
+	x = (x * x) >> 32
+	x = (uint64(area) * x) >> 32
+
+	return refLane*laneLength + uint32((uint64(start)+uint64(area)-(x+1))%uint64(laneLength))
+}
+
+// argon2Compress функция сжатия G: out = G(x, y) или out ^= G(x, y)
+func argon2Compress(out, x, y *argon2Block, xor bool) {
+	var r, t argon2Block
+	for i := range r {
+		r[i] = x[i] ^ y[i]
+	}
+	t = r
+
+	//Перестановка по строкам из 16 слов, затем по столбцам из пар слов
+	for i := 0; i < argon2BlockWords; i += 16 {
+		blamkaRound(&t, i, i+1, i+2, i+3, i+4, i+5, i+6, i+7, i+8, i+9, i+10, i+11, i+12, i+13, i+14, i+15)
+	}
+	for i := 0; i < 16; i += 2 {
+		blamkaRound(&t, i, i+1, i+16, i+17, i+32, i+33, i+48, i+49, i+64, i+65, i+80, i+81, i+96, i+97, i+112, i+113)
+	}
+
+	for i := range t {
+		if xor {
+			out[i] ^= t[i] ^ r[i]
+		} else {
+			out[i] = t[i] ^ r[i]
+		}
+	}
+}
+
+// blamkaRound раунд BLAKE2b с умножением в функции смешивания над 16 словами блока
+func blamkaRound(b *argon2Block, i ...int) {
+	blamka(b, i[0], i[4], i[8], i[12])
+	blamka(b, i[1], i[5], i[9], i[13])
+	blamka(b, i[2], i[6], i[10], i[14])
+	blamka(b, i[3], i[7], i[11], i[15])
+	blamka(b, i[0], i[5], i[10], i[15])
+	blamka(b, i[1], i[6], i[11], i[12])
+	blamka(b, i[2], i[7], i[8], i[13])
+	blamka(b, i[3], i[4], i[9], i[14])
+}
+
+func blamka(b *argon2Block, a, c, d, e int) {
+	mix := func(x, y uint64) uint64 {
+		return x + y + 2*uint64(uint32(x))*uint64(uint32(y))
+	}
+	rotr := func(x uint64, n uint) uint64 {
+		return x>>n | x<<(64-n)
+	}
+
+	b[a] = mix(b[a], b[c])
+	b[e] = rotr(b[e]^b[a], 32)
+	b[d] = mix(b[d], b[e])
+	b[c] = rotr(b[c]^b[d], 24)
+	b[a] = mix(b[a], b[c])
+	b[e] = rotr(b[e]^b[a], 16)
+	b[d] = mix(b[d], b[e])
+	b[c] = rotr(b[c]^b[d], 63)
+}
+
+// argon2Hash хэш переменной длины H' на основе BLAKE2b
+func argon2Hash(out, in []byte) {
+	prefix := binary.LittleEndian.AppendUint32(nil, uint32(len(out)))
+
+	if len(out) <= blake2b.Size {
+		h, _ := blake2b.New(len(out), nil)
+		h.Write(prefix)
+		h.Write(in)
+		h.Sum(out[:0])
+		return
+	}
+
+	h, _ := blake2b.New512(nil)
+	h.Write(prefix)
+	h.Write(in)
+	v := h.Sum(nil)
+
+	//Из каждого промежуточного хэша берется первая половина, последний хэш - целиком
+	n := copy(out, v[:blake2b.Size/2])
+	for len(out)-n > blake2b.Size {
+		sum := blake2b.Sum512(v)
+		v = sum[:]
+		n += copy(out[n:], v[:blake2b.Size/2])
+	}
+
+	h, _ = blake2b.New(len(out)-n, nil)
+	h.Write(v)
+	h.Sum(out[n:n])
+}
@@ -0,0 +1,42 @@
+package kdbx
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+// TestArgon2d проверяет Argon2d по контрольному вектору RFC 9106, раздел 5.1
+func TestArgon2d(t *testing.T) {
+	password := bytes.Repeat([]byte{0x01}, 32)
+	salt := bytes.Repeat([]byte{0x02}, 16)
+	secret := bytes.Repeat([]byte{0x03}, 8)
+	data := bytes.Repeat([]byte{0x04}, 12)
+
+	want := "512b391b6f1162975371d30919734294f868e3be3984f3c1a13a4db9fabe4acb"
+	if got := hex.EncodeToString(argon2d(password, salt, secret, data, 3, 32, 4, argon2Version13)); got != want {
+		t.Errorf("argon2d() = %s, want %s", got, want)
+	}
+}
+
+// TestDeriveArgon2Params проверяет отказ на параметрах, с которыми Argon2 не вычисляется
+func TestDeriveArgon2Params(t *testing.T) {
+	tests := []struct {
+		name   string
+		params argon2Params
+	}{
+		{"no lanes", argon2Params{memory: 64 << 10, iterations: 1, version: argon2Version13}},
+		{"no iterations", argon2Params{parallelism: 1, memory: 64 << 10, version: argon2Version13}},
+		{"too little memory", argon2Params{parallelism: 4, memory: 16 << 10, iterations: 1, version: argon2Version13}},
+		{"unknown version", argon2Params{parallelism: 1, memory: 64 << 10, iterations: 1, version: 0x12}},
+		{"argon2id version 0x10", argon2Params{id: true, parallelism: 1, memory: 64 << 10, iterations: 1, version: argon2Version10}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := deriveArgon2([]byte("key"), tt.params); err == nil {
+				t.Error("deriveArgon2() error = nil, want error")
+			}
+		})
+	}
+}
@@ -0,0 +1,259 @@
+package kdbx
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// fixturePassword пароль баз в testdata
+const fixturePassword = "abcdefg12345678"
+
+// readFixture читает базу из testdata с паролем и необязательным ключевым файлом
+func readFixture(t *testing.T, name, keyFile string) (*Database, []byte) {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var keyData []byte
+	if keyFile != "" {
+		if keyData, err = os.ReadFile(filepath.Join("testdata", keyFile)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	key, err := NewKey(fixturePassword, keyData)
+	if err != nil {
+		t.Fatalf("NewKey() error = %v", err)
+	}
+
+	db, err := Read(bytes.NewReader(data), key)
+	if err != nil {
+		t.Fatalf("Read(%s) error = %v", name, err)
+	}
+
+	return db, data
+}
+
+// findGroup ищет вложенную группу корня по названию
+func findGroup(t *testing.T, root Group, name string) Group {
+	t.Helper()
+
+	for _, group := range root.Groups {
+		if group.Name == name {
+			return group
+		}
+	}
+	t.Fatalf("group %s is missing", name)
+
+	return Group{}
+}
+
+// checkEntry сравнивает поля и вложения записи с ожидаемыми
+func checkEntry(t *testing.T, entry Entry, fields []Field, attachments []Attachment) {
+	t.Helper()
+
+	for _, want := range fields {
+		i := slices.IndexFunc(entry.Fields, func(f Field) bool { return f.Key == want.Key })
+		if i < 0 {
+			t.Errorf("%s: field %s is missing", entry.Get(FieldTitle), want.Key)
+		} else if entry.Fields[i] != want {
+			t.Errorf("%s: field %s = %+v, want %+v", entry.Get(FieldTitle), want.Key, entry.Fields[i], want)
+		}
+	}
+
+	if len(entry.Attachments) != len(attachments) {
+		t.Fatalf("%s: attachments = %d, want %d", entry.Get(FieldTitle), len(entry.Attachments), len(attachments))
+	}
+	for i, want := range attachments {
+		if got := entry.Attachments[i]; got.Name != want.Name || !bytes.Equal(got.Data, want.Data) {
+			t.Errorf("%s: attachment = %s %q, want %s %q", entry.Get(FieldTitle), got.Name, got.Data, want.Name, want.Data)
+		}
+	}
+}
+
+func TestReadFixtures(t *testing.T) {
+	tests := []struct {
+		name       string
+		keyFile    string
+		cipher     UUID
+		compressed bool
+		copied     bool // база содержит копию записи с вложением и произвольным полем
+	}{
+		{"aes-argon2d.kdbx", "", cipherAES, true, true},
+		{"chacha20-argon2d.kdbx", "", cipherChaCha, true, true},
+		{"aes-argon2d-nocompression.kdbx", "", cipherAES, false, true},
+		{"aes-argon2d-keyfile.kdbx", "aes-argon2d-keyfile.key", cipherAES, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, data := readFixture(t, tt.name, tt.keyFile)
+
+			h, err := readHeader(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("readHeader() error = %v", err)
+			}
+			if h.cipher != tt.cipher || h.compressed != tt.compressed {
+				t.Errorf("header = %x compressed %v, want %x compressed %v", h.cipher, h.compressed, tt.cipher, tt.compressed)
+			}
+			if kdf, _ := h.kdf["$UUID"].([]byte); !bytes.Equal(kdf, kdfArgon2d[:]) {
+				t.Errorf("kdf = %x, want %x", kdf, kdfArgon2d)
+			}
+
+			if db.Root.Name != "example" {
+				t.Errorf("root = %s, want example", db.Root.Name)
+			}
+			if bin := findGroup(t, db.Root, "Recycle Bin"); db.RecycleBin != bin.UUID {
+				t.Errorf("recycle bin = %x, want %x", db.RecycleBin, bin.UUID)
+			}
+
+			general := findGroup(t, db.Root, "General")
+			if len(general.Entries) != 2 {
+				t.Fatalf("General entries = %d, want 2", len(general.Entries))
+			}
+			checkEntry(t, general.Entries[0], []Field{
+				{Key: FieldTitle, Value: "Sample Entry"},
+				{Key: FieldUserName, Value: "User Name"},
+				{Key: FieldPassword, Value: "Password", Protected: true},
+				{Key: FieldURL, Value: "http://keepass.info/"},
+				{Key: FieldNotes, Value: "Notes"},
+			}, nil)
+			checkEntry(t, general.Entries[1], []Field{
+				{Key: FieldTitle, Value: "Sample Entry2"},
+				{Key: FieldUserName, Value: "test"},
+				{Key: FieldPassword, Value: "AnotherPassword", Protected: true},
+			}, nil)
+
+			windows := findGroup(t, db.Root, "Windows")
+			want := 1
+			if tt.copied {
+				want = 2
+			}
+			if len(windows.Entries) != want {
+				t.Fatalf("Windows entries = %d, want %d", len(windows.Entries), want)
+			}
+			checkEntry(t, windows.Entries[0], []Field{{Key: FieldTitle, Value: "File test"}},
+				[]Attachment{{Name: "example.txt", Data: []byte("Hello world")}})
+			if tt.copied {
+				checkEntry(t, windows.Entries[1], []Field{
+					{Key: FieldTitle, Value: "File test - Copy"},
+					{Key: "test", Value: "prova", Protected: true},
+				}, []Attachment{{Name: "example.txt", Data: []byte("Hello world2")}})
+			}
+		})
+	}
+}
+
+func TestReadFixtureWrongKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+	}{
+		{"aes-argon2d.kdbx", "wrong"},
+		{"chacha20-argon2d.kdbx", "wrong"},
+		//Ключевой файл обязателен, одного пароля недостаточно
+		{"aes-argon2d-keyfile.kdbx", fixturePassword},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", tt.name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			key, err := NewKey(tt.password, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := Read(bytes.NewReader(data), key); !errors.Is(err, ErrBadKey) {
+				t.Errorf("Read() error = %v, want %v", err, ErrBadKey)
+			}
+		})
+	}
+}
+
+// TestWriteHeaderBytes разбирает внешний заголовок записанной базы по спецификации KDBX 4,
+// не используя код чтения пакета
+func TestWriteHeaderBytes(t *testing.T) {
+	data := writeDatabase(t, testDatabase(t), "password")
+
+	//Сигнатуры и версия 4.0 в little-endian
+	start := []byte{0x03, 0xd9, 0xa2, 0x9a, 0x67, 0xfb, 0x4b, 0xb5, 0x00, 0x00, 0x04, 0x00}
+	if !bytes.HasPrefix(data, start) {
+		t.Fatalf("file start = % x, want % x", data[:len(start)], start)
+	}
+
+	fields := make(map[byte][]byte)
+	var order []byte
+	pos := len(start)
+	for {
+		if pos+5 > len(data) {
+			t.Fatal("header is truncated")
+		}
+		id := data[pos]
+		size := int(binary.LittleEndian.Uint32(data[pos+1 : pos+5]))
+		pos += 5
+		if pos+size > len(data) {
+			t.Fatalf("field %d is truncated", id)
+		}
+		fields[id] = data[pos : pos+size]
+		order = append(order, id)
+		pos += size
+		if id == 0 {
+			break
+		}
+	}
+
+	if want := []byte{2, 3, 4, 7, 11, 0}; !bytes.Equal(order, want) {
+		t.Errorf("header fields = %v, want %v", order, want)
+	}
+
+	chacha := []byte{0xd6, 0x03, 0x8a, 0x2b, 0x8b, 0x6f, 0x4c, 0xb5, 0xa5, 0x24, 0x33, 0x9a, 0x31, 0xdb, 0xb5, 0x9a}
+	if !bytes.Equal(fields[2], chacha) {
+		t.Errorf("cipher id = % x, want ChaCha20 % x", fields[2], chacha)
+	}
+	if want := []byte{1, 0, 0, 0}; !bytes.Equal(fields[3], want) {
+		t.Errorf("compression = % x, want gzip % x", fields[3], want)
+	}
+	if len(fields[4]) != 32 {
+		t.Errorf("master seed = %d bytes, want 32", len(fields[4]))
+	}
+	if len(fields[7]) != 12 {
+		t.Errorf("iv = %d bytes, want 12", len(fields[7]))
+	}
+	if want := []byte("\r\n\r\n"); !bytes.Equal(fields[0], want) {
+		t.Errorf("end of header = %q, want %q", fields[0], want)
+	}
+
+	//Словарь KDF: версия 1.0, первым идет $UUID Argon2id
+	argon2id := []byte{0x9e, 0x29, 0x8b, 0x19, 0x56, 0xdb, 0x47, 0x73, 0xb2, 0x3d, 0xfc, 0x3e, 0xc6, 0xf0, 0xa1, 0xe6}
+	kdf := fields[11]
+	if len(kdf) < 2 || binary.LittleEndian.Uint16(kdf) != 0x0100 {
+		t.Fatalf("kdf dictionary version = % x, want 00 01", kdf[:min(len(kdf), 2)])
+	}
+	uuidItem := append([]byte{0x42, 5, 0, 0, 0}, "$UUID"...)
+	uuidItem = append(uuidItem, 16, 0, 0, 0)
+	uuidItem = append(uuidItem, argon2id...)
+	if !bytes.Contains(kdf, uuidItem) {
+		t.Errorf("kdf dictionary = % x, want $UUID Argon2id", kdf)
+	}
+	if kdf[len(kdf)-1] != 0 {
+		t.Error("kdf dictionary is not terminated")
+	}
+
+	//За заголовком следует его SHA-256
+	hash := sha256.Sum256(data[:pos])
+	if !bytes.Equal(data[pos:pos+32], hash[:]) {
+		t.Errorf("header hash = % x, want % x", data[pos:pos+32], hash)
+	}
+}
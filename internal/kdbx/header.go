@@ -0,0 +1,453 @@
+package kdbx
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"golang.org/x/crypto/chacha20"
+	"io"
+	"math"
+	"sort"
+)
+
+// Внешний заголовок KDBX 4 не зашифрован, его целостность проверяется SHA-256 и HMAC-SHA-256.
+// Содержимое базы разбито на блоки, каждый со своим HMAC, что защищает от перестановки и обрезки блоков.
+const (
+	signature1 = 0x9AA2D903
+	signature2 = 0xB54BFB67
+	version4   = 0x00040000
+
+	headerLimit      = 1 << 20        // ограничение размера внешнего заголовка
+	blockSize        = 1 << 20        // размер блока при записи
+	maxBlockSize     = 1 << 30        // ограничение размера блока при чтении
+	headerBlockIndex = math.MaxUint64 // номер блока для HMAC заголовка
+	seedSize         = 32             // размер начального значения мастер-ключа и соли KDF
+
+	argon2Memory     = 64 << 20 // объем памяти Argon2id при записи
+	argon2Iterations = 10       // число проходов Argon2id при записи
+	argon2Lanes      = 2        // число полос Argon2id при записи
+
+	argon2MaxMemory     = 1 << 30 // ограничение памяти Argon2 при чтении, байт
+	argon2MaxIterations = 1000    // ограничение числа проходов Argon2 при чтении
+	aesMaxRounds        = 1 << 28 // ограничение числа раундов AES-KDF при чтении, несколько секунд вычисления
+)
+
+// Поля внешнего заголовка
+const (
+	headerEnd         = 0
+	headerCipherID    = 2
+	headerCompression = 3
+	headerMasterSeed  = 4
+	headerIV          = 7
+	headerKdf         = 11
+)
+
+// Типы значений словаря параметров KDF
+const (
+	dictUint32 = 0x04
+	dictUint64 = 0x05
+	dictBool   = 0x08
+	dictInt32  = 0x0C
+	dictInt64  = 0x0D
+	dictString = 0x18
+	dictBytes  = 0x42
+
+	dictVersion = 0x0100
+)
+
+var (
+	cipherAES    = UUID{0x31, 0xc1, 0xf2, 0xe6, 0xbf, 0x71, 0x43, 0x50, 0xbe, 0x58, 0x05, 0x21, 0x6a, 0xfc, 0x5a, 0xff}
+	cipherChaCha = UUID{0xd6, 0x03, 0x8a, 0x2b, 0x8b, 0x6f, 0x4c, 0xb5, 0xa5, 0x24, 0x33, 0x9a, 0x31, 0xdb, 0xb5, 0x9a}
+	kdfAES       = UUID{0xc9, 0xd9, 0xf3, 0x9a, 0x62, 0x8a, 0x44, 0x60, 0xbf, 0x74, 0x0d, 0x08, 0xc1, 0x8a, 0x4f, 0xea}
+	kdfArgon2d   = UUID{0xef, 0x63, 0x6d, 0xdf, 0x8c, 0x29, 0x44, 0x4b, 0x91, 0xf7, 0xa9, 0xa4, 0x03, 0xe3, 0x0a, 0x0c}
+	kdfArgon2id  = UUID{0x9e, 0x29, 0x8b, 0x19, 0x56, 0xdb, 0x47, 0x73, 0xb2, 0x3d, 0xfc, 0x3e, 0xc6, 0xf0, 0xa1, 0xe6}
+)
+
+// header внешний заголовок базы
+type header struct {
+	raw        []byte         // заголовок целиком, от сигнатуры до поля конца заголовка
+	cipher     UUID           // шифр содержимого
+	compressed bool           // содержимое сжато gzip
+	masterSeed []byte         // начальное значение мастер-ключа
+	iv         []byte         // вектор инициализации шифра
+	kdf        map[string]any // параметры KDF
+}
+
+// newHeader заголовок новой базы: ChaCha20, Argon2id, сжатие gzip
+func newHeader() (*header, error) {
+	h := &header{
+		cipher:     cipherChaCha,
+		compressed: true,
+		masterSeed: make([]byte, seedSize),
+		iv:         make([]byte, chacha20.NonceSize),
+	}
+
+	salt := make([]byte, seedSize)
+	for _, b := range [][]byte{h.masterSeed, h.iv, salt} {
+		if _, err := rand.Read(b); err != nil {
+			return nil, fmt.Errorf("cannot generate header: %w", err)
+		}
+	}
+
+	h.kdf = map[string]any{
+		"$UUID": kdfArgon2id[:],
+		"S":     salt,
+		"P":     uint32(argon2Lanes),
+		"M":     uint64(argon2Memory),
+		"I":     uint64(argon2Iterations),
+		"V":     uint32(argon2Version13),
+	}
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, []uint32{signature1, signature2, version4})
+	writeField := func(id byte, data []byte) {
+		buf.WriteByte(id)
+		binary.Write(&buf, binary.LittleEndian, uint32(len(data)))
+		buf.Write(data)
+	}
+	writeField(headerCipherID, h.cipher[:])
+	writeField(headerCompression, binary.LittleEndian.AppendUint32(nil, 1))
+	writeField(headerMasterSeed, h.masterSeed)
+	writeField(headerIV, h.iv)
+	writeField(headerKdf, encodeDict(h.kdf))
+	writeField(headerEnd, []byte("\r\n\r\n"))
+	h.raw = buf.Bytes()
+
+	return h, nil
+}
+
+// readHeader читает внешний заголовок и проверяет его хэш
+func readHeader(r io.Reader) (*header, error) {
+	var buf bytes.Buffer
+	src := io.TeeReader(r, &buf)
+
+	var start [3]uint32
+	if err := binary.Read(src, binary.LittleEndian, &start); err != nil {
+		return nil, fmt.Errorf("cannot read database signature: %w", err)
+	}
+	if start[0] != signature1 || start[1] != signature2 {
+		return nil, fmt.Errorf("not a keepass database")
+	}
+	if start[2]>>16 != version4>>16 {
+		return nil, fmt.Errorf("unsupported database version %d.%d, only KDBX 4 is supported", start[2]>>16, start[2]&0xFFFF)
+	}
+
+	h := new(header)
+	for {
+		var id byte
+		var size uint32
+		if err := binary.Read(src, binary.LittleEndian, &id); err != nil {
+			return nil, fmt.Errorf("cannot read header field: %w", err)
+		}
+		if err := binary.Read(src, binary.LittleEndian, &size); err != nil {
+			return nil, fmt.Errorf("cannot read header field: %w", err)
+		}
+		if int64(buf.Len())+int64(size) > headerLimit {
+			return nil, fmt.Errorf("header is too large")
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(src, data); err != nil {
+			return nil, fmt.Errorf("cannot read header field: %w", err)
+		}
+
+		switch id {
+		case headerEnd:
+			h.raw = buf.Bytes()
+			return h, h.verify(r)
+		case headerCipherID:
+			if len(data) != len(h.cipher) {
+				return nil, fmt.Errorf("bad cipher id")
+			}
+			copy(h.cipher[:], data)
+		case headerCompression:
+			if len(data) != 4 || binary.LittleEndian.Uint32(data) > 1 {
+				return nil, fmt.Errorf("unsupported compression")
+			}
+			h.compressed = binary.LittleEndian.Uint32(data) == 1
+		case headerMasterSeed:
+			if len(data) != seedSize {
+				return nil, fmt.Errorf("bad master seed")
+			}
+			h.masterSeed = data
+		case headerIV:
+			h.iv = data
+		case headerKdf:
+			kdf, err := decodeDict(data)
+			if err != nil {
+				return nil, err
+			}
+			h.kdf = kdf
+		}
+		//Остальные поля, например, публичные пользовательские данные, не нужны для чтения
+	}
+}
+
+// verify проверяет SHA-256 заголовка, записанный после него
+func (m *header) verify(r io.Reader) error {
+	var stored [sha256.Size]byte
+	if _, err := io.ReadFull(r, stored[:]); err != nil {
+		return fmt.Errorf("cannot read header hash: %w", err)
+	}
+
+	if sum := sha256.Sum256(m.raw); !bytes.Equal(sum[:], stored[:]) {
+		return fmt.Errorf("database header is corrupted")
+	}
+
+	if m.masterSeed == nil || m.kdf == nil {
+		return fmt.Errorf("database header is incomplete")
+	}
+
+	return nil
+}
+
+// transformKey вычисляет преобразованный ключ по параметрам KDF
+func (m *header) transformKey(key *Key) ([]byte, error) {
+	id, _ := m.kdf["$UUID"].([]byte)
+	salt, _ := m.kdf["S"].([]byte)
+
+	switch UUID(pad16(id)) {
+	case kdfArgon2d, kdfArgon2id:
+		parallelism, _ := m.kdf["P"].(uint32)
+		memory, _ := m.kdf["M"].(uint64)
+		iterations, _ := m.kdf["I"].(uint64)
+		version, _ := m.kdf["V"].(uint32)
+
+		return deriveArgon2(key.hash[:], argon2Params{
+			id:          UUID(pad16(id)) == kdfArgon2id,
+			salt:        salt,
+			parallelism: parallelism,
+			memory:      memory,
+			iterations:  iterations,
+			version:     version,
+		})
+	case kdfAES:
+		rounds, _ := m.kdf["R"].(uint64)
+		return deriveAES(key.hash[:], salt, rounds)
+	default:
+		return nil, fmt.Errorf("unsupported key derivation function")
+	}
+}
+
+// decrypt расшифровывает содержимое базы
+func (m *header) decrypt(key, data []byte) ([]byte, error) {
+	switch m.cipher {
+	case cipherChaCha:
+		c, err := chacha20.NewUnauthenticatedCipher(key, m.iv)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create chacha20 cipher: %w", err)
+		}
+		c.XORKeyStream(data, data)
+		return data, nil
+	case cipherAES:
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create aes cipher: %w", err)
+		}
+		if len(m.iv) != aes.BlockSize || len(data) == 0 || len(data)%aes.BlockSize != 0 {
+			return nil, fmt.Errorf("bad aes encrypted data")
+		}
+		cipher.NewCBCDecrypter(block, m.iv).CryptBlocks(data, data)
+
+		//Дополнение PKCS#7
+		pad := int(data[len(data)-1])
+		if pad == 0 || pad > aes.BlockSize {
+			return nil, fmt.Errorf("bad aes padding")
+		}
+		return data[:len(data)-pad], nil
+	default:
+		return nil, fmt.Errorf("unsupported cipher, only AES-256 and ChaCha20 are supported")
+	}
+}
+
+// encrypt шифрует содержимое базы ChaCha20
+func (m *header) encrypt(key, data []byte) ([]byte, error) {
+	c, err := chacha20.NewUnauthenticatedCipher(key, m.iv)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create chacha20 cipher: %w", err)
+	}
+	c.XORKeyStream(data, data)
+	return data, nil
+}
+
+// encryptionKey ключ шифрования содержимого
+func encryptionKey(masterSeed, transformed []byte) []byte {
+	sum := sha256.Sum256(append(bytes.Clone(masterSeed), transformed...))
+	return sum[:]
+}
+
+// hmacBaseKey ключ, из которого выводятся ключи HMAC заголовка и блоков
+func hmacBaseKey(masterSeed, transformed []byte) []byte {
+	sum := sha512.Sum512(append(append(bytes.Clone(masterSeed), transformed...), 1))
+	return sum[:]
+}
+
+// blockHMAC HMAC блока с номером index
+func blockHMAC(baseKey []byte, index uint64, data []byte) []byte {
+	key := sha512.Sum512(append(binary.LittleEndian.AppendUint64(nil, index), baseKey...))
+
+	mac := hmac.New(sha256.New, key[:])
+	if index != headerBlockIndex {
+		mac.Write(binary.LittleEndian.AppendUint64(nil, index))
+		mac.Write(binary.LittleEndian.AppendUint32(nil, uint32(len(data))))
+	}
+	mac.Write(data)
+
+	return mac.Sum(nil)
+}
+
+func hmacValid(baseKey []byte, index uint64, data, stored []byte) bool {
+	return hmac.Equal(blockHMAC(baseKey, index, data), stored)
+}
+
+// readBlocks читает и проверяет блоки содержимого до пустого завершающего блока
+func readBlocks(r io.Reader, baseKey []byte) ([]byte, error) {
+	var payload []byte
+	for index := uint64(0); ; index++ {
+		var stored [sha256.Size]byte
+		var size uint32
+		if _, err := io.ReadFull(r, stored[:]); err != nil {
+			return nil, fmt.Errorf("cannot read block %d: %w", index, err)
+		}
+		if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+			return nil, fmt.Errorf("cannot read block %d: %w", index, err)
+		}
+		if size > maxBlockSize {
+			return nil, fmt.Errorf("block %d is too large", index)
+		}
+
+		data := make([]byte, size)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, fmt.Errorf("cannot read block %d: %w", index, err)
+		}
+		if !hmacValid(baseKey, index, data, stored[:]) {
+			return nil, fmt.Errorf("block %d is corrupted", index)
+		}
+
+		if size == 0 {
+			return payload, nil
+		}
+		payload = append(payload, data...)
+	}
+}
+
+// writeBlocks записывает содержимое блоками и пустой завершающий блок
+func writeBlocks(w io.Writer, baseKey []byte, payload []byte) error {
+	for index := uint64(0); ; index++ {
+		data := payload[:min(blockSize, len(payload))]
+		payload = payload[len(data):]
+
+		block := blockHMAC(baseKey, index, data)
+		block = binary.LittleEndian.AppendUint32(block, uint32(len(data)))
+		block = append(block, data...)
+		if _, err := w.Write(block); err != nil {
+			return fmt.Errorf("cannot write database: %w", err)
+		}
+
+		if len(data) == 0 {
+			return nil
+		}
+	}
+}
+
+// decodeDict разбирает словарь параметров
+func decodeDict(data []byte) (map[string]any, error) {
+	if len(data) < 2 || binary.LittleEndian.Uint16(data)>>8 != dictVersion>>8 {
+		return nil, fmt.Errorf("unsupported kdf parameters version")
+	}
+	data = data[2:]
+
+	next := func() ([]byte, bool) {
+		if len(data) < 4 {
+			return nil, false
+		}
+		size := binary.LittleEndian.Uint32(data)
+		if uint64(len(data)-4) < uint64(size) {
+			return nil, false
+		}
+		value := data[4 : 4+size]
+		data = data[4+size:]
+		return value, true
+	}
+
+	dict := make(map[string]any)
+	for len(data) > 0 {
+		kind := data[0]
+		data = data[1:]
+		if kind == 0 {
+			return dict, nil
+		}
+
+		name, ok := next()
+		if !ok {
+			break
+		}
+		value, ok := next()
+		if !ok {
+			break
+		}
+
+		switch {
+		case (kind == dictUint32 || kind == dictInt32) && len(value) == 4:
+			dict[string(name)] = binary.LittleEndian.Uint32(value)
+		case (kind == dictUint64 || kind == dictInt64) && len(value) == 8:
+			dict[string(name)] = binary.LittleEndian.Uint64(value)
+		case kind == dictBool && len(value) == 1:
+			dict[string(name)] = value[0] != 0
+		case kind == dictString || kind == dictBytes:
+			dict[string(name)] = value
+		default:
+			return nil, fmt.Errorf("bad kdf parameter %s", name)
+		}
+	}
+
+	return nil, fmt.Errorf("kdf parameters are truncated")
+}
+
+// encodeDict сериализует словарь параметров
+func encodeDict(dict map[string]any) []byte {
+	names := make([]string, 0, len(dict))
+	for name := range dict {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	data := binary.LittleEndian.AppendUint16(nil, dictVersion)
+	for _, name := range names {
+		var kind byte
+		var value []byte
+		switch v := dict[name].(type) {
+		case uint32:
+			kind, value = dictUint32, binary.LittleEndian.AppendUint32(nil, v)
+		case uint64:
+			kind, value = dictUint64, binary.LittleEndian.AppendUint64(nil, v)
+		case bool:
+			kind, value = dictBool, []byte{0}
+			if v {
+				value[0] = 1
+			}
+		case []byte:
+			kind, value = dictBytes, v
+		}
+
+		data = append(data, kind)
+		data = binary.LittleEndian.AppendUint32(data, uint32(len(name)))
+		data = append(data, name...)
+		data = binary.LittleEndian.AppendUint32(data, uint32(len(value)))
+		data = append(data, value...)
+	}
+
+	return append(data, 0)
+}
+
+// pad16 дополняет или обрезает идентификатор до размера UUID
+func pad16(b []byte) [16]byte {
+	var id [16]byte
+	copy(id[:], b)
+	return id
+}
@@ -0,0 +1,215 @@
+// Package kdbx читает и записывает базы KeePass в формате KDBX 4.
+// Поддерживаются шифры AES-256 и ChaCha20, KDF Argon2d, Argon2id и AES-KDF, пароль и файл ключа.
+package kdbx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+)
+
+// Стандартные поля записи KeePass
+const (
+	FieldTitle    = "Title"
+	FieldUserName = "UserName"
+	FieldPassword = "Password"
+	FieldURL      = "URL"
+	FieldNotes    = "Notes"
+)
+
+// ErrBadKey неверный пароль или файл ключа
+var ErrBadKey = errors.New("wrong password or key file")
+
+// ErrUnsupportedKDF параметры KDF из заголовка превышают ограничения чтения. Заголовок проверяется
+// только после вычисления ключа, поэтому без ограничений поддельная база исчерпала бы память или время.
+var ErrUnsupportedKDF = errors.New("unsupported KDF parameters")
+
+// UUID идентификатор группы или записи
+type UUID [16]byte
+
+// NewUUID создает случайный UUID версии 4
+func NewUUID() (UUID, error) {
+	var id UUID
+	if _, err := rand.Read(id[:]); err != nil {
+		return id, fmt.Errorf("cannot generate uuid: %w", err)
+	}
+	id[6] = id[6]&0x0f | 0x40
+	id[8] = id[8]&0x3f | 0x80
+	return id, nil
+}
+
+// IsZero проверяет, что UUID не задан
+func (m UUID) IsZero() bool {
+	return m == UUID{}
+}
+
+// Database содержимое базы
+type Database struct {
+	Name       string // название базы
+	Root       Group  // корневая группа
+	RecycleBin UUID   // группа корзины, нулевой - корзины нет
+}
+
+// Group группа записей
+type Group struct {
+	UUID    UUID
+	Name    string
+	Notes   string
+	Groups  []Group // вложенные группы
+	Entries []Entry // записи группы
+}
+
+// Entry запись базы. Кроме стандартных полей может содержать произвольные поля и вложения.
+type Entry struct {
+	UUID        UUID
+	Fields      []Field      // строковые поля в исходном порядке
+	Attachments []Attachment // вложения
+	Tags        []string     // теги
+	CreatedAt   time.Time    // время создания
+	UpdatedAt   time.Time    // время последнего изменения
+}
+
+// Field строковое поле записи
+type Field struct {
+	Key       string
+	Value     string
+	Protected bool // значение защищено в памяти KeePass, например, пароль
+}
+
+// Attachment вложение записи
+type Attachment struct {
+	Name string
+	Data []byte
+}
+
+// Get возвращает значение поля, пустая строка - поля нет
+func (m *Entry) Get(key string) string {
+	for _, field := range m.Fields {
+		if field.Key == key {
+			return field.Value
+		}
+	}
+	return ``
+}
+
+// Set задает значение поля, добавляя поле при необходимости
+func (m *Entry) Set(key, value string, protected bool) {
+	for i := range m.Fields {
+		if m.Fields[i].Key == key {
+			m.Fields[i].Value = value
+			m.Fields[i].Protected = protected
+			return
+		}
+	}
+	m.Fields = append(m.Fields, Field{Key: key, Value: value, Protected: protected})
+}
+
+// IsStandard проверяет, является ли поле стандартным полем записи
+func IsStandard(key string) bool {
+	return slices.Contains([]string{FieldTitle, FieldUserName, FieldPassword, FieldURL, FieldNotes}, key)
+}
+
+// Read читает и расшифровывает базу
+func Read(r io.Reader, key *Key) (*Database, error) {
+	h, err := readHeader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	transformed, err := h.transformKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	var stored [sha256.Size]byte
+	if _, err := io.ReadFull(r, stored[:]); err != nil {
+		return nil, fmt.Errorf("cannot read header hmac: %w", err)
+	}
+	hmacKey := hmacBaseKey(h.masterSeed, transformed)
+	if !hmacValid(hmacKey, headerBlockIndex, h.raw, stored[:]) {
+		return nil, ErrBadKey
+	}
+
+	payload, err := readBlocks(r, hmacKey)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err = h.decrypt(encryptionKey(h.masterSeed, transformed), payload)
+	if err != nil {
+		return nil, err
+	}
+
+	if h.compressed {
+		zr, err := gzip.NewReader(bytes.NewReader(payload))
+		if err != nil {
+			return nil, fmt.Errorf("cannot decompress database: %w", err)
+		}
+		if payload, err = io.ReadAll(zr); err != nil {
+			return nil, fmt.Errorf("cannot decompress database: %w", err)
+		}
+	}
+
+	inner, content, err := readInnerHeader(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeXML(content, inner)
+}
+
+// Write шифрует и записывает базу. База шифруется ChaCha20 с KDF Argon2id, содержимое сжимается.
+func Write(w io.Writer, db *Database, key *Key) error {
+	h, err := newHeader()
+	if err != nil {
+		return err
+	}
+
+	inner, err := newInnerHeader()
+	if err != nil {
+		return err
+	}
+
+	content, err := encodeXML(db, inner)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if err := inner.write(zw); err != nil {
+		return err
+	}
+	if _, err := zw.Write(content); err != nil {
+		return fmt.Errorf("cannot compress database: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("cannot compress database: %w", err)
+	}
+
+	transformed, err := h.transformKey(key)
+	if err != nil {
+		return err
+	}
+
+	payload, err := h.encrypt(encryptionKey(h.masterSeed, transformed), buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	hmacKey := hmacBaseKey(h.masterSeed, transformed)
+	headerHash := sha256.Sum256(h.raw)
+
+	out := slices.Concat(h.raw, headerHash[:], blockHMAC(hmacKey, headerBlockIndex, h.raw))
+	if _, err := w.Write(out); err != nil {
+		return fmt.Errorf("cannot write database: %w", err)
+	}
+
+	return writeBlocks(w, hmacKey, payload)
+}
@@ -0,0 +1,120 @@
+package kdbx
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+// Key составной ключ базы из пароля и необязательного файла ключа
+type Key struct {
+	hash [sha256.Size]byte
+}
+
+// NewKey создает составной ключ. Пустой пароль вместе с файлом ключа означает, что база защищена только файлом.
+func NewKey(password string, keyFile []byte) (*Key, error) {
+	var parts []byte
+
+	if password != `` || keyFile == nil {
+		sum := sha256.Sum256([]byte(password))
+		parts = append(parts, sum[:]...)
+	}
+
+	if keyFile != nil {
+		fileKey, err := parseKeyFile(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, fileKey...)
+	}
+
+	return &Key{hash: sha256.Sum256(parts)}, nil
+}
+
+// keyFileXML файл ключа KeePass в формате XML версий 1.0 и 2.0
+type keyFileXML struct {
+	XMLName xml.Name `xml:"KeyFile"`
+	Version string   `xml:"Meta>Version"`
+	Data    struct {
+		Hash  string `xml:"Hash,attr"`
+		Value string `xml:",chardata"`
+	} `xml:"Key>Data"`
+}
+
+// parseKeyFile возвращает 32-байтный ключ из файла ключа.
+// Файл в формате XML, 32 байта или 64 шестнадцатеричные цифры содержит ключ, любой другой файл хэшируется.
+func parseKeyFile(data []byte) ([]byte, error) {
+	if trimmed := bytes.TrimSpace(data); bytes.HasPrefix(trimmed, []byte("<?xml")) || bytes.HasPrefix(trimmed, []byte("<KeyFile")) {
+		var file keyFileXML
+		if err := xml.Unmarshal(trimmed, &file); err == nil {
+			return parseKeyFileXML(file)
+		}
+	}
+
+	if len(data) == 32 {
+		return data, nil
+	}
+
+	if len(data) == 64 {
+		if key, err := hex.DecodeString(string(data)); err == nil {
+			return key, nil
+		}
+	}
+
+	sum := sha256.Sum256(data)
+	return sum[:], nil
+}
+
+func parseKeyFileXML(file keyFileXML) ([]byte, error) {
+	value := strings.Join(strings.Fields(file.Data.Value), ``)
+
+	if strings.HasPrefix(file.Version, "2.") {
+		key, err := hex.DecodeString(value)
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("bad key file data")
+		}
+
+		//Версия 2.0 хранит первые 4 байта SHA-256 ключа для проверки
+		sum := sha256.Sum256(key)
+		if hash, err := hex.DecodeString(file.Data.Hash); err != nil || len(hash) != 4 || !bytes.Equal(hash, sum[:4]) {
+			return nil, fmt.Errorf("key file is corrupted")
+		}
+
+		return key, nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("bad key file data")
+	}
+
+	return key, nil
+}
+
+// deriveAES преобразует составной ключ AES-KDF: rounds раз шифрует ключ AES-256 на соли, затем хэширует
+func deriveAES(key, seed []byte, rounds uint64) ([]byte, error) {
+	block, err := aes.NewCipher(seed)
+	if err != nil {
+		return nil, fmt.Errorf("bad aes-kdf seed: %w", err)
+	}
+	if rounds == 0 {
+		return nil, fmt.Errorf("bad aes-kdf rounds")
+	}
+	if rounds > aesMaxRounds {
+		return nil, fmt.Errorf("%w: %d aes-kdf rounds, at most %d", ErrUnsupportedKDF, rounds, aesMaxRounds)
+	}
+
+	transformed := bytes.Clone(key)
+	for i := uint64(0); i < rounds; i++ {
+		block.Encrypt(transformed[:aes.BlockSize], transformed[:aes.BlockSize])
+		block.Encrypt(transformed[aes.BlockSize:], transformed[aes.BlockSize:])
+	}
+
+	sum := sha256.Sum256(transformed)
+	return sum[:], nil
+}
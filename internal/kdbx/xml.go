@@ -0,0 +1,513 @@
+package kdbx
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"golang.org/x/crypto/chacha20"
+	"golang.org/x/crypto/salsa20/salsa"
+	"io"
+	"strings"
+	"time"
+)
+
+// Внутренний заголовок идет в начале расшифрованного содержимого перед XML.
+// Он содержит ключ потока, которым дополнительно шифруются защищенные значения, и содержимое вложений.
+const (
+	innerEnd       = 0
+	innerStreamID  = 1
+	innerStreamKey = 2
+	innerBinary    = 3
+
+	streamSalsa20  = 2
+	streamChaCha20 = 3
+
+	generator = "go-keepass"
+)
+
+// salsaNonce фиксированный nonce потока Salsa20 защищенных значений
+var salsaNonce = []byte{0xE8, 0x30, 0x09, 0x4B, 0x97, 0x20, 0x5D, 0x2A}
+
+// epoch начало отсчета времени в KDBX 4
+var epoch = time.Date(1, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// innerHeader внутренний заголовок
+type innerHeader struct {
+	streamID  uint32   // шифр защищенных значений
+	streamKey []byte   // ключ шифра защищенных значений
+	binaries  [][]byte // содержимое вложений, записи ссылаются на него по номеру
+}
+
+func newInnerHeader() (*innerHeader, error) {
+	h := &innerHeader{streamID: streamChaCha20, streamKey: make([]byte, 64)}
+	if _, err := rand.Read(h.streamKey); err != nil {
+		return nil, fmt.Errorf("cannot generate inner stream key: %w", err)
+	}
+	return h, nil
+}
+
+// readInnerHeader разбирает внутренний заголовок и возвращает следующий за ним XML
+func readInnerHeader(data []byte) (*innerHeader, []byte, error) {
+	h := new(innerHeader)
+	for {
+		if len(data) < 5 {
+			return nil, nil, fmt.Errorf("inner header is truncated")
+		}
+		id, size := data[0], binary.LittleEndian.Uint32(data[1:5])
+		if uint64(len(data)-5) < uint64(size) {
+			return nil, nil, fmt.Errorf("inner header is truncated")
+		}
+		value := data[5 : 5+size]
+		data = data[5+size:]
+
+		switch id {
+		case innerEnd:
+			if h.streamKey == nil {
+				return nil, nil, fmt.Errorf("inner stream key is missing")
+			}
+			return h, data, nil
+		case innerStreamID:
+			if len(value) != 4 {
+				return nil, nil, fmt.Errorf("bad inner stream id")
+			}
+			h.streamID = binary.LittleEndian.Uint32(value)
+		case innerStreamKey:
+			h.streamKey = value
+		case innerBinary:
+			//Первый байт - флаги вложения, они не нужны
+			if len(value) == 0 {
+				return nil, nil, fmt.Errorf("bad attachment in inner header")
+			}
+			h.binaries = append(h.binaries, value[1:])
+		}
+	}
+}
+
+func (m *innerHeader) write(w io.Writer) error {
+	var buf bytes.Buffer
+	writeField := func(id byte, data ...[]byte) {
+		size := 0
+		for _, d := range data {
+			size += len(d)
+		}
+		buf.WriteByte(id)
+		binary.Write(&buf, binary.LittleEndian, uint32(size))
+		for _, d := range data {
+			buf.Write(d)
+		}
+	}
+
+	writeField(innerStreamID, binary.LittleEndian.AppendUint32(nil, m.streamID))
+	writeField(innerStreamKey, m.streamKey)
+	for _, data := range m.binaries {
+		writeField(innerBinary, []byte{0}, data)
+	}
+	writeField(innerEnd)
+
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("cannot write inner header: %w", err)
+	}
+
+	return nil
+}
+
+// stream шифр защищенных значений. Значения шифруются одним потоком в порядке следования в XML.
+func (m *innerHeader) stream() (cipher.Stream, error) {
+	switch m.streamID {
+	case streamChaCha20:
+		sum := sha512.Sum512(m.streamKey)
+		c, err := chacha20.NewUnauthenticatedCipher(sum[:32], sum[32:32+chacha20.NonceSize])
+		if err != nil {
+			return nil, fmt.Errorf("cannot create inner stream cipher: %w", err)
+		}
+		return c, nil
+	case streamSalsa20:
+		s := &salsaStream{key: sha256.Sum256(m.streamKey), used: 64}
+		copy(s.counter[:], salsaNonce)
+		return s, nil
+	default:
+		return nil, fmt.Errorf("unsupported inner stream cipher %d", m.streamID)
+	}
+}
+
+// salsaStream потоковый шифр Salsa20, который используют старые базы
+type salsaStream struct {
+	key     [32]byte
+	counter [16]byte // nonce и номер блока
+	block   [64]byte // текущий блок ключевого потока
+	used    int      // использованная часть блока
+}
+
+func (m *salsaStream) XORKeyStream(dst, src []byte) {
+	for i := range src {
+		if m.used == len(m.block) {
+			var zero [64]byte
+			salsa.XORKeyStream(m.block[:], zero[:], &m.counter, &m.key)
+			binary.LittleEndian.PutUint64(m.counter[8:], binary.LittleEndian.Uint64(m.counter[8:])+1)
+			m.used = 0
+		}
+		dst[i] = src[i] ^ m.block[m.used]
+		m.used++
+	}
+}
+
+type xmlFile struct {
+	XMLName xml.Name `xml:"KeePassFile"`
+	Meta    xmlMeta  `xml:"Meta"`
+	Root    struct {
+		Groups         []xmlGroup `xml:"Group"`
+		DeletedObjects struct{}   `xml:"DeletedObjects"`
+	} `xml:"Root"`
+}
+
+type xmlMeta struct {
+	Generator           string `xml:"Generator"`
+	DatabaseName        string `xml:"DatabaseName"`
+	DatabaseNameChanged string `xml:"DatabaseNameChanged,omitempty"`
+	MemoryProtection    struct {
+		ProtectTitle    string `xml:"ProtectTitle"`
+		ProtectUserName string `xml:"ProtectUserName"`
+		ProtectPassword string `xml:"ProtectPassword"`
+		ProtectURL      string `xml:"ProtectURL"`
+		ProtectNotes    string `xml:"ProtectNotes"`
+	} `xml:"MemoryProtection"`
+	RecycleBinEnabled string `xml:"RecycleBinEnabled"`
+	RecycleBinUUID    string `xml:"RecycleBinUUID"`
+}
+
+type xmlGroup struct {
+	UUID       string     `xml:"UUID"`
+	Name       string     `xml:"Name"`
+	Notes      string     `xml:"Notes"`
+	IconID     int        `xml:"IconID"`
+	Times      xmlTimes   `xml:"Times"`
+	IsExpanded string     `xml:"IsExpanded"`
+	Entries    []xmlEntry `xml:"Entry"`
+	Groups     []xmlGroup `xml:"Group"`
+}
+
+type xmlEntry struct {
+	UUID     string      `xml:"UUID"`
+	IconID   int         `xml:"IconID"`
+	Tags     string      `xml:"Tags"`
+	Times    xmlTimes    `xml:"Times"`
+	Strings  []xmlString `xml:"String"`
+	Binaries []xmlBinary `xml:"Binary"`
+}
+
+type xmlTimes struct {
+	CreationTime         string `xml:"CreationTime"`
+	LastModificationTime string `xml:"LastModificationTime"`
+	LastAccessTime       string `xml:"LastAccessTime"`
+	ExpiryTime           string `xml:"ExpiryTime"`
+	Expires              string `xml:"Expires"`
+	UsageCount           int    `xml:"UsageCount"`
+	LocationChanged      string `xml:"LocationChanged"`
+}
+
+type xmlString struct {
+	Key   string `xml:"Key"`
+	Value struct {
+		Protected string `xml:"Protected,attr,omitempty"`
+		Text      string `xml:",chardata"`
+	} `xml:"Value"`
+}
+
+type xmlBinary struct {
+	Key   string `xml:"Key"`
+	Value struct {
+		Ref int `xml:"Ref,attr"`
+	} `xml:"Value"`
+}
+
+// decodeXML расшифровывает защищенные значения и разбирает XML базы
+func decodeXML(content []byte, inner *innerHeader) (*Database, error) {
+	stream, err := inner.stream()
+	if err != nil {
+		return nil, err
+	}
+
+	content, err = unprotect(content, stream)
+	if err != nil {
+		return nil, err
+	}
+
+	var file xmlFile
+	if err := xml.Unmarshal(content, &file); err != nil {
+		return nil, fmt.Errorf("cannot parse database xml: %w", err)
+	}
+	if len(file.Root.Groups) == 0 {
+		return nil, fmt.Errorf("database has no root group")
+	}
+
+	db := &Database{Name: file.Meta.DatabaseName}
+	if isTrue(file.Meta.RecycleBinEnabled) {
+		db.RecycleBin = parseUUID(file.Meta.RecycleBinUUID)
+	}
+
+	db.Root, err = decodeGroup(file.Root.Groups[0], inner.binaries)
+	if err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// unprotect заменяет защищенные значения открытыми. Поток шифра применяется к значениям в порядке
+// их следования в документе, поэтому они расшифровываются при последовательном чтении XML, до разбора в структуры.
+func unprotect(content []byte, stream cipher.Stream) ([]byte, error) {
+	var buf bytes.Buffer
+	d := xml.NewDecoder(bytes.NewReader(content))
+	e := xml.NewEncoder(&buf)
+
+	protected := false
+	var text strings.Builder
+	for {
+		token, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse database xml: %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			for _, attr := range t.Attr {
+				if t.Name.Local == "Value" && attr.Name.Local == "Protected" && isTrue(attr.Value) {
+					protected = true
+					text.Reset()
+				}
+			}
+		case xml.CharData:
+			if protected {
+				text.Write(t)
+				continue
+			}
+		case xml.EndElement:
+			if protected {
+				value, err := base64.StdEncoding.DecodeString(strings.TrimSpace(text.String()))
+				if err != nil {
+					return nil, fmt.Errorf("bad protected value: %w", err)
+				}
+				stream.XORKeyStream(value, value)
+				if err := e.EncodeToken(xml.CharData(value)); err != nil {
+					return nil, fmt.Errorf("cannot rebuild database xml: %w", err)
+				}
+				protected = false
+			}
+		case xml.ProcInst, xml.Comment, xml.Directive:
+			continue
+		}
+
+		if err := e.EncodeToken(token); err != nil {
+			return nil, fmt.Errorf("cannot rebuild database xml: %w", err)
+		}
+	}
+
+	if err := e.Flush(); err != nil {
+		return nil, fmt.Errorf("cannot rebuild database xml: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func decodeGroup(g xmlGroup, binaries [][]byte) (Group, error) {
+	group := Group{UUID: parseUUID(g.UUID), Name: g.Name, Notes: g.Notes}
+
+	for _, e := range g.Entries {
+		entry := Entry{
+			UUID:      parseUUID(e.UUID),
+			CreatedAt: parseTime(e.Times.CreationTime),
+			UpdatedAt: parseTime(e.Times.LastModificationTime),
+		}
+
+		for _, s := range e.Strings {
+			entry.Fields = append(entry.Fields, Field{Key: s.Key, Value: s.Value.Text, Protected: isTrue(s.Value.Protected)})
+		}
+
+		for _, b := range e.Binaries {
+			if b.Value.Ref < 0 || b.Value.Ref >= len(binaries) {
+				return group, fmt.Errorf("entry %s refers to missing attachment %s", entry.Get(FieldTitle), b.Key)
+			}
+			entry.Attachments = append(entry.Attachments, Attachment{Name: b.Key, Data: binaries[b.Value.Ref]})
+		}
+
+		for _, tag := range strings.FieldsFunc(e.Tags, func(r rune) bool { return r == ';' || r == ',' }) {
+			if tag = strings.TrimSpace(tag); tag != `` {
+				entry.Tags = append(entry.Tags, tag)
+			}
+		}
+
+		group.Entries = append(group.Entries, entry)
+	}
+
+	for _, sub := range g.Groups {
+		child, err := decodeGroup(sub, binaries)
+		if err != nil {
+			return group, err
+		}
+		group.Groups = append(group.Groups, child)
+	}
+
+	return group, nil
+}
+
+// encodeXML строит XML базы, шифруя защищенные значения, и заполняет вложения внутреннего заголовка
+func encodeXML(db *Database, inner *innerHeader) ([]byte, error) {
+	stream, err := inner.stream()
+	if err != nil {
+		return nil, err
+	}
+
+	now := formatTime(time.Now())
+
+	var file xmlFile
+	file.Meta.Generator = generator
+	file.Meta.DatabaseName = db.Name
+	file.Meta.DatabaseNameChanged = now
+	file.Meta.MemoryProtection.ProtectTitle = "False"
+	file.Meta.MemoryProtection.ProtectUserName = "False"
+	file.Meta.MemoryProtection.ProtectPassword = "True"
+	file.Meta.MemoryProtection.ProtectURL = "False"
+	file.Meta.MemoryProtection.ProtectNotes = "False"
+	file.Meta.RecycleBinEnabled = "False"
+	file.Meta.RecycleBinUUID = formatUUID(db.RecycleBin)
+	if !db.RecycleBin.IsZero() {
+		file.Meta.RecycleBinEnabled = "True"
+	}
+
+	//Одинаковые вложения хранятся во внутреннем заголовке один раз
+	refs := make(map[string]int)
+
+	//Значения шифруются в том же порядке, в котором encoding/xml запишет их: записи группы, затем вложенные группы
+	var encodeGroup func(g *Group) (xmlGroup, error)
+	encodeGroup = func(g *Group) (xmlGroup, error) {
+		x := xmlGroup{UUID: formatUUID(g.UUID), Name: g.Name, Notes: g.Notes, IsExpanded: "True", Times: newTimes(time.Time{}, time.Time{}, now)}
+		if g.UUID.IsZero() {
+			id, err := NewUUID()
+			if err != nil {
+				return x, err
+			}
+			x.UUID = formatUUID(id)
+		}
+
+		for _, entry := range g.Entries {
+			e := xmlEntry{UUID: formatUUID(entry.UUID), Tags: strings.Join(entry.Tags, ";"), Times: newTimes(entry.CreatedAt, entry.UpdatedAt, now)}
+			if entry.UUID.IsZero() {
+				id, err := NewUUID()
+				if err != nil {
+					return x, err
+				}
+				e.UUID = formatUUID(id)
+			}
+
+			for _, field := range entry.Fields {
+				var s xmlString
+				s.Key = field.Key
+				s.Value.Text = field.Value
+				if field.Protected {
+					value := []byte(field.Value)
+					stream.XORKeyStream(value, value)
+					s.Value.Protected = "True"
+					s.Value.Text = base64.StdEncoding.EncodeToString(value)
+				}
+				e.Strings = append(e.Strings, s)
+			}
+
+			for _, attachment := range entry.Attachments {
+				ref, ok := refs[string(attachment.Data)]
+				if !ok {
+					ref = len(inner.binaries)
+					refs[string(attachment.Data)] = ref
+					inner.binaries = append(inner.binaries, attachment.Data)
+				}
+
+				var b xmlBinary
+				b.Key = attachment.Name
+				b.Value.Ref = ref
+				e.Binaries = append(e.Binaries, b)
+			}
+
+			x.Entries = append(x.Entries, e)
+		}
+
+		for i := range g.Groups {
+			child, err := encodeGroup(&g.Groups[i])
+			if err != nil {
+				return x, err
+			}
+			x.Groups = append(x.Groups, child)
+		}
+
+		return x, nil
+	}
+
+	root, err := encodeGroup(&db.Root)
+	if err != nil {
+		return nil, err
+	}
+	file.Root.Groups = []xmlGroup{root}
+
+	content, err := xml.MarshalIndent(file, ``, "\t")
+	if err != nil {
+		return nil, fmt.Errorf("cannot marshal database xml: %w", err)
+	}
+
+	return append([]byte(xml.Header), content...), nil
+}
+
+// newTimes времена группы или записи, нулевое время заменяется текущим now
+func newTimes(created, updated time.Time, now string) xmlTimes {
+	times := xmlTimes{
+		CreationTime:         now,
+		LastModificationTime: now,
+		LastAccessTime:       now,
+		ExpiryTime:           now,
+		Expires:              "False",
+		LocationChanged:      now,
+	}
+	if !created.IsZero() {
+		times.CreationTime = formatTime(created)
+	}
+	if !updated.IsZero() {
+		times.LastModificationTime = formatTime(updated)
+	}
+	return times
+}
+
+// formatTime время в KDBX 4: base64 от числа секунд с 0001-01-01
+func formatTime(t time.Time) string {
+	seconds := t.Unix() - epoch.Unix()
+	return base64.StdEncoding.EncodeToString(binary.LittleEndian.AppendUint64(nil, uint64(seconds)))
+}
+
+// parseTime разбирает время KDBX 4 или время в формате ISO 8601, нулевое время - время не задано или не разобрано
+func parseTime(s string) time.Time {
+	if data, err := base64.StdEncoding.DecodeString(s); err == nil && len(data) == 8 {
+		return time.Unix(int64(binary.LittleEndian.Uint64(data))+epoch.Unix(), 0).UTC()
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t
+	}
+	return time.Time{}
+}
+
+func formatUUID(id UUID) string {
+	return base64.StdEncoding.EncodeToString(id[:])
+}
+
+func parseUUID(s string) UUID {
+	data, _ := base64.StdEncoding.DecodeString(s)
+	return pad16(data)
+}
+
+func isTrue(s string) bool {
+	return strings.EqualFold(s, "True")
+}
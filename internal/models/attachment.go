@@ -0,0 +1,32 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Attachment файл, прикрепленный к данным. Содержимое зашифровано клиентом потоком на собственном
+// ключе вложения, а ключ - ключом данных записи, поэтому вложение доступно всем, кому доступна запись.
+type Attachment struct {
+	Name      string    `json:"name"`          //Имя вложения, уникальное в пределах данных
+	MimeType  string    `json:"mime_type"`     //Тип содержимого
+	Size      int64     `json:"size"`          //Размер зашифрованного содержимого
+	Key       []byte    `json:"key,omitempty"` //Ключ вложения, зашифрованный ключом данных (только при получении)
+	CreatedAt time.Time `json:"created_at"`    //Время загрузки
+}
+
+// ValidateAttachmentName проверяет имя вложения: не длиннее 255 байт и без разделителя папок,
+// имя остается одним сегментом пути запроса
+func ValidateAttachmentName(name string) error {
+	switch {
+	case name == ``:
+		return fmt.Errorf("empty attachment name")
+	case len(name) > maxPathLength:
+		return fmt.Errorf("attachment name is longer than %d bytes", maxPathLength)
+	case strings.Contains(name, FolderSeparator), name == ".", name == "..":
+		return fmt.Errorf("bad attachment name %q", name)
+	}
+
+	return nil
+}
@@ -0,0 +1,70 @@
+package models
+
+import "time"
+
+// DataRevision описание одной ревизии сохраненных данных
+type DataRevision struct {
+	Revision  int64     `json:"revision"`   //Номер ревизии, начинается с 1
+	CreatedAt time.Time `json:"created_at"` //Время сохранения ревизии
+	Size      int64     `json:"size"`       //Размер зашифрованных данных
+}
+
+// DataInfo описание сохраненных данных без их содержимого
+type DataInfo struct {
+	Identifier string    `json:"identifier"`         //Идентификатор данных
+	Origin     string    `json:"origin,omitempty"`   //Идентификатор до перемещения, от него получен ключ данных (см. KeyId)
+	Revision   int64     `json:"revision"`           //Номер текущей ревизии
+	Size       int64     `json:"size"`               //Размер зашифрованных данных текущей ревизии
+	Metadata   []byte    `json:"metadata,omitempty"` //Зашифрованные метаданные
+	CreatedAt  time.Time `json:"created_at"`         //Время создания
+	UpdatedAt  time.Time `json:"updated_at"`         //Время последнего изменения
+}
+
+// KeyId идентификатор, от которого получен ключ данных: перемещение меняет идентификатор,
+// но не ключ, иначе пришлось бы заново шифровать все ревизии
+func (m *DataInfo) KeyId() string {
+	if m.Origin != `` {
+		return m.Origin
+	}
+	return m.Identifier
+}
+
+// DataList страница списка данных пользователя
+type DataList struct {
+	Items []DataInfo `json:"items"` //Данные на странице
+	Total int64      `json:"total"` //Общее количество данных пользователя
+}
+
+// TrashItem описание удаленных данных в корзине пользователя
+type TrashItem struct {
+	Id         string    `json:"id"`                 //Идентификатор удаленных данных в корзине
+	Identifier string    `json:"identifier"`         //Идентификатор данных до удаления
+	Origin     string    `json:"origin,omitempty"`   //Идентификатор до перемещения, от него получен ключ данных
+	Revision   int64     `json:"revision"`           //Номер ревизии на момент удаления
+	Size       int64     `json:"size"`               //Размер зашифрованных данных
+	Metadata   []byte    `json:"metadata,omitempty"` //Зашифрованные метаданные
+	DeletedAt  time.Time `json:"deleted_at"`         //Время удаления
+}
+
+// KeyId идентификатор, от которого получен ключ данных
+func (m *TrashItem) KeyId() string {
+	if m.Origin != `` {
+		return m.Origin
+	}
+	return m.Identifier
+}
+
+// NewData новые данные в пакетном запросе на добавление
+type NewData struct {
+	Identifier string `json:"identifier"`         //Идентификатор данных
+	Data       []byte `json:"data"`               //Зашифрованные данные
+	Metadata   []byte `json:"metadata,omitempty"` //Зашифрованные метаданные
+}
+
+// AddResult результат добавления одних данных из пакета: код как у одиночного запроса на добавление
+type AddResult struct {
+	Identifier string `json:"identifier"`         //Идентификатор данных
+	Status     int    `json:"status"`             //HTTP-код результата, 202 - данные сохранены
+	Revision   int64  `json:"revision,omitempty"` //Ревизия сохраненных данных
+	Error      string `json:"error,omitempty"`    //Причина отказа
+}
@@ -0,0 +1,75 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// FolderSeparator разделитель папок в идентификаторе данных: prod/db/password - данные password в папке prod/db
+	FolderSeparator = "/"
+
+	maxPathLength = 255 // наибольшая длина идентификатора или пути папки, как у столбца data_id
+)
+
+// ValidatePath проверяет идентификатор данных или путь папки: не длиннее 255 байт, без пустых
+// частей, а значит, без разделителя в начале, в конце и двух разделителей подряд, и без частей . и ..
+func ValidatePath(path string) error {
+	if path == `` {
+		return fmt.Errorf("empty path")
+	}
+	if len(path) > maxPathLength {
+		return fmt.Errorf("path is longer than %d bytes", maxPathLength)
+	}
+
+	for _, part := range strings.Split(path, FolderSeparator) {
+		switch part {
+		case ``:
+			return fmt.Errorf("path %q has empty part", path)
+		case ".", "..":
+			return fmt.Errorf("path %q has relative part %q", path, part)
+		}
+	}
+
+	return nil
+}
+
+// ParentFolder папка, в которой находятся данные или папка path, пустая - корень
+func ParentFolder(path string) string {
+	if i := strings.LastIndex(path, FolderSeparator); i >= 0 {
+		return path[:i]
+	}
+	return ``
+}
+
+// BaseName имя данных или папки path без родительской папки
+func BaseName(path string) string {
+	return path[strings.LastIndex(path, FolderSeparator)+1:]
+}
+
+// InFolder проверяет, что данные или папка path находятся в папке folder или ее вложенных папках.
+// Пустая папка - корень, в ней находится все.
+func InFolder(path, folder string) bool {
+	return folder == `` || strings.HasPrefix(path, folder+FolderSeparator)
+}
+
+// MovePath путь данных или папки path из папки from после ее перемещения в to
+func MovePath(path, from, to string) string {
+	return to + strings.TrimPrefix(path, from)
+}
+
+// Folder папка данных. Папки бывают созданы явно или следуют из идентификаторов данных.
+type Folder struct {
+	Path    string `json:"path"`    //Путь папки
+	Entries int64  `json:"entries"` //Количество данных в папке и вложенных папках
+}
+
+// MoveRequest запрос на перемещение или переименование данных или папки
+type MoveRequest struct {
+	Path string `json:"path"` //Новый идентификатор данных или путь папки
+}
+
+// Validate проверяет заполнение запроса
+func (m *MoveRequest) Validate() error {
+	return ValidatePath(m.Path)
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Metadata описательные данные записи. Шифруются на клиенте отдельно от записи и возвращаются
+// сервером в списке данных, поэтому искать по ним можно без загрузки самих записей.
+type Metadata struct {
+	Site   string            `json:"site,omitempty"`   //Сайт или сервис
+	Bank   string            `json:"bank,omitempty"`   //Банк
+	Owner  string            `json:"owner,omitempty"`  //Владелец
+	Notes  string            `json:"notes,omitempty"`  //Произвольные заметки
+	Tags   []string          `json:"tags,omitempty"`   //Теги
+	Fields map[string]string `json:"fields,omitempty"` //Произвольные дополнительные поля
+}
+
+// ParseTags разбирает список тегов через запятую, убирая пустые и повторяющиеся
+func ParseTags(line string) []string {
+	var tags []string
+	for _, tag := range strings.Split(line, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag != `` && !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// HasTag проверяет наличие тега
+func (m *Metadata) HasTag(tag string) bool {
+	return slices.Contains(m.Tags, tag)
+}
+
+// IsEmpty проверяет, что метаданные не заполнены
+func (m *Metadata) IsEmpty() bool {
+	return m.Site == `` && m.Bank == `` && m.Owner == `` && m.Notes == `` && len(m.Tags) == 0 && len(m.Fields) == 0
+}
+
+// ParseMetadata разбирает расшифрованные метаданные, пустые данные - пустые метаданные
+func ParseMetadata(data []byte) (Metadata, error) {
+	var metadata Metadata
+	if len(data) == 0 {
+		return metadata, nil
+	}
+
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return metadata, fmt.Errorf("cannot unmarshal metadata: %w", err)
+	}
+
+	return metadata, nil
+}
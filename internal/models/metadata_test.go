@@ -0,0 +1,64 @@
+package models
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseTags(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{"", nil},
+		{" , ,", nil},
+		{"work", []string{"work"}},
+		{" work, bank ,work,, Work ", []string{"work", "bank", "Work"}},
+	}
+	for _, tt := range tests {
+		if got := ParseTags(tt.line); !slices.Equal(got, tt.want) {
+			t.Errorf("ParseTags(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	var empty Metadata
+	if !empty.IsEmpty() {
+		t.Error("IsEmpty() zero metadata = false, want true")
+	}
+	for _, metadata := range []Metadata{
+		{Site: "github.com"}, {Bank: "bank"}, {Owner: "alice"}, {Notes: "note"},
+		{Tags: []string{"work"}}, {Fields: map[string]string{"pin": "1234"}},
+	} {
+		if metadata.IsEmpty() {
+			t.Errorf("IsEmpty(%+v) = true, want false", metadata)
+		}
+	}
+
+	metadata := Metadata{Tags: []string{"work", "bank"}}
+	if !metadata.HasTag("bank") || metadata.HasTag("Bank") || metadata.HasTag("home") {
+		t.Errorf("HasTag() on %q matched wrong tags", metadata.Tags)
+	}
+}
+
+func TestParseMetadata(t *testing.T) {
+	for _, data := range [][]byte{nil, {}} {
+		got, err := ParseMetadata(data)
+		if err != nil || !got.IsEmpty() {
+			t.Errorf("ParseMetadata(%q) = %+v, %v, want empty metadata", data, got, err)
+		}
+	}
+
+	got, err := ParseMetadata([]byte(`{"site":"github.com","tags":["work"],"fields":{"pin":"1234"},"unknown":1}`))
+	if err != nil {
+		t.Fatalf("ParseMetadata() error = %v", err)
+	}
+	if got.Site != "github.com" || !got.HasTag("work") || got.Fields["pin"] != "1234" {
+		t.Errorf("ParseMetadata() = %+v", got)
+	}
+
+	if _, err := ParseMetadata([]byte("not json")); err == nil {
+		t.Error("ParseMetadata() bad json error = nil, want error")
+	}
+}
@@ -0,0 +1,171 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// OrgRole роль участника организации
+type OrgRole string
+
+const (
+	RoleOwner    OrgRole = "owner"    //Управление организацией, в том числе администраторами
+	RoleAdmin    OrgRole = "admin"    //Управление участниками и коллекциями, чтение и запись данных
+	RoleMember   OrgRole = "member"   //Чтение и запись данных коллекций
+	RoleReadOnly OrgRole = "readonly" //Только чтение данных коллекций
+)
+
+// Valid проверяет, что роль известна
+func (m OrgRole) Valid() bool {
+	switch m {
+	case RoleOwner, RoleAdmin, RoleMember, RoleReadOnly:
+		return true
+	}
+	return false
+}
+
+// CanWrite разрешает изменение данных коллекций
+func (m OrgRole) CanWrite() bool {
+	return m == RoleOwner || m == RoleAdmin || m == RoleMember
+}
+
+// CanManage разрешает приглашать и удалять участников и создавать коллекции
+func (m OrgRole) CanManage() bool {
+	return m == RoleOwner || m == RoleAdmin
+}
+
+// CanAssign разрешает назначать роль role и управлять участниками с этой ролью:
+// владельцу - любую, администратору - участника и только чтение
+func (m OrgRole) CanAssign(role OrgRole) bool {
+	switch m {
+	case RoleOwner:
+		return true
+	case RoleAdmin:
+		return role == RoleMember || role == RoleReadOnly
+	}
+	return false
+}
+
+// OrganizationRequest запрос на создание организации
+type OrganizationRequest struct {
+	Name string `json:"name"` //Название организации
+}
+
+// Validate проверяет заполнение запроса
+func (m *OrganizationRequest) Validate() error {
+	if m.Name == `` {
+		return fmt.Errorf("name required")
+	}
+
+	return nil
+}
+
+// Organization организация, в которой состоит пользователь
+type Organization struct {
+	Id        string    `json:"id"`         //Идентификатор организации
+	Name      string    `json:"name"`       //Название
+	Role      OrgRole   `json:"role"`       //Роль пользователя
+	Accepted  bool      `json:"accepted"`   //Пользователь принял приглашение
+	CreatedAt time.Time `json:"created_at"` //Время создания
+}
+
+// Member участник организации
+type Member struct {
+	Login     string    `json:"login"`      //Логин участника
+	Role      OrgRole   `json:"role"`       //Роль
+	Accepted  bool      `json:"accepted"`   //Участник принял приглашение
+	CreatedAt time.Time `json:"created_at"` //Время приглашения
+
+	UserId string `json:"-"` //Идентификатор участника, используется только сервером
+}
+
+// CollectionKey ключ коллекции, зашифрованный открытым ключом участника. Коллекция, участник и версия
+// заполняются по смыслу запроса: при создании коллекции - участник, при приглашении - коллекция и версия,
+// при удалении участника - коллекция и участник, версия следующая за текущей.
+type CollectionKey struct {
+	Collection string `json:"collection,omitempty"` //Идентификатор коллекции
+	Login      string `json:"login,omitempty"`      //Логин участника
+	Version    int64  `json:"version,omitempty"`    //Версия ключа
+	Key        []byte `json:"key"`                  //Зашифрованный ключ
+}
+
+// CollectionRequest запрос на создание коллекции с ключом для каждого участника организации
+type CollectionRequest struct {
+	Name string          `json:"name"` //Название коллекции
+	Keys []CollectionKey `json:"keys"` //Ключ коллекции для каждого участника
+}
+
+// Validate проверяет заполнение запроса
+func (m *CollectionRequest) Validate() error {
+	if m.Name == `` {
+		return fmt.Errorf("name required")
+	}
+
+	return validateKeys(m.Keys)
+}
+
+// Collection общая коллекция данных организации
+type Collection struct {
+	Id           string          `json:"id"`             //Идентификатор коллекции
+	Organization string          `json:"organization"`   //Идентификатор организации
+	Name         string          `json:"name"`           //Название
+	KeyVersion   int64           `json:"key_version"`    //Текущая версия ключа, ею шифруются новые данные
+	Role         OrgRole         `json:"role"`           //Роль пользователя в организации
+	Keys         []CollectionKey `json:"keys,omitempty"` //Все версии ключа, зашифрованные для пользователя
+	CreatedAt    time.Time       `json:"created_at"`     //Время создания
+}
+
+// InviteRequest приглашение пользователя в организацию со всеми версиями ключей всех коллекций
+type InviteRequest struct {
+	Login string          `json:"login"` //Логин приглашенного
+	Role  OrgRole         `json:"role"`  //Роль
+	Keys  []CollectionKey `json:"keys"`  //Ключи коллекций для приглашенного
+}
+
+// Validate проверяет заполнение запроса
+func (m *InviteRequest) Validate() error {
+	if m.Login == `` {
+		return fmt.Errorf("login required")
+	}
+	if !m.Role.Valid() {
+		return fmt.Errorf("unknown role %q", m.Role)
+	}
+
+	return validateKeys(m.Keys)
+}
+
+// RoleRequest запрос на изменение роли участника
+type RoleRequest struct {
+	Role OrgRole `json:"role"` //Новая роль
+}
+
+// Validate проверяет заполнение запроса
+func (m *RoleRequest) Validate() error {
+	if !m.Role.Valid() {
+		return fmt.Errorf("unknown role %q", m.Role)
+	}
+
+	return nil
+}
+
+// RemoveRequest запрос на удаление участника. Если участник принял приглашение, ему известны ключи
+// коллекций, поэтому запрос содержит новую версию ключа каждой коллекции для каждого оставшегося участника.
+type RemoveRequest struct {
+	Keys []CollectionKey `json:"keys"` //Новые ключи коллекций
+}
+
+// Validate проверяет заполнение запроса
+func (m *RemoveRequest) Validate() error {
+	return validateKeys(m.Keys)
+}
+
+// validateKeys проверяет, что переданы сами ключи; их набор проверяет хранилище
+func validateKeys(keys []CollectionKey) error {
+	for _, key := range keys {
+		if len(key.Key) == 0 {
+			return fmt.Errorf("empty collection key")
+		}
+	}
+
+	return nil
+}
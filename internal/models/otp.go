@@ -0,0 +1,382 @@
+package models
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OTPKind вид одноразовых кодов
+type OTPKind string
+
+const (
+	OTPTotp OTPKind = "totp" //Коды по времени, RFC 6238
+	OTPHotp OTPKind = "hotp" //Коды по счетчику, RFC 4226
+)
+
+// OTPAlgorithm хеш-функция HMAC для вычисления кодов
+type OTPAlgorithm string
+
+const (
+	OTPSHA1   OTPAlgorithm = "SHA1"
+	OTPSHA256 OTPAlgorithm = "SHA256"
+	OTPSHA512 OTPAlgorithm = "SHA512"
+)
+
+const (
+	// OTPScheme схема адреса otpauth://, в котором сервисы передают секрет через QR-код
+	OTPScheme = "otpauth"
+	// OTPMigrationScheme схема адреса выгрузки Google Authenticator
+	OTPMigrationScheme = "otpauth-migration"
+
+	defaultOTPDigits = 6
+	defaultOTPPeriod = 30
+	minOTPDigits     = 6
+	maxOTPDigits     = 10
+)
+
+// OTP секрет одноразовых кодов двухфакторной аутентификации
+type OTP struct {
+	Kind      OTPKind      `json:"kind"`              //Вид кодов
+	Secret    string       `json:"secret"`            //Секрет в base32 без дополнения
+	Issuer    string       `json:"issuer,omitempty"`  //Сервис, выдавший секрет
+	Account   string       `json:"account,omitempty"` //Учетная запись в сервисе
+	Algorithm OTPAlgorithm `json:"algorithm"`         //Хеш-функция HMAC
+	Digits    int          `json:"digits"`            //Количество цифр кода
+	Period    int          `json:"period,omitempty"`  //Время действия кода TOTP в секундах
+	Counter   uint64       `json:"counter,omitempty"` //Счетчик HOTP для следующего кода
+}
+
+// Validate проверяет вид кодов, секрет и параметры вычисления кода
+func (m *OTP) Validate() error {
+	switch m.Kind {
+	case OTPTotp:
+		if m.Period <= 0 {
+			return fmt.Errorf("otp period must be positive")
+		}
+	case OTPHotp:
+	default:
+		return fmt.Errorf("unknown otp kind %q", m.Kind)
+	}
+
+	if _, err := m.Key(); err != nil {
+		return err
+	}
+	if m.Algorithm.Hash() == nil {
+		return fmt.Errorf("unsupported otp algorithm %q", m.Algorithm)
+	}
+	if m.Digits < minOTPDigits || m.Digits > maxOTPDigits {
+		return fmt.Errorf("otp digits must be from %d to %d", minOTPDigits, maxOTPDigits)
+	}
+
+	return nil
+}
+
+// Key секрет в байтах
+func (m *OTP) Key() ([]byte, error) {
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(m.Secret)
+	if err != nil {
+		return nil, fmt.Errorf("bad otp secret: %w", err)
+	}
+	if len(key) == 0 {
+		return nil, fmt.Errorf("otp secret required")
+	}
+	return key, nil
+}
+
+// TimeCounter счетчик TOTP в момент at и время, оставшееся до смены кода
+func (m *OTP) TimeCounter(at time.Time) (uint64, time.Duration) {
+	period := int64(m.Period)
+	seconds := at.Unix()
+	return uint64(seconds / period), time.Duration(period-seconds%period) * time.Second
+}
+
+// Label название секрета: сервис и учетная запись
+func (m *OTP) Label() string {
+	switch {
+	case m.Issuer == ``:
+		return m.Account
+	case m.Account == ``:
+		return m.Issuer
+	}
+	return m.Issuer + ":" + m.Account
+}
+
+// URI адрес otpauth:// с секретом, который понимают приложения-аутентификаторы
+func (m *OTP) URI() string {
+	query := url.Values{}
+	query.Set("secret", m.Secret)
+	if m.Issuer != `` {
+		query.Set("issuer", m.Issuer)
+	}
+	query.Set("algorithm", string(m.Algorithm))
+	query.Set("digits", strconv.Itoa(m.Digits))
+	if m.Kind == OTPTotp {
+		query.Set("period", strconv.Itoa(m.Period))
+	} else {
+		query.Set("counter", strconv.FormatUint(m.Counter, 10))
+	}
+
+	uri := url.URL{Scheme: OTPScheme, Host: string(m.Kind), Path: "/" + m.Label(), RawQuery: query.Encode()}
+	return uri.String()
+}
+
+// Hash конструктор хеш-функции алгоритма, nil - алгоритм не поддерживается
+func (m OTPAlgorithm) Hash() func() hash.Hash {
+	switch m {
+	case OTPSHA1:
+		return sha1.New
+	case OTPSHA256:
+		return sha256.New
+	case OTPSHA512:
+		return sha512.New
+	}
+	return nil
+}
+
+// NormalizeOTPSecret приводит секрет base32 к виду без пробелов, дополнения и в верхнем регистре
+func NormalizeOTPSecret(secret string) string {
+	secret = strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' || r == '=' {
+			return -1
+		}
+		return r
+	}, secret)
+	return strings.ToUpper(secret)
+}
+
+// ParseOTPURI разбирает адрес otpauth://totp/Issuer:account?secret=...&issuer=...&algorithm=...&digits=...&period=...
+// Отсутствующие параметры получают значения по умолчанию: SHA1, 6 цифр, 30 секунд; счетчик HOTP обязателен.
+func ParseOTPURI(uri string) (OTP, error) {
+	var otp OTP
+
+	u, err := url.Parse(strings.TrimSpace(uri))
+	if err != nil {
+		return otp, fmt.Errorf("bad otpauth uri: %w", err)
+	}
+	if !strings.EqualFold(u.Scheme, OTPScheme) {
+		return otp, fmt.Errorf("otpauth uri expected, got %q scheme", u.Scheme)
+	}
+
+	otp.Kind = OTPKind(strings.ToLower(u.Host))
+	query := u.Query()
+
+	//Метка - "сервис:учетная запись" или только учетная запись, параметр issuer важнее сервиса из метки
+	label := strings.TrimPrefix(u.Path, "/")
+	if issuer, account, ok := strings.Cut(label, ":"); ok {
+		otp.Issuer, otp.Account = strings.TrimSpace(issuer), strings.TrimSpace(account)
+	} else {
+		otp.Account = strings.TrimSpace(label)
+	}
+	if issuer := query.Get("issuer"); issuer != `` {
+		otp.Issuer = issuer
+	}
+
+	otp.Secret = NormalizeOTPSecret(query.Get("secret"))
+
+	otp.Algorithm = OTPSHA1
+	if algorithm := query.Get("algorithm"); algorithm != `` {
+		otp.Algorithm = OTPAlgorithm(strings.ToUpper(algorithm))
+	}
+
+	otp.Digits = defaultOTPDigits
+	if digits := query.Get("digits"); digits != `` {
+		if otp.Digits, err = strconv.Atoi(digits); err != nil {
+			return otp, fmt.Errorf("bad otp digits %q", digits)
+		}
+	}
+
+	switch otp.Kind {
+	case OTPTotp:
+		otp.Period = defaultOTPPeriod
+		if period := query.Get("period"); period != `` {
+			if otp.Period, err = strconv.Atoi(period); err != nil {
+				return otp, fmt.Errorf("bad otp period %q", period)
+			}
+		}
+	case OTPHotp:
+		if otp.Counter, err = strconv.ParseUint(query.Get("counter"), 10, 64); err != nil {
+			return otp, fmt.Errorf("bad or missing hotp counter")
+		}
+	}
+
+	if err := otp.Validate(); err != nil {
+		return otp, err
+	}
+
+	return otp, nil
+}
+
+// Значения перечислений в выгрузке Google Authenticator
+const (
+	migrationSHA1   = 1
+	migrationSHA256 = 2
+	migrationSHA512 = 3
+
+	migrationSixDigits   = 1
+	migrationEightDigits = 2
+
+	migrationHOTP = 1
+	migrationTOTP = 2
+)
+
+// ParseOTPMigration разбирает адрес otpauth-migration://offline?data=..., который Google Authenticator
+// показывает QR-кодом при переносе аккаунтов. В data - сообщение protobuf MigrationPayload в base64.
+// Период в выгрузке не передается, у всех кодов TOTP он 30 секунд.
+func ParseOTPMigration(uri string) ([]OTP, error) {
+	u, err := url.Parse(strings.TrimSpace(uri))
+	if err != nil {
+		return nil, fmt.Errorf("bad otpauth-migration uri: %w", err)
+	}
+	if !strings.EqualFold(u.Scheme, OTPMigrationScheme) {
+		return nil, fmt.Errorf("otpauth-migration uri expected, got %q scheme", u.Scheme)
+	}
+
+	//Неэкранированный "+" из base64 в запросе превращается в пробел
+	data := strings.ReplaceAll(u.Query().Get("data"), " ", "+")
+	payload, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		if payload, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(data, "=")); err != nil {
+			return nil, fmt.Errorf("bad migration data: %w", err)
+		}
+	}
+
+	var otps []OTP
+	err = readProto(payload, func(field int, value uint64, data []byte) error {
+		//1 - repeated OtpParameters, остальные поля описывают пакет выгрузки
+		if field != 1 || data == nil {
+			return nil
+		}
+		otp, err := parseMigrationOTP(data)
+		if err != nil {
+			return fmt.Errorf("otp %d: %w", len(otps)+1, err)
+		}
+		otps = append(otps, otp)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("bad migration payload: %w", err)
+	}
+	if len(otps) == 0 {
+		return nil, fmt.Errorf("migration payload has no otp")
+	}
+
+	return otps, nil
+}
+
+// parseMigrationOTP разбирает сообщение OtpParameters:
+// secret = 1, name = 2, issuer = 3, algorithm = 4, digits = 5, type = 6, counter = 7
+func parseMigrationOTP(data []byte) (OTP, error) {
+	otp := OTP{Algorithm: OTPSHA1, Digits: defaultOTPDigits}
+	var secret []byte
+	var kind uint64
+
+	err := readProto(data, func(field int, value uint64, data []byte) error {
+		switch field {
+		case 1:
+			secret = data
+		case 2:
+			otp.Account = string(data)
+		case 3:
+			otp.Issuer = string(data)
+		case 4:
+			switch value {
+			case 0, migrationSHA1:
+			case migrationSHA256:
+				otp.Algorithm = OTPSHA256
+			case migrationSHA512:
+				otp.Algorithm = OTPSHA512
+			default:
+				return fmt.Errorf("unsupported algorithm %d", value)
+			}
+		case 5:
+			if value == migrationEightDigits {
+				otp.Digits = 8
+			} else if value != 0 && value != migrationSixDigits {
+				return fmt.Errorf("unsupported digits %d", value)
+			}
+		case 6:
+			kind = value
+		case 7:
+			otp.Counter = value
+		}
+		return nil
+	})
+	if err != nil {
+		return otp, err
+	}
+
+	switch kind {
+	case 0, migrationTOTP:
+		otp.Kind, otp.Period = OTPTotp, defaultOTPPeriod
+	case migrationHOTP:
+		otp.Kind = OTPHotp
+	default:
+		return otp, fmt.Errorf("unsupported otp type %d", kind)
+	}
+
+	//Имя бывает в виде "сервис:учетная запись", как метка otpauth://
+	if issuer, account, ok := strings.Cut(otp.Account, ":"); ok && (otp.Issuer == `` || otp.Issuer == issuer) {
+		otp.Issuer, otp.Account = issuer, account
+	}
+
+	otp.Secret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(secret)
+
+	return otp, otp.Validate()
+}
+
+// readProto перебирает поля сообщения protobuf: числовые поля передаются в value,
+// поля с длиной - в data. Поля фиксированной длины пропускаются, группы не поддерживаются.
+func readProto(message []byte, field func(number int, value uint64, data []byte) error) error {
+	for len(message) > 0 {
+		tag, n := binary.Uvarint(message)
+		if n <= 0 {
+			return fmt.Errorf("bad field tag")
+		}
+		message = message[n:]
+
+		var value uint64
+		var data []byte
+		switch tag & 7 {
+		case 0:
+			if value, n = binary.Uvarint(message); n <= 0 {
+				return fmt.Errorf("bad varint")
+			}
+			message = message[n:]
+		case 1, 5:
+			size := 8
+			if tag&7 == 5 {
+				size = 4
+			}
+			if len(message) < size {
+				return fmt.Errorf("truncated message")
+			}
+			message = message[size:]
+			continue
+		case 2:
+			size, n := binary.Uvarint(message)
+			if n <= 0 || size > uint64(len(message)-n) {
+				return fmt.Errorf("truncated message")
+			}
+			data = message[n : n+int(size)]
+			message = message[n+int(size):]
+		default:
+			return fmt.Errorf("unsupported wire type %d", tag&7)
+		}
+
+		if err := field(int(tag>>3), value, data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"testing"
+)
+
+func TestParseOTPURI(t *testing.T) {
+	tests := []struct {
+		name    string
+		uri     string
+		want    OTP
+		wantErr bool
+	}{
+		{
+			name: "totp defaults",
+			uri:  "otpauth://totp/GitHub:alice?secret=jbsw%20y3dp-ehpk3pxp",
+			want: OTP{Kind: OTPTotp, Secret: "JBSWY3DPEHPK3PXP", Issuer: "GitHub", Account: "alice", Algorithm: OTPSHA1, Digits: 6, Period: 30},
+		},
+		{
+			name: "hotp with parameters",
+			uri:  "otpauth://hotp/alice?secret=JBSWY3DPEHPK3PXP&issuer=Example&algorithm=sha256&digits=8&counter=5",
+			want: OTP{Kind: OTPHotp, Secret: "JBSWY3DPEHPK3PXP", Issuer: "Example", Account: "alice", Algorithm: OTPSHA256, Digits: 8, Counter: 5},
+		},
+		{name: "missing secret", uri: "otpauth://totp/GitHub:alice", wantErr: true},
+		{name: "bad base32", uri: "otpauth://totp/GitHub:alice?secret=JBSW1890", wantErr: true},
+		{name: "unsupported digits", uri: "otpauth://totp/GitHub:alice?secret=JBSWY3DPEHPK3PXP&digits=4", wantErr: true},
+		{name: "bad digits", uri: "otpauth://totp/GitHub:alice?secret=JBSWY3DPEHPK3PXP&digits=six", wantErr: true},
+		{name: "unsupported algorithm", uri: "otpauth://totp/GitHub:alice?secret=JBSWY3DPEHPK3PXP&algorithm=MD5", wantErr: true},
+		{name: "unknown kind", uri: "otpauth://motp/GitHub:alice?secret=JBSWY3DPEHPK3PXP", wantErr: true},
+		{name: "missing hotp counter", uri: "otpauth://hotp/GitHub:alice?secret=JBSWY3DPEHPK3PXP", wantErr: true},
+		{name: "other scheme", uri: "https://github.com/?secret=JBSWY3DPEHPK3PXP", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseOTPURI(tt.uri)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseOTPURI() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("ParseOTPURI() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestOTPURIRoundTrip проверяет, что адрес из URI разбирается обратно в тот же секрет
+func TestOTPURIRoundTrip(t *testing.T) {
+	otp := OTP{Kind: OTPTotp, Secret: "JBSWY3DPEHPK3PXP", Issuer: "GitHub", Account: "alice", Algorithm: OTPSHA512, Digits: 8, Period: 60}
+
+	got, err := ParseOTPURI(otp.URI())
+	if err != nil {
+		t.Fatalf("ParseOTPURI() error = %v", err)
+	}
+	if got != otp {
+		t.Errorf("ParseOTPURI(URI()) = %+v, want %+v", got, otp)
+	}
+}
@@ -0,0 +1,317 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// RecordType тип записи пользователя
+type RecordType string
+
+const (
+	RecordCredentials RecordType = "credentials" //Логин и пароль
+	RecordCard        RecordType = "card"        //Банковская карта
+	RecordText        RecordType = "text"        //Произвольный текст
+	RecordBinary      RecordType = "binary"      //Произвольные бинарные данные (файл)
+	RecordOTP         RecordType = "otp"         //Секрет одноразовых кодов TOTP/HOTP
+)
+
+// RecordTypes все поддерживаемые типы записей
+var RecordTypes = []RecordType{RecordCredentials, RecordCard, RecordText, RecordBinary, RecordOTP}
+
+// Record запись пользователя. Сериализуется в json на клиенте перед шифрованием,
+// поэтому сервер не видит ни содержимого, ни типа записи.
+type Record struct {
+	Type        RecordType   `json:"type"`                  //Тип записи, определяет заполненное поле
+	Credentials *Credentials `json:"credentials,omitempty"` //Логин и пароль
+	Card        *Card        `json:"card,omitempty"`        //Банковская карта
+	Text        *TextNote    `json:"text,omitempty"`        //Текстовая заметка
+	Binary      *BinaryFile  `json:"binary,omitempty"`      //Файл
+	OTP         *OTP         `json:"otp,omitempty"`         //Секрет одноразовых кодов
+}
+
+// Credentials пара логин/пароль
+type Credentials struct {
+	Login    string `json:"login"`         //Логин
+	Password string `json:"password"`      //Пароль
+	URL      string `json:"url,omitempty"` //Адрес сайта или сервиса
+}
+
+// Card данные банковской карты
+type Card struct {
+	Number string `json:"number"` //Номер карты, только цифры
+	Holder string `json:"holder"` //Держатель карты
+	Expiry string `json:"expiry"` //Срок действия в формате MM/YY или MM/YYYY
+	CVV    string `json:"cvv"`    //Код проверки
+}
+
+// TextNote произвольная текстовая заметка
+type TextNote struct {
+	Text string `json:"text"` //Текст
+}
+
+// BinaryFile произвольные бинарные данные
+type BinaryFile struct {
+	Name string `json:"name,omitempty"` //Исходное имя файла
+	Data []byte `json:"data"`           //Содержимое
+}
+
+// NewTextRecord создает текстовую запись
+func NewTextRecord(text string) Record {
+	return Record{Type: RecordText, Text: &TextNote{Text: text}}
+}
+
+// ParseRecordType проверяет название типа записи
+func ParseRecordType(name string) (RecordType, error) {
+	for _, recordType := range RecordTypes {
+		if string(recordType) == name {
+			return recordType, nil
+		}
+	}
+	return ``, fmt.Errorf("unknown record type %q", name)
+}
+
+// Validate проверяет, что заполнено поле, соответствующее типу, и его содержимое корректно
+func (m *Record) Validate() error {
+	filled := 0
+	for _, set := range []bool{m.Credentials != nil, m.Card != nil, m.Text != nil, m.Binary != nil, m.OTP != nil} {
+		if set {
+			filled++
+		}
+	}
+	if filled != 1 {
+		return fmt.Errorf("record must contain exactly one payload, got %d", filled)
+	}
+
+	switch m.Type {
+	case RecordCredentials:
+		if m.Credentials == nil {
+			return fmt.Errorf("credentials record without credentials")
+		}
+		return m.Credentials.Validate()
+	case RecordCard:
+		if m.Card == nil {
+			return fmt.Errorf("card record without card")
+		}
+		return m.Card.Validate()
+	case RecordText:
+		if m.Text == nil {
+			return fmt.Errorf("text record without text")
+		}
+		return nil
+	case RecordBinary:
+		if m.Binary == nil {
+			return fmt.Errorf("binary record without data")
+		}
+		return nil
+	case RecordOTP:
+		if m.OTP == nil {
+			return fmt.Errorf("otp record without secret")
+		}
+		return m.OTP.Validate()
+	default:
+		return fmt.Errorf("unknown record type %q", m.Type)
+	}
+}
+
+// Marshal проверяет и сериализует запись для шифрования
+func (m *Record) Marshal() ([]byte, error) {
+	if err := m.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid record: %w", err)
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("cannot marshal record: %w", err)
+	}
+
+	return data, nil
+}
+
+// ParseRecord разбирает расшифрованные данные. Данные, сохраненные до появления
+// типизированных записей, не являются json записью и читаются как текстовая заметка.
+func ParseRecord(data []byte) (Record, error) {
+	var record Record
+	if err := json.Unmarshal(data, &record); err != nil || record.Type == `` {
+		if header, content, ok := bytes.Cut(data, []byte("\n")); ok {
+			if record, err := ParseFileHeader(header); err == nil {
+				record.Binary.Data = content
+				return record, nil
+			}
+		}
+		return NewTextRecord(string(data)), nil
+	}
+
+	if err := record.Validate(); err != nil {
+		return record, fmt.Errorf("invalid record: %w", err)
+	}
+
+	return record, nil
+}
+
+// FileHeader заголовок большого файла, который шифруется потоком, а не целиком в записи:
+// json записи без содержимого и перевод строки, за ними следует содержимое файла
+func FileHeader(name string) []byte {
+	header, _ := json.Marshal(Record{Type: RecordBinary, Binary: &BinaryFile{Name: name}})
+	return append(header, '\n')
+}
+
+// ParseFileHeader разбирает заголовок большого файла без перевода строки
+func ParseFileHeader(header []byte) (Record, error) {
+	var record Record
+	if err := json.Unmarshal(header, &record); err != nil {
+		return record, fmt.Errorf("cannot unmarshal file header: %w", err)
+	}
+
+	if record.Type != RecordBinary || record.Binary == nil || len(record.Binary.Data) != 0 {
+		return record, fmt.Errorf("bad file header")
+	}
+
+	return record, nil
+}
+
+// Validate проверяет учетные данные. Логин необязателен: у пароля Wi-Fi или PIN-кода его нет.
+// Формат логина и адреса здесь не проверяется, как и срок действия карты: записи, сохраненные
+// или импортированные раньше, должны оставаться читаемыми. Новый ввод проверяет CheckInput.
+func (m *Credentials) Validate() error {
+	if m.Password == `` {
+		return fmt.Errorf("password required")
+	}
+	return nil
+}
+
+// CheckInput проверяет введенные пользователем логин и адрес: в них нет управляющих символов,
+// адрес - абсолютный URL с хостом или просто хост, как в адресной строке браузера.
+// Вызывается при вводе новых или измененных учетных данных.
+func (m *Credentials) CheckInput() error {
+	if strings.IndexFunc(m.Login, unicode.IsControl) >= 0 {
+		return fmt.Errorf("login must not contain control characters")
+	}
+
+	if m.URL == `` {
+		return nil
+	}
+	if strings.IndexFunc(m.URL, func(r rune) bool { return unicode.IsSpace(r) || unicode.IsControl(r) }) >= 0 {
+		return fmt.Errorf("url must not contain spaces")
+	}
+
+	raw := m.URL
+	if !strings.Contains(raw, "://") {
+		raw = "https://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("bad url: %w", err)
+	}
+	if u.Host == `` {
+		return fmt.Errorf("url %s has no host", m.URL)
+	}
+
+	return nil
+}
+
+// Validate проверяет номер карты по алгоритму Луна, формат срока действия и CVV.
+// Истечение срока здесь не проверяется: карта, сохраненная действующей, должна оставаться читаемой.
+func (m *Card) Validate() error {
+	if !luhnValid(m.Number) {
+		return fmt.Errorf("bad card number")
+	}
+
+	if m.Holder == `` {
+		return fmt.Errorf("card holder required")
+	}
+
+	if _, err := m.ExpiryTime(); err != nil {
+		return err
+	}
+
+	if len(m.CVV) < 3 || len(m.CVV) > 4 || !isDigits(m.CVV) {
+		return fmt.Errorf("cvv must be 3 or 4 digits")
+	}
+
+	return nil
+}
+
+// CheckExpiry проверяет, что срок действия карты не истек на момент now. Вызывается при вводе
+// новой или измененной карты, но не при чтении сохраненной.
+func (m *Card) CheckExpiry(now time.Time) error {
+	expiry, err := m.ExpiryTime()
+	if err != nil {
+		return err
+	}
+	if !now.Before(expiry) {
+		return fmt.Errorf("card expired %s", m.Expiry)
+	}
+	return nil
+}
+
+// ExpiryTime возвращает момент окончания срока действия карты: начало месяца, следующего за MM/YY.
+// Год принимается и полностью, MM/YYYY: так срок записывают некоторые менеджеры паролей.
+func (m *Card) ExpiryTime() (time.Time, error) {
+	month, year, ok := strings.Cut(m.Expiry, "/")
+	if !ok || len(month) != 2 || (len(year) != 2 && len(year) != 4) || !isDigits(month) || !isDigits(year) {
+		return time.Time{}, fmt.Errorf("expiry must be in MM/YY or MM/YYYY format")
+	}
+
+	mm, _ := strconv.Atoi(month)
+	yy, _ := strconv.Atoi(year)
+	if mm < 1 || mm > 12 {
+		return time.Time{}, fmt.Errorf("bad expiry month %s", month)
+	}
+	if len(year) == 2 {
+		yy += 2000
+	}
+
+	return time.Date(yy, time.Month(mm)+1, 1, 0, 0, 0, 0, time.UTC), nil
+}
+
+// NormalizeCardNumber убирает из номера карты пробелы и дефисы
+func NormalizeCardNumber(number string) string {
+	return strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' {
+			return -1
+		}
+		return r
+	}, number)
+}
+
+// luhnValid проверка контрольной цифры номера карты
+func luhnValid(number string) bool {
+	if len(number) < 12 || len(number) > 19 || !isDigits(number) {
+		return false
+	}
+
+	sum := 0
+	double := false
+	for i := len(number) - 1; i >= 0; i-- {
+		digit := int(number[i] - '0')
+		if double {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		double = !double
+	}
+
+	return sum%10 == 0
+}
+
+func isDigits(s string) bool {
+	if s == `` {
+		return false
+	}
+	for _, r := range s {
+		if r > unicode.MaxASCII || !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,208 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLuhnValid(t *testing.T) {
+	tests := []struct {
+		number string
+		want   bool
+	}{
+		{"4111111111111111", true},
+		{"5555555555554444", true},
+		{"378282246310005", true},
+		{"4111111111111112", false},
+		{"411111111111", false},
+		{"41111111111111111111", false},
+		{"4111 1111 1111 1111", false},
+		{"411111111111111a", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := luhnValid(tt.number); got != tt.want {
+			t.Errorf("luhnValid(%q) = %v, want %v", tt.number, got, tt.want)
+		}
+	}
+
+	if got := NormalizeCardNumber("4111 1111-1111 1111"); got != "4111111111111111" {
+		t.Errorf("NormalizeCardNumber() = %q, want 4111111111111111", got)
+	}
+}
+
+func TestCardValidate(t *testing.T) {
+	valid := Card{Number: "4111111111111111", Holder: "ALICE", Expiry: "12/30", CVV: "123"}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		change func(card *Card)
+	}{
+		{"bad number", func(card *Card) { card.Number = "4111111111111112" }},
+		{"no holder", func(card *Card) { card.Holder = `` }},
+		{"bad expiry", func(card *Card) { card.Expiry = "1230" }},
+		{"short cvv", func(card *Card) { card.CVV = "12" }},
+		{"long cvv", func(card *Card) { card.CVV = "12345" }},
+		{"letters in cvv", func(card *Card) { card.CVV = "12a" }},
+	}
+	for _, tt := range tests {
+		card := valid
+		tt.change(&card)
+		if err := card.Validate(); err == nil {
+			t.Errorf("Validate() %s error = nil, want error", tt.name)
+		}
+	}
+
+	//Истекшая карта остается корректной записью
+	expired := valid
+	expired.Expiry = "01/20"
+	if err := expired.Validate(); err != nil {
+		t.Errorf("Validate() expired card error = %v, want nil", err)
+	}
+}
+
+func TestCardExpiry(t *testing.T) {
+	tests := []struct {
+		expiry  string
+		want    time.Time
+		wantErr bool
+	}{
+		{expiry: "01/27", want: time.Date(2027, time.February, 1, 0, 0, 0, 0, time.UTC)},
+		{expiry: "12/27", want: time.Date(2028, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{expiry: "12/2027", want: time.Date(2028, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{expiry: "06/2100", want: time.Date(2100, time.July, 1, 0, 0, 0, 0, time.UTC)},
+		{expiry: "00/27", wantErr: true},
+		{expiry: "13/27", wantErr: true},
+		{expiry: "1/27", wantErr: true},
+		{expiry: "01/7", wantErr: true},
+		{expiry: "01/027", wantErr: true},
+		{expiry: "01-27", wantErr: true},
+		{expiry: "ab/cd", wantErr: true},
+	}
+	for _, tt := range tests {
+		card := Card{Expiry: tt.expiry}
+		got, err := card.ExpiryTime()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ExpiryTime(%s) error = %v, wantErr %v", tt.expiry, err, tt.wantErr)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("ExpiryTime(%s) = %v, want %v", tt.expiry, got, tt.want)
+		}
+	}
+
+	//Карта действует до конца месяца срока
+	card := Card{Expiry: "03/26"}
+	for _, tt := range []struct {
+		now     time.Time
+		expired bool
+	}{
+		{time.Date(2026, time.March, 1, 0, 0, 0, 0, time.UTC), false},
+		{time.Date(2026, time.March, 31, 23, 59, 59, 0, time.UTC), false},
+		{time.Date(2026, time.April, 1, 0, 0, 0, 0, time.UTC), true},
+		{time.Date(2027, time.January, 1, 0, 0, 0, 0, time.UTC), true},
+	} {
+		if err := card.CheckExpiry(tt.now); (err != nil) != tt.expired {
+			t.Errorf("CheckExpiry(%v) error = %v, want expired %v", tt.now, err, tt.expired)
+		}
+	}
+	if err := (&Card{Expiry: "03/2026"}).CheckExpiry(time.Date(2026, time.March, 15, 0, 0, 0, 0, time.UTC)); err != nil {
+		t.Errorf("CheckExpiry() 4-digit year error = %v, want nil", err)
+	}
+}
+
+func TestCredentialsValidate(t *testing.T) {
+	if err := (&Credentials{Password: "secret"}).Validate(); err != nil {
+		t.Errorf("Validate() without login error = %v, want nil", err)
+	}
+	if err := (&Credentials{Login: "alice"}).Validate(); err == nil {
+		t.Error("Validate() without password error = nil, want error")
+	}
+
+	tests := []struct {
+		name    string
+		login   string
+		url     string
+		wantErr bool
+	}{
+		{name: "no url", login: "alice"},
+		{name: "full url", login: "alice", url: "https://github.com/login"},
+		{name: "host only", url: "github.com"},
+		{name: "other scheme", url: "ssh://git@github.com:22"},
+		{name: "space in url", url: "my bank", wantErr: true},
+		{name: "no host", url: "https:///login", wantErr: true},
+		{name: "bad escape", url: "https://github.com/%zz", wantErr: true},
+		{name: "newline in login", login: "alice\nbob", wantErr: true},
+	}
+	for _, tt := range tests {
+		credentials := Credentials{Login: tt.login, Password: "secret", URL: tt.url}
+		if err := credentials.CheckInput(); (err != nil) != tt.wantErr {
+			t.Errorf("CheckInput() %s error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+		//Сохраненная запись читается независимо от формата адреса
+		if err := credentials.Validate(); err != nil {
+			t.Errorf("Validate() %s error = %v, want nil", tt.name, err)
+		}
+	}
+}
+
+func TestParseRecord(t *testing.T) {
+	record := Record{Type: RecordCredentials, Credentials: &Credentials{Login: "alice", Password: "secret"}}
+	data, err := record.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	got, err := ParseRecord(data)
+	if err != nil {
+		t.Fatalf("ParseRecord() error = %v", err)
+	}
+	if got.Type != RecordCredentials || *got.Credentials != *record.Credentials {
+		t.Errorf("ParseRecord() = %+v, want %+v", got, record)
+	}
+
+	//Данные, сохраненные до типизированных записей, читаются как текст
+	for _, legacy := range []string{"plain text", `{"login":"alice"}`, `["a"]`, "", "line one\nline two"} {
+		got, err := ParseRecord([]byte(legacy))
+		if err != nil {
+			t.Errorf("ParseRecord(%q) error = %v", legacy, err)
+			continue
+		}
+		if got.Type != RecordText || got.Text.Text != legacy {
+			t.Errorf("ParseRecord(%q) = %+v, want text record", legacy, got)
+		}
+	}
+
+	//Большой файл: заголовок записи и содержимое после перевода строки
+	got, err = ParseRecord(append(FileHeader("photo.jpg"), "\x00binary\n"...))
+	if err != nil {
+		t.Fatalf("ParseRecord() file error = %v", err)
+	}
+	if got.Type != RecordBinary || got.Binary.Name != "photo.jpg" || string(got.Binary.Data) != "\x00binary\n" {
+		t.Errorf("ParseRecord() file = %+v, want photo.jpg", got)
+	}
+
+	//Типизированная запись с ошибкой не выдается за текст
+	if _, err := ParseRecord([]byte(`{"type":"card","card":{"number":"1"}}`)); err == nil {
+		t.Error("ParseRecord() invalid card error = nil, want error")
+	}
+	if _, err := ParseRecord([]byte(`{"type":"text"}`)); err == nil {
+		t.Error("ParseRecord() record without payload error = nil, want error")
+	}
+}
+
+func TestRecordValidate(t *testing.T) {
+	record := Record{Type: RecordText, Text: &TextNote{Text: "a"}, Binary: &BinaryFile{}}
+	if err := record.Validate(); err == nil {
+		t.Error("Validate() two payloads error = nil, want error")
+	}
+	record = Record{Type: RecordCard, Text: &TextNote{Text: "a"}}
+	if err := record.Validate(); err == nil {
+		t.Error("Validate() mismatched payload error = nil, want error")
+	}
+	if _, err := ParseRecordType("password"); err == nil {
+		t.Error("ParseRecordType() unknown error = nil, want error")
+	}
+}
@@ -0,0 +1,86 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// SharePermission права получателя на общие данные
+type SharePermission string
+
+const (
+	ShareRead  SharePermission = "read"  //Только чтение
+	ShareWrite SharePermission = "write" //Чтение и сохранение новых ревизий
+)
+
+// UserKeys пара ключей пользователя для обмена данными. Закрытый ключ зашифрован клиентом
+// паролем пользователя, сервер хранит его, чтобы ключи были доступны на любом устройстве.
+type UserKeys struct {
+	PublicKey  []byte `json:"public_key"`  //Открытый ключ RSA в PEM
+	PrivateKey []byte `json:"private_key"` //Зашифрованный закрытый ключ
+}
+
+// Validate проверяет наличие ключей
+func (m *UserKeys) Validate() error {
+	if len(m.PublicKey) == 0 {
+		return fmt.Errorf("public key required")
+	}
+	if len(m.PrivateKey) == 0 {
+		return fmt.Errorf("private key required")
+	}
+
+	return nil
+}
+
+// ShareRequest запрос владельца на передачу данных другому пользователю
+type ShareRequest struct {
+	Recipient  string          `json:"recipient"`  //Логин получателя
+	Key        []byte          `json:"key"`        //Ключ данных, зашифрованный открытым ключом получателя
+	Permission SharePermission `json:"permission"` //Права получателя
+}
+
+// Validate проверяет заполнение запроса
+func (m *ShareRequest) Validate() error {
+	if m.Recipient == `` {
+		return fmt.Errorf("recipient required")
+	}
+	if len(m.Key) == 0 {
+		return fmt.Errorf("key required")
+	}
+	if m.Permission != ShareRead && m.Permission != ShareWrite {
+		return fmt.Errorf("unknown permission %q", m.Permission)
+	}
+
+	return nil
+}
+
+// Share данные, переданные одним пользователем другому
+type Share struct {
+	Id         string          `json:"id"`            //Идентификатор передачи
+	Identifier string          `json:"identifier"`    //Идентификатор данных у владельца
+	Owner      string          `json:"owner"`         //Логин владельца
+	Recipient  string          `json:"recipient"`     //Логин получателя
+	Permission SharePermission `json:"permission"`    //Права получателя
+	Key        []byte          `json:"key,omitempty"` //Зашифрованный ключ данных, передается только получателю
+	Accepted   bool            `json:"accepted"`      //Получатель принял данные
+	CreatedAt  time.Time       `json:"created_at"`    //Время передачи
+
+	OwnerId     string `json:"-"` //Идентификатор владельца, используется только сервером
+	RecipientId string `json:"-"` //Идентификатор получателя, используется только сервером
+}
+
+// ShareList общие данные пользователя
+type ShareList struct {
+	Outgoing []Share `json:"outgoing"` //Данные, переданные пользователем
+	Incoming []Share `json:"incoming"` //Данные, полученные пользователем
+}
+
+// RekeyRequest запрос владельца на смену ключа данных после отзыва передачи
+type RekeyRequest struct {
+	Origin string `json:"origin"` //Новый идентификатор, от которого получен ключ данных
+}
+
+// Validate проверяет заполнение запроса
+func (m *RekeyRequest) Validate() error {
+	return ValidatePath(m.Origin)
+}
@@ -0,0 +1,11 @@
+package models
+
+// SyncChanges изменения данных пользователя после курсора синхронизации.
+// Клиент применяет сначала Deleted, затем Created и Updated, и запоминает Cursor для следующего запроса.
+type SyncChanges struct {
+	Cursor  int64      `json:"cursor"`  //Курсор для следующего запроса
+	Reset   bool       `json:"reset"`   //Курсор устарел или не указан: Created содержит все данные, остальные удалены
+	Created []DataInfo `json:"created"` //Созданные данные, в том числе возвращенные из корзины
+	Updated []DataInfo `json:"updated"` //Измененные данные
+	Deleted []string   `json:"deleted"` //Идентификаторы удаленных данных
+}
@@ -0,0 +1,9 @@
+package models
+
+// Usage место, занятое пользователем на сервере, и ограничения квоты (0 - без ограничения)
+type Usage struct {
+	Entries    int64 `json:"entries"`     //Количество данных, не считая корзины
+	Bytes      int64 `json:"bytes"`       //Объем всех ревизий данных, корзины и незавершенных загрузок
+	MaxEntries int64 `json:"max_entries"` //Максимальное количество данных
+	MaxBytes   int64 `json:"max_bytes"`   //Максимальный объем
+}
@@ -5,7 +5,6 @@ import (
 	"errors"
 	"fmt"
 	"github.com/go-chi/chi/v5"
-	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/lionslon/go-keepass/internal/auth"
 	"github.com/lionslon/go-keepass/internal/deadline"
 	"github.com/lionslon/go-keepass/internal/logger"
@@ -26,9 +25,15 @@ const (
 type App struct {
 	server     *http.Server
 	notifyStop context.CancelFunc
+
+	storage         storage.Storage
+	trashRetention  time.Duration      //Время хранения данных в корзине (0 - очистка отключена)
+	uploadRetention time.Duration      //Время хранения незавершенных загрузок (0 - очистка отключена)
+	purgeCtx        context.Context    //Контекст очистки корзины и загрузок
+	stopPurge       context.CancelFunc //Остановка очистки корзины и загрузок
 }
 
-func Create(cfg *config.Config, storage *storage.KeeperStorage) (*App, error) {
+func Create(cfg *config.Config, storage storage.Storage) (*App, error) {
 
 	// Инициализируем объект для создания/проверки jwt
 	auth.Initialize(cfg)
@@ -39,19 +44,35 @@ func Create(cfg *config.Config, storage *storage.KeeperStorage) (*App, error) {
 	// Подключаем middleware deadline context
 	router.Use(deadline.Middleware)
 	// Подключаем storage
-	keeperHandler := handlers.NewKeeperHandler(storage)
+	keeperHandler := handlers.NewKeeperHandler(storage, handlers.Limits{
+		MaxRequestSize: cfg.MaxRequestSize,
+		MaxEntries:     cfg.QuotaEntries,
+		MaxBytes:       cfg.QuotaBytes,
+	})
 	// Регистрируем роутер
 	keeperHandler.Register(router)
+	// Очистка корзины и загрузок останавливается при завершении работы сервера
+	purgeCtx, stopPurge := context.WithCancel(context.Background())
 
 	return &App{
 		server: &http.Server{
 			Addr:    cfg.Endpoint,
 			Handler: router,
 		},
+		storage:         storage,
+		trashRetention:  cfg.TrashRetention,
+		uploadRetention: cfg.UploadRetention,
+		purgeCtx:        purgeCtx,
+		stopPurge:       stopPurge,
 	}, nil
 }
 
 func (m *App) Run() {
+	// Запускаем очистку корзины и незавершенных загрузок
+	if m.trashRetention > 0 || m.uploadRetention > 0 {
+		go purge(m.purgeCtx, m.storage, m.storage, m.trashRetention, m.uploadRetention)
+	}
+
 	if err := m.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Fatalf("cannot listen: %s\n", err)
 	}
@@ -66,6 +87,8 @@ func (m *App) ServerDone() <-chan struct{} {
 func (m *App) Shutdown() error {
 	defer m.notifyStop()
 
+	m.stopPurge()
+
 	ctx, cancel := context.WithTimeout(context.Background(), shutdownTime)
 	defer cancel()
 
@@ -0,0 +1,47 @@
+package app
+
+import (
+	"context"
+	"github.com/lionslon/go-keepass/internal/logger"
+	"github.com/lionslon/go-keepass/internal/storage"
+	"time"
+)
+
+const (
+	purgeInterval = time.Hour
+)
+
+// purge раз в purgeInterval окончательно удаляет данные, пролежавшие в корзине дольше trashRetention,
+// и загрузки, не завершенные за uploadRetention. Нулевой срок отключает соответствующую очистку.
+// Первая очистка выполняется сразу после запуска, работа завершается с отменой ctx.
+func purge(ctx context.Context, trash storage.TrashStorage, uploads storage.UploadStorage, trashRetention, uploadRetention time.Duration) {
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		if trashRetention > 0 {
+			count, err := trash.PurgeTrash(ctx, time.Now().Add(-trashRetention))
+			if err != nil {
+				logger.Error("cannot purge trash: %s", err)
+			} else if count > 0 {
+				logger.Info("Purged %d trash items", count)
+			}
+		}
+
+		//Брошенные загрузки иначе навсегда занимали бы квоту пользователя
+		if uploadRetention > 0 {
+			count, err := uploads.PurgeUploads(ctx, time.Now().Add(-uploadRetention))
+			if err != nil {
+				logger.Error("cannot purge uploads: %s", err)
+			} else if count > 0 {
+				logger.Info("Purged %d abandoned uploads", count)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
 
 	"time"
 )
@@ -14,17 +16,47 @@ type Config struct {
 	CryptoKey   string        `env:"RUN_ADDRESS"`  //Путь до файла с приватным ключом сервера для расшифровывания данных
 	JWTKey      []byte        `env:"JWT_KEY"`      //Ключ для создания/проверки jwt для авторизации
 	JWTDuration time.Duration `env:"JWT_DURATION"` //Время действия jwt для авторизации
+
+	TrashRetention  time.Duration `env:"TRASH_RETENTION"`  //Время хранения данных в корзине (0 - хранить бессрочно)
+	UploadRetention time.Duration `env:"UPLOAD_RETENTION"` //Время хранения незавершенных загрузок (0 - хранить бессрочно)
+
+	MaxRequestSize int64 `env:"MAX_REQUEST_SIZE"` //Максимальный размер тела запроса в байтах (0 - без ограничения)
+	QuotaEntries   int64 `env:"QUOTA_ENTRIES"`    //Максимальное количество данных пользователя (0 - без ограничения)
+	QuotaBytes     int64 `env:"QUOTA_BYTES"`      //Максимальный объем данных пользователя в байтах (0 - без ограничения)
+
+	Command     string   //Подкоманда (пусто - запуск сервера)
+	CommandArgs []string //Аргументы подкоманды, оставшиеся после флагов
 }
 
+// Create разбирает флаги командной строки и переменные окружения
 func Create() (*Config, error) {
+	return parse(os.Args[0], os.Args[1:])
+}
+
+// parse разбирает аргументы командной строки args, переменные окружения переопределяют флаги
+func parse(name string, args []string) (*Config, error) {
 	cfg := &Config{}
-	var JWTKey, JWTDuration string
-	flag.StringVar(&cfg.Endpoint, "a", "localhost:8088", "address and port to run server")
-	flag.StringVar(&cfg.DataBaseDSN, "d", "", "db dsn")
-	flag.StringVar(&cfg.CryptoKey, "p", "private.rsa", "Server private key path")
-	flag.StringVar(&JWTKey, "k", "gBz65sbl0GAb", "JWT key")
-	flag.StringVar(&JWTDuration, "t", "60m", "JWT duration")
-	flag.Parse()
+	var JWTKey, JWTDuration, TrashRetention, UploadRetention string
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	flags.StringVar(&cfg.Endpoint, "a", "localhost:8088", "address and port to run server")
+	flags.StringVar(&cfg.DataBaseDSN, "d", "", "db dsn (postgres dsn, sqlite://path/to/file.db or mem://)")
+	flags.StringVar(&cfg.CryptoKey, "p", "private.rsa", "Server private key path")
+	flags.StringVar(&JWTKey, "k", "gBz65sbl0GAb", "JWT key")
+	flags.StringVar(&JWTDuration, "t", "60m", "JWT duration")
+	flags.StringVar(&TrashRetention, "r", "720h", "trash retention, 0 keeps deleted data forever")
+	flags.StringVar(&UploadRetention, "u", "24h", "unfinished upload retention, 0 keeps abandoned uploads forever")
+	//Размер запроса больше части загрузки клиента, квоты выключены по умолчанию, чтобы обновление
+	//сервера не отклоняло запросы существующих пользователей
+	flags.Int64Var(&cfg.MaxRequestSize, "l", 16<<20, "max request body size in bytes, 0 - unlimited")
+	flags.Int64Var(&cfg.QuotaEntries, "e", 0, "max entries per user, 0 - unlimited (quotas are opt-in)")
+	flags.Int64Var(&cfg.QuotaBytes, "b", 0, "max stored bytes per user, 0 - unlimited (quotas are opt-in)")
+
+	//Подкоманда указывается первой: server migrate -d dsn status
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cfg.Command, args = args[0], args[1:]
+	}
+	flags.Parse(args)
+	cfg.CommandArgs = flags.Args()
 
 	if cfg.DataBaseDSN == `` {
 		return nil, fmt.Errorf("db dsn is empty")
@@ -40,5 +72,44 @@ func Create() (*Config, error) {
 		cfg.JWTDuration = duration
 	}
 
+	if retention, exist := os.LookupEnv("TRASH_RETENTION"); exist {
+		TrashRetention = retention
+	}
+	if retention, err := time.ParseDuration(TrashRetention); err != nil {
+		return nil, fmt.Errorf("TRASH RETENTION: %w", err)
+	} else if retention < 0 {
+		return nil, fmt.Errorf("TRASH RETENTION: must not be negative")
+	} else {
+		cfg.TrashRetention = retention
+	}
+
+	if retention, exist := os.LookupEnv("UPLOAD_RETENTION"); exist {
+		UploadRetention = retention
+	}
+	if retention, err := time.ParseDuration(UploadRetention); err != nil {
+		return nil, fmt.Errorf("UPLOAD RETENTION: %w", err)
+	} else if retention < 0 {
+		return nil, fmt.Errorf("UPLOAD RETENTION: must not be negative")
+	} else {
+		cfg.UploadRetention = retention
+	}
+
+	for env, value := range map[string]*int64{
+		"MAX_REQUEST_SIZE": &cfg.MaxRequestSize,
+		"QUOTA_ENTRIES":    &cfg.QuotaEntries,
+		"QUOTA_BYTES":      &cfg.QuotaBytes,
+	} {
+		if limit, exist := os.LookupEnv(env); exist {
+			n, err := strconv.ParseInt(limit, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", env, err)
+			}
+			*value = n
+		}
+		if *value < 0 {
+			return nil, fmt.Errorf("%s: must not be negative", env)
+		}
+	}
+
 	return cfg, nil
 }
@@ -0,0 +1,100 @@
+package config
+
+import (
+	"os"
+	"slices"
+	"testing"
+	"time"
+)
+
+// clearEnv убирает переменные окружения конфига на время теста
+func clearEnv(t *testing.T) {
+	for _, env := range []string{"JWT_DURATION", "TRASH_RETENTION", "UPLOAD_RETENTION", "MAX_REQUEST_SIZE", "QUOTA_ENTRIES", "QUOTA_BYTES"} {
+		t.Setenv(env, ``)
+		os.Unsetenv(env)
+	}
+}
+
+func TestParseDefaults(t *testing.T) {
+	clearEnv(t)
+
+	cfg, err := parse("server", []string{"-d", "mem://"})
+	if err != nil {
+		t.Fatalf("parse() error = %v", err)
+	}
+
+	//Ограничение размера запроса включено, квоты включаются явно
+	if cfg.MaxRequestSize != 16<<20 {
+		t.Errorf("MaxRequestSize = %d, want %d", cfg.MaxRequestSize, 16<<20)
+	}
+	if cfg.QuotaEntries != 0 || cfg.QuotaBytes != 0 {
+		t.Errorf("quotas = %d entries, %d bytes, want unlimited", cfg.QuotaEntries, cfg.QuotaBytes)
+	}
+	if cfg.TrashRetention != 720*time.Hour || cfg.UploadRetention != 24*time.Hour || cfg.JWTDuration != time.Hour {
+		t.Errorf("durations = trash %v, upload %v, jwt %v", cfg.TrashRetention, cfg.UploadRetention, cfg.JWTDuration)
+	}
+	if cfg.Command != `` || len(cfg.CommandArgs) != 0 {
+		t.Errorf("command = %q %q, want none", cfg.Command, cfg.CommandArgs)
+	}
+}
+
+func TestParseLimits(t *testing.T) {
+	clearEnv(t)
+
+	cfg, err := parse("server", []string{"-d", "mem://", "-l", "1024", "-e", "10", "-b", "4096"})
+	if err != nil {
+		t.Fatalf("parse() error = %v", err)
+	}
+	if cfg.MaxRequestSize != 1024 || cfg.QuotaEntries != 10 || cfg.QuotaBytes != 4096 {
+		t.Errorf("limits = %d, %d, %d, want 1024, 10, 4096", cfg.MaxRequestSize, cfg.QuotaEntries, cfg.QuotaBytes)
+	}
+
+	//Переменные окружения важнее флагов, 0 снимает ограничение
+	t.Setenv("MAX_REQUEST_SIZE", "0")
+	t.Setenv("QUOTA_BYTES", "100")
+	cfg, err = parse("server", []string{"-d", "mem://", "-b", "4096"})
+	if err != nil {
+		t.Fatalf("parse() error = %v", err)
+	}
+	if cfg.MaxRequestSize != 0 || cfg.QuotaBytes != 100 {
+		t.Errorf("limits from env = %d, %d, want 0, 100", cfg.MaxRequestSize, cfg.QuotaBytes)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+	}{
+		{name: "no dsn", args: nil},
+		{name: "negative request size", args: []string{"-d", "mem://", "-l", "-1"}},
+		{name: "negative quota", args: []string{"-d", "mem://", "-e", "-5"}},
+		{name: "bad quota env", args: []string{"-d", "mem://"}, env: map[string]string{"QUOTA_ENTRIES": "many"}},
+		{name: "negative retention", args: []string{"-d", "mem://", "-r", "-1h"}},
+		{name: "bad jwt duration env", args: []string{"-d", "mem://"}, env: map[string]string{"JWT_DURATION": "soon"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			for env, value := range tt.env {
+				t.Setenv(env, value)
+			}
+			if _, err := parse("server", tt.args); err == nil {
+				t.Error("parse() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestParseCommand(t *testing.T) {
+	clearEnv(t)
+
+	cfg, err := parse("server", []string{"migrate", "-d", "sqlite://keeper.db", "down", "2"})
+	if err != nil {
+		t.Fatalf("parse() error = %v", err)
+	}
+	if cfg.Command != "migrate" || !slices.Equal(cfg.CommandArgs, []string{"down", "2"}) {
+		t.Errorf("command = %q %q, want migrate [down 2]", cfg.Command, cfg.CommandArgs)
+	}
+}
@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/lionslon/go-keepass/internal/deadline"
+	"github.com/lionslon/go-keepass/internal/logger"
+	"github.com/lionslon/go-keepass/internal/models"
+	"github.com/lionslon/go-keepass/internal/storage"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Вложения данных: POST /api/data/{id}/attachments/{name} создает загрузку вложения, которая продолжается
+// так же, как загрузка больших данных, через /api/uploads/{upload}. Вложение не меняет ревизию данных.
+const (
+	// attachmentTypeHeader тип содержимого вложения при загрузке
+	attachmentTypeHeader = "X-Attachment-Type"
+	// attachmentKeyHeader ключ вложения, зашифрованный ключом данных, в base64
+	attachmentKeyHeader = "X-Attachment-Key"
+
+	defaultAttachmentType = "application/octet-stream"
+)
+
+// attachmentParam имя вложения из пути запроса, false - ответ уже отправлен
+func (m *KeeperHandler) attachmentParam(w http.ResponseWriter, r *http.Request) (string, bool) {
+	name, err := pathParam(r, "attachment")
+	if err == nil {
+		err = models.ValidateAttachmentName(name)
+	}
+	if err != nil {
+		m.errorRespond(w, http.StatusBadRequest, fmt.Errorf("bad attachment name: %s", err))
+		return ``, false
+	}
+	return name, true
+}
+
+func (m *KeeperHandler) listAttachments(w http.ResponseWriter, r *http.Request) {
+
+	//Проверяем доступ к данным пользователя или коллекции организации
+	vault, ok := m.authorize(w, r, readAccess)
+	if !ok {
+		return
+	}
+
+	dataId, ok := m.dataParam(w, r)
+	if !ok {
+		return
+	}
+
+	attachments, err := m.attachments.ListAttachments(r.Context(), vault, dataId)
+	if errors.Is(err, storage.ErrNotFound) {
+		m.errorRespond(w, http.StatusNotFound, fmt.Errorf("cannot list attachments: %s", err))
+		return
+	}
+	if err != nil {
+		m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot list attachments: %s", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(attachments); err != nil {
+		logger.Error("cannot encode attachments: %s", err)
+	}
+}
+
+func (m *KeeperHandler) createAttachmentUpload(w http.ResponseWriter, r *http.Request) {
+
+	//Разобрали запрос
+	dataId, ok := m.dataParam(w, r)
+	if !ok {
+		return
+	}
+	name, ok := m.attachmentParam(w, r)
+	if !ok {
+		return
+	}
+	size, err := strconv.ParseInt(r.Header.Get(uploadLengthHeader), 10, 64)
+	if err != nil || size < 0 {
+		m.errorRespond(w, http.StatusBadRequest, fmt.Errorf("bad %s header", uploadLengthHeader))
+		return
+	}
+	key, err := base64.StdEncoding.DecodeString(r.Header.Get(attachmentKeyHeader))
+	if err != nil || len(key) == 0 {
+		m.errorRespond(w, http.StatusBadRequest, fmt.Errorf("bad %s header", attachmentKeyHeader))
+		return
+	}
+	mimeType := r.Header.Get(attachmentTypeHeader)
+	if mimeType == `` {
+		mimeType = defaultAttachmentType
+	}
+
+	//Проверяем доступ к данным пользователя или коллекции организации
+	vault, ok := m.authorize(w, r, writeAccess)
+	if !ok {
+		return
+	}
+
+	//Данные должны существовать, окончательно это проверяется при завершении загрузки
+	if _, err := m.attachments.ListAttachments(r.Context(), vault, dataId); err != nil {
+		code := http.StatusInternalServerError
+		if errors.Is(err, storage.ErrNotFound) {
+			code = http.StatusNotFound
+		}
+		m.errorRespond(w, code, fmt.Errorf("cannot create attachment upload: %s", err))
+		return
+	}
+
+	//Место под все содержимое занимается при создании загрузки
+	if !m.checkQuota(w, r, vault, 0, size+int64(len(key))) {
+		return
+	}
+
+	uploadId, err := m.uploads.CreateUpload(r.Context(), vault, storage.Upload{
+		DataId:     dataId,
+		Size:       size,
+		CreateOnly: r.Header.Get("If-None-Match") == "*",
+		Attachment: name,
+		MimeType:   mimeType,
+		Key:        key,
+	})
+	if err != nil {
+		m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot create attachment upload: %s", err))
+		return
+	}
+
+	w.Header().Set("Location", vaultPath(r, uploadsPath)+"/"+uploadId)
+	w.Header().Set(uploadOffsetHeader, "0")
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (m *KeeperHandler) getAttachment(w http.ResponseWriter, r *http.Request) {
+
+	//Проверяем доступ к данным пользователя или коллекции организации
+	vault, ok := m.authorize(w, r, readAccess)
+	if !ok {
+		return
+	}
+
+	dataId, ok := m.dataParam(w, r)
+	if !ok {
+		return
+	}
+	name, ok := m.attachmentParam(w, r)
+	if !ok {
+		return
+	}
+
+	attachment, content, err := m.attachments.GetAttachment(r.Context(), vault, dataId, name)
+	if errors.Is(err, storage.ErrNotFound) {
+		m.errorRespond(w, http.StatusNotFound, fmt.Errorf("cannot get attachment: %s", err))
+		return
+	}
+	if err != nil {
+		m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot get attachment: %s", err))
+		return
+	}
+
+	w.Header().Set(attachmentKeyHeader, base64.StdEncoding.EncodeToString(attachment.Key))
+	if content.Origin != `` {
+		w.Header().Set(originHeader, url.PathEscape(content.Origin))
+	}
+	w.Header().Set("Content-Type", attachment.MimeType)
+	w.Header().Set("Content-Length", strconv.FormatInt(content.Size, 10))
+
+	//Заголовки уже отправлены, об ошибке остается только записать в лог
+	if err := m.data.WriteContent(deadline.Unbounded(r.Context()), content, w); err != nil {
+		logger.Error("cannot write attachment: %s", err)
+	}
+}
+
+func (m *KeeperHandler) deleteAttachment(w http.ResponseWriter, r *http.Request) {
+
+	//Проверяем доступ к данным пользователя или коллекции организации
+	vault, ok := m.authorize(w, r, writeAccess)
+	if !ok {
+		return
+	}
+
+	dataId, ok := m.dataParam(w, r)
+	if !ok {
+		return
+	}
+	name, ok := m.attachmentParam(w, r)
+	if !ok {
+		return
+	}
+
+	err := m.attachments.DeleteAttachment(r.Context(), vault, dataId, name)
+	if errors.Is(err, storage.ErrNotFound) {
+		m.errorRespond(w, http.StatusNotFound, fmt.Errorf("cannot delete attachment: %s", err))
+		return
+	}
+	if err != nil {
+		m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot delete attachment: %s", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
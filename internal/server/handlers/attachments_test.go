@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"github.com/lionslon/go-keepass/internal/models"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// createAttachmentUpload начинает загрузку вложения name размером size и возвращает ее путь
+func createAttachmentUpload(t *testing.T, s *testServer, token, dataId, name, size string) string {
+	t.Helper()
+
+	resp := s.do(t, token, http.MethodPost, "/api/data/"+dataId+"/attachments/"+name, nil,
+		uploadLengthHeader, size,
+		attachmentTypeHeader, "text/plain",
+		attachmentKeyHeader, base64.StdEncoding.EncodeToString([]byte("key of "+name)))
+	expect(t, resp, http.StatusCreated)
+	location := resp.Header.Get("Location")
+	if !strings.HasPrefix(location, uploadsPath+"/") {
+		t.Fatalf("attachment upload Location = %q, want under %s", location, uploadsPath)
+	}
+	return location
+}
+
+func TestAttachmentFlow(t *testing.T) {
+	s := newTestServer(t, Limits{})
+	_, token := s.user(t, "alice")
+
+	expect(t, s.do(t, token, http.MethodPost, "/api/data/vpn", strings.NewReader("data")), http.StatusAccepted)
+
+	upload := createAttachmentUpload(t, s, token, "vpn", "config.ovpn", "6")
+	//Часть длиннее объявленного размера отклоняется
+	expect(t, s.do(t, token, http.MethodPatch, upload, strings.NewReader("1234567"), uploadOffsetHeader, "0"),
+		http.StatusRequestEntityTooLarge)
+	resp := s.do(t, token, http.MethodPatch, upload, strings.NewReader("config"), uploadOffsetHeader, "0")
+	expect(t, resp, http.StatusNoContent)
+	//Вложение не меняет ревизию данных
+	if got := resp.Header.Get("ETag"); got != `"1"` {
+		t.Errorf("final PATCH ETag = %s, want \"1\"", got)
+	}
+
+	body := expect(t, s.do(t, token, http.MethodGet, "/api/data/vpn/attachments", nil), http.StatusOK)
+	var attachments []models.Attachment
+	if err := json.Unmarshal([]byte(body), &attachments); err != nil {
+		t.Fatalf("cannot decode attachments %q: %v", body, err)
+	}
+	if len(attachments) != 1 || attachments[0].Name != "config.ovpn" || attachments[0].MimeType != "text/plain" ||
+		attachments[0].Size != 6 || attachments[0].Key != nil {
+		t.Errorf("attachments = %+v, want config.ovpn of 6 bytes without key", attachments)
+	}
+
+	resp = s.do(t, token, http.MethodGet, "/api/data/vpn/attachments/config.ovpn", nil)
+	if body := expect(t, resp, http.StatusOK); body != "config" {
+		t.Errorf("GET attachment = %q, want config", body)
+	}
+	if got := resp.Header.Get("Content-Type"); got != "text/plain" {
+		t.Errorf("GET attachment Content-Type = %s, want text/plain", got)
+	}
+	if key, _ := base64.StdEncoding.DecodeString(resp.Header.Get(attachmentKeyHeader)); string(key) != "key of config.ovpn" {
+		t.Errorf("GET attachment key = %q, want key of config.ovpn", key)
+	}
+
+	//Вложение другого пользователя не видно
+	_, other := s.user(t, "bob")
+	expect(t, s.do(t, other, http.MethodGet, "/api/data/vpn/attachments/config.ovpn", nil), http.StatusNotFound)
+
+	expect(t, s.do(t, token, http.MethodDelete, "/api/data/vpn/attachments/config.ovpn", nil), http.StatusNoContent)
+	expect(t, s.do(t, token, http.MethodGet, "/api/data/vpn/attachments/config.ovpn", nil), http.StatusNotFound)
+	expect(t, s.do(t, token, http.MethodDelete, "/api/data/vpn/attachments/config.ovpn", nil), http.StatusNotFound)
+}
+
+func TestAttachmentErrors(t *testing.T) {
+	s := newTestServer(t, Limits{MaxBytes: 20})
+	_, token := s.user(t, "alice")
+
+	key := base64.StdEncoding.EncodeToString([]byte("key"))
+
+	//Вложения есть только у существующих данных
+	expect(t, s.do(t, token, http.MethodPost, "/api/data/missing/attachments/a.txt", nil,
+		uploadLengthHeader, "1", attachmentKeyHeader, key), http.StatusNotFound)
+	expect(t, s.do(t, token, http.MethodGet, "/api/data/missing/attachments", nil), http.StatusNotFound)
+
+	expect(t, s.do(t, token, http.MethodPost, "/api/data/vpn", strings.NewReader("data")), http.StatusAccepted)
+	expect(t, s.do(t, token, http.MethodGet, "/api/data/vpn/attachments/missing.txt", nil), http.StatusNotFound)
+
+	//Без ключа и размера загрузка не начинается
+	expect(t, s.do(t, token, http.MethodPost, "/api/data/vpn/attachments/a.txt", nil, uploadLengthHeader, "1"),
+		http.StatusBadRequest)
+	expect(t, s.do(t, token, http.MethodPost, "/api/data/vpn/attachments/a.txt", nil, attachmentKeyHeader, key),
+		http.StatusBadRequest)
+
+	//Вложение с ключом занимает место в квоте при создании загрузки
+	expect(t, s.do(t, token, http.MethodPost, "/api/data/vpn/attachments/a.txt", nil,
+		uploadLengthHeader, "14", attachmentKeyHeader, key), http.StatusInsufficientStorage)
+	expect(t, s.do(t, token, http.MethodPost, "/api/data/vpn/attachments/a.txt", nil,
+		uploadLengthHeader, "13", attachmentKeyHeader, key), http.StatusCreated)
+}
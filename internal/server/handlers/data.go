@@ -0,0 +1,529 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/lionslon/go-keepass/internal/deadline"
+	"github.com/lionslon/go-keepass/internal/logger"
+	"github.com/lionslon/go-keepass/internal/models"
+	"github.com/lionslon/go-keepass/internal/storage"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const (
+	// metadataHeader заголовок с зашифрованными клиентом метаданными в base64
+	metadataHeader = "X-Metadata"
+	// originHeader заголовок с идентификатором, от которого получен ключ перемещенных данных
+	originHeader = "X-Data-Origin"
+
+	defaultListLimit = 100  // размер страницы списка данных по умолчанию
+	maxListLimit     = 1000 // максимальный размер страницы списка данных
+	maxBatchSize     = 1000 // максимальное количество данных в пакетном запросе
+)
+
+// readMetadata возвращает метаданные из заголовка запроса, nil - заголовка нет
+func readMetadata(r *http.Request) ([]byte, error) {
+	header := r.Header.Get(metadataHeader)
+	if header == `` {
+		return nil, nil
+	}
+
+	return base64.StdEncoding.DecodeString(header)
+}
+
+// writeMetadata передает метаданные в заголовке ответа
+func writeMetadata(w http.ResponseWriter, metadata []byte) {
+	if len(metadata) > 0 {
+		w.Header().Set(metadataHeader, base64.StdEncoding.EncodeToString(metadata))
+	}
+}
+
+// dataParam идентификатор данных из пути запроса, false - ответ уже отправлен
+func (m *KeeperHandler) dataParam(w http.ResponseWriter, r *http.Request) (string, bool) {
+	dataId, err := pathParam(r, "id")
+	if err != nil {
+		m.errorRespond(w, http.StatusBadRequest, fmt.Errorf("bad data identifier: %s", err))
+		return ``, false
+	}
+	return dataId, true
+}
+
+func (m *KeeperHandler) addNewData(w http.ResponseWriter, r *http.Request) {
+
+	//Разобрали запрос, новый идентификатор должен быть допустимым путем
+	dataId, ok := m.dataParam(w, r)
+	if !ok {
+		return
+	}
+	if err := models.ValidatePath(dataId); err != nil {
+		m.errorRespond(w, http.StatusBadRequest, fmt.Errorf("bad data identifier: %s", err))
+		return
+	}
+	data, ok := m.readBody(w, r)
+	if !ok {
+		return
+	}
+
+	metadata, err := readMetadata(r)
+	if err != nil {
+		m.errorRespond(w, http.StatusBadRequest, fmt.Errorf("cannot read metadata: %s", err))
+		return
+	}
+
+	//Проверяем доступ к данным пользователя или коллекции организации
+	vault, ok := m.authorize(w, r, writeAccess)
+	if !ok {
+		return
+	}
+
+	//Проверяем квоту
+	if !m.checkQuota(w, r, vault, 1, int64(len(data)+len(metadata))) {
+		return
+	}
+
+	//Добавляем данные в базу
+	err = m.data.AddData(r.Context(), vault, dataId, data, metadata)
+	if errors.Is(err, storage.ErrAlreadyExist) {
+		//If-None-Match: * - клиент явно просил создать только отсутствующие данные
+		code := http.StatusConflict
+		if r.Header.Get("If-None-Match") != `` {
+			code = http.StatusPreconditionFailed
+		}
+		m.errorRespond(w, code, fmt.Errorf("cannot add data: %s", err))
+		return
+	}
+	if err != nil {
+		m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot decode data: %s", err))
+		return
+	}
+
+	w.Header().Set("ETag", etag(1))
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// addDataBatch добавляет пакет новых данных. Данные сохраняются по отдельности: отказ в сохранении одних данных
+// не отменяет остальные, результат по каждым данным возвращается с тем же кодом, что и у одиночного запроса.
+func (m *KeeperHandler) addDataBatch(w http.ResponseWriter, r *http.Request) {
+
+	//Разобрали запрос
+	body, ok := m.readBody(w, r)
+	if !ok {
+		return
+	}
+	var batch []models.NewData
+	if err := json.Unmarshal(body, &batch); err != nil {
+		m.errorRespond(w, http.StatusBadRequest, fmt.Errorf("cannot decode data batch: %s", err))
+		return
+	}
+	if len(batch) > maxBatchSize {
+		m.errorRespond(w, http.StatusBadRequest, fmt.Errorf("data batch of %d exceeds limit %d", len(batch), maxBatchSize))
+		return
+	}
+
+	//Проверяем доступ к данным пользователя или коллекции организации
+	vault, ok := m.authorize(w, r, writeAccess)
+	if !ok {
+		return
+	}
+
+	//Занятое место считаем один раз и увеличиваем по мере сохранения
+	var usage models.Usage
+	if m.limits.MaxEntries > 0 || m.limits.MaxBytes > 0 {
+		var err error
+		if usage, err = m.usage.GetUsage(r.Context(), vault); err != nil {
+			m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot get user usage: %s", err))
+			return
+		}
+	}
+
+	results := make([]models.AddResult, 0, len(batch))
+	for _, item := range batch {
+		result := models.AddResult{Identifier: item.Identifier, Status: http.StatusAccepted, Revision: 1}
+		size := int64(len(item.Data) + len(item.Metadata))
+
+		var err error
+		if err = models.ValidatePath(item.Identifier); err != nil {
+			result.Status = http.StatusBadRequest
+		} else if err = m.quotaError(usage, 1, size); err != nil {
+			result.Status = http.StatusInsufficientStorage
+		} else if err = m.data.AddData(r.Context(), vault, item.Identifier, item.Data, item.Metadata); errors.Is(err, storage.ErrAlreadyExist) {
+			result.Status = http.StatusConflict
+		} else if err != nil {
+			result.Status = http.StatusInternalServerError
+			logger.Error("cannot add data %s: %s", item.Identifier, err)
+		} else {
+			usage.Entries++
+			usage.Bytes += size
+		}
+
+		if err != nil {
+			result.Revision = 0
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(results); err != nil {
+		logger.Error("cannot encode data batch results: %s", err)
+	}
+}
+
+func (m *KeeperHandler) updateData(w http.ResponseWriter, r *http.Request) {
+
+	//Разобрали запрос
+	dataId, ok := m.dataParam(w, r)
+	if !ok {
+		return
+	}
+	data, ok := m.readBody(w, r)
+	if !ok {
+		return
+	}
+
+	//Без заголовка метаданных остаются прежними
+	metadata, err := readMetadata(r)
+	if err != nil {
+		m.errorRespond(w, http.StatusBadRequest, fmt.Errorf("cannot read metadata: %s", err))
+		return
+	}
+
+	//Проверяем доступ к данным пользователя или коллекции организации
+	vault, ok := m.authorize(w, r, writeAccess)
+	if !ok {
+		return
+	}
+
+	//Проверяем условия запроса и квоту
+	expected, ok := m.checkPreconditions(w, r, vault, dataId)
+	if !ok || !m.checkQuota(w, r, vault, 0, int64(len(data)+len(metadata))) {
+		return
+	}
+
+	//Сохраняем новую ревизию
+	revision, err := m.data.UpdateData(r.Context(), vault, dataId, data, metadata, expected)
+	if errors.Is(err, storage.ErrRevisionMismatch) {
+		m.errorRespond(w, http.StatusPreconditionFailed, fmt.Errorf("cannot update data: %s", err))
+		return
+	}
+	if errors.Is(err, storage.ErrNotFound) {
+		m.errorRespond(w, m.notFoundCode(r), fmt.Errorf("cannot update data: %s", err))
+		return
+	}
+	if err != nil {
+		m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot update data: %s", err))
+		return
+	}
+
+	w.Header().Set("ETag", etag(revision))
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (m *KeeperHandler) updateMetadata(w http.ResponseWriter, r *http.Request) {
+
+	//Разобрали запрос, тело - зашифрованные метаданные
+	dataId, ok := m.dataParam(w, r)
+	if !ok {
+		return
+	}
+	metadata, ok := m.readBody(w, r)
+	if !ok {
+		return
+	}
+
+	//Проверяем доступ к данным пользователя или коллекции организации
+	vault, ok := m.authorize(w, r, writeAccess)
+	if !ok {
+		return
+	}
+
+	//Проверяем условия запроса и квоту
+	expected, ok := m.checkPreconditions(w, r, vault, dataId)
+	if !ok || !m.checkQuota(w, r, vault, 0, int64(len(metadata))) {
+		return
+	}
+
+	//Сохраняем новую ревизию с прежними данными
+	revision, err := m.data.UpdateMetadata(r.Context(), vault, dataId, metadata, expected)
+	if errors.Is(err, storage.ErrRevisionMismatch) {
+		m.errorRespond(w, http.StatusPreconditionFailed, fmt.Errorf("cannot update metadata: %s", err))
+		return
+	}
+	if errors.Is(err, storage.ErrNotFound) {
+		m.errorRespond(w, m.notFoundCode(r), fmt.Errorf("cannot update metadata: %s", err))
+		return
+	}
+	if err != nil {
+		m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot update metadata: %s", err))
+		return
+	}
+
+	w.Header().Set("ETag", etag(revision))
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (m *KeeperHandler) listData(w http.ResponseWriter, r *http.Request) {
+
+	//Проверяем доступ к данным пользователя или коллекции организации
+	vault, ok := m.authorize(w, r, readAccess)
+	if !ok {
+		return
+	}
+
+	//Разбираем параметры страницы: ?sort=updated&order=desc&limit=20&offset=40&folder=prod/db
+	opts, err := parseListOptions(r)
+	if err != nil {
+		m.errorRespond(w, http.StatusBadRequest, fmt.Errorf("bad list parameters: %s", err))
+		return
+	}
+
+	items, total, err := m.data.ListData(r.Context(), vault, opts)
+	if err != nil {
+		m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot list user data: %s", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(models.DataList{Items: items, Total: total}); err != nil {
+		logger.Error("cannot encode user data list: %s", err)
+	}
+}
+
+func parseListOptions(r *http.Request) (storage.ListOptions, error) {
+	query := r.URL.Query()
+	opts := storage.ListOptions{
+		Sort:  storage.SortByIdentifier,
+		Limit: defaultListLimit,
+	}
+
+	switch sort := query.Get("sort"); sort {
+	case ``:
+	case storage.SortByIdentifier, storage.SortByCreated, storage.SortByUpdated, storage.SortBySize:
+		opts.Sort = sort
+	default:
+		return opts, fmt.Errorf("unknown sort field %s", sort)
+	}
+
+	switch order := query.Get("order"); order {
+	case ``, "asc":
+	case "desc":
+		opts.Desc = true
+	default:
+		return opts, fmt.Errorf("unknown sort order %s", order)
+	}
+
+	if limit := query.Get("limit"); limit != `` {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 || n > maxListLimit {
+			return opts, fmt.Errorf("limit must be in range 1..%d", maxListLimit)
+		}
+		opts.Limit = n
+	}
+
+	if offset := query.Get("offset"); offset != `` {
+		n, err := strconv.Atoi(offset)
+		if err != nil || n < 0 {
+			return opts, fmt.Errorf("offset must be non-negative number")
+		}
+		opts.Offset = n
+	}
+
+	if folder := query.Get("folder"); folder != `` {
+		if err := models.ValidatePath(folder); err != nil {
+			return opts, fmt.Errorf("bad folder: %s", err)
+		}
+		opts.Folder = folder
+	}
+
+	return opts, nil
+}
+
+func (m *KeeperHandler) getDataRevisions(w http.ResponseWriter, r *http.Request) {
+
+	//Проверяем доступ к данным пользователя или коллекции организации
+	vault, ok := m.authorize(w, r, readAccess)
+	if !ok {
+		return
+	}
+
+	//Забираем идентификатор данных
+	dataId, ok := m.dataParam(w, r)
+	if !ok {
+		return
+	}
+
+	revisions, err := m.data.GetDataRevisions(r.Context(), vault, dataId)
+	if errors.Is(err, storage.ErrNotFound) {
+		m.errorRespond(w, http.StatusNotFound, fmt.Errorf("cannot get data revisions: %s", err))
+		return
+	}
+	if err != nil {
+		m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot get data revisions: %s", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(revisions); err != nil {
+		logger.Error("cannot encode data revisions: %s", err)
+	}
+}
+
+func (m *KeeperHandler) getDataRevision(w http.ResponseWriter, r *http.Request) {
+
+	//Проверяем доступ к данным пользователя или коллекции организации
+	vault, ok := m.authorize(w, r, readAccess)
+	if !ok {
+		return
+	}
+
+	//Забираем идентификатор данных и номер ревизии
+	dataId, ok := m.dataParam(w, r)
+	if !ok {
+		return
+	}
+	revision, err := strconv.ParseInt(chi.URLParam(r, "revision"), 10, 64)
+	if err != nil {
+		m.errorRespond(w, http.StatusBadRequest, fmt.Errorf("bad revision number: %s", err))
+		return
+	}
+
+	entry, err := m.data.GetDataRevision(r.Context(), vault, dataId, revision)
+	if errors.Is(err, storage.ErrNotFound) {
+		m.errorRespond(w, http.StatusNotFound, fmt.Errorf("cannot get data revision: %s", err))
+		return
+	}
+	if err != nil {
+		m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot get data revision: %s", err))
+		return
+	}
+
+	m.writeContent(w, r, entry)
+}
+
+func (m *KeeperHandler) getData(w http.ResponseWriter, r *http.Request) {
+
+	//Проверяем доступ к данным пользователя или коллекции организации
+	vault, ok := m.authorize(w, r, readAccess)
+	if !ok {
+		return
+	}
+
+	//Забираем идентификатор данных
+	dataId, ok := m.dataParam(w, r)
+	if !ok {
+		return
+	}
+
+	//Получаем данные из базы
+	entry, err := m.data.GetData(r.Context(), vault, dataId)
+	if errors.Is(err, storage.ErrNotFound) {
+		m.errorRespond(w, http.StatusNotFound, fmt.Errorf("cannot get user data: %s", err))
+		return
+	}
+	if err != nil {
+		m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot get user data: %s", err))
+		return
+	}
+
+	w.Header().Set("ETag", etag(entry.Revision))
+
+	//У клиента уже актуальная ревизия
+	if inm := r.Header.Get("If-None-Match"); inm != `` && matchETag(inm, entry.Revision) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	m.writeContent(w, r, entry)
+}
+
+// writeContent отправляет метаданные и содержимое ревизии. Содержимое загрузок передается частями
+// по мере чтения из хранилища, поэтому на время передачи снимается общее ограничение времени запроса.
+func (m *KeeperHandler) writeContent(w http.ResponseWriter, r *http.Request, entry storage.Entry) {
+	writeMetadata(w, entry.Metadata)
+	if entry.Origin != `` {
+		w.Header().Set(originHeader, url.PathEscape(entry.Origin))
+	}
+	w.Header().Set("Content-Type", "multipart/form-data")
+	w.Header().Set("Content-Length", strconv.FormatInt(entry.Size, 10))
+
+	//Заголовки уже отправлены, об ошибке остается только записать в лог
+	if err := m.data.WriteContent(deadline.Unbounded(r.Context()), entry, w); err != nil {
+		logger.Error("cannot write user data: %s", err)
+	}
+}
+
+func (m *KeeperHandler) deleteData(w http.ResponseWriter, r *http.Request) {
+
+	//Проверяем доступ к данным пользователя или коллекции организации
+	vault, ok := m.authorize(w, r, writeAccess)
+	if !ok {
+		return
+	}
+
+	//Забираем идентификатор данных
+	dataId, ok := m.dataParam(w, r)
+	if !ok {
+		return
+	}
+
+	//Проверяем условия запроса
+	expected, ok := m.checkPreconditions(w, r, vault, dataId)
+	if !ok {
+		return
+	}
+
+	//Удаляем данные из базы
+	err := m.data.DeleteData(r.Context(), vault, dataId, expected)
+	if errors.Is(err, storage.ErrRevisionMismatch) {
+		m.errorRespond(w, http.StatusPreconditionFailed, fmt.Errorf("cannot delete user data: %s", err))
+		return
+	}
+	if errors.Is(err, storage.ErrNotFound) {
+		m.errorRespond(w, m.notFoundCode(r), fmt.Errorf("cannot delete user data: %s", err))
+		return
+	}
+	if err != nil {
+		m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot delete user data: %s", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// checkPreconditions разбирает If-Match и проверяет If-None-Match для изменения существующих данных.
+// Возвращает ожидаемую ревизию для атомарной проверки в хранилище; false - ответ уже отправлен.
+func (m *KeeperHandler) checkPreconditions(w http.ResponseWriter, r *http.Request, userId, dataId string) (int64, bool) {
+
+	expected, err := ifMatchRevision(r.Header.Get("If-Match"))
+	if err != nil {
+		m.errorRespond(w, http.StatusBadRequest, fmt.Errorf("bad If-Match header: %s", err))
+		return 0, false
+	}
+
+	if inm := r.Header.Get("If-None-Match"); inm != `` {
+		entry, err := m.data.GetData(r.Context(), userId, dataId)
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot get user data: %s", err))
+			return 0, false
+		}
+		if err == nil && matchETag(inm, entry.Revision) {
+			m.errorRespond(w, http.StatusPreconditionFailed, fmt.Errorf("data %s revision %d matches If-None-Match", dataId, entry.Revision))
+			return 0, false
+		}
+	}
+
+	return expected, true
+}
+
+// notFoundCode код ответа на отсутствующие данные: при заданном If-Match условие не выполнено
+func (m *KeeperHandler) notFoundCode(r *http.Request) int {
+	if r.Header.Get("If-Match") != `` {
+		return http.StatusPreconditionFailed
+	}
+	return http.StatusNotFound
+}
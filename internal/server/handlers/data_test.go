@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/lionslon/go-keepass/internal/models"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// listData запрашивает страницу списка данных
+func listData(t *testing.T, s *testServer, token, query string) models.DataList {
+	t.Helper()
+
+	var list models.DataList
+	body := expect(t, s.do(t, token, http.MethodGet, "/api/data/?"+query, nil), http.StatusOK)
+	if err := json.Unmarshal([]byte(body), &list); err != nil {
+		t.Fatalf("cannot decode list %q: %v", body, err)
+	}
+	if list.Items == nil {
+		t.Errorf("list %s items = null, want array", query)
+	}
+	return list
+}
+
+func TestListData(t *testing.T) {
+	s := newTestServer(t, Limits{})
+	_, token := s.user(t, "alice")
+
+	if list := listData(t, s, token, ``); len(list.Items) != 0 || list.Total != 0 {
+		t.Errorf("list empty = %+v, want no items", list)
+	}
+
+	for _, dataId := range []string{"c", "a", "prod%2Fdb", "b"} {
+		expect(t, s.do(t, token, http.MethodPost, "/api/data/"+dataId, strings.NewReader(dataId)), http.StatusAccepted)
+	}
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{``, "a,b,c,prod/db"},
+		{`limit=2`, "a,b"},
+		{`limit=2&offset=2`, "c,prod/db"},
+		{`limit=3&offset=3`, "prod/db"},
+		{`limit=2&offset=4`, ""},
+		{`sort=identifier&order=desc&limit=1`, "prod/db"},
+		{`sort=size&order=asc`, "a,b,c,prod/db"},
+		{`folder=prod`, "prod/db"},
+		{`limit=1000`, "a,b,c,prod/db"},
+	}
+	for _, tt := range tests {
+		list := listData(t, s, token, tt.query)
+		ids := make([]string, 0, len(list.Items))
+		for _, item := range list.Items {
+			ids = append(ids, item.Identifier)
+		}
+		if got := strings.Join(ids, ","); got != tt.want {
+			t.Errorf("list %s = %q, want %q", tt.query, got, tt.want)
+		}
+		wantTotal := int64(4)
+		if strings.HasPrefix(tt.query, "folder=") {
+			wantTotal = 1
+		}
+		if list.Total != wantTotal {
+			t.Errorf("list %s total = %d, want %d", tt.query, list.Total, wantTotal)
+		}
+	}
+
+	for _, query := range []string{
+		`sort=color`, `order=up`, `limit=0`, `limit=1001`, `limit=x`, `offset=-1`, `offset=x`, `folder=..%2Fetc`,
+	} {
+		expect(t, s.do(t, token, http.MethodGet, "/api/data/?"+query, nil), http.StatusBadRequest)
+	}
+}
+
+func TestAddDataBatch(t *testing.T) {
+	s := newTestServer(t, Limits{MaxEntries: 3})
+	_, token := s.user(t, "alice")
+
+	expect(t, s.do(t, token, http.MethodPost, "/api/data/existing", strings.NewReader("old")), http.StatusAccepted)
+
+	batch, err := json.Marshal([]models.NewData{
+		{Identifier: "mail", Data: []byte("mail data"), Metadata: []byte("mail metadata")},
+		{Identifier: "existing", Data: []byte("new")},
+		{Identifier: "../bad", Data: []byte("bad")},
+		{Identifier: "work/vpn", Data: []byte("vpn")},
+		{Identifier: "over", Data: []byte("over quota")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var results []models.AddResult
+	body := expect(t, s.do(t, token, http.MethodPost, "/api/data/", bytes.NewReader(batch)), http.StatusOK)
+	if err := json.Unmarshal([]byte(body), &results); err != nil {
+		t.Fatalf("cannot decode results: %v", err)
+	}
+
+	//Отказ по одним данным не мешает сохранению остальных
+	want := []struct {
+		identifier string
+		status     int
+	}{
+		{"mail", http.StatusAccepted},
+		{"existing", http.StatusConflict},
+		{"../bad", http.StatusBadRequest},
+		{"work/vpn", http.StatusAccepted},
+		{"over", http.StatusInsufficientStorage},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("results = %d, want %d", len(results), len(want))
+	}
+	for i, w := range want {
+		got := results[i]
+		if got.Identifier != w.identifier || got.Status != w.status {
+			t.Errorf("result %d = %s %d, want %s %d", i, got.Identifier, got.Status, w.identifier, w.status)
+		}
+		if (got.Status == http.StatusAccepted) != (got.Error == ``) || (got.Status == http.StatusAccepted) != (got.Revision == 1) {
+			t.Errorf("result %d = %+v, want revision without error only on success", i, got)
+		}
+	}
+
+	resp := s.do(t, token, http.MethodGet, "/api/data/mail", nil)
+	if body := expect(t, resp, http.StatusOK); body != "mail data" {
+		t.Errorf("GET mail = %q, want mail data", body)
+	}
+	if metadata := resp.Header.Get(metadataHeader); metadata != base64.StdEncoding.EncodeToString([]byte("mail metadata")) {
+		t.Errorf("GET mail metadata = %q", metadata)
+	}
+	if body := expect(t, s.do(t, token, http.MethodGet, "/api/data/existing", nil), http.StatusOK); body != "old" {
+		t.Errorf("GET existing = %q, want unchanged", body)
+	}
+	expect(t, s.do(t, token, http.MethodGet, "/api/data/over", nil), http.StatusNotFound)
+
+	expect(t, s.do(t, token, http.MethodPost, "/api/data/", strings.NewReader("not json")), http.StatusBadRequest)
+	expect(t, s.do(t, ``, http.MethodPost, "/api/data/", bytes.NewReader(batch)), http.StatusUnauthorized)
+}
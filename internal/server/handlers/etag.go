@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// etag формирует ETag данных по номеру ревизии
+func etag(revision int64) string {
+	return strconv.Quote(strconv.FormatInt(revision, 10))
+}
+
+// matchETag проверяет, входит ли ревизия в список ETag из If-Match / If-None-Match.
+// Слабые ETag сравниваются как сильные: ревизия однозначно определяет содержимое.
+func matchETag(header string, revision int64) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag(revision) {
+			return true
+		}
+	}
+	return false
+}
+
+// ifMatchRevision возвращает ревизию из заголовка If-Match.
+// 0 - заголовок пуст или равен *, то есть подходит любая существующая ревизия.
+func ifMatchRevision(header string) (int64, error) {
+	header = strings.TrimSpace(header)
+	if header == `` || header == "*" {
+		return 0, nil
+	}
+
+	tag, err := strconv.Unquote(header)
+	if err != nil {
+		return 0, fmt.Errorf("bad etag %s: only single strong etag supported", header)
+	}
+
+	revision, err := strconv.ParseInt(tag, 10, 64)
+	if err != nil || revision <= 0 {
+		return 0, fmt.Errorf("bad etag %s: not a revision", header)
+	}
+
+	return revision, nil
+}
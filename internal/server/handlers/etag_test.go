@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMatchETag(t *testing.T) {
+	tests := []struct {
+		header   string
+		revision int64
+		want     bool
+	}{
+		{`"3"`, 3, true},
+		{`"3"`, 4, false},
+		{`*`, 7, true},
+		{`W/"3"`, 3, true},
+		{`"1", "2" ,"3"`, 3, true},
+		{`"1", "2"`, 3, false},
+		{`3`, 3, false},
+	}
+	for _, tt := range tests {
+		if got := matchETag(tt.header, tt.revision); got != tt.want {
+			t.Errorf("matchETag(%q, %d) = %v, want %v", tt.header, tt.revision, got, tt.want)
+		}
+	}
+}
+
+func TestIfMatchRevision(t *testing.T) {
+	tests := []struct {
+		header  string
+		want    int64
+		wantErr bool
+	}{
+		{``, 0, false},
+		{`*`, 0, false},
+		{` "5" `, 5, false},
+		{`5`, 0, true},
+		{`"x"`, 0, true},
+		{`"0"`, 0, true},
+		{`"-1"`, 0, true},
+		{`"1", "2"`, 0, true},
+		{`W/"5"`, 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ifMatchRevision(tt.header)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ifMatchRevision(%q) = %d, %v, want %d, error %v", tt.header, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestDataPreconditions(t *testing.T) {
+	s := newTestServer(t, Limits{})
+	_, token := s.user(t, "alice")
+
+	//Создание возвращает ETag первой ревизии, повторное - конфликт или невыполненное условие
+	resp := s.do(t, token, http.MethodPost, "/api/data/mail", strings.NewReader("v1"))
+	expect(t, resp, http.StatusAccepted)
+	if got := resp.Header.Get("ETag"); got != `"1"` {
+		t.Errorf("POST ETag = %s, want \"1\"", got)
+	}
+	expect(t, s.do(t, token, http.MethodPost, "/api/data/mail", strings.NewReader("v1")), http.StatusConflict)
+	expect(t, s.do(t, token, http.MethodPost, "/api/data/mail", strings.NewReader("v1"), "If-None-Match", "*"),
+		http.StatusPreconditionFailed)
+
+	//ETag при чтении равен ревизии, совпадающий If-None-Match - 304
+	resp = s.do(t, token, http.MethodGet, "/api/data/mail", nil)
+	if body := expect(t, resp, http.StatusOK); body != "v1" {
+		t.Errorf("GET = %q, want v1", body)
+	}
+	if got := resp.Header.Get("ETag"); got != `"1"` {
+		t.Errorf("GET ETag = %s, want \"1\"", got)
+	}
+	expect(t, s.do(t, token, http.MethodGet, "/api/data/mail", nil, "If-None-Match", `"1"`), http.StatusNotModified)
+	expect(t, s.do(t, token, http.MethodGet, "/api/data/mail", nil, "If-None-Match", `W/"1"`), http.StatusNotModified)
+	expect(t, s.do(t, token, http.MethodGet, "/api/data/mail", nil, "If-None-Match", `"2"`), http.StatusOK)
+
+	//Без условий обновление безусловное
+	resp = s.do(t, token, http.MethodPut, "/api/data/mail", strings.NewReader("v2"))
+	expect(t, resp, http.StatusAccepted)
+	if got := resp.Header.Get("ETag"); got != `"2"` {
+		t.Errorf("PUT without If-Match ETag = %s, want \"2\"", got)
+	}
+
+	//Устаревшая ревизия отклоняется и данные не меняются
+	expect(t, s.do(t, token, http.MethodPut, "/api/data/mail", strings.NewReader("lost"), "If-Match", `"1"`),
+		http.StatusPreconditionFailed)
+	expect(t, s.do(t, token, http.MethodPut, "/api/data/mail", strings.NewReader("lost"), "If-None-Match", `"2"`),
+		http.StatusPreconditionFailed)
+	expect(t, s.do(t, token, http.MethodPut, "/api/data/mail", strings.NewReader("lost"), "If-None-Match", "*"),
+		http.StatusPreconditionFailed)
+	expect(t, s.do(t, token, http.MethodPut, "/api/data/mail", strings.NewReader("lost"), "If-Match", "2"),
+		http.StatusBadRequest)
+
+	resp = s.do(t, token, http.MethodPut, "/api/data/mail", strings.NewReader("v3"), "If-Match", `"2"`)
+	expect(t, resp, http.StatusAccepted)
+	if got := resp.Header.Get("ETag"); got != `"3"` {
+		t.Errorf("PUT ETag = %s, want \"3\"", got)
+	}
+	resp = s.do(t, token, http.MethodGet, "/api/data/mail", nil)
+	if body := expect(t, resp, http.StatusOK); body != "v3" || resp.Header.Get("ETag") != `"3"` {
+		t.Errorf("GET = %q with ETag %s, want v3 with \"3\"", body, resp.Header.Get("ETag"))
+	}
+
+	//Метаданные тоже меняют ревизию
+	resp = s.do(t, token, http.MethodPut, "/api/data/mail/metadata", strings.NewReader("meta"), "If-Match", `"3"`)
+	expect(t, resp, http.StatusAccepted)
+	if got := resp.Header.Get("ETag"); got != `"4"` {
+		t.Errorf("PUT metadata ETag = %s, want \"4\"", got)
+	}
+
+	//Отсутствующие данные: с If-Match условие не выполнено, без него - 404
+	expect(t, s.do(t, token, http.MethodPut, "/api/data/none", strings.NewReader("x"), "If-Match", `"1"`),
+		http.StatusPreconditionFailed)
+	expect(t, s.do(t, token, http.MethodPut, "/api/data/none", strings.NewReader("x")), http.StatusNotFound)
+	expect(t, s.do(t, token, http.MethodDelete, "/api/data/none", nil), http.StatusNotFound)
+
+	expect(t, s.do(t, token, http.MethodDelete, "/api/data/mail", nil, "If-Match", `"3"`), http.StatusPreconditionFailed)
+	expect(t, s.do(t, token, http.MethodDelete, "/api/data/mail", nil, "If-Match", `"4"`), http.StatusAccepted)
+	expect(t, s.do(t, token, http.MethodGet, "/api/data/mail", nil), http.StatusNotFound)
+}
+
+func TestDataIsolatedBetweenUsers(t *testing.T) {
+	s := newTestServer(t, Limits{})
+	_, alice := s.user(t, "alice")
+	_, bob := s.user(t, "bob")
+
+	expect(t, s.do(t, alice, http.MethodPost, "/api/data/mail", strings.NewReader("secret")), http.StatusAccepted)
+	expect(t, s.do(t, bob, http.MethodGet, "/api/data/mail", nil), http.StatusNotFound)
+	expect(t, s.do(t, bob, http.MethodPut, "/api/data/mail", strings.NewReader("x"), "If-Match", `"1"`),
+		http.StatusPreconditionFailed)
+}
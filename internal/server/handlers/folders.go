@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/lionslon/go-keepass/internal/logger"
+	"github.com/lionslon/go-keepass/internal/models"
+	"github.com/lionslon/go-keepass/internal/storage"
+	"net/http"
+	"net/url"
+)
+
+// Папки: идентификатор данных - путь вида prod/db/password, папка prod/db следует из него сама,
+// пустую папку можно создать явно. Клиент экранирует разделитель папок в пути запроса (%2F),
+// поэтому идентификатор остается одним сегментом пути. Перемещение меняет идентификатор, но не ключ
+// данных: клиент получает ключ из исходного идентификатора (origin).
+const (
+	foldersPath = "/api/folders"
+)
+
+// pathParam параметр пути запроса с идентификатором данных или путем папки. Если в пути есть
+// экранированные символы, chi разбирает путь в исходном виде (URL.RawPath) и параметр нужно раскодировать.
+func pathParam(r *http.Request, key string) (string, error) {
+	param := chi.URLParam(r, key)
+	if r.URL.RawPath == `` {
+		return param, nil
+	}
+	return url.PathUnescape(param)
+}
+
+// folderParam путь папки из пути запроса, false - ответ уже отправлен
+func (m *KeeperHandler) folderParam(w http.ResponseWriter, r *http.Request) (string, bool) {
+	path, err := pathParam(r, "folder")
+	if err == nil {
+		err = models.ValidatePath(path)
+	}
+	if err != nil {
+		m.errorRespond(w, http.StatusBadRequest, fmt.Errorf("bad folder path: %s", err))
+		return ``, false
+	}
+	return path, true
+}
+
+// folderRoutes пути папок пользователя или коллекции
+func (m *KeeperHandler) folderRoutes(r chi.Router) {
+	//Папки с количеством данных в них
+	r.Get("/", m.listFolders)
+
+	r.Route("/{folder}", func(r chi.Router) {
+		//Создание пустой папки
+		r.Post("/", m.createFolder)
+		//Переименование или перемещение папки вместе с содержимым
+		r.Put("/", m.moveFolder)
+		//Удаление папки, ее данные попадают в корзину
+		r.Delete("/", m.deleteFolder)
+	})
+}
+
+func (m *KeeperHandler) listFolders(w http.ResponseWriter, r *http.Request) {
+
+	//Проверяем доступ к данным пользователя или коллекции организации
+	vault, ok := m.authorize(w, r, readAccess)
+	if !ok {
+		return
+	}
+
+	folders, err := m.folders.ListFolders(r.Context(), vault)
+	if err != nil {
+		m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot list folders: %s", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(folders); err != nil {
+		logger.Error("cannot encode folders: %s", err)
+	}
+}
+
+func (m *KeeperHandler) createFolder(w http.ResponseWriter, r *http.Request) {
+
+	//Проверяем доступ к данным пользователя или коллекции организации
+	vault, ok := m.authorize(w, r, writeAccess)
+	if !ok {
+		return
+	}
+
+	path, ok := m.folderParam(w, r)
+	if !ok {
+		return
+	}
+
+	err := m.folders.CreateFolder(r.Context(), vault, path)
+	if errors.Is(err, storage.ErrAlreadyExist) {
+		m.errorRespond(w, http.StatusConflict, fmt.Errorf("cannot create folder: %s", err))
+		return
+	}
+	if err != nil {
+		m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot create folder: %s", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (m *KeeperHandler) moveFolder(w http.ResponseWriter, r *http.Request) {
+
+	//Проверяем доступ к данным пользователя или коллекции организации
+	vault, ok := m.authorize(w, r, writeAccess)
+	if !ok {
+		return
+	}
+
+	//Разобрали запрос
+	from, ok := m.folderParam(w, r)
+	if !ok {
+		return
+	}
+	request, ok := m.readMoveRequest(w, r)
+	if !ok {
+		return
+	}
+
+	//Папку нельзя перенести в нее саму или в ее вложенную папку
+	if request.Path == from || models.InFolder(request.Path, from) {
+		m.errorRespond(w, http.StatusBadRequest, fmt.Errorf("cannot move folder %s into itself", from))
+		return
+	}
+
+	moved, err := m.folders.MoveFolder(r.Context(), vault, from, request.Path)
+	if errors.Is(err, storage.ErrNotFound) {
+		m.errorRespond(w, http.StatusNotFound, fmt.Errorf("cannot move folder: %s", err))
+		return
+	}
+	if errors.Is(err, storage.ErrAlreadyExist) {
+		m.errorRespond(w, http.StatusConflict, fmt.Errorf("cannot move folder: %s", err))
+		return
+	}
+	if err != nil {
+		m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot move folder: %s", err))
+		return
+	}
+
+	m.writeFolder(w, models.Folder{Path: request.Path, Entries: moved})
+}
+
+func (m *KeeperHandler) deleteFolder(w http.ResponseWriter, r *http.Request) {
+
+	//Проверяем доступ к данным пользователя или коллекции организации
+	vault, ok := m.authorize(w, r, writeAccess)
+	if !ok {
+		return
+	}
+
+	path, ok := m.folderParam(w, r)
+	if !ok {
+		return
+	}
+
+	deleted, err := m.folders.DeleteFolder(r.Context(), vault, path)
+	if errors.Is(err, storage.ErrNotFound) {
+		m.errorRespond(w, http.StatusNotFound, fmt.Errorf("cannot delete folder: %s", err))
+		return
+	}
+	if err != nil {
+		m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot delete folder: %s", err))
+		return
+	}
+
+	m.writeFolder(w, models.Folder{Path: path, Entries: deleted})
+}
+
+// writeFolder отправляет папку с количеством перенесенных или удаленных данных
+func (m *KeeperHandler) writeFolder(w http.ResponseWriter, folder models.Folder) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(folder); err != nil {
+		logger.Error("cannot encode folder: %s", err)
+	}
+}
+
+func (m *KeeperHandler) moveData(w http.ResponseWriter, r *http.Request) {
+
+	//Проверяем доступ к данным пользователя или коллекции организации
+	vault, ok := m.authorize(w, r, writeAccess)
+	if !ok {
+		return
+	}
+
+	//Разобрали запрос
+	dataId, ok := m.dataParam(w, r)
+	if !ok {
+		return
+	}
+	request, ok := m.readMoveRequest(w, r)
+	if !ok {
+		return
+	}
+
+	//Проверяем условия запроса
+	expected, ok := m.checkPreconditions(w, r, vault, dataId)
+	if !ok {
+		return
+	}
+
+	err := m.data.MoveData(r.Context(), vault, dataId, request.Path, expected)
+	if errors.Is(err, storage.ErrRevisionMismatch) {
+		m.errorRespond(w, http.StatusPreconditionFailed, fmt.Errorf("cannot move data: %s", err))
+		return
+	}
+	if errors.Is(err, storage.ErrNotFound) {
+		m.errorRespond(w, m.notFoundCode(r), fmt.Errorf("cannot move data: %s", err))
+		return
+	}
+	if errors.Is(err, storage.ErrAlreadyExist) {
+		m.errorRespond(w, http.StatusConflict, fmt.Errorf("cannot move data: %s", err))
+		return
+	}
+	if err != nil {
+		m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot move data: %s", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// readMoveRequest разбирает и проверяет запрос на перемещение, false - ответ уже отправлен
+func (m *KeeperHandler) readMoveRequest(w http.ResponseWriter, r *http.Request) (models.MoveRequest, bool) {
+	request, err := models.NewDTO[models.MoveRequest](r.Body)
+	if err != nil {
+		m.errorRespond(w, bodyErrorCode(err), fmt.Errorf("cannot decode move request: %s", err))
+		return request, false
+	}
+	if err := request.Validate(); err != nil {
+		m.errorRespond(w, http.StatusBadRequest, fmt.Errorf("cannot validate move request: %s", err))
+		return request, false
+	}
+	return request, true
+}
@@ -7,24 +7,47 @@ import (
 	"github.com/lionslon/go-keepass/internal/logger"
 	"github.com/lionslon/go-keepass/internal/models"
 	"github.com/lionslon/go-keepass/internal/storage"
-	"io"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
 )
 
+// KeeperHandler обработчики API. Каждая группа обработчиков пользуется только своей частью хранилища.
 type KeeperHandler struct {
-	storage *storage.KeeperStorage
+	users       storage.UserStorage
+	data        storage.DataStorage
+	folders     storage.FolderStorage
+	trash       storage.TrashStorage
+	uploads     storage.UploadStorage
+	attachments storage.AttachmentStorage
+	sync        storage.SyncStorage
+	usage       storage.UsageStorage
+	shares      storage.ShareStorage
+	orgs        storage.OrgStorage
+	limits      Limits
 }
 
-func NewKeeperHandler(storage *storage.KeeperStorage) KeeperHandler {
+func NewKeeperHandler(storage storage.Storage, limits Limits) KeeperHandler {
 	return KeeperHandler{
-		storage: storage,
+		users:       storage,
+		data:        storage,
+		folders:     storage,
+		trash:       storage,
+		uploads:     storage,
+		attachments: storage,
+		sync:        storage,
+		usage:       storage,
+		shares:      storage,
+		orgs:        storage,
+		limits:      limits,
 	}
 }
 
 func (m *KeeperHandler) Register(r *chi.Mux) {
 
+	//Ограничение размера тела для всех запросов
+	r.Use(m.limitBody)
+
 	r.Route("/api/user", func(r chi.Router) {
 		r.Use(crypt.Middleware)
 		//Регистрация нового пользователя
@@ -33,17 +56,179 @@ func (m *KeeperHandler) Register(r *chi.Mux) {
 		r.Post("/login", m.login)
 	})
 
-	r.Route("/api/data/{id}", func(r chi.Router) {
+	r.Route("/api/data", func(r chi.Router) {
+		r.Use(auth.Middleware)
+		m.dataRoutes(r)
+	})
+
+	r.Route(uploadsPath+"/{upload}", func(r chi.Router) {
+		r.Use(auth.Middleware)
+		m.uploadRoutes(r)
+	})
+
+	r.Route(syncPath, func(r chi.Router) {
+		r.Use(auth.Middleware)
+		m.syncRoutes(r)
+	})
+
+	r.Route(usagePath, func(r chi.Router) {
+		r.Use(auth.Middleware)
+		m.usageRoutes(r)
+	})
+
+	r.Route(trashPath, func(r chi.Router) {
+		r.Use(auth.Middleware)
+		m.trashRoutes(r)
+	})
+
+	r.Route(foldersPath, func(r chi.Router) {
+		r.Use(auth.Middleware)
+		m.folderRoutes(r)
+	})
+
+	r.Route(keysPath, func(r chi.Router) {
+		r.Use(auth.Middleware)
+		//Пара ключей пользователя
+		r.Get("/", m.getUserKeys)
+		//Сохранение пары ключей, однократное
+		r.Put("/", m.setUserKeys)
+		//Открытый ключ другого пользователя, чтобы передать ему данные
+		r.Get("/{login}", m.getPublicKey)
+	})
+
+	r.Route(sharesPath, func(r chi.Router) {
+		r.Use(auth.Middleware)
+		//Переданные и полученные пользователем данные
+		r.Get("/", m.listShares)
+
+		r.Route("/{share}", func(r chi.Router) {
+			//Передача с ключом данных для получателя
+			r.Get("/", m.getShare)
+			//Отзыв передачи владельцем или отказ получателя
+			r.Delete("/", m.deleteShare)
+			//Получатель принимает данные
+			r.Post("/accept", m.acceptShare)
+			//Получение переданных данных
+			r.Get("/data", m.getSharedData)
+			//Сохранение новой ревизии переданных данных, если есть право записи
+			r.Put("/data", m.updateSharedData)
+		})
+	})
+
+	r.Route(orgsPath, func(r chi.Router) {
+		r.Use(auth.Middleware)
+		//Организации пользователя, включая приглашения
+		r.Get("/", m.listOrganizations)
+		//Создание организации, пользователь становится владельцем
+		r.Post("/", m.createOrganization)
+
+		r.Route("/{org}", func(r chi.Router) {
+			//Принятие приглашения
+			r.Post("/accept", m.acceptInvitation)
+			//Участники организации
+			r.Get("/members", m.listMembers)
+			//Приглашение пользователя с ключами коллекций
+			r.Post("/members", m.inviteMember)
+			//Изменение роли участника
+			r.Put("/members/{login}", m.setMemberRole)
+			//Удаление участника со сменой ключей коллекций или отказ от приглашения
+			r.Delete("/members/{login}", m.removeMember)
+			//Коллекции организации с ключами пользователя
+			r.Get("/collections", m.listCollections)
+			//Создание коллекции с ключом для каждого участника
+			r.Post("/collections", m.createCollection)
+		})
+	})
+
+	//Данные коллекции организации по тем же путям, что и данные пользователя
+	r.Route(collectionsPath+"/{"+collectionParam+"}", func(r chi.Router) {
 		r.Use(auth.Middleware)
+		//Коллекция с ключами пользователя
+		r.Get("/", m.getCollection)
+		r.Route("/data", m.dataRoutes)
+		r.Route("/uploads/{upload}", m.uploadRoutes)
+		r.Route("/sync", m.syncRoutes)
+		r.Route("/usage", m.usageRoutes)
+		r.Route("/trash", m.trashRoutes)
+		r.Route("/folders", m.folderRoutes)
+	})
+}
+
+// dataRoutes пути данных пользователя или коллекции
+func (m *KeeperHandler) dataRoutes(r chi.Router) {
+	//Список сохраненных данных
+	r.Get("/", m.listData)
+	//Добавление пакета новых данных с результатом по каждым данным
+	r.Post("/", m.addDataBatch)
+
+	r.Route("/{id}", func(r chi.Router) {
 		//Добавление новых данных на сервер
 		r.Post("/", m.addNewData)
+		//Обновление данных с сохранением предыдущей ревизии
+		r.Put("/", m.updateData)
 		//Получение ранеее сохраненных данных с сервера
 		r.Get("/", m.getData)
 		//Удаление хранящихся на сервере данных
 		r.Delete("/", m.deleteData)
+		//Изменение метаданных с сохранением предыдущей ревизии
+		r.Put("/metadata", m.updateMetadata)
+		//Список ревизий данных
+		r.Get("/revisions", m.getDataRevisions)
+		//Получение данных указанной ревизии
+		r.Get("/revisions/{revision}", m.getDataRevision)
+		//Начало загрузки больших данных по частям
+		r.Post("/uploads", m.createUpload)
+		//Передача данных другому пользователю
+		r.Post("/shares", m.shareData)
+		//Смена ключа данных после отзыва передачи
+		r.Post("/rekey", m.rekeyData)
+		//Перемещение данных под новый идентификатор, в том числе в другую папку
+		r.Post("/move", m.moveData)
+		//Вложения данных
+		r.Get("/attachments", m.listAttachments)
+		//Начало загрузки вложения по частям, одноименное вложение заменяется после загрузки
+		r.Post("/attachments/{attachment}", m.createAttachmentUpload)
+		//Получение вложения
+		r.Get("/attachments/{attachment}", m.getAttachment)
+		//Удаление вложения
+		r.Delete("/attachments/{attachment}", m.deleteAttachment)
 	})
 }
 
+// uploadRoutes пути загрузки по частям
+func (m *KeeperHandler) uploadRoutes(r chi.Router) {
+	//Загруженный объем, чтобы продолжить прерванную загрузку
+	r.Head("/", m.getUpload)
+	//Загрузка очередной части
+	r.Patch("/", m.appendUpload)
+	//Отмена загрузки
+	r.Delete("/", m.deleteUpload)
+}
+
+// syncRoutes пути синхронизации
+func (m *KeeperHandler) syncRoutes(r chi.Router) {
+	//Изменения данных после курсора синхронизации
+	r.Get("/", m.getChanges)
+}
+
+// usageRoutes пути занятого места
+func (m *KeeperHandler) usageRoutes(r chi.Router) {
+	//Занятое место и квота
+	r.Get("/", m.getUsage)
+}
+
+// trashRoutes пути корзины
+func (m *KeeperHandler) trashRoutes(r chi.Router) {
+	//Содержимое корзины
+	r.Get("/", m.listTrash)
+	//Окончательное удаление всего содержимого корзины
+	r.Delete("/", m.emptyTrash)
+	//Возврат данных из корзины
+	r.Post("/{trash}/restore", m.restoreTrash)
+	//Окончательное удаление данных из корзины
+	r.Delete("/{trash}", m.deleteTrash)
+}
+
 func (m *KeeperHandler) errorRespond(w http.ResponseWriter, code int, err error) {
 	logger.Error(err.Error())
 	w.WriteHeader(code)
@@ -54,7 +239,7 @@ func (m *KeeperHandler) userRegister(w http.ResponseWriter, r *http.Request) {
 	//Разобрали запрос
 	authDTO, err := models.NewDTO[models.AuthDTO](r.Body)
 	if err != nil {
-		m.errorRespond(w, http.StatusBadRequest, fmt.Errorf("cannot decode auth dto: %s", err))
+		m.errorRespond(w, bodyErrorCode(err), fmt.Errorf("cannot decode auth dto: %s", err))
 		return
 	}
 	//Проверили наличие полей
@@ -63,12 +248,12 @@ func (m *KeeperHandler) userRegister(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	//Проверяем, что пользака с таким логином нет
-	if m.storage.IsUserExist(r.Context(), authDTO.Login) {
+	if m.users.IsUserExist(r.Context(), authDTO.Login) {
 		m.errorRespond(w, http.StatusConflict, fmt.Errorf("user with login %s already exist", authDTO.Login))
 		return
 	}
 	//Создаем пользователя, получаем идентификатор для токена
-	user_id, err := m.storage.CreateUser(r.Context(), authDTO)
+	user_id, err := m.users.CreateUser(r.Context(), authDTO)
 	if err != nil {
 		m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot create new user: %s", err))
 		return
@@ -88,12 +273,12 @@ func (m *KeeperHandler) login(w http.ResponseWriter, r *http.Request) {
 	//Разобрали запрос
 	authDTO, err := models.NewDTO[models.AuthDTO](r.Body)
 	if err != nil {
-		m.errorRespond(w, http.StatusBadRequest, fmt.Errorf("cannot decode auth dto: %s", err))
+		m.errorRespond(w, bodyErrorCode(err), fmt.Errorf("cannot decode auth dto: %s", err))
 		return
 	}
 
 	//Провереяем корректность данных пользователя
-	user_id, err := m.storage.Login(r.Context(), authDTO)
+	user_id, err := m.users.Login(r.Context(), authDTO)
 	if err != nil {
 		m.errorRespond(w, http.StatusUnauthorized, fmt.Errorf("authentication failed: %s", err))
 		return
@@ -108,59 +293,3 @@ func (m *KeeperHandler) login(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Authorization", jwt)
 }
-
-func (m *KeeperHandler) addNewData(w http.ResponseWriter, r *http.Request) {
-
-	//Разобрали запрос
-	dataId := chi.URLParam(r, "id")
-	data, err := io.ReadAll(r.Body)
-	if err != nil {
-		m.errorRespond(w, http.StatusBadRequest, fmt.Errorf("cannot read request body: %s", err))
-		return
-	}
-
-	//Забираем id пользователя из контекста
-	currentUser := r.Context().Value("user").(string)
-
-	//Добавляем данные в базу
-	err = m.storage.AddData(r.Context(), currentUser, dataId, data)
-	if err != nil {
-		m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot decode data: %s", err))
-		return
-	}
-
-	w.WriteHeader(http.StatusAccepted)
-}
-
-func (m *KeeperHandler) getData(w http.ResponseWriter, r *http.Request) {
-
-	//Забираем id пользователя из контекста и идентификатор данных
-	currentUser := r.Context().Value("user").(string)
-	dataId := chi.URLParam(r, "id")
-
-	//Добавляем данные в базу
-	data, err := m.storage.GetData(r.Context(), currentUser, dataId)
-	if err != nil {
-		m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot get user data: %s", err))
-		return
-	}
-
-	w.Header().Set("Content-Type", "multipart/form-data")
-	w.Write(data)
-}
-
-func (m *KeeperHandler) deleteData(w http.ResponseWriter, r *http.Request) {
-
-	//Забираем id пользователя из контекста и идентификатор данных
-	currentUser := r.Context().Value("user").(string)
-	dataId := chi.URLParam(r, "id")
-
-	//Добавляем данные в базу
-	err := m.storage.DeleteData(r.Context(), currentUser, dataId)
-	if err != nil {
-		m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot delete user data: %s", err))
-		return
-	}
-
-	w.WriteHeader(http.StatusAccepted)
-}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"context"
+	"github.com/go-chi/chi/v5"
+	"github.com/lionslon/go-keepass/internal/auth"
+	"github.com/lionslon/go-keepass/internal/deadline"
+	"github.com/lionslon/go-keepass/internal/models"
+	"github.com/lionslon/go-keepass/internal/server/config"
+	"github.com/lionslon/go-keepass/internal/storage"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testServer сервер с обработчиками и хранилищем
+type testServer struct {
+	url     string
+	storage storage.Storage
+}
+
+// newTestServer запускает сервер с хранилищем в памяти и указанными ограничениями
+func newTestServer(t *testing.T, limits Limits) *testServer {
+	t.Helper()
+	return newStorageServer(t, storage.NewMemStorage(), limits)
+}
+
+// newSQLiteServer запускает сервер с хранилищем в файле SQLite: в отличие от хранилища в памяти,
+// оно прерывает запросы по отмене контекста
+func newSQLiteServer(t *testing.T, limits Limits) *testServer {
+	t.Helper()
+
+	dsn := "sqlite://" + filepath.Join(t.TempDir(), "keeper.db")
+	migrator, err := storage.OpenMigrator(dsn)
+	if err != nil {
+		t.Fatalf("OpenMigrator() error = %v", err)
+	}
+	defer migrator.Close()
+	if _, err := migrator.Up(context.Background(), 0); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+
+	st, err := storage.New(dsn)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	t.Cleanup(st.Close)
+
+	return newStorageServer(t, st, limits)
+}
+
+// newStorageServer запускает сервер с хранилищем st, как app.Create
+func newStorageServer(t *testing.T, st storage.Storage, limits Limits) *testServer {
+	t.Helper()
+
+	auth.Initialize(&config.Config{JWTKey: []byte("test"), JWTDuration: time.Hour})
+
+	router := chi.NewRouter()
+	router.Use(deadline.Middleware)
+	handler := NewKeeperHandler(st, limits)
+	handler.Register(router)
+
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	return &testServer{url: server.URL, storage: st}
+}
+
+// user создает пользователя в хранилище и возвращает его идентификатор и заголовок Authorization
+func (s *testServer) user(t *testing.T, login string) (string, string) {
+	t.Helper()
+
+	userId, err := s.storage.CreateUser(context.Background(), models.AuthDTO{Login: login, Password: "password"})
+	if err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	token, err := auth.CreateToken(userId)
+	if err != nil {
+		t.Fatalf("CreateToken() error = %v", err)
+	}
+
+	return userId, token
+}
+
+// do выполняет запрос пользователя с токеном token; header - пары имя, значение
+func (s *testServer) do(t *testing.T, token, method, path string, body io.Reader, header ...string) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequest(method, s.url+path, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", token)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s error = %v", method, path, err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+
+	return resp
+}
+
+// expect проверяет код ответа и возвращает тело
+func expect(t *testing.T, resp *http.Response, code int) string {
+	t.Helper()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("cannot read response: %v", err)
+	}
+	if resp.StatusCode != code {
+		t.Fatalf("%s %s = %d, want %d", resp.Request.Method, resp.Request.URL.Path, resp.StatusCode, code)
+	}
+
+	return string(body)
+}
+
+func TestUnauthorized(t *testing.T) {
+	s := newTestServer(t, Limits{})
+
+	expect(t, s.do(t, ``, http.MethodGet, "/api/data/", nil), http.StatusUnauthorized)
+	expect(t, s.do(t, "Bearer bad", http.MethodGet, "/api/data/", nil), http.StatusUnauthorized)
+	expect(t, s.do(t, "bad", http.MethodPost, "/api/data/mail", strings.NewReader("x")), http.StatusUnauthorized)
+}
@@ -0,0 +1,427 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/lionslon/go-keepass/internal/logger"
+	"github.com/lionslon/go-keepass/internal/models"
+	"github.com/lionslon/go-keepass/internal/storage"
+	"net/http"
+	"strings"
+)
+
+// Организации: участники с ролями (owner, admin, member, readonly) работают с общими коллекциями.
+// Данные коллекции доступны по тем же путям, что и данные пользователя, с префиксом
+// /api/collections/{collection}: /data, /uploads, /sync, /usage, /trash. Каждый обработчик данных
+// проверяет доступ через authorize. Ключи коллекций сервер хранит только зашифрованными
+// открытыми ключами участников.
+const (
+	orgsPath        = "/api/orgs"
+	collectionsPath = "/api/collections"
+
+	collectionParam = "collection"
+)
+
+// vaultAccess доступ к данным, нужный обработчику
+type vaultAccess int
+
+const (
+	readAccess  vaultAccess = iota // чтение
+	writeAccess                    // изменение
+)
+
+// authorize проверяет доступ к данным запроса и возвращает идентификатор их владельца: пользователь
+// работает со своими данными без ограничений, с данными коллекции - если принял приглашение
+// в организацию и его роль разрешает доступ. false - ответ уже отправлен.
+func (m *KeeperHandler) authorize(w http.ResponseWriter, r *http.Request, access vaultAccess) (string, bool) {
+
+	//Забираем id пользователя из контекста
+	currentUser := r.Context().Value("user").(string)
+
+	collectionId := chi.URLParam(r, collectionParam)
+	if collectionId == `` {
+		return currentUser, true
+	}
+
+	collection, err := m.orgs.GetCollection(r.Context(), currentUser, collectionId)
+	if errors.Is(err, storage.ErrNotFound) {
+		m.errorRespond(w, http.StatusNotFound, fmt.Errorf("cannot get collection: %s", err))
+		return ``, false
+	}
+	if err != nil {
+		m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot get collection: %s", err))
+		return ``, false
+	}
+
+	if access == writeAccess && !collection.Role.CanWrite() {
+		m.errorRespond(w, http.StatusForbidden, fmt.Errorf("role %s cannot change collection %s", collection.Role, collectionId))
+		return ``, false
+	}
+
+	return collection.Id, true
+}
+
+// vaultPath путь ресурса данных запроса: для коллекции путь пользователя переносится под путь коллекции
+func vaultPath(r *http.Request, path string) string {
+	if collectionId := chi.URLParam(r, collectionParam); collectionId != `` {
+		return collectionsPath + "/" + collectionId + strings.TrimPrefix(path, "/api")
+	}
+	return path
+}
+
+// membership возвращает участие текущего пользователя в организации запроса.
+// Непринятое приглашение дает доступ только к принятию и отказу. false - ответ уже отправлен.
+func (m *KeeperHandler) membership(w http.ResponseWriter, r *http.Request) (models.Member, bool) {
+
+	//Забираем id пользователя из контекста и идентификатор организации
+	currentUser := r.Context().Value("user").(string)
+	orgId := chi.URLParam(r, "org")
+
+	member, err := m.orgs.GetMember(r.Context(), orgId, currentUser)
+	if errors.Is(err, storage.ErrNotFound) {
+		m.errorRespond(w, http.StatusNotFound, fmt.Errorf("cannot get membership: %s", err))
+		return member, false
+	}
+	if err != nil {
+		m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot get membership: %s", err))
+		return member, false
+	}
+
+	if !member.Accepted {
+		m.errorRespond(w, http.StatusForbidden, fmt.Errorf("invitation to organization %s is not accepted", orgId))
+		return member, false
+	}
+
+	return member, true
+}
+
+// manager возвращает участие текущего пользователя, если он может управлять организацией
+func (m *KeeperHandler) manager(w http.ResponseWriter, r *http.Request) (models.Member, bool) {
+	member, ok := m.membership(w, r)
+	if !ok {
+		return member, false
+	}
+
+	if !member.Role.CanManage() {
+		m.errorRespond(w, http.StatusForbidden, fmt.Errorf("role %s cannot manage organization", member.Role))
+		return member, false
+	}
+
+	return member, true
+}
+
+// orgErrorCode код ответа на ошибку изменения состава организации
+func orgErrorCode(err error) int {
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, storage.ErrAlreadyExist), errors.Is(err, storage.ErrKeysMismatch):
+		return http.StatusConflict
+	case errors.Is(err, storage.ErrForbidden):
+		return http.StatusForbidden
+	}
+	return http.StatusInternalServerError
+}
+
+func (m *KeeperHandler) createOrganization(w http.ResponseWriter, r *http.Request) {
+
+	//Разобрали запрос
+	request, err := models.NewDTO[models.OrganizationRequest](r.Body)
+	if err != nil {
+		m.errorRespond(w, bodyErrorCode(err), fmt.Errorf("cannot decode organization request: %s", err))
+		return
+	}
+	if err := request.Validate(); err != nil {
+		m.errorRespond(w, http.StatusBadRequest, fmt.Errorf("cannot validate organization request: %s", err))
+		return
+	}
+
+	//Забираем id пользователя из контекста
+	currentUser := r.Context().Value("user").(string)
+
+	org, err := m.orgs.CreateOrganization(r.Context(), currentUser, request.Name)
+	if err != nil {
+		m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot create organization: %s", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(org); err != nil {
+		logger.Error("cannot encode organization: %s", err)
+	}
+}
+
+func (m *KeeperHandler) listOrganizations(w http.ResponseWriter, r *http.Request) {
+
+	//Забираем id пользователя из контекста
+	currentUser := r.Context().Value("user").(string)
+
+	orgs, err := m.orgs.ListOrganizations(r.Context(), currentUser)
+	if err != nil {
+		m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot list organizations: %s", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(orgs); err != nil {
+		logger.Error("cannot encode organizations: %s", err)
+	}
+}
+
+func (m *KeeperHandler) acceptInvitation(w http.ResponseWriter, r *http.Request) {
+
+	//Забираем id пользователя из контекста и идентификатор организации
+	currentUser := r.Context().Value("user").(string)
+	orgId := chi.URLParam(r, "org")
+
+	err := m.orgs.AcceptInvitation(r.Context(), orgId, currentUser)
+	if errors.Is(err, storage.ErrNotFound) {
+		m.errorRespond(w, http.StatusNotFound, fmt.Errorf("cannot accept invitation: %s", err))
+		return
+	}
+	if err != nil {
+		m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot accept invitation: %s", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (m *KeeperHandler) listMembers(w http.ResponseWriter, r *http.Request) {
+
+	if _, ok := m.membership(w, r); !ok {
+		return
+	}
+
+	members, err := m.orgs.ListMembers(r.Context(), chi.URLParam(r, "org"))
+	if err != nil {
+		m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot list members: %s", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(members); err != nil {
+		logger.Error("cannot encode members: %s", err)
+	}
+}
+
+func (m *KeeperHandler) inviteMember(w http.ResponseWriter, r *http.Request) {
+
+	manager, ok := m.manager(w, r)
+	if !ok {
+		return
+	}
+
+	//Разобрали запрос
+	request, err := models.NewDTO[models.InviteRequest](r.Body)
+	if err != nil {
+		m.errorRespond(w, bodyErrorCode(err), fmt.Errorf("cannot decode invite request: %s", err))
+		return
+	}
+	if err := request.Validate(); err != nil {
+		m.errorRespond(w, http.StatusBadRequest, fmt.Errorf("cannot validate invite request: %s", err))
+		return
+	}
+
+	if !manager.Role.CanAssign(request.Role) {
+		m.errorRespond(w, http.StatusForbidden, fmt.Errorf("role %s cannot invite %s", manager.Role, request.Role))
+		return
+	}
+
+	member, err := m.orgs.InviteMember(r.Context(), chi.URLParam(r, "org"), request)
+	if err != nil {
+		m.errorRespond(w, orgErrorCode(err), fmt.Errorf("cannot invite member: %s", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(member); err != nil {
+		logger.Error("cannot encode member: %s", err)
+	}
+}
+
+// targetMember возвращает участника организации, которым управляет запрос; false - ответ уже отправлен
+func (m *KeeperHandler) targetMember(w http.ResponseWriter, r *http.Request) (models.Member, bool) {
+	login := chi.URLParam(r, "login")
+
+	members, err := m.orgs.ListMembers(r.Context(), chi.URLParam(r, "org"))
+	if err != nil {
+		m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot list members: %s", err))
+		return models.Member{}, false
+	}
+
+	for _, member := range members {
+		if member.Login == login {
+			return member, true
+		}
+	}
+
+	m.errorRespond(w, http.StatusNotFound, fmt.Errorf("member %s not found", login))
+	return models.Member{}, false
+}
+
+func (m *KeeperHandler) setMemberRole(w http.ResponseWriter, r *http.Request) {
+
+	manager, ok := m.manager(w, r)
+	if !ok {
+		return
+	}
+
+	//Разобрали запрос
+	request, err := models.NewDTO[models.RoleRequest](r.Body)
+	if err != nil {
+		m.errorRespond(w, bodyErrorCode(err), fmt.Errorf("cannot decode role request: %s", err))
+		return
+	}
+	if err := request.Validate(); err != nil {
+		m.errorRespond(w, http.StatusBadRequest, fmt.Errorf("cannot validate role request: %s", err))
+		return
+	}
+
+	target, ok := m.targetMember(w, r)
+	if !ok {
+		return
+	}
+
+	//Роль можно менять только участнику, которым управляешь, и только на ту, которую можешь назначить
+	if !manager.Role.CanAssign(target.Role) || !manager.Role.CanAssign(request.Role) {
+		m.errorRespond(w, http.StatusForbidden, fmt.Errorf("role %s cannot change role %s to %s", manager.Role, target.Role, request.Role))
+		return
+	}
+
+	err = m.orgs.SetMemberRole(r.Context(), chi.URLParam(r, "org"), target.Login, request.Role)
+	if err != nil {
+		m.errorRespond(w, orgErrorCode(err), fmt.Errorf("cannot set member role: %s", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (m *KeeperHandler) removeMember(w http.ResponseWriter, r *http.Request) {
+
+	//Забираем id пользователя из контекста
+	currentUser := r.Context().Value("user").(string)
+
+	target, ok := m.targetMember(w, r)
+	if !ok {
+		return
+	}
+
+	//От непринятого приглашения пользователь отказывается сам, остальных удаляет управляющий организацией.
+	//Принявший приглашение участник знает ключи, и новые ключи коллекций ему знать нельзя.
+	if target.UserId != currentUser || target.Accepted {
+		manager, ok := m.manager(w, r)
+		if !ok {
+			return
+		}
+		if !manager.Role.CanAssign(target.Role) {
+			m.errorRespond(w, http.StatusForbidden, fmt.Errorf("role %s cannot remove %s", manager.Role, target.Role))
+			return
+		}
+		if target.UserId == currentUser {
+			m.errorRespond(w, http.StatusForbidden, fmt.Errorf("members cannot remove themselves, ask another manager"))
+			return
+		}
+	}
+
+	//Без тела запроса ключи не меняются: так удаляется непринятое приглашение
+	var request models.RemoveRequest
+	if r.ContentLength != 0 {
+		var err error
+		request, err = models.NewDTO[models.RemoveRequest](r.Body)
+		if err != nil {
+			m.errorRespond(w, bodyErrorCode(err), fmt.Errorf("cannot decode remove request: %s", err))
+			return
+		}
+		if err := request.Validate(); err != nil {
+			m.errorRespond(w, http.StatusBadRequest, fmt.Errorf("cannot validate remove request: %s", err))
+			return
+		}
+	}
+
+	err := m.orgs.RemoveMember(r.Context(), chi.URLParam(r, "org"), target.Login, request.Keys)
+	if err != nil {
+		m.errorRespond(w, orgErrorCode(err), fmt.Errorf("cannot remove member: %s", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (m *KeeperHandler) createCollection(w http.ResponseWriter, r *http.Request) {
+
+	manager, ok := m.manager(w, r)
+	if !ok {
+		return
+	}
+
+	//Разобрали запрос
+	request, err := models.NewDTO[models.CollectionRequest](r.Body)
+	if err != nil {
+		m.errorRespond(w, bodyErrorCode(err), fmt.Errorf("cannot decode collection request: %s", err))
+		return
+	}
+	if err := request.Validate(); err != nil {
+		m.errorRespond(w, http.StatusBadRequest, fmt.Errorf("cannot validate collection request: %s", err))
+		return
+	}
+
+	collection, err := m.orgs.CreateCollection(r.Context(), chi.URLParam(r, "org"), request)
+	if err != nil {
+		m.errorRespond(w, orgErrorCode(err), fmt.Errorf("cannot create collection: %s", err))
+		return
+	}
+	collection.Role = manager.Role
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(collection); err != nil {
+		logger.Error("cannot encode collection: %s", err)
+	}
+}
+
+func (m *KeeperHandler) listCollections(w http.ResponseWriter, r *http.Request) {
+
+	member, ok := m.membership(w, r)
+	if !ok {
+		return
+	}
+
+	collections, err := m.orgs.ListCollections(r.Context(), chi.URLParam(r, "org"), member.UserId)
+	if err != nil {
+		m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot list collections: %s", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(collections); err != nil {
+		logger.Error("cannot encode collections: %s", err)
+	}
+}
+
+func (m *KeeperHandler) getCollection(w http.ResponseWriter, r *http.Request) {
+
+	//Забираем id пользователя из контекста и идентификатор коллекции
+	currentUser := r.Context().Value("user").(string)
+	collectionId := chi.URLParam(r, collectionParam)
+
+	collection, err := m.orgs.GetCollection(r.Context(), currentUser, collectionId)
+	if errors.Is(err, storage.ErrNotFound) {
+		m.errorRespond(w, http.StatusNotFound, fmt.Errorf("cannot get collection: %s", err))
+		return
+	}
+	if err != nil {
+		m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot get collection: %s", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(collection); err != nil {
+		logger.Error("cannot encode collection: %s", err)
+	}
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"context"
+	"github.com/lionslon/go-keepass/internal/models"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// keyedUser создает пользователя с парой ключей, без которой его нельзя пригласить в организацию
+func (s *testServer) keyedUser(t *testing.T, login string) (string, string) {
+	t.Helper()
+
+	userId, token := s.user(t, login)
+	if err := s.storage.SetUserKeys(context.Background(), userId, models.UserKeys{PublicKey: []byte("public"), PrivateKey: []byte("private")}); err != nil {
+		t.Fatalf("SetUserKeys() error = %v", err)
+	}
+
+	return userId, token
+}
+
+// newCollection создает организацию с коллекцией, ownerId - ее владелец, members - приглашенные с ролями.
+// Приглашение принимают все, кроме участников с ролью из pending.
+func newCollection(t *testing.T, s *testServer, ownerId, owner string, members map[string]models.OrgRole, pending ...string) string {
+	t.Helper()
+	ctx := context.Background()
+
+	org, err := s.storage.CreateOrganization(ctx, ownerId, "team")
+	if err != nil {
+		t.Fatalf("CreateOrganization() error = %v", err)
+	}
+	collection, err := s.storage.CreateCollection(ctx, org.Id, models.CollectionRequest{
+		Name: "infra",
+		Keys: []models.CollectionKey{{Login: owner, Key: []byte("key")}},
+	})
+	if err != nil {
+		t.Fatalf("CreateCollection() error = %v", err)
+	}
+
+	for login, role := range members {
+		member, err := s.storage.InviteMember(ctx, org.Id, models.InviteRequest{
+			Login: login,
+			Role:  role,
+			Keys:  []models.CollectionKey{{Collection: collection.Id, Version: 1, Key: []byte("key")}},
+		})
+		if err != nil {
+			t.Fatalf("InviteMember(%s) error = %v", login, err)
+		}
+		if !slices.Contains(pending, login) {
+			if err := s.storage.AcceptInvitation(ctx, org.Id, member.UserId); err != nil {
+				t.Fatalf("AcceptInvitation(%s) error = %v", login, err)
+			}
+		}
+	}
+
+	return collection.Id
+}
+
+func TestCollectionRoles(t *testing.T) {
+	s := newTestServer(t, Limits{})
+	ownerId, owner := s.keyedUser(t, "alice")
+	_, member := s.keyedUser(t, "bob")
+	_, reader := s.keyedUser(t, "carol")
+	_, invited := s.keyedUser(t, "dave")
+	_, stranger := s.keyedUser(t, "eve")
+
+	collectionId := newCollection(t, s, ownerId, "alice",
+		map[string]models.OrgRole{"bob": models.RoleMember, "carol": models.RoleReadOnly, "dave": models.RoleMember}, "dave")
+	path := collectionsPath + "/" + collectionId
+
+	expect(t, s.do(t, owner, http.MethodPost, path+"/data/db", strings.NewReader("owner")), http.StatusAccepted)
+	expect(t, s.do(t, member, http.MethodPost, path+"/data/vpn", strings.NewReader("member")), http.StatusAccepted)
+
+	reads := []struct {
+		method, path string
+	}{
+		{http.MethodGet, path + "/"},
+		{http.MethodGet, path + "/data/"},
+		{http.MethodGet, path + "/data/db"},
+		{http.MethodGet, path + "/data/db/revisions"},
+		{http.MethodGet, path + "/data/db/attachments"},
+		{http.MethodGet, path + "/sync/"},
+		{http.MethodGet, path + "/usage/"},
+		{http.MethodGet, path + "/trash/"},
+		{http.MethodGet, path + "/folders/"},
+	}
+
+	writes := []struct {
+		method, path, body string
+		header             []string
+	}{
+		{http.MethodPost, path + "/data/new", "data", nil},
+		{http.MethodPost, path + "/data/", `[{"identifier":"new","data":"ZGF0YQ=="}]`, nil},
+		{http.MethodPut, path + "/data/db", "data", nil},
+		{http.MethodPut, path + "/data/db/metadata", "metadata", nil},
+		{http.MethodDelete, path + "/data/db", ``, nil},
+		{http.MethodPost, path + "/data/db/move", `{"identifier":"moved"}`, nil},
+		{http.MethodPost, path + "/data/new/uploads", ``, []string{uploadLengthHeader, "4"}},
+		{http.MethodPost, path + "/data/db/attachments/file", ``, []string{uploadLengthHeader, "4", attachmentKeyHeader, "a2V5"}},
+		{http.MethodDelete, path + "/data/db/attachments/file", ``, nil},
+		{http.MethodPost, path + "/folders/prod", ``, nil},
+		{http.MethodPut, path + "/folders/prod", `{"path":"stage"}`, nil},
+		{http.MethodDelete, path + "/folders/prod", ``, nil},
+		{http.MethodDelete, path + "/trash/", ``, nil},
+		{http.MethodPost, path + "/trash/1/restore", ``, nil},
+		{http.MethodDelete, path + "/trash/1", ``, nil},
+	}
+
+	//Участник только для чтения читает данные коллекции, но не меняет их
+	for _, r := range reads {
+		expect(t, s.do(t, reader, r.method, r.path, nil), http.StatusOK)
+	}
+	for _, w := range writes {
+		expect(t, s.do(t, reader, w.method, w.path, strings.NewReader(w.body), w.header...), http.StatusForbidden)
+	}
+	if body := expect(t, s.do(t, reader, http.MethodGet, path+"/data/db", nil), http.StatusOK); body != "owner" {
+		t.Errorf("GET after forbidden writes = %q, want unchanged", body)
+	}
+
+	//Для пользователя вне организации и не принявшего приглашение коллекции нет
+	for _, token := range []string{stranger, invited} {
+		for _, r := range reads {
+			expect(t, s.do(t, token, r.method, r.path, nil), http.StatusNotFound)
+		}
+		for _, w := range writes {
+			expect(t, s.do(t, token, w.method, w.path, strings.NewReader(w.body), w.header...), http.StatusNotFound)
+		}
+	}
+	expect(t, s.do(t, stranger, http.MethodGet, collectionsPath+"/unknown/data/", nil), http.StatusNotFound)
+
+	//Данные коллекции не видны в личных данных участника
+	expect(t, s.do(t, member, http.MethodGet, "/api/data/db", nil), http.StatusNotFound)
+	expect(t, s.do(t, member, http.MethodPut, path+"/data/db", strings.NewReader("member")), http.StatusAccepted)
+}
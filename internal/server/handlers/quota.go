@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/lionslon/go-keepass/internal/logger"
+	"github.com/lionslon/go-keepass/internal/models"
+	"io"
+	"net/http"
+)
+
+const (
+	usagePath = "/api/usage"
+)
+
+// Limits ограничения размера запросов и квоты пользователей, 0 - без ограничения.
+// Квота проверяется перед записью по уже занятому месту, поэтому параллельные запросы
+// могут превысить ее не больше, чем на свой размер.
+type Limits struct {
+	MaxRequestSize int64 // максимальный размер тела запроса
+	MaxEntries     int64 // максимальное количество данных пользователя
+	MaxBytes       int64 // максимальный объем, занятый пользователем
+}
+
+// limitBody ограничивает размер тела запроса: запрос с большим Content-Length отклоняется сразу,
+// чтение тела сверх ограничения завершается ошибкой *http.MaxBytesError (см. bodyErrorCode)
+func (m *KeeperHandler) limitBody(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if m.limits.MaxRequestSize > 0 {
+			if r.ContentLength > m.limits.MaxRequestSize {
+				m.errorRespond(w, http.StatusRequestEntityTooLarge,
+					fmt.Errorf("request body %d bytes exceeds limit %d", r.ContentLength, m.limits.MaxRequestSize))
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, m.limits.MaxRequestSize)
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// bodyErrorCode код ответа на ошибку чтения тела запроса: 413, если превышено ограничение размера
+func bodyErrorCode(err error) int {
+	if tooLarge := new(http.MaxBytesError); errors.As(err, &tooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// readBody читает тело запроса целиком; false - ответ уже отправлен
+func (m *KeeperHandler) readBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		m.errorRespond(w, bodyErrorCode(err), fmt.Errorf("cannot read request body: %s", err))
+		return nil, false
+	}
+	return body, true
+}
+
+// checkQuota проверяет, что у пользователя есть место для entries новых данных и bytes байт.
+// При превышении квоты отвечает 507; false - ответ уже отправлен.
+func (m *KeeperHandler) checkQuota(w http.ResponseWriter, r *http.Request, userId string, entries, bytes int64) bool {
+	if m.limits.MaxEntries == 0 && m.limits.MaxBytes == 0 {
+		return true
+	}
+
+	usage, err := m.usage.GetUsage(r.Context(), userId)
+	if err != nil {
+		m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot get user usage: %s", err))
+		return false
+	}
+
+	if err := m.quotaError(usage, entries, bytes); err != nil {
+		m.errorRespond(w, http.StatusInsufficientStorage, fmt.Errorf("user %s %s", userId, err))
+		return false
+	}
+
+	return true
+}
+
+// quotaError проверяет, что при занятом месте usage есть место для entries новых данных и bytes байт
+func (m *KeeperHandler) quotaError(usage models.Usage, entries, bytes int64) error {
+	if m.limits.MaxEntries > 0 && entries > 0 && usage.Entries+entries > m.limits.MaxEntries {
+		return fmt.Errorf("has %d of %d entries", usage.Entries, m.limits.MaxEntries)
+	}
+
+	if m.limits.MaxBytes > 0 && bytes > 0 && usage.Bytes+bytes > m.limits.MaxBytes {
+		return fmt.Errorf("uses %d of %d bytes, cannot add %d", usage.Bytes, m.limits.MaxBytes, bytes)
+	}
+
+	return nil
+}
+
+func (m *KeeperHandler) getUsage(w http.ResponseWriter, r *http.Request) {
+
+	//Проверяем доступ к данным пользователя или коллекции организации
+	vault, ok := m.authorize(w, r, readAccess)
+	if !ok {
+		return
+	}
+
+	usage, err := m.usage.GetUsage(r.Context(), vault)
+	if err != nil {
+		m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot get user usage: %s", err))
+		return
+	}
+	usage.MaxEntries = m.limits.MaxEntries
+	usage.MaxBytes = m.limits.MaxBytes
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(usage); err != nil {
+		logger.Error("cannot encode user usage: %s", err)
+	}
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/lionslon/go-keepass/internal/models"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// chunked скрывает размер тела, чтобы запрос передавался без Content-Length
+type chunked struct {
+	io.Reader
+}
+
+func TestRequestSizeLimit(t *testing.T) {
+	s := newTestServer(t, Limits{MaxRequestSize: 8})
+	_, token := s.user(t, "alice")
+
+	expect(t, s.do(t, token, http.MethodPost, "/api/data/fits", strings.NewReader("12345678")), http.StatusAccepted)
+
+	//Объявленный размер отклоняется сразу, без объявления - при чтении тела
+	expect(t, s.do(t, token, http.MethodPost, "/api/data/large", strings.NewReader("123456789")),
+		http.StatusRequestEntityTooLarge)
+	expect(t, s.do(t, token, http.MethodPost, "/api/data/large", chunked{strings.NewReader("123456789")}),
+		http.StatusRequestEntityTooLarge)
+	expect(t, s.do(t, token, http.MethodPut, "/api/data/fits", chunked{strings.NewReader("123456789")}),
+		http.StatusRequestEntityTooLarge)
+	expect(t, s.do(t, ``, http.MethodPost, "/api/user/login", chunked{strings.NewReader(`{"login":"alice"}`)}),
+		http.StatusRequestEntityTooLarge)
+
+	//Ограничение действует и на части загрузки, сама загрузка может быть больше
+	upload := createUpload(t, s, token, "file", "16")
+	expect(t, s.do(t, token, http.MethodPatch, upload, strings.NewReader("12345678"), uploadOffsetHeader, "0"),
+		http.StatusNoContent)
+	resp := s.do(t, token, http.MethodPatch, upload, chunked{strings.NewReader("123456789")}, uploadOffsetHeader, "8")
+	expect(t, resp, http.StatusRequestEntityTooLarge)
+	if offset := resp.Header.Get(uploadOffsetHeader); offset != "16" {
+		t.Errorf("PATCH too large Upload-Offset = %s, want 16: bytes within limit are kept", offset)
+	}
+	expect(t, s.do(t, token, http.MethodPatch, upload, strings.NewReader(``), uploadOffsetHeader, "16"), http.StatusNoContent)
+	if body := expect(t, s.do(t, token, http.MethodGet, "/api/data/file", nil), http.StatusOK); body != "1234567812345678" {
+		t.Errorf("GET uploaded = %q, want 16 bytes", body)
+	}
+
+	if body := expect(t, s.do(t, token, http.MethodGet, "/api/data/fits", nil), http.StatusOK); body != "12345678" {
+		t.Errorf("GET = %q, want unchanged data", body)
+	}
+	expect(t, s.do(t, token, http.MethodGet, "/api/data/large", nil), http.StatusNotFound)
+}
+
+func TestQuotaEntries(t *testing.T) {
+	s := newTestServer(t, Limits{MaxEntries: 2})
+	_, token := s.user(t, "alice")
+
+	expect(t, s.do(t, token, http.MethodPost, "/api/data/a", strings.NewReader("a")), http.StatusAccepted)
+	expect(t, s.do(t, token, http.MethodPost, "/api/data/b", strings.NewReader("b")), http.StatusAccepted)
+	expect(t, s.do(t, token, http.MethodPost, "/api/data/c", strings.NewReader("c")), http.StatusInsufficientStorage)
+	expect(t, s.do(t, token, http.MethodPost, "/api/data/c/uploads", nil, uploadLengthHeader, "1", "If-None-Match", "*"),
+		http.StatusInsufficientStorage)
+
+	//Изменение существующих данных не добавляет записей
+	expect(t, s.do(t, token, http.MethodPut, "/api/data/a", strings.NewReader("a2")), http.StatusAccepted)
+
+	//Квота у каждого пользователя своя
+	_, other := s.user(t, "bob")
+	expect(t, s.do(t, other, http.MethodPost, "/api/data/c", strings.NewReader("c")), http.StatusAccepted)
+}
+
+func TestQuotaBytes(t *testing.T) {
+	s := newTestServer(t, Limits{MaxBytes: 10})
+	_, token := s.user(t, "alice")
+
+	expect(t, s.do(t, token, http.MethodPost, "/api/data/a", strings.NewReader("123456")), http.StatusAccepted)
+
+	//Предыдущие ревизии тоже занимают место
+	expect(t, s.do(t, token, http.MethodPut, "/api/data/a", strings.NewReader("123456")), http.StatusInsufficientStorage)
+	expect(t, s.do(t, token, http.MethodPost, "/api/data/b", strings.NewReader("12345")), http.StatusInsufficientStorage)
+	expect(t, s.do(t, token, http.MethodPost, "/api/data/b/uploads", nil, uploadLengthHeader, "5"),
+		http.StatusInsufficientStorage)
+	expect(t, s.do(t, token, http.MethodPost, "/api/data/b", strings.NewReader("1234")), http.StatusAccepted)
+
+	var usage models.Usage
+	body := expect(t, s.do(t, token, http.MethodGet, usagePath+"/", nil), http.StatusOK)
+	if err := json.Unmarshal([]byte(body), &usage); err != nil {
+		t.Fatalf("cannot decode usage %q: %v", body, err)
+	}
+	if usage.Entries != 2 || usage.Bytes != 10 || usage.MaxBytes != 10 || usage.MaxEntries != 0 {
+		t.Errorf("usage = %+v, want 2 entries and 10 of 10 bytes", usage)
+	}
+}
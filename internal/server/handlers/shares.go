@@ -0,0 +1,374 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/lionslon/go-keepass/internal/logger"
+	"github.com/lionslon/go-keepass/internal/models"
+	"github.com/lionslon/go-keepass/internal/storage"
+	"net/http"
+)
+
+// Обмен данными: у каждого пользователя есть пара ключей, закрытый ключ зашифрован клиентом.
+// Владелец передает данные, отправляя ключ данных, зашифрованный открытым ключом получателя;
+// получатель принимает передачу и читает (с правом записи - и изменяет) данные владельца
+// через /api/shares/{share}/data. Сервер ключи данных не видит.
+const (
+	keysPath   = "/api/keys"
+	sharesPath = "/api/shares"
+)
+
+func (m *KeeperHandler) getUserKeys(w http.ResponseWriter, r *http.Request) {
+
+	//Забираем id пользователя из контекста
+	currentUser := r.Context().Value("user").(string)
+
+	keys, err := m.shares.GetUserKeys(r.Context(), currentUser)
+	if errors.Is(err, storage.ErrNotFound) {
+		m.errorRespond(w, http.StatusNotFound, fmt.Errorf("cannot get user keys: %s", err))
+		return
+	}
+	if err != nil {
+		m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot get user keys: %s", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(keys); err != nil {
+		logger.Error("cannot encode user keys: %s", err)
+	}
+}
+
+func (m *KeeperHandler) setUserKeys(w http.ResponseWriter, r *http.Request) {
+
+	//Разобрали запрос
+	keys, err := models.NewDTO[models.UserKeys](r.Body)
+	if err != nil {
+		m.errorRespond(w, bodyErrorCode(err), fmt.Errorf("cannot decode user keys: %s", err))
+		return
+	}
+	if err := keys.Validate(); err != nil {
+		m.errorRespond(w, http.StatusBadRequest, fmt.Errorf("cannot validate user keys: %s", err))
+		return
+	}
+
+	//Забираем id пользователя из контекста
+	currentUser := r.Context().Value("user").(string)
+
+	//Ключи не заменяются: переданные пользователю данные зашифрованы его открытым ключом
+	err = m.shares.SetUserKeys(r.Context(), currentUser, keys)
+	if errors.Is(err, storage.ErrAlreadyExist) {
+		m.errorRespond(w, http.StatusConflict, fmt.Errorf("cannot set user keys: %s", err))
+		return
+	}
+	if err != nil {
+		m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot set user keys: %s", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (m *KeeperHandler) getPublicKey(w http.ResponseWriter, r *http.Request) {
+
+	login := chi.URLParam(r, "login")
+
+	publicKey, err := m.shares.GetPublicKey(r.Context(), login)
+	if errors.Is(err, storage.ErrNotFound) {
+		m.errorRespond(w, http.StatusNotFound, fmt.Errorf("cannot get public key: %s", err))
+		return
+	}
+	if err != nil {
+		m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot get public key: %s", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-pem-file")
+	if _, err := w.Write(publicKey); err != nil {
+		logger.Error("cannot write public key: %s", err)
+	}
+}
+
+func (m *KeeperHandler) shareData(w http.ResponseWriter, r *http.Request) {
+
+	//Данные коллекции доступны участникам организации, передать можно только свои данные
+	if collectionId := chi.URLParam(r, collectionParam); collectionId != `` {
+		m.errorRespond(w, http.StatusBadRequest, fmt.Errorf("cannot share data of collection %s", collectionId))
+		return
+	}
+
+	//Разобрали запрос
+	dataId, ok := m.dataParam(w, r)
+	if !ok {
+		return
+	}
+	request, err := models.NewDTO[models.ShareRequest](r.Body)
+	if err != nil {
+		m.errorRespond(w, bodyErrorCode(err), fmt.Errorf("cannot decode share request: %s", err))
+		return
+	}
+	if err := request.Validate(); err != nil {
+		m.errorRespond(w, http.StatusBadRequest, fmt.Errorf("cannot validate share request: %s", err))
+		return
+	}
+
+	//Забираем id пользователя из контекста
+	currentUser := r.Context().Value("user").(string)
+
+	share, err := m.shares.ShareData(r.Context(), currentUser, dataId, request)
+	if errors.Is(err, storage.ErrNotFound) {
+		m.errorRespond(w, http.StatusNotFound, fmt.Errorf("cannot share data: %s", err))
+		return
+	}
+	if errors.Is(err, storage.ErrForbidden) {
+		m.errorRespond(w, http.StatusBadRequest, fmt.Errorf("cannot share data: %s", err))
+		return
+	}
+	if err != nil {
+		m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot share data: %s", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(share); err != nil {
+		logger.Error("cannot encode share: %s", err)
+	}
+}
+
+func (m *KeeperHandler) rekeyData(w http.ResponseWriter, r *http.Request) {
+
+	//Ключи данных коллекции меняются новой версией ключа коллекции
+	if collectionId := chi.URLParam(r, collectionParam); collectionId != `` {
+		m.errorRespond(w, http.StatusBadRequest, fmt.Errorf("cannot rekey data of collection %s", collectionId))
+		return
+	}
+
+	//Разобрали запрос
+	dataId, ok := m.dataParam(w, r)
+	if !ok {
+		return
+	}
+	request, err := models.NewDTO[models.RekeyRequest](r.Body)
+	if err != nil {
+		m.errorRespond(w, bodyErrorCode(err), fmt.Errorf("cannot decode rekey request: %s", err))
+		return
+	}
+	if err := request.Validate(); err != nil {
+		m.errorRespond(w, http.StatusBadRequest, fmt.Errorf("cannot validate rekey request: %s", err))
+		return
+	}
+
+	//Забираем id пользователя из контекста
+	currentUser := r.Context().Value("user").(string)
+
+	//Проверяем условия запроса
+	expected, ok := m.checkPreconditions(w, r, currentUser, dataId)
+	if !ok {
+		return
+	}
+
+	err = m.data.RekeyData(r.Context(), currentUser, dataId, request.Origin, expected)
+	if errors.Is(err, storage.ErrRevisionMismatch) {
+		m.errorRespond(w, http.StatusPreconditionFailed, fmt.Errorf("cannot rekey data: %s", err))
+		return
+	}
+	if errors.Is(err, storage.ErrNotFound) {
+		m.errorRespond(w, m.notFoundCode(r), fmt.Errorf("cannot rekey data: %s", err))
+		return
+	}
+	if err != nil {
+		m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot rekey data: %s", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (m *KeeperHandler) listShares(w http.ResponseWriter, r *http.Request) {
+
+	//Забираем id пользователя из контекста
+	currentUser := r.Context().Value("user").(string)
+
+	list, err := m.shares.ListShares(r.Context(), currentUser)
+	if err != nil {
+		m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot list shares: %s", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(list); err != nil {
+		logger.Error("cannot encode shares: %s", err)
+	}
+}
+
+func (m *KeeperHandler) getShare(w http.ResponseWriter, r *http.Request) {
+
+	//Забираем id пользователя из контекста и идентификатор передачи
+	currentUser := r.Context().Value("user").(string)
+	shareId := chi.URLParam(r, "share")
+
+	share, err := m.shares.GetShare(r.Context(), currentUser, shareId)
+	if errors.Is(err, storage.ErrNotFound) {
+		m.errorRespond(w, http.StatusNotFound, fmt.Errorf("cannot get share: %s", err))
+		return
+	}
+	if err != nil {
+		m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot get share: %s", err))
+		return
+	}
+
+	//Ключ данных нужен только получателю
+	if share.RecipientId != currentUser {
+		share.Key = nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(share); err != nil {
+		logger.Error("cannot encode share: %s", err)
+	}
+}
+
+func (m *KeeperHandler) acceptShare(w http.ResponseWriter, r *http.Request) {
+
+	//Забираем id пользователя из контекста и идентификатор передачи
+	currentUser := r.Context().Value("user").(string)
+	shareId := chi.URLParam(r, "share")
+
+	err := m.shares.AcceptShare(r.Context(), currentUser, shareId)
+	if errors.Is(err, storage.ErrNotFound) {
+		m.errorRespond(w, http.StatusNotFound, fmt.Errorf("cannot accept share: %s", err))
+		return
+	}
+	if err != nil {
+		m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot accept share: %s", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (m *KeeperHandler) deleteShare(w http.ResponseWriter, r *http.Request) {
+
+	//Забираем id пользователя из контекста и идентификатор передачи
+	currentUser := r.Context().Value("user").(string)
+	shareId := chi.URLParam(r, "share")
+
+	err := m.shares.DeleteShare(r.Context(), currentUser, shareId)
+	if errors.Is(err, storage.ErrNotFound) {
+		m.errorRespond(w, http.StatusNotFound, fmt.Errorf("cannot delete share: %s", err))
+		return
+	}
+	if err != nil {
+		m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot delete share: %s", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// receivedShare возвращает принятую получателем передачу; false - ответ уже отправлен
+func (m *KeeperHandler) receivedShare(w http.ResponseWriter, r *http.Request) (models.Share, bool) {
+
+	//Забираем id пользователя из контекста и идентификатор передачи
+	currentUser := r.Context().Value("user").(string)
+	shareId := chi.URLParam(r, "share")
+
+	//Владелец работает с данными напрямую, через передачу - только получатель
+	share, err := m.shares.GetShare(r.Context(), currentUser, shareId)
+	if errors.Is(err, storage.ErrNotFound) || (err == nil && share.RecipientId != currentUser) {
+		m.errorRespond(w, http.StatusNotFound, fmt.Errorf("cannot get share: share %s not received by user", shareId))
+		return share, false
+	}
+	if err != nil {
+		m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot get share: %s", err))
+		return share, false
+	}
+
+	if !share.Accepted {
+		m.errorRespond(w, http.StatusForbidden, fmt.Errorf("share %s is not accepted", shareId))
+		return share, false
+	}
+
+	return share, true
+}
+
+func (m *KeeperHandler) getSharedData(w http.ResponseWriter, r *http.Request) {
+
+	share, ok := m.receivedShare(w, r)
+	if !ok {
+		return
+	}
+
+	//Получаем данные владельца
+	entry, err := m.data.GetData(r.Context(), share.OwnerId, share.Identifier)
+	if errors.Is(err, storage.ErrNotFound) {
+		m.errorRespond(w, http.StatusNotFound, fmt.Errorf("cannot get shared data: %s", err))
+		return
+	}
+	if err != nil {
+		m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot get shared data: %s", err))
+		return
+	}
+
+	w.Header().Set("ETag", etag(entry.Revision))
+
+	//У получателя уже актуальная ревизия
+	if inm := r.Header.Get("If-None-Match"); inm != `` && matchETag(inm, entry.Revision) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	m.writeContent(w, r, entry)
+}
+
+func (m *KeeperHandler) updateSharedData(w http.ResponseWriter, r *http.Request) {
+
+	share, ok := m.receivedShare(w, r)
+	if !ok {
+		return
+	}
+
+	if share.Permission != models.ShareWrite {
+		m.errorRespond(w, http.StatusForbidden, fmt.Errorf("share %s is read only", share.Id))
+		return
+	}
+
+	//Разобрали запрос
+	data, ok := m.readBody(w, r)
+	if !ok {
+		return
+	}
+
+	//Без заголовка метаданных остаются прежними
+	metadata, err := readMetadata(r)
+	if err != nil {
+		m.errorRespond(w, http.StatusBadRequest, fmt.Errorf("cannot read metadata: %s", err))
+		return
+	}
+
+	//Новая ревизия занимает место владельца
+	expected, ok := m.checkPreconditions(w, r, share.OwnerId, share.Identifier)
+	if !ok || !m.checkQuota(w, r, share.OwnerId, 0, int64(len(data)+len(metadata))) {
+		return
+	}
+
+	revision, err := m.data.UpdateData(r.Context(), share.OwnerId, share.Identifier, data, metadata, expected)
+	if errors.Is(err, storage.ErrRevisionMismatch) {
+		m.errorRespond(w, http.StatusPreconditionFailed, fmt.Errorf("cannot update shared data: %s", err))
+		return
+	}
+	if errors.Is(err, storage.ErrNotFound) {
+		m.errorRespond(w, m.notFoundCode(r), fmt.Errorf("cannot update shared data: %s", err))
+		return
+	}
+	if err != nil {
+		m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot update shared data: %s", err))
+		return
+	}
+
+	w.Header().Set("ETag", etag(revision))
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/lionslon/go-keepass/internal/logger"
+	"net/http"
+	"strconv"
+)
+
+// Синхронизация: каждое изменение данных пользователя получает следующий номер.
+// GET /api/sync?since=<курсор> возвращает изменения после курсора и новый курсор;
+// без курсора (или с устаревшим курсором) возвращаются все данные с признаком reset.
+const (
+	syncPath = "/api/sync"
+)
+
+func (m *KeeperHandler) getChanges(w http.ResponseWriter, r *http.Request) {
+
+	//Проверяем доступ к данным пользователя или коллекции организации
+	vault, ok := m.authorize(w, r, readAccess)
+	if !ok {
+		return
+	}
+
+	var since int64
+	if cursor := r.URL.Query().Get("since"); cursor != `` {
+		n, err := strconv.ParseInt(cursor, 10, 64)
+		if err != nil || n < 0 {
+			m.errorRespond(w, http.StatusBadRequest, fmt.Errorf("bad sync cursor %q", cursor))
+			return
+		}
+		since = n
+	}
+
+	changes, err := m.sync.GetChanges(r.Context(), vault, since)
+	if err != nil {
+		m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot get user changes: %s", err))
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(changes); err != nil {
+		logger.Error("cannot encode user changes: %s", err)
+	}
+}
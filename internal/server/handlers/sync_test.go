@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/lionslon/go-keepass/internal/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// getChanges запрашивает изменения после курсора since
+func getChanges(t *testing.T, s *testServer, token string, since int64) models.SyncChanges {
+	t.Helper()
+
+	var changes models.SyncChanges
+	resp := s.do(t, token, http.MethodGet, "/api/sync/?since="+strconv.FormatInt(since, 10), nil)
+	body := expect(t, resp, http.StatusOK)
+	if err := json.Unmarshal([]byte(body), &changes); err != nil {
+		t.Fatalf("cannot decode changes %q: %v", body, err)
+	}
+	if got := resp.Header.Get("Cache-Control"); got != "no-store" {
+		t.Errorf("sync Cache-Control = %q, want no-store", got)
+	}
+	return changes
+}
+
+func TestSyncCursor(t *testing.T) {
+	s := newTestServer(t, Limits{})
+	_, token := s.user(t, "alice")
+
+	expect(t, s.do(t, token, http.MethodPost, "/api/data/a", strings.NewReader("a")), http.StatusAccepted)
+	expect(t, s.do(t, token, http.MethodPost, "/api/data/b", strings.NewReader("b")), http.StatusAccepted)
+
+	full := getChanges(t, s, token, 0)
+	if !full.Reset || full.Cursor != 2 || len(full.Created) != 2 {
+		t.Fatalf("sync without cursor = %+v, want reset with 2 created at cursor 2", full)
+	}
+
+	expect(t, s.do(t, token, http.MethodPut, "/api/data/a", strings.NewReader("a2")), http.StatusAccepted)
+	expect(t, s.do(t, token, http.MethodDelete, "/api/data/b", nil), http.StatusAccepted)
+
+	delta := getChanges(t, s, token, full.Cursor)
+	if delta.Reset || delta.Cursor != 4 {
+		t.Errorf("sync delta = reset %v at cursor %d, want delta at cursor 4", delta.Reset, delta.Cursor)
+	}
+	if len(delta.Created) != 0 || len(delta.Updated) != 1 || delta.Updated[0].Identifier != "a" ||
+		len(delta.Deleted) != 1 || delta.Deleted[0] != "b" {
+		t.Errorf("sync delta = %+v, want a updated and b deleted", delta)
+	}
+
+	if current := getChanges(t, s, token, delta.Cursor); current.Reset || len(current.Updated)+len(current.Deleted) != 0 {
+		t.Errorf("sync current = %+v, want no changes", current)
+	}
+
+	//Курсор, выданный не этим сервером, сбрасывает синхронизацию
+	if unknown := getChanges(t, s, token, 100); !unknown.Reset || unknown.Cursor != 4 || len(unknown.Created) != 1 {
+		t.Errorf("sync unknown cursor = %+v, want reset with a at cursor 4", unknown)
+	}
+
+	//Окончательно удаленные из корзины данные делают старый курсор устаревшим
+	expect(t, s.do(t, token, http.MethodDelete, "/api/trash/", nil), http.StatusNoContent)
+	if expired := getChanges(t, s, token, full.Cursor); !expired.Reset {
+		t.Errorf("sync expired cursor = %+v, want reset", expired)
+	}
+
+	for _, since := range []string{"-1", "x"} {
+		expect(t, s.do(t, token, http.MethodGet, "/api/sync/?since="+since, nil), http.StatusBadRequest)
+	}
+}
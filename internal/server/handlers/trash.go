@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/lionslon/go-keepass/internal/logger"
+	"github.com/lionslon/go-keepass/internal/storage"
+	"net/http"
+)
+
+// Корзина: DELETE /api/data/{id} переносит данные в корзину, откуда их можно вернуть
+// или удалить окончательно. Данные в корзине адресуются собственным идентификатором,
+// так как после удаления можно создать и снова удалить данные с тем же идентификатором.
+const (
+	trashPath = "/api/trash"
+)
+
+func (m *KeeperHandler) listTrash(w http.ResponseWriter, r *http.Request) {
+
+	//Проверяем доступ к данным пользователя или коллекции организации
+	vault, ok := m.authorize(w, r, readAccess)
+	if !ok {
+		return
+	}
+
+	items, err := m.trash.ListTrash(r.Context(), vault)
+	if err != nil {
+		m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot list user trash: %s", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(items); err != nil {
+		logger.Error("cannot encode user trash: %s", err)
+	}
+}
+
+func (m *KeeperHandler) restoreTrash(w http.ResponseWriter, r *http.Request) {
+
+	//Проверяем доступ к данным пользователя или коллекции организации
+	vault, ok := m.authorize(w, r, writeAccess)
+	if !ok {
+		return
+	}
+
+	//Забираем идентификатор в корзине
+	trashId := chi.URLParam(r, "trash")
+
+	//Данные в корзине уже занимают место, но снова учитываются в количестве данных
+	if !m.checkQuota(w, r, vault, 1, 0) {
+		return
+	}
+
+	item, err := m.trash.RestoreTrash(r.Context(), vault, trashId)
+	if errors.Is(err, storage.ErrNotFound) {
+		m.errorRespond(w, http.StatusNotFound, fmt.Errorf("cannot restore trash item: %s", err))
+		return
+	}
+	//Данные с тем же идентификатором уже созданы заново
+	if errors.Is(err, storage.ErrAlreadyExist) {
+		m.errorRespond(w, http.StatusConflict, fmt.Errorf("cannot restore trash item: %s", err))
+		return
+	}
+	if err != nil {
+		m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot restore trash item: %s", err))
+		return
+	}
+
+	w.Header().Set("ETag", etag(item.Revision))
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(item); err != nil {
+		logger.Error("cannot encode trash item: %s", err)
+	}
+}
+
+func (m *KeeperHandler) deleteTrash(w http.ResponseWriter, r *http.Request) {
+
+	//Проверяем доступ к данным пользователя или коллекции организации
+	vault, ok := m.authorize(w, r, writeAccess)
+	if !ok {
+		return
+	}
+
+	//Забираем идентификатор в корзине
+	trashId := chi.URLParam(r, "trash")
+
+	err := m.trash.DeleteTrash(r.Context(), vault, trashId)
+	if errors.Is(err, storage.ErrNotFound) {
+		m.errorRespond(w, http.StatusNotFound, fmt.Errorf("cannot delete trash item: %s", err))
+		return
+	}
+	if err != nil {
+		m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot delete trash item: %s", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (m *KeeperHandler) emptyTrash(w http.ResponseWriter, r *http.Request) {
+
+	//Проверяем доступ к данным пользователя или коллекции организации
+	vault, ok := m.authorize(w, r, writeAccess)
+	if !ok {
+		return
+	}
+
+	if _, err := m.trash.EmptyTrash(r.Context(), vault); err != nil {
+		m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot empty user trash: %s", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/lionslon/go-keepass/internal/deadline"
+	"github.com/lionslon/go-keepass/internal/models"
+	"github.com/lionslon/go-keepass/internal/storage"
+	"net/http"
+	"strconv"
+)
+
+// Загрузка больших данных по частям в стиле tus: POST /api/data/{id}/uploads создает загрузку
+// объявленного размера, PATCH /api/uploads/{upload} дописывает часть с указанного смещения,
+// HEAD возвращает уже загруженный объем, чтобы продолжить загрузку после обрыва.
+// Когда загружено все содержимое, оно становится новой ревизией данных.
+const (
+	uploadsPath = "/api/uploads"
+
+	uploadLengthHeader = "Upload-Length" // полный размер содержимого
+	uploadOffsetHeader = "Upload-Offset" // смещение части / загруженный объем
+)
+
+func (m *KeeperHandler) createUpload(w http.ResponseWriter, r *http.Request) {
+
+	//Разобрали запрос, загрузка может создать данные, поэтому идентификатор должен быть допустимым путем
+	dataId, ok := m.dataParam(w, r)
+	if !ok {
+		return
+	}
+	if err := models.ValidatePath(dataId); err != nil {
+		m.errorRespond(w, http.StatusBadRequest, fmt.Errorf("bad data identifier: %s", err))
+		return
+	}
+	size, err := strconv.ParseInt(r.Header.Get(uploadLengthHeader), 10, 64)
+	if err != nil || size < 0 {
+		m.errorRespond(w, http.StatusBadRequest, fmt.Errorf("bad %s header", uploadLengthHeader))
+		return
+	}
+
+	metadata, err := readMetadata(r)
+	if err != nil {
+		m.errorRespond(w, http.StatusBadRequest, fmt.Errorf("cannot read metadata: %s", err))
+		return
+	}
+
+	//Проверяем доступ к данным пользователя или коллекции организации
+	vault, ok := m.authorize(w, r, writeAccess)
+	if !ok {
+		return
+	}
+
+	//Проверяем условия запроса сразу, окончательно они проверяются при завершении загрузки
+	expected, ok := m.checkPreconditions(w, r, vault, dataId)
+	if !ok {
+		return
+	}
+
+	//Место под все содержимое занимается при создании загрузки
+	createOnly := r.Header.Get("If-None-Match") == "*"
+	var entries int64
+	if createOnly {
+		entries = 1
+	}
+	if !m.checkQuota(w, r, vault, entries, size+int64(len(metadata))) {
+		return
+	}
+
+	uploadId, err := m.uploads.CreateUpload(r.Context(), vault, storage.Upload{
+		DataId:     dataId,
+		Size:       size,
+		Metadata:   metadata,
+		Expected:   expected,
+		CreateOnly: createOnly,
+	})
+	if err != nil {
+		m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot create upload: %s", err))
+		return
+	}
+
+	w.Header().Set("Location", vaultPath(r, uploadsPath)+"/"+uploadId)
+	w.Header().Set(uploadOffsetHeader, "0")
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (m *KeeperHandler) getUpload(w http.ResponseWriter, r *http.Request) {
+
+	//Проверяем доступ к данным пользователя или коллекции организации
+	vault, ok := m.authorize(w, r, writeAccess)
+	if !ok {
+		return
+	}
+
+	//Забираем идентификатор загрузки
+	uploadId := chi.URLParam(r, "upload")
+
+	upload, err := m.uploads.GetUpload(r.Context(), vault, uploadId)
+	if errors.Is(err, storage.ErrNotFound) {
+		m.errorRespond(w, http.StatusNotFound, fmt.Errorf("cannot get upload: %s", err))
+		return
+	}
+	if err != nil {
+		m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot get upload: %s", err))
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set(uploadLengthHeader, strconv.FormatInt(upload.Size, 10))
+	w.Header().Set(uploadOffsetHeader, strconv.FormatInt(upload.Uploaded, 10))
+}
+
+func (m *KeeperHandler) appendUpload(w http.ResponseWriter, r *http.Request) {
+
+	//Проверяем доступ к данным пользователя или коллекции организации
+	vault, ok := m.authorize(w, r, writeAccess)
+	if !ok {
+		return
+	}
+
+	//Забираем идентификатор загрузки
+	uploadId := chi.URLParam(r, "upload")
+
+	offset, err := strconv.ParseInt(r.Header.Get(uploadOffsetHeader), 10, 64)
+	if err != nil || offset < 0 {
+		m.errorRespond(w, http.StatusBadRequest, fmt.Errorf("bad %s header", uploadOffsetHeader))
+		return
+	}
+
+	//Тело читается из сети дольше общего ограничения времени запроса
+	uploaded, err := m.uploads.AppendUpload(deadline.Unbounded(r.Context()), vault, uploadId, offset, r.Body)
+	w.Header().Set(uploadOffsetHeader, strconv.FormatInt(uploaded, 10))
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		m.errorRespond(w, http.StatusNotFound, fmt.Errorf("cannot append upload: %s", err))
+		return
+	case errors.Is(err, storage.ErrOffsetMismatch):
+		m.errorRespond(w, http.StatusConflict, fmt.Errorf("cannot append upload: %s", err))
+		return
+	case errors.Is(err, storage.ErrUploadTooLarge), bodyErrorCode(err) == http.StatusRequestEntityTooLarge:
+		m.errorRespond(w, http.StatusRequestEntityTooLarge, fmt.Errorf("cannot append upload: %s", err))
+		return
+	case err != nil:
+		m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot append upload: %s", err))
+		return
+	}
+
+	//Deadline запроса мог истечь, пока читалось тело, завершение ограничиваем заново
+	ctx, cancel := deadline.Renew(r.Context())
+	defer cancel()
+
+	upload, err := m.uploads.GetUpload(ctx, vault, uploadId)
+	if err != nil {
+		m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot get upload: %s", err))
+		return
+	}
+
+	if upload.Uploaded < upload.Size {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	//Загружено все содержимое - сохраняем его новой ревизией данных
+	revision, err := m.uploads.CompleteUpload(ctx, vault, uploadId)
+	if errors.Is(err, storage.ErrRevisionMismatch) || errors.Is(err, storage.ErrAlreadyExist) || errors.Is(err, storage.ErrNotFound) {
+		m.errorRespond(w, http.StatusPreconditionFailed, fmt.Errorf("cannot complete upload: %s", err))
+		return
+	}
+	if err != nil {
+		m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot complete upload: %s", err))
+		return
+	}
+
+	w.Header().Set("ETag", etag(revision))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (m *KeeperHandler) deleteUpload(w http.ResponseWriter, r *http.Request) {
+
+	//Проверяем доступ к данным пользователя или коллекции организации
+	vault, ok := m.authorize(w, r, writeAccess)
+	if !ok {
+		return
+	}
+
+	//Забираем идентификатор загрузки
+	uploadId := chi.URLParam(r, "upload")
+
+	err := m.uploads.DeleteUpload(r.Context(), vault, uploadId)
+	if errors.Is(err, storage.ErrNotFound) {
+		m.errorRespond(w, http.StatusNotFound, fmt.Errorf("cannot delete upload: %s", err))
+		return
+	}
+	if err != nil {
+		m.errorRespond(w, http.StatusInternalServerError, fmt.Errorf("cannot delete upload: %s", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// slowReader отдает содержимое после паузы, как медленный клиент
+type slowReader struct {
+	r     io.Reader
+	delay time.Duration
+	slept bool
+}
+
+func (m *slowReader) Read(p []byte) (int, error) {
+	if !m.slept {
+		time.Sleep(m.delay)
+		m.slept = true
+	}
+	return m.r.Read(p)
+}
+
+// createUpload начинает загрузку size байт и возвращает ее путь
+func createUpload(t *testing.T, s *testServer, token, dataId string, size string) string {
+	t.Helper()
+
+	resp := s.do(t, token, http.MethodPost, "/api/data/"+dataId+"/uploads", nil, uploadLengthHeader, size)
+	expect(t, resp, http.StatusCreated)
+	location := resp.Header.Get("Location")
+	if !strings.HasPrefix(location, uploadsPath+"/") {
+		t.Fatalf("upload Location = %q, want under %s", location, uploadsPath)
+	}
+	return location
+}
+
+func TestUploadResume(t *testing.T) {
+	s := newTestServer(t, Limits{})
+	_, token := s.user(t, "alice")
+
+	upload := createUpload(t, s, token, "file", "6")
+
+	resp := s.do(t, token, http.MethodPatch, upload, strings.NewReader("abc"), uploadOffsetHeader, "0")
+	expect(t, resp, http.StatusNoContent)
+	if got := resp.Header.Get(uploadOffsetHeader); got != "3" {
+		t.Errorf("PATCH Upload-Offset = %s, want 3", got)
+	}
+
+	//Часть с неверного смещения отклоняется, загруженный объем можно узнать и продолжить
+	expect(t, s.do(t, token, http.MethodPatch, upload, strings.NewReader("def"), uploadOffsetHeader, "0"), http.StatusConflict)
+	resp = s.do(t, token, http.MethodHead, upload, nil)
+	expect(t, resp, http.StatusOK)
+	if resp.Header.Get(uploadOffsetHeader) != "3" || resp.Header.Get(uploadLengthHeader) != "6" {
+		t.Errorf("HEAD = offset %s of %s, want 3 of 6", resp.Header.Get(uploadOffsetHeader), resp.Header.Get(uploadLengthHeader))
+	}
+
+	expect(t, s.do(t, token, http.MethodPatch, upload, strings.NewReader("defg"), uploadOffsetHeader, "3"),
+		http.StatusRequestEntityTooLarge)
+
+	resp = s.do(t, token, http.MethodPatch, upload, strings.NewReader("def"), uploadOffsetHeader, "3")
+	expect(t, resp, http.StatusNoContent)
+	if got := resp.Header.Get("ETag"); got != `"1"` {
+		t.Errorf("final PATCH ETag = %s, want \"1\"", got)
+	}
+	if body := expect(t, s.do(t, token, http.MethodGet, "/api/data/file", nil), http.StatusOK); body != "abcdef" {
+		t.Errorf("GET = %q, want abcdef", body)
+	}
+	expect(t, s.do(t, token, http.MethodHead, upload, nil), http.StatusNotFound)
+}
+
+// TestUploadSlowBody проверяет, что загрузка завершается, даже если тело последней части
+// передавалось дольше общего ограничения времени запроса
+func TestUploadSlowBody(t *testing.T) {
+	if testing.Short() {
+		t.Skip("slow body takes longer than request deadline")
+	}
+
+	s := newSQLiteServer(t, Limits{})
+	_, token := s.user(t, "alice")
+
+	upload := createUpload(t, s, token, "video", "5")
+
+	body := &slowReader{r: strings.NewReader("slow!"), delay: 2500 * time.Millisecond}
+	resp := s.do(t, token, http.MethodPatch, upload, body, uploadOffsetHeader, "0")
+	expect(t, resp, http.StatusNoContent)
+	if resp.Header.Get(uploadOffsetHeader) != "5" || resp.Header.Get("ETag") != `"1"` {
+		t.Errorf("PATCH = offset %s, ETag %s, want 5, \"1\"", resp.Header.Get(uploadOffsetHeader), resp.Header.Get("ETag"))
+	}
+
+	if got := expect(t, s.do(t, token, http.MethodGet, "/api/data/video", nil), http.StatusOK); got != "slow!" {
+		t.Errorf("GET = %q, want slow!", got)
+	}
+}
@@ -0,0 +1,202 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+// attach загружает вложение name данных dataId и возвращает ошибку завершения загрузки,
+// загрузка, которую не удалось завершить, удаляется
+func attach(t *testing.T, ctx context.Context, s Storage, userId, dataId, name string, content []byte, createOnly bool) error {
+	t.Helper()
+
+	uploadId, err := s.CreateUpload(ctx, userId, Upload{
+		DataId:     dataId,
+		Size:       int64(len(content)),
+		CreateOnly: createOnly,
+		Attachment: name,
+		MimeType:   "text/plain",
+		Key:        []byte("key of " + name),
+	})
+	if err != nil {
+		t.Fatalf("CreateUpload() error = %v", err)
+	}
+	if _, err := s.AppendUpload(ctx, userId, uploadId, 0, bytes.NewReader(content)); err != nil {
+		t.Fatalf("AppendUpload() error = %v", err)
+	}
+
+	//Незавершенную загрузку удаляем, как клиент, иначе она занимает место
+	if _, err = s.CompleteUpload(ctx, userId, uploadId); err != nil {
+		if err := s.DeleteUpload(ctx, userId, uploadId); err != nil {
+			t.Fatalf("DeleteUpload() error = %v", err)
+		}
+	}
+	return err
+}
+
+// checkAttachment проверяет описание, ключ и содержимое вложения
+func checkAttachment(t *testing.T, ctx context.Context, s Storage, userId, dataId, name string, want []byte) {
+	t.Helper()
+
+	attachment, content, err := s.GetAttachment(ctx, userId, dataId, name)
+	if err != nil {
+		t.Fatalf("GetAttachment(%s, %s) error = %v", dataId, name, err)
+	}
+	if attachment.Name != name || attachment.MimeType != "text/plain" || attachment.Size != int64(len(want)) ||
+		!bytes.Equal(attachment.Key, []byte("key of "+name)) {
+		t.Errorf("GetAttachment(%s, %s) = %+v", dataId, name, attachment)
+	}
+
+	var buf bytes.Buffer
+	if err := s.WriteContent(ctx, content, &buf); err != nil {
+		t.Fatalf("WriteContent() error = %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("WriteContent(%s, %s) = %q, want %q", dataId, name, buf.Bytes(), want)
+	}
+}
+
+// usageBytes объем данных пользователя
+func usageBytes(t *testing.T, ctx context.Context, s Storage, userId string) int64 {
+	t.Helper()
+
+	usage, err := s.GetUsage(ctx, userId)
+	if err != nil {
+		t.Fatalf("GetUsage() error = %v", err)
+	}
+	return usage.Bytes
+}
+
+func TestStorageAttachments(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, ctx context.Context, s Storage, userId string) {
+		if err := s.AddData(ctx, userId, "vpn", []byte("data"), []byte("meta")); err != nil {
+			t.Fatalf("AddData() error = %v", err)
+		}
+		stored := usageBytes(t, ctx, s, userId)
+
+		if err := attach(t, ctx, s, userId, "vpn", "config.ovpn", []byte("first config"), true); err != nil {
+			t.Fatalf("attach() error = %v", err)
+		}
+		if err := attach(t, ctx, s, userId, "vpn", "ca.pem", []byte("ca"), true); err != nil {
+			t.Fatalf("attach() error = %v", err)
+		}
+
+		attachments, err := s.ListAttachments(ctx, userId, "vpn")
+		if err != nil {
+			t.Fatalf("ListAttachments() error = %v", err)
+		}
+		if len(attachments) != 2 || attachments[0].Name != "ca.pem" || attachments[1].Name != "config.ovpn" {
+			t.Fatalf("ListAttachments() = %+v, want ca.pem, config.ovpn", attachments)
+		}
+		for _, attachment := range attachments {
+			if attachment.Key != nil {
+				t.Errorf("ListAttachments() %s key = %q, want none", attachment.Name, attachment.Key)
+			}
+		}
+		if got := usageBytes(t, ctx, s, userId); got != stored+int64(len("first config")+len("ca")) {
+			t.Errorf("GetUsage() bytes = %d, want %d", got, stored+int64(len("first config")+len("ca")))
+		}
+
+		//Одноименное вложение заменяется, прежнее содержимое больше не занимает место
+		if err := attach(t, ctx, s, userId, "vpn", "config.ovpn", []byte("second"), true); !errors.Is(err, ErrAlreadyExist) {
+			t.Errorf("attach() create only over existing error = %v, want %v", err, ErrAlreadyExist)
+		}
+		if err := attach(t, ctx, s, userId, "vpn", "config.ovpn", []byte("second"), false); err != nil {
+			t.Fatalf("attach() replace error = %v", err)
+		}
+		checkAttachment(t, ctx, s, userId, "vpn", "config.ovpn", []byte("second"))
+		if attachments, _ := s.ListAttachments(ctx, userId, "vpn"); len(attachments) != 2 {
+			t.Errorf("ListAttachments() after replace = %+v, want 2", attachments)
+		}
+		if got := usageBytes(t, ctx, s, userId); got != stored+int64(len("second")+len("ca")) {
+			t.Errorf("GetUsage() bytes after replace = %d, want %d", got, stored+int64(len("second")+len("ca")))
+		}
+
+		//Вложение не меняет ревизию данных
+		entry, err := s.GetData(ctx, userId, "vpn")
+		if err != nil {
+			t.Fatalf("GetData() error = %v", err)
+		}
+		if entry.Revision != 1 {
+			t.Errorf("GetData() revision = %d, want 1", entry.Revision)
+		}
+
+		if err := s.DeleteAttachment(ctx, userId, "vpn", "config.ovpn"); err != nil {
+			t.Fatalf("DeleteAttachment() error = %v", err)
+		}
+		if _, _, err := s.GetAttachment(ctx, userId, "vpn", "config.ovpn"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetAttachment() deleted error = %v, want %v", err, ErrNotFound)
+		}
+		if err := s.DeleteAttachment(ctx, userId, "vpn", "config.ovpn"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("DeleteAttachment() twice error = %v, want %v", err, ErrNotFound)
+		}
+		if attachments, _ := s.ListAttachments(ctx, userId, "vpn"); len(attachments) != 1 || attachments[0].Name != "ca.pem" {
+			t.Errorf("ListAttachments() after delete = %+v, want ca.pem", attachments)
+		}
+		if got := usageBytes(t, ctx, s, userId); got != stored+int64(len("ca")) {
+			t.Errorf("GetUsage() bytes after delete = %d, want %d", got, stored+int64(len("ca")))
+		}
+
+		//Вложения есть только у существующих данных
+		if _, err := s.ListAttachments(ctx, userId, "missing"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("ListAttachments() of missing data error = %v, want %v", err, ErrNotFound)
+		}
+		if err := attach(t, ctx, s, userId, "missing", "a.txt", []byte("a"), false); !errors.Is(err, ErrNotFound) {
+			t.Errorf("attach() to missing data error = %v, want %v", err, ErrNotFound)
+		}
+	})
+}
+
+func TestStorageAttachmentsFollowData(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, ctx context.Context, s Storage, userId string) {
+		if err := s.AddData(ctx, userId, "vpn", []byte("data"), []byte("meta")); err != nil {
+			t.Fatalf("AddData() error = %v", err)
+		}
+		if err := attach(t, ctx, s, userId, "vpn", "config.ovpn", []byte("config"), false); err != nil {
+			t.Fatalf("attach() error = %v", err)
+		}
+		stored := usageBytes(t, ctx, s, userId)
+
+		//Перемещение переносит вложения под новый идентификатор
+		if err := s.MoveData(ctx, userId, "vpn", "work/vpn", 0); err != nil {
+			t.Fatalf("MoveData() error = %v", err)
+		}
+		checkAttachment(t, ctx, s, userId, "work/vpn", "config.ovpn", []byte("config"))
+		if _, err := s.ListAttachments(ctx, userId, "vpn"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("ListAttachments() of old identifier error = %v, want %v", err, ErrNotFound)
+		}
+
+		//Вложения удаленных данных недоступны, но занимают место, пока данные в корзине
+		if err := s.DeleteData(ctx, userId, "work/vpn", 0); err != nil {
+			t.Fatalf("DeleteData() error = %v", err)
+		}
+		if _, err := s.ListAttachments(ctx, userId, "work/vpn"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("ListAttachments() of deleted data error = %v, want %v", err, ErrNotFound)
+		}
+		if got := usageBytes(t, ctx, s, userId); got != stored {
+			t.Errorf("GetUsage() bytes in trash = %d, want %d", got, stored)
+		}
+
+		items, err := s.ListTrash(ctx, userId)
+		if err != nil || len(items) != 1 {
+			t.Fatalf("ListTrash() = %+v, %v, want one item", items, err)
+		}
+		if _, err := s.RestoreTrash(ctx, userId, items[0].Id); err != nil {
+			t.Fatalf("RestoreTrash() error = %v", err)
+		}
+		checkAttachment(t, ctx, s, userId, "work/vpn", "config.ovpn", []byte("config"))
+
+		//Окончательное удаление освобождает место вложений
+		if err := s.DeleteData(ctx, userId, "work/vpn", 0); err != nil {
+			t.Fatalf("DeleteData() error = %v", err)
+		}
+		if _, err := s.EmptyTrash(ctx, userId); err != nil {
+			t.Fatalf("EmptyTrash() error = %v", err)
+		}
+		if got := usageBytes(t, ctx, s, userId); got != 0 {
+			t.Errorf("GetUsage() bytes after empty trash = %d, want 0", got)
+		}
+	})
+}
@@ -0,0 +1,426 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"time"
+)
+
+// Архив резервной копии сервера - gzip с JSON записями по одной на строку: заголовок, строки таблиц
+// в порядке, допускающем вставку с внешними ключами, и завершающая запись с количеством записей
+// и SHA-256 всех предыдущих строк. Данные пользователей остаются зашифрованными клиентом.
+const (
+	backupFormat  = "go-keepass-server-backup"
+	backupVersion = 1
+)
+
+// Типы записей архива в порядке следования
+const (
+	backupHeaderType        = "header"
+	backupUserType          = "user"
+	backupBlobType          = "blob"
+	backupChunkType         = "chunk"
+	backupDataType          = "data"
+	backupRevisionType      = "revision"
+	backupShareType         = "share"
+	backupOrgType           = "organization"
+	backupMemberType        = "member"
+	backupCollectionType    = "collection"
+	backupCollectionKeyType = "collection_key"
+	backupFolderType        = "folder"
+	backupAttachmentType    = "attachment"
+	backupEndType           = "end"
+)
+
+// backupOrder порядок типов записей в архиве
+var backupOrder = []string{backupHeaderType, backupUserType, backupBlobType, backupChunkType, backupDataType, backupRevisionType, backupShareType,
+	backupOrgType, backupMemberType, backupCollectionType, backupCollectionKeyType, backupFolderType, backupAttachmentType,
+	backupEndType}
+
+// ErrBackupCorrupted возвращается, если архив поврежден, обрезан или не совпадает контрольная сумма
+var ErrBackupCorrupted = errors.New("backup is corrupted")
+
+// Backuper хранилище, которое можно выгрузить в архив и восстановить из архива
+type Backuper interface {
+	// Backup выгружает согласованный снимок хранилища в w. Незавершенные загрузки не выгружаются.
+	Backup(ctx context.Context, w io.Writer) (BackupStats, error)
+	// Restore загружает архив в пустое хранилище одной транзакцией: если архив поврежден,
+	// ничего не сохраняется
+	Restore(ctx context.Context, r io.Reader) (BackupStats, error)
+}
+
+// BackupStats количество записей архива по типам
+type BackupStats struct {
+	Users          int64 // пользователи
+	Data           int64 // данные, включая корзину
+	Revisions      int64 // предыдущие ревизии данных
+	Blobs          int64 // содержимое, загруженное по частям
+	Chunks         int64 // части содержимого
+	Shares         int64 // данные, переданные другим пользователям
+	Orgs           int64 // организации
+	Members        int64 // участники организаций
+	Collections    int64 // коллекции организаций
+	CollectionKeys int64 // ключи коллекций, зашифрованные для участников
+	Folders        int64 // папки, созданные явно
+	Attachments    int64 // вложения данных
+}
+
+type backupHeader struct {
+	Format    string    `json:"format"`
+	Version   int       `json:"version"`
+	Schema    int64     `json:"schema"` //Версия схемы базы, из которой сделан архив
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type backupUser struct {
+	Id         string `json:"id"`
+	Login      string `json:"login"`
+	Password   string `json:"password"` //Хэш пароля
+	ChangeSeq  int64  `json:"change_seq"`
+	PurgedSeq  int64  `json:"purged_seq"`
+	PublicKey  []byte `json:"public_key,omitempty"`
+	PrivateKey []byte `json:"private_key,omitempty"` //Закрытый ключ, зашифрованный клиентом
+}
+
+type backupBlob struct {
+	Id        string    `json:"id"`
+	UserId    string    `json:"user_id"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type backupChunk struct {
+	BlobId string `json:"blob_id"`
+	Start  int64  `json:"start"`
+	Data   []byte `json:"data"`
+}
+
+type backupData struct {
+	Id         string     `json:"id"`
+	UserId     string     `json:"user_id"`
+	DataId     string     `json:"data_id"`
+	Data       []byte     `json:"data"`
+	Metadata   []byte     `json:"metadata"`
+	BlobId     string     `json:"blob_id,omitempty"`
+	Revision   int64      `json:"revision"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	DeletedAt  *time.Time `json:"deleted_at,omitempty"`
+	ChangeSeq  int64      `json:"change_seq"`
+	CreatedSeq int64      `json:"created_seq"`
+	Origin     string     `json:"origin,omitempty"`
+	Moved      bool       `json:"moved,omitempty"`
+}
+
+type backupRevision struct {
+	DataId    string    `json:"data_id"`
+	Revision  int64     `json:"revision"`
+	Data      []byte    `json:"data"`
+	Metadata  []byte    `json:"metadata"`
+	BlobId    string    `json:"blob_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type backupShare struct {
+	Id          string    `json:"id"`
+	DataId      string    `json:"data_id"`
+	RecipientId string    `json:"recipient_id"`
+	WrappedKey  []byte    `json:"wrapped_key"`
+	Permission  string    `json:"permission"`
+	Accepted    bool      `json:"accepted"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type backupOrg struct {
+	Id        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type backupMember struct {
+	OrgId     string    `json:"org_id"`
+	UserId    string    `json:"user_id"`
+	Role      string    `json:"role"`
+	Accepted  bool      `json:"accepted"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type backupCollection struct {
+	Id         string    `json:"id"`
+	OrgId      string    `json:"org_id"`
+	Name       string    `json:"name"`
+	KeyVersion int64     `json:"key_version"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type backupCollectionKey struct {
+	CollectionId string `json:"collection_id"`
+	UserId       string `json:"user_id"`
+	Version      int64  `json:"version"`
+	WrappedKey   []byte `json:"wrapped_key"`
+}
+
+type backupFolder struct {
+	UserId    string    `json:"user_id"`
+	Path      string    `json:"path"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type backupAttachment struct {
+	DataId    string    `json:"data_id"`
+	Name      string    `json:"name"`
+	MimeType  string    `json:"mime_type"`
+	Key       []byte    `json:"key"` //Ключ вложения, зашифрованный клиентом
+	BlobId    string    `json:"blob_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type backupEnd struct {
+	Records int64  `json:"records"` //Количество записей без заголовка и завершающей записи
+	SHA256  string `json:"sha256"`  //Контрольная сумма всех предыдущих строк
+}
+
+// backupRecord строка архива, заполнено поле, соответствующее типу
+type backupRecord struct {
+	Type          string               `json:"type"`
+	Header        *backupHeader        `json:"header,omitempty"`
+	User          *backupUser          `json:"user,omitempty"`
+	Blob          *backupBlob          `json:"blob,omitempty"`
+	Chunk         *backupChunk         `json:"chunk,omitempty"`
+	Data          *backupData          `json:"data,omitempty"`
+	Revision      *backupRevision      `json:"revision,omitempty"`
+	Share         *backupShare         `json:"share,omitempty"`
+	Org           *backupOrg           `json:"organization,omitempty"`
+	Member        *backupMember        `json:"member,omitempty"`
+	Collection    *backupCollection    `json:"collection,omitempty"`
+	CollectionKey *backupCollectionKey `json:"collection_key,omitempty"`
+	Folder        *backupFolder        `json:"folder,omitempty"`
+	Attachment    *backupAttachment    `json:"attachment,omitempty"`
+	End           *backupEnd           `json:"end,omitempty"`
+}
+
+// count учитывает запись в статистике
+func (m *BackupStats) count(record backupRecord) {
+	switch record.Type {
+	case backupUserType:
+		m.Users++
+	case backupBlobType:
+		m.Blobs++
+	case backupChunkType:
+		m.Chunks++
+	case backupDataType:
+		m.Data++
+	case backupRevisionType:
+		m.Revisions++
+	case backupShareType:
+		m.Shares++
+	case backupOrgType:
+		m.Orgs++
+	case backupMemberType:
+		m.Members++
+	case backupCollectionType:
+		m.Collections++
+	case backupCollectionKeyType:
+		m.CollectionKeys++
+	case backupFolderType:
+		m.Folders++
+	case backupAttachmentType:
+		m.Attachments++
+	}
+}
+
+// records общее количество записей
+func (m *BackupStats) records() int64 {
+	return m.Users + m.Blobs + m.Chunks + m.Data + m.Revisions + m.Shares + m.Orgs + m.Members + m.Collections + m.CollectionKeys +
+		m.Folders + m.Attachments
+}
+
+// backupWriter пишет записи архива и считает контрольную сумму
+type backupWriter struct {
+	w     *gzip.Writer
+	hash  hash.Hash
+	stats BackupStats
+}
+
+func newBackupWriter(w io.Writer, schema int64) (*backupWriter, error) {
+	bw := &backupWriter{w: gzip.NewWriter(w), hash: sha256.New()}
+	header := &backupHeader{Format: backupFormat, Version: backupVersion, Schema: schema, CreatedAt: time.Now().UTC()}
+	if err := bw.write(backupRecord{Type: backupHeaderType, Header: header}); err != nil {
+		return nil, err
+	}
+	return bw, nil
+}
+
+func (m *backupWriter) write(record backupRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("cannot marshal backup record: %w", err)
+	}
+	line = append(line, '\n')
+
+	m.hash.Write(line)
+	if _, err := m.w.Write(line); err != nil {
+		return fmt.Errorf("cannot write backup: %w", err)
+	}
+
+	m.stats.count(record)
+	return nil
+}
+
+// close дописывает завершающую запись и завершает сжатый поток
+func (m *backupWriter) close() (BackupStats, error) {
+	end := &backupEnd{Records: m.stats.records(), SHA256: hex.EncodeToString(m.hash.Sum(nil))}
+
+	line, err := json.Marshal(backupRecord{Type: backupEndType, End: end})
+	if err != nil {
+		return m.stats, fmt.Errorf("cannot marshal backup record: %w", err)
+	}
+	if _, err := m.w.Write(append(line, '\n')); err != nil {
+		return m.stats, fmt.Errorf("cannot write backup: %w", err)
+	}
+	if err := m.w.Close(); err != nil {
+		return m.stats, fmt.Errorf("cannot write backup: %w", err)
+	}
+
+	return m.stats, nil
+}
+
+// readBackup читает архив и передает restore каждую запись таблицы. Заголовок, порядок записей,
+// их количество и контрольная сумма проверяются; ошибка означает, что переданным записям доверять нельзя.
+// schema - последняя известная версия схемы, архивы более новых версий не читаются.
+func readBackup(r io.Reader, schema int64, restore func(record backupRecord) error) (BackupStats, error) {
+	var stats BackupStats
+
+	unzipped, err := gzip.NewReader(r)
+	if err != nil {
+		return stats, fmt.Errorf("not a server backup: %w", err)
+	}
+
+	reader := bufio.NewReader(unzipped)
+	sum := sha256.New()
+	order := 0
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(line) == 0 {
+				return stats, fmt.Errorf("end record is missing: %w", ErrBackupCorrupted)
+			}
+			return stats, fmt.Errorf("last line is incomplete: %w", ErrBackupCorrupted)
+		}
+		if err != nil {
+			return stats, fmt.Errorf("cannot read backup: %w: %w", err, ErrBackupCorrupted)
+		}
+
+		var record backupRecord
+		decoder := json.NewDecoder(bytes.NewReader(line))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&record); err != nil {
+			return stats, fmt.Errorf("bad record %d: %w", stats.records()+1, ErrBackupCorrupted)
+		}
+
+		//Тип записи не может идти раньше предыдущего, заголовок - только первым
+		next := order
+		for next < len(backupOrder) && backupOrder[next] != record.Type {
+			next++
+		}
+		if next == len(backupOrder) || (order == 0) != (record.Type == backupHeaderType) || !record.valid() {
+			return stats, fmt.Errorf("unexpected %q record after %q: %w", record.Type, backupOrder[order], ErrBackupCorrupted)
+		}
+		if record.Type == backupHeaderType {
+			next = 1
+		}
+		order = next
+
+		switch record.Type {
+		case backupHeaderType:
+			header := record.Header
+			if header.Format != backupFormat {
+				return stats, fmt.Errorf("not a server backup")
+			}
+			if header.Version != backupVersion {
+				return stats, fmt.Errorf("unsupported backup version %d", header.Version)
+			}
+			if header.Schema > schema {
+				return stats, fmt.Errorf("backup schema version %d is newer than server schema version %d", header.Schema, schema)
+			}
+		case backupEndType:
+			if record.End.Records != stats.records() || record.End.SHA256 != hex.EncodeToString(sum.Sum(nil)) {
+				return stats, fmt.Errorf("checksum mismatch: %w", ErrBackupCorrupted)
+			}
+			//Дочитываем поток до конца, чтобы gzip проверил свою контрольную сумму
+			if n, err := io.Copy(io.Discard, reader); n > 0 || err != nil {
+				return stats, fmt.Errorf("data after end record: %w", ErrBackupCorrupted)
+			}
+			return stats, nil
+		default:
+			if err := restore(record); err != nil {
+				return stats, err
+			}
+		}
+
+		sum.Write(line)
+		stats.count(record)
+	}
+}
+
+// valid проверяет, что заполнено поле, соответствующее типу записи
+func (m *backupRecord) valid() bool {
+	filled := map[string]bool{
+		backupHeaderType:        m.Header != nil,
+		backupUserType:          m.User != nil,
+		backupBlobType:          m.Blob != nil,
+		backupChunkType:         m.Chunk != nil,
+		backupDataType:          m.Data != nil,
+		backupRevisionType:      m.Revision != nil,
+		backupShareType:         m.Share != nil,
+		backupOrgType:           m.Org != nil,
+		backupMemberType:        m.Member != nil,
+		backupCollectionType:    m.Collection != nil,
+		backupCollectionKeyType: m.CollectionKey != nil,
+		backupFolderType:        m.Folder != nil,
+		backupAttachmentType:    m.Attachment != nil,
+		backupEndType:           m.End != nil,
+	}
+
+	count := 0
+	for _, set := range filled {
+		if set {
+			count++
+		}
+	}
+
+	return count == 1 && filled[m.Type]
+}
+
+// VerifyBackup читает архив целиком и проверяет его, ничего не сохраняя
+func VerifyBackup(r io.Reader) (BackupStats, error) {
+	schema, err := latestSchema()
+	if err != nil {
+		return BackupStats{}, err
+	}
+
+	return readBackup(r, schema, func(backupRecord) error { return nil })
+}
+
+// latestSchema последняя версия схемы, известная серверу. Версии миграций всех диалектов совпадают.
+func latestSchema() (int64, error) {
+	migrations, err := loadMigrations(postgresDialect.name)
+	if err != nil {
+		return 0, err
+	}
+	if len(migrations) == 0 {
+		return 0, nil
+	}
+
+	return migrations[len(migrations)-1].Version, nil
+}
@@ -0,0 +1,301 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/lionslon/go-keepass/internal/models"
+	"io"
+	"strings"
+	"testing"
+)
+
+// newBackupStorage создает пустое хранилище SQLite, которое умеет выгружать и загружать архив
+func newBackupStorage(t *testing.T) *KeeperStorage {
+	t.Helper()
+	return testStorages["sqlite"](t).(*KeeperStorage)
+}
+
+// fillBackupStorage сохраняет в хранилище записи всех типов архива
+func fillBackupStorage(t *testing.T, ctx context.Context, s Storage) {
+	t.Helper()
+
+	alice, err := s.CreateUser(ctx, models.AuthDTO{Login: "alice", Password: "password"})
+	if err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	bob, err := s.CreateUser(ctx, models.AuthDTO{Login: "bob", Password: "password"})
+	if err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	for _, userId := range []string{alice, bob} {
+		if err := s.SetUserKeys(ctx, userId, models.UserKeys{PublicKey: []byte("public " + userId), PrivateKey: []byte("private")}); err != nil {
+			t.Fatalf("SetUserKeys() error = %v", err)
+		}
+	}
+
+	if err := s.AddData(ctx, alice, "work/mail", []byte("v1"), []byte("m1")); err != nil {
+		t.Fatalf("AddData() error = %v", err)
+	}
+	if _, err := s.UpdateData(ctx, alice, "work/mail", []byte("v2"), nil, 0); err != nil {
+		t.Fatalf("UpdateData() error = %v", err)
+	}
+	if err := s.AddData(ctx, alice, "old", []byte("old"), nil); err != nil {
+		t.Fatalf("AddData() error = %v", err)
+	}
+	if err := s.DeleteData(ctx, alice, "old", 0); err != nil {
+		t.Fatalf("DeleteData() error = %v", err)
+	}
+	if err := s.CreateFolder(ctx, alice, "empty"); err != nil {
+		t.Fatalf("CreateFolder() error = %v", err)
+	}
+
+	//Содержимое, загруженное частями, и вложение
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	for _, upload := range []Upload{
+		{DataId: "video", Size: int64(len(content))},
+		{DataId: "video", Size: int64(len(content)), Attachment: "scan.pdf", MimeType: "application/pdf", Key: []byte("key")},
+	} {
+		uploadId, err := s.CreateUpload(ctx, alice, upload)
+		if err != nil {
+			t.Fatalf("CreateUpload() error = %v", err)
+		}
+		if _, err := s.AppendUpload(ctx, alice, uploadId, 0, bytes.NewReader(content[:4000])); err != nil {
+			t.Fatalf("AppendUpload() error = %v", err)
+		}
+		if _, err := s.AppendUpload(ctx, alice, uploadId, 4000, bytes.NewReader(content[4000:])); err != nil {
+			t.Fatalf("AppendUpload() error = %v", err)
+		}
+		if _, err := s.CompleteUpload(ctx, alice, uploadId); err != nil {
+			t.Fatalf("CompleteUpload() error = %v", err)
+		}
+	}
+
+	//Незавершенная загрузка в архив не попадает
+	if _, err := s.CreateUpload(ctx, alice, Upload{DataId: "abandoned", Size: 100}); err != nil {
+		t.Fatalf("CreateUpload() error = %v", err)
+	}
+
+	if _, err := s.ShareData(ctx, alice, "work/mail", models.ShareRequest{Recipient: "bob", Key: []byte("wrapped"), Permission: models.ShareRead}); err != nil {
+		t.Fatalf("ShareData() error = %v", err)
+	}
+
+	org, err := s.CreateOrganization(ctx, alice, "team")
+	if err != nil {
+		t.Fatalf("CreateOrganization() error = %v", err)
+	}
+	collection, err := s.CreateCollection(ctx, org.Id, models.CollectionRequest{
+		Name: "infra",
+		Keys: []models.CollectionKey{{Login: "alice", Key: []byte("collection key")}},
+	})
+	if err != nil {
+		t.Fatalf("CreateCollection() error = %v", err)
+	}
+	_, err = s.InviteMember(ctx, org.Id, models.InviteRequest{
+		Login: "bob",
+		Role:  models.RoleMember,
+		Keys:  []models.CollectionKey{{Collection: collection.Id, Version: collection.KeyVersion, Key: []byte("collection key")}},
+	})
+	if err != nil {
+		t.Fatalf("InviteMember() error = %v", err)
+	}
+}
+
+// backupLines распаковывает архив в строки таблиц: время создания в заголовке у архивов разное,
+// поэтому заголовок и завершающая запись с контрольной суммой не сравниваются
+func backupLines(t *testing.T, archive []byte) []string {
+	t.Helper()
+
+	unzipped, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatalf("gzip.NewReader() error = %v", err)
+	}
+	content, err := io.ReadAll(unzipped)
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+	return lines[1 : len(lines)-1]
+}
+
+// rewriteBackup распаковывает архив, меняет его содержимое и сжимает снова
+func rewriteBackup(t *testing.T, archive []byte, change func(content string) string) []byte {
+	t.Helper()
+
+	unzipped, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatalf("gzip.NewReader() error = %v", err)
+	}
+	content, err := io.ReadAll(unzipped)
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+
+	var buf bytes.Buffer
+	zipped := gzip.NewWriter(&buf)
+	zipped.Write([]byte(change(string(content))))
+	zipped.Close()
+
+	return buf.Bytes()
+}
+
+func TestBackupRestore(t *testing.T) {
+	ctx := context.Background()
+
+	source := newBackupStorage(t)
+	fillBackupStorage(t, ctx, source)
+
+	var archive bytes.Buffer
+	stats, err := source.Backup(ctx, &archive)
+	if err != nil {
+		t.Fatalf("Backup() error = %v", err)
+	}
+	//Данные коллекции хранятся у отдельного пользователя коллекции
+	want := BackupStats{Users: 3, Data: 3, Revisions: 1, Blobs: 2, Chunks: 4, Shares: 1, Orgs: 1, Members: 2, Collections: 1,
+		CollectionKeys: 2, Folders: 1, Attachments: 1}
+	if stats != want {
+		t.Errorf("Backup() = %+v, want %+v", stats, want)
+	}
+
+	if verified, err := VerifyBackup(bytes.NewReader(archive.Bytes())); err != nil || verified != stats {
+		t.Errorf("VerifyBackup() = %+v, %v, want %+v", verified, err, stats)
+	}
+
+	target := newBackupStorage(t)
+	restored, err := target.Restore(ctx, bytes.NewReader(archive.Bytes()))
+	if err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if restored != stats {
+		t.Errorf("Restore() = %+v, want %+v", restored, stats)
+	}
+
+	//Архив восстановленного хранилища совпадает с исходным
+	var again bytes.Buffer
+	if _, err := target.Backup(ctx, &again); err != nil {
+		t.Fatalf("Backup() restored error = %v", err)
+	}
+	got, expected := backupLines(t, again.Bytes()), backupLines(t, archive.Bytes())
+	if len(got) != len(expected) {
+		t.Fatalf("restored backup = %d lines, want %d", len(got), len(expected))
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("restored backup line %d = %s, want %s", i+1, got[i], expected[i])
+		}
+	}
+
+	//Восстановленные пользователи входят с прежним паролем и читают содержимое
+	alice, err := target.Login(ctx, models.AuthDTO{Login: "alice", Password: "password"})
+	if err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+	entry, err := target.GetData(ctx, alice, "video")
+	if err != nil {
+		t.Fatalf("GetData() error = %v", err)
+	}
+	var content bytes.Buffer
+	if err := target.WriteContent(ctx, entry, &content); err != nil {
+		t.Fatalf("WriteContent() error = %v", err)
+	}
+	if !bytes.Equal(content.Bytes(), bytes.Repeat([]byte("0123456789"), 1000)) {
+		t.Errorf("WriteContent() = %d bytes, want uploaded content", content.Len())
+	}
+}
+
+func TestRestoreRejectsCorrupted(t *testing.T) {
+	ctx := context.Background()
+
+	source := newBackupStorage(t)
+	fillBackupStorage(t, ctx, source)
+
+	var buf bytes.Buffer
+	stats, err := source.Backup(ctx, &buf)
+	if err != nil {
+		t.Fatalf("Backup() error = %v", err)
+	}
+	archive := buf.Bytes()
+
+	flipped := bytes.Clone(archive)
+	flipped[len(flipped)/2] ^= 0x01
+
+	tests := []struct {
+		name    string
+		archive []byte
+	}{
+		{"truncated", archive[:len(archive)/2]},
+		{"truncated before end record", rewriteBackup(t, archive, func(content string) string {
+			lines := strings.SplitAfter(content, "\n")
+			return strings.Join(lines[:len(lines)-2], "")
+		})},
+		{"flipped byte", flipped},
+		{"flipped byte in record", rewriteBackup(t, archive, func(content string) string {
+			return strings.Replace(content, `"login":"bob"`, `"login":"bot"`, 1)
+		})},
+		{"wrong end record count", rewriteBackup(t, archive, func(content string) string {
+			records := fmt.Sprintf(`"records":%d`, stats.records())
+			return strings.Replace(content, records, records+`1`, 1)
+		})},
+		{"records reordered", rewriteBackup(t, archive, func(content string) string {
+			lines := strings.SplitAfter(content, "\n")
+			lines[1], lines[2] = lines[2], lines[1]
+			return strings.Join(lines, "")
+		})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if bytes.Equal(tt.archive, archive) {
+				t.Fatal("archive is not changed")
+			}
+
+			if _, err := VerifyBackup(bytes.NewReader(tt.archive)); !errors.Is(err, ErrBackupCorrupted) {
+				t.Errorf("VerifyBackup() error = %v, want %v", err, ErrBackupCorrupted)
+			}
+
+			//Поврежденный архив не оставляет в хранилище ничего
+			target := newBackupStorage(t)
+			if _, err := target.Restore(ctx, bytes.NewReader(tt.archive)); !errors.Is(err, ErrBackupCorrupted) {
+				t.Errorf("Restore() error = %v, want %v", err, ErrBackupCorrupted)
+			}
+			if target.IsUserExist(ctx, "alice") {
+				t.Error("IsUserExist() after failed restore = true, want false")
+			}
+		})
+	}
+}
+
+func TestRestoreRequiresEmptyStorage(t *testing.T) {
+	ctx := context.Background()
+
+	source := newBackupStorage(t)
+	fillBackupStorage(t, ctx, source)
+
+	var archive bytes.Buffer
+	if _, err := source.Backup(ctx, &archive); err != nil {
+		t.Fatalf("Backup() error = %v", err)
+	}
+
+	target := newBackupStorage(t)
+	userId, err := target.CreateUser(ctx, models.AuthDTO{Login: "carol", Password: "password"})
+	if err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	if err := target.AddData(ctx, userId, "mail", []byte("v1"), nil); err != nil {
+		t.Fatalf("AddData() error = %v", err)
+	}
+
+	if _, err := target.Restore(ctx, bytes.NewReader(archive.Bytes())); err == nil {
+		t.Fatal("Restore() into non-empty storage error = nil, want error")
+	}
+
+	if target.IsUserExist(ctx, "alice") {
+		t.Error("IsUserExist() restored user = true, want false")
+	}
+	if _, err := target.GetData(ctx, userId, "mail"); err != nil {
+		t.Errorf("GetData() existing data error = %v", err)
+	}
+}
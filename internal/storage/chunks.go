@@ -0,0 +1,36 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// chunkSize размер части содержимого, сохраняемой одной записью
+const chunkSize = 1 << 20
+
+// writeChunks читает r частями по chunkSize и передает write каждую часть вместе с ее смещением,
+// начиная с offset. Содержимое сверх size не принимается. Буфер части переиспользуется.
+// Возвращает смещение после последней сохраненной части.
+func writeChunks(r io.Reader, offset, size int64, write func(start int64, chunk []byte) error) (int64, error) {
+	buf := make([]byte, chunkSize)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			if offset+int64(n) > size {
+				return offset, fmt.Errorf("%d bytes after offset %d of %d: %w", n, offset, size, ErrUploadTooLarge)
+			}
+			if err := write(offset, buf[:n]); err != nil {
+				return offset, err
+			}
+			offset += int64(n)
+		}
+
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return offset, nil
+		}
+		if err != nil {
+			return offset, fmt.Errorf("cannot read upload content: %w", err)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestStorageRevisions(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, ctx context.Context, s Storage, userId string) {
+		if err := s.AddData(ctx, userId, "mail", []byte("v1"), []byte("m1")); err != nil {
+			t.Fatalf("AddData() error = %v", err)
+		}
+		if err := s.AddData(ctx, userId, "mail", []byte("v1"), nil); !errors.Is(err, ErrAlreadyExist) {
+			t.Errorf("AddData() existing error = %v, want %v", err, ErrAlreadyExist)
+		}
+
+		revision, err := s.UpdateData(ctx, userId, "mail", []byte("v2"), nil, 0)
+		if err != nil {
+			t.Fatalf("UpdateData() error = %v", err)
+		}
+		if revision != 2 {
+			t.Errorf("UpdateData() revision = %d, want 2", revision)
+		}
+
+		entry, err := s.GetData(ctx, userId, "mail")
+		if err != nil {
+			t.Fatalf("GetData() error = %v", err)
+		}
+		if entry.Revision != 2 || !bytes.Equal(entry.Data, []byte("v2")) || !bytes.Equal(entry.Metadata, []byte("m1")) {
+			t.Errorf("GetData() = revision %d, data %q, metadata %q, want 2, v2, m1", entry.Revision, entry.Data, entry.Metadata)
+		}
+
+		revisions, err := s.GetDataRevisions(ctx, userId, "mail")
+		if err != nil {
+			t.Fatalf("GetDataRevisions() error = %v", err)
+		}
+		if len(revisions) != 2 {
+			t.Errorf("GetDataRevisions() = %d revisions, want 2", len(revisions))
+		}
+
+		//Предыдущая ревизия остается в истории без изменений
+		previous, err := s.GetDataRevision(ctx, userId, "mail", 1)
+		if err != nil {
+			t.Fatalf("GetDataRevision() error = %v", err)
+		}
+		if previous.Revision != 1 || !bytes.Equal(previous.Data, []byte("v1")) || !bytes.Equal(previous.Metadata, []byte("m1")) {
+			t.Errorf("GetDataRevision() = revision %d, data %q, metadata %q, want 1, v1, m1", previous.Revision, previous.Data, previous.Metadata)
+		}
+		if _, err := s.GetDataRevision(ctx, userId, "mail", 3); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetDataRevision() missing error = %v, want %v", err, ErrNotFound)
+		}
+
+		if _, err := s.UpdateData(ctx, userId, "missing", []byte("v1"), nil, 0); !errors.Is(err, ErrNotFound) {
+			t.Errorf("UpdateData() missing error = %v, want %v", err, ErrNotFound)
+		}
+	})
+}
+
+func TestStorageRevisionMismatch(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, ctx context.Context, s Storage, userId string) {
+		if err := s.AddData(ctx, userId, "mail", []byte("v1"), []byte("m1")); err != nil {
+			t.Fatalf("AddData() error = %v", err)
+		}
+		revision, err := s.UpdateData(ctx, userId, "mail", []byte("v2"), nil, 1)
+		if err != nil {
+			t.Fatalf("UpdateData() error = %v", err)
+		}
+		if revision != 2 {
+			t.Errorf("UpdateData() revision = %d, want 2", revision)
+		}
+
+		//Изменения с устаревшей ревизией, как запрос с If-Match на старый ETag
+		stale := map[string]func() error{
+			"UpdateData": func() error {
+				_, err := s.UpdateData(ctx, userId, "mail", []byte("v3"), nil, 1)
+				return err
+			},
+			"UpdateMetadata": func() error {
+				_, err := s.UpdateMetadata(ctx, userId, "mail", []byte("m3"), 1)
+				return err
+			},
+			"DeleteData": func() error {
+				return s.DeleteData(ctx, userId, "mail", 1)
+			},
+		}
+		for name, change := range stale {
+			if err := change(); !errors.Is(err, ErrRevisionMismatch) {
+				t.Errorf("%s() stale error = %v, want %v", name, err, ErrRevisionMismatch)
+			}
+		}
+
+		entry, err := s.GetData(ctx, userId, "mail")
+		if err != nil {
+			t.Fatalf("GetData() error = %v", err)
+		}
+		if entry.Revision != 2 || !bytes.Equal(entry.Data, []byte("v2")) || !bytes.Equal(entry.Metadata, []byte("m1")) {
+			t.Errorf("GetData() = revision %d, data %q, metadata %q, want 2, v2, m1", entry.Revision, entry.Data, entry.Metadata)
+		}
+
+		if _, err := s.UpdateMetadata(ctx, userId, "mail", []byte("m3"), 2); err != nil {
+			t.Errorf("UpdateMetadata() current revision error = %v", err)
+		}
+		if err := s.DeleteData(ctx, userId, "mail", 3); err != nil {
+			t.Errorf("DeleteData() current revision error = %v", err)
+		}
+	})
+}
+
+func TestStorageListPages(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, ctx context.Context, s Storage, userId string) {
+		//Размер данных задан в обратном порядке идентификаторов
+		for i, dataId := range []string{"a", "b", "c", "d", "e"} {
+			if err := s.AddData(ctx, userId, dataId, bytes.Repeat([]byte("x"), 5-i), nil); err != nil {
+				t.Fatalf("AddData() error = %v", err)
+			}
+		}
+
+		identifiers := func(opts ListOptions) ([]string, int64) {
+			t.Helper()
+			infos, total, err := s.ListData(ctx, userId, opts)
+			if err != nil {
+				t.Fatalf("ListData(%+v) error = %v", opts, err)
+			}
+			if infos == nil {
+				t.Errorf("ListData(%+v) = nil, want empty page", opts)
+			}
+			ids := make([]string, 0, len(infos))
+			for _, info := range infos {
+				ids = append(ids, info.Identifier)
+			}
+			return ids, total
+		}
+
+		tests := []struct {
+			name string
+			opts ListOptions
+			want string
+		}{
+			{"first page", ListOptions{Sort: SortByIdentifier, Limit: 2}, "a,b"},
+			{"middle page", ListOptions{Sort: SortByIdentifier, Limit: 2, Offset: 2}, "c,d"},
+			{"last page", ListOptions{Sort: SortByIdentifier, Limit: 2, Offset: 4}, "e"},
+			{"page after last", ListOptions{Sort: SortByIdentifier, Limit: 2, Offset: 5}, ""},
+			{"far after last", ListOptions{Sort: SortByIdentifier, Limit: 2, Offset: 100}, ""},
+			{"descending", ListOptions{Sort: SortByIdentifier, Desc: true, Limit: 3}, "e,d,c"},
+			{"by size", ListOptions{Sort: SortBySize, Limit: 10}, "e,d,c,b,a"},
+			{"by size descending", ListOptions{Sort: SortBySize, Desc: true, Limit: 2, Offset: 3}, "d,e"},
+			{"unknown sort", ListOptions{Sort: "color", Limit: 10}, "a,b,c,d,e"},
+		}
+		for _, tt := range tests {
+			ids, total := identifiers(tt.opts)
+			if got := strings.Join(ids, ","); got != tt.want {
+				t.Errorf("ListData() %s = %q, want %q", tt.name, got, tt.want)
+			}
+			if total != 5 {
+				t.Errorf("ListData() %s total = %d, want 5", tt.name, total)
+			}
+		}
+
+		//Удаленные данные в список не попадают
+		if err := s.DeleteData(ctx, userId, "a", 0); err != nil {
+			t.Fatalf("DeleteData() error = %v", err)
+		}
+		if ids, total := identifiers(ListOptions{Limit: 10}); strings.Join(ids, ",") != "b,c,d,e" || total != 4 {
+			t.Errorf("ListData() after delete = %v, %d, want b,c,d,e of 4", ids, total)
+		}
+	})
+}
@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"github.com/lionslon/go-keepass/internal/models"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// folderPrefix префикс идентификаторов данных в папке folder, для корня - пустой
+func folderPrefix(folder string) string {
+	if folder == `` {
+		return ``
+	}
+	return folder + models.FolderSeparator
+}
+
+// prefixLength длина префикса в символах, как ее считает substr в SQL
+func prefixLength(prefix string) int {
+	return utf8.RuneCountInString(prefix)
+}
+
+// movedOrigin идентификатор, от которого получен ключ данных dataId с исходным идентификатором origin,
+// после перемещения в to. Данные, вернувшиеся под исходный идентификатор, снова его не хранят.
+func movedOrigin(dataId string, origin string, to string) string {
+	if origin == `` {
+		origin = dataId
+	}
+	if origin == to {
+		return ``
+	}
+	return origin
+}
+
+// collectFolders собирает папки, созданные явно (explicit) и следующие из идентификаторов данных:
+// каждая папка вместе со всеми родительскими. Entries - количество данных в папке и вложенных папках.
+func collectFolders(explicit []string, identifiers []string) []models.Folder {
+	entries := make(map[string]int64)
+
+	addFolder := func(path string, count int64) {
+		for ; path != ``; path = models.ParentFolder(path) {
+			entries[path] += count
+		}
+	}
+
+	for _, path := range explicit {
+		addFolder(path, 0)
+	}
+	for _, dataId := range identifiers {
+		addFolder(models.ParentFolder(dataId), 1)
+	}
+
+	folders := make([]models.Folder, 0, len(entries))
+	for path, count := range entries {
+		folders = append(folders, models.Folder{Path: path, Entries: count})
+	}
+	slices.SortFunc(folders, func(a, b models.Folder) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+
+	return folders
+}
@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestStorageMoveFolder(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, ctx context.Context, s Storage, userId string) {
+		for _, dataId := range []string{"work/mail", "work/vpn/office", "home/mail"} {
+			if err := s.AddData(ctx, userId, dataId, []byte(dataId), nil); err != nil {
+				t.Fatalf("AddData(%s) error = %v", dataId, err)
+			}
+		}
+		if _, err := s.UpdateData(ctx, userId, "work/mail", []byte("work/mail v2"), nil, 0); err != nil {
+			t.Fatalf("UpdateData() error = %v", err)
+		}
+
+		if _, err := s.MoveFolder(ctx, userId, "work", "home"); !errors.Is(err, ErrAlreadyExist) {
+			t.Errorf("MoveFolder() onto existing folder error = %v, want %v", err, ErrAlreadyExist)
+		}
+
+		moved, err := s.MoveFolder(ctx, userId, "work", "archive/work")
+		if err != nil {
+			t.Fatalf("MoveFolder() error = %v", err)
+		}
+		if moved != 2 {
+			t.Errorf("MoveFolder() = %d, want 2", moved)
+		}
+
+		//Перемещение не меняет ревизию, а ключ данных по-прежнему получается из прежнего идентификатора
+		for from, want := range map[string]Entry{
+			"work/mail":       {Data: []byte("work/mail v2"), Revision: 2},
+			"work/vpn/office": {Data: []byte("work/vpn/office"), Revision: 1},
+		} {
+			to := "archive/" + from
+			entry, err := s.GetData(ctx, userId, to)
+			if err != nil {
+				t.Fatalf("GetData(%s) error = %v", to, err)
+			}
+			if entry.Origin != from || entry.Revision != want.Revision || !bytes.Equal(entry.Data, want.Data) {
+				t.Errorf("GetData(%s) = origin %q, revision %d, data %q, want %q, %d, %q",
+					to, entry.Origin, entry.Revision, entry.Data, from, want.Revision, want.Data)
+			}
+
+			if _, err := s.GetData(ctx, userId, from); !errors.Is(err, ErrNotFound) {
+				t.Errorf("GetData(%s) after move error = %v, want %v", from, err, ErrNotFound)
+			}
+		}
+
+		//Повторное перемещение сохраняет исходный идентификатор ключа
+		if err := s.MoveData(ctx, userId, "archive/work/mail", "mail", 0); err != nil {
+			t.Fatalf("MoveData() error = %v", err)
+		}
+		entry, err := s.GetData(ctx, userId, "mail")
+		if err != nil {
+			t.Fatalf("GetData() error = %v", err)
+		}
+		if entry.Origin != "work/mail" {
+			t.Errorf("GetData() origin = %q, want %q", entry.Origin, "work/mail")
+		}
+
+		if err := s.MoveData(ctx, userId, "mail", "post", 1); !errors.Is(err, ErrRevisionMismatch) {
+			t.Errorf("MoveData() stale error = %v, want %v", err, ErrRevisionMismatch)
+		}
+		if err := s.MoveData(ctx, userId, "mail", "home/mail", 0); !errors.Is(err, ErrAlreadyExist) {
+			t.Errorf("MoveData() onto existing data error = %v, want %v", err, ErrAlreadyExist)
+		}
+	})
+}
+
+func TestStorageRekeyData(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, ctx context.Context, s Storage, userId string) {
+		if err := s.AddData(ctx, userId, "vpn", []byte("data"), nil); err != nil {
+			t.Fatalf("AddData() error = %v", err)
+		}
+		if _, err := s.UpdateData(ctx, userId, "vpn", []byte("data v2"), nil, 0); err != nil {
+			t.Fatalf("UpdateData() error = %v", err)
+		}
+		before, err := s.GetChanges(ctx, userId, 0)
+		if err != nil {
+			t.Fatalf("GetChanges() error = %v", err)
+		}
+
+		if err := s.RekeyData(ctx, userId, "vpn", "vpn#1", 1); !errors.Is(err, ErrRevisionMismatch) {
+			t.Errorf("RekeyData() stale revision error = %v, want %v", err, ErrRevisionMismatch)
+		}
+		if err := s.RekeyData(ctx, userId, "missing", "missing#1", 0); !errors.Is(err, ErrNotFound) {
+			t.Errorf("RekeyData() missing data error = %v, want %v", err, ErrNotFound)
+		}
+		if err := s.RekeyData(ctx, userId, "vpn", "vpn#1", 2); err != nil {
+			t.Fatalf("RekeyData() error = %v", err)
+		}
+
+		//Смена ключа не меняет ревизию и содержимое, прежние ревизии видны с новым исходным идентификатором
+		entry, err := s.GetData(ctx, userId, "vpn")
+		if err != nil {
+			t.Fatalf("GetData() error = %v", err)
+		}
+		if entry.Origin != "vpn#1" || entry.Revision != 2 || !bytes.Equal(entry.Data, []byte("data v2")) {
+			t.Errorf("GetData() = origin %q, revision %d, data %q, want vpn#1, 2, data v2", entry.Origin, entry.Revision, entry.Data)
+		}
+		if entry, err := s.GetDataRevision(ctx, userId, "vpn", 1); err != nil || entry.Origin != "vpn#1" {
+			t.Errorf("GetDataRevision() = origin %q, %v, want vpn#1", entry.Origin, err)
+		}
+
+		//Синхронизация видит данные измененными
+		changes, err := s.GetChanges(ctx, userId, before.Cursor)
+		if err != nil {
+			t.Fatalf("GetChanges() error = %v", err)
+		}
+		checkChanges(t, "after rekey", changes, false, []string{}, []string{"vpn"}, []string{})
+		if len(changes.Updated) == 1 && changes.Updated[0].Origin != "vpn#1" {
+			t.Errorf("GetChanges() origin = %q, want vpn#1", changes.Updated[0].Origin)
+		}
+
+		//Перемещение сохраняет новый исходный идентификатор, а ключ из самого идентификатора не хранится
+		if err := s.MoveData(ctx, userId, "vpn", "work/vpn", 0); err != nil {
+			t.Fatalf("MoveData() error = %v", err)
+		}
+		if entry, err := s.GetData(ctx, userId, "work/vpn"); err != nil || entry.Origin != "vpn#1" {
+			t.Errorf("GetData() after move = origin %q, %v, want vpn#1", entry.Origin, err)
+		}
+		if err := s.RekeyData(ctx, userId, "work/vpn", "work/vpn", 0); err != nil {
+			t.Fatalf("RekeyData() error = %v", err)
+		}
+		if entry, err := s.GetData(ctx, userId, "work/vpn"); err != nil || entry.Origin != `` {
+			t.Errorf("GetData() rekeyed to own identifier = origin %q, %v, want none", entry.Origin, err)
+		}
+	})
+}
@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"github.com/lionslon/go-keepass/internal/models"
+	"slices"
+	"strings"
+	"time"
+)
+
+// memAttachment вложение данных, содержимое хранится в blobs, как у загрузок
+type memAttachment struct {
+	mimeType  string    // тип содержимого
+	key       []byte    // ключ вложения, зашифрованный ключом данных
+	blob      string    // идентификатор содержимого
+	createdAt time.Time // время загрузки
+}
+
+func (m *MemStorage) ListAttachments(ctx context.Context, userId string, dataId string) ([]models.Attachment, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	entry, ok := m.data[userId][dataId]
+	if !ok {
+		return nil, fmt.Errorf("data %s: %w", dataId, ErrNotFound)
+	}
+
+	attachments := make([]models.Attachment, 0, len(entry.attachments))
+	for name, attachment := range entry.attachments {
+		attachments = append(attachments, m.attachment(name, attachment))
+	}
+	slices.SortFunc(attachments, func(a, b models.Attachment) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return attachments, nil
+}
+
+func (m *MemStorage) GetAttachment(ctx context.Context, userId string, dataId string, name string) (models.Attachment, Entry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	entry, ok := m.data[userId][dataId]
+	if !ok {
+		return models.Attachment{}, Entry{}, fmt.Errorf("data %s: %w", dataId, ErrNotFound)
+	}
+
+	attachment, ok := entry.attachments[name]
+	if !ok {
+		return models.Attachment{}, Entry{}, fmt.Errorf("attachment %s of data %s: %w", name, dataId, ErrNotFound)
+	}
+
+	result := m.attachment(name, attachment)
+	result.Key = cloneBytes(attachment.key)
+
+	return result, Entry{Size: result.Size, Origin: entry.origin, blob: attachment.blob}, nil
+}
+
+func (m *MemStorage) DeleteAttachment(ctx context.Context, userId string, dataId string, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.data[userId][dataId]
+	if !ok {
+		return fmt.Errorf("data %s: %w", dataId, ErrNotFound)
+	}
+
+	attachment, ok := entry.attachments[name]
+	if !ok {
+		return fmt.Errorf("attachment %s of data %s: %w", name, dataId, ErrNotFound)
+	}
+
+	delete(entry.attachments, name)
+	delete(m.blobs, attachment.blob)
+
+	return nil
+}
+
+// attachUpload сохраняет загруженное содержимое вложением данных вместо одноименного вложения
+// и возвращает текущую ревизию данных, вызывается под блокировкой на запись
+func (m *MemStorage) attachUpload(userId string, uploadId string, upload *Upload) (int64, error) {
+	entry, ok := m.data[userId][upload.DataId]
+	if !ok {
+		return 0, fmt.Errorf("data %s: %w", upload.DataId, ErrNotFound)
+	}
+
+	if prev, ok := entry.attachments[upload.Attachment]; ok {
+		if upload.CreateOnly {
+			return 0, fmt.Errorf("attachment %s of data %s: %w", upload.Attachment, upload.DataId, ErrAlreadyExist)
+		}
+		delete(m.blobs, prev.blob)
+	}
+
+	if entry.attachments == nil {
+		entry.attachments = make(map[string]*memAttachment)
+	}
+	entry.attachments[upload.Attachment] = &memAttachment{
+		mimeType:  upload.MimeType,
+		key:       cloneBytes(upload.Key),
+		blob:      uploadId,
+		createdAt: time.Now().UTC(),
+	}
+
+	return entry.revision, nil
+}
+
+// attachment описание вложения с размером содержимого, вызывается под блокировкой
+func (m *MemStorage) attachment(name string, attachment *memAttachment) models.Attachment {
+	return models.Attachment{
+		Name:      name,
+		MimeType:  attachment.mimeType,
+		Size:      m.blobs[attachment.blob].size,
+		CreatedAt: attachment.createdAt,
+	}
+}
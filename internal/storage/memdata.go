@@ -0,0 +1,285 @@
+package storage
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"github.com/lionslon/go-keepass/internal/models"
+	"slices"
+	"strings"
+	"time"
+)
+
+// memRevision ревизия данных пользователя
+type memRevision struct {
+	data      []byte    // зашифрованные данные
+	metadata  []byte    // зашифрованные метаданные
+	blob      string    // идентификатор содержимого загрузки вместо data
+	size      int64     // размер содержимого
+	createdAt time.Time // время сохранения ревизии
+}
+
+// memEntry данные пользователя: текущая ревизия и история предыдущих
+type memEntry struct {
+	memRevision
+	revision   int64         // номер текущей ревизии
+	history    []memRevision // предыдущие ревизии, history[i] - ревизия i+1
+	changeSeq  int64         // номер последнего изменения, в том числе удаления
+	createdSeq int64         // номер изменения, создавшего данные
+	origin     string        // идентификатор до перемещения, от которого получен ключ данных
+
+	attachments map[string]*memAttachment // вложения по имени, не входят в ревизии
+}
+
+// entry копия ревизии для возврата из хранилища
+func (m *memRevision) entry(revision int64) Entry {
+	return Entry{
+		Data:     append([]byte(nil), m.data...),
+		Metadata: append([]byte(nil), m.metadata...),
+		Revision: revision,
+		Size:     m.size,
+		blob:     m.blob,
+	}
+}
+
+// info описание данных для списка
+func (m *memEntry) info(dataId string) models.DataInfo {
+	createdAt := m.createdAt
+	if len(m.history) > 0 {
+		createdAt = m.history[0].createdAt
+	}
+
+	return models.DataInfo{
+		Identifier: dataId,
+		Origin:     m.origin,
+		Revision:   m.revision,
+		Size:       m.size,
+		Metadata:   append([]byte(nil), m.metadata...),
+		CreatedAt:  createdAt,
+		UpdatedAt:  m.createdAt,
+	}
+}
+
+func (m *MemStorage) AddData(ctx context.Context, userId string, dataId string, data, metadata []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	userData, ok := m.data[userId]
+	if !ok {
+		userData = make(map[string]*memEntry)
+		m.data[userId] = userData
+	}
+
+	if _, ok := userData[dataId]; ok {
+		return fmt.Errorf("data %s: %w", dataId, ErrAlreadyExist)
+	}
+
+	seq := m.nextSeq(userId)
+	userData[dataId] = &memEntry{
+		memRevision: memRevision{
+			data:      append([]byte(nil), data...),
+			metadata:  append([]byte(nil), metadata...),
+			size:      int64(len(data)),
+			createdAt: time.Now().UTC(),
+		},
+		revision:   1,
+		changeSeq:  seq,
+		createdSeq: seq,
+	}
+
+	return nil
+}
+
+func (m *MemStorage) UpdateData(ctx context.Context, userId string, dataId string, data, metadata []byte, expected int64) (int64, error) {
+	return m.update(userId, dataId, expected, func(revision *memRevision) {
+		revision.data = append([]byte(nil), data...)
+		revision.blob = ``
+		revision.size = int64(len(data))
+		if metadata != nil {
+			revision.metadata = append([]byte(nil), metadata...)
+		}
+	})
+}
+
+func (m *MemStorage) UpdateMetadata(ctx context.Context, userId string, dataId string, metadata []byte, expected int64) (int64, error) {
+	return m.update(userId, dataId, expected, func(revision *memRevision) {
+		revision.metadata = append([]byte(nil), metadata...)
+	})
+}
+
+// update сохраняет текущую ревизию в историю и записывает новую, полученную из текущей функцией change
+func (m *MemStorage) update(userId string, dataId string, expected int64, change func(revision *memRevision)) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.data[userId][dataId]
+	if !ok {
+		return 0, fmt.Errorf("data %s: %w", dataId, ErrNotFound)
+	}
+
+	if expected != 0 && expected != entry.revision {
+		return 0, fmt.Errorf("data %s revision %d, expected %d: %w", dataId, entry.revision, expected, ErrRevisionMismatch)
+	}
+
+	next := entry.memRevision
+	change(&next)
+
+	return entry.replace(next, m.nextSeq(userId)), nil
+}
+
+// replace переносит текущую ревизию в историю и делает next текущей изменением с номером seq,
+// возвращает номер новой ревизии
+func (m *memEntry) replace(next memRevision, seq int64) int64 {
+	next.createdAt = time.Now().UTC()
+
+	m.history = append(m.history, m.memRevision)
+	m.memRevision = next
+	m.revision++
+	m.changeSeq = seq
+
+	return m.revision
+}
+
+func (m *MemStorage) GetData(ctx context.Context, userId string, dataId string) (Entry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	entry, ok := m.data[userId][dataId]
+	if !ok {
+		return Entry{}, fmt.Errorf("data %s: %w", dataId, ErrNotFound)
+	}
+
+	return entry.revisionEntry(entry.revision), nil
+}
+
+// revisionEntry копия ревизии revision, которая должна существовать
+func (m *memEntry) revisionEntry(revision int64) Entry {
+	result := m.entry(revision)
+	if revision != m.revision {
+		result = m.history[revision-1].entry(revision)
+	}
+	result.Origin = m.origin
+
+	return result
+}
+
+func (m *MemStorage) ListData(ctx context.Context, userId string, opts ListOptions) ([]models.DataInfo, int64, error) {
+	m.mu.RLock()
+	infos := make([]models.DataInfo, 0, len(m.data[userId]))
+	for dataId, entry := range m.data[userId] {
+		if models.InFolder(dataId, opts.Folder) {
+			infos = append(infos, entry.info(dataId))
+		}
+	}
+	m.mu.RUnlock()
+
+	sortDataInfos(infos, opts)
+
+	total := int64(len(infos))
+	infos = infos[min(opts.Offset, len(infos)):]
+	infos = infos[:min(opts.Limit, len(infos))]
+
+	return infos, total, nil
+}
+
+// sortDataInfos сортирует список данных так же, как это делает SQL хранилище
+func sortDataInfos(infos []models.DataInfo, opts ListOptions) {
+	compare := func(a, b models.DataInfo) int {
+		switch opts.Sort {
+		case SortByCreated:
+			return a.CreatedAt.Compare(b.CreatedAt)
+		case SortByUpdated:
+			return a.UpdatedAt.Compare(b.UpdatedAt)
+		case SortBySize:
+			return cmp.Compare(a.Size, b.Size)
+		default:
+			return strings.Compare(a.Identifier, b.Identifier)
+		}
+	}
+
+	slices.SortFunc(infos, func(a, b models.DataInfo) int {
+		c := compare(a, b)
+		if opts.Desc {
+			c = -c
+		}
+		if c == 0 {
+			c = strings.Compare(a.Identifier, b.Identifier)
+		}
+		return c
+	})
+}
+
+func (m *MemStorage) GetDataRevisions(ctx context.Context, userId string, dataId string) ([]models.DataRevision, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	entry, ok := m.data[userId][dataId]
+	if !ok {
+		return nil, fmt.Errorf("data %s: %w", dataId, ErrNotFound)
+	}
+
+	revisions := make([]models.DataRevision, 0, len(entry.history)+1)
+	for i, revision := range entry.history {
+		revisions = append(revisions, models.DataRevision{
+			Revision:  int64(i + 1),
+			CreatedAt: revision.createdAt,
+			Size:      revision.size,
+		})
+	}
+	revisions = append(revisions, models.DataRevision{
+		Revision:  entry.revision,
+		CreatedAt: entry.createdAt,
+		Size:      entry.size,
+	})
+
+	return revisions, nil
+}
+
+func (m *MemStorage) GetDataRevision(ctx context.Context, userId string, dataId string, revision int64) (Entry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	entry, ok := m.data[userId][dataId]
+	if !ok || revision < 1 || revision > entry.revision {
+		return Entry{}, fmt.Errorf("data %s revision %d: %w", dataId, revision, ErrNotFound)
+	}
+
+	return entry.revisionEntry(revision), nil
+}
+
+func (m *MemStorage) DeleteData(ctx context.Context, userId string, dataId string, expected int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.data[userId][dataId]
+	if !ok {
+		return fmt.Errorf("data %s: %w", dataId, ErrNotFound)
+	}
+
+	if expected != 0 && expected != entry.revision {
+		return fmt.Errorf("data %s revision %d, expected %d: %w", dataId, entry.revision, expected, ErrRevisionMismatch)
+	}
+
+	trashId, err := newUUID()
+	if err != nil {
+		return fmt.Errorf("cannot generate trash id: %w", err)
+	}
+
+	m.trashEntry(userId, dataId, trashId, m.nextSeq(userId), time.Now().UTC())
+
+	return nil
+}
+
+// trashEntry переносит данные в корзину под идентификатором trashId изменением с номером seq,
+// вызывается под блокировкой на запись
+func (m *MemStorage) trashEntry(userId string, dataId string, trashId string, seq int64, deletedAt time.Time) {
+	entry := m.data[userId][dataId]
+	delete(m.data[userId], dataId)
+	entry.changeSeq = seq
+
+	m.userTrash(userId)[trashId] = &memTrash{
+		dataId:    dataId,
+		entry:     entry,
+		deletedAt: deletedAt,
+	}
+}
@@ -0,0 +1,215 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"github.com/lionslon/go-keepass/internal/models"
+	"time"
+)
+
+func (m *MemStorage) MoveData(ctx context.Context, userId string, from string, to string, expected int64) error {
+	trashId, err := newUUID()
+	if err != nil {
+		return fmt.Errorf("cannot generate trash id: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.data[userId][from]
+	if !ok {
+		return fmt.Errorf("data %s: %w", from, ErrNotFound)
+	}
+
+	if expected != 0 && expected != entry.revision {
+		return fmt.Errorf("data %s revision %d, expected %d: %w", from, entry.revision, expected, ErrRevisionMismatch)
+	}
+
+	if _, ok := m.data[userId][to]; ok {
+		return fmt.Errorf("data %s: %w", to, ErrAlreadyExist)
+	}
+
+	m.moveEntry(userId, from, to, trashId, m.nextSeq(userId), time.Now().UTC())
+
+	return nil
+}
+
+func (m *MemStorage) RekeyData(ctx context.Context, userId string, dataId string, origin string, expected int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.data[userId][dataId]
+	if !ok {
+		return fmt.Errorf("data %s: %w", dataId, ErrNotFound)
+	}
+
+	if expected != 0 && expected != entry.revision {
+		return fmt.Errorf("data %s revision %d, expected %d: %w", dataId, entry.revision, expected, ErrRevisionMismatch)
+	}
+
+	//Ключ, полученный из самого идентификатора, не хранится, как у вернувшихся на место данных
+	entry.origin = movedOrigin(dataId, origin, dataId)
+	entry.changeSeq = m.nextSeq(userId)
+
+	return nil
+}
+
+// moveEntry переносит данные под идентификатор to изменением с номером seq и оставляет в корзине
+// под trashId след прежнего идентификатора, вызывается под блокировкой на запись
+func (m *MemStorage) moveEntry(userId string, from string, to string, trashId string, seq int64, movedAt time.Time) {
+	entry := m.data[userId][from]
+	delete(m.data[userId], from)
+
+	entry.origin = movedOrigin(from, entry.origin, to)
+	entry.changeSeq = seq
+	entry.createdSeq = seq
+	m.data[userId][to] = entry
+
+	m.userTrash(userId)[trashId] = &memTrash{
+		dataId:    from,
+		entry:     &memEntry{changeSeq: seq},
+		deletedAt: movedAt,
+		moved:     true,
+	}
+
+	//Передачи в SQL хранилище привязаны к строке данных и перемещаются вместе с ней
+	for _, share := range m.shares {
+		if share.entry == entry {
+			share.dataId = to
+		}
+	}
+}
+
+func (m *MemStorage) CreateFolder(ctx context.Context, userId string, path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.isFolderExist(userId, path) {
+		return fmt.Errorf("folder %s: %w", path, ErrAlreadyExist)
+	}
+
+	userFolders, ok := m.folders[userId]
+	if !ok {
+		userFolders = make(map[string]time.Time)
+		m.folders[userId] = userFolders
+	}
+	userFolders[path] = time.Now().UTC()
+
+	return nil
+}
+
+func (m *MemStorage) ListFolders(ctx context.Context, userId string) ([]models.Folder, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	explicit := make([]string, 0, len(m.folders[userId]))
+	for path := range m.folders[userId] {
+		explicit = append(explicit, path)
+	}
+
+	identifiers := make([]string, 0, len(m.data[userId]))
+	for dataId := range m.data[userId] {
+		identifiers = append(identifiers, dataId)
+	}
+
+	return collectFolders(explicit, identifiers), nil
+}
+
+func (m *MemStorage) MoveFolder(ctx context.Context, userId string, from string, to string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.isFolderExist(userId, from) {
+		return 0, fmt.Errorf("folder %s: %w", from, ErrNotFound)
+	}
+	if m.isFolderExist(userId, to) {
+		return 0, fmt.Errorf("folder %s: %w", to, ErrAlreadyExist)
+	}
+
+	dataIds := m.folderData(userId, from)
+
+	//Идентификаторы следов выделяются заранее, чтобы ошибка не оставила папку перенесенной наполовину
+	trashIds := make([]string, 0, len(dataIds))
+	for range dataIds {
+		trashId, err := newUUID()
+		if err != nil {
+			return 0, fmt.Errorf("cannot generate trash id: %w", err)
+		}
+		trashIds = append(trashIds, trashId)
+	}
+
+	seq := m.nextSeq(userId)
+	now := time.Now().UTC()
+	for i, dataId := range dataIds {
+		m.moveEntry(userId, dataId, models.MovePath(dataId, from, to), trashIds[i], seq, now)
+	}
+
+	moved := make(map[string]time.Time)
+	for path, createdAt := range m.folders[userId] {
+		if path == from || models.InFolder(path, from) {
+			moved[models.MovePath(path, from, to)] = createdAt
+			delete(m.folders[userId], path)
+		}
+	}
+	for path, createdAt := range moved {
+		m.folders[userId][path] = createdAt
+	}
+
+	return int64(len(dataIds)), nil
+}
+
+func (m *MemStorage) DeleteFolder(ctx context.Context, userId string, path string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.isFolderExist(userId, path) {
+		return 0, fmt.Errorf("folder %s: %w", path, ErrNotFound)
+	}
+
+	dataIds := m.folderData(userId, path)
+
+	trashIds := make([]string, 0, len(dataIds))
+	for range dataIds {
+		trashId, err := newUUID()
+		if err != nil {
+			return 0, fmt.Errorf("cannot generate trash id: %w", err)
+		}
+		trashIds = append(trashIds, trashId)
+	}
+
+	//Все данные папки попадают в корзину одним изменением, как в SQL хранилище
+	seq := m.nextSeq(userId)
+	now := time.Now().UTC()
+	for i, dataId := range dataIds {
+		m.trashEntry(userId, dataId, trashIds[i], seq, now)
+	}
+
+	for folder := range m.folders[userId] {
+		if folder == path || models.InFolder(folder, path) {
+			delete(m.folders[userId], folder)
+		}
+	}
+
+	return int64(len(dataIds)), nil
+}
+
+// folderData идентификаторы неудаленных данных папки и ее вложенных папок
+func (m *MemStorage) folderData(userId string, folder string) []string {
+	var dataIds []string
+	for dataId := range m.data[userId] {
+		if models.InFolder(dataId, folder) {
+			dataIds = append(dataIds, dataId)
+		}
+	}
+	return dataIds
+}
+
+// isFolderExist проверяет, что папка создана явно или следует из вложенных папок и идентификаторов данных
+func (m *MemStorage) isFolderExist(userId string, path string) bool {
+	for folder := range m.folders[userId] {
+		if folder == path || models.InFolder(folder, path) {
+			return true
+		}
+	}
+	return len(m.folderData(userId, path)) > 0
+}
@@ -0,0 +1,395 @@
+package storage
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"github.com/lionslon/go-keepass/internal/models"
+	"slices"
+	"strings"
+	"time"
+)
+
+// memOrg организация хранилища в памяти
+type memOrg struct {
+	name      string                // название
+	createdAt time.Time             // время создания
+	members   map[string]*memMember // участники по идентификатору пользователя
+}
+
+// memMember участник организации
+type memMember struct {
+	role      models.OrgRole // роль
+	accepted  bool           // приглашение принято
+	createdAt time.Time      // время приглашения
+}
+
+// memCollection коллекция организации, ее данные хранятся под идентификатором коллекции
+type memCollection struct {
+	orgId      string                      // идентификатор организации
+	name       string                      // название
+	keyVersion int64                       // текущая версия ключа
+	createdAt  time.Time                   // время создания
+	keys       map[string]map[int64][]byte // зашифрованные ключи по идентификатору участника и версии
+}
+
+// setKey сохраняет версию ключа коллекции, зашифрованную для участника
+func (m *memCollection) setKey(userId string, version int64, key []byte) {
+	if m.keys[userId] == nil {
+		m.keys[userId] = make(map[int64][]byte)
+	}
+	m.keys[userId][version] = append([]byte(nil), key...)
+}
+
+// member описание участника организации
+func (m *MemStorage) member(userId string, member *memMember) models.Member {
+	return models.Member{
+		Login:     m.userLogin(userId),
+		Role:      member.role,
+		Accepted:  member.accepted,
+		CreatedAt: member.createdAt,
+		UserId:    userId,
+	}
+}
+
+// members участники организации в порядке логинов
+func (m *MemStorage) members(org *memOrg) []models.Member {
+	members := make([]models.Member, 0, len(org.members))
+	for userId, member := range org.members {
+		members = append(members, m.member(userId, member))
+	}
+	slices.SortFunc(members, func(a, b models.Member) int {
+		return strings.Compare(a.Login, b.Login)
+	})
+	return members
+}
+
+// collection описание коллекции с ролью и ключами пользователя
+func (m *MemStorage) collection(collectionId string, collection *memCollection, userId string) models.Collection {
+	result := models.Collection{
+		Id:           collectionId,
+		Organization: collection.orgId,
+		Name:         collection.name,
+		KeyVersion:   collection.keyVersion,
+		CreatedAt:    collection.createdAt,
+	}
+	if member, ok := m.orgMembers(collection.orgId)[userId]; ok {
+		result.Role = member.role
+	}
+
+	for version, key := range collection.keys[userId] {
+		result.Keys = append(result.Keys, models.CollectionKey{
+			Collection: collectionId,
+			Version:    version,
+			Key:        append([]byte(nil), key...),
+		})
+	}
+	slices.SortFunc(result.Keys, compareKeys)
+
+	return result
+}
+
+// orgMembers участники организации по идентификатору пользователя, nil - организации нет
+func (m *MemStorage) orgMembers(orgId string) map[string]*memMember {
+	if org, ok := m.orgs[orgId]; ok {
+		return org.members
+	}
+	return nil
+}
+
+// orgCollections идентификаторы коллекций организации
+func (m *MemStorage) orgCollections(orgId string) []string {
+	ids := make([]string, 0)
+	for id, collection := range m.collections {
+		if collection.orgId == orgId {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// orgMember возвращает организацию и участника по логину, вызывается под блокировкой
+func (m *MemStorage) orgMember(orgId string, login string) (*memOrg, string, *memMember, error) {
+	org, ok := m.orgs[orgId]
+	if !ok {
+		return nil, ``, nil, fmt.Errorf("organization %s: %w", orgId, ErrNotFound)
+	}
+
+	user, ok := m.users[login]
+	if !ok {
+		return nil, ``, nil, fmt.Errorf("user %s: %w", login, ErrNotFound)
+	}
+
+	member, ok := org.members[user.id]
+	if !ok {
+		return nil, ``, nil, fmt.Errorf("member %s: %w", login, ErrNotFound)
+	}
+
+	return org, user.id, member, nil
+}
+
+func (m *MemStorage) CreateOrganization(ctx context.Context, userId string, name string) (models.Organization, error) {
+	orgId, err := newUUID()
+	if err != nil {
+		return models.Organization{}, fmt.Errorf("cannot generate organization id: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.userLogin(userId) == `` {
+		return models.Organization{}, fmt.Errorf("user %s: %w", userId, ErrNotFound)
+	}
+
+	now := time.Now().UTC()
+	m.orgs[orgId] = &memOrg{
+		name:      name,
+		createdAt: now,
+		members:   map[string]*memMember{userId: {role: models.RoleOwner, accepted: true, createdAt: now}},
+	}
+
+	return models.Organization{Id: orgId, Name: name, Role: models.RoleOwner, Accepted: true, CreatedAt: now}, nil
+}
+
+func (m *MemStorage) ListOrganizations(ctx context.Context, userId string) ([]models.Organization, error) {
+	m.mu.RLock()
+	orgs := make([]models.Organization, 0)
+	for orgId, org := range m.orgs {
+		if member, ok := org.members[userId]; ok {
+			orgs = append(orgs, models.Organization{
+				Id:        orgId,
+				Name:      org.name,
+				Role:      member.role,
+				Accepted:  member.accepted,
+				CreatedAt: org.createdAt,
+			})
+		}
+	}
+	m.mu.RUnlock()
+
+	//Порядок тот же, что и в SQL хранилище
+	slices.SortFunc(orgs, func(a, b models.Organization) int {
+		return cmp.Or(strings.Compare(a.Name, b.Name), strings.Compare(a.Id, b.Id))
+	})
+
+	return orgs, nil
+}
+
+func (m *MemStorage) GetMember(ctx context.Context, orgId string, userId string) (models.Member, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	member, ok := m.orgMembers(orgId)[userId]
+	if !ok {
+		return models.Member{}, fmt.Errorf("member of organization %s: %w", orgId, ErrNotFound)
+	}
+
+	return m.member(userId, member), nil
+}
+
+func (m *MemStorage) ListMembers(ctx context.Context, orgId string) ([]models.Member, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	org, ok := m.orgs[orgId]
+	if !ok {
+		return make([]models.Member, 0), nil
+	}
+
+	return m.members(org), nil
+}
+
+func (m *MemStorage) InviteMember(ctx context.Context, orgId string, request models.InviteRequest) (models.Member, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	org, ok := m.orgs[orgId]
+	if !ok {
+		return models.Member{}, fmt.Errorf("organization %s: %w", orgId, ErrNotFound)
+	}
+
+	user, ok := m.users[request.Login]
+	if !ok {
+		return models.Member{}, fmt.Errorf("user %s: %w", request.Login, ErrNotFound)
+	}
+	if len(user.publicKey) == 0 {
+		return models.Member{}, fmt.Errorf("public key of user %s: %w", request.Login, ErrNotFound)
+	}
+	if _, ok := org.members[user.id]; ok {
+		return models.Member{}, fmt.Errorf("member %s: %w", request.Login, ErrAlreadyExist)
+	}
+
+	//Приглашенный получает все версии ключей, чтобы читать данные, сохраненные до смены ключа
+	expected := make([]models.CollectionKey, 0)
+	for _, collectionId := range m.orgCollections(orgId) {
+		for version := int64(1); version <= m.collections[collectionId].keyVersion; version++ {
+			expected = append(expected, models.CollectionKey{Collection: collectionId, Version: version})
+		}
+	}
+	if err := matchKeys(request.Keys, expected); err != nil {
+		return models.Member{}, err
+	}
+
+	member := &memMember{role: request.Role, createdAt: time.Now().UTC()}
+	org.members[user.id] = member
+	for _, key := range request.Keys {
+		m.collections[key.Collection].setKey(user.id, key.Version, key.Key)
+	}
+
+	return m.member(user.id, member), nil
+}
+
+func (m *MemStorage) AcceptInvitation(ctx context.Context, orgId string, userId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	member, ok := m.orgMembers(orgId)[userId]
+	if !ok {
+		return fmt.Errorf("member of organization %s: %w", orgId, ErrNotFound)
+	}
+
+	member.accepted = true
+	return nil
+}
+
+func (m *MemStorage) SetMemberRole(ctx context.Context, orgId string, login string, role models.OrgRole) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	org, _, member, err := m.orgMember(orgId, login)
+	if err != nil {
+		return err
+	}
+
+	if err := ownersLeft(m.members(org), login, role); err != nil {
+		return err
+	}
+
+	member.role = role
+	return nil
+}
+
+func (m *MemStorage) RemoveMember(ctx context.Context, orgId string, login string, keys []models.CollectionKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	org, userId, member, err := m.orgMember(orgId, login)
+	if err != nil {
+		return err
+	}
+
+	if err := ownersLeft(m.members(org), login, ``); err != nil {
+		return err
+	}
+
+	//Участнику, принявшему приглашение, известны ключи: коллекции получают новую версию ключа
+	collections := m.orgCollections(orgId)
+	expected := make([]models.CollectionKey, 0)
+	if member.accepted {
+		for _, collectionId := range collections {
+			for memberId := range org.members {
+				if memberId != userId {
+					expected = append(expected, models.CollectionKey{
+						Collection: collectionId,
+						Login:      m.userLogin(memberId),
+						Version:    m.collections[collectionId].keyVersion + 1,
+					})
+				}
+			}
+		}
+	}
+	if err := matchKeys(keys, expected); err != nil {
+		return err
+	}
+
+	delete(org.members, userId)
+	for _, collectionId := range collections {
+		delete(m.collections[collectionId].keys, userId)
+	}
+
+	if !member.accepted {
+		return nil
+	}
+
+	for _, collectionId := range collections {
+		m.collections[collectionId].keyVersion++
+	}
+	for _, key := range keys {
+		m.collections[key.Collection].setKey(m.users[key.Login].id, key.Version, key.Key)
+	}
+
+	return nil
+}
+
+func (m *MemStorage) CreateCollection(ctx context.Context, orgId string, request models.CollectionRequest) (models.Collection, error) {
+	collectionId, err := newUUID()
+	if err != nil {
+		return models.Collection{}, fmt.Errorf("cannot generate collection id: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	org, ok := m.orgs[orgId]
+	if !ok {
+		return models.Collection{}, fmt.Errorf("organization %s: %w", orgId, ErrNotFound)
+	}
+
+	//Ключ нужен каждому участнику, в том числе еще не принявшему приглашение
+	expected := make([]models.CollectionKey, 0, len(org.members))
+	for memberId := range org.members {
+		expected = append(expected, models.CollectionKey{Login: m.userLogin(memberId)})
+	}
+	if err := matchKeys(request.Keys, expected); err != nil {
+		return models.Collection{}, err
+	}
+
+	collection := &memCollection{
+		orgId:      orgId,
+		name:       request.Name,
+		keyVersion: 1,
+		createdAt:  time.Now().UTC(),
+		keys:       make(map[string]map[int64][]byte),
+	}
+	for _, key := range request.Keys {
+		collection.setKey(m.users[key.Login].id, 1, key.Key)
+	}
+
+	m.users[collectionLogin(collectionId)] = memUser{id: collectionId}
+	m.collections[collectionId] = collection
+
+	return m.collection(collectionId, collection, ``), nil
+}
+
+func (m *MemStorage) ListCollections(ctx context.Context, orgId string, userId string) ([]models.Collection, error) {
+	m.mu.RLock()
+	collections := make([]models.Collection, 0)
+	for _, collectionId := range m.orgCollections(orgId) {
+		collections = append(collections, m.collection(collectionId, m.collections[collectionId], userId))
+	}
+	m.mu.RUnlock()
+
+	//Порядок тот же, что и в SQL хранилище
+	slices.SortFunc(collections, func(a, b models.Collection) int {
+		return cmp.Or(strings.Compare(a.Name, b.Name), strings.Compare(a.Id, b.Id))
+	})
+
+	return collections, nil
+}
+
+func (m *MemStorage) GetCollection(ctx context.Context, userId string, collectionId string) (models.Collection, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	collection, ok := m.collections[collectionId]
+	if !ok {
+		return models.Collection{}, fmt.Errorf("collection %s: %w", collectionId, ErrNotFound)
+	}
+
+	member, ok := m.orgMembers(collection.orgId)[userId]
+	if !ok || !member.accepted {
+		return models.Collection{}, fmt.Errorf("collection %s: %w", collectionId, ErrNotFound)
+	}
+
+	return m.collection(collectionId, collection, userId), nil
+}
@@ -0,0 +1,225 @@
+package storage
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"github.com/lionslon/go-keepass/internal/models"
+	"slices"
+	"strings"
+	"time"
+)
+
+// memShare данные, переданные владельцем получателю. Передача привязана к данным, а не к идентификатору:
+// после удаления и повторного создания данных с тем же идентификатором она не действует.
+type memShare struct {
+	ownerId     string                 // идентификатор владельца
+	dataId      string                 // идентификатор данных у владельца
+	entry       *memEntry              // переданные данные
+	recipientId string                 // идентификатор получателя
+	key         []byte                 // ключ данных, зашифрованный открытым ключом получателя
+	permission  models.SharePermission // права получателя
+	accepted    bool                   // получатель принял данные
+	createdAt   time.Time              // время передачи
+}
+
+// live проверяет, что переданные данные не удалены в корзину
+func (m *MemStorage) live(share *memShare) bool {
+	return m.data[share.ownerId][share.dataId] == share.entry
+}
+
+// share описание передачи с логинами владельца и получателя
+func (m *MemStorage) share(shareId string, share *memShare) models.Share {
+	return models.Share{
+		Id:          shareId,
+		Identifier:  share.dataId,
+		Owner:       m.userLogin(share.ownerId),
+		Recipient:   m.userLogin(share.recipientId),
+		Permission:  share.permission,
+		Key:         append([]byte(nil), share.key...),
+		Accepted:    share.accepted,
+		CreatedAt:   share.createdAt,
+		OwnerId:     share.ownerId,
+		RecipientId: share.recipientId,
+	}
+}
+
+// userLogin возвращает логин пользователя по идентификатору
+func (m *MemStorage) userLogin(userId string) string {
+	for login, user := range m.users {
+		if user.id == userId {
+			return login
+		}
+	}
+	return ``
+}
+
+func (m *MemStorage) SetUserKeys(ctx context.Context, userId string, keys models.UserKeys) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	login := m.userLogin(userId)
+	user, ok := m.users[login]
+	if !ok {
+		return fmt.Errorf("user %s: %w", userId, ErrNotFound)
+	}
+	if len(user.publicKey) > 0 {
+		return fmt.Errorf("user keys: %w", ErrAlreadyExist)
+	}
+
+	user.publicKey = append([]byte(nil), keys.PublicKey...)
+	user.privateKey = append([]byte(nil), keys.PrivateKey...)
+	m.users[login] = user
+
+	return nil
+}
+
+func (m *MemStorage) GetUserKeys(ctx context.Context, userId string) (models.UserKeys, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.users[m.userLogin(userId)]
+	if !ok {
+		return models.UserKeys{}, fmt.Errorf("user %s: %w", userId, ErrNotFound)
+	}
+	if len(user.publicKey) == 0 {
+		return models.UserKeys{}, fmt.Errorf("user keys: %w", ErrNotFound)
+	}
+
+	return models.UserKeys{
+		PublicKey:  append([]byte(nil), user.publicKey...),
+		PrivateKey: append([]byte(nil), user.privateKey...),
+	}, nil
+}
+
+func (m *MemStorage) GetPublicKey(ctx context.Context, login string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.users[login]
+	if !ok {
+		return nil, fmt.Errorf("user %s: %w", login, ErrNotFound)
+	}
+	if len(user.publicKey) == 0 {
+		return nil, fmt.Errorf("public key of user %s: %w", login, ErrNotFound)
+	}
+
+	return append([]byte(nil), user.publicKey...), nil
+}
+
+func (m *MemStorage) ShareData(ctx context.Context, userId string, dataId string, request models.ShareRequest) (models.Share, error) {
+	shareId, err := newUUID()
+	if err != nil {
+		return models.Share{}, fmt.Errorf("cannot generate share id: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.data[userId][dataId]
+	if !ok {
+		return models.Share{}, fmt.Errorf("data %s: %w", dataId, ErrNotFound)
+	}
+
+	recipient, ok := m.users[request.Recipient]
+	if !ok {
+		return models.Share{}, fmt.Errorf("user %s: %w", request.Recipient, ErrNotFound)
+	}
+	if len(recipient.publicKey) == 0 {
+		return models.Share{}, fmt.Errorf("public key of user %s: %w", request.Recipient, ErrNotFound)
+	}
+	if recipient.id == userId {
+		return models.Share{}, fmt.Errorf("cannot share data with its owner: %w", ErrForbidden)
+	}
+
+	//Повторная передача тому же получателю меняет существующую
+	share := &memShare{
+		ownerId:     userId,
+		dataId:      dataId,
+		entry:       entry,
+		recipientId: recipient.id,
+		createdAt:   time.Now().UTC(),
+	}
+	for id, existing := range m.shares {
+		if existing.entry == entry && existing.recipientId == recipient.id {
+			shareId, share = id, existing
+			break
+		}
+	}
+
+	share.key = append([]byte(nil), request.Key...)
+	share.permission = request.Permission
+	m.shares[shareId] = share
+
+	result := m.share(shareId, share)
+	result.Key = nil
+	return result, nil
+}
+
+func (m *MemStorage) ListShares(ctx context.Context, userId string) (models.ShareList, error) {
+	m.mu.RLock()
+	list := models.ShareList{Outgoing: make([]models.Share, 0), Incoming: make([]models.Share, 0)}
+	for shareId, share := range m.shares {
+		if !m.live(share) {
+			continue
+		}
+		switch userId {
+		case share.ownerId:
+			//Ключ данных нужен только получателю
+			outgoing := m.share(shareId, share)
+			outgoing.Key = nil
+			list.Outgoing = append(list.Outgoing, outgoing)
+		case share.recipientId:
+			list.Incoming = append(list.Incoming, m.share(shareId, share))
+		}
+	}
+	m.mu.RUnlock()
+
+	//Порядок тот же, что и в SQL хранилище
+	slices.SortFunc(list.Outgoing, func(a, b models.Share) int {
+		return cmp.Or(strings.Compare(a.Identifier, b.Identifier), strings.Compare(a.Recipient, b.Recipient))
+	})
+	slices.SortFunc(list.Incoming, func(a, b models.Share) int {
+		return cmp.Or(strings.Compare(a.Owner, b.Owner), strings.Compare(a.Identifier, b.Identifier))
+	})
+
+	return list, nil
+}
+
+func (m *MemStorage) GetShare(ctx context.Context, userId string, shareId string) (models.Share, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	share, ok := m.shares[shareId]
+	if !ok || !m.live(share) || (share.ownerId != userId && share.recipientId != userId) {
+		return models.Share{}, fmt.Errorf("share %s: %w", shareId, ErrNotFound)
+	}
+
+	return m.share(shareId, share), nil
+}
+
+func (m *MemStorage) AcceptShare(ctx context.Context, userId string, shareId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	share, ok := m.shares[shareId]
+	if !ok || !m.live(share) || share.recipientId != userId {
+		return fmt.Errorf("share %s: %w", shareId, ErrNotFound)
+	}
+
+	share.accepted = true
+	return nil
+}
+
+func (m *MemStorage) DeleteShare(ctx context.Context, userId string, shareId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	share, ok := m.shares[shareId]
+	if !ok || (share.ownerId != userId && share.recipientId != userId) {
+		return fmt.Errorf("share %s: %w", shareId, ErrNotFound)
+	}
+
+	delete(m.shares, shareId)
+	return nil
+}
@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"github.com/lionslon/go-keepass/internal/models"
+	"sync"
+	"time"
+)
+
+// memUser пользователь хранилища в памяти
+type memUser struct {
+	id         string // идентификатор пользователя
+	password   string // хэш пароля
+	publicKey  []byte // открытый ключ для обмена данными
+	privateKey []byte // закрытый ключ, зашифрованный клиентом
+}
+
+// MemStorage потокобезопасное хранилище в памяти, используется для локального запуска и тестов.
+type MemStorage struct {
+	mu          sync.RWMutex
+	users       map[string]memUser              // пользователи по логину
+	data        map[string]map[string]*memEntry // данные по идентификатору пользователя и идентификатору данных
+	trash       map[string]map[string]*memTrash // корзина по идентификатору пользователя и идентификатору в корзине
+	seqs        map[string]*memSeqs             // номера изменений по идентификатору пользователя
+	blobs       map[string]*memBlob             // содержимое загрузок по идентификатору
+	uploads     map[string]*Upload              // незавершенные загрузки по идентификатору содержимого
+	shares      map[string]*memShare            // переданные данные по идентификатору передачи
+	orgs        map[string]*memOrg              // организации по идентификатору
+	collections map[string]*memCollection       // коллекции организаций по идентификатору
+	folders     map[string]map[string]time.Time // папки, созданные явно, по идентификатору пользователя и пути
+}
+
+var _ Storage = (*MemStorage)(nil)
+
+func NewMemStorage() *MemStorage {
+	return &MemStorage{
+		users:       make(map[string]memUser),
+		data:        make(map[string]map[string]*memEntry),
+		trash:       make(map[string]map[string]*memTrash),
+		seqs:        make(map[string]*memSeqs),
+		blobs:       make(map[string]*memBlob),
+		uploads:     make(map[string]*Upload),
+		shares:      make(map[string]*memShare),
+		orgs:        make(map[string]*memOrg),
+		collections: make(map[string]*memCollection),
+		folders:     make(map[string]map[string]time.Time),
+	}
+}
+
+func (m *MemStorage) Close() {}
+
+func (m *MemStorage) IsUserExist(ctx context.Context, login string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, ok := m.users[login]
+	return ok
+}
+
+func (m *MemStorage) CreateUser(ctx context.Context, dto models.AuthDTO) (string, error) {
+
+	if err := dto.GeneratePasswordHash(); err != nil {
+		return ``, fmt.Errorf("cannot generate password hash: %w", err)
+	}
+
+	uuid, err := newUUID()
+	if err != nil {
+		return ``, fmt.Errorf("cannot generate user id: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[dto.Login]; ok {
+		return ``, fmt.Errorf("user %s: %w", dto.Login, ErrAlreadyExist)
+	}
+
+	m.users[dto.Login] = memUser{
+		id:       uuid,
+		password: dto.Password,
+	}
+
+	return uuid, nil
+}
+
+func (m *MemStorage) Login(ctx context.Context, dto models.AuthDTO) (string, error) {
+	m.mu.RLock()
+	user, ok := m.users[dto.Login]
+	m.mu.RUnlock()
+
+	if !ok {
+		return ``, fmt.Errorf("cannot get user: %w", ErrNotFound)
+	}
+
+	if !dto.CheckPassword(user.password) {
+		return ``, fmt.Errorf("bad password")
+	}
+
+	return user.id, nil
+}
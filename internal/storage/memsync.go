@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"cmp"
+	"context"
+	"github.com/lionslon/go-keepass/internal/models"
+	"slices"
+	"strings"
+)
+
+// memSeqs последовательность изменений данных пользователя
+type memSeqs struct {
+	change int64 // номер последнего изменения
+	purged int64 // наибольший номер изменения, удаленного из корзины окончательно
+}
+
+// userSeqs возвращает последовательность изменений пользователя, вызывается под блокировкой на запись
+func (m *MemStorage) userSeqs(userId string) *memSeqs {
+	seqs, ok := m.seqs[userId]
+	if !ok {
+		seqs = &memSeqs{}
+		m.seqs[userId] = seqs
+	}
+	return seqs
+}
+
+// nextSeq выделяет номер следующего изменения данных пользователя, вызывается под блокировкой на запись
+func (m *MemStorage) nextSeq(userId string) int64 {
+	seqs := m.userSeqs(userId)
+	seqs.change++
+	return seqs.change
+}
+
+func (m *MemStorage) GetChanges(ctx context.Context, userId string, since int64) (models.SyncChanges, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	changes := models.SyncChanges{
+		Created: make([]models.DataInfo, 0),
+		Updated: make([]models.DataInfo, 0),
+		Deleted: make([]string, 0),
+	}
+
+	var purged int64
+	if seqs, ok := m.seqs[userId]; ok {
+		changes.Cursor, purged = seqs.change, seqs.purged
+	}
+
+	changes.Reset = resetSync(since, changes.Cursor, purged)
+	if changes.Reset {
+		since = 0
+	}
+
+	//Порядок тот же, что и в SQL хранилище: по номеру изменения
+	dataIds := make([]string, 0)
+	for dataId, entry := range m.data[userId] {
+		if entry.changeSeq > since {
+			dataIds = append(dataIds, dataId)
+		}
+	}
+	slices.SortFunc(dataIds, func(a, b string) int {
+		return cmp.Compare(m.data[userId][a].changeSeq, m.data[userId][b].changeSeq)
+	})
+	for _, dataId := range dataIds {
+		entry := m.data[userId][dataId]
+		addChange(&changes, entry.info(dataId), entry.createdSeq > since)
+	}
+
+	if changes.Reset {
+		return changes, nil
+	}
+
+	for _, trash := range m.trash[userId] {
+		if _, live := m.data[userId][trash.dataId]; trash.entry.changeSeq > since && !live &&
+			!slices.Contains(changes.Deleted, trash.dataId) {
+			changes.Deleted = append(changes.Deleted, trash.dataId)
+		}
+	}
+	slices.SortFunc(changes.Deleted, strings.Compare)
+
+	return changes, nil
+}
@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"github.com/lionslon/go-keepass/internal/models"
+	"slices"
+	"strings"
+	"time"
+)
+
+// memTrash удаленные данные в корзине пользователя
+type memTrash struct {
+	dataId    string    // идентификатор данных до удаления
+	entry     *memEntry // данные вместе с историей ревизий
+	deletedAt time.Time // время удаления
+	moved     bool      // след перемещенных данных: нужен синхронизации, пользователь его не видит
+}
+
+// userTrash возвращает корзину пользователя, вызывается под блокировкой на запись
+func (m *MemStorage) userTrash(userId string) map[string]*memTrash {
+	userTrash, ok := m.trash[userId]
+	if !ok {
+		userTrash = make(map[string]*memTrash)
+		m.trash[userId] = userTrash
+	}
+	return userTrash
+}
+
+// item описание удаленных данных для списка корзины
+func (m *memTrash) item(trashId string) models.TrashItem {
+	return models.TrashItem{
+		Id:         trashId,
+		Identifier: m.dataId,
+		Origin:     m.entry.origin,
+		Revision:   m.entry.revision,
+		Size:       m.entry.size,
+		Metadata:   append([]byte(nil), m.entry.metadata...),
+		DeletedAt:  m.deletedAt,
+	}
+}
+
+func (m *MemStorage) ListTrash(ctx context.Context, userId string) ([]models.TrashItem, error) {
+	m.mu.RLock()
+	items := make([]models.TrashItem, 0, len(m.trash[userId]))
+	for trashId, trash := range m.trash[userId] {
+		if !trash.moved {
+			items = append(items, trash.item(trashId))
+		}
+	}
+	m.mu.RUnlock()
+
+	//Порядок тот же, что и в SQL хранилище
+	slices.SortFunc(items, func(a, b models.TrashItem) int {
+		return cmp.Or(b.DeletedAt.Compare(a.DeletedAt), strings.Compare(a.Identifier, b.Identifier))
+	})
+
+	return items, nil
+}
+
+func (m *MemStorage) RestoreTrash(ctx context.Context, userId string, trashId string) (models.TrashItem, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	trash, ok := m.trash[userId][trashId]
+	if !ok || trash.moved {
+		return models.TrashItem{}, fmt.Errorf("trash item %s: %w", trashId, ErrNotFound)
+	}
+
+	item := trash.item(trashId)
+	if _, ok := m.data[userId][trash.dataId]; ok {
+		return item, fmt.Errorf("data %s: %w", trash.dataId, ErrAlreadyExist)
+	}
+
+	userData, ok := m.data[userId]
+	if !ok {
+		userData = make(map[string]*memEntry)
+		m.data[userId] = userData
+	}
+
+	seq := m.nextSeq(userId)
+	trash.entry.changeSeq = seq
+	trash.entry.createdSeq = seq
+	userData[trash.dataId] = trash.entry
+	delete(m.trash[userId], trashId)
+
+	return item, nil
+}
+
+func (m *MemStorage) DeleteTrash(ctx context.Context, userId string, trashId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if trash, ok := m.trash[userId][trashId]; !ok || trash.moved {
+		return fmt.Errorf("trash item %s: %w", trashId, ErrNotFound)
+	}
+
+	m.purge(userId, trashId)
+
+	return nil
+}
+
+func (m *MemStorage) EmptyTrash(ctx context.Context, userId string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	//Следы перемещений остаются до истечения срока хранения корзины, как в SQL хранилище
+	var count int64
+	for trashId, trash := range m.trash[userId] {
+		if !trash.moved {
+			m.purge(userId, trashId)
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (m *MemStorage) PurgeTrash(ctx context.Context, before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var count int64
+	for userId, userTrash := range m.trash {
+		for trashId, trash := range userTrash {
+			if trash.deletedAt.Before(before) {
+				m.purge(userId, trashId)
+				count++
+			}
+		}
+	}
+
+	return count, nil
+}
+
+// purge окончательно удаляет данные из корзины вместе с содержимым загрузок.
+// Номер удаления запоминается у пользователя: курсоры синхронизации до него больше не видят удаление.
+func (m *MemStorage) purge(userId string, trashId string) {
+	entry := m.trash[userId][trashId].entry
+	delete(m.trash[userId], trashId)
+
+	seqs := m.userSeqs(userId)
+	seqs.purged = max(seqs.purged, entry.changeSeq)
+
+	//Содержимое загрузок хранится отдельно от данных
+	for _, revision := range entry.history {
+		delete(m.blobs, revision.blob)
+	}
+	delete(m.blobs, entry.blob)
+	for _, attachment := range entry.attachments {
+		delete(m.blobs, attachment.blob)
+	}
+
+	//Передачи данных удаляются вместе с ними, как каскадом в SQL хранилище
+	for shareId, share := range m.shares {
+		if share.entry == entry {
+			delete(m.shares, shareId)
+		}
+	}
+}
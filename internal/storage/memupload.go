@@ -0,0 +1,217 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+// memBlob содержимое, загруженное по частям
+type memBlob struct {
+	userId    string    // владелец
+	size      int64     // полный размер
+	chunks    [][]byte  // части в порядке загрузки
+	createdAt time.Time // время начала загрузки
+}
+
+func (m *MemStorage) WriteContent(ctx context.Context, entry Entry, w io.Writer) error {
+	if entry.blob == `` {
+		if _, err := w.Write(entry.Data); err != nil {
+			return fmt.Errorf("cannot write content: %w", err)
+		}
+		return nil
+	}
+
+	//Части не меняются после загрузки, поэтому пишем их без блокировки
+	m.mu.RLock()
+	blob, ok := m.blobs[entry.blob]
+	var chunks [][]byte
+	if ok {
+		chunks = blob.chunks
+	}
+	m.mu.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("content %s: %w", entry.blob, ErrNotFound)
+	}
+
+	for _, chunk := range chunks {
+		if _, err := w.Write(chunk); err != nil {
+			return fmt.Errorf("cannot write content: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (m *MemStorage) CreateUpload(ctx context.Context, userId string, upload Upload) (string, error) {
+
+	id, err := newUUID()
+	if err != nil {
+		return ``, fmt.Errorf("cannot generate upload id: %w", err)
+	}
+
+	upload.Uploaded = 0
+	upload.Metadata = cloneBytes(upload.Metadata)
+	upload.Key = cloneBytes(upload.Key)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.blobs[id] = &memBlob{userId: userId, size: upload.Size, createdAt: time.Now().UTC()}
+	m.uploads[id] = &upload
+
+	return id, nil
+}
+
+func (m *MemStorage) GetUpload(ctx context.Context, userId string, uploadId string) (Upload, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	upload, err := m.upload(userId, uploadId)
+	if err != nil {
+		return Upload{}, err
+	}
+
+	result := *upload
+	result.Metadata = cloneBytes(upload.Metadata)
+	result.Key = cloneBytes(upload.Key)
+
+	return result, nil
+}
+
+// upload находит незавершенную загрузку пользователя, вызывается под блокировкой
+func (m *MemStorage) upload(userId string, uploadId string) (*Upload, error) {
+	upload, ok := m.uploads[uploadId]
+	if !ok || m.blobs[uploadId].userId != userId {
+		return nil, fmt.Errorf("upload %s: %w", uploadId, ErrNotFound)
+	}
+	return upload, nil
+}
+
+func (m *MemStorage) AppendUpload(ctx context.Context, userId string, uploadId string, offset int64, r io.Reader) (int64, error) {
+
+	upload, err := m.GetUpload(ctx, userId, uploadId)
+	if err != nil {
+		return 0, err
+	}
+	if upload.Uploaded != offset {
+		return upload.Uploaded, fmt.Errorf("upload %s has %d bytes, got offset %d: %w", uploadId, upload.Uploaded, offset, ErrOffsetMismatch)
+	}
+
+	return writeChunks(r, offset, upload.Size, func(start int64, chunk []byte) error {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		upload, err := m.upload(userId, uploadId)
+		if err != nil {
+			return err
+		}
+		if upload.Uploaded != start {
+			return fmt.Errorf("upload %s has %d bytes, got offset %d: %w", uploadId, upload.Uploaded, start, ErrOffsetMismatch)
+		}
+
+		blob := m.blobs[uploadId]
+		blob.chunks = append(blob.chunks, cloneBytes(chunk))
+		upload.Uploaded += int64(len(chunk))
+
+		return nil
+	})
+}
+
+func (m *MemStorage) CompleteUpload(ctx context.Context, userId string, uploadId string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	upload, err := m.upload(userId, uploadId)
+	if err != nil {
+		return 0, err
+	}
+	if upload.Uploaded != upload.Size {
+		return 0, fmt.Errorf("upload %s is incomplete: %d of %d bytes", uploadId, upload.Uploaded, upload.Size)
+	}
+
+	if upload.Attachment != `` {
+		revision, err := m.attachUpload(userId, uploadId, upload)
+		if err != nil {
+			return 0, err
+		}
+		delete(m.uploads, uploadId)
+		return revision, nil
+	}
+
+	next := memRevision{
+		metadata:  upload.Metadata,
+		blob:      uploadId,
+		size:      upload.Size,
+		createdAt: time.Now().UTC(),
+	}
+
+	var revision int64
+	entry, ok := m.data[userId][upload.DataId]
+	switch {
+	case !ok && upload.Expected != 0:
+		return 0, fmt.Errorf("data %s: %w", upload.DataId, ErrNotFound)
+	case !ok:
+		userData, ok := m.data[userId]
+		if !ok {
+			userData = make(map[string]*memEntry)
+			m.data[userId] = userData
+		}
+		seq := m.nextSeq(userId)
+		userData[upload.DataId] = &memEntry{memRevision: next, revision: 1, changeSeq: seq, createdSeq: seq}
+		revision = 1
+	case upload.CreateOnly:
+		return 0, fmt.Errorf("data %s: %w", upload.DataId, ErrAlreadyExist)
+	case upload.Expected != 0 && upload.Expected != entry.revision:
+		return 0, fmt.Errorf("data %s revision %d, expected %d: %w", upload.DataId, entry.revision, upload.Expected, ErrRevisionMismatch)
+	default:
+		if next.metadata == nil {
+			next.metadata = entry.metadata
+		}
+		revision = entry.replace(next, m.nextSeq(userId))
+	}
+
+	delete(m.uploads, uploadId)
+
+	return revision, nil
+}
+
+func (m *MemStorage) DeleteUpload(ctx context.Context, userId string, uploadId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := m.upload(userId, uploadId); err != nil {
+		return err
+	}
+
+	delete(m.uploads, uploadId)
+	delete(m.blobs, uploadId)
+
+	return nil
+}
+
+func (m *MemStorage) PurgeUploads(ctx context.Context, before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var count int64
+	for uploadId := range m.uploads {
+		if m.blobs[uploadId].createdAt.Before(before) {
+			delete(m.uploads, uploadId)
+			delete(m.blobs, uploadId)
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// cloneBytes копия среза, сохраняющая различие nil и пустого среза
+func cloneBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
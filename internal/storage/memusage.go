@@ -0,0 +1,37 @@
+package storage
+
+import (
+	"context"
+	"github.com/lionslon/go-keepass/internal/models"
+)
+
+func (m *MemStorage) GetUsage(ctx context.Context, userId string) (models.Usage, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	usage := models.Usage{Entries: int64(len(m.data[userId]))}
+
+	//Содержимое загрузок учитывается отдельно, по одному разу
+	for _, entry := range m.data[userId] {
+		usage.Bytes += entry.stored()
+	}
+	for _, trash := range m.trash[userId] {
+		usage.Bytes += trash.entry.stored()
+	}
+	for _, blob := range m.blobs {
+		if blob.userId == userId {
+			usage.Bytes += blob.size
+		}
+	}
+
+	return usage, nil
+}
+
+// stored объем данных и метаданных всех ревизий без содержимого загрузок
+func (m *memEntry) stored() int64 {
+	size := int64(len(m.data) + len(m.metadata))
+	for _, revision := range m.history {
+		size += int64(len(revision.data) + len(revision.metadata))
+	}
+	return size
+}
@@ -0,0 +1,354 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	createMigrationsTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version BIGINT NOT NULL,
+		name VARCHAR(255) NOT NULL,
+		applied_at TIMESTAMP NOT NULL,
+		PRIMARY KEY (version)
+	)`
+	getAppliedMigrations = `SELECT version, applied_at FROM schema_migrations`
+	addMigration         = `INSERT INTO schema_migrations (version, name, applied_at) VALUES($1,$2,$3)`
+	deleteMigration      = `DELETE FROM schema_migrations WHERE version = $1`
+
+	upSuffix   = ".up.sql"
+	downSuffix = ".down.sql"
+)
+
+// migrationsFS наборы миграций, по каталогу на диалект
+//
+//go:embed migrations
+var migrationsFS embed.FS
+
+// Migration одна версия схемы базы
+type Migration struct {
+	Version int64  // номер версии, миграции применяются по возрастанию
+	Name    string // название из имени файла
+	up      string // запросы применения
+	down    string // запросы отката
+}
+
+// MigrationStatus состояние миграции в базе
+type MigrationStatus struct {
+	Migration
+	Applied   bool      // применена ли миграция
+	AppliedAt time.Time // время применения
+}
+
+// Migrator применяет и откатывает встроенные миграции схемы.
+type Migrator struct {
+	conn       *sql.DB
+	dialect    dialect
+	migrations []Migration
+}
+
+// OpenMigrator подключается к базе, указанной в dsn, не применяя миграции.
+func OpenMigrator(dsn string) (*Migrator, error) {
+	var d dialect
+	switch {
+	case strings.HasPrefix(dsn, memScheme):
+		return nil, fmt.Errorf("in-memory storage has no schema to migrate")
+	case strings.HasPrefix(dsn, sqliteScheme):
+		d = sqliteDialect
+		dsn = sqliteDSN(dsn)
+	default:
+		d = postgresDialect
+	}
+
+	conn, err := openDB(d, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	migrator, err := newMigrator(conn, d)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return migrator, nil
+}
+
+func newMigrator(conn *sql.DB, d dialect) (*Migrator, error) {
+	migrations, err := loadMigrations(d.name)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load %s migrations: %w", d.name, err)
+	}
+
+	return &Migrator{
+		conn:       conn,
+		dialect:    d,
+		migrations: migrations,
+	}, nil
+}
+
+// loadMigrations разбирает файлы вида 0001_name.up.sql / 0001_name.down.sql из каталога диалекта
+func loadMigrations(dir string) ([]Migration, error) {
+	dir = path.Join("migrations", dir)
+
+	entries, err := fs.ReadDir(migrationsFS, dir)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read migrations dir: %w", err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		file := entry.Name()
+
+		var base string
+		var up bool
+		switch {
+		case strings.HasSuffix(file, upSuffix):
+			base, up = strings.TrimSuffix(file, upSuffix), true
+		case strings.HasSuffix(file, downSuffix):
+			base = strings.TrimSuffix(file, downSuffix)
+		default:
+			continue
+		}
+
+		number, name, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("bad migration file name %s", file)
+		}
+		version, err := strconv.ParseInt(number, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad migration version in %s: %w", file, err)
+		}
+
+		query, err := fs.ReadFile(migrationsFS, path.Join(dir, file))
+		if err != nil {
+			return nil, fmt.Errorf("cannot read migration %s: %w", file, err)
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: name}
+			byVersion[version] = migration
+		}
+		if migration.Name != name {
+			return nil, fmt.Errorf("migration %d has different names: %s and %s", version, migration.Name, name)
+		}
+
+		if up {
+			migration.up = string(query)
+		} else {
+			migration.down = string(query)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.up == `` {
+			return nil, fmt.Errorf("migration %d_%s has no up script", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+func (m *Migrator) Close() {
+	m.conn.Close()
+}
+
+// Status возвращает все известные миграции с признаком применения.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			appliedAt, ok := applied[migration.Version]
+			statuses = append(statuses, MigrationStatus{
+				Migration: migration,
+				Applied:   ok,
+				AppliedAt: appliedAt,
+			})
+		}
+		return nil
+	})
+
+	return statuses, err
+}
+
+// Up применяет не более steps еще не примененных миграций (все, если steps <= 0).
+func (m *Migrator) Up(ctx context.Context, steps int) ([]Migration, error) {
+	var done []Migration
+
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if steps > 0 && len(done) == steps {
+				break
+			}
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+
+			applied, err := m.apply(ctx, conn, migration, true)
+			if err != nil {
+				return err
+			}
+			if applied {
+				done = append(done, migration)
+			}
+		}
+		return nil
+	})
+
+	return done, err
+}
+
+// Down откатывает не более steps последних примененных миграций (одну, если steps <= 0).
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	if steps <= 0 {
+		steps = 1
+	}
+
+	var done []Migration
+
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+			if migration.down == `` {
+				return fmt.Errorf("migration %d_%s cannot be reverted: no down script", migration.Version, migration.Name)
+			}
+
+			reverted, err := m.apply(ctx, conn, migration, false)
+			if err != nil {
+				return err
+			}
+			if reverted {
+				done = append(done, migration)
+			}
+		}
+		return nil
+	})
+
+	return done, err
+}
+
+// withLock выполняет fn на выделенном соединении, удерживая блокировку миграций,
+// чтобы параллельно стартующие экземпляры сервера не применяли миграции одновременно
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.conn.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot get db connection: %w", err)
+	}
+	defer conn.Close()
+
+	if err := m.dialect.lockMigrations(ctx, conn); err != nil {
+		return fmt.Errorf("cannot acquire migrations lock: %w", err)
+	}
+	defer m.dialect.unlockMigrations(context.Background(), conn)
+
+	if _, err := conn.ExecContext(ctx, createMigrationsTable); err != nil {
+		return fmt.Errorf("cannot create schema_migrations table: %w", err)
+	}
+
+	return fn(conn)
+}
+
+// applied возвращает примененные версии и время их применения
+func (m *Migrator) applied(ctx context.Context, conn *sql.Conn) (map[int64]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, getAppliedMigrations)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]time.Time)
+	for rows.Next() {
+		var version int64
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("cannot scan applied migration: %w", err)
+		}
+		applied[version] = appliedAt
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read applied migrations: %w", err)
+	}
+
+	return applied, nil
+}
+
+// apply применяет (up) или откатывает миграцию вместе с записью в schema_migrations в одной транзакции.
+// Возвращает false, если миграцию уже применил (откатил) другой экземпляр.
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, migration Migration, up bool) (bool, error) {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("cannot begin transaction: %w", err)
+	}
+
+	defer tx.Rollback()
+
+	// Отметку о версии меняем первой: так транзакция сразу берет блокировку на запись,
+	// а конфликт отметки означает, что миграцию уже применил (откатил) кто-то другой
+	query := migration.up
+	if up {
+		_, err = tx.ExecContext(ctx, addMigration, migration.Version, migration.Name, time.Now().UTC())
+		if m.dialect.isUniqueViolation(err) {
+			return false, nil
+		}
+	} else {
+		query = migration.down
+
+		var result sql.Result
+		result, err = tx.ExecContext(ctx, deleteMigration, migration.Version)
+		if err == nil {
+			if affected, _ := result.RowsAffected(); affected == 0 {
+				return false, nil
+			}
+		}
+	}
+	if err != nil {
+		return false, fmt.Errorf("cannot mark migration %d_%s: %w", migration.Version, migration.Name, err)
+	}
+
+	if _, err := tx.ExecContext(ctx, query); err != nil {
+		return false, fmt.Errorf("cannot execute migration %d_%s: %w", migration.Version, migration.Name, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("cannot comit migration %d_%s: %w", migration.Version, migration.Name, err)
+	}
+
+	return true, nil
+}
+
+// noMigrationsLock используется базами, которые сами сериализуют транзакции на запись
+func noMigrationsLock(context.Context, *sql.Conn) error {
+	return nil
+}
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS data;
+DROP TABLE IF EXISTS users;
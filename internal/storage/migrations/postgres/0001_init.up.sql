@@ -0,0 +1,21 @@
+-- это для возможности генерации uuid
+CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
+
+-- таблица для хранения пользователей
+CREATE TABLE IF NOT EXISTS users (
+    id uuid DEFAULT uuid_generate_v4 (),
+    login VARCHAR(255) UNIQUE NOT NULL,
+    password VARCHAR(255),
+    PRIMARY KEY (id)
+);
+
+-- таблица для хранения данных пользователя
+CREATE TABLE IF NOT EXISTS data (
+    id uuid DEFAULT uuid_generate_v4 (),
+    user_id uuid,
+    data_id VARCHAR(255) NOT NULL,
+    data BYTEA,
+    PRIMARY KEY (id),
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    UNIQUE (user_id, data_id)
+);
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS data_revisions;
+
+ALTER TABLE data
+    DROP COLUMN IF EXISTS revision,
+    DROP COLUMN IF EXISTS created_at,
+    DROP COLUMN IF EXISTS updated_at;
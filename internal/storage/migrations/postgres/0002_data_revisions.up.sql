@@ -0,0 +1,15 @@
+-- текущая ревизия и время изменения записи
+ALTER TABLE data
+    ADD COLUMN revision BIGINT NOT NULL DEFAULT 1,
+    ADD COLUMN created_at TIMESTAMP NOT NULL DEFAULT (now() AT TIME ZONE 'utc'),
+    ADD COLUMN updated_at TIMESTAMP NOT NULL DEFAULT (now() AT TIME ZONE 'utc');
+
+-- предыдущие ревизии записей, текущая хранится в data
+CREATE TABLE data_revisions (
+    data_id uuid NOT NULL,
+    revision BIGINT NOT NULL,
+    data BYTEA,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (data_id, revision),
+    FOREIGN KEY (data_id) REFERENCES data(id) ON DELETE CASCADE
+);
@@ -0,0 +1,2 @@
+ALTER TABLE data_revisions DROP COLUMN metadata;
+ALTER TABLE data DROP COLUMN metadata;
@@ -0,0 +1,3 @@
+-- зашифрованные клиентом метаданные записи (сайт, теги, заметки), хранятся рядом с данными
+ALTER TABLE data ADD COLUMN metadata BYTEA;
+ALTER TABLE data_revisions ADD COLUMN metadata BYTEA;
@@ -0,0 +1,5 @@
+ALTER TABLE data_revisions DROP COLUMN blob_id;
+ALTER TABLE data DROP COLUMN blob_id;
+DROP TABLE uploads;
+DROP TABLE blob_chunks;
+DROP TABLE blobs;
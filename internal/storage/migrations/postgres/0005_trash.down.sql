@@ -0,0 +1,12 @@
+-- содержимое корзины без нее не восстановить
+DELETE FROM data WHERE deleted_at IS NOT NULL;
+DELETE FROM blobs WHERE id NOT IN (
+    SELECT blob_id FROM data WHERE blob_id IS NOT NULL
+    UNION SELECT blob_id FROM data_revisions WHERE blob_id IS NOT NULL
+    UNION SELECT id FROM uploads
+);
+
+DROP INDEX data_deleted_at;
+DROP INDEX data_user_id_data_id_live;
+ALTER TABLE data ADD CONSTRAINT data_user_id_data_id_key UNIQUE (user_id, data_id);
+ALTER TABLE data DROP COLUMN deleted_at;
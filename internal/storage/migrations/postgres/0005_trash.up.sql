@@ -0,0 +1,7 @@
+-- удаленные записи попадают в корзину: deleted_at - время удаления, NULL - запись не удалена
+ALTER TABLE data ADD COLUMN deleted_at TIMESTAMP;
+
+-- идентификатор уникален только среди неудаленных записей, в корзине их может быть несколько
+ALTER TABLE data DROP CONSTRAINT data_user_id_data_id_key;
+CREATE UNIQUE INDEX data_user_id_data_id_live ON data (user_id, data_id) WHERE deleted_at IS NULL;
+CREATE INDEX data_deleted_at ON data (deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,10 @@
+-- последовательность изменений пользователя: каждое изменение данных получает следующий номер,
+-- по которому клиенты запрашивают изменения после своего курсора синхронизации.
+-- purged_seq - наибольший номер изменения, удаленного из корзины окончательно: курсоры до него устарели.
+ALTER TABLE users ADD COLUMN change_seq BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN purged_seq BIGINT NOT NULL DEFAULT 0;
+
+-- change_seq - номер последнего изменения строки (в том числе удаления), created_seq - номер создания
+ALTER TABLE data ADD COLUMN change_seq BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE data ADD COLUMN created_seq BIGINT NOT NULL DEFAULT 0;
+CREATE INDEX data_user_id_change_seq ON data (user_id, change_seq);
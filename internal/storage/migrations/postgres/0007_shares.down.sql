@@ -0,0 +1,3 @@
+DROP TABLE shares;
+ALTER TABLE users DROP COLUMN private_key;
+ALTER TABLE users DROP COLUMN public_key;
@@ -0,0 +1,20 @@
+-- пара ключей пользователя для обмена данными: открытый ключ в PEM и закрытый ключ, зашифрованный клиентом
+ALTER TABLE users ADD COLUMN public_key BYTEA;
+ALTER TABLE users ADD COLUMN private_key BYTEA;
+
+-- данные, переданные владельцем другому пользователю: wrapped_key - ключ данных, зашифрованный
+-- открытым ключом получателя. Передача привязана к строке data и удаляется вместе с ней из корзины.
+CREATE TABLE shares (
+    id uuid NOT NULL,
+    data_id uuid NOT NULL,
+    recipient_id uuid NOT NULL,
+    wrapped_key BYTEA NOT NULL,
+    permission VARCHAR(16) NOT NULL,
+    accepted BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (id),
+    FOREIGN KEY (data_id) REFERENCES data(id) ON DELETE CASCADE,
+    FOREIGN KEY (recipient_id) REFERENCES users(id),
+    UNIQUE (data_id, recipient_id)
+);
+CREATE INDEX shares_recipient_id ON shares (recipient_id);
@@ -0,0 +1,48 @@
+-- организации и их участники: role - owner, admin, member или readonly,
+-- accepted - участник принял приглашение и получил доступ к ключам коллекций
+CREATE TABLE organizations (
+    id uuid NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (id)
+);
+
+CREATE TABLE org_members (
+    org_id uuid NOT NULL,
+    user_id uuid NOT NULL,
+    role VARCHAR(16) NOT NULL,
+    accepted BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (org_id, user_id),
+    FOREIGN KEY (org_id) REFERENCES organizations(id),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+CREATE INDEX org_members_user_id ON org_members (user_id);
+
+-- общие коллекции организации. Данные коллекции хранятся от имени служебной учетной записи users
+-- с тем же идентификатором и без пароля, поэтому ревизии, корзина, загрузки, синхронизация и квота
+-- работают так же, как у пользователей. key_version - текущая версия ключа коллекции.
+CREATE TABLE collections (
+    id uuid NOT NULL,
+    org_id uuid NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    key_version BIGINT NOT NULL DEFAULT 1,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (id),
+    FOREIGN KEY (id) REFERENCES users(id),
+    FOREIGN KEY (org_id) REFERENCES organizations(id)
+);
+CREATE INDEX collections_org_id ON collections (org_id);
+
+-- ключи коллекций, зашифрованные открытыми ключами участников; предыдущие версии остаются,
+-- чтобы читать данные, сохраненные до смены ключа
+CREATE TABLE collection_keys (
+    collection_id uuid NOT NULL,
+    user_id uuid NOT NULL,
+    version BIGINT NOT NULL,
+    wrapped_key BYTEA NOT NULL,
+    PRIMARY KEY (collection_id, user_id, version),
+    FOREIGN KEY (collection_id) REFERENCES collections(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+CREATE INDEX collection_keys_user_id ON collection_keys (user_id);
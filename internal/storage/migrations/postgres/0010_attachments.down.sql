@@ -0,0 +1,13 @@
+-- содержимое вложений и незавершенных загрузок вложений больше не на что сослаться
+CREATE TEMPORARY TABLE attachment_blobs AS
+    SELECT blob_id AS id FROM attachments
+    UNION
+    SELECT id FROM uploads WHERE attachment IS NOT NULL;
+
+DROP TABLE attachments;
+DELETE FROM blobs WHERE id IN (SELECT id FROM attachment_blobs);
+DROP TABLE attachment_blobs;
+
+ALTER TABLE uploads DROP COLUMN attachment_key;
+ALTER TABLE uploads DROP COLUMN mime_type;
+ALTER TABLE uploads DROP COLUMN attachment;
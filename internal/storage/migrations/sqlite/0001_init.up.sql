@@ -0,0 +1,18 @@
+-- таблица для хранения пользователей
+CREATE TABLE IF NOT EXISTS users (
+    id TEXT NOT NULL,
+    login VARCHAR(255) UNIQUE NOT NULL,
+    password VARCHAR(255),
+    PRIMARY KEY (id)
+);
+
+-- таблица для хранения данных пользователя
+CREATE TABLE IF NOT EXISTS data (
+    id TEXT NOT NULL,
+    user_id TEXT,
+    data_id VARCHAR(255) NOT NULL,
+    data BLOB,
+    PRIMARY KEY (id),
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    UNIQUE (user_id, data_id)
+);
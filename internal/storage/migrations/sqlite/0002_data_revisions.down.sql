@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS data_revisions;
+
+ALTER TABLE data DROP COLUMN revision;
+ALTER TABLE data DROP COLUMN created_at;
+ALTER TABLE data DROP COLUMN updated_at;
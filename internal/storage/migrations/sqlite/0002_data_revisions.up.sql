@@ -0,0 +1,16 @@
+-- текущая ревизия и время изменения записи,
+-- SQLite не разрешает выражения по умолчанию при добавлении столбца, поэтому проставляем время отдельно
+ALTER TABLE data ADD COLUMN revision BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE data ADD COLUMN created_at TIMESTAMP NOT NULL DEFAULT '1970-01-01 00:00:00';
+ALTER TABLE data ADD COLUMN updated_at TIMESTAMP NOT NULL DEFAULT '1970-01-01 00:00:00';
+UPDATE data SET created_at = datetime('now'), updated_at = datetime('now');
+
+-- предыдущие ревизии записей, текущая хранится в data
+CREATE TABLE data_revisions (
+    data_id TEXT NOT NULL,
+    revision BIGINT NOT NULL,
+    data BLOB,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (data_id, revision),
+    FOREIGN KEY (data_id) REFERENCES data(id) ON DELETE CASCADE
+);
@@ -0,0 +1,34 @@
+-- содержимое, загруженное по частям: большие данные хранятся не в строке data, а частями в blob_chunks
+CREATE TABLE blobs (
+    id TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    size BIGINT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (id),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+-- части содержимого, start - смещение части от начала содержимого
+CREATE TABLE blob_chunks (
+    blob_id TEXT NOT NULL,
+    start BIGINT NOT NULL,
+    data BLOB NOT NULL,
+    PRIMARY KEY (blob_id, start),
+    FOREIGN KEY (blob_id) REFERENCES blobs(id) ON DELETE CASCADE
+);
+
+-- незавершенные загрузки, идентификатор совпадает с идентификатором загружаемого содержимого
+CREATE TABLE uploads (
+    id TEXT NOT NULL,
+    data_id VARCHAR(255) NOT NULL,
+    uploaded BIGINT NOT NULL DEFAULT 0,
+    metadata BLOB,
+    expected_revision BIGINT NOT NULL DEFAULT 0,
+    create_only BOOLEAN NOT NULL DEFAULT 0,
+    PRIMARY KEY (id),
+    FOREIGN KEY (id) REFERENCES blobs(id) ON DELETE CASCADE
+);
+
+-- SQLite не умеет удалять столбцы, участвующие во внешних ключах, поэтому ссылки на blobs без ограничения
+ALTER TABLE data ADD COLUMN blob_id TEXT;
+ALTER TABLE data_revisions ADD COLUMN blob_id TEXT;
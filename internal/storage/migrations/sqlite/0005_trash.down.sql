@@ -0,0 +1,43 @@
+-- содержимое корзины без нее не восстановить
+DELETE FROM data WHERE deleted_at IS NOT NULL;
+DELETE FROM blobs WHERE id NOT IN (
+    SELECT blob_id FROM data WHERE blob_id IS NOT NULL
+    UNION SELECT blob_id FROM data_revisions WHERE blob_id IS NOT NULL
+    UNION SELECT id FROM uploads
+);
+
+-- возвращаем ограничение уникальности, пересоздавая таблицы, как при применении миграции
+CREATE TABLE data_old (
+    id TEXT NOT NULL,
+    user_id TEXT,
+    data_id VARCHAR(255) NOT NULL,
+    data BLOB,
+    revision BIGINT NOT NULL DEFAULT 1,
+    created_at TIMESTAMP NOT NULL DEFAULT '1970-01-01 00:00:00',
+    updated_at TIMESTAMP NOT NULL DEFAULT '1970-01-01 00:00:00',
+    metadata BLOB,
+    blob_id TEXT,
+    PRIMARY KEY (id),
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    UNIQUE (user_id, data_id)
+);
+INSERT INTO data_old (id, user_id, data_id, data, revision, created_at, updated_at, metadata, blob_id)
+    SELECT id, user_id, data_id, data, revision, created_at, updated_at, metadata, blob_id FROM data;
+
+CREATE TABLE data_revisions_old (
+    data_id TEXT NOT NULL,
+    revision BIGINT NOT NULL,
+    data BLOB,
+    created_at TIMESTAMP NOT NULL,
+    metadata BLOB,
+    blob_id TEXT,
+    PRIMARY KEY (data_id, revision),
+    FOREIGN KEY (data_id) REFERENCES data_old(id) ON DELETE CASCADE
+);
+INSERT INTO data_revisions_old (data_id, revision, data, created_at, metadata, blob_id)
+    SELECT data_id, revision, data, created_at, metadata, blob_id FROM data_revisions;
+
+DROP TABLE data_revisions;
+DROP TABLE data;
+ALTER TABLE data_old RENAME TO data;
+ALTER TABLE data_revisions_old RENAME TO data_revisions;
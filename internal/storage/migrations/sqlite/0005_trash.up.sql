@@ -0,0 +1,41 @@
+-- удаленные записи попадают в корзину: deleted_at - время удаления, NULL - запись не удалена.
+-- Идентификатор уникален только среди неудаленных записей, а SQLite не умеет удалять ограничение
+-- уникальности, поэтому data пересоздается. data_revisions пересоздается вместе с ней,
+-- иначе удаление старой data каскадно удалило бы историю ревизий.
+CREATE TABLE data_new (
+    id TEXT NOT NULL,
+    user_id TEXT,
+    data_id VARCHAR(255) NOT NULL,
+    data BLOB,
+    revision BIGINT NOT NULL DEFAULT 1,
+    created_at TIMESTAMP NOT NULL DEFAULT '1970-01-01 00:00:00',
+    updated_at TIMESTAMP NOT NULL DEFAULT '1970-01-01 00:00:00',
+    metadata BLOB,
+    blob_id TEXT,
+    deleted_at TIMESTAMP,
+    PRIMARY KEY (id),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+INSERT INTO data_new (id, user_id, data_id, data, revision, created_at, updated_at, metadata, blob_id)
+    SELECT id, user_id, data_id, data, revision, created_at, updated_at, metadata, blob_id FROM data;
+
+CREATE TABLE data_revisions_new (
+    data_id TEXT NOT NULL,
+    revision BIGINT NOT NULL,
+    data BLOB,
+    created_at TIMESTAMP NOT NULL,
+    metadata BLOB,
+    blob_id TEXT,
+    PRIMARY KEY (data_id, revision),
+    FOREIGN KEY (data_id) REFERENCES data_new(id) ON DELETE CASCADE
+);
+INSERT INTO data_revisions_new (data_id, revision, data, created_at, metadata, blob_id)
+    SELECT data_id, revision, data, created_at, metadata, blob_id FROM data_revisions;
+
+DROP TABLE data_revisions;
+DROP TABLE data;
+ALTER TABLE data_new RENAME TO data;
+ALTER TABLE data_revisions_new RENAME TO data_revisions;
+
+CREATE UNIQUE INDEX data_user_id_data_id_live ON data (user_id, data_id) WHERE deleted_at IS NULL;
+CREATE INDEX data_deleted_at ON data (deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,5 @@
+DROP INDEX data_user_id_change_seq;
+ALTER TABLE data DROP COLUMN created_seq;
+ALTER TABLE data DROP COLUMN change_seq;
+ALTER TABLE users DROP COLUMN purged_seq;
+ALTER TABLE users DROP COLUMN change_seq;
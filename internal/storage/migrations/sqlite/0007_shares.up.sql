@@ -0,0 +1,20 @@
+-- пара ключей пользователя для обмена данными: открытый ключ в PEM и закрытый ключ, зашифрованный клиентом
+ALTER TABLE users ADD COLUMN public_key BLOB;
+ALTER TABLE users ADD COLUMN private_key BLOB;
+
+-- данные, переданные владельцем другому пользователю: wrapped_key - ключ данных, зашифрованный
+-- открытым ключом получателя. Передача привязана к строке data и удаляется вместе с ней из корзины.
+CREATE TABLE shares (
+    id TEXT NOT NULL,
+    data_id TEXT NOT NULL,
+    recipient_id TEXT NOT NULL,
+    wrapped_key BLOB NOT NULL,
+    permission VARCHAR(16) NOT NULL,
+    accepted BOOLEAN NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (id),
+    FOREIGN KEY (data_id) REFERENCES data(id) ON DELETE CASCADE,
+    FOREIGN KEY (recipient_id) REFERENCES users(id),
+    UNIQUE (data_id, recipient_id)
+);
+CREATE INDEX shares_recipient_id ON shares (recipient_id);
@@ -0,0 +1,10 @@
+-- вместе с коллекциями удаляются их данные и служебные учетные записи
+DELETE FROM data WHERE user_id IN (SELECT id FROM collections);
+DELETE FROM blobs WHERE user_id IN (SELECT id FROM collections);
+
+DROP TABLE collection_keys;
+DROP TABLE collections;
+DROP TABLE org_members;
+DROP TABLE organizations;
+
+DELETE FROM users WHERE login LIKE 'collection:%' AND password IS NULL;
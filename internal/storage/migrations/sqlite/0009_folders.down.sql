@@ -0,0 +1,8 @@
+-- ключ перемещенных данных получен из прежнего идентификатора, без origin клиент его не найдет:
+-- такие данные возвращаются в корзину под прежним идентификатором, откуда их можно восстановить
+DELETE FROM data WHERE moved;
+UPDATE data SET data_id = origin, deleted_at = COALESCE(deleted_at, updated_at) WHERE origin IS NOT NULL;
+
+DROP TABLE folders;
+ALTER TABLE data DROP COLUMN moved;
+ALTER TABLE data DROP COLUMN origin;
@@ -0,0 +1,15 @@
+-- перемещение меняет идентификатор данных, но не ключ, полученный клиентом из идентификатора:
+-- origin - идентификатор, от которого получен ключ, NULL - совпадает с data_id.
+-- moved - строка-след перемещенных данных под прежним идентификатором: она в корзине, чтобы синхронизация
+-- сообщила клиентам об исчезновении прежнего идентификатора, не показывается в корзине и удаляется вместе с ней.
+ALTER TABLE data ADD COLUMN origin VARCHAR(255);
+ALTER TABLE data ADD COLUMN moved BOOLEAN NOT NULL DEFAULT 0;
+
+-- папки, созданные явно; папки, в которых есть данные, следуют из идентификаторов и не хранятся
+CREATE TABLE folders (
+    user_id TEXT NOT NULL,
+    path VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, path),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
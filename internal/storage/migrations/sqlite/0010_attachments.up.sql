@@ -0,0 +1,18 @@
+-- вложения данных: содержимое загружается по частям в blobs, как большие данные, и не входит в ревизии.
+-- data_id - строка данных, поэтому вложения переносятся, удаляются в корзину и восстанавливаются вместе с ней.
+CREATE TABLE attachments (
+    data_id TEXT NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    mime_type VARCHAR(255) NOT NULL,
+    key BLOB NOT NULL,
+    blob_id TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (data_id, name),
+    FOREIGN KEY (data_id) REFERENCES data(id) ON DELETE CASCADE,
+    FOREIGN KEY (blob_id) REFERENCES blobs(id)
+);
+
+-- загрузка вложения вместо новой ревизии данных: attachment - имя вложения, NULL - загружается ревизия
+ALTER TABLE uploads ADD COLUMN attachment VARCHAR(255);
+ALTER TABLE uploads ADD COLUMN mime_type VARCHAR(255);
+ALTER TABLE uploads ADD COLUMN attachment_key BLOB;
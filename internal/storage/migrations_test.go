@@ -0,0 +1,237 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// openTestMigrator открывает мигратор пустого файла базы SQLite
+func openTestMigrator(t *testing.T) *Migrator {
+	t.Helper()
+
+	migrator, err := OpenMigrator(sqliteScheme + filepath.Join(t.TempDir(), "keeper.db"))
+	if err != nil {
+		t.Fatalf("OpenMigrator() error = %v", err)
+	}
+	t.Cleanup(migrator.Close)
+
+	return migrator
+}
+
+// appliedVersions версии из schema_migrations
+func appliedVersions(t *testing.T, m *Migrator) map[int64]bool {
+	t.Helper()
+
+	rows, err := m.conn.Query(`SELECT version FROM schema_migrations`)
+	if err != nil {
+		t.Fatalf("select schema_migrations error = %v", err)
+	}
+	defer rows.Close()
+
+	versions := make(map[int64]bool)
+	for rows.Next() {
+		var version int64
+		if err := rows.Scan(&version); err != nil {
+			t.Fatalf("scan schema_migrations error = %v", err)
+		}
+		versions[version] = true
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("read schema_migrations error = %v", err)
+	}
+
+	return versions
+}
+
+// userTables таблицы базы, кроме служебных
+func userTables(t *testing.T, m *Migrator) []string {
+	t.Helper()
+
+	tables, err := queryStrings(context.Background(), m.conn,
+		`SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' AND name <> 'schema_migrations'`)
+	if err != nil {
+		t.Fatalf("select tables error = %v", err)
+	}
+	return tables
+}
+
+func TestLoadMigrations(t *testing.T) {
+	for _, dialect := range []string{"sqlite", "postgres"} {
+		migrations, err := loadMigrations(dialect)
+		if err != nil {
+			t.Fatalf("loadMigrations(%s) error = %v", dialect, err)
+		}
+		for i, migration := range migrations {
+			if migration.Version != int64(i+1) {
+				t.Errorf("%s migration %d version = %d, want %d", dialect, i, migration.Version, i+1)
+			}
+			if migration.up == `` || migration.down == `` {
+				t.Errorf("%s migration %04d_%s has no up or down script", dialect, migration.Version, migration.Name)
+			}
+		}
+	}
+
+	//Наборы диалектов должны совпадать, иначе схемы баз разойдутся
+	sqlite, _ := loadMigrations("sqlite")
+	postgres, _ := loadMigrations("postgres")
+	if len(sqlite) != len(postgres) {
+		t.Fatalf("sqlite has %d migrations, postgres has %d", len(sqlite), len(postgres))
+	}
+	for i := range sqlite {
+		if sqlite[i].Name != postgres[i].Name {
+			t.Errorf("migration %d name: sqlite %s, postgres %s", sqlite[i].Version, sqlite[i].Name, postgres[i].Name)
+		}
+	}
+}
+
+func TestMigratorRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	m := openTestMigrator(t)
+	total := len(m.migrations)
+
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	if len(statuses) != total {
+		t.Fatalf("Status() = %d migrations, want %d", len(statuses), total)
+	}
+	for _, status := range statuses {
+		if status.Applied {
+			t.Errorf("Status() migration %d applied on empty db", status.Version)
+		}
+	}
+
+	//Применяем по шагам, затем остальные
+	done, err := m.Up(ctx, 2)
+	if err != nil {
+		t.Fatalf("Up(2) error = %v", err)
+	}
+	if len(done) != 2 || done[0].Version != 1 || done[1].Version != 2 {
+		t.Fatalf("Up(2) = %v, want versions 1, 2", done)
+	}
+	done, err = m.Up(ctx, 0)
+	if err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+	if len(done) != total-2 {
+		t.Fatalf("Up() = %d migrations, want %d", len(done), total-2)
+	}
+	if versions := appliedVersions(t, m); len(versions) != total {
+		t.Errorf("schema_migrations = %v, want %d versions", versions, total)
+	}
+
+	statuses, err = m.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	for _, status := range statuses {
+		if !status.Applied || status.AppliedAt.IsZero() {
+			t.Errorf("Status() migration %d = applied %v at %v, want applied", status.Version, status.Applied, status.AppliedAt)
+		}
+	}
+
+	if done, err := m.Up(ctx, 0); err != nil || len(done) != 0 {
+		t.Errorf("Up() up to date = %v, %v, want nothing", done, err)
+	}
+
+	//Откат по умолчанию - одна последняя миграция
+	done, err = m.Down(ctx, 0)
+	if err != nil {
+		t.Fatalf("Down() error = %v", err)
+	}
+	if len(done) != 1 || done[0].Version != int64(total) {
+		t.Fatalf("Down() = %v, want version %d", done, total)
+	}
+	if versions := appliedVersions(t, m); versions[int64(total)] || len(versions) != total-1 {
+		t.Errorf("schema_migrations after Down() = %v", versions)
+	}
+
+	//Полный откат в обратном порядке оставляет пустую базу
+	done, err = m.Down(ctx, total)
+	if err != nil {
+		t.Fatalf("Down(all) error = %v", err)
+	}
+	if len(done) != total-1 {
+		t.Fatalf("Down(all) = %d migrations, want %d", len(done), total-1)
+	}
+	for i, migration := range done {
+		if want := int64(total - 1 - i); migration.Version != want {
+			t.Errorf("Down(all) step %d version = %d, want %d", i, migration.Version, want)
+		}
+	}
+	if versions := appliedVersions(t, m); len(versions) != 0 {
+		t.Errorf("schema_migrations after Down(all) = %v, want empty", versions)
+	}
+	if tables := userTables(t, m); len(tables) != 0 {
+		t.Errorf("tables after Down(all) = %v, want none", tables)
+	}
+	if done, err := m.Down(ctx, 1); err != nil || len(done) != 0 {
+		t.Errorf("Down() on empty db = %v, %v, want nothing", done, err)
+	}
+
+	//Повторное применение восстанавливает рабочую схему
+	done, err = m.Up(ctx, 0)
+	if err != nil {
+		t.Fatalf("Up() again error = %v", err)
+	}
+	if len(done) != total {
+		t.Fatalf("Up() again = %d migrations, want %d", len(done), total)
+	}
+	if versions := appliedVersions(t, m); len(versions) != total {
+		t.Errorf("schema_migrations after Up() again = %v, want %d versions", versions, total)
+	}
+}
+
+// TestMigratorConcurrentUp проверяет, что экземпляры, одновременно мигрирующие один файл базы,
+// пропускают уже примененные другими миграции и вместе применяют каждую ровно один раз
+func TestMigratorConcurrentUp(t *testing.T) {
+	const instances = 4
+
+	dsn := sqliteScheme + filepath.Join(t.TempDir(), "keeper.db")
+	migrators := make([]*Migrator, instances)
+	for i := range migrators {
+		migrator, err := OpenMigrator(dsn)
+		if err != nil {
+			t.Fatalf("OpenMigrator() error = %v", err)
+		}
+		t.Cleanup(migrator.Close)
+		migrators[i] = migrator
+	}
+
+	var wg sync.WaitGroup
+	done := make([][]Migration, instances)
+	errs := make([]error, instances)
+	for i, migrator := range migrators {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			done[i], errs[i] = migrator.Up(context.Background(), 0)
+		}()
+	}
+	wg.Wait()
+
+	total := len(migrators[0].migrations)
+	applied := make(map[int64]int)
+	for i := range migrators {
+		if errs[i] != nil {
+			t.Errorf("Up() instance %d error = %v", i, errs[i])
+		}
+		for _, migration := range done[i] {
+			applied[migration.Version]++
+		}
+	}
+	if len(applied) != total {
+		t.Errorf("Up() applied %d migrations, want %d", len(applied), total)
+	}
+	for version, count := range applied {
+		if count != 1 {
+			t.Errorf("Up() migration %d applied %d times, want once", version, count)
+		}
+	}
+	if versions := appliedVersions(t, migrators[0]); len(versions) != total {
+		t.Errorf("schema_migrations = %v, want %d versions", versions, total)
+	}
+}
@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"cmp"
+	"fmt"
+	"github.com/lionslon/go-keepass/internal/models"
+	"slices"
+	"strings"
+)
+
+// collectionLoginPrefix префикс логина служебной учетной записи коллекции. У учетной записи нет пароля,
+// войти под ней нельзя, она нужна, чтобы данные коллекции хранились так же, как данные пользователей.
+const collectionLoginPrefix = "collection:"
+
+// collectionLogin логин служебной учетной записи коллекции
+func collectionLogin(collectionId string) string {
+	return collectionLoginPrefix + collectionId
+}
+
+// compareKeys порядок ключей коллекций: по коллекции, участнику и версии
+func compareKeys(a, b models.CollectionKey) int {
+	return cmp.Or(strings.Compare(a.Collection, b.Collection), strings.Compare(a.Login, b.Login), cmp.Compare(a.Version, b.Version))
+}
+
+// matchKeys проверяет, что keys содержит ровно по одному ключу на каждый из expected.
+// Ключи сравниваются по коллекции, участнику и версии, сами ключи в expected не заполнены.
+func matchKeys(keys []models.CollectionKey, expected []models.CollectionKey) error {
+	keys = slices.Clone(keys)
+	slices.SortFunc(keys, compareKeys)
+	slices.SortFunc(expected, compareKeys)
+
+	if len(keys) != len(expected) {
+		return fmt.Errorf("%d collection keys instead of %d: %w", len(keys), len(expected), ErrKeysMismatch)
+	}
+	for i := range keys {
+		if compareKeys(keys[i], expected[i]) != 0 {
+			return fmt.Errorf("unexpected key of collection %s for %q version %d: %w",
+				keys[i].Collection, keys[i].Login, keys[i].Version, ErrKeysMismatch)
+		}
+	}
+
+	return nil
+}
+
+// ownersLeft проверяет, что после изменения роли или удаления участника login в организации останется владелец
+func ownersLeft(members []models.Member, login string, role models.OrgRole) error {
+	for _, member := range members {
+		if member.Role == models.RoleOwner && member.Accepted && member.Login != login {
+			return nil
+		}
+	}
+	if role == models.RoleOwner {
+		return nil
+	}
+
+	return fmt.Errorf("organization must keep an owner: %w", ErrForbidden)
+}
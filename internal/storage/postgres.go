@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/jackc/pgx/v5/pgconn"
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+const (
+	pgUniqueViolation   = "23505"            // код ошибки PostgreSQL при нарушении ограничения уникальности
+	pgMigrationsLockKey = 0x6b6565706173735f // ключ advisory lock на время применения миграций ("keepass_")
+)
+
+// postgresDialect диалект PostgreSQL (драйвер pgx)
+var postgresDialect = dialect{
+	name:      "postgres",
+	driver:    "pgx",
+	forUpdate: " FOR UPDATE",
+	snapshot:  &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true},
+	lockMigrations: func(ctx context.Context, conn *sql.Conn) error {
+		_, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, pgMigrationsLockKey)
+		return err
+	},
+	unlockMigrations: func(ctx context.Context, conn *sql.Conn) error {
+		_, err := conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, pgMigrationsLockKey)
+		return err
+	},
+	isUniqueViolation: func(err error) bool {
+		var pgErr *pgconn.PgError
+		return errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation
+	},
+}
+
+// NewKeeperStorage создает хранилище в PostgreSQL.
+func NewKeeperStorage(dsn string) (*KeeperStorage, error) {
+	return newSQLStorage(postgresDialect, dsn)
+}
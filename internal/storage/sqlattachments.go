@@ -0,0 +1,174 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lionslon/go-keepass/internal/models"
+	"time"
+)
+
+const (
+	getDataRowId    = `SELECT id, origin FROM data WHERE user_id = $1 AND data_id = $2 AND deleted_at IS NULL`
+	listAttachments = `
+		SELECT a.name, a.mime_type, b.size, a.created_at
+		FROM attachments a JOIN blobs b ON b.id = a.blob_id WHERE a.data_id = $1 ORDER BY a.name`
+	getAttachment = `
+		SELECT a.name, a.mime_type, b.size, a.key, a.blob_id, a.created_at
+		FROM attachments a JOIN blobs b ON b.id = a.blob_id WHERE a.data_id = $1 AND a.name = $2`
+	getAttachmentBlob = `SELECT blob_id FROM attachments WHERE data_id = $1 AND name = $2`
+	addAttachment     = `INSERT INTO attachments (data_id, name, mime_type, key, blob_id, created_at) VALUES($1,$2,$3,$4,$5,$6)`
+	deleteAttachment  = `DELETE FROM attachments WHERE data_id = $1 AND name = $2`
+)
+
+func (m *KeeperStorage) ListAttachments(ctx context.Context, userId string, dataId string) ([]models.Attachment, error) {
+	tx, err := m.conn.BeginTx(ctx, m.dialect.snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("cannot begin transaction: %w", err)
+	}
+
+	defer tx.Rollback()
+
+	id, _, err := dataRowId(ctx, tx, userId, dataId)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.QueryContext(ctx, listAttachments, id)
+	if err != nil {
+		return nil, fmt.Errorf("cannot query attachments: %w", err)
+	}
+	defer rows.Close()
+
+	attachments := make([]models.Attachment, 0)
+	for rows.Next() {
+		var attachment models.Attachment
+		if err := rows.Scan(&attachment.Name, &attachment.MimeType, &attachment.Size, &attachment.CreatedAt); err != nil {
+			return nil, fmt.Errorf("cannot scan attachment: %w", err)
+		}
+		attachments = append(attachments, attachment)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read attachments: %w", err)
+	}
+
+	return attachments, nil
+}
+
+func (m *KeeperStorage) GetAttachment(ctx context.Context, userId string, dataId string, name string) (models.Attachment, Entry, error) {
+	var attachment models.Attachment
+	var content Entry
+
+	tx, err := m.conn.BeginTx(ctx, m.dialect.snapshot)
+	if err != nil {
+		return attachment, content, fmt.Errorf("cannot begin transaction: %w", err)
+	}
+
+	defer tx.Rollback()
+
+	id, origin, err := dataRowId(ctx, tx, userId, dataId)
+	if err != nil {
+		return attachment, content, err
+	}
+
+	row := tx.QueryRowContext(ctx, getAttachment, id, name)
+	err = row.Scan(&attachment.Name, &attachment.MimeType, &attachment.Size, &attachment.Key, &content.blob, &attachment.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return attachment, content, fmt.Errorf("attachment %s of data %s: %w", name, dataId, ErrNotFound)
+	}
+	if err != nil {
+		return attachment, content, fmt.Errorf("cannot scan attachment: %w", err)
+	}
+	content.Size, content.Origin = attachment.Size, origin
+
+	return attachment, content, nil
+}
+
+func (m *KeeperStorage) DeleteAttachment(ctx context.Context, userId string, dataId string, name string) error {
+	tx, err := m.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("cannot begin transaction: %w", err)
+	}
+
+	defer tx.Rollback()
+
+	current, err := m.currentData(ctx, tx, userId, dataId)
+	if err != nil {
+		return err
+	}
+
+	var blob string
+	err = tx.QueryRowContext(ctx, getAttachmentBlob, current.id, name).Scan(&blob)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("attachment %s of data %s: %w", name, dataId, ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot scan attachment: %w", err)
+	}
+
+	if err := removeAttachment(ctx, tx, current.id, name, blob); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("cannot comit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// attachUpload сохраняет загруженное содержимое вложением данных вместо одноименного вложения
+// и возвращает текущую ревизию данных
+func attachUpload(ctx context.Context, tx *sql.Tx, current currentRow, uploadId string, upload Upload) (int64, error) {
+	var blob string
+	err := tx.QueryRowContext(ctx, getAttachmentBlob, current.id, upload.Attachment).Scan(&blob)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+	case err != nil:
+		return 0, fmt.Errorf("cannot scan attachment: %w", err)
+	case upload.CreateOnly:
+		return 0, fmt.Errorf("attachment %s of data %s: %w", upload.Attachment, upload.DataId, ErrAlreadyExist)
+	default:
+		if err := removeAttachment(ctx, tx, current.id, upload.Attachment, blob); err != nil {
+			return 0, err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, addAttachment, current.id, upload.Attachment, upload.MimeType, upload.Key, uploadId, time.Now().UTC())
+	if err != nil {
+		return 0, fmt.Errorf("cannot execute add attachment: %w", err)
+	}
+
+	return current.Revision, nil
+}
+
+// removeAttachment удаляет вложение строки данных id и его содержимое blob
+func removeAttachment(ctx context.Context, tx *sql.Tx, id string, name string, blob string) error {
+	if _, err := tx.ExecContext(ctx, deleteAttachment, id, name); err != nil {
+		return fmt.Errorf("cannot execute delete attachment: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, deleteBlob, blob); err != nil {
+		return fmt.Errorf("cannot delete attachment content: %w", err)
+	}
+
+	return nil
+}
+
+// dataRowId идентификатор строки неудаленных данных и идентификатор, от которого получен их ключ
+func dataRowId(ctx context.Context, q querier, userId string, dataId string) (string, string, error) {
+	var id string
+	var origin sql.NullString
+
+	err := q.QueryRowContext(ctx, getDataRowId, userId, dataId).Scan(&id, &origin)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ``, ``, fmt.Errorf("data %s: %w", dataId, ErrNotFound)
+	}
+	if err != nil {
+		return ``, ``, fmt.Errorf("cannot scan data: %w", err)
+	}
+
+	return id, origin.String, nil
+}
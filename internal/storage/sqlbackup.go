@@ -0,0 +1,305 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+)
+
+const (
+	//Выгружается только содержимое, на которое ссылаются данные: части незавершенных загрузок не нужны
+	backupBlobIds = `
+		SELECT blob_id FROM data WHERE blob_id IS NOT NULL
+		UNION
+		SELECT blob_id FROM data_revisions WHERE blob_id IS NOT NULL
+		UNION
+		SELECT blob_id FROM attachments`
+	backupUsers    = `SELECT id, login, password, change_seq, purged_seq, public_key, private_key FROM users ORDER BY id`
+	backupBlobs    = `SELECT id, user_id, size, created_at FROM blobs WHERE id IN (` + backupBlobIds + `) ORDER BY id`
+	backupChunks   = `SELECT blob_id, start, data FROM blob_chunks WHERE blob_id IN (` + backupBlobIds + `) ORDER BY blob_id, start`
+	backupDataRows = `
+		SELECT id, user_id, data_id, data, metadata, blob_id, revision, created_at, updated_at, deleted_at, change_seq, created_seq,
+			origin, moved
+		FROM data ORDER BY id`
+	backupRevisions      = `SELECT data_id, revision, data, metadata, blob_id, created_at FROM data_revisions ORDER BY data_id, revision`
+	backupShares         = `SELECT id, data_id, recipient_id, wrapped_key, permission, accepted, created_at FROM shares ORDER BY id`
+	backupOrgs           = `SELECT id, name, created_at FROM organizations ORDER BY id`
+	backupMembers        = `SELECT org_id, user_id, role, accepted, created_at FROM org_members ORDER BY org_id, user_id`
+	backupCollections    = `SELECT id, org_id, name, key_version, created_at FROM collections ORDER BY id`
+	backupCollectionKeys = `
+		SELECT collection_id, user_id, version, wrapped_key FROM collection_keys ORDER BY collection_id, user_id, version`
+	backupFolders     = `SELECT user_id, path, created_at FROM folders ORDER BY user_id, path`
+	backupAttachments = `SELECT data_id, name, mime_type, key, blob_id, created_at FROM attachments ORDER BY data_id, name`
+
+	countUsers     = `SELECT COUNT(*) FROM users`
+	restoreUser    = `INSERT INTO users (id, login, password, change_seq, purged_seq, public_key, private_key) VALUES($1,$2,$3,$4,$5,$6,$7)`
+	restoreBlob    = `INSERT INTO blobs (id, user_id, size, created_at) VALUES($1,$2,$3,$4)`
+	restoreChunk   = `INSERT INTO blob_chunks (blob_id, start, data) VALUES($1,$2,$3)`
+	restoreDataRow = `
+		INSERT INTO data (id, user_id, data_id, data, metadata, blob_id, revision, created_at, updated_at, deleted_at, change_seq, created_seq,
+			origin, moved)
+		VALUES($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14)`
+	restoreRevision = `INSERT INTO data_revisions (data_id, revision, data, metadata, blob_id, created_at) VALUES($1,$2,$3,$4,$5,$6)`
+	restoreShare    = `
+		INSERT INTO shares (id, data_id, recipient_id, wrapped_key, permission, accepted, created_at)
+		VALUES($1,$2,$3,$4,$5,$6,$7)`
+	restoreOrg           = `INSERT INTO organizations (id, name, created_at) VALUES($1,$2,$3)`
+	restoreMember        = `INSERT INTO org_members (org_id, user_id, role, accepted, created_at) VALUES($1,$2,$3,$4,$5)`
+	restoreCollection    = `INSERT INTO collections (id, org_id, name, key_version, created_at) VALUES($1,$2,$3,$4,$5)`
+	restoreCollectionKey = `INSERT INTO collection_keys (collection_id, user_id, version, wrapped_key) VALUES($1,$2,$3,$4)`
+	restoreFolder        = `INSERT INTO folders (user_id, path, created_at) VALUES($1,$2,$3)`
+	restoreAttachment    = `INSERT INTO attachments (data_id, name, mime_type, key, blob_id, created_at) VALUES($1,$2,$3,$4,$5,$6)`
+)
+
+var _ Backuper = (*KeeperStorage)(nil)
+
+// Backup выгружает все таблицы в одной транзакции только для чтения, поэтому архив согласован,
+// даже если сервер в это время работает. Строки читаются по одной, содержимое не собирается в памяти.
+func (m *KeeperStorage) Backup(ctx context.Context, w io.Writer) (BackupStats, error) {
+	schema, err := latestSchema()
+	if err != nil {
+		return BackupStats{}, err
+	}
+
+	tx, err := m.conn.BeginTx(ctx, m.dialect.snapshot)
+	if err != nil {
+		return BackupStats{}, fmt.Errorf("cannot begin transaction: %w", err)
+	}
+
+	defer tx.Rollback()
+
+	bw, err := newBackupWriter(w, schema)
+	if err != nil {
+		return BackupStats{}, err
+	}
+
+	tables := []struct {
+		query string
+		scan  func(rows *sql.Rows) (backupRecord, error)
+	}{
+		{backupUsers, scanBackupUser},
+		{backupBlobs, scanBackupBlob},
+		{backupChunks, scanBackupChunk},
+		{backupDataRows, scanBackupData},
+		{backupRevisions, scanBackupRevision},
+		{backupShares, scanBackupShare},
+		{backupOrgs, scanBackupOrg},
+		{backupMembers, scanBackupMember},
+		{backupCollections, scanBackupCollection},
+		{backupCollectionKeys, scanBackupCollectionKey},
+		{backupFolders, scanBackupFolder},
+		{backupAttachments, scanBackupAttachment},
+	}
+
+	for _, table := range tables {
+		if err := backupTable(ctx, tx, table.query, table.scan, bw); err != nil {
+			return bw.stats, err
+		}
+	}
+
+	return bw.close()
+}
+
+// backupTable пишет в архив все строки запроса
+func backupTable(ctx context.Context, tx *sql.Tx, query string, scan func(rows *sql.Rows) (backupRecord, error), bw *backupWriter) error {
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return fmt.Errorf("cannot query backup rows: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		record, err := scan(rows)
+		if err != nil {
+			return fmt.Errorf("cannot scan backup row: %w", err)
+		}
+		if err := bw.write(record); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("cannot read backup rows: %w", err)
+	}
+
+	return nil
+}
+
+func scanBackupUser(rows *sql.Rows) (backupRecord, error) {
+	var user backupUser
+	var password sql.NullString
+	err := rows.Scan(&user.Id, &user.Login, &password, &user.ChangeSeq, &user.PurgedSeq, &user.PublicKey, &user.PrivateKey)
+	user.Password = password.String
+	return backupRecord{Type: backupUserType, User: &user}, err
+}
+
+func scanBackupBlob(rows *sql.Rows) (backupRecord, error) {
+	var blob backupBlob
+	err := rows.Scan(&blob.Id, &blob.UserId, &blob.Size, &blob.CreatedAt)
+	return backupRecord{Type: backupBlobType, Blob: &blob}, err
+}
+
+func scanBackupChunk(rows *sql.Rows) (backupRecord, error) {
+	var chunk backupChunk
+	err := rows.Scan(&chunk.BlobId, &chunk.Start, &chunk.Data)
+	return backupRecord{Type: backupChunkType, Chunk: &chunk}, err
+}
+
+func scanBackupData(rows *sql.Rows) (backupRecord, error) {
+	var data backupData
+	var userId, blobId, origin sql.NullString
+	var deletedAt sql.NullTime
+	err := rows.Scan(&data.Id, &userId, &data.DataId, &data.Data, &data.Metadata, &blobId, &data.Revision,
+		&data.CreatedAt, &data.UpdatedAt, &deletedAt, &data.ChangeSeq, &data.CreatedSeq, &origin, &data.Moved)
+	data.UserId, data.BlobId, data.Origin = userId.String, blobId.String, origin.String
+	if deletedAt.Valid {
+		data.DeletedAt = &deletedAt.Time
+	}
+	return backupRecord{Type: backupDataType, Data: &data}, err
+}
+
+func scanBackupRevision(rows *sql.Rows) (backupRecord, error) {
+	var revision backupRevision
+	var blobId sql.NullString
+	err := rows.Scan(&revision.DataId, &revision.Revision, &revision.Data, &revision.Metadata, &blobId, &revision.CreatedAt)
+	revision.BlobId = blobId.String
+	return backupRecord{Type: backupRevisionType, Revision: &revision}, err
+}
+
+func scanBackupShare(rows *sql.Rows) (backupRecord, error) {
+	var share backupShare
+	err := rows.Scan(&share.Id, &share.DataId, &share.RecipientId, &share.WrappedKey, &share.Permission, &share.Accepted, &share.CreatedAt)
+	return backupRecord{Type: backupShareType, Share: &share}, err
+}
+
+func scanBackupOrg(rows *sql.Rows) (backupRecord, error) {
+	var org backupOrg
+	err := rows.Scan(&org.Id, &org.Name, &org.CreatedAt)
+	return backupRecord{Type: backupOrgType, Org: &org}, err
+}
+
+func scanBackupMember(rows *sql.Rows) (backupRecord, error) {
+	var member backupMember
+	err := rows.Scan(&member.OrgId, &member.UserId, &member.Role, &member.Accepted, &member.CreatedAt)
+	return backupRecord{Type: backupMemberType, Member: &member}, err
+}
+
+func scanBackupCollection(rows *sql.Rows) (backupRecord, error) {
+	var collection backupCollection
+	err := rows.Scan(&collection.Id, &collection.OrgId, &collection.Name, &collection.KeyVersion, &collection.CreatedAt)
+	return backupRecord{Type: backupCollectionType, Collection: &collection}, err
+}
+
+func scanBackupCollectionKey(rows *sql.Rows) (backupRecord, error) {
+	var key backupCollectionKey
+	err := rows.Scan(&key.CollectionId, &key.UserId, &key.Version, &key.WrappedKey)
+	return backupRecord{Type: backupCollectionKeyType, CollectionKey: &key}, err
+}
+
+func scanBackupFolder(rows *sql.Rows) (backupRecord, error) {
+	var folder backupFolder
+	err := rows.Scan(&folder.UserId, &folder.Path, &folder.CreatedAt)
+	return backupRecord{Type: backupFolderType, Folder: &folder}, err
+}
+
+func scanBackupAttachment(rows *sql.Rows) (backupRecord, error) {
+	var attachment backupAttachment
+	err := rows.Scan(&attachment.DataId, &attachment.Name, &attachment.MimeType, &attachment.Key, &attachment.BlobId, &attachment.CreatedAt)
+	return backupRecord{Type: backupAttachmentType, Attachment: &attachment}, err
+}
+
+// Restore загружает архив в пустую базу. Архив может быть выгружен из базы другого диалекта.
+func (m *KeeperStorage) Restore(ctx context.Context, r io.Reader) (BackupStats, error) {
+	schema, err := latestSchema()
+	if err != nil {
+		return BackupStats{}, err
+	}
+
+	tx, err := m.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return BackupStats{}, fmt.Errorf("cannot begin transaction: %w", err)
+	}
+
+	defer tx.Rollback()
+
+	var users int64
+	if err := tx.QueryRowContext(ctx, countUsers).Scan(&users); err != nil {
+		return BackupStats{}, fmt.Errorf("cannot count users: %w", err)
+	}
+	if users > 0 {
+		return BackupStats{}, fmt.Errorf("storage is not empty: %d users", users)
+	}
+
+	stats, err := readBackup(r, schema, func(record backupRecord) error {
+		return restoreRecord(ctx, tx, record)
+	})
+	if err != nil {
+		return stats, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return stats, fmt.Errorf("cannot comit transaction: %w", err)
+	}
+
+	return stats, nil
+}
+
+// restoreRecord вставляет строку таблицы из записи архива
+func restoreRecord(ctx context.Context, tx *sql.Tx, record backupRecord) error {
+	var err error
+	switch record.Type {
+	case backupUserType:
+		user := record.User
+		_, err = tx.ExecContext(ctx, restoreUser, user.Id, user.Login, nullString(user.Password), user.ChangeSeq, user.PurgedSeq,
+			user.PublicKey, user.PrivateKey)
+	case backupBlobType:
+		blob := record.Blob
+		_, err = tx.ExecContext(ctx, restoreBlob, blob.Id, blob.UserId, blob.Size, blob.CreatedAt.UTC())
+	case backupChunkType:
+		chunk := record.Chunk
+		_, err = tx.ExecContext(ctx, restoreChunk, chunk.BlobId, chunk.Start, chunk.Data)
+	case backupDataType:
+		data := record.Data
+		var deletedAt sql.NullTime
+		if data.DeletedAt != nil {
+			deletedAt = sql.NullTime{Time: data.DeletedAt.UTC(), Valid: true}
+		}
+		_, err = tx.ExecContext(ctx, restoreDataRow, data.Id, nullString(data.UserId), data.DataId, data.Data, data.Metadata,
+			nullString(data.BlobId), data.Revision, data.CreatedAt.UTC(), data.UpdatedAt.UTC(), deletedAt, data.ChangeSeq, data.CreatedSeq,
+			nullString(data.Origin), data.Moved)
+	case backupRevisionType:
+		revision := record.Revision
+		_, err = tx.ExecContext(ctx, restoreRevision, revision.DataId, revision.Revision, revision.Data, revision.Metadata,
+			nullString(revision.BlobId), revision.CreatedAt.UTC())
+	case backupShareType:
+		share := record.Share
+		_, err = tx.ExecContext(ctx, restoreShare, share.Id, share.DataId, share.RecipientId, share.WrappedKey, share.Permission,
+			share.Accepted, share.CreatedAt.UTC())
+	case backupOrgType:
+		org := record.Org
+		_, err = tx.ExecContext(ctx, restoreOrg, org.Id, org.Name, org.CreatedAt.UTC())
+	case backupMemberType:
+		member := record.Member
+		_, err = tx.ExecContext(ctx, restoreMember, member.OrgId, member.UserId, member.Role, member.Accepted, member.CreatedAt.UTC())
+	case backupCollectionType:
+		collection := record.Collection
+		_, err = tx.ExecContext(ctx, restoreCollection, collection.Id, collection.OrgId, collection.Name, collection.KeyVersion,
+			collection.CreatedAt.UTC())
+	case backupCollectionKeyType:
+		key := record.CollectionKey
+		_, err = tx.ExecContext(ctx, restoreCollectionKey, key.CollectionId, key.UserId, key.Version, key.WrappedKey)
+	case backupFolderType:
+		folder := record.Folder
+		_, err = tx.ExecContext(ctx, restoreFolder, folder.UserId, folder.Path, folder.CreatedAt.UTC())
+	case backupAttachmentType:
+		attachment := record.Attachment
+		_, err = tx.ExecContext(ctx, restoreAttachment, attachment.DataId, attachment.Name, attachment.MimeType, attachment.Key,
+			attachment.BlobId, attachment.CreatedAt.UTC())
+	}
+	if err != nil {
+		return fmt.Errorf("cannot restore %s: %w", record.Type, err)
+	}
+
+	return nil
+}
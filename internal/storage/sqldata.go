@@ -0,0 +1,360 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lionslon/go-keepass/internal/models"
+	"time"
+)
+
+const (
+	addData = `
+		INSERT INTO data (id, user_id, data_id, data, metadata, blob_id, revision, created_at, updated_at, change_seq, created_seq)
+		VALUES($1,$2,$3,$4,$5,$6,1,$7,$7,$8,$8)`
+	getData = `
+		SELECT d.data, d.metadata, d.revision, d.blob_id, COALESCE(b.size, length(d.data), 0), d.origin
+		FROM data d LEFT JOIN blobs b ON b.id = d.blob_id WHERE d.user_id = $1 AND d.data_id = $2 AND d.deleted_at IS NULL`
+	trashData    = `UPDATE data SET deleted_at = $2, change_seq = $3 WHERE id = $1`
+	deleteData   = `DELETE FROM data WHERE id = $1`
+	getDataBlobs = `
+		SELECT blob_id FROM data WHERE id = $1 AND blob_id IS NOT NULL
+		UNION
+		SELECT blob_id FROM data_revisions WHERE data_id = $1 AND blob_id IS NOT NULL
+		UNION
+		SELECT blob_id FROM attachments WHERE data_id = $1`
+
+	getCurrentData  = `SELECT id, revision, data, metadata, blob_id, updated_at FROM data WHERE user_id = $1 AND data_id = $2 AND deleted_at IS NULL`
+	getDataRevision = `SELECT id, revision FROM data WHERE user_id = $1 AND data_id = $2 AND deleted_at IS NULL`
+	addDataRevision = `INSERT INTO data_revisions (data_id, revision, data, metadata, blob_id, created_at) VALUES($1,$2,$3,$4,$5,$6)`
+	updateData      = `UPDATE data SET data = $2, metadata = $3, blob_id = $4, revision = $5, updated_at = $6, change_seq = $7 WHERE id = $1`
+	countData       = `SELECT COUNT(*) FROM data WHERE user_id = $1 AND deleted_at IS NULL AND substr(data_id, 1, $3) = $2`
+	listData        = `
+		SELECT d.data_id, d.origin, d.revision, COALESCE(b.size, length(d.data), 0), d.metadata, d.created_at, d.updated_at
+		FROM data d LEFT JOIN blobs b ON b.id = d.blob_id
+		WHERE d.user_id = $1 AND d.deleted_at IS NULL AND substr(d.data_id, 1, $5) = $4
+		ORDER BY %s %s, d.data_id LIMIT $2 OFFSET $3`
+	getRevisions = `
+		SELECT r.revision, r.created_at, COALESCE(b.size, length(r.data), 0)
+		FROM data_revisions r JOIN data d ON d.id = r.data_id LEFT JOIN blobs b ON b.id = r.blob_id
+		WHERE d.user_id = $1 AND d.data_id = $2 AND d.deleted_at IS NULL
+		UNION ALL
+		SELECT d.revision, d.updated_at, COALESCE(b.size, length(d.data), 0)
+		FROM data d LEFT JOIN blobs b ON b.id = d.blob_id WHERE d.user_id = $1 AND d.data_id = $2 AND d.deleted_at IS NULL
+		ORDER BY 1`
+	getRevision = `
+		SELECT r.data, r.metadata, r.revision, r.blob_id, COALESCE(b.size, length(r.data), 0), d.origin
+		FROM data_revisions r JOIN data d ON d.id = r.data_id LEFT JOIN blobs b ON b.id = r.blob_id
+		WHERE d.user_id = $1 AND d.data_id = $2 AND d.deleted_at IS NULL AND r.revision = $3
+		UNION ALL
+		SELECT d.data, d.metadata, d.revision, d.blob_id, COALESCE(b.size, length(d.data), 0), d.origin
+		FROM data d LEFT JOIN blobs b ON b.id = d.blob_id
+		WHERE d.user_id = $1 AND d.data_id = $2 AND d.deleted_at IS NULL AND d.revision = $3`
+)
+
+// listColumns столбцы сортировки списка данных
+var listColumns = map[string]string{
+	SortByIdentifier: "d.data_id",
+	SortByCreated:    "d.created_at",
+	SortByUpdated:    "d.updated_at",
+	SortBySize:       "COALESCE(b.size, length(d.data), 0)",
+}
+
+func (m *KeeperStorage) AddData(ctx context.Context, userId string, dataId string, data, metadata []byte) error {
+	tx, err := m.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("cannot begin transaction: %w", err)
+	}
+
+	defer tx.Rollback()
+
+	seq, err := nextSeq(ctx, tx, userId)
+	if err != nil {
+		return err
+	}
+
+	if err := m.insertData(ctx, tx, userId, dataId, Entry{Data: data, Metadata: metadata}, seq); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("cannot comit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// insertData сохраняет первую ревизию новых данных изменением с номером seq
+func (m *KeeperStorage) insertData(ctx context.Context, q querier, userId string, dataId string, entry Entry, seq int64) error {
+
+	id, err := newUUID()
+	if err != nil {
+		return fmt.Errorf("cannot generate data id: %w", err)
+	}
+
+	_, err = q.ExecContext(ctx, addData, id, userId, dataId, entry.Data, entry.Metadata, nullString(entry.blob), time.Now().UTC(), seq)
+	if m.dialect.isUniqueViolation(err) {
+		return fmt.Errorf("data %s: %w", dataId, ErrAlreadyExist)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot execute add new data: %w", err)
+	}
+
+	return nil
+}
+
+func (m *KeeperStorage) GetData(ctx context.Context, userId string, dataId string) (Entry, error) {
+
+	row := m.conn.QueryRowContext(ctx, getData, userId, dataId)
+	entry, err := scanEntry(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return entry, fmt.Errorf("data %s: %w", dataId, ErrNotFound)
+	}
+	if err != nil {
+		return entry, fmt.Errorf("cannot scan data: %w", err)
+	}
+
+	return entry, nil
+}
+
+func (m *KeeperStorage) UpdateData(ctx context.Context, userId string, dataId string, data, metadata []byte, expected int64) (int64, error) {
+	return m.update(ctx, userId, dataId, expected, func(entry *Entry) {
+		entry.Data = data
+		entry.blob = ``
+		if metadata != nil {
+			entry.Metadata = metadata
+		}
+	})
+}
+
+func (m *KeeperStorage) UpdateMetadata(ctx context.Context, userId string, dataId string, metadata []byte, expected int64) (int64, error) {
+	return m.update(ctx, userId, dataId, expected, func(entry *Entry) {
+		entry.Metadata = metadata
+	})
+}
+
+// update сохраняет текущую ревизию в историю и записывает новую, полученную из текущей функцией change
+func (m *KeeperStorage) update(ctx context.Context, userId string, dataId string, expected int64, change func(entry *Entry)) (int64, error) {
+	tx, err := m.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("cannot begin transaction: %w", err)
+	}
+
+	defer tx.Rollback()
+
+	seq, err := nextSeq(ctx, tx, userId)
+	if err != nil {
+		return 0, err
+	}
+
+	current, err := m.currentData(ctx, tx, userId, dataId)
+	if err != nil {
+		return 0, err
+	}
+
+	if expected != 0 && expected != current.Revision {
+		return 0, fmt.Errorf("data %s revision %d, expected %d: %w", dataId, current.Revision, expected, ErrRevisionMismatch)
+	}
+
+	next := current.Entry
+	change(&next)
+
+	revision, err := m.replaceData(ctx, tx, current, next, seq)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("cannot comit transaction: %w", err)
+	}
+
+	return revision, nil
+}
+
+// currentRow текущая ревизия данных со служебными полями строки
+type currentRow struct {
+	Entry
+	id        string    // идентификатор строки
+	updatedAt time.Time // время сохранения ревизии
+}
+
+// currentData читает текущую ревизию данных и блокирует ее, чтобы параллельное изменение дождалось транзакции
+func (m *KeeperStorage) currentData(ctx context.Context, tx *sql.Tx, userId string, dataId string) (currentRow, error) {
+	var current currentRow
+	var blob sql.NullString
+
+	row := tx.QueryRowContext(ctx, getCurrentData+m.dialect.forUpdate, userId, dataId)
+	err := row.Scan(&current.id, &current.Revision, &current.Data, &current.Metadata, &blob, &current.updatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return current, fmt.Errorf("data %s: %w", dataId, ErrNotFound)
+	}
+	if err != nil {
+		return current, fmt.Errorf("cannot scan current data: %w", err)
+	}
+	current.blob = blob.String
+
+	return current, nil
+}
+
+// replaceData переносит текущую ревизию в историю и записывает на ее место next изменением с номером seq,
+// возвращает номер новой ревизии
+func (m *KeeperStorage) replaceData(ctx context.Context, tx *sql.Tx, current currentRow, next Entry, seq int64) (int64, error) {
+	_, err := tx.ExecContext(ctx, addDataRevision, current.id, current.Revision, current.Data, current.Metadata,
+		nullString(current.blob), current.updatedAt)
+	if err != nil {
+		return 0, fmt.Errorf("cannot save data revision: %w", err)
+	}
+
+	next.Revision = current.Revision + 1
+
+	_, err = tx.ExecContext(ctx, updateData, current.id, next.Data, next.Metadata, nullString(next.blob), next.Revision, time.Now().UTC(), seq)
+	if err != nil {
+		return 0, fmt.Errorf("cannot execute update data: %w", err)
+	}
+
+	return next.Revision, nil
+}
+
+func (m *KeeperStorage) ListData(ctx context.Context, userId string, opts ListOptions) ([]models.DataInfo, int64, error) {
+
+	//Отбор по папке - сравнение начала идентификатора: LIKE в SQLite не различает регистр,
+	//а пустой префикс подходит ко всем данным
+	prefix := folderPrefix(opts.Folder)
+
+	var total int64
+	row := m.conn.QueryRowContext(ctx, countData, userId, prefix, prefixLength(prefix))
+	if err := row.Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("cannot count user data: %w", err)
+	}
+
+	column, ok := listColumns[opts.Sort]
+	if !ok {
+		column = listColumns[SortByIdentifier]
+	}
+	order := "ASC"
+	if opts.Desc {
+		order = "DESC"
+	}
+
+	rows, err := m.conn.QueryContext(ctx, fmt.Sprintf(listData, column, order), userId, opts.Limit, opts.Offset,
+		prefix, prefixLength(prefix))
+	if err != nil {
+		return nil, 0, fmt.Errorf("cannot query user data list: %w", err)
+	}
+	defer rows.Close()
+
+	infos := make([]models.DataInfo, 0)
+	for rows.Next() {
+		var info models.DataInfo
+		var origin sql.NullString
+		err := rows.Scan(&info.Identifier, &origin, &info.Revision, &info.Size, &info.Metadata, &info.CreatedAt, &info.UpdatedAt)
+		if err != nil {
+			return nil, 0, fmt.Errorf("cannot scan user data info: %w", err)
+		}
+		info.Origin = origin.String
+		infos = append(infos, info)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("cannot read user data list: %w", err)
+	}
+
+	return infos, total, nil
+}
+
+func (m *KeeperStorage) GetDataRevisions(ctx context.Context, userId string, dataId string) ([]models.DataRevision, error) {
+
+	rows, err := m.conn.QueryContext(ctx, getRevisions, userId, dataId)
+	if err != nil {
+		return nil, fmt.Errorf("cannot query data revisions: %w", err)
+	}
+	defer rows.Close()
+
+	var revisions []models.DataRevision
+	for rows.Next() {
+		var revision models.DataRevision
+		if err := rows.Scan(&revision.Revision, &revision.CreatedAt, &revision.Size); err != nil {
+			return nil, fmt.Errorf("cannot scan data revision: %w", err)
+		}
+		revisions = append(revisions, revision)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read data revisions: %w", err)
+	}
+
+	if len(revisions) == 0 {
+		return nil, fmt.Errorf("data %s: %w", dataId, ErrNotFound)
+	}
+
+	return revisions, nil
+}
+
+func (m *KeeperStorage) GetDataRevision(ctx context.Context, userId string, dataId string, revision int64) (Entry, error) {
+
+	row := m.conn.QueryRowContext(ctx, getRevision, userId, dataId, revision)
+	entry, err := scanEntry(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return entry, fmt.Errorf("data %s revision %d: %w", dataId, revision, ErrNotFound)
+	}
+	if err != nil {
+		return entry, fmt.Errorf("cannot scan data revision: %w", err)
+	}
+
+	return entry, nil
+}
+
+func (m *KeeperStorage) DeleteData(ctx context.Context, userId string, dataId string, expected int64) error {
+	tx, err := m.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("cannot begin transaction: %w", err)
+	}
+
+	defer tx.Rollback()
+
+	seq, err := nextSeq(ctx, tx, userId)
+	if err != nil {
+		return err
+	}
+
+	var id string
+	var revision int64
+
+	row := tx.QueryRowContext(ctx, getDataRevision+m.dialect.forUpdate, userId, dataId)
+	err = row.Scan(&id, &revision)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("data %s: %w", dataId, ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot scan current data: %w", err)
+	}
+
+	if expected != 0 && expected != revision {
+		return fmt.Errorf("data %s revision %d, expected %d: %w", dataId, revision, expected, ErrRevisionMismatch)
+	}
+
+	//Данные остаются в таблице вместе с историей, пока их не удалят из корзины
+	if _, err := tx.ExecContext(ctx, trashData, id, time.Now().UTC(), seq); err != nil {
+		return fmt.Errorf("cannot execute trash user data: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("cannot comit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// scanEntry разбирает строку ревизии: data, metadata, revision, blob_id, размер содержимого, origin
+func scanEntry(row *sql.Row) (Entry, error) {
+	var entry Entry
+	var blob, origin sql.NullString
+
+	if err := row.Scan(&entry.Data, &entry.Metadata, &entry.Revision, &blob, &entry.Size, &origin); err != nil {
+		return entry, err
+	}
+	entry.blob, entry.Origin = blob.String, origin.String
+
+	return entry, nil
+}
@@ -0,0 +1,353 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lionslon/go-keepass/internal/models"
+	"time"
+)
+
+const (
+	// folderExists папка есть, если она создана явно, в ней есть вложенная папка или данные
+	folderExists = `
+		SELECT EXISTS (SELECT 1 FROM folders WHERE user_id = $1 AND (path = $2 OR substr(path, 1, $4) = $3))
+		OR EXISTS (SELECT 1 FROM data WHERE user_id = $1 AND deleted_at IS NULL AND substr(data_id, 1, $4) = $3)`
+	createFolder   = `INSERT INTO folders (user_id, path, created_at) VALUES($1,$2,$3)`
+	listFolderRows = `SELECT path FROM folders WHERE user_id = $1`
+	listDataIds    = `SELECT data_id FROM data WHERE user_id = $1 AND deleted_at IS NULL`
+	getSubfolders  = `SELECT path FROM folders WHERE user_id = $1 AND (path = $2 OR substr(path, 1, $4) = $3)`
+	renameFolder   = `UPDATE folders SET path = $3 WHERE user_id = $1 AND path = $2`
+	deleteFolders  = `DELETE FROM folders WHERE user_id = $1 AND (path = $2 OR substr(path, 1, $4) = $3)`
+	getFolderData  = `SELECT id, data_id, origin FROM data WHERE user_id = $1 AND deleted_at IS NULL AND substr(data_id, 1, $3) = $2`
+	getMovingData  = `SELECT id, data_id, origin, revision FROM data WHERE user_id = $1 AND data_id = $2 AND deleted_at IS NULL`
+	// addMovedData след данных под прежним идентификатором: строка в корзине без содержимого,
+	// по которой синхронизация сообщает об удалении прежнего идентификатора
+	addMovedData = `
+		INSERT INTO data (id, user_id, data_id, revision, created_at, updated_at, deleted_at, change_seq, created_seq, moved)
+		VALUES($1,$2,$3,1,$4,$4,$4,$5,$5,TRUE)`
+	moveData  = `UPDATE data SET data_id = $2, origin = $3, change_seq = $4, created_seq = $4 WHERE id = $1`
+	rekeyData = `UPDATE data SET origin = $2, change_seq = $3 WHERE id = $1`
+)
+
+// movingRow строка данных, которые переносятся в другую папку или под другой идентификатор
+type movingRow struct {
+	id       string // идентификатор строки
+	dataId   string // идентификатор данных
+	origin   string // идентификатор, от которого получен ключ данных (пусто - dataId)
+	revision int64  // номер текущей ревизии
+}
+
+func (m *KeeperStorage) MoveData(ctx context.Context, userId string, from string, to string, expected int64) error {
+	tx, err := m.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("cannot begin transaction: %w", err)
+	}
+
+	defer tx.Rollback()
+
+	seq, err := nextSeq(ctx, tx, userId)
+	if err != nil {
+		return err
+	}
+
+	var row movingRow
+	var origin sql.NullString
+	err = tx.QueryRowContext(ctx, getMovingData+m.dialect.forUpdate, userId, from).Scan(&row.id, &row.dataId, &origin, &row.revision)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("data %s: %w", from, ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot scan moving data: %w", err)
+	}
+	row.origin = origin.String
+
+	if expected != 0 && expected != row.revision {
+		return fmt.Errorf("data %s revision %d, expected %d: %w", from, row.revision, expected, ErrRevisionMismatch)
+	}
+
+	//Перемещение под тот же идентификатор не нарушает уникальность, но данные с ним уже есть
+	if to == from {
+		return fmt.Errorf("data %s: %w", to, ErrAlreadyExist)
+	}
+
+	if err := m.moveRow(ctx, tx, userId, row, to, seq); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("cannot comit transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (m *KeeperStorage) RekeyData(ctx context.Context, userId string, dataId string, origin string, expected int64) error {
+	tx, err := m.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("cannot begin transaction: %w", err)
+	}
+
+	defer tx.Rollback()
+
+	seq, err := nextSeq(ctx, tx, userId)
+	if err != nil {
+		return err
+	}
+
+	var row movingRow
+	var current sql.NullString
+	err = tx.QueryRowContext(ctx, getMovingData+m.dialect.forUpdate, userId, dataId).Scan(&row.id, &row.dataId, &current, &row.revision)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("data %s: %w", dataId, ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot scan data: %w", err)
+	}
+
+	if expected != 0 && expected != row.revision {
+		return fmt.Errorf("data %s revision %d, expected %d: %w", dataId, row.revision, expected, ErrRevisionMismatch)
+	}
+
+	//Ключ, полученный из самого идентификатора, не хранится, как у вернувшихся на место данных
+	if _, err := tx.ExecContext(ctx, rekeyData, row.id, nullString(movedOrigin(dataId, origin, dataId)), seq); err != nil {
+		return fmt.Errorf("cannot execute rekey data: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("cannot comit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// moveRow переносит строку данных под идентификатор to изменением с номером seq и оставляет след
+// под прежним идентификатором
+func (m *KeeperStorage) moveRow(ctx context.Context, tx *sql.Tx, userId string, row movingRow, to string, seq int64) error {
+	id, err := newUUID()
+	if err != nil {
+		return fmt.Errorf("cannot generate data id: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, addMovedData, id, userId, row.dataId, time.Now().UTC(), seq); err != nil {
+		return fmt.Errorf("cannot execute add moved data: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, moveData, row.id, to, nullString(movedOrigin(row.dataId, row.origin, to)), seq)
+	if m.dialect.isUniqueViolation(err) {
+		return fmt.Errorf("data %s: %w", to, ErrAlreadyExist)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot execute move data: %w", err)
+	}
+
+	return nil
+}
+
+func (m *KeeperStorage) CreateFolder(ctx context.Context, userId string, path string) error {
+	tx, err := m.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("cannot begin transaction: %w", err)
+	}
+
+	defer tx.Rollback()
+
+	//Блокировка пользователя не дает данным появиться в папке между проверкой и созданием
+	if err := m.lockUser(ctx, tx, userId); err != nil {
+		return err
+	}
+
+	exists, err := isFolderExist(ctx, tx, userId, path)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("folder %s: %w", path, ErrAlreadyExist)
+	}
+
+	if _, err := tx.ExecContext(ctx, createFolder, userId, path, time.Now().UTC()); err != nil {
+		return fmt.Errorf("cannot execute create folder: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("cannot comit transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (m *KeeperStorage) ListFolders(ctx context.Context, userId string) ([]models.Folder, error) {
+	tx, err := m.conn.BeginTx(ctx, m.dialect.snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("cannot begin transaction: %w", err)
+	}
+
+	defer tx.Rollback()
+
+	explicit, err := queryStrings(ctx, tx, listFolderRows, userId)
+	if err != nil {
+		return nil, fmt.Errorf("cannot query user folders: %w", err)
+	}
+
+	identifiers, err := queryStrings(ctx, tx, listDataIds, userId)
+	if err != nil {
+		return nil, fmt.Errorf("cannot query user data identifiers: %w", err)
+	}
+
+	return collectFolders(explicit, identifiers), nil
+}
+
+func (m *KeeperStorage) MoveFolder(ctx context.Context, userId string, from string, to string) (int64, error) {
+	tx, err := m.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("cannot begin transaction: %w", err)
+	}
+
+	defer tx.Rollback()
+
+	seq, err := nextSeq(ctx, tx, userId)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := checkFolderMove(ctx, tx, userId, from, to); err != nil {
+		return 0, err
+	}
+
+	rows, err := m.folderData(ctx, tx, userId, from)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, row := range rows {
+		if err := m.moveRow(ctx, tx, userId, row, models.MovePath(row.dataId, from, to), seq); err != nil {
+			return 0, err
+		}
+	}
+
+	prefix := folderPrefix(from)
+	paths, err := queryStrings(ctx, tx, getSubfolders, userId, from, prefix, prefixLength(prefix))
+	if err != nil {
+		return 0, fmt.Errorf("cannot query subfolders: %w", err)
+	}
+
+	for _, path := range paths {
+		if _, err := tx.ExecContext(ctx, renameFolder, userId, path, models.MovePath(path, from, to)); err != nil {
+			return 0, fmt.Errorf("cannot execute rename folder: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("cannot comit transaction: %w", err)
+	}
+
+	return int64(len(rows)), nil
+}
+
+// checkFolderMove проверяет, что папка from есть, а папки to нет
+func checkFolderMove(ctx context.Context, tx *sql.Tx, userId string, from string, to string) error {
+	exists, err := isFolderExist(ctx, tx, userId, from)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("folder %s: %w", from, ErrNotFound)
+	}
+
+	exists, err = isFolderExist(ctx, tx, userId, to)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("folder %s: %w", to, ErrAlreadyExist)
+	}
+
+	return nil
+}
+
+func (m *KeeperStorage) DeleteFolder(ctx context.Context, userId string, path string) (int64, error) {
+	tx, err := m.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("cannot begin transaction: %w", err)
+	}
+
+	defer tx.Rollback()
+
+	seq, err := nextSeq(ctx, tx, userId)
+	if err != nil {
+		return 0, err
+	}
+
+	exists, err := isFolderExist(ctx, tx, userId, path)
+	if err != nil {
+		return 0, err
+	}
+	if !exists {
+		return 0, fmt.Errorf("folder %s: %w", path, ErrNotFound)
+	}
+
+	rows, err := m.folderData(ctx, tx, userId, path)
+	if err != nil {
+		return 0, err
+	}
+
+	//Все данные папки попадают в корзину одним изменением, как если бы их удалили по одному
+	now := time.Now().UTC()
+	for _, row := range rows {
+		if _, err := tx.ExecContext(ctx, trashData, row.id, now, seq); err != nil {
+			return 0, fmt.Errorf("cannot execute trash user data: %w", err)
+		}
+	}
+
+	prefix := folderPrefix(path)
+	if _, err := tx.ExecContext(ctx, deleteFolders, userId, path, prefix, prefixLength(prefix)); err != nil {
+		return 0, fmt.Errorf("cannot execute delete folders: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("cannot comit transaction: %w", err)
+	}
+
+	return int64(len(rows)), nil
+}
+
+// folderData читает и блокирует неудаленные данные папки и ее вложенных папок
+func (m *KeeperStorage) folderData(ctx context.Context, tx *sql.Tx, userId string, folder string) ([]movingRow, error) {
+	prefix := folderPrefix(folder)
+
+	rows, err := tx.QueryContext(ctx, getFolderData+m.dialect.forUpdate, userId, prefix, prefixLength(prefix))
+	if err != nil {
+		return nil, fmt.Errorf("cannot query folder data: %w", err)
+	}
+	defer rows.Close()
+
+	var moving []movingRow
+	for rows.Next() {
+		var row movingRow
+		var origin sql.NullString
+		if err := rows.Scan(&row.id, &row.dataId, &origin); err != nil {
+			return nil, fmt.Errorf("cannot scan folder data: %w", err)
+		}
+		row.origin = origin.String
+		moving = append(moving, row)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read folder data: %w", err)
+	}
+
+	return moving, nil
+}
+
+// isFolderExist проверяет, что папка создана явно или следует из вложенных папок и идентификаторов данных
+func isFolderExist(ctx context.Context, q querier, userId string, path string) (bool, error) {
+	var exists bool
+
+	prefix := folderPrefix(path)
+	if err := q.QueryRowContext(ctx, folderExists, userId, path, prefix, prefixLength(prefix)).Scan(&exists); err != nil {
+		return false, fmt.Errorf("cannot check folder: %w", err)
+	}
+
+	return exists, nil
+}
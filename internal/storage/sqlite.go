@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+const (
+	sqliteScheme = "sqlite://"
+)
+
+// sqliteDialect диалект встраиваемой базы SQLite (драйвер modernc.org/sqlite, без cgo)
+var sqliteDialect = dialect{
+	name:   "sqlite",
+	driver: "sqlite",
+	// одно соединение: запись в SQLite все равно выполняется последовательно,
+	// а база :memory: существует только в рамках соединения
+	maxOpenConns: 1,
+	// первая запись в транзакции миграции блокирует базу для остальных процессов
+	lockMigrations:   noMigrationsLock,
+	unlockMigrations: noMigrationsLock,
+	// повтор первичного ключа SQLite сообщает отдельным расширенным кодом, а не как нарушение UNIQUE
+	isUniqueViolation: func(err error) bool {
+		var sqliteErr *sqlite.Error
+		if !errors.As(err, &sqliteErr) {
+			return false
+		}
+		code := sqliteErr.Code()
+		return code == sqlite3.SQLITE_CONSTRAINT_UNIQUE || code == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+	},
+}
+
+// NewSQLiteStorage создает хранилище в файле базы SQLite.
+// dsn имеет вид sqlite://путь/до/файла.db, параметры после '?' передаются драйверу.
+func NewSQLiteStorage(dsn string) (*KeeperStorage, error) {
+	if strings.TrimPrefix(dsn, sqliteScheme) == `` {
+		return nil, fmt.Errorf("sqlite database path is empty")
+	}
+
+	return newSQLStorage(sqliteDialect, sqliteDSN(dsn))
+}
+
+// sqliteDSN преобразует sqlite://путь в dsn драйвера
+func sqliteDSN(dsn string) string {
+	path := strings.TrimPrefix(dsn, sqliteScheme)
+
+	// внешние ключи в SQLite по умолчанию выключены, включаем, ожидание блокировки - для параллельных процессов
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+	return path + separator + "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"
+}
@@ -0,0 +1,542 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lionslon/go-keepass/internal/models"
+	"time"
+)
+
+const (
+	createOrganization = `INSERT INTO organizations (id, name, created_at) VALUES($1,$2,$3)`
+	lockOrganization   = `SELECT id FROM organizations WHERE id = $1`
+	listOrganizations  = `
+		SELECT o.id, o.name, m.role, m.accepted, o.created_at
+		FROM organizations o JOIN org_members m ON m.org_id = o.id
+		WHERE m.user_id = $1 ORDER BY o.name, o.id`
+	addMember     = `INSERT INTO org_members (org_id, user_id, role, accepted, created_at) VALUES($1,$2,$3,$4,$5)`
+	memberColumns = `SELECT u.login, m.role, m.accepted, m.created_at, m.user_id FROM org_members m JOIN users u ON u.id = m.user_id`
+	getMember     = memberColumns + ` WHERE m.org_id = $1 AND m.user_id = $2`
+	listMembers   = memberColumns + ` WHERE m.org_id = $1 ORDER BY u.login`
+
+	acceptInvitation = `UPDATE org_members SET accepted = TRUE WHERE org_id = $1 AND user_id = $2`
+	setMemberRole    = `UPDATE org_members SET role = $3 WHERE org_id = $1 AND user_id = $2`
+	deleteMember     = `DELETE FROM org_members WHERE org_id = $1 AND user_id = $2`
+	deleteMemberKeys = `DELETE FROM collection_keys WHERE user_id = $2 AND collection_id IN (SELECT id FROM collections WHERE org_id = $1)`
+
+	createCollectionUser = `INSERT INTO users (id, login) VALUES($1,$2)`
+	createCollection     = `INSERT INTO collections (id, org_id, name, key_version, created_at) VALUES($1,$2,$3,1,$4)`
+	rotateCollectionKeys = `UPDATE collections SET key_version = key_version + 1 WHERE org_id = $1`
+	addCollectionKey     = `INSERT INTO collection_keys (collection_id, user_id, version, wrapped_key) VALUES($1,$2,$3,$4)`
+	getOrgCollections    = `SELECT id, key_version FROM collections WHERE org_id = $1`
+	listCollections      = `
+		SELECT c.id, c.org_id, c.name, c.key_version, c.created_at, COALESCE(m.role, '')
+		FROM collections c LEFT JOIN org_members m ON m.org_id = c.org_id AND m.user_id = $2
+		WHERE c.org_id = $1 ORDER BY c.name, c.id`
+	getCollection = `
+		SELECT c.id, c.org_id, c.name, c.key_version, c.created_at, m.role
+		FROM collections c JOIN org_members m ON m.org_id = c.org_id
+		WHERE c.id = $1 AND m.user_id = $2 AND m.accepted = TRUE`
+	listOrgKeys = `
+		SELECT k.collection_id, k.version, k.wrapped_key
+		FROM collection_keys k JOIN collections c ON c.id = k.collection_id
+		WHERE c.org_id = $1 AND k.user_id = $2 ORDER BY k.collection_id, k.version`
+	getCollectionKeys = `
+		SELECT collection_id, version, wrapped_key FROM collection_keys
+		WHERE collection_id = $1 AND user_id = $2 ORDER BY version`
+)
+
+func (m *KeeperStorage) CreateOrganization(ctx context.Context, userId string, name string) (models.Organization, error) {
+	orgId, err := newUUID()
+	if err != nil {
+		return models.Organization{}, fmt.Errorf("cannot generate organization id: %w", err)
+	}
+
+	tx, err := m.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Organization{}, fmt.Errorf("cannot begin transaction: %w", err)
+	}
+
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	if _, err := tx.ExecContext(ctx, createOrganization, orgId, name, now); err != nil {
+		return models.Organization{}, fmt.Errorf("cannot execute create organization: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, addMember, orgId, userId, models.RoleOwner, true, now); err != nil {
+		return models.Organization{}, fmt.Errorf("cannot execute add member: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.Organization{}, fmt.Errorf("cannot comit transaction: %w", err)
+	}
+
+	return models.Organization{Id: orgId, Name: name, Role: models.RoleOwner, Accepted: true, CreatedAt: now}, nil
+}
+
+func (m *KeeperStorage) ListOrganizations(ctx context.Context, userId string) ([]models.Organization, error) {
+	rows, err := m.conn.QueryContext(ctx, listOrganizations, userId)
+	if err != nil {
+		return nil, fmt.Errorf("cannot query organizations: %w", err)
+	}
+	defer rows.Close()
+
+	orgs := make([]models.Organization, 0)
+	for rows.Next() {
+		var org models.Organization
+		if err := rows.Scan(&org.Id, &org.Name, &org.Role, &org.Accepted, &org.CreatedAt); err != nil {
+			return nil, fmt.Errorf("cannot scan organization: %w", err)
+		}
+		orgs = append(orgs, org)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read organizations: %w", err)
+	}
+
+	return orgs, nil
+}
+
+func (m *KeeperStorage) GetMember(ctx context.Context, orgId string, userId string) (models.Member, error) {
+	if !isUUID(orgId) {
+		return models.Member{}, fmt.Errorf("member of organization %s: %w", orgId, ErrNotFound)
+	}
+
+	member, err := scanMember(m.conn.QueryRowContext(ctx, getMember, orgId, userId))
+	if errors.Is(err, sql.ErrNoRows) {
+		return member, fmt.Errorf("member of organization %s: %w", orgId, ErrNotFound)
+	}
+	if err != nil {
+		return member, fmt.Errorf("cannot scan member: %w", err)
+	}
+
+	return member, nil
+}
+
+func (m *KeeperStorage) ListMembers(ctx context.Context, orgId string) ([]models.Member, error) {
+	if !isUUID(orgId) {
+		return make([]models.Member, 0), nil
+	}
+
+	return queryMembers(ctx, m.conn, orgId)
+}
+
+// queryMembers возвращает участников организации в порядке логинов
+func queryMembers(ctx context.Context, q querier, orgId string) ([]models.Member, error) {
+	rows, err := q.QueryContext(ctx, listMembers, orgId)
+	if err != nil {
+		return nil, fmt.Errorf("cannot query members: %w", err)
+	}
+	defer rows.Close()
+
+	members := make([]models.Member, 0)
+	for rows.Next() {
+		member, err := scanMember(rows)
+		if err != nil {
+			return nil, fmt.Errorf("cannot scan member: %w", err)
+		}
+		members = append(members, member)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read members: %w", err)
+	}
+
+	return members, nil
+}
+
+func (m *KeeperStorage) InviteMember(ctx context.Context, orgId string, request models.InviteRequest) (models.Member, error) {
+	tx, err := m.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Member{}, fmt.Errorf("cannot begin transaction: %w", err)
+	}
+
+	defer tx.Rollback()
+
+	if err := m.lockOrganization(ctx, tx, orgId); err != nil {
+		return models.Member{}, err
+	}
+
+	userId, _, err := getRecipient(ctx, tx, request.Login)
+	if err != nil {
+		return models.Member{}, err
+	}
+
+	_, err = scanMember(tx.QueryRowContext(ctx, getMember, orgId, userId))
+	if err == nil {
+		return models.Member{}, fmt.Errorf("member %s: %w", request.Login, ErrAlreadyExist)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return models.Member{}, fmt.Errorf("cannot scan member: %w", err)
+	}
+
+	//Приглашенный получает все версии ключей, чтобы читать данные, сохраненные до смены ключа
+	collections, err := orgCollections(ctx, tx, orgId)
+	if err != nil {
+		return models.Member{}, err
+	}
+	expected := make([]models.CollectionKey, 0)
+	for collectionId, keyVersion := range collections {
+		for version := int64(1); version <= keyVersion; version++ {
+			expected = append(expected, models.CollectionKey{Collection: collectionId, Version: version})
+		}
+	}
+	if err := matchKeys(request.Keys, expected); err != nil {
+		return models.Member{}, err
+	}
+
+	if _, err := tx.ExecContext(ctx, addMember, orgId, userId, request.Role, false, time.Now().UTC()); err != nil {
+		return models.Member{}, fmt.Errorf("cannot execute add member: %w", err)
+	}
+	for _, key := range request.Keys {
+		if _, err := tx.ExecContext(ctx, addCollectionKey, key.Collection, userId, key.Version, key.Key); err != nil {
+			return models.Member{}, fmt.Errorf("cannot execute add collection key: %w", err)
+		}
+	}
+
+	member, err := scanMember(tx.QueryRowContext(ctx, getMember, orgId, userId))
+	if err != nil {
+		return member, fmt.Errorf("cannot scan member: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return member, fmt.Errorf("cannot comit transaction: %w", err)
+	}
+
+	return member, nil
+}
+
+func (m *KeeperStorage) AcceptInvitation(ctx context.Context, orgId string, userId string) error {
+	if !isUUID(orgId) {
+		return fmt.Errorf("member of organization %s: %w", orgId, ErrNotFound)
+	}
+
+	res, err := m.conn.ExecContext(ctx, acceptInvitation, orgId, userId)
+	if err != nil {
+		return fmt.Errorf("cannot execute accept invitation: %w", err)
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("cannot get updated members: %w", err)
+	} else if n == 0 {
+		return fmt.Errorf("member of organization %s: %w", orgId, ErrNotFound)
+	}
+
+	return nil
+}
+
+func (m *KeeperStorage) SetMemberRole(ctx context.Context, orgId string, login string, role models.OrgRole) error {
+	tx, err := m.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("cannot begin transaction: %w", err)
+	}
+
+	defer tx.Rollback()
+
+	members, member, err := m.orgMember(ctx, tx, orgId, login)
+	if err != nil {
+		return err
+	}
+
+	if err := ownersLeft(members, login, role); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, setMemberRole, orgId, member.UserId, role); err != nil {
+		return fmt.Errorf("cannot execute set member role: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("cannot comit transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (m *KeeperStorage) RemoveMember(ctx context.Context, orgId string, login string, keys []models.CollectionKey) error {
+	tx, err := m.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("cannot begin transaction: %w", err)
+	}
+
+	defer tx.Rollback()
+
+	members, member, err := m.orgMember(ctx, tx, orgId, login)
+	if err != nil {
+		return err
+	}
+
+	if err := ownersLeft(members, login, ``); err != nil {
+		return err
+	}
+
+	//Участнику, принявшему приглашение, известны ключи: коллекции получают новую версию ключа
+	collections, err := orgCollections(ctx, tx, orgId)
+	if err != nil {
+		return err
+	}
+	expected := make([]models.CollectionKey, 0)
+	userIds := make(map[string]string, len(members))
+	if member.Accepted {
+		for collectionId, keyVersion := range collections {
+			for _, remaining := range members {
+				if remaining.Login != login {
+					expected = append(expected, models.CollectionKey{Collection: collectionId, Login: remaining.Login, Version: keyVersion + 1})
+					userIds[remaining.Login] = remaining.UserId
+				}
+			}
+		}
+	}
+	if err := matchKeys(keys, expected); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, deleteMemberKeys, orgId, member.UserId); err != nil {
+		return fmt.Errorf("cannot execute delete member keys: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, deleteMember, orgId, member.UserId); err != nil {
+		return fmt.Errorf("cannot execute delete member: %w", err)
+	}
+
+	if member.Accepted {
+		if _, err := tx.ExecContext(ctx, rotateCollectionKeys, orgId); err != nil {
+			return fmt.Errorf("cannot execute rotate collection keys: %w", err)
+		}
+		for _, key := range keys {
+			if _, err := tx.ExecContext(ctx, addCollectionKey, key.Collection, userIds[key.Login], key.Version, key.Key); err != nil {
+				return fmt.Errorf("cannot execute add collection key: %w", err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("cannot comit transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (m *KeeperStorage) CreateCollection(ctx context.Context, orgId string, request models.CollectionRequest) (models.Collection, error) {
+	collectionId, err := newUUID()
+	if err != nil {
+		return models.Collection{}, fmt.Errorf("cannot generate collection id: %w", err)
+	}
+
+	tx, err := m.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Collection{}, fmt.Errorf("cannot begin transaction: %w", err)
+	}
+
+	defer tx.Rollback()
+
+	if err := m.lockOrganization(ctx, tx, orgId); err != nil {
+		return models.Collection{}, err
+	}
+
+	members, err := queryMembers(ctx, tx, orgId)
+	if err != nil {
+		return models.Collection{}, err
+	}
+
+	//Ключ нужен каждому участнику, в том числе еще не принявшему приглашение
+	expected := make([]models.CollectionKey, 0, len(members))
+	userIds := make(map[string]string, len(members))
+	for _, member := range members {
+		expected = append(expected, models.CollectionKey{Login: member.Login})
+		userIds[member.Login] = member.UserId
+	}
+	if err := matchKeys(request.Keys, expected); err != nil {
+		return models.Collection{}, err
+	}
+
+	collection := models.Collection{
+		Id:           collectionId,
+		Organization: orgId,
+		Name:         request.Name,
+		KeyVersion:   1,
+		CreatedAt:    time.Now().UTC(),
+	}
+
+	if _, err := tx.ExecContext(ctx, createCollectionUser, collectionId, collectionLogin(collectionId)); err != nil {
+		return models.Collection{}, fmt.Errorf("cannot execute create collection user: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, createCollection, collectionId, orgId, request.Name, collection.CreatedAt); err != nil {
+		return models.Collection{}, fmt.Errorf("cannot execute create collection: %w", err)
+	}
+	for _, key := range request.Keys {
+		if _, err := tx.ExecContext(ctx, addCollectionKey, collectionId, userIds[key.Login], 1, key.Key); err != nil {
+			return models.Collection{}, fmt.Errorf("cannot execute add collection key: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.Collection{}, fmt.Errorf("cannot comit transaction: %w", err)
+	}
+
+	return collection, nil
+}
+
+func (m *KeeperStorage) ListCollections(ctx context.Context, orgId string, userId string) ([]models.Collection, error) {
+	collections := make([]models.Collection, 0)
+	if !isUUID(orgId) {
+		return collections, nil
+	}
+
+	rows, err := m.conn.QueryContext(ctx, listCollections, orgId, userId)
+	if err != nil {
+		return nil, fmt.Errorf("cannot query collections: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		collection, err := scanCollection(rows)
+		if err != nil {
+			return nil, fmt.Errorf("cannot scan collection: %w", err)
+		}
+		collections = append(collections, collection)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read collections: %w", err)
+	}
+
+	keys, err := queryCollectionKeys(ctx, m.conn, listOrgKeys, orgId, userId)
+	if err != nil {
+		return nil, err
+	}
+	for i := range collections {
+		for _, key := range keys {
+			if key.Collection == collections[i].Id {
+				collections[i].Keys = append(collections[i].Keys, key)
+			}
+		}
+	}
+
+	return collections, nil
+}
+
+func (m *KeeperStorage) GetCollection(ctx context.Context, userId string, collectionId string) (models.Collection, error) {
+	if !isUUID(collectionId) {
+		return models.Collection{}, fmt.Errorf("collection %s: %w", collectionId, ErrNotFound)
+	}
+
+	collection, err := scanCollection(m.conn.QueryRowContext(ctx, getCollection, collectionId, userId))
+	if errors.Is(err, sql.ErrNoRows) {
+		return collection, fmt.Errorf("collection %s: %w", collectionId, ErrNotFound)
+	}
+	if err != nil {
+		return collection, fmt.Errorf("cannot scan collection: %w", err)
+	}
+
+	collection.Keys, err = queryCollectionKeys(ctx, m.conn, getCollectionKeys, collectionId, userId)
+	if err != nil {
+		return collection, err
+	}
+
+	return collection, nil
+}
+
+// lockOrganization блокирует строку организации до конца транзакции, чтобы изменения участников
+// и коллекций одной организации проверяли ключи по согласованному составу
+func (m *KeeperStorage) lockOrganization(ctx context.Context, tx *sql.Tx, orgId string) error {
+	if !isUUID(orgId) {
+		return fmt.Errorf("organization %s: %w", orgId, ErrNotFound)
+	}
+
+	var id string
+	err := tx.QueryRowContext(ctx, lockOrganization+m.dialect.forUpdate, orgId).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("organization %s: %w", orgId, ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot lock organization: %w", err)
+	}
+
+	return nil
+}
+
+// orgMember блокирует организацию и возвращает ее участников и участника с логином login
+func (m *KeeperStorage) orgMember(ctx context.Context, tx *sql.Tx, orgId string, login string) ([]models.Member, models.Member, error) {
+	if err := m.lockOrganization(ctx, tx, orgId); err != nil {
+		return nil, models.Member{}, err
+	}
+
+	members, err := queryMembers(ctx, tx, orgId)
+	if err != nil {
+		return nil, models.Member{}, err
+	}
+
+	for _, member := range members {
+		if member.Login == login {
+			return members, member, nil
+		}
+	}
+
+	return nil, models.Member{}, fmt.Errorf("member %s: %w", login, ErrNotFound)
+}
+
+// orgCollections возвращает текущие версии ключей коллекций организации
+func orgCollections(ctx context.Context, tx *sql.Tx, orgId string) (map[string]int64, error) {
+	rows, err := tx.QueryContext(ctx, getOrgCollections, orgId)
+	if err != nil {
+		return nil, fmt.Errorf("cannot query collections: %w", err)
+	}
+	defer rows.Close()
+
+	collections := make(map[string]int64)
+	for rows.Next() {
+		var id string
+		var keyVersion int64
+		if err := rows.Scan(&id, &keyVersion); err != nil {
+			return nil, fmt.Errorf("cannot scan collection: %w", err)
+		}
+		collections[id] = keyVersion
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read collections: %w", err)
+	}
+
+	return collections, nil
+}
+
+// queryCollectionKeys возвращает ключи коллекций, зашифрованные для пользователя
+func queryCollectionKeys(ctx context.Context, q querier, query string, args ...any) ([]models.CollectionKey, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot query collection keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []models.CollectionKey
+	for rows.Next() {
+		var key models.CollectionKey
+		if err := rows.Scan(&key.Collection, &key.Version, &key.Key); err != nil {
+			return nil, fmt.Errorf("cannot scan collection key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read collection keys: %w", err)
+	}
+
+	return keys, nil
+}
+
+// scanMember разбирает строку участника, см. memberColumns
+func scanMember(row interface{ Scan(dest ...any) error }) (models.Member, error) {
+	var member models.Member
+	err := row.Scan(&member.Login, &member.Role, &member.Accepted, &member.CreatedAt, &member.UserId)
+	return member, err
+}
+
+// scanCollection разбирает строку коллекции с ролью пользователя
+func scanCollection(row interface{ Scan(dest ...any) error }) (models.Collection, error) {
+	var collection models.Collection
+	err := row.Scan(&collection.Id, &collection.Organization, &collection.Name, &collection.KeyVersion,
+		&collection.CreatedAt, &collection.Role)
+	return collection, err
+}
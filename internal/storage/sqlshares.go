@@ -0,0 +1,236 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lionslon/go-keepass/internal/models"
+	"time"
+)
+
+const (
+	setUserKeys  = `UPDATE users SET public_key = $2, private_key = $3 WHERE id = $1 AND public_key IS NULL`
+	getUserKeys  = `SELECT public_key, private_key FROM users WHERE id = $1`
+	getPublicKey = `SELECT id, public_key FROM users WHERE login = $1`
+	getLiveData  = `SELECT id FROM data WHERE user_id = $1 AND data_id = $2 AND deleted_at IS NULL`
+	upsertShare  = `
+		INSERT INTO shares (id, data_id, recipient_id, wrapped_key, permission, created_at) VALUES($1,$2,$3,$4,$5,$6)
+		ON CONFLICT (data_id, recipient_id) DO UPDATE SET wrapped_key = excluded.wrapped_key, permission = excluded.permission`
+	shareColumns = `
+		SELECT s.id, d.data_id, o.login, r.login, s.permission, s.wrapped_key, s.accepted, s.created_at, d.user_id, s.recipient_id
+		FROM shares s JOIN data d ON d.id = s.data_id JOIN users o ON o.id = d.user_id JOIN users r ON r.id = s.recipient_id
+		WHERE d.deleted_at IS NULL`
+	getDataShare      = shareColumns + ` AND s.data_id = $1 AND s.recipient_id = $2`
+	getShare          = shareColumns + ` AND s.id = $1 AND (d.user_id = $2 OR s.recipient_id = $2)`
+	listOutgoingShare = shareColumns + ` AND d.user_id = $1 ORDER BY d.data_id, r.login`
+	listIncomingShare = shareColumns + ` AND s.recipient_id = $1 ORDER BY o.login, d.data_id`
+	acceptShare       = `
+		UPDATE shares SET accepted = TRUE
+		WHERE id = $1 AND recipient_id = $2 AND data_id IN (SELECT id FROM data WHERE deleted_at IS NULL)`
+	deleteShare = `
+		DELETE FROM shares
+		WHERE id = $1 AND (recipient_id = $2 OR data_id IN (SELECT id FROM data WHERE user_id = $2))`
+)
+
+func (m *KeeperStorage) SetUserKeys(ctx context.Context, userId string, keys models.UserKeys) error {
+	res, err := m.conn.ExecContext(ctx, setUserKeys, userId, keys.PublicKey, keys.PrivateKey)
+	if err != nil {
+		return fmt.Errorf("cannot execute set user keys: %w", err)
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("cannot get updated rows: %w", err)
+	} else if n == 0 {
+		//Пользователь есть, значит, ключи уже сохранены
+		if _, err := m.GetUserKeys(ctx, userId); err != nil {
+			return err
+		}
+		return fmt.Errorf("user keys: %w", ErrAlreadyExist)
+	}
+
+	return nil
+}
+
+func (m *KeeperStorage) GetUserKeys(ctx context.Context, userId string) (models.UserKeys, error) {
+	var keys models.UserKeys
+
+	err := m.conn.QueryRowContext(ctx, getUserKeys, userId).Scan(&keys.PublicKey, &keys.PrivateKey)
+	if errors.Is(err, sql.ErrNoRows) {
+		return keys, fmt.Errorf("user %s: %w", userId, ErrNotFound)
+	}
+	if err != nil {
+		return keys, fmt.Errorf("cannot get user keys: %w", err)
+	}
+	if len(keys.PublicKey) == 0 {
+		return keys, fmt.Errorf("user keys: %w", ErrNotFound)
+	}
+
+	return keys, nil
+}
+
+func (m *KeeperStorage) GetPublicKey(ctx context.Context, login string) ([]byte, error) {
+	_, publicKey, err := getRecipient(ctx, m.conn, login)
+	return publicKey, err
+}
+
+// getRecipient возвращает идентификатор и открытый ключ пользователя по логину
+func getRecipient(ctx context.Context, q querier, login string) (string, []byte, error) {
+	var id string
+	var publicKey []byte
+
+	err := q.QueryRowContext(ctx, getPublicKey, login).Scan(&id, &publicKey)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ``, nil, fmt.Errorf("user %s: %w", login, ErrNotFound)
+	}
+	if err != nil {
+		return ``, nil, fmt.Errorf("cannot get user public key: %w", err)
+	}
+	if len(publicKey) == 0 {
+		return ``, nil, fmt.Errorf("public key of user %s: %w", login, ErrNotFound)
+	}
+
+	return id, publicKey, nil
+}
+
+func (m *KeeperStorage) ShareData(ctx context.Context, userId string, dataId string, request models.ShareRequest) (models.Share, error) {
+	tx, err := m.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Share{}, fmt.Errorf("cannot begin transaction: %w", err)
+	}
+
+	defer tx.Rollback()
+
+	var id string
+	err = tx.QueryRowContext(ctx, getLiveData, userId, dataId).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Share{}, fmt.Errorf("data %s: %w", dataId, ErrNotFound)
+	}
+	if err != nil {
+		return models.Share{}, fmt.Errorf("cannot get user data: %w", err)
+	}
+
+	recipientId, _, err := getRecipient(ctx, tx, request.Recipient)
+	if err != nil {
+		return models.Share{}, err
+	}
+	if recipientId == userId {
+		return models.Share{}, fmt.Errorf("cannot share data with its owner: %w", ErrForbidden)
+	}
+
+	shareId, err := newUUID()
+	if err != nil {
+		return models.Share{}, fmt.Errorf("cannot generate share id: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, upsertShare, shareId, id, recipientId, request.Key, request.Permission, time.Now().UTC())
+	if err != nil {
+		return models.Share{}, fmt.Errorf("cannot execute share data: %w", err)
+	}
+
+	share, err := scanShare(tx.QueryRowContext(ctx, getDataShare, id, recipientId))
+	if err != nil {
+		return share, fmt.Errorf("cannot scan share: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return share, fmt.Errorf("cannot comit transaction: %w", err)
+	}
+
+	share.Key = nil
+	return share, nil
+}
+
+func (m *KeeperStorage) ListShares(ctx context.Context, userId string) (models.ShareList, error) {
+	outgoing, err := m.queryShares(ctx, listOutgoingShare, userId)
+	if err != nil {
+		return models.ShareList{}, err
+	}
+
+	incoming, err := m.queryShares(ctx, listIncomingShare, userId)
+	if err != nil {
+		return models.ShareList{}, err
+	}
+
+	//Ключ данных нужен только получателю
+	for i := range outgoing {
+		outgoing[i].Key = nil
+	}
+
+	return models.ShareList{Outgoing: outgoing, Incoming: incoming}, nil
+}
+
+func (m *KeeperStorage) queryShares(ctx context.Context, query string, userId string) ([]models.Share, error) {
+	rows, err := m.conn.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, fmt.Errorf("cannot query shares: %w", err)
+	}
+	defer rows.Close()
+
+	shares := make([]models.Share, 0)
+	for rows.Next() {
+		share, err := scanShare(rows)
+		if err != nil {
+			return nil, fmt.Errorf("cannot scan share: %w", err)
+		}
+		shares = append(shares, share)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read shares: %w", err)
+	}
+
+	return shares, nil
+}
+
+func (m *KeeperStorage) GetShare(ctx context.Context, userId string, shareId string) (models.Share, error) {
+	if !isUUID(shareId) {
+		return models.Share{}, fmt.Errorf("share %s: %w", shareId, ErrNotFound)
+	}
+
+	share, err := scanShare(m.conn.QueryRowContext(ctx, getShare, shareId, userId))
+	if errors.Is(err, sql.ErrNoRows) {
+		return share, fmt.Errorf("share %s: %w", shareId, ErrNotFound)
+	}
+	if err != nil {
+		return share, fmt.Errorf("cannot scan share: %w", err)
+	}
+
+	return share, nil
+}
+
+func (m *KeeperStorage) AcceptShare(ctx context.Context, userId string, shareId string) error {
+	return m.execShare(ctx, acceptShare, userId, shareId)
+}
+
+func (m *KeeperStorage) DeleteShare(ctx context.Context, userId string, shareId string) error {
+	return m.execShare(ctx, deleteShare, userId, shareId)
+}
+
+// execShare выполняет изменение передачи, доступной пользователю
+func (m *KeeperStorage) execShare(ctx context.Context, query string, userId string, shareId string) error {
+	if !isUUID(shareId) {
+		return fmt.Errorf("share %s: %w", shareId, ErrNotFound)
+	}
+
+	res, err := m.conn.ExecContext(ctx, query, shareId, userId)
+	if err != nil {
+		return fmt.Errorf("cannot execute share request: %w", err)
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("cannot get updated shares: %w", err)
+	} else if n == 0 {
+		return fmt.Errorf("share %s: %w", shareId, ErrNotFound)
+	}
+
+	return nil
+}
+
+// scanShare разбирает строку передачи, см. shareColumns
+func scanShare(row interface{ Scan(dest ...any) error }) (models.Share, error) {
+	var share models.Share
+	err := row.Scan(&share.Id, &share.Identifier, &share.Owner, &share.Recipient, &share.Permission, &share.Key,
+		&share.Accepted, &share.CreatedAt, &share.OwnerId, &share.RecipientId)
+	return share, err
+}
@@ -3,82 +3,78 @@ package storage
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"github.com/lionslon/go-keepass/internal/models"
 )
 
 const (
 	checkUserExist = `SELECT COUNT(*) FROM users WHERE login = $1`
-	createUser     = `INSERT INTO users (login, password) VALUES($1,$2)`
-	getUser        = `SELECT id, password FROM users WHERE login = $1`
-	addData        = `INSERT INTO data (user_id, data_id, data) VALUES($1,$2, $3)`
-	getData        = `SELECT data FROM data WHERE user_id = $1 AND data_id = $2`
-	deleteData     = `DELETE FROM data WHERE user_id = $1 AND data_id = $2`
+	createUser     = `INSERT INTO users (id, login, password) VALUES($1,$2,$3)`
+	getUser        = `SELECT id, password FROM users WHERE login = $1 AND password IS NOT NULL`
 )
 
+// dialect описывает отличия SQL баз, с которыми работает KeeperStorage
+type dialect struct {
+	name              string           // название диалекта для сообщений
+	driver            string           // имя драйвера database/sql
+	maxOpenConns      int              // ограничение числа соединений (0 - без ограничения)
+	forUpdate         string           // суффикс SELECT для блокировки читаемых строк до конца транзакции
+	snapshot          *sql.TxOptions   // транзакция, в которой все запросы видят один снимок базы
+	isUniqueViolation func(error) bool // проверка ошибки нарушения уникальности
+
+	lockMigrations   func(ctx context.Context, conn *sql.Conn) error // блокировка на время применения миграций
+	unlockMigrations func(ctx context.Context, conn *sql.Conn) error // снятие блокировки миграций
+}
+
+// querier общие методы sql.DB и sql.Tx
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+var _ Storage = (*KeeperStorage)(nil)
+
+// KeeperStorage хранилище в SQL базе, конкретная база определяется диалектом.
 type KeeperStorage struct {
-	conn *sql.DB
+	conn    *sql.DB
+	dialect dialect
 }
 
-func NewKeeperStorage(dns string) (*KeeperStorage, error) {
-	conn, err := sql.Open("pgx", dns)
+func newSQLStorage(d dialect, dsn string) (*KeeperStorage, error) {
+	conn, err := openDB(d, dsn)
 	if err != nil {
-		return nil, fmt.Errorf("cannot create connection db: %w", err)
+		return nil, err
 	}
 
-	storage := &KeeperStorage{conn: conn}
+	storage := &KeeperStorage{conn: conn, dialect: d}
 	if err := storage.applyDBMigrations(context.Background()); err != nil {
-		return nil, fmt.Errorf("cannot apply migrations: %w", err)
+		conn.Close()
+		return nil, fmt.Errorf("cannot apply %s migrations: %w", d.name, err)
 	}
 	return storage, nil
 }
 
-func (m *KeeperStorage) applyDBMigrations(ctx context.Context) error {
-	tx, err := m.conn.BeginTx(ctx, nil)
+func openDB(d dialect, dsn string) (*sql.DB, error) {
+	conn, err := sql.Open(d.driver, dsn)
 	if err != nil {
-		return fmt.Errorf("cannot begin transaction: %w", err)
-	}
-
-	defer tx.Rollback()
-	// это для возможности генерации uuid
-	_, err = tx.ExecContext(ctx, `CREATE EXTENSION IF NOT EXISTS "uuid-ossp"`)
-	if err != nil {
-		return fmt.Errorf("cannot create uuid extension: %w", err)
+		return nil, fmt.Errorf("cannot create connection db: %w", err)
 	}
+	conn.SetMaxOpenConns(d.maxOpenConns)
 
-	// создаём таблицу для хранения пользователей
-	_, err = tx.ExecContext(ctx, `
-        CREATE TABLE IF NOT EXISTS users (
-			id uuid DEFAULT uuid_generate_v4 (),
-			login VARCHAR(255) UNIQUE NOT NULL,
-			password VARCHAR(255),
-			PRIMARY KEY (id)
-        )
-    `)
-	if err != nil {
-		return fmt.Errorf("cannot create users table: %w", err)
-	}
+	return conn, nil
+}
 
-	// создаём таблицу для хранения данных пользователя
-	_, err = tx.ExecContext(ctx, `
-		CREATE TABLE IF NOT EXISTS data (
-			id uuid DEFAULT uuid_generate_v4 (),
-			user_id uuid,
-			data_id VARCHAR(255) NOT NULL,
-			data BYTEA,
-			PRIMARY KEY (id),
-			FOREIGN KEY (user_id) REFERENCES users(id),
-			UNIQUE (user_id, data_id)
-			)
-    `)
+// applyDBMigrations доводит схему базы до последней версии
+func (m *KeeperStorage) applyDBMigrations(ctx context.Context) error {
+	migrator, err := newMigrator(m.conn, m.dialect)
 	if err != nil {
-		return fmt.Errorf("cannot create orders table: %w", err)
+		return err
 	}
 
-	// коммитим транзакцию
-	err = tx.Commit()
-	if err != nil {
-		return fmt.Errorf("cannot comit transaction: %w", err)
+	if _, err := migrator.Up(ctx, 0); err != nil {
+		return err
 	}
 	return nil
 }
@@ -101,16 +97,17 @@ func (m *KeeperStorage) CreateUser(ctx context.Context, dto models.AuthDTO) (str
 		return ``, fmt.Errorf("cannot generate password hash: %w", err)
 	}
 
-	_, err := m.conn.ExecContext(ctx, createUser, dto.Login, dto.Password)
+	uuid, err := newUUID()
 	if err != nil {
-		return ``, fmt.Errorf("cannot execute create request: %w", err)
+		return ``, fmt.Errorf("cannot generate user id: %w", err)
 	}
 
-	var uuid, password string
-	row := m.conn.QueryRowContext(ctx, getUser, dto.Login)
-	err = row.Scan(&uuid, &password)
+	_, err = m.conn.ExecContext(ctx, createUser, uuid, dto.Login, dto.Password)
+	if m.dialect.isUniqueViolation(err) {
+		return ``, fmt.Errorf("user %s: %w", dto.Login, ErrAlreadyExist)
+	}
 	if err != nil {
-		return ``, fmt.Errorf("cannot get created user id: %w", err)
+		return ``, fmt.Errorf("cannot execute create request: %w", err)
 	}
 
 	return uuid, nil
@@ -122,6 +119,9 @@ func (m *KeeperStorage) Login(ctx context.Context, dto models.AuthDTO) (string,
 
 	row := m.conn.QueryRowContext(ctx, getUser, dto.Login)
 	err := row.Scan(&uuid, &passwordHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ``, fmt.Errorf("cannot get user: %w", ErrNotFound)
+	}
 	if err != nil {
 		return ``, fmt.Errorf("cannot get user: %w", err)
 	}
@@ -133,35 +133,27 @@ func (m *KeeperStorage) Login(ctx context.Context, dto models.AuthDTO) (string,
 	return uuid, nil
 }
 
-func (m *KeeperStorage) AddData(ctx context.Context, userId string, dataId string, data []byte) error {
-
-	_, err := m.conn.ExecContext(ctx, addData, userId, dataId, data)
-	if err != nil {
-		return fmt.Errorf("cannot execute add new data: %w", err)
-	}
-
-	return nil
+// nullString пустую строку записывает как NULL
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ``}
 }
 
-func (m *KeeperStorage) GetData(ctx context.Context, userId string, dataId string) ([]byte, error) {
-
-	var data []byte
-
-	row := m.conn.QueryRowContext(ctx, getData, userId, dataId)
-	err := row.Scan(&data)
+// queryStrings возвращает значения единственного столбца результата запроса
+func queryStrings(ctx context.Context, q querier, query string, args ...any) ([]string, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("cannot scan data: %w", err)
+		return nil, err
 	}
-
-	return data, nil
-}
-
-func (m *KeeperStorage) DeleteData(ctx context.Context, userId string, dataId string) error {
-
-	_, err := m.conn.ExecContext(ctx, deleteData, userId, dataId)
-	if err != nil {
-		return fmt.Errorf("cannot execute delete user data: %w", err)
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
 	}
 
-	return nil
+	return values, rows.Err()
 }
@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lionslon/go-keepass/internal/models"
+)
+
+const (
+	nextChangeSeq = `UPDATE users SET change_seq = change_seq + 1 WHERE id = $1 RETURNING change_seq`
+	getSyncCursor = `SELECT change_seq, purged_seq FROM users WHERE id = $1`
+	getSyncData   = `
+		SELECT d.data_id, d.origin, d.revision, COALESCE(b.size, length(d.data), 0), d.metadata, d.created_at, d.updated_at, d.created_seq
+		FROM data d LEFT JOIN blobs b ON b.id = d.blob_id
+		WHERE d.user_id = $1 AND d.deleted_at IS NULL AND d.change_seq > $2 AND d.change_seq <= $3
+		ORDER BY d.change_seq`
+	getSyncDeleted = `
+		SELECT DISTINCT d.data_id FROM data d
+		WHERE d.user_id = $1 AND d.deleted_at IS NOT NULL AND d.change_seq > $2 AND d.change_seq <= $3
+		AND NOT EXISTS (
+			SELECT 1 FROM data l
+			WHERE l.user_id = d.user_id AND l.data_id = d.data_id AND l.deleted_at IS NULL AND l.change_seq <= $3
+		)
+		ORDER BY d.data_id`
+	updatePurgedSeq = `
+		UPDATE users SET purged_seq = d.change_seq FROM data d
+		WHERE d.id = $1 AND users.id = d.user_id AND users.purged_seq < d.change_seq`
+)
+
+// nextSeq выделяет номер следующего изменения данных пользователя. Строка пользователя остается
+// заблокированной до конца транзакции, поэтому изменения одного пользователя фиксируются в порядке номеров.
+// Номер выделяется первым в транзакции, чтобы блокировки всегда брались в одном порядке.
+func nextSeq(ctx context.Context, tx *sql.Tx, userId string) (int64, error) {
+	var seq int64
+
+	row := tx.QueryRowContext(ctx, nextChangeSeq, userId)
+	err := row.Scan(&seq)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("user %s: %w", userId, ErrNotFound)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("cannot get next change number: %w", err)
+	}
+
+	return seq, nil
+}
+
+func (m *KeeperStorage) GetChanges(ctx context.Context, userId string, since int64) (models.SyncChanges, error) {
+	changes := models.SyncChanges{
+		Created: make([]models.DataInfo, 0),
+		Updated: make([]models.DataInfo, 0),
+		Deleted: make([]string, 0),
+	}
+
+	//Курсор читается первым: все изменения с номерами до него уже зафиксированы,
+	//а более поздние попадут в следующий запрос
+	var purged int64
+	row := m.conn.QueryRowContext(ctx, getSyncCursor, userId)
+	err := row.Scan(&changes.Cursor, &purged)
+	if errors.Is(err, sql.ErrNoRows) {
+		return changes, fmt.Errorf("user %s: %w", userId, ErrNotFound)
+	}
+	if err != nil {
+		return changes, fmt.Errorf("cannot scan sync cursor: %w", err)
+	}
+
+	changes.Reset = resetSync(since, changes.Cursor, purged)
+	if changes.Reset {
+		since = 0
+	}
+
+	rows, err := m.conn.QueryContext(ctx, getSyncData, userId, since, changes.Cursor)
+	if err != nil {
+		return changes, fmt.Errorf("cannot query changed data: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var info models.DataInfo
+		var origin sql.NullString
+		var created int64
+		err := rows.Scan(&info.Identifier, &origin, &info.Revision, &info.Size, &info.Metadata, &info.CreatedAt, &info.UpdatedAt, &created)
+		if err != nil {
+			return changes, fmt.Errorf("cannot scan changed data: %w", err)
+		}
+		info.Origin = origin.String
+		addChange(&changes, info, created > since)
+	}
+
+	if err := rows.Err(); err != nil {
+		return changes, fmt.Errorf("cannot read changed data: %w", err)
+	}
+
+	if changes.Reset {
+		return changes, nil
+	}
+
+	changes.Deleted, err = queryStrings(ctx, m.conn, getSyncDeleted, userId, since, changes.Cursor)
+	if err != nil {
+		return changes, fmt.Errorf("cannot query deleted data: %w", err)
+	}
+	if changes.Deleted == nil {
+		changes.Deleted = make([]string, 0)
+	}
+
+	return changes, nil
+}
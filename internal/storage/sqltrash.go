@@ -0,0 +1,241 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lionslon/go-keepass/internal/models"
+	"time"
+)
+
+const (
+	//Следы перемещенных данных (moved) лежат в корзине только для синхронизации: пользователь их не видит,
+	//а удаляются они вместе с устаревшим содержимым корзины
+	trashColumns = `
+		SELECT d.id, d.data_id, d.origin, d.revision, COALESCE(b.size, length(d.data), 0), d.metadata, d.deleted_at
+		FROM data d LEFT JOIN blobs b ON b.id = d.blob_id`
+	listTrash       = trashColumns + ` WHERE d.user_id = $1 AND d.deleted_at IS NOT NULL AND NOT d.moved ORDER BY d.deleted_at DESC, d.data_id`
+	getTrash        = trashColumns + ` WHERE d.id = $1 AND d.user_id = $2 AND d.deleted_at IS NOT NULL AND NOT d.moved`
+	getTrashId      = `SELECT id FROM data WHERE id = $1 AND user_id = $2 AND deleted_at IS NOT NULL AND NOT moved`
+	getUserTrash    = `SELECT id FROM data WHERE user_id = $1 AND deleted_at IS NOT NULL AND NOT moved`
+	getExpiredTrash = `SELECT id FROM data WHERE user_id = $1 AND deleted_at IS NOT NULL AND deleted_at < $2`
+	getExpiredUsers = `SELECT DISTINCT user_id FROM data WHERE deleted_at IS NOT NULL AND deleted_at < $1`
+	lockUser        = `SELECT id FROM users WHERE id = $1`
+	restoreTrash    = `UPDATE data SET deleted_at = NULL, change_seq = $2, created_seq = $2 WHERE id = $1 AND deleted_at IS NOT NULL`
+)
+
+func (m *KeeperStorage) ListTrash(ctx context.Context, userId string) ([]models.TrashItem, error) {
+
+	rows, err := m.conn.QueryContext(ctx, listTrash, userId)
+	if err != nil {
+		return nil, fmt.Errorf("cannot query user trash: %w", err)
+	}
+	defer rows.Close()
+
+	items := make([]models.TrashItem, 0)
+	for rows.Next() {
+		item, err := scanTrashItem(rows)
+		if err != nil {
+			return nil, fmt.Errorf("cannot scan trash item: %w", err)
+		}
+		items = append(items, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read user trash: %w", err)
+	}
+
+	return items, nil
+}
+
+func (m *KeeperStorage) RestoreTrash(ctx context.Context, userId string, trashId string) (models.TrashItem, error) {
+	if !isUUID(trashId) {
+		return models.TrashItem{}, fmt.Errorf("trash item %s: %w", trashId, ErrNotFound)
+	}
+
+	item, err := scanTrashItem(m.conn.QueryRowContext(ctx, getTrash, trashId, userId))
+	if errors.Is(err, sql.ErrNoRows) {
+		return item, fmt.Errorf("trash item %s: %w", trashId, ErrNotFound)
+	}
+	if err != nil {
+		return item, fmt.Errorf("cannot scan trash item: %w", err)
+	}
+
+	tx, err := m.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return item, fmt.Errorf("cannot begin transaction: %w", err)
+	}
+
+	defer tx.Rollback()
+
+	seq, err := nextSeq(ctx, tx, userId)
+	if err != nil {
+		return item, err
+	}
+
+	//Пока данные в корзине, их ревизия не меняется, поэтому достаточно условия на deleted_at
+	res, err := tx.ExecContext(ctx, restoreTrash, trashId, seq)
+	if m.dialect.isUniqueViolation(err) {
+		return item, fmt.Errorf("data %s: %w", item.Identifier, ErrAlreadyExist)
+	}
+	if err != nil {
+		return item, fmt.Errorf("cannot execute restore trash: %w", err)
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return item, fmt.Errorf("cannot get restored rows: %w", err)
+	} else if n == 0 {
+		return item, fmt.Errorf("trash item %s: %w", trashId, ErrNotFound)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return item, fmt.Errorf("cannot comit transaction: %w", err)
+	}
+
+	return item, nil
+}
+
+func (m *KeeperStorage) DeleteTrash(ctx context.Context, userId string, trashId string) error {
+	if !isUUID(trashId) {
+		return fmt.Errorf("trash item %s: %w", trashId, ErrNotFound)
+	}
+
+	tx, err := m.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("cannot begin transaction: %w", err)
+	}
+
+	defer tx.Rollback()
+
+	if err := m.lockUser(ctx, tx, userId); err != nil {
+		return err
+	}
+
+	var id string
+	row := tx.QueryRowContext(ctx, getTrashId+m.dialect.forUpdate, trashId, userId)
+	err = row.Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("trash item %s: %w", trashId, ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot scan trash item: %w", err)
+	}
+
+	if err := purgeData(ctx, tx, id); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("cannot comit transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (m *KeeperStorage) EmptyTrash(ctx context.Context, userId string) (int64, error) {
+	return m.purgeTrash(ctx, userId, getUserTrash, userId)
+}
+
+func (m *KeeperStorage) PurgeTrash(ctx context.Context, before time.Time) (int64, error) {
+	users, err := queryStrings(ctx, m.conn, getExpiredUsers, before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("cannot get users with expired trash: %w", err)
+	}
+
+	//Корзина каждого пользователя очищается своей транзакцией
+	var count int64
+	for _, userId := range users {
+		n, err := m.purgeTrash(ctx, userId, getExpiredTrash, userId, before.UTC())
+		if err != nil {
+			return count, err
+		}
+		count += n
+	}
+
+	return count, nil
+}
+
+// purgeTrash окончательно удаляет данные из корзины пользователя, идентификаторы которых возвращает запрос query
+func (m *KeeperStorage) purgeTrash(ctx context.Context, userId string, query string, args ...any) (int64, error) {
+	tx, err := m.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("cannot begin transaction: %w", err)
+	}
+
+	defer tx.Rollback()
+
+	if err := m.lockUser(ctx, tx, userId); err != nil {
+		return 0, err
+	}
+
+	ids, err := queryStrings(ctx, tx, query+m.dialect.forUpdate, args...)
+	if err != nil {
+		return 0, fmt.Errorf("cannot get trash items: %w", err)
+	}
+
+	for _, id := range ids {
+		if err := purgeData(ctx, tx, id); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("cannot comit transaction: %w", err)
+	}
+
+	return int64(len(ids)), nil
+}
+
+// lockUser блокирует строку пользователя до конца транзакции. Изменения данных блокируют ее первой (см. nextSeq),
+// поэтому окончательное удаление, меняющее пользователя, тоже начинается с нее.
+func (m *KeeperStorage) lockUser(ctx context.Context, tx *sql.Tx, userId string) error {
+	var id string
+
+	row := tx.QueryRowContext(ctx, lockUser+m.dialect.forUpdate, userId)
+	err := row.Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("user %s: %w", userId, ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot lock user: %w", err)
+	}
+
+	return nil
+}
+
+// purgeData окончательно удаляет строку данных, историю ревизий и содержимое загрузок.
+// Номер удаления запоминается у пользователя: курсоры синхронизации до него больше не видят удаление.
+func purgeData(ctx context.Context, tx *sql.Tx, id string) error {
+
+	if _, err := tx.ExecContext(ctx, updatePurgedSeq, id); err != nil {
+		return fmt.Errorf("cannot execute update purged change: %w", err)
+	}
+
+	//Содержимое загрузок не удаляется каскадом вместе с данными, запоминаем его до удаления
+	blobs, err := queryStrings(ctx, tx, getDataBlobs, id)
+	if err != nil {
+		return fmt.Errorf("cannot get data content: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, deleteData, id); err != nil {
+		return fmt.Errorf("cannot execute delete user data: %w", err)
+	}
+
+	for _, blob := range blobs {
+		if _, err := tx.ExecContext(ctx, deleteBlob, blob); err != nil {
+			return fmt.Errorf("cannot delete data content: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// scanTrashItem разбирает строку корзины: id, data_id, origin, revision, размер содержимого, metadata, deleted_at
+func scanTrashItem(row interface{ Scan(dest ...any) error }) (models.TrashItem, error) {
+	var item models.TrashItem
+	var origin sql.NullString
+	err := row.Scan(&item.Id, &item.Identifier, &origin, &item.Revision, &item.Size, &item.Metadata, &item.DeletedAt)
+	item.Origin = origin.String
+	return item, err
+}
@@ -0,0 +1,259 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	addBlob    = `INSERT INTO blobs (id, user_id, size, created_at) VALUES($1,$2,$3,$4)`
+	deleteBlob = `DELETE FROM blobs WHERE id = $1`
+	addChunk   = `INSERT INTO blob_chunks (blob_id, start, data) VALUES($1,$2,$3)`
+	getChunk   = `SELECT data FROM blob_chunks WHERE blob_id = $1 AND start = $2`
+	addUpload  = `
+		INSERT INTO uploads (id, data_id, metadata, expected_revision, create_only, attachment, mime_type, attachment_key)
+		VALUES($1,$2,$3,$4,$5,$6,$7,$8)`
+	deleteUpload = `DELETE FROM uploads WHERE id = $1`
+	getUpload    = `
+		SELECT u.data_id, b.size, u.uploaded, u.metadata, u.expected_revision, u.create_only, u.attachment, u.mime_type, u.attachment_key
+		FROM uploads u JOIN blobs b ON b.id = u.id WHERE u.id = $1 AND b.user_id = $2`
+	// purgeUploads части и строки загрузок удаляются каскадом, содержимое завершенных загрузок строк в uploads не имеет
+	purgeUploads   = `DELETE FROM blobs WHERE created_at < $1 AND id IN (SELECT id FROM uploads)`
+	getUploaded    = `SELECT uploaded FROM uploads WHERE id = $1`
+	updateUploaded = `UPDATE uploads SET uploaded = $2 WHERE id = $1`
+)
+
+func (m *KeeperStorage) WriteContent(ctx context.Context, entry Entry, w io.Writer) error {
+	if entry.blob == `` {
+		if _, err := w.Write(entry.Data); err != nil {
+			return fmt.Errorf("cannot write content: %w", err)
+		}
+		return nil
+	}
+
+	//Каждую часть читаем отдельным запросом, чтобы не держать соединение с базой, пока медленный клиент читает ответ
+	for start := int64(0); start < entry.Size; {
+		var chunk []byte
+
+		row := m.conn.QueryRowContext(ctx, getChunk, entry.blob, start)
+		if err := row.Scan(&chunk); err != nil {
+			return fmt.Errorf("cannot get content chunk at %d: %w", start, err)
+		}
+
+		if _, err := w.Write(chunk); err != nil {
+			return fmt.Errorf("cannot write content: %w", err)
+		}
+		start += int64(len(chunk))
+	}
+
+	return nil
+}
+
+func (m *KeeperStorage) CreateUpload(ctx context.Context, userId string, upload Upload) (string, error) {
+
+	id, err := newUUID()
+	if err != nil {
+		return ``, fmt.Errorf("cannot generate upload id: %w", err)
+	}
+
+	tx, err := m.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return ``, fmt.Errorf("cannot begin transaction: %w", err)
+	}
+
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, addBlob, id, userId, upload.Size, time.Now().UTC()); err != nil {
+		return ``, fmt.Errorf("cannot execute add blob: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, addUpload, id, upload.DataId, upload.Metadata, upload.Expected, upload.CreateOnly,
+		nullString(upload.Attachment), nullString(upload.MimeType), upload.Key)
+	if err != nil {
+		return ``, fmt.Errorf("cannot execute add upload: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return ``, fmt.Errorf("cannot comit transaction: %w", err)
+	}
+
+	return id, nil
+}
+
+func (m *KeeperStorage) GetUpload(ctx context.Context, userId string, uploadId string) (Upload, error) {
+	return m.upload(ctx, m.conn, userId, uploadId)
+}
+
+func (m *KeeperStorage) upload(ctx context.Context, q querier, userId string, uploadId string) (Upload, error) {
+	var upload Upload
+	var attachment, mimeType sql.NullString
+
+	row := q.QueryRowContext(ctx, getUpload, uploadId, userId)
+	err := row.Scan(&upload.DataId, &upload.Size, &upload.Uploaded, &upload.Metadata, &upload.Expected, &upload.CreateOnly,
+		&attachment, &mimeType, &upload.Key)
+	if errors.Is(err, sql.ErrNoRows) {
+		return upload, fmt.Errorf("upload %s: %w", uploadId, ErrNotFound)
+	}
+	if err != nil {
+		return upload, fmt.Errorf("cannot scan upload: %w", err)
+	}
+	upload.Attachment, upload.MimeType = attachment.String, mimeType.String
+
+	return upload, nil
+}
+
+func (m *KeeperStorage) AppendUpload(ctx context.Context, userId string, uploadId string, offset int64, r io.Reader) (int64, error) {
+
+	upload, err := m.GetUpload(ctx, userId, uploadId)
+	if err != nil {
+		return 0, err
+	}
+	if upload.Uploaded != offset {
+		return upload.Uploaded, fmt.Errorf("upload %s has %d bytes, got offset %d: %w", uploadId, upload.Uploaded, offset, ErrOffsetMismatch)
+	}
+
+	//Каждая часть сохраняется своей транзакцией: тело запроса читается из сети долго,
+	//а прерванная загрузка должна продолжиться с последней сохраненной части
+	return writeChunks(r, offset, upload.Size, func(start int64, chunk []byte) error {
+		return m.appendChunk(ctx, uploadId, start, chunk)
+	})
+}
+
+func (m *KeeperStorage) appendChunk(ctx context.Context, uploadId string, start int64, chunk []byte) error {
+	tx, err := m.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("cannot begin transaction: %w", err)
+	}
+
+	defer tx.Rollback()
+
+	//Параллельная загрузка с того же смещения дождется нас и получит несовпадение смещения
+	var uploaded int64
+	row := tx.QueryRowContext(ctx, getUploaded+m.dialect.forUpdate, uploadId)
+	err = row.Scan(&uploaded)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("upload %s: %w", uploadId, ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot scan upload: %w", err)
+	}
+	if uploaded != start {
+		return fmt.Errorf("upload %s has %d bytes, got offset %d: %w", uploadId, uploaded, start, ErrOffsetMismatch)
+	}
+
+	if _, err := tx.ExecContext(ctx, addChunk, uploadId, start, chunk); err != nil {
+		return fmt.Errorf("cannot execute add chunk: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, updateUploaded, uploadId, start+int64(len(chunk))); err != nil {
+		return fmt.Errorf("cannot execute update upload: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("cannot comit transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (m *KeeperStorage) CompleteUpload(ctx context.Context, userId string, uploadId string) (int64, error) {
+	tx, err := m.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("cannot begin transaction: %w", err)
+	}
+
+	defer tx.Rollback()
+
+	seq, err := nextSeq(ctx, tx, userId)
+	if err != nil {
+		return 0, err
+	}
+
+	upload, err := m.upload(ctx, tx, userId, uploadId)
+	if err != nil {
+		return 0, err
+	}
+	if upload.Uploaded != upload.Size {
+		return 0, fmt.Errorf("upload %s is incomplete: %d of %d bytes", uploadId, upload.Uploaded, upload.Size)
+	}
+
+	next := Entry{Metadata: upload.Metadata, blob: uploadId}
+
+	var revision int64
+	current, err := m.currentData(ctx, tx, userId, upload.DataId)
+	switch {
+	case upload.Attachment != ``:
+		//Вложение добавляется только к существующим данным
+		if err == nil {
+			revision, err = attachUpload(ctx, tx, current, uploadId, upload)
+		}
+	case errors.Is(err, ErrNotFound) && upload.Expected == 0:
+		revision = 1
+		err = m.insertData(ctx, tx, userId, upload.DataId, next, seq)
+	case err != nil:
+	case upload.CreateOnly:
+		err = fmt.Errorf("data %s: %w", upload.DataId, ErrAlreadyExist)
+	case upload.Expected != 0 && upload.Expected != current.Revision:
+		err = fmt.Errorf("data %s revision %d, expected %d: %w", upload.DataId, current.Revision, upload.Expected, ErrRevisionMismatch)
+	default:
+		if next.Metadata == nil {
+			next.Metadata = current.Metadata
+		}
+		revision, err = m.replaceData(ctx, tx, current, next, seq)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.ExecContext(ctx, deleteUpload, uploadId); err != nil {
+		return 0, fmt.Errorf("cannot execute delete upload: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("cannot comit transaction: %w", err)
+	}
+
+	return revision, nil
+}
+
+func (m *KeeperStorage) DeleteUpload(ctx context.Context, userId string, uploadId string) error {
+	tx, err := m.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("cannot begin transaction: %w", err)
+	}
+
+	defer tx.Rollback()
+
+	if _, err := m.upload(ctx, tx, userId, uploadId); err != nil {
+		return err
+	}
+
+	//Части и сама загрузка удаляются каскадом
+	if _, err := tx.ExecContext(ctx, deleteBlob, uploadId); err != nil {
+		return fmt.Errorf("cannot execute delete blob: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("cannot comit transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (m *KeeperStorage) PurgeUploads(ctx context.Context, before time.Time) (int64, error) {
+	result, err := m.conn.ExecContext(ctx, purgeUploads, before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("cannot execute purge uploads: %w", err)
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("cannot get purged uploads count: %w", err)
+	}
+
+	return count, nil
+}
@@ -0,0 +1,31 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"github.com/lionslon/go-keepass/internal/models"
+)
+
+const (
+	// getUsage объем считается по данным и метаданным всех ревизий; содержимое загрузок -
+	// по таблице blobs, где каждое содержимое учитывается один раз, сколько бы ревизий на него ни ссылалось
+	getUsage = `
+		SELECT
+			(SELECT COUNT(*) FROM data WHERE user_id = $1 AND deleted_at IS NULL),
+			(SELECT CAST(COALESCE(SUM(COALESCE(length(data), 0) + COALESCE(length(metadata), 0)), 0) AS BIGINT)
+				FROM data WHERE user_id = $1)
+			+ (SELECT CAST(COALESCE(SUM(COALESCE(length(r.data), 0) + COALESCE(length(r.metadata), 0)), 0) AS BIGINT)
+				FROM data_revisions r JOIN data d ON d.id = r.data_id WHERE d.user_id = $1)
+			+ (SELECT CAST(COALESCE(SUM(size), 0) AS BIGINT) FROM blobs WHERE user_id = $1)`
+)
+
+func (m *KeeperStorage) GetUsage(ctx context.Context, userId string) (models.Usage, error) {
+	var usage models.Usage
+
+	row := m.conn.QueryRowContext(ctx, getUsage, userId)
+	if err := row.Scan(&usage.Entries, &usage.Bytes); err != nil {
+		return usage, fmt.Errorf("cannot scan user usage: %w", err)
+	}
+
+	return usage, nil
+}
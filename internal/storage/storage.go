@@ -0,0 +1,287 @@
+// Package storage содержит реализации хранилища пользователей и их данных.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/lionslon/go-keepass/internal/models"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	memScheme = "mem://"
+)
+
+var (
+	// ErrNotFound возвращается, если запрошенные данные отсутствуют в хранилище
+	ErrNotFound = errors.New("not found")
+	// ErrAlreadyExist возвращается при попытке повторно сохранить данные с тем же идентификатором
+	ErrAlreadyExist = errors.New("already exist")
+	// ErrRevisionMismatch возвращается, если текущая ревизия данных отличается от ожидаемой
+	ErrRevisionMismatch = errors.New("revision mismatch")
+	// ErrOffsetMismatch возвращается, если смещение части загрузки не совпадает с уже загруженным объемом
+	ErrOffsetMismatch = errors.New("upload offset mismatch")
+	// ErrUploadTooLarge возвращается при попытке загрузить больше объявленного размера
+	ErrUploadTooLarge = errors.New("upload exceeds declared size")
+	// ErrForbidden возвращается, если у пользователя нет прав на операцию с общими данными
+	ErrForbidden = errors.New("forbidden")
+	// ErrKeysMismatch возвращается, если переданные ключи коллекций не соответствуют коллекциям
+	// и участникам организации, например, участников успели изменить
+	ErrKeysMismatch = errors.New("collection keys mismatch")
+)
+
+// Entry сохраненные данные пользователя, содержимое зашифровано клиентом
+type Entry struct {
+	Data     []byte // данные, если они хранятся целиком (содержимое загрузки читается через WriteContent)
+	Metadata []byte // метаданные (может отсутствовать)
+	Revision int64  // номер ревизии
+	Size     int64  // размер содержимого
+	Origin   string // идентификатор до перемещения, от которого получен ключ данных (пусто - не перемещались)
+
+	blob string // идентификатор содержимого, загруженного по частям
+}
+
+// Upload загрузка содержимого данных по частям
+type Upload struct {
+	DataId     string // идентификатор данных
+	Size       int64  // полный размер содержимого
+	Uploaded   int64  // загружено байт
+	Metadata   []byte // метаданные новой ревизии (nil - сохранить текущие)
+	Expected   int64  // ожидаемая ревизия данных (0 - без проверки)
+	CreateOnly bool   // только создание новых данных, как If-None-Match: * (для вложения - нового вложения)
+
+	Attachment string // имя вложения, которое загружается вместо новой ревизии данных (пусто - ревизия)
+	MimeType   string // тип содержимого вложения
+	Key        []byte // ключ вложения, зашифрованный ключом данных
+}
+
+// Поля сортировки списка данных
+const (
+	SortByIdentifier = "identifier"
+	SortByCreated    = "created"
+	SortByUpdated    = "updated"
+	SortBySize       = "size"
+)
+
+// ListOptions параметры выборки списка данных пользователя
+type ListOptions struct {
+	Sort   string // поле сортировки, одно из SortBy*
+	Desc   bool   // сортировка по убыванию
+	Limit  int    // размер страницы
+	Offset int    // смещение от начала списка
+	Folder string // только данные в папке и ее вложенных папках (пусто - все данные)
+}
+
+// UserStorage операции с пользователями: регистрация и вход
+type UserStorage interface {
+	// IsUserExist проверяет наличие пользователя с указанным логином
+	IsUserExist(ctx context.Context, login string) bool
+	// CreateUser создает пользователя и возвращает его идентификатор
+	CreateUser(ctx context.Context, dto models.AuthDTO) (string, error)
+	// Login проверяет логин и пароль пользователя и возвращает его идентификатор
+	Login(ctx context.Context, dto models.AuthDTO) (string, error)
+}
+
+// DataStorage операции с данными пользователя или коллекции и историей их ревизий
+type DataStorage interface {
+	// AddData сохраняет новые данные пользователя и их метаданные
+	AddData(ctx context.Context, userId string, dataId string, data, metadata []byte) error
+	// UpdateData сохраняет новую ревизию данных, предыдущая остается в истории.
+	// Если metadata равно nil, метаданные переносятся из текущей ревизии.
+	// Если expected не 0, обновление выполняется только при совпадении текущей ревизии с expected.
+	// Возвращает номер новой ревизии.
+	UpdateData(ctx context.Context, userId string, dataId string, data, metadata []byte, expected int64) (int64, error)
+	// UpdateMetadata сохраняет новую ревизию с измененными метаданными и прежними данными
+	UpdateMetadata(ctx context.Context, userId string, dataId string, metadata []byte, expected int64) (int64, error)
+	// GetData возвращает текущую ревизию данных пользователя
+	GetData(ctx context.Context, userId string, dataId string) (Entry, error)
+	// ListData возвращает страницу списка данных пользователя и общее количество данных
+	ListData(ctx context.Context, userId string, opts ListOptions) ([]models.DataInfo, int64, error)
+	// GetDataRevisions возвращает список всех ревизий данных, включая текущую
+	GetDataRevisions(ctx context.Context, userId string, dataId string) ([]models.DataRevision, error)
+	// GetDataRevision возвращает указанную ревизию данных
+	GetDataRevision(ctx context.Context, userId string, dataId string, revision int64) (Entry, error)
+	// DeleteData переносит данные пользователя в корзину вместе с историей ревизий.
+	// Если expected не 0, удаление выполняется только при совпадении текущей ревизии с expected.
+	DeleteData(ctx context.Context, userId string, dataId string, expected int64) error
+	// MoveData переносит данные под новый идентификатор вместе с историей ревизий, номер ревизии не меняется.
+	// Ключ данных по-прежнему получается из прежнего идентификатора (Entry.Origin), синхронизация видит
+	// перемещение как удаление прежнего идентификатора и создание нового. Если данные с идентификатором to
+	// уже есть, возвращает ErrAlreadyExist.
+	MoveData(ctx context.Context, userId string, from string, to string, expected int64) error
+	// RekeyData меняет идентификатор, от которого получен ключ данных (Entry.Origin), например, после отзыва
+	// передачи. Ревизия не меняется, синхронизация видит данные измененными.
+	RekeyData(ctx context.Context, userId string, dataId string, origin string, expected int64) error
+	// WriteContent пишет в w содержимое ревизии, полученной из GetData или GetDataRevision.
+	// Содержимое загрузок читается частями, не целиком в память.
+	WriteContent(ctx context.Context, entry Entry, w io.Writer) error
+}
+
+// FolderStorage операции с папками
+type FolderStorage interface {
+	// CreateFolder создает пустую папку. Если папка уже есть, в том числе следует из идентификаторов данных,
+	// возвращает ErrAlreadyExist.
+	CreateFolder(ctx context.Context, userId string, path string) error
+	// ListFolders возвращает папки пользователя по алфавиту: созданные явно и следующие из идентификаторов данных
+	ListFolders(ctx context.Context, userId string) ([]models.Folder, error)
+	// MoveFolder переносит папку со всем содержимым и вложенными папками в to и возвращает количество
+	// перенесенных данных. Если папка to уже есть, возвращает ErrAlreadyExist.
+	MoveFolder(ctx context.Context, userId string, from string, to string) (int64, error)
+	// DeleteFolder переносит все данные папки и ее вложенных папок в корзину, удаляет папки
+	// и возвращает количество удаленных данных
+	DeleteFolder(ctx context.Context, userId string, path string) (int64, error)
+}
+
+// TrashStorage операции с корзиной
+type TrashStorage interface {
+	// ListTrash возвращает содержимое корзины пользователя, последние удаленные данные первыми
+	ListTrash(ctx context.Context, userId string) ([]models.TrashItem, error)
+	// RestoreTrash возвращает данные из корзины. Если данные с тем же идентификатором
+	// уже созданы заново, возвращает ErrAlreadyExist.
+	RestoreTrash(ctx context.Context, userId string, trashId string) (models.TrashItem, error)
+	// DeleteTrash окончательно удаляет данные из корзины
+	DeleteTrash(ctx context.Context, userId string, trashId string) error
+	// EmptyTrash окончательно удаляет все данные из корзины пользователя и возвращает их количество
+	EmptyTrash(ctx context.Context, userId string) (int64, error)
+	// PurgeTrash окончательно удаляет данные всех пользователей, попавшие в корзину раньше before,
+	// и возвращает их количество
+	PurgeTrash(ctx context.Context, before time.Time) (int64, error)
+}
+
+// UploadStorage операции загрузки содержимого по частям
+type UploadStorage interface {
+	// CreateUpload начинает загрузку содержимого данных по частям и возвращает ее идентификатор
+	CreateUpload(ctx context.Context, userId string, upload Upload) (string, error)
+	// GetUpload возвращает состояние загрузки
+	GetUpload(ctx context.Context, userId string, uploadId string) (Upload, error)
+	// AppendUpload дописывает к загрузке содержимое из r, если уже загружено ровно offset байт.
+	// Принятые части сохраняются и при ошибке чтения r. Возвращает новый объем загруженного.
+	AppendUpload(ctx context.Context, userId string, uploadId string, offset int64, r io.Reader) (int64, error)
+	// CompleteUpload сохраняет полностью загруженное содержимое новой ревизией данных
+	// (или новыми данными) с проверкой условий загрузки и возвращает номер ревизии.
+	// Вложение заменяет одноименное вложение данных, ревизия данных при этом не меняется.
+	CompleteUpload(ctx context.Context, userId string, uploadId string) (int64, error)
+	// DeleteUpload отменяет незавершенную загрузку
+	DeleteUpload(ctx context.Context, userId string, uploadId string) error
+	// PurgeUploads удаляет незавершенные загрузки всех пользователей, начатые раньше before,
+	// вместе с загруженными частями и возвращает их количество
+	PurgeUploads(ctx context.Context, before time.Time) (int64, error)
+}
+
+// AttachmentStorage операции с вложениями данных
+type AttachmentStorage interface {
+	// ListAttachments возвращает вложения неудаленных данных по имени, без ключей
+	ListAttachments(ctx context.Context, userId string, dataId string) ([]models.Attachment, error)
+	// GetAttachment возвращает вложение с ключом и его содержимое для WriteContent (Entry.Origin - как у данных)
+	GetAttachment(ctx context.Context, userId string, dataId string, name string) (models.Attachment, Entry, error)
+	// DeleteAttachment окончательно удаляет вложение вместе с содержимым
+	DeleteAttachment(ctx context.Context, userId string, dataId string, name string) error
+}
+
+// SyncStorage журнал изменений для синхронизации
+type SyncStorage interface {
+	// GetChanges возвращает изменения данных пользователя с номерами больше since и новый курсор.
+	// Если since не подходит для частичной синхронизации, возвращает все данные с признаком Reset.
+	GetChanges(ctx context.Context, userId string, since int64) (models.SyncChanges, error)
+}
+
+// UsageStorage занятое пользователем место для квот
+type UsageStorage interface {
+	// GetUsage возвращает количество данных пользователя и объем всего, что он хранит:
+	// ревизий с историей, корзины и объявленный размер незавершенных загрузок
+	GetUsage(ctx context.Context, userId string) (models.Usage, error)
+}
+
+// ShareStorage ключи пользователей и передача данных между ними
+type ShareStorage interface {
+	// SetUserKeys сохраняет пару ключей пользователя. Если ключи уже сохранены, возвращает ErrAlreadyExist:
+	// замена ключей сделала бы недоступными данные, уже переданные пользователю.
+	SetUserKeys(ctx context.Context, userId string, keys models.UserKeys) error
+	// GetUserKeys возвращает пару ключей пользователя, ErrNotFound - ключи еще не сохранены
+	GetUserKeys(ctx context.Context, userId string) (models.UserKeys, error)
+	// GetPublicKey возвращает открытый ключ пользователя по логину
+	GetPublicKey(ctx context.Context, login string) ([]byte, error)
+	// ShareData передает данные пользователя получателю. Если данные уже переданы этому получателю,
+	// меняются права и ключ, а принятая передача остается принятой. Ключ в результате не возвращается.
+	ShareData(ctx context.Context, userId string, dataId string, request models.ShareRequest) (models.Share, error)
+	// ListShares возвращает данные, переданные пользователем, и данные, полученные им.
+	// Данные в корзине не показываются, ключ возвращается только в полученных данных.
+	ListShares(ctx context.Context, userId string) (models.ShareList, error)
+	// GetShare возвращает передачу неудаленных данных, в которой пользователь владелец или получатель
+	GetShare(ctx context.Context, userId string, shareId string) (models.Share, error)
+	// AcceptShare отмечает, что получатель принял переданные ему данные
+	AcceptShare(ctx context.Context, userId string, shareId string) error
+	// DeleteShare удаляет передачу: владелец отзывает доступ, получатель отказывается от данных
+	DeleteShare(ctx context.Context, userId string, shareId string) error
+}
+
+// OrgStorage организации, их участники и коллекции
+type OrgStorage interface {
+	// CreateOrganization создает организацию, пользователь становится ее владельцем
+	CreateOrganization(ctx context.Context, userId string, name string) (models.Organization, error)
+	// ListOrganizations возвращает организации пользователя, включая непринятые приглашения
+	ListOrganizations(ctx context.Context, userId string) ([]models.Organization, error)
+	// GetMember возвращает участника организации по идентификатору пользователя
+	GetMember(ctx context.Context, orgId string, userId string) (models.Member, error)
+	// ListMembers возвращает участников организации, включая приглашенных
+	ListMembers(ctx context.Context, orgId string) ([]models.Member, error)
+	// InviteMember приглашает пользователя в организацию. Ключи должны содержать все версии ключей
+	// всех коллекций, иначе возвращается ErrKeysMismatch.
+	InviteMember(ctx context.Context, orgId string, request models.InviteRequest) (models.Member, error)
+	// AcceptInvitation отмечает, что пользователь принял приглашение в организацию
+	AcceptInvitation(ctx context.Context, orgId string, userId string) error
+	// SetMemberRole меняет роль участника. Если в организации не останется владельца, возвращает ErrForbidden.
+	SetMemberRole(ctx context.Context, orgId string, login string, role models.OrgRole) error
+	// RemoveMember удаляет участника и его ключи. Если участник принял приглашение, keys - новая версия
+	// ключа каждой коллекции для каждого оставшегося участника, иначе keys должен быть пустым;
+	// при несовпадении возвращается ErrKeysMismatch. Последнего владельца удалить нельзя (ErrForbidden).
+	RemoveMember(ctx context.Context, orgId string, login string, keys []models.CollectionKey) error
+	// CreateCollection создает коллекцию организации с ключом для каждого участника
+	CreateCollection(ctx context.Context, orgId string, request models.CollectionRequest) (models.Collection, error)
+	// ListCollections возвращает коллекции организации с ключами пользователя
+	ListCollections(ctx context.Context, orgId string, userId string) ([]models.Collection, error)
+	// GetCollection возвращает коллекцию с ролью пользователя, ErrNotFound - коллекции нет
+	// или пользователь не принял приглашение в ее организацию
+	GetCollection(ctx context.Context, userId string, collectionId string) (models.Collection, error)
+}
+
+// Storage описывает все операции хранилища. Обработчики сервера зависят только от тех
+// интерфейсов, методами которых пользуются.
+type Storage interface {
+	UserStorage
+	DataStorage
+	FolderStorage
+	TrashStorage
+	UploadStorage
+	AttachmentStorage
+	SyncStorage
+	UsageStorage
+	ShareStorage
+	OrgStorage
+	// Close освобождает ресурсы хранилища
+	Close()
+}
+
+// New создает хранилище, выбирая реализацию по схеме dsn:
+// mem:// - хранилище в памяти, sqlite:// - файл базы SQLite, иначе - PostgreSQL.
+func New(dsn string) (Storage, error) {
+	switch {
+	case strings.HasPrefix(dsn, memScheme):
+		return NewMemStorage(), nil
+	case strings.HasPrefix(dsn, sqliteScheme):
+		storage, err := NewSQLiteStorage(dsn)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create sqlite storage: %w", err)
+		}
+		return storage, nil
+	default:
+		storage, err := NewKeeperStorage(dsn)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create postgres storage: %w", err)
+		}
+		return storage, nil
+	}
+}
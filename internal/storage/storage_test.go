@@ -0,0 +1,247 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lionslon/go-keepass/internal/models"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testStorages реализации хранилища, на которых проверяется одинаковое поведение:
+// в памяти, в файле SQLite и, если задана переменная KEEPER_TEST_POSTGRES_DSN, в PostgreSQL
+var testStorages = map[string]func(t *testing.T) Storage{
+	"mem": func(t *testing.T) Storage {
+		return NewMemStorage()
+	},
+	"sqlite": func(t *testing.T) Storage {
+		return migratedStorage(t, sqliteScheme+filepath.Join(t.TempDir(), "keeper.db"))
+	},
+}
+
+func init() {
+	if dsn := os.Getenv("KEEPER_TEST_POSTGRES_DSN"); dsn != `` {
+		testStorages["postgres"] = func(t *testing.T) Storage {
+			return migratedStorage(t, postgresTestSchema(t, dsn))
+		}
+	}
+}
+
+// migratedStorage применяет к базе dsn все миграции и открывает хранилище
+func migratedStorage(t *testing.T, dsn string) Storage {
+	t.Helper()
+
+	migrator, err := OpenMigrator(dsn)
+	if err != nil {
+		t.Fatalf("OpenMigrator() error = %v", err)
+	}
+	defer migrator.Close()
+	if _, err := migrator.Up(context.Background(), 0); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+
+	storage, err := New(dsn)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	t.Cleanup(storage.Close)
+	return storage
+}
+
+// postgresTestSchema создает для теста отдельную схему в базе dsn (в формате URL)
+// и возвращает dsn, в котором она выбрана; схема удаляется по окончании теста
+func postgresTestSchema(t *testing.T, dsn string) string {
+	t.Helper()
+
+	conn, err := sql.Open(postgresDialect.driver, dsn)
+	if err != nil {
+		t.Fatalf("cannot open postgres: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	id, err := newUUID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := "keeper_test_" + strings.ReplaceAll(id, "-", "")
+	if _, err := conn.Exec(`CREATE SCHEMA ` + schema); err != nil {
+		t.Fatalf("cannot create schema: %v", err)
+	}
+	t.Cleanup(func() {
+		if _, err := conn.Exec(`DROP SCHEMA ` + schema + ` CASCADE`); err != nil {
+			t.Errorf("cannot drop schema %s: %v", schema, err)
+		}
+	})
+
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatalf("KEEPER_TEST_POSTGRES_DSN must be url: %v", err)
+	}
+	query := u.Query()
+	query.Set("search_path", schema)
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
+
+// forEachStorage запускает тест на каждой реализации хранилища с новым пользователем
+func forEachStorage(t *testing.T, test func(t *testing.T, ctx context.Context, s Storage, userId string)) {
+	for name, open := range testStorages {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			s := open(t)
+
+			userId, err := s.CreateUser(ctx, models.AuthDTO{Login: "alice", Password: "password"})
+			if err != nil {
+				t.Fatalf("CreateUser() error = %v", err)
+			}
+
+			test(t, ctx, s, userId)
+		})
+	}
+}
+
+func TestStorageUsers(t *testing.T) {
+	for name, open := range testStorages {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			s := open(t)
+
+			if s.IsUserExist(ctx, "alice") {
+				t.Error("IsUserExist() before create = true, want false")
+			}
+
+			userId, err := s.CreateUser(ctx, models.AuthDTO{Login: "alice", Password: "password"})
+			if err != nil {
+				t.Fatalf("CreateUser() error = %v", err)
+			}
+			if !s.IsUserExist(ctx, "alice") {
+				t.Error("IsUserExist() = false, want true")
+			}
+			if s.IsUserExist(ctx, "bob") {
+				t.Error("IsUserExist() other login = true, want false")
+			}
+
+			if _, err := s.CreateUser(ctx, models.AuthDTO{Login: "alice", Password: "other"}); !errors.Is(err, ErrAlreadyExist) {
+				t.Errorf("CreateUser() duplicate error = %v, want %v", err, ErrAlreadyExist)
+			}
+
+			got, err := s.Login(ctx, models.AuthDTO{Login: "alice", Password: "password"})
+			if err != nil {
+				t.Fatalf("Login() error = %v", err)
+			}
+			if got != userId {
+				t.Errorf("Login() = %q, want %q", got, userId)
+			}
+
+			//Повторная регистрация не меняет пароль
+			if _, err := s.Login(ctx, models.AuthDTO{Login: "alice", Password: "other"}); err == nil {
+				t.Error("Login() wrong password error = nil, want error")
+			}
+			if _, err := s.Login(ctx, models.AuthDTO{Login: "bob", Password: "password"}); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Login() unknown user error = %v, want %v", err, ErrNotFound)
+			}
+		})
+	}
+}
+
+// TestMemStorageConcurrent проверяет одновременную работу с хранилищем в памяти, запускается с -race
+func TestMemStorageConcurrent(t *testing.T) {
+	ctx := context.Background()
+	s, err := New(memScheme)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer s.Close()
+
+	shared, err := s.CreateUser(ctx, models.AuthDTO{Login: "shared", Password: "password"})
+	if err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	if err := s.AddData(ctx, shared, "counter", []byte("0"), nil); err != nil {
+		t.Fatalf("AddData() error = %v", err)
+	}
+
+	const workers, updates = 8, 20
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for i := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- func() error {
+				login := fmt.Sprintf("user%d", i)
+				userId, err := s.CreateUser(ctx, models.AuthDTO{Login: login, Password: "password"})
+				if err != nil {
+					return err
+				}
+				if _, err := s.Login(ctx, models.AuthDTO{Login: login, Password: "password"}); err != nil {
+					return err
+				}
+				//Повторную регистрацию того же логина принимает только один запрос
+				if _, err := s.CreateUser(ctx, models.AuthDTO{Login: "race", Password: "password"}); err != nil && !errors.Is(err, ErrAlreadyExist) {
+					return err
+				}
+
+				for j := range updates {
+					dataId := fmt.Sprintf("data%d", j)
+					if err := s.AddData(ctx, userId, dataId, []byte(dataId), nil); err != nil {
+						return err
+					}
+					if _, err := s.UpdateData(ctx, shared, "counter", []byte(dataId), nil, 0); err != nil {
+						return err
+					}
+					if _, err := s.GetData(ctx, shared, "counter"); err != nil {
+						return err
+					}
+					if _, _, err := s.ListData(ctx, userId, ListOptions{}); err != nil {
+						return err
+					}
+					s.IsUserExist(ctx, "race")
+				}
+				return nil
+			}()
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("concurrent access error = %v", err)
+		}
+	}
+
+	entry, err := s.GetData(ctx, shared, "counter")
+	if err != nil {
+		t.Fatalf("GetData() error = %v", err)
+	}
+	if entry.Revision != 1+workers*updates {
+		t.Errorf("GetData() revision = %d, want %d", entry.Revision, 1+workers*updates)
+	}
+
+	revisions, err := s.GetDataRevisions(ctx, shared, "counter")
+	if err != nil {
+		t.Fatalf("GetDataRevisions() error = %v", err)
+	}
+	if len(revisions) != 1+workers*updates {
+		t.Errorf("GetDataRevisions() = %d revisions, want %d", len(revisions), 1+workers*updates)
+	}
+
+	for i := range workers {
+		userId, err := s.Login(ctx, models.AuthDTO{Login: fmt.Sprintf("user%d", i), Password: "password"})
+		if err != nil {
+			t.Fatalf("Login() error = %v", err)
+		}
+		if _, total, err := s.ListData(ctx, userId, ListOptions{}); err != nil || total != updates {
+			t.Errorf("ListData() = %d, %v, want %d", total, err, updates)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package storage
+
+import "github.com/lionslon/go-keepass/internal/models"
+
+// resetSync проверяет, нужна ли клиенту полная синхронизация: курсор не указан,
+// относится к изменениям, уже удаленным из корзины окончательно, или выдан не этим сервером
+func resetSync(since, cursor, purged int64) bool {
+	return since <= 0 || since < purged || since > cursor
+}
+
+// addChange добавляет данные в созданные или измененные
+func addChange(changes *models.SyncChanges, info models.DataInfo, created bool) {
+	if created {
+		changes.Created = append(changes.Created, info)
+	} else {
+		changes.Updated = append(changes.Updated, info)
+	}
+}
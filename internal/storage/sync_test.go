@@ -0,0 +1,149 @@
+package storage
+
+import (
+	"context"
+	"github.com/lionslon/go-keepass/internal/models"
+	"slices"
+	"testing"
+	"time"
+)
+
+// changedIds идентификаторы данных из списка изменений
+func changedIds(infos []models.DataInfo) []string {
+	ids := make([]string, 0, len(infos))
+	for _, info := range infos {
+		ids = append(ids, info.Identifier)
+	}
+	return ids
+}
+
+// checkChanges сравнивает изменения с ожидаемыми
+func checkChanges(t *testing.T, name string, got models.SyncChanges, reset bool, created, updated, deleted []string) {
+	t.Helper()
+
+	if got.Reset != reset {
+		t.Errorf("GetChanges() %s reset = %v, want %v", name, got.Reset, reset)
+	}
+	if ids := changedIds(got.Created); !slices.Equal(ids, created) {
+		t.Errorf("GetChanges() %s created = %v, want %v", name, ids, created)
+	}
+	if ids := changedIds(got.Updated); !slices.Equal(ids, updated) {
+		t.Errorf("GetChanges() %s updated = %v, want %v", name, ids, updated)
+	}
+	if !slices.Equal(got.Deleted, deleted) {
+		t.Errorf("GetChanges() %s deleted = %v, want %v", name, got.Deleted, deleted)
+	}
+}
+
+func TestStorageChanges(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, ctx context.Context, s Storage, userId string) {
+		changes, err := s.GetChanges(ctx, userId, 0)
+		if err != nil {
+			t.Fatalf("GetChanges() error = %v", err)
+		}
+		if changes.Cursor != 0 {
+			t.Errorf("GetChanges() empty cursor = %d, want 0", changes.Cursor)
+		}
+		checkChanges(t, "empty", changes, true, []string{}, []string{}, []string{})
+
+		for _, dataId := range []string{"a", "b"} {
+			if err := s.AddData(ctx, userId, dataId, []byte(dataId), nil); err != nil {
+				t.Fatalf("AddData() error = %v", err)
+			}
+		}
+		first, err := s.GetChanges(ctx, userId, 0)
+		if err != nil {
+			t.Fatalf("GetChanges() error = %v", err)
+		}
+		if first.Cursor != 2 {
+			t.Errorf("GetChanges() cursor = %d, want 2", first.Cursor)
+		}
+		checkChanges(t, "full", first, true, []string{"a", "b"}, []string{}, []string{})
+
+		//Каждое изменение сдвигает курсор, изменения возвращаются по порядку номеров
+		if _, err := s.UpdateData(ctx, userId, "a", []byte("a2"), nil, 0); err != nil {
+			t.Fatalf("UpdateData() error = %v", err)
+		}
+		if err := s.DeleteData(ctx, userId, "b", 0); err != nil {
+			t.Fatalf("DeleteData() error = %v", err)
+		}
+		if err := s.AddData(ctx, userId, "c", []byte("c"), nil); err != nil {
+			t.Fatalf("AddData() error = %v", err)
+		}
+
+		delta, err := s.GetChanges(ctx, userId, first.Cursor)
+		if err != nil {
+			t.Fatalf("GetChanges() error = %v", err)
+		}
+		if delta.Cursor != 5 {
+			t.Errorf("GetChanges() delta cursor = %d, want 5", delta.Cursor)
+		}
+		checkChanges(t, "delta", delta, false, []string{"c"}, []string{"a"}, []string{"b"})
+
+		//С актуальным курсором изменений нет, курсор не меняется
+		current, err := s.GetChanges(ctx, userId, delta.Cursor)
+		if err != nil {
+			t.Fatalf("GetChanges() error = %v", err)
+		}
+		if current.Cursor != delta.Cursor {
+			t.Errorf("GetChanges() current cursor = %d, want %d", current.Cursor, delta.Cursor)
+		}
+		checkChanges(t, "current", current, false, []string{}, []string{}, []string{})
+
+		//Курсор, который этот сервер не выдавал, сбрасывает синхронизацию
+		future, err := s.GetChanges(ctx, userId, delta.Cursor+100)
+		if err != nil {
+			t.Fatalf("GetChanges() error = %v", err)
+		}
+		checkChanges(t, "future cursor", future, true, []string{"a", "c"}, []string{}, []string{})
+
+		//Удаленные и созданные заново данные - создание, а не удаление
+		if err := s.AddData(ctx, userId, "b", []byte("b2"), nil); err != nil {
+			t.Fatalf("AddData() recreate error = %v", err)
+		}
+		recreated, err := s.GetChanges(ctx, userId, first.Cursor)
+		if err != nil {
+			t.Fatalf("GetChanges() error = %v", err)
+		}
+		checkChanges(t, "recreated", recreated, false, []string{"c", "b"}, []string{"a"}, []string{})
+
+		//Окончательное удаление из корзины делает устаревшими курсоры до удаления
+		if _, err := s.PurgeTrash(ctx, time.Now().Add(time.Hour)); err != nil {
+			t.Fatalf("PurgeTrash() error = %v", err)
+		}
+		expired, err := s.GetChanges(ctx, userId, first.Cursor)
+		if err != nil {
+			t.Fatalf("GetChanges() error = %v", err)
+		}
+		checkChanges(t, "expired cursor", expired, true, []string{"a", "c", "b"}, []string{}, []string{})
+
+		//Курсор после удаления остается действительным
+		valid, err := s.GetChanges(ctx, userId, delta.Cursor)
+		if err != nil {
+			t.Fatalf("GetChanges() error = %v", err)
+		}
+		checkChanges(t, "cursor after purge", valid, false, []string{"b"}, []string{}, []string{})
+	})
+}
+
+func TestStorageChangesIsolated(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, ctx context.Context, s Storage, userId string) {
+		other, err := s.CreateUser(ctx, models.AuthDTO{Login: "bob", Password: "password"})
+		if err != nil {
+			t.Fatalf("CreateUser() error = %v", err)
+		}
+		if err := s.AddData(ctx, other, "mail", []byte("bob"), nil); err != nil {
+			t.Fatalf("AddData() error = %v", err)
+		}
+
+		//Курсор у каждого пользователя свой
+		changes, err := s.GetChanges(ctx, userId, 0)
+		if err != nil {
+			t.Fatalf("GetChanges() error = %v", err)
+		}
+		if changes.Cursor != 0 {
+			t.Errorf("GetChanges() other user cursor = %d, want 0", changes.Cursor)
+		}
+		checkChanges(t, "other user", changes, true, []string{}, []string{}, []string{})
+	})
+}
@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStorageTrash(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, ctx context.Context, s Storage, userId string) {
+		for _, dataId := range []string{"mail", "vpn", "bank"} {
+			if err := s.AddData(ctx, userId, dataId, []byte(dataId), []byte("meta "+dataId)); err != nil {
+				t.Fatalf("AddData(%s) error = %v", dataId, err)
+			}
+			if err := s.DeleteData(ctx, userId, dataId, 0); err != nil {
+				t.Fatalf("DeleteData(%s) error = %v", dataId, err)
+			}
+		}
+
+		items, err := s.ListTrash(ctx, userId)
+		if err != nil {
+			t.Fatalf("ListTrash() error = %v", err)
+		}
+		if len(items) != 3 {
+			t.Fatalf("ListTrash() = %d items, want 3", len(items))
+		}
+		trashIds := make(map[string]string)
+		for _, item := range items {
+			trashIds[item.Identifier] = item.Id
+		}
+
+		//Восстановление возвращает данные с историей, но не поверх созданных заново
+		item, err := s.RestoreTrash(ctx, userId, trashIds["mail"])
+		if err != nil {
+			t.Fatalf("RestoreTrash() error = %v", err)
+		}
+		if item.Identifier != "mail" || item.Revision != 1 {
+			t.Errorf("RestoreTrash() = %+v, want mail revision 1", item)
+		}
+		entry, err := s.GetData(ctx, userId, "mail")
+		if err != nil {
+			t.Fatalf("GetData() restored error = %v", err)
+		}
+		if !bytes.Equal(entry.Data, []byte("mail")) || !bytes.Equal(entry.Metadata, []byte("meta mail")) {
+			t.Errorf("GetData() restored = %q, %q", entry.Data, entry.Metadata)
+		}
+		if _, err := s.RestoreTrash(ctx, userId, trashIds["mail"]); !errors.Is(err, ErrNotFound) {
+			t.Errorf("RestoreTrash() twice error = %v, want %v", err, ErrNotFound)
+		}
+
+		if err := s.AddData(ctx, userId, "vpn", []byte("vpn v2"), nil); err != nil {
+			t.Fatalf("AddData() error = %v", err)
+		}
+		if _, err := s.RestoreTrash(ctx, userId, trashIds["vpn"]); !errors.Is(err, ErrAlreadyExist) {
+			t.Errorf("RestoreTrash() over new data error = %v, want %v", err, ErrAlreadyExist)
+		}
+
+		if err := s.DeleteTrash(ctx, userId, trashIds["bank"]); err != nil {
+			t.Fatalf("DeleteTrash() error = %v", err)
+		}
+		if _, err := s.RestoreTrash(ctx, userId, trashIds["bank"]); !errors.Is(err, ErrNotFound) {
+			t.Errorf("RestoreTrash() deleted error = %v, want %v", err, ErrNotFound)
+		}
+
+		//Срок хранения еще не истек
+		purged, err := s.PurgeTrash(ctx, time.Now().Add(-time.Hour))
+		if err != nil {
+			t.Fatalf("PurgeTrash() error = %v", err)
+		}
+		if purged != 0 {
+			t.Errorf("PurgeTrash() before deletion = %d, want 0", purged)
+		}
+
+		purged, err = s.PurgeTrash(ctx, time.Now().Add(time.Hour))
+		if err != nil {
+			t.Fatalf("PurgeTrash() error = %v", err)
+		}
+		if purged != 1 {
+			t.Errorf("PurgeTrash() = %d, want 1", purged)
+		}
+
+		items, err = s.ListTrash(ctx, userId)
+		if err != nil {
+			t.Fatalf("ListTrash() error = %v", err)
+		}
+		if len(items) != 0 {
+			t.Errorf("ListTrash() after purge = %+v, want empty", items)
+		}
+	})
+}
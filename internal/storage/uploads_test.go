@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStoragePurgeUploads(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, ctx context.Context, s Storage, userId string) {
+		content := bytes.Repeat([]byte{0x5a}, 1000)
+
+		//Брошенная загрузка с частью содержимого
+		abandoned, err := s.CreateUpload(ctx, userId, Upload{DataId: "video", Size: int64(len(content))})
+		if err != nil {
+			t.Fatalf("CreateUpload() error = %v", err)
+		}
+		if _, err := s.AppendUpload(ctx, userId, abandoned, 0, bytes.NewReader(content[:400])); err != nil {
+			t.Fatalf("AppendUpload() error = %v", err)
+		}
+
+		//Завершенная загрузка остается содержимым данных
+		completed, err := s.CreateUpload(ctx, userId, Upload{DataId: "photo", Size: int64(len(content))})
+		if err != nil {
+			t.Fatalf("CreateUpload() error = %v", err)
+		}
+		if _, err := s.AppendUpload(ctx, userId, completed, 0, bytes.NewReader(content)); err != nil {
+			t.Fatalf("AppendUpload() error = %v", err)
+		}
+		if _, err := s.CompleteUpload(ctx, userId, completed); err != nil {
+			t.Fatalf("CompleteUpload() error = %v", err)
+		}
+
+		usage, err := s.GetUsage(ctx, userId)
+		if err != nil {
+			t.Fatalf("GetUsage() error = %v", err)
+		}
+		if usage.Bytes != 2*int64(len(content)) {
+			t.Errorf("GetUsage() bytes = %d, want %d", usage.Bytes, 2*len(content))
+		}
+
+		//Загрузки моложе срока хранения не удаляются
+		purged, err := s.PurgeUploads(ctx, time.Now().Add(-time.Hour))
+		if err != nil {
+			t.Fatalf("PurgeUploads() error = %v", err)
+		}
+		if purged != 0 {
+			t.Errorf("PurgeUploads() recent = %d, want 0", purged)
+		}
+
+		purged, err = s.PurgeUploads(ctx, time.Now().Add(time.Hour))
+		if err != nil {
+			t.Fatalf("PurgeUploads() error = %v", err)
+		}
+		if purged != 1 {
+			t.Errorf("PurgeUploads() = %d, want 1", purged)
+		}
+
+		if _, err := s.GetUpload(ctx, userId, abandoned); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetUpload() purged error = %v, want %v", err, ErrNotFound)
+		}
+
+		usage, err = s.GetUsage(ctx, userId)
+		if err != nil {
+			t.Fatalf("GetUsage() error = %v", err)
+		}
+		if usage.Bytes != int64(len(content)) {
+			t.Errorf("GetUsage() bytes after purge = %d, want %d", usage.Bytes, len(content))
+		}
+
+		entry, err := s.GetData(ctx, userId, "photo")
+		if err != nil {
+			t.Fatalf("GetData() error = %v", err)
+		}
+		var buf bytes.Buffer
+		if err := s.WriteContent(ctx, entry, &buf); err != nil {
+			t.Fatalf("WriteContent() error = %v", err)
+		}
+		if !bytes.Equal(buf.Bytes(), content) {
+			t.Errorf("WriteContent() = %d bytes, want completed content", buf.Len())
+		}
+	})
+}
@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"crypto/rand"
+	"fmt"
+)
+
+// newUUID генерирует случайный UUID версии 4.
+func newUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return ``, fmt.Errorf("cannot read random bytes: %w", err)
+	}
+
+	b[6] = (b[6] & 0x0f) | 0x40 // версия 4
+	b[8] = (b[8] & 0x3f) | 0x80 // вариант RFC 4122
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
+
+// isUUID проверяет, что s - uuid в том виде, в котором его возвращает newUUID.
+// PostgreSQL отвергает сравнение столбца uuid с произвольной строкой ошибкой, а не пустым результатом.
+func isUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i, c := range s {
+		switch {
+		case i == 8 || i == 13 || i == 18 || i == 23:
+			if c != '-' {
+				return false
+			}
+		case '0' <= c && c <= '9', 'a' <= c && c <= 'f', 'A' <= c && c <= 'F':
+		default:
+			return false
+		}
+	}
+	return true
+}